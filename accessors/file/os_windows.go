@@ -69,17 +69,28 @@ func NewOSFileInfo(base os.FileInfo, path *accessors.OSPath) *OSFileInfo {
 	}
 }
 
+// Names with unpaired surrogates are escaped so they survive
+// serialization (see utils.EscapeSurrogates).
+func (self *OSFileInfo) Name() string {
+	return utils.EscapeSurrogates(self.FileInfo.Name())
+}
+
 func (self *OSFileInfo) FullPath() string {
 	return self._full_path.String()
 }
 
+// The path to pass to the OS APIs.
+func (self *OSFileInfo) apiPath() string {
+	return toAPIPath(self._full_path.String())
+}
+
 func (self *OSFileInfo) OSPath() *accessors.OSPath {
 	return self._full_path
 }
 
 func (self *OSFileInfo) Data() *ordereddict.Dict {
 	if self.IsLink() {
-		target, err := os.Readlink(self.FullPath())
+		target, err := os.Readlink(self.apiPath())
 		if err == nil {
 			return ordereddict.NewDict().
 				Set("Link", target)
@@ -119,7 +130,7 @@ func (self *OSFileInfo) GetLink() (*accessors.OSPath, error) {
 		return nil, errors.New("Not following links")
 	}
 
-	target, err := os.Readlink(self.FullPath())
+	target, err := os.Readlink(self.apiPath())
 	if err != nil {
 		return nil, err
 	}
@@ -130,6 +141,12 @@ func (self *OSFileInfo) sys() *syscall.Win32FileAttributeData {
 	return self.Sys().(*syscall.Win32FileAttributeData)
 }
 
+// Convert a serialized path into the form passed to the OS: We use
+// extended length paths so long and unusual names can be accessed.
+func toAPIPath(path string) string {
+	return utils.ToLongPath(utils.UnescapeSurrogates(path))
+}
+
 type OSFileSystemAccessor struct {
 	follow_links bool
 }
@@ -211,7 +228,7 @@ func (self OSFileSystemAccessor) ReadDirWithOSPath(
 	// needed for windows since paths that do not end with a \\
 	// are interpreted incorrectly. Example readdir("c:") is not
 	// the same as readdir("c:\\")
-	dir_path := full_path.String() + "\\"
+	dir_path := toAPIPath(full_path.String()) + "\\"
 
 	// Windows symlinks are buggy - a ReadDir() of a link to a
 	// directory fails and the caller needs to specially check for
@@ -237,13 +254,13 @@ func (self OSFileSystemAccessor) ReadDirWithOSPath(
 		}
 
 		// Maybe it is a symlink
-		link_path := full_path.String()
+		link_path := toAPIPath(full_path.String())
 		target, err := os.Readlink(link_path)
 		if err == nil {
 
 			// Yes it is a symlink, we just recurse into
 			// the target
-			files, err = utils.ReadDir(target)
+			files, err = utils.ReadDir(utils.ToLongPath(target))
 		}
 	}
 
@@ -252,7 +269,8 @@ func (self OSFileSystemAccessor) ReadDirWithOSPath(
 			&OSFileInfo{
 				follow_links: self.follow_links,
 				FileInfo:     f,
-				_full_path:   full_path.Append(f.Name()),
+				_full_path: full_path.Append(
+					utils.EscapeSurrogates(f.Name())),
 			})
 	}
 	return result, nil
@@ -303,7 +321,7 @@ func (self OSFileSystemAccessor) OpenWithOSPath(full_path *accessors.OSPath) (
 		return utils.NewReadSeekReaderAdapter(reader), err
 	}
 
-	filename := full_path.String()
+	filename := toAPIPath(full_path.String())
 
 	// The API does not accept filenames with trailing \\ for an open call.
 	filename = strings.TrimSuffix(filename, "\\")
@@ -322,7 +340,7 @@ func (self *OSFileSystemAccessor) Lstat(path string) (accessors.FileInfo, error)
 	if err != nil {
 		return nil, err
 	}
-	stat, err := os.Lstat(full_path.String())
+	stat, err := os.Lstat(toAPIPath(full_path.String()))
 	return &OSFileInfo{
 		follow_links: self.follow_links,
 		FileInfo:     stat,
@@ -349,7 +367,7 @@ func (self *OSFileSystemAccessor) LstatWithOSPath(full_path *accessors.OSPath) (
 		return nil, errors.New("Not found")
 	}
 
-	stat, err := os.Lstat(full_path.String())
+	stat, err := os.Lstat(toAPIPath(full_path.String()))
 	return &OSFileInfo{
 		follow_links: self.follow_links,
 		FileInfo:     stat,
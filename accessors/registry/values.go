@@ -127,3 +127,9 @@ loopItems:
 	}
 	return names, nil
 }
+
+// Read and parse a value from an open key.
+func GetValue(key registry.Key, value_name string) (interface{}, error) {
+	_, _, value, err := getValue(key, value_name)
+	return value, err
+}
@@ -125,6 +125,11 @@ const (
 	// Allowed raw datastore access
 	DATASTORE_ACCESS
 
+	// This is not a permission that can be granted to a role. When
+	// an artifact requires it, each collection must be approved by
+	// a second user before it can be scheduled.
+	DUAL_AUTHORIZATION
+
 	// When adding new permission - update CheckAccess,
 	// GetRolePermissions and acl.proto
 )
@@ -185,6 +190,8 @@ func (self ACL_PERMISSION) String() string {
 		return "DELETE_RESULTS"
 	case DATASTORE_ACCESS:
 		return "DATASTORE_ACCESS"
+	case DUAL_AUTHORIZATION:
+		return "DUAL_AUTHORIZATION"
 
 	}
 	return fmt.Sprintf("%d", self)
@@ -239,6 +246,8 @@ func GetPermission(name string) ACL_PERMISSION {
 		return DELETE_RESULTS
 	case "DATASTORE_ACCESS":
 		return DATASTORE_ACCESS
+	case "DUAL_AUTHORIZATION":
+		return DUAL_AUTHORIZATION
 
 	}
 	return NO_PERMISSIONS
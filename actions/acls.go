@@ -0,0 +1,93 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+
+	"www.velocidex.com/golang/velociraptor/acls"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/responder"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
+)
+
+var (
+	// Permissions which allow a query to change the endpoint. These
+	// are never granted in forensic mode.
+	ForensicDeniedPermissions = []acls.ACL_PERMISSION{
+		acls.EXECVE, acls.FILESYSTEM_WRITE,
+	}
+)
+
+// Returns the ACL manager to use for the client's queries. ACLs are
+// disabled on the client apart from the consent notification and
+// forensic mode.
+func NewClientACLManager(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	responder responder.Responder) vql_subsystem.ACLManager {
+	var result vql_subsystem.ACLManager = acl_managers.NullACLManager{}
+
+	if config_obj.Client == nil {
+		return result
+	}
+
+	if config_obj.Client.ConsentMessage != "" {
+		result = newConsentACLManager(ctx, config_obj.Client, responder)
+	}
+
+	// Denied permissions never reach the consent notification.
+	if config_obj.Client.ForensicMode {
+		result = &ForensicACLManager{ACLManager: result}
+	}
+
+	return result
+}
+
+// Denies the ForensicDeniedPermissions and defers all other checks
+// to the wrapped manager.
+type ForensicACLManager struct {
+	vql_subsystem.ACLManager
+}
+
+func (self *ForensicACLManager) CheckAccess(
+	permissions ...acls.ACL_PERMISSION) (bool, error) {
+	err := checkForensicMode(permissions...)
+	if err != nil {
+		return false, err
+	}
+	return self.ACLManager.CheckAccess(permissions...)
+}
+
+func (self *ForensicACLManager) CheckAccessWithArgs(
+	permission acls.ACL_PERMISSION, args ...string) (bool, error) {
+	err := checkForensicMode(permission)
+	if err != nil {
+		return false, err
+	}
+	return self.ACLManager.CheckAccessWithArgs(permission, args...)
+}
+
+func (self *ForensicACLManager) CheckAccessInOrg(
+	org_id string, permissions ...acls.ACL_PERMISSION) (bool, error) {
+	return self.CheckAccess(permissions...)
+}
+
+func (self *ForensicACLManager) GetPrincipal() string {
+	principal_manager, ok := self.ACLManager.(vql_subsystem.PrincipalACLManager)
+	if ok {
+		return principal_manager.GetPrincipal()
+	}
+	return ""
+}
+
+func checkForensicMode(permissions ...acls.ACL_PERMISSION) error {
+	for _, perm := range permissions {
+		for _, denied := range ForensicDeniedPermissions {
+			if perm == denied {
+				return fmt.Errorf("%v is not allowed in forensic mode", perm)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package actions
+
+import (
+	"context"
+	"testing"
+
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/config"
+	"www.velocidex.com/golang/velociraptor/crypto"
+	"www.velocidex.com/golang/velociraptor/responder"
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func TestForensicMode(t *testing.T) {
+	shown := 0
+	notifyLoggedInUsers = func(ctx context.Context, title, message string) error {
+		shown++
+		return nil
+	}
+	defer func() {
+		notifyLoggedInUsers = notifyUsers
+	}()
+
+	ca, err := crypto.GenerateCACert(2048)
+	assert.NoError(t, err)
+
+	config_obj := config.GetDefaultConfig()
+	config_obj.CA.PrivateKey = ca.PrivateKey
+	config_obj.Client.CaCertificate = ca.Cert
+	config_obj.Client.ForensicMode = true
+
+	ctx := context.Background()
+	resp := responder.TestResponderWithFlowId(config_obj, "F.Forensic1")
+	defer resp.Close()
+
+	manager := NewClientACLManager(ctx, config_obj, resp)
+
+	ok, err := manager.CheckAccess(acls.READ_RESULTS)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = manager.CheckAccess(acls.EXECVE)
+	assert.Error(t, err)
+	assert.True(t, !ok)
+
+	ok, err = manager.CheckAccessWithArgs(acls.FILESYSTEM_WRITE, "/tmp/x")
+	assert.Error(t, err)
+	assert.True(t, !ok)
+
+	// Denied permissions never show the consent message.
+	config_obj.Client.ConsentMessage = "Your computer is being examined."
+	config_obj.Client.ConsentMessageSignature, err = SignConsentMessage(
+		config_obj, config_obj.Client.ConsentMessage)
+	assert.NoError(t, err)
+
+	manager = NewClientACLManager(ctx, config_obj, resp)
+
+	ok, err = manager.CheckAccess(acls.EXECVE)
+	assert.Error(t, err)
+	assert.True(t, !ok)
+	assert.Equal(t, 0, shown)
+}
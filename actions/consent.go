@@ -0,0 +1,208 @@
+package actions
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"www.velocidex.com/golang/velociraptor/acls"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	crypto_utils "www.velocidex.com/golang/velociraptor/crypto/utils"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/responder"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
+)
+
+// Some jurisdictions require users to be told when their computer is
+// being examined. When Client.consent_message is set, the logged in
+// users are shown the message the first time a collection uses one
+// of the Client.consent_permissions.
+//
+// The message is signed with the CA key so whoever can edit the
+// client's config can not change or remove the notice. If the
+// signature does not verify the client refuses those permissions
+// rather than act without the approved notice.
+
+const (
+	CONSENT_TITLE = "Notice"
+
+	// How long to remember that a flow already showed the notice.
+	consentExpiry = 24 * time.Hour
+
+	consentNotifyTimeout = 10 * time.Second
+)
+
+var (
+	defaultConsentPermissions = []string{"EXECVE", "FILESYSTEM_WRITE"}
+
+	consent_mu sync.Mutex
+
+	// Flows which already showed the notice. A flow may run many
+	// queries but only needs to notify once.
+	consent_notified = make(map[string]time.Time)
+
+	// Replaced in tests.
+	notifyLoggedInUsers = notifyUsers
+)
+
+// Sign the consent message with the CA private key. Returns the hex
+// encoded signature for Client.consent_message_signature.
+func SignConsentMessage(
+	config_obj *config_proto.Config, message string) (string, error) {
+	if config_obj.CA == nil || config_obj.CA.PrivateKey == "" {
+		return "", errors.New("SignConsentMessage: CA private key not available")
+	}
+
+	key, err := crypto_utils.ParseRsaPrivateKeyFromPemStr(
+		[]byte(config_obj.CA.PrivateKey))
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := crypto_utils.SignSHA256(key, []byte(message))
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(signature), nil
+}
+
+// Verify the consent message was signed by the CA.
+func VerifyConsentMessage(client_config *config_proto.ClientConfig) error {
+	if client_config.CaCertificate == "" {
+		return errors.New("VerifyConsentMessage: No CA certificate configured")
+	}
+
+	signature, err := hex.DecodeString(client_config.ConsentMessageSignature)
+	if err != nil || len(signature) == 0 {
+		return errors.New("VerifyConsentMessage: Consent message is not signed")
+	}
+
+	err = crypto_utils.VerifySHA256WithCertificate(
+		client_config.CaCertificate,
+		[]byte(client_config.ConsentMessage), signature)
+	if err != nil {
+		return fmt.Errorf("VerifyConsentMessage: %w", err)
+	}
+	return nil
+}
+
+// An ACL manager which allows everything like the NullACLManager but
+// shows the consent message before allowing any of the consent
+// permissions.
+type ConsentACLManager struct {
+	acl_managers.NullACLManager
+
+	ctx       context.Context
+	responder responder.Responder
+
+	message     string
+	permissions []acls.ACL_PERMISSION
+
+	// Set when the message does not verify.
+	err error
+}
+
+func newConsentACLManager(
+	ctx context.Context,
+	client_config *config_proto.ClientConfig,
+	responder responder.Responder) *ConsentACLManager {
+
+	names := client_config.ConsentPermissions
+	if len(names) == 0 {
+		names = defaultConsentPermissions
+	}
+
+	result := &ConsentACLManager{
+		ctx:       ctx,
+		responder: responder,
+		message:   client_config.ConsentMessage,
+		err:       VerifyConsentMessage(client_config),
+	}
+
+	for _, name := range names {
+		perm := acls.GetPermission(name)
+		if perm != acls.NO_PERMISSIONS {
+			result.permissions = append(result.permissions, perm)
+		}
+	}
+
+	return result
+}
+
+func (self *ConsentACLManager) CheckAccess(
+	permissions ...acls.ACL_PERMISSION) (bool, error) {
+	for _, perm := range permissions {
+		if !self.requiresConsent(perm) {
+			continue
+		}
+
+		if self.err != nil {
+			return false, self.err
+		}
+
+		self.maybeNotify()
+		break
+	}
+
+	return true, nil
+}
+
+func (self *ConsentACLManager) CheckAccessWithArgs(
+	permission acls.ACL_PERMISSION, args ...string) (bool, error) {
+	return self.CheckAccess(permission)
+}
+
+func (self *ConsentACLManager) CheckAccessInOrg(
+	org_id string, permissions ...acls.ACL_PERMISSION) (bool, error) {
+	return self.CheckAccess(permissions...)
+}
+
+func (self *ConsentACLManager) requiresConsent(perm acls.ACL_PERMISSION) bool {
+	for _, p := range self.permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Show the message once for each flow.
+func (self *ConsentACLManager) maybeNotify() {
+	session_id := self.responder.FlowContext().SessionId()
+	now := utils.GetTime().Now()
+
+	consent_mu.Lock()
+	_, pres := consent_notified[session_id]
+	if !pres {
+		consent_notified[session_id] = now
+		for k, v := range consent_notified {
+			if now.Sub(v) > consentExpiry {
+				delete(consent_notified, k)
+			}
+		}
+	}
+	consent_mu.Unlock()
+
+	if pres {
+		return
+	}
+
+	sub_ctx, cancel := context.WithTimeout(self.ctx, consentNotifyTimeout)
+	defer cancel()
+
+	// There may be no one logged in so this is not fatal.
+	err := notifyLoggedInUsers(sub_ctx, CONSENT_TITLE, self.message)
+	if err != nil {
+		self.responder.Log(self.ctx, logging.WARNING,
+			fmt.Sprintf("Unable to show consent notification: %v", err))
+		return
+	}
+
+	self.responder.Log(self.ctx, logging.DEFAULT,
+		"Showed consent notification to logged in users")
+}
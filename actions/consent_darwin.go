@@ -0,0 +1,32 @@
+//go:build darwin
+// +build darwin
+
+package actions
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Show a notification in the console user's session. We run as
+// root so we need to switch to the user's launchd context.
+func notifyUsers(ctx context.Context, title, message string) error {
+	uid, err := exec.CommandContext(ctx, "stat", "-f", "%u", "/dev/console").
+		Output()
+	if err != nil {
+		return err
+	}
+
+	script := fmt.Sprintf("display notification %q with title %q",
+		message, title)
+	output, err := exec.CommandContext(ctx, "launchctl", "asuser",
+		strings.TrimSpace(string(uid)),
+		"osascript", "-e", script).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("osascript: %w: %v", err,
+			strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// Show a desktop notification in every graphical session (those with
+// a session bus under /run/user/) and broadcast the message to
+// terminal users with wall.
+func notifyUsers(ctx context.Context, title, message string) error {
+	var errs []error
+	notified := 0
+
+	buses, _ := filepath.Glob("/run/user/*/bus")
+	for _, bus := range buses {
+		uid := filepath.Base(filepath.Dir(bus))
+		u, err := user.LookupId(uid)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		output, err := exec.CommandContext(ctx, "runuser", "-u", u.Username,
+			"--", "env", "DBUS_SESSION_BUS_ADDRESS=unix:path="+bus,
+			"notify-send", "--urgency=critical", title, message).
+			CombinedOutput()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("notify-send for %v: %w: %v",
+				u.Username, err, strings.TrimSpace(string(output))))
+			continue
+		}
+		notified++
+	}
+
+	cmd := exec.CommandContext(ctx, "wall")
+	cmd.Stdin = strings.NewReader(title + ": " + message)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("wall: %w: %v", err,
+			strings.TrimSpace(string(output))))
+	} else {
+		notified++
+	}
+
+	if notified == 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
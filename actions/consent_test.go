@@ -0,0 +1,91 @@
+package actions
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/config"
+	"www.velocidex.com/golang/velociraptor/crypto"
+	"www.velocidex.com/golang/velociraptor/responder"
+	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func TestConsentNotification(t *testing.T) {
+	var mu sync.Mutex
+	var shown []string
+
+	notifyLoggedInUsers = func(ctx context.Context, title, message string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		shown = append(shown, message)
+		return nil
+	}
+	defer func() {
+		notifyLoggedInUsers = notifyUsers
+	}()
+
+	ca, err := crypto.GenerateCACert(2048)
+	assert.NoError(t, err)
+
+	config_obj := config.GetDefaultConfig()
+	config_obj.CA.PrivateKey = ca.PrivateKey
+	config_obj.Client.CaCertificate = ca.Cert
+
+	ctx := context.Background()
+	resp := responder.TestResponderWithFlowId(config_obj, "F.Consent1")
+	defer resp.Close()
+
+	// Without a message there are no restrictions.
+	manager := NewClientACLManager(ctx, config_obj, resp)
+	assert.Equal(t, acl_managers.NullACLManager{}, manager)
+
+	config_obj.Client.ConsentMessage = "Your computer is being examined."
+	config_obj.Client.ConsentMessageSignature, err = SignConsentMessage(
+		config_obj, config_obj.Client.ConsentMessage)
+	assert.NoError(t, err)
+
+	manager = NewClientACLManager(ctx, config_obj, resp)
+
+	// Other permissions do not show the message.
+	ok, err := manager.CheckAccess(acls.READ_RESULTS)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 0, len(shown))
+
+	ok, err = manager.CheckAccess(acls.EXECVE)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"Your computer is being examined."}, shown)
+
+	// Only once per flow.
+	ok, err = manager.CheckAccess(acls.FILESYSTEM_WRITE)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, len(shown))
+
+	resp2 := responder.TestResponderWithFlowId(config_obj, "F.Consent2")
+	defer resp2.Close()
+
+	manager = NewClientACLManager(ctx, config_obj, resp2)
+	ok, err = manager.CheckAccessWithArgs(acls.EXECVE, "ls")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(shown))
+
+	// A message which was changed after signing denies the consent
+	// permissions.
+	config_obj.Client.ConsentMessage = "Nothing to see here."
+	manager = NewClientACLManager(ctx, config_obj, resp2)
+
+	ok, err = manager.CheckAccess(acls.EXECVE)
+	assert.Error(t, err)
+	assert.True(t, !ok)
+
+	ok, err = manager.CheckAccess(acls.READ_RESULTS)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(shown))
+}
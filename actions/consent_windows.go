@@ -0,0 +1,88 @@
+//go:build windows
+// +build windows
+
+package actions
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	wtsapi32                 = syscall.NewLazyDLL("wtsapi32.dll")
+	procWTSEnumerateSessions = wtsapi32.NewProc("WTSEnumerateSessionsW")
+	procWTSSendMessage       = wtsapi32.NewProc("WTSSendMessageW")
+	procWTSFreeMemory        = wtsapi32.NewProc("WTSFreeMemory")
+)
+
+const (
+	WTS_CURRENT_SERVER_HANDLE = 0
+	WTSActive                 = 0
+
+	MB_OK              = 0x00000000
+	MB_ICONINFORMATION = 0x00000040
+	MB_SETFOREGROUND   = 0x00010000
+)
+
+// https://learn.microsoft.com/en-us/windows/win32/api/wtsapi32/ns-wtsapi32-wts_session_infow
+type wtsSessionInfo struct {
+	SessionId      uint32
+	WinStationName *uint16
+	State          uint32
+}
+
+// We run as a service in session 0 which has no desktop so show a
+// message box in every active user session instead.
+func notifyUsers(ctx context.Context, title, message string) error {
+	var sessions *wtsSessionInfo
+	var count uint32
+
+	r1, _, err := procWTSEnumerateSessions.Call(
+		WTS_CURRENT_SERVER_HANDLE, 0, 1,
+		uintptr(unsafe.Pointer(&sessions)),
+		uintptr(unsafe.Pointer(&count)))
+	if r1 == 0 {
+		return err
+	}
+	defer procWTSFreeMemory.Call(uintptr(unsafe.Pointer(sessions)))
+
+	title_utf16, err := syscall.UTF16FromString(title)
+	if err != nil {
+		return err
+	}
+
+	message_utf16, err := syscall.UTF16FromString(message)
+	if err != nil {
+		return err
+	}
+
+	notified := 0
+	for _, session := range unsafe.Slice(sessions, count) {
+		if session.State != WTSActive {
+			continue
+		}
+
+		// Lengths are in bytes without the terminating NULL. Do
+		// not wait for the user to dismiss the message.
+		var response uint32
+		r1, _, _ := procWTSSendMessage.Call(
+			WTS_CURRENT_SERVER_HANDLE,
+			uintptr(session.SessionId),
+			uintptr(unsafe.Pointer(&title_utf16[0])),
+			uintptr((len(title_utf16)-1)*2),
+			uintptr(unsafe.Pointer(&message_utf16[0])),
+			uintptr((len(message_utf16)-1)*2),
+			MB_OK|MB_ICONINFORMATION|MB_SETFOREGROUND,
+			0, uintptr(unsafe.Pointer(&response)), 0)
+		if r1 != 0 {
+			notified++
+		}
+	}
+
+	if notified == 0 {
+		return errors.New("No active user sessions")
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package actions
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+const (
+	PII_POLICY_HASH     = "hash"
+	PII_POLICY_TRUNCATE = "truncate"
+
+	DEFAULT_PII_TRUNCATE_LENGTH = 4
+)
+
+func scrubPIIValue(client_config *config_proto.ClientConfig, value string) string {
+	switch client_config.PiiPolicy {
+	case PII_POLICY_TRUNCATE:
+		length := int(client_config.PiiTruncateLength)
+		if length == 0 {
+			length = DEFAULT_PII_TRUNCATE_LENGTH
+		}
+
+		runes := []rune(value)
+		if len(runes) <= length {
+			return value
+		}
+		return string(runes[:length]) + "..."
+
+	// Unknown policies hash the data since the deployment asked for
+	// it to be scrubbed.
+	default:
+		hash := sha256.Sum256([]byte(client_config.PiiSalt + value))
+		return hex.EncodeToString(hash[:])
+	}
+}
+
+// Scrub the PII columns the artifact declares from the JSONL payload
+// before it leaves the endpoint. Rows that can not be parsed are
+// dropped since we can not tell what they contain.
+func scrubPII(
+	config_obj *config_proto.Config,
+	query *actions_proto.VQLRequest,
+	response *actions_proto.VQLResponse) error {
+
+	if config_obj.Client == nil || config_obj.Client.PiiPolicy == "" ||
+		len(query.PiiColumns) == 0 {
+		return nil
+	}
+
+	var result bytes.Buffer
+	var dropped int
+	for _, line := range bytes.Split([]byte(response.JSONLResponse), []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		row, err := utils.ParseJsonToObject(line)
+		if err != nil {
+			dropped++
+			continue
+		}
+
+		for _, column := range query.PiiColumns {
+			value, pres := row.Get(column)
+			if !pres || utils.IsNil(value) {
+				continue
+			}
+
+			str, ok := value.(string)
+			if !ok {
+				str = fmt.Sprintf("%v", value)
+			}
+			row.Update(column, scrubPIIValue(config_obj.Client, str))
+		}
+
+		serialized, err := json.Marshal(row)
+		if err != nil {
+			dropped++
+			continue
+		}
+		result.Write(serialized)
+		result.Write([]byte("\n"))
+	}
+
+	response.JSONLResponse = result.String()
+
+	if dropped > 0 {
+		response.TotalRows -= uint64(dropped)
+		return fmt.Errorf("Dropped %v rows which could not be scrubbed", dropped)
+	}
+	return nil
+}
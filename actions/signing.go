@@ -0,0 +1,65 @@
+package actions
+
+import (
+	"crypto/rsa"
+	"errors"
+	"sync"
+
+	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	crypto_utils "www.velocidex.com/golang/velociraptor/crypto/utils"
+	"www.velocidex.com/golang/velociraptor/services/writeback"
+)
+
+var (
+	signing_mu sync.Mutex
+
+	// Parsing the key is expensive so we cache it. The client may
+	// be rekeyed at runtime so we keep the pem it came from.
+	signing_key_pem string
+	signing_key     *rsa.PrivateKey
+)
+
+func getSigningKey(config_obj *config_proto.Config) (*rsa.PrivateKey, error) {
+	writeback_service := writeback.GetWritebackService()
+	wb, err := writeback_service.GetWriteback(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if wb.PrivateKey == "" {
+		return nil, errors.New("No client private key available")
+	}
+
+	signing_mu.Lock()
+	defer signing_mu.Unlock()
+
+	if signing_key != nil && signing_key_pem == wb.PrivateKey {
+		return signing_key, nil
+	}
+
+	key, err := crypto_utils.ParseRsaPrivateKeyFromPemStr(
+		[]byte(wb.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	signing_key = key
+	signing_key_pem = wb.PrivateKey
+	return key, nil
+}
+
+// Sign the JSONL payload of the response with the client's private
+// key so the rows can be attributed to this client later.
+func signResponse(
+	config_obj *config_proto.Config,
+	response *actions_proto.VQLResponse) error {
+	key, err := getSigningKey(config_obj)
+	if err != nil {
+		return err
+	}
+
+	response.Signature, err = crypto_utils.SignSHA256(
+		key, []byte(response.JSONLResponse))
+	return err
+}
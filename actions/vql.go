@@ -37,8 +37,8 @@ import (
 	"www.velocidex.com/golang/velociraptor/responder"
 	"www.velocidex.com/golang/velociraptor/services"
 	"www.velocidex.com/golang/velociraptor/uploads"
+	"www.velocidex.com/golang/velociraptor/utils"
 	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
-	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
 	"www.velocidex.com/golang/vfilter"
 	"www.velocidex.com/golang/vfilter/types"
 )
@@ -154,8 +154,9 @@ func (self VQLClientAction) StartQuery(
 		// Only provide the client config since we are running in
 		// client context.
 		ClientConfig: config_obj.Client,
-		// Disable ACLs on the client.
-		ACLManager: acl_managers.NullACLManager{},
+		// Disable ACLs on the client apart from the consent
+		// notification.
+		ACLManager: NewClientACLManager(ctx, config_obj, responder),
 		Env: ordereddict.NewDict().
 			// Make the session id available in the query.
 			Set("_SessionId", responder.FlowContext().SessionId()).
@@ -292,7 +293,12 @@ func (self VQLClientAction) StartQuery(
 					continue
 				}
 
-				row_tracker.AddRows(query, uint64(result.TotalRows))
+				err := scrubPII(config_obj, query, response)
+				if err != nil {
+					scope.Log("Scrubbing PII: %v", err)
+				}
+
+				row_tracker.AddRows(query, response.TotalRows)
 
 				// Don't log empty VQL statements.
 				if query.Name != "" {
@@ -309,6 +315,21 @@ func (self VQLClientAction) StartQuery(
 						))
 				}
 				response.Columns = result.Columns
+
+				// Signatures cover the JSONL payload exactly as
+				// the server stores it so signed responses are
+				// never columnar encoded.
+				if config_obj.Client != nil && config_obj.Client.SignResults {
+					err := signResponse(config_obj, response)
+					if err != nil {
+						scope.Log("Signing results: %v", err)
+					}
+
+				} else if config_obj.Client != nil &&
+					config_obj.Client.ColumnarResults {
+					encodeColumnar(response)
+				}
+
 				responder.AddResponse(&crypto_proto.VeloMessage{
 					VQLResponse: response})
 			}
@@ -346,6 +367,18 @@ func CheckPreconditions(
 	return false, nil
 }
 
+// Replace the JSONL payload with the columnar encoding but only if
+// it actually makes the response smaller.
+func encodeColumnar(response *actions_proto.VQLResponse) {
+	encoded, err := utils.EncodeColumnarJSONL([]byte(response.JSONLResponse))
+	if err != nil || len(encoded) >= len(response.JSONLResponse) {
+		return
+	}
+
+	response.ColumnarResponse = string(encoded)
+	response.JSONLResponse = ""
+}
+
 func EncodeIntoResponsePackets(
 	vql *vfilter.VQL,
 	ctx context.Context,
@@ -157,6 +157,41 @@ func (self *ClientVQLTestSuite) TestMaxWait() {
 		}))
 }
 
+func (self *ClientVQLTestSuite) TestPIIScrubbing() {
+	request := &actions_proto.VQLCollectorArgs{
+		Query: []*actions_proto.VQLRequest{
+			{
+				Name:       "Query",
+				PiiColumns: []string{"User"},
+				VQL:        "SELECT 'Administrator' AS User, 1 AS Pid FROM scope()",
+			},
+		},
+	}
+
+	collect := func() string {
+		resp := responder.TestResponderWithFlowId(
+			self.ConfigObj, "TestPIIScrubbing")
+		actions.VQLClientAction{}.StartQuery(
+			self.ConfigObj, self.Sm.Ctx, resp, request)
+		resp.Close()
+		return getVQLResponse(resp.Drain.Messages())
+	}
+
+	defer func() {
+		self.ConfigObj.Client.PiiPolicy = ""
+	}()
+
+	// Columns are only scrubbed when the config demands it.
+	assert.Equal(self.T(), "{\"User\":\"Administrator\",\"Pid\":1}\n", collect())
+
+	self.ConfigObj.Client.PiiPolicy = "truncate"
+	assert.Equal(self.T(), "{\"User\":\"Admi...\",\"Pid\":1}\n", collect())
+
+	self.ConfigObj.Client.PiiPolicy = "hash"
+	self.ConfigObj.Client.PiiSalt = "S"
+	assert.Equal(self.T(), "{\"User\":\"6b5c9b37471d7e70049a12cdd2f80791e8990ed637b508d20d4802af139f982f\",\"Pid\":1}\n", collect())
+}
+
 func getLogs(responses []*crypto_proto.VeloMessage) string {
 	result := ""
 	for _, item := range responses {
@@ -56,6 +56,7 @@ import (
 	"www.velocidex.com/golang/velociraptor/server"
 	"www.velocidex.com/golang/velociraptor/services"
 	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/utils/tracing"
 	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
 	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
 	"www.velocidex.com/golang/vfilter"
@@ -503,7 +504,26 @@ func (self *ApiServer) VFSListDirectory(
 
 	result, err := vfs_service.ListDirectories(ctx,
 		org_config_obj, in.ClientId, in.VfsComponents)
-	return result, err
+	if err != nil {
+		return nil, err
+	}
+
+	// The directory was never listed - populate it from the client
+	// so the analyst does not need to refresh it manually.
+	if in.RefreshIfMissing && result.FlowId == "" &&
+		len(in.VfsComponents) > 0 {
+		perm, err := services.CheckAccess(
+			org_config_obj, principal, acls.COLLECT_CLIENT)
+		if perm && err == nil {
+			_, err = vfsRefreshDirectory(
+				self, ctx, in.ClientId, in.VfsComponents, 0)
+			if err != nil {
+				return nil, Status(self.verbose, err)
+			}
+		}
+	}
+
+	return result, nil
 }
 
 func (self *ApiServer) VFSStatDirectory(
@@ -1177,6 +1197,11 @@ func StartMonitoringService(
 
 	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
 
+	err := tracing.StartOTLPExporter(ctx, wg, config_obj)
+	if err != nil {
+		return err
+	}
+
 	env_inject_time, pres := os.LookupEnv("VELOCIRAPTOR_INJECT_API_SLEEP")
 	if pres {
 		logger.Info("Injecting delays for API calls since VELOCIRAPTOR_INJECT_API_SLEEP is set (only used for testing).")
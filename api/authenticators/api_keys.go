@@ -0,0 +1,115 @@
+package authenticators
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+	api_proto "www.velocidex.com/golang/velociraptor/api/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/constants"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/services/users"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+type apiKeyContextKey struct{}
+
+// Returns the API key if the request carries one as a bearer token.
+func getApiKeyFromRequest(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", false
+	}
+
+	key := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	return key, strings.HasPrefix(key, users.API_KEY_PREFIX)
+}
+
+func IsApiKeyRequest(r *http.Request) bool {
+	_, ok := getApiKeyFromRequest(r)
+	return ok
+}
+
+// The id of the API key used to authenticate the request (if any).
+func GetApiKeyId(ctx context.Context) string {
+	id, _ := ctx.Value(apiKeyContextKey{}).(string)
+	return id
+}
+
+// Authenticate a request bearing an API key. The request proceeds
+// as the user owning the key.
+func authenticateApiKey(
+	config_obj *config_proto.Config,
+	parent http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _ := getApiKeyFromRequest(r)
+
+		reject := func(record *users.ApiKey, err error, status int) {
+			username := ""
+			details := ordereddict.NewDict().
+				Set("remote", r.RemoteAddr).
+				Set("err", err.Error()).
+				Set("status", status)
+			if record != nil {
+				username = record.Username
+				details.Set("api_key", record.Id)
+			}
+
+			services.LogAudit(r.Context(),
+				config_obj, username, "API key rejected", details)
+			http.Error(w, err.Error(), status)
+		}
+
+		record, err := users.VerifyApiKey(r.Context(), config_obj, key)
+		if err != nil {
+			reject(record, err, http.StatusUnauthorized)
+			return
+		}
+
+		if !users.AllowApiKey(record) {
+			reject(record, errors.New("Rate limit exceeded"),
+				http.StatusTooManyRequests)
+			return
+		}
+
+		user_manager := services.GetUserManager()
+		user_record, err := user_manager.GetUser(
+			r.Context(), record.Username, record.Username)
+		if err != nil {
+			reject(record, errors.New("Invalid user"), http.StatusUnauthorized)
+			return
+		}
+
+		// Keys scoped to specific orgs can not be used elsewhere. We
+		// do not switch orgs for API keys like we do for interactive
+		// users.
+		org_id := GetOrgIdFromRequest(r)
+		if len(record.Orgs) > 0 && !utils.InString(record.Orgs, org_id) {
+			reject(record, utils.NoAccessToOrgError, http.StatusForbidden)
+			return
+		}
+
+		err = _checkOrgAccess(r, org_id, user_record)
+		if err != nil {
+			reject(record, err, http.StatusForbidden)
+			return
+		}
+
+		user_info := &api_proto.VelociraptorUser{
+			Name: user_record.Name,
+		}
+
+		serialized, _ := json.Marshal(user_info)
+		ctx := context.WithValue(
+			r.Context(), constants.GRPC_USER_CONTEXT, string(serialized))
+		ctx = context.WithValue(ctx, apiKeyContextKey{}, record.Id)
+
+		GetLoggingHandler(config_obj)(parent).ServeHTTP(
+			w, r.WithContext(ctx))
+	})
+}
@@ -159,11 +159,16 @@ func init() {
 		if err != nil {
 			return nil, err
 		}
+		role_mapper, err := NewGroupRoleMapper(auth_config)
+		if err != nil {
+			return nil, err
+		}
 		return &OidcAuthenticator{
 			config_obj:    config_obj,
 			authenticator: auth_config,
 			base:          utils.GetBasePath(config_obj),
 			public_url:    utils.GetPublicURL(config_obj),
+			role_mapper:   role_mapper,
 		}, nil
 	})
 
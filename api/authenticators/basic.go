@@ -67,7 +67,14 @@ func (self *BasicAuthenticator) AuthRedirectTemplate() string {
 
 func (self *BasicAuthenticator) AuthenticateUserHandler(
 	parent http.Handler) http.Handler {
+	api_key_handler := authenticateApiKey(self.config_obj, parent)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsApiKeyRequest(r) {
+			api_key_handler.ServeHTTP(w, r)
+			return
+		}
+
 		w.Header().Set("X-CSRF-Token", csrf.Token(r))
 		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
 
@@ -275,7 +275,16 @@ func authenticateUserHandle(
 		err error, username string),
 	parent http.Handler) http.Handler {
 
+	api_key_handler := authenticateApiKey(config_obj, parent)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Automation may authenticate using an API key instead of
+		// the session cookie.
+		if IsApiKeyRequest(r) {
+			api_key_handler.ServeHTTP(w, r)
+			return
+		}
+
 		w.Header().Set("X-CSRF-Token", csrf.Token(r))
 
 		claims, err := getDetailsFromCookie(config_obj, r)
@@ -39,30 +39,28 @@ func GetLoggingHandler(config_obj *config_proto.Config) func(http.Handler) http.
 				w.(http.Flusher),
 				200, nil}
 			defer func() {
+				fields := logrus.Fields{
+					"method":     r.Method,
+					"url":        r.URL.Path,
+					"remote":     r.RemoteAddr,
+					"user-agent": r.UserAgent(),
+					"status":     rec.Status,
+					"user": GetUserInfo(
+						r.Context(), config_obj).Name,
+				}
+
+				// Attribute requests made with an API key to the key.
+				api_key := GetApiKeyId(r.Context())
+				if api_key != "" {
+					fields["api_key"] = api_key
+				}
+
 				if rec.Status == 500 {
-					logger.WithFields(
-						logrus.Fields{
-							"method":     r.Method,
-							"url":        r.URL.Path,
-							"remote":     r.RemoteAddr,
-							"error":      string(rec.Error),
-							"user-agent": r.UserAgent(),
-							"status":     rec.Status,
-							"user": GetUserInfo(
-								r.Context(), config_obj).Name,
-						}).Error("")
+					fields["error"] = string(rec.Error)
+					logger.WithFields(fields).Error("")
 
 				} else {
-					logger.WithFields(
-						logrus.Fields{
-							"method":     r.Method,
-							"url":        r.URL.Path,
-							"remote":     r.RemoteAddr,
-							"user-agent": r.UserAgent(),
-							"status":     rec.Status,
-							"user": GetUserInfo(
-								r.Context(), config_obj).Name,
-						}).Info("")
+					logger.WithFields(fields).Info("")
 				}
 			}()
 			next.ServeHTTP(rec, r)
@@ -0,0 +1,154 @@
+package authenticators
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/logging"
+)
+
+// Middleware wraps the GUI and API handlers before the
+// authenticator. This allows deployments to require additional
+// checks (e.g. a client certificate or an identity aware proxy) on
+// top of the configured authenticator.
+//
+// Middleware is selected by name in the GUI.middleware config
+// setting. Other packages can add their own middleware by calling
+// RegisterMiddleware() from an init() function.
+type Middleware func(parent http.Handler) http.Handler
+
+var (
+	middleware_dispatcher = make(map[string]func(
+		config_obj *config_proto.Config) (Middleware, error))
+)
+
+func RegisterMiddleware(name string,
+	handler func(config_obj *config_proto.Config) (Middleware, error)) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	middleware_dispatcher[strings.ToLower(name)] = handler
+}
+
+// Build the chain of configured middleware. The IP filter is always
+// applied first, then the middleware in the order it is listed.
+func NewMiddleware(config_obj *config_proto.Config) (Middleware, error) {
+	chain := []Middleware{}
+	if config_obj.GUI != nil {
+		for _, name := range config_obj.GUI.Middleware {
+			mu.Lock()
+			handler, pres := middleware_dispatcher[strings.ToLower(name)]
+			mu.Unlock()
+
+			if !pres {
+				return nil, fmt.Errorf("Unknown GUI middleware %v", name)
+			}
+
+			middleware, err := handler(config_obj)
+			if err != nil {
+				return nil, fmt.Errorf("GUI middleware %v: %w", name, err)
+			}
+			chain = append(chain, middleware)
+		}
+	}
+
+	return func(parent http.Handler) http.Handler {
+		for i := len(chain) - 1; i >= 0; i-- {
+			parent = chain[i](parent)
+		}
+		return IpFilter(config_obj, parent)
+	}, nil
+}
+
+// The client_cert middleware needs the GUI listener to request client
+// certificates.
+func MiddlewareRequiresClientCerts(config_obj *config_proto.Config) bool {
+	for _, name := range config_obj.GUI.GetMiddleware() {
+		if strings.ToLower(name) == "client_cert" {
+			return true
+		}
+	}
+	return false
+}
+
+// Only allow requests presenting a client certificate signed by the
+// deployment CA. Unlike the certs authenticator, the certificate does
+// not determine the user so it can be combined with any
+// authenticator.
+//
+// NOTE: This only works when the GUI is served on its own port since
+// the frontend can not require client certificates.
+func clientCertMiddleware(config_obj *config_proto.Config) (Middleware, error) {
+	if config_obj.GUI.UsePlainHttp {
+		return nil, errors.New("client_cert middleware must use TLS")
+	}
+
+	return func(parent http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+				http.Error(w, "client certificate required",
+					http.StatusUnauthorized)
+				return
+			}
+			parent.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// Only allow requests which passed through an identity aware proxy
+// (e.g. Google IAP or an oauth2 proxy). The proxy authenticates the
+// user and adds the trusted_user_header to the request. Requests not
+// coming directly from one of the trusted proxies are rejected so the
+// header can not be forged by connecting to the GUI directly.
+func trustedHeaderMiddleware(config_obj *config_proto.Config) (Middleware, error) {
+	header := config_obj.GUI.TrustedUserHeader
+	if header == "" {
+		return nil, errors.New("GUI.trusted_user_header must be set")
+	}
+
+	if len(config_obj.GUI.TrustedProxies) == 0 {
+		return nil, errors.New("GUI.trusted_proxies must be set")
+	}
+
+	ranges := []*net.IPNet{}
+	for _, cidr := range config_obj.GUI.TrustedProxies {
+		_, cidr_net, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CIDR Range %v", cidr)
+		}
+		ranges = append(ranges, cidr_net)
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.GUIComponent)
+
+	return func(parent http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			remote_address, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				remote_address = r.RemoteAddr
+			}
+
+			if !matchCidr(ranges, remote_address) {
+				logger.Info("trusted_header: Rejected request from untrusted %v",
+					r.RemoteAddr)
+				http.Error(w, "rejected", http.StatusUnauthorized)
+				return
+			}
+
+			if r.Header.Get(header) == "" {
+				http.Error(w, "rejected", http.StatusUnauthorized)
+				return
+			}
+			parent.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+func init() {
+	RegisterMiddleware("client_cert", clientCertMiddleware)
+	RegisterMiddleware("trusted_header", trustedHeaderMiddleware)
+}
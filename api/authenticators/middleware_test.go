@@ -0,0 +1,63 @@
+package authenticators
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/velociraptor/config"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+)
+
+func TestMiddleware(t *testing.T) {
+	config_obj := config.GetDefaultConfig()
+	config_obj.GUI.Middleware = []string{"trusted_header", "test"}
+	config_obj.GUI.TrustedUserHeader = "X-Auth-Request-Email"
+	config_obj.GUI.TrustedProxies = []string{"10.0.0.0/8"}
+
+	// Record the order the middleware is called in.
+	var calls []string
+	RegisterMiddleware("test", func(config_obj *config_proto.Config) (Middleware, error) {
+		return func(parent http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, "test")
+				parent.ServeHTTP(w, r)
+			})
+		}, nil
+	})
+
+	middleware, err := NewMiddleware(config_obj)
+	assert.NoError(t, err)
+
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	}))
+
+	serve := func(remote_addr, user string) int {
+		r := httptest.NewRequest("GET", "/api/v1/GetUserUITraits", nil)
+		r.RemoteAddr = remote_addr
+		if user != "" {
+			r.Header.Set("X-Auth-Request-Email", user)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Requests from the proxy with the header are passed through the
+	// chain in order.
+	assert.Equal(t, http.StatusOK, serve("10.1.1.1:1234", "mic@example.com"))
+	assert.Equal(t, []string{"test", "handler"}, calls)
+
+	// The header is ignored unless it comes from the proxy.
+	calls = nil
+	assert.Equal(t, http.StatusUnauthorized, serve("192.168.1.1:1234", "mic@example.com"))
+	assert.Equal(t, http.StatusUnauthorized, serve("10.1.1.1:1234", ""))
+	assert.Equal(t, 0, len(calls))
+
+	// Unknown middleware is a configuration error.
+	config_obj.GUI.Middleware = []string{"no_such_middleware"}
+	_, err = NewMiddleware(config_obj)
+	assert.Error(t, err)
+}
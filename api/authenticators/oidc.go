@@ -17,6 +17,9 @@ type OidcAuthenticator struct {
 	config_obj       *config_proto.Config
 	authenticator    *config_proto.Authenticator
 	base, public_url string
+
+	// If set, assign roles based on the user's groups.
+	role_mapper *GroupRoleMapper
 }
 
 func (self *OidcAuthenticator) IsPasswordLess() bool {
@@ -178,6 +181,19 @@ func (self *OidcAuthenticator) oauthOidcCallback(
 			return
 		}
 
+		if self.role_mapper != nil && self.role_mapper.Enabled() {
+			groups := self.getGroups(ctx, provider, oauthToken, userInfo)
+			err = self.role_mapper.SyncUser(r.Context(), self.config_obj,
+				userInfo.Email, r.RemoteAddr, groups)
+			if err != nil {
+				logging.GetLogger(self.config_obj, &logging.GUIComponent).
+					Error("OIDC group role mapping: %v", err)
+				http.Redirect(w, r, utils.Homepage(self.config_obj),
+					http.StatusTemporaryRedirect)
+				return
+			}
+		}
+
 		cookie, err := getSignedJWTTokenCookie(
 			self.config_obj, self.authenticator,
 			&Claims{
@@ -198,3 +214,32 @@ func (self *OidcAuthenticator) oauthOidcCallback(
 			http.StatusTemporaryRedirect)
 	})
 }
+
+// Groups may be present in the UserInfo response or only in the ID
+// token depending on the provider, so we check both.
+func (self *OidcAuthenticator) getGroups(
+	ctx context.Context, provider *oidc.Provider,
+	oauthToken *oauth2.Token, userInfo *oidc.UserInfo) []string {
+	claims := make(map[string]interface{})
+	_ = userInfo.Claims(&claims)
+	groups := self.role_mapper.GetGroups(claims)
+
+	raw_id_token, ok := oauthToken.Extra("id_token").(string)
+	if !ok {
+		return groups
+	}
+
+	verifier := provider.Verifier(&oidc.Config{
+		ClientID: self.authenticator.OauthClientId,
+	})
+	id_token, err := verifier.Verify(ctx, raw_id_token)
+	if err != nil {
+		logging.GetLogger(self.config_obj, &logging.GUIComponent).
+			Error("can not verify ID token from OIDC provider: %v", err)
+		return groups
+	}
+
+	claims = make(map[string]interface{})
+	_ = id_token.Claims(&claims)
+	return append(groups, self.role_mapper.GetGroups(claims)...)
+}
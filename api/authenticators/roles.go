@@ -0,0 +1,129 @@
+package authenticators
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	acl_proto "www.velocidex.com/golang/velociraptor/acls/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/constants"
+	"www.velocidex.com/golang/velociraptor/services"
+)
+
+// Maps identity provider groups to Velociraptor roles.
+type GroupRoleMapper struct {
+	claim    string
+	mappings map[string][]string
+}
+
+// Parse the group_role_mappings. Each mapping is of the form
+// "group=role1,role2".
+func NewGroupRoleMapper(
+	auth_config *config_proto.Authenticator) (*GroupRoleMapper, error) {
+	result := &GroupRoleMapper{
+		claim:    auth_config.OidcGroupsClaim,
+		mappings: make(map[string][]string),
+	}
+
+	if result.claim == "" {
+		result.claim = "groups"
+	}
+
+	for _, mapping := range auth_config.GroupRoleMappings {
+		idx := strings.LastIndex(mapping, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf(
+				"Invalid group role mapping %v: should be group=role1,role2",
+				mapping)
+		}
+
+		group := strings.TrimSpace(mapping[:idx])
+		for _, role := range strings.Split(mapping[idx+1:], ",") {
+			role = strings.TrimSpace(role)
+			if !acls.ValidateRole(role) {
+				return nil, fmt.Errorf(
+					"Invalid role %v in group role mapping %v", role, mapping)
+			}
+			result.mappings[group] = append(result.mappings[group], role)
+		}
+	}
+
+	return result, nil
+}
+
+func (self *GroupRoleMapper) Enabled() bool {
+	return len(self.mappings) > 0
+}
+
+// Extract the groups from the claims. Groups may be given as a list
+// or a single string.
+func (self *GroupRoleMapper) GetGroups(claims map[string]interface{}) []string {
+	result := []string{}
+	switch t := claims[self.claim].(type) {
+	case string:
+		result = append(result, t)
+	case []interface{}:
+		for _, i := range t {
+			group, ok := i.(string)
+			if ok {
+				result = append(result, group)
+			}
+		}
+	case []string:
+		result = append(result, t...)
+	}
+	return result
+}
+
+// Returns the sorted set of roles granted by the groups.
+func (self *GroupRoleMapper) GetRoles(groups []string) []string {
+	set := make(map[string]bool)
+	for _, group := range groups {
+		for _, role := range self.mappings[group] {
+			set[role] = true
+		}
+	}
+
+	result := make([]string, 0, len(set))
+	for role := range set {
+		result = append(result, role)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Create or update the user in the root org with the roles granted
+// by their groups.
+func (self *GroupRoleMapper) SyncUser(ctx context.Context,
+	config_obj *config_proto.Config,
+	username, remote string, groups []string) error {
+	roles := self.GetRoles(groups)
+	if len(roles) == 0 {
+		services.LogAudit(ctx,
+			config_obj, username, "Authorization failed: no roles mapped from groups",
+			ordereddict.NewDict().
+				Set("username", username).
+				Set("groups", groups).
+				Set("remote", remote))
+		return fmt.Errorf("no roles are mapped for the groups of %v", username)
+	}
+
+	services.LogAudit(ctx,
+		config_obj, username, "Group Role Mapping",
+		ordereddict.NewDict().
+			Set("username", username).
+			Set("groups", groups).
+			Set("roles", roles).
+			Set("remote", remote))
+
+	// Use the super user principal to actually add the username so
+	// we have enough permissions.
+	users := services.GetUserManager()
+	return users.AddUserToOrg(ctx, services.AddNewUser,
+		constants.PinnedServerName, username,
+		[]string{"root"}, &acl_proto.ApiClientACL{Roles: roles})
+}
@@ -0,0 +1,48 @@
+package authenticators
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+)
+
+func TestGroupRoleMapper(t *testing.T) {
+	mapper, err := NewGroupRoleMapper(&config_proto.Authenticator{
+		GroupRoleMappings: []string{
+			"dfir-team=analyst, investigator",
+			"admins=administrator",
+			"cn=readers,ou=groups=reader",
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, mapper.Enabled())
+
+	// Groups may be a list or a single string.
+	groups := mapper.GetGroups(map[string]interface{}{
+		"groups": []interface{}{"dfir-team", "cn=readers,ou=groups", "other"},
+	})
+	assert.Equal(t, []string{"dfir-team", "cn=readers,ou=groups", "other"}, groups)
+	assert.Equal(t, []string{"admins"}, mapper.GetGroups(
+		map[string]interface{}{"groups": "admins"}))
+
+	assert.Equal(t, []string{"analyst", "investigator", "reader"},
+		mapper.GetRoles(groups))
+	assert.Equal(t, []string{}, mapper.GetRoles([]string{"other"}))
+
+	// Invalid roles are rejected at startup.
+	_, err = NewGroupRoleMapper(&config_proto.Authenticator{
+		GroupRoleMappings: []string{"admins=superuser"},
+	})
+	assert.Error(t, err)
+
+	_, err = NewGroupRoleMapper(&config_proto.Authenticator{
+		GroupRoleMappings: []string{"admins"},
+	})
+	assert.Error(t, err)
+
+	// No mappings means the feature is disabled.
+	mapper, err = NewGroupRoleMapper(&config_proto.Authenticator{})
+	assert.NoError(t, err)
+	assert.False(t, mapper.Enabled())
+}
@@ -543,11 +543,19 @@ func StartFrontendWithAutocert(
 		TLSConfig:    tls_config,
 	}
 
-	// We must have port 80 open to serve the HTTP 01 challenge.
+	// We must have port 80 open to serve the HTTP 01 challenge. The
+	// TLS-ALPN challenge is served on the main port via NextProtos
+	// above. Certificates are renewed by the manager as needed
+	// without a restart.
+	challenge_server := &http.Server{
+		Addr:     ":http",
+		Handler:  certManager.HTTPHandler(nil),
+		ErrorLog: logging.NewPlainLogger(config_obj, &logging.FrontendComponent),
+	}
+
 	go func() {
-		err := http.ListenAndServe(":http", certManager.HTTPHandler(nil))
-		if err != nil {
-			logger := logging.Manager.GetLogger(config_obj, &logging.GUIComponent)
+		err := challenge_server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
 			logger.Error("Failed to bind to http server: %v", err)
 		}
 	}()
@@ -595,6 +603,11 @@ func StartFrontendWithAutocert(
 		if err != nil {
 			logger.Error("Frontend shutdown error: %v", err)
 		}
+
+		err = challenge_server.Shutdown(timeout_ctx)
+		if err != nil {
+			logger.Error("ACME challenge server shutdown error: %v", err)
+		}
 		server_obj.Info("Shutdown frontend")
 	}()
 
@@ -683,7 +696,8 @@ func StartSelfSignedGUI(
 		return err
 	}
 
-	if auther.RequireClientCerts() {
+	if auther.RequireClientCerts() ||
+		authenticators.MiddlewareRequiresClientCerts(config_obj) {
 		err = addClientCerts(config_obj, tls_config)
 		if err != nil {
 			return err
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/gorilla/csrf"
+	"www.velocidex.com/golang/velociraptor/api/authenticators"
 	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
 	"www.velocidex.com/golang/velociraptor/logging"
 )
@@ -30,6 +31,12 @@ func csrfProtect(config_obj *config_proto.Config,
 	protectionFn := csrf.Protect(token, csrf.Path("/"), csrf.MaxAge(7*24*60*60))
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Requests authenticated with an API key do not carry a
+		// session cookie so are not subject to CSRF. The key itself
+		// is verified by the authenticator.
+		if authenticators.IsApiKeyRequest(r) {
+			r = csrf.UnsafeSkipCheck(r)
+		}
 		protectionFn(parent).ServeHTTP(w, r)
 	})
 }
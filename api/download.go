@@ -140,34 +140,12 @@ func vfsFileDownloadHandler() http.Handler {
 			return
 		}
 
-		// Where to read from the file store
-		var path_spec api.FSPathSpec
-
-		// The filename for the attachment header.
-		var filename string
-
-		client_path_manager := paths.NewClientPathManager(request.ClientId)
-
-		// Newer API calls pass the filestore components directly
-		if len(request.FSComponents) > 0 {
-			path_spec = path_specs.NewUnsafeFilestorePath(request.FSComponents...).
-				SetType(api.PATH_TYPE_FILESTORE_ANY)
-
-			filename = utils.Base(request.VfsPath)
-
-			// Uploads table has direct vfs paths
-		} else if request.VfsPath != "" {
-			path_spec, err = client_path_manager.GetUploadsFileFromVFSPath(
-				request.VfsPath)
-			if err != nil {
-				returnError(w, 404, err.Error())
-				return
-			}
-			filename = path_spec.Base()
-
-		} else {
-			// Just reject the request
-			returnError(w, 404, "")
+		// Where to read from the file store and the filename for
+		// the attachment header.
+		path_spec, filename, err := getUploadPathSpec(
+			request.ClientId, request.VfsPath, request.FSComponents)
+		if err != nil {
+			returnError(w, 404, err.Error())
 			return
 		}
 
@@ -291,6 +269,33 @@ func vfsFileDownloadHandler() http.Handler {
 	})
 }
 
+// Resolve the file store path of an uploaded file and the filename it
+// should be presented as.
+func getUploadPathSpec(client_id, vfs_path string, fs_components []string) (
+	path_spec api.FSPathSpec, filename string, err error) {
+
+	// Newer API calls pass the filestore components directly
+	if len(fs_components) > 0 {
+		path_spec = path_specs.NewUnsafeFilestorePath(fs_components...).
+			SetType(api.PATH_TYPE_FILESTORE_ANY)
+
+		return path_spec, utils.Base(vfs_path), nil
+	}
+
+	// Uploads table has direct vfs paths
+	if vfs_path != "" {
+		client_path_manager := paths.NewClientPathManager(client_id)
+		path_spec, err = client_path_manager.GetUploadsFileFromVFSPath(vfs_path)
+		if err != nil {
+			return nil, "", err
+		}
+		return path_spec, path_spec.Base(), nil
+	}
+
+	// Just reject the request
+	return nil, "", errors.New("No file specified")
+}
+
 // Read data from offset and filter it until the requested number of
 // lines is found. This produces text only output, aka "strings"
 func filterData(reader_at io.ReaderAt,
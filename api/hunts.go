@@ -448,14 +448,22 @@ func (self *ApiServer) GetHuntResults(
 
 	env := ordereddict.NewDict().
 		Set("HuntID", in.HuntId).
-		Set("ArtifactName", in.Artifact)
+		Set("ArtifactName", in.Artifact).
+		Set("Sample", in.Sample)
 
 	// More than 100 results are not very useful in the GUI -
 	// users should just download the json file for post
-	// processing or process in the notebook.
+	// processing or process in the notebook. When sampling allow
+	// more rows so a useful number of clients are represented in
+	// the preview.
+	limit := uint64(100)
+	if in.Sample > 0 && in.Count > 0 {
+		limit = min(in.Count, 1000)
+	}
+
 	result, err := RunVQL(ctx, org_config_obj, principal, env,
-		"SELECT * FROM hunt_results(hunt_id=HuntID, "+
-			"artifact=ArtifactName) LIMIT 100")
+		fmt.Sprintf("SELECT * FROM hunt_results(hunt_id=HuntID, "+
+			"artifact=ArtifactName, sample=Sample) LIMIT %d", limit))
 	if err != nil {
 		return nil, Status(self.verbose, err)
 	}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/schema"
+	"www.velocidex.com/golang/velociraptor/api/authenticators"
+	"www.velocidex.com/golang/velociraptor/file_store"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+const (
+	// Previews are meant for quick triage so only a small part of
+	// the file is ever read.
+	DEFAULT_PREVIEW_LENGTH = 4096
+	MAX_PREVIEW_LENGTH     = 64 * 1024
+
+	// Maximum number of previews computed at the same time.
+	MAX_CONCURRENT_PREVIEWS = 4
+
+	MAX_PREVIEW_STRINGS = 1000
+)
+
+var (
+	previewSemaphore = make(chan bool, MAX_CONCURRENT_PREVIEWS)
+)
+
+type vfsFilePreviewRequest struct {
+	ClientId     string   `schema:"client_id"`
+	VfsPath      string   `schema:"vfs_path"`
+	FSComponents []string `schema:"fs_components[]"`
+	Offset       int64    `schema:"offset"`
+	Length       int      `schema:"length"`
+	OrgId        string   `schema:"org_id"`
+
+	// Minimum length of strings to extract (default 4).
+	MinStringLength int `schema:"min_string_length"`
+}
+
+type vfsFilePreviewResponse struct {
+	Filename string   `json:"Filename"`
+	Size     int      `json:"Size"`
+	Offset   int64    `json:"Offset"`
+	Length   int      `json:"Length"`
+	Type     string   `json:"Type"`
+	MimeType string   `json:"MimeType"`
+	Hex      []string `json:"Hex"`
+	Strings  []string `json:"Strings"`
+}
+
+// URL format: /api/v1/PreviewVFSFile
+
+// Returns a hex dump, the printable strings and the detected type of
+// a small part of an uploaded file so it can be triaged without
+// downloading it. Previews are limited in size and concurrency so
+// they can not be used to bulk download files.
+func vfsFilePreviewHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := vfsFilePreviewRequest{}
+		decoder := schema.NewDecoder()
+		decoder.IgnoreUnknownKeys(true)
+
+		err := decoder.Decode(&request, r.URL.Query())
+		if err != nil {
+			returnError(w, 403, "Error "+err.Error())
+			return
+		}
+
+		select {
+		case previewSemaphore <- true:
+			defer func() { <-previewSemaphore }()
+		default:
+			w.Header().Set("Retry-After", "1")
+			returnError(w, http.StatusTooManyRequests, "Too many previews")
+			return
+		}
+
+		org_id := request.OrgId
+		if org_id == "" {
+			org_id = authenticators.GetOrgIdFromRequest(r)
+		}
+
+		org_manager, err := services.GetOrgManager()
+		if err != nil {
+			returnError(w, 404, err.Error())
+			return
+		}
+
+		org_config_obj, err := org_manager.GetOrgConfig(
+			utils.NormalizedOrgId(org_id))
+		if err != nil {
+			returnError(w, 404, err.Error())
+			return
+		}
+
+		path_spec, filename, err := getUploadPathSpec(
+			request.ClientId, request.VfsPath, request.FSComponents)
+		if err != nil {
+			returnError(w, 404, err.Error())
+			return
+		}
+
+		file, err := file_store.GetFileStore(org_config_obj).ReadFile(path_spec)
+		if err != nil {
+			returnError(w, 404, err.Error())
+			return
+		}
+		defer file.Close()
+
+		var reader_at io.ReaderAt = utils.MakeReaderAtter(file)
+		total_size := calculateTotalReaderSize(file)
+
+		// Sparse files are previewed as they would be on the endpoint.
+		index, err := getIndex(org_config_obj, path_spec)
+		if err == nil && len(index.Ranges) > 0 {
+			reader_at = &utils.RangedReader{
+				ReaderAt: reader_at,
+				Index:    index,
+			}
+			total_size = calculateTotalSizeWithPadding(index)
+		}
+
+		length := request.Length
+		if length <= 0 {
+			length = DEFAULT_PREVIEW_LENGTH
+		}
+		if length > MAX_PREVIEW_LENGTH {
+			length = MAX_PREVIEW_LENGTH
+		}
+
+		buf := make([]byte, length)
+		n, err := reader_at.ReadAt(buf, request.Offset)
+		if err != nil && err != io.EOF {
+			returnError(w, 500, err.Error())
+			return
+		}
+		buf = buf[:n]
+
+		response := &vfsFilePreviewResponse{
+			Filename: filename,
+			Size:     total_size,
+			Offset:   request.Offset,
+			Length:   n,
+			MimeType: http.DetectContentType(buf),
+			Hex:      hexDumpLines(buf),
+			Strings:  extractStrings(buf, request.MinStringLength),
+		}
+
+		// The type can only be detected from the file header.
+		if request.Offset == 0 {
+			response.Type = detectFileType(buf)
+		}
+
+		serialized, err := json.Marshal(response)
+		if err != nil {
+			returnError(w, 500, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		_, _ = w.Write(serialized)
+	})
+}
+
+func hexDumpLines(buf []byte) []string {
+	if len(buf) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(hex.Dump(buf), "\n"), "\n")
+}
+
+// Extract runs of printable ASCII at least min_length long, similar
+// to the strings utility.
+func extractStrings(buf []byte, min_length int) []string {
+	if min_length <= 0 {
+		min_length = 4
+	}
+
+	result := []string{}
+	start := -1
+	for i := 0; i <= len(buf); i++ {
+		if i < len(buf) && (buf[i] >= 0x20 && buf[i] < 0x7f || buf[i] == '\t') {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+
+		if start >= 0 && i-start >= min_length {
+			result = append(result, string(buf[start:i]))
+			if len(result) >= MAX_PREVIEW_STRINGS {
+				break
+			}
+		}
+		start = -1
+	}
+
+	return result
+}
+
+// Signatures of file types commonly collected for triage.
+var fileSignatures = []struct {
+	offset    int
+	signature []byte
+	name      string
+}{
+	{0, []byte("MZ"), "PE executable"},
+	{0, []byte("\x7fELF"), "ELF executable"},
+	{0, []byte("\xcf\xfa\xed\xfe"), "Mach-O executable (64 bit)"},
+	{0, []byte("\xce\xfa\xed\xfe"), "Mach-O executable (32 bit)"},
+	{0, []byte("\xca\xfe\xba\xbe"), "Mach-O universal binary"},
+	{0, []byte("dex\n"), "Android DEX"},
+	{0, []byte("PK\x03\x04"), "ZIP archive"},
+	{0, []byte("\x1f\x8b"), "GZIP compressed data"},
+	{0, []byte("7z\xbc\xaf\x27\x1c"), "7-Zip archive"},
+	{0, []byte("Rar!\x1a\x07"), "RAR archive"},
+	{0, []byte("BZh"), "BZIP2 compressed data"},
+	{0, []byte("\xfd7zXZ\x00"), "XZ compressed data"},
+	{0, []byte("MSCF"), "Microsoft Cabinet archive"},
+	{0, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"), "OLE2 compound document"},
+	{0, []byte("%PDF-"), "PDF document"},
+	{0, []byte("{\\rtf"), "RTF document"},
+	{0, []byte("SQLite format 3\x00"), "SQLite database"},
+	{0, []byte("regf"), "Windows registry hive"},
+	{0, []byte("ElfFile\x00"), "Windows event log (EVTX)"},
+	{4, []byte("SCCA"), "Windows prefetch"},
+	{0, []byte("MAM\x04"), "Windows prefetch (compressed)"},
+	{0, []byte("L\x00\x00\x00\x01\x14\x02\x00"), "Windows shortcut (LNK)"},
+	{0, []byte("\x89PNG\r\n\x1a\n"), "PNG image"},
+	{0, []byte("\xff\xd8\xff"), "JPEG image"},
+	{0, []byte("GIF8"), "GIF image"},
+	{0, []byte("#!"), "Script"},
+}
+
+// Detect the type of a file from its header.
+func detectFileType(buf []byte) string {
+	for _, sig := range fileSignatures {
+		end := sig.offset + len(sig.signature)
+		if len(buf) >= end &&
+			bytes.Equal(buf[sig.offset:end], sig.signature) {
+			return sig.name
+		}
+	}
+
+	if len(buf) == 0 {
+		return "empty"
+	}
+
+	if strings.HasPrefix(http.DetectContentType(buf), "text/") {
+		return "text"
+	}
+
+	return "data"
+}
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectFileType(t *testing.T) {
+	assert.Equal(t, "PE executable", detectFileType([]byte("MZ\x90\x00\x03")))
+	assert.Equal(t, "ELF executable", detectFileType([]byte("\x7fELF\x02\x01")))
+	assert.Equal(t, "Windows prefetch",
+		detectFileType([]byte("\x1e\x00\x00\x00SCCA\x11\x00")))
+	assert.Equal(t, "text", detectFileType([]byte("hello world\n")))
+	assert.Equal(t, "data", detectFileType([]byte{0x00, 0x01, 0x02, 0xff}))
+	assert.Equal(t, "empty", detectFileType(nil))
+}
+
+func TestExtractStrings(t *testing.T) {
+	buf := []byte("\x00\x01abc\x00hello\x00\xffworld wide\x02")
+	assert.Equal(t, []string{"hello", "world wide"}, extractStrings(buf, 0))
+	assert.Equal(t, []string{"abc", "hello", "world wide"}, extractStrings(buf, 3))
+}
@@ -130,6 +130,13 @@ func PrepareGUIMux(
 		server_obj.Info("GUI will use the %v authenticator", config_obj.GUI.Authenticator.Type)
 	}
 
+	// Middleware is applied to all the routes before the
+	// authenticator.
+	middleware, err := authenticators.NewMiddleware(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
 	// Add the authenticator specific handlers.
 	err = auther.AddHandlers(mux)
 	if err != nil {
@@ -143,50 +150,54 @@ func PrepareGUIMux(
 	}
 
 	base := api_utils.GetBasePath(config_obj)
-	mux.Handle(api_utils.Join(base, "/api/"), ipFilter(config_obj,
+	mux.Handle(api_utils.Join(base, "/api/"), middleware(
 		csrfProtect(config_obj,
 			auther.AuthenticateUserHandler(h))))
 
 	mux.Handle(api_utils.Join(base, "/api/v1/DownloadTable"),
-		ipFilter(config_obj, csrfProtect(config_obj,
+		middleware(csrfProtect(config_obj,
 			auther.AuthenticateUserHandler(downloadTable()))))
 
 	mux.Handle(api_utils.Join(base, "/api/v1/DownloadVFSFile"),
-		ipFilter(config_obj, csrfProtect(config_obj,
+		middleware(csrfProtect(config_obj,
 			auther.AuthenticateUserHandler(vfsFileDownloadHandler()))))
 
+	mux.Handle(api_utils.Join(base, "/api/v1/PreviewVFSFile"),
+		middleware(csrfProtect(config_obj,
+			auther.AuthenticateUserHandler(vfsFilePreviewHandler()))))
+
 	mux.Handle(api_utils.Join(base, "/api/v1/UploadTool"),
-		ipFilter(config_obj, csrfProtect(config_obj,
+		middleware(csrfProtect(config_obj,
 			auther.AuthenticateUserHandler(toolUploadHandler()))))
 
 	mux.Handle(api_utils.Join(base, "/api/v1/UploadFormFile"),
-		ipFilter(config_obj, csrfProtect(config_obj,
+		middleware(csrfProtect(config_obj,
 			auther.AuthenticateUserHandler(formUploadHandler()))))
 
 	// Serve prepared zip files.
 	mux.Handle(api_utils.Join(base, "/downloads/"),
-		ipFilter(config_obj, csrfProtect(config_obj,
+		middleware(csrfProtect(config_obj,
 			auther.AuthenticateUserHandler(
 				http.StripPrefix(base,
 					downloadFileStore([]string{"downloads"}))))))
 
 	// Serve notebook items
 	mux.Handle(api_utils.Join(base, "/notebooks/"),
-		ipFilter(config_obj, csrfProtect(config_obj,
+		middleware(csrfProtect(config_obj,
 			auther.AuthenticateUserHandler(
 				http.StripPrefix(base,
 					downloadFileStore([]string{"notebooks"}))))))
 
 	// Serve files from hunt notebooks
 	mux.Handle(api_utils.Join(base, "/hunts/"),
-		ipFilter(config_obj, csrfProtect(config_obj,
+		middleware(csrfProtect(config_obj,
 			auther.AuthenticateUserHandler(
 				http.StripPrefix(base,
 					downloadFileStore([]string{"hunts"}))))))
 
 	// Serve files from client notebooks
 	mux.Handle(api_utils.Join(base, "/clients/"),
-		ipFilter(config_obj, csrfProtect(config_obj,
+		middleware(csrfProtect(config_obj,
 			auther.AuthenticateUserHandler(
 				http.StripPrefix(base,
 					downloadFileStore([]string{"clients"}))))))
@@ -205,7 +216,7 @@ func PrepareGUIMux(
 		return nil, err
 	}
 	mux.Handle(api_utils.Join(base, "/app/index.html"),
-		ipFilter(config_obj,
+		middleware(
 			csrfProtect(config_obj, auther.AuthenticateUserHandler(h))))
 
 	// Redirect everything else to the app
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
+	api_proto "www.velocidex.com/golang/velociraptor/api/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/grpc_client"
+	"www.velocidex.com/golang/velociraptor/json"
+	logging "www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+// Commands for analysts and automation which drive a remote server
+// through the API. They need an API client config (see `config
+// api_client`) and use the same gRPC connection as `query`, so
+// scripts do not need to write any gRPC code.
+var (
+	collect_command = app.Command(
+		"collect", "Collect artifacts from a client through the API.")
+
+	collect_command_client_id = collect_command.Arg(
+		"client_id", "The client to collect from.").Required().String()
+
+	collect_command_artifacts = collect_command.Arg(
+		"artifacts", "The artifacts to collect.").Required().Strings()
+
+	collect_command_args = collect_command.Flag(
+		"args", "Artifact parameters as name=value.").StringMap()
+
+	collect_command_org = collect_command.Flag(
+		"org", "The org to collect in (default the API user's org).").
+		Default("").String()
+
+	collect_command_urgent = collect_command.Flag(
+		"urgent", "Run the collection ahead of others queued on the client.").
+		Bool()
+
+	collect_command_timeout = collect_command.Flag(
+		"timeout", "Time the collection out on the client after this many seconds.").
+		Default("0").Uint64()
+
+	collect_command_follow = collect_command.Flag(
+		"follow", "Wait for the collection to finish and print results as JSONL as they arrive.").
+		Bool()
+
+	collect_command_poll = collect_command.Flag(
+		"poll", "How often to check for new results when following (seconds).").
+		Default("5").Int64()
+
+	download_command = app.Command(
+		"download", "Download a collection's results and uploads as a zip file through the API.")
+
+	download_command_client_id = download_command.Arg(
+		"client_id", "The client the collection was made on.").Required().String()
+
+	download_command_flow_id = download_command.Arg(
+		"flow_id", "The collection to download.").Required().String()
+
+	download_command_output = download_command.Flag(
+		"output", "Where to write the zip file (default the name the server gives it).").
+		Default("").String()
+
+	download_command_password = download_command.Flag(
+		"password", "Encrypt the zip file with this password.").
+		Default("").String()
+
+	download_command_expand_sparse = download_command.Flag(
+		"expand_sparse", "Expand sparse files in the zip file.").Bool()
+)
+
+const (
+	collectQuery = `
+SELECT collect_client(client_id=ClientId,
+   artifacts=parse_json_array(data=Artifacts),
+   env=parse_json(data=Parameters),
+   urgent=Urgent = "Y", timeout=int(int=Timeout)).flow_id AS FlowId
+FROM scope()`
+
+	flowStateQuery = `
+SELECT state, status, artifacts_with_results
+FROM flows(client_id=ClientId, flow_id=FlowId)`
+
+	flowResultsQuery = `
+SELECT * FROM source(client_id=ClientId, flow_id=FlowId,
+   artifact=Artifact, start_row=int(int=StartRow))`
+
+	downloadQuery = `
+SELECT create_flow_download(client_id=ClientId, flow_id=FlowId,
+   wait=TRUE, password=Password,
+   expand_sparse=ExpandSparse = "Y") AS VFSPath
+FROM scope()`
+
+	// Size of each read when downloading files.
+	downloadChunkSize = 1024 * 1024
+)
+
+func loadAPIClientConfig() (*config_proto.Config, error) {
+	config_obj, err := APIConfigLoader.WithNullLoader().LoadAndValidate()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load config file: %w", err)
+	}
+
+	if config_obj.ApiConfig == nil || config_obj.ApiConfig.Name == "" {
+		return nil, errors.New(
+			"An API client config is required (use --api_config)")
+	}
+
+	return config_obj, nil
+}
+
+// Run a query on the server and call cb for every row. The env
+// values are passed to the query as strings.
+func runRemoteQuery(
+	ctx context.Context, client api_proto.APIClient,
+	config_obj *config_proto.Config, org_id string,
+	query string, env *ordereddict.Dict,
+	cb func(row *ordereddict.Dict) error) error {
+
+	logger := logging.GetLogger(config_obj, &logging.ToolComponent)
+
+	request := &actions_proto.VQLCollectorArgs{
+		OrgId:   org_id,
+		MaxRow:  1000,
+		MaxWait: 1,
+		Query:   []*actions_proto.VQLRequest{{VQL: query}},
+	}
+
+	for _, k := range env.Keys() {
+		v, _ := env.GetString(k)
+		request.Env = append(request.Env, &actions_proto.VQLEnv{
+			Key: k, Value: v})
+	}
+
+	stream, err := client.Query(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	for {
+		response, err := stream.Recv()
+		if response == nil && err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if response.Log != "" {
+			logger.Info(response.Log)
+			continue
+		}
+
+		json_response := response.Response
+		if json_response == "" {
+			json_response = response.JSONLResponse
+		}
+
+		rows, err := utils.ParseJsonToDicts([]byte(json_response))
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			err = cb(row)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func doCollect() error {
+	logging.DisableLogging()
+
+	config_obj, err := loadAPIClientConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := install_sig_handler()
+	defer cancel()
+
+	client, closer, err := grpc_client.Factory.GetAPIClient(
+		ctx, grpc_client.API_User, config_obj)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = closer() }()
+
+	parameters := ordereddict.NewDict()
+	for k, v := range *collect_command_args {
+		parameters.Set(k, v)
+	}
+
+	urgent := ""
+	if *collect_command_urgent {
+		urgent = "Y"
+	}
+
+	env := ordereddict.NewDict().
+		Set("ClientId", *collect_command_client_id).
+		Set("Artifacts", json.MustMarshalString(*collect_command_artifacts)).
+		Set("Parameters", json.MustMarshalString(parameters)).
+		Set("Urgent", urgent).
+		Set("Timeout", fmt.Sprintf("%d", *collect_command_timeout))
+
+	flow_id := ""
+	err = runRemoteQuery(ctx, client, config_obj, *collect_command_org,
+		collectQuery, env, func(row *ordereddict.Dict) error {
+			flow_id, _ = row.GetString("FlowId")
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	if flow_id == "" {
+		return errors.New("Unable to schedule the collection")
+	}
+
+	if !*collect_command_follow {
+		fmt.Println(flow_id)
+		return nil
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.ToolComponent)
+	logger.Info("Collecting %v from %v in flow %v",
+		*collect_command_artifacts, *collect_command_client_id, flow_id)
+
+	return followCollection(ctx, client, config_obj, *collect_command_org,
+		*collect_command_client_id, flow_id,
+		time.Duration(*collect_command_poll)*time.Second)
+}
+
+// Print the flow's results as they arrive until the flow is done.
+func followCollection(
+	ctx context.Context, client api_proto.APIClient,
+	config_obj *config_proto.Config, org_id string,
+	client_id, flow_id string, poll time.Duration) error {
+
+	// How many rows of each artifact were already printed.
+	printed := make(map[string]int64)
+
+	for {
+		env := ordereddict.NewDict().
+			Set("ClientId", client_id).
+			Set("FlowId", flow_id)
+
+		state := ""
+		status := ""
+		var artifacts []string
+
+		err := runRemoteQuery(ctx, client, config_obj, org_id,
+			flowStateQuery, env, func(row *ordereddict.Dict) error {
+				state, _ = row.GetString("state")
+				status, _ = row.GetString("status")
+				artifacts, _ = row.GetStrings("artifacts_with_results")
+				return nil
+			})
+		if err != nil {
+			return err
+		}
+
+		if state == "" {
+			return fmt.Errorf("Flow %v not found", flow_id)
+		}
+
+		// Results are fetched after the state so the last pass
+		// sees all the results of a completed flow.
+		for _, artifact := range artifacts {
+			env := ordereddict.NewDict().
+				Set("ClientId", client_id).
+				Set("FlowId", flow_id).
+				Set("Artifact", artifact).
+				Set("StartRow", fmt.Sprintf("%d", printed[artifact]))
+
+			err := runRemoteQuery(ctx, client, config_obj, org_id,
+				flowResultsQuery, env, func(row *ordereddict.Dict) error {
+					printed[artifact]++
+					row.Set("_Source", artifact)
+					fmt.Println(json.MustMarshalString(row))
+					return nil
+				})
+			if err != nil {
+				return err
+			}
+		}
+
+		switch state {
+		case "RUNNING":
+		case "FINISHED":
+			return nil
+		default:
+			return fmt.Errorf("Flow %v is %v: %v", flow_id, state, status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(poll):
+		}
+	}
+}
+
+func doDownload() error {
+	logging.DisableLogging()
+
+	config_obj, err := loadAPIClientConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := install_sig_handler()
+	defer cancel()
+
+	client, closer, err := grpc_client.Factory.GetAPIClient(
+		ctx, grpc_client.API_User, config_obj)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = closer() }()
+
+	expand_sparse := ""
+	if *download_command_expand_sparse {
+		expand_sparse = "Y"
+	}
+
+	env := ordereddict.NewDict().
+		Set("ClientId", *download_command_client_id).
+		Set("FlowId", *download_command_flow_id).
+		Set("Password", *download_command_password).
+		Set("ExpandSparse", expand_sparse)
+
+	// The zip file is read back with VFSGetBuffer which works in the
+	// API user's org so we prepare it there too.
+	vfs_path := ""
+	err = runRemoteQuery(ctx, client, config_obj, "",
+		downloadQuery, env, func(row *ordereddict.Dict) error {
+			vfs_path, _ = row.GetString("VFSPath")
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(vfs_path, "fs:") {
+		return errors.New("Unable to prepare the download")
+	}
+
+	components := utils.SplitComponents(strings.TrimPrefix(vfs_path, "fs:"))
+	if len(components) == 0 {
+		return fmt.Errorf("Invalid download path %v", vfs_path)
+	}
+
+	output := *download_command_output
+	if output == "" {
+		output = path.Base(components[len(components)-1])
+	}
+
+	out_fd, err := os.OpenFile(output,
+		os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out_fd.Close()
+
+	var offset uint64
+	for {
+		response, err := client.VFSGetBuffer(ctx, &api_proto.VFSFileBuffer{
+			Components: components,
+			Offset:     offset,
+			Length:     downloadChunkSize,
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(response.Data) == 0 {
+			break
+		}
+
+		_, err = out_fd.Write(response.Data)
+		if err != nil {
+			return err
+		}
+		offset += uint64(len(response.Data))
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.ToolComponent)
+	logger.Info("Downloaded %v bytes to %v", offset, output)
+
+	return nil
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case collect_command.FullCommand():
+			FatalIfError(collect_command, doCollect)
+
+		case download_command.FullCommand():
+			FatalIfError(download_command, doDownload)
+
+		default:
+			return false
+		}
+		return true
+	})
+}
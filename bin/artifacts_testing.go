@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"google.golang.org/protobuf/proto"
+	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/startup"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
+	vfilter "www.velocidex.com/golang/vfilter"
+)
+
+var (
+	artifact_command_test = artifact_command.Command(
+		"test", "Run artifact unit tests against fixture files.")
+
+	artifact_command_test_paths = artifact_command_test.Arg(
+		"paths", "Test files (*.test.yaml) or directories containing them.").
+		Required().Strings()
+
+	artifact_command_test_update = artifact_command_test.Flag(
+		"update", "Write the actual results as the expected results.").Bool()
+
+	artifact_command_test_filter = artifact_command_test.Flag(
+		"filter", "Only run tests with names matching this prefix.").String()
+)
+
+const (
+	ARTIFACT_TEST_SUFFIX     = ".test.yaml"
+	ARTIFACT_EXPECTED_SUFFIX = ".expected.json"
+
+	// Replaced with the directory containing the test file in
+	// remapping prefixes.
+	TESTDIR_PLACEHOLDER = "%TESTDIR%"
+)
+
+/*
+An artifact unit test. For example:
+
+	name: Detects the run key
+	artifact: Custom.Windows.Persistence.RunKeys
+	parameters:
+	  KeyGlob: HKEY_LOCAL_MACHINE\Software\Microsoft\Windows\CurrentVersion\Run\*
+	remappings:
+	- type: mount
+	  from:
+	    accessor: raw_reg
+	    prefix: |
+	      {"Path": "%TESTDIR%/fixtures/SOFTWARE", "DelegateAccessor": "file"}
+	    path_type: registry
+	  "on":
+	    accessor: registry
+	    prefix: HKEY_LOCAL_MACHINE\Software
+	    path_type: registry
+
+The remappings are the same as the config file's `remappings` and
+allow fixture directories, hives and event logs to appear where the
+artifact expects them. Relative prefixes for the file accessor are
+resolved against the test file's directory.
+
+The results of each source are compared against the
+<name>.expected.json file next to the test file.
+*/
+type artifactTestSpec struct {
+	Name          string                          `json:"name"`
+	Artifact      string                          `json:"artifact"`
+	Parameters    map[string]string               `json:"parameters"`
+	Remappings    []*config_proto.RemappingConfig `json:"remappings"`
+	IgnoreColumns []string                        `json:"ignore_columns"`
+}
+
+func findArtifactTests(paths []string) ([]string, error) {
+	var result []string
+
+	for _, path := range paths {
+		err := filepath.Walk(path, func(
+			file_path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !info.IsDir() && strings.HasSuffix(file_path, ARTIFACT_TEST_SUFFIX) {
+				result = append(result, file_path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Run the test cases in a predictable way
+	sort.Strings(result)
+	return result, nil
+}
+
+// Resolve fixture paths relative to the test file.
+func resolveTestRemappings(test_dir string,
+	remappings []*config_proto.RemappingConfig) []*config_proto.RemappingConfig {
+	result := make([]*config_proto.RemappingConfig, 0, len(remappings))
+	for _, remapping := range remappings {
+		remapping = proto.Clone(remapping).(*config_proto.RemappingConfig)
+
+		if remapping.From != nil {
+			from := remapping.From
+			from.Prefix = strings.ReplaceAll(from.Prefix,
+				TESTDIR_PLACEHOLDER, filepath.ToSlash(test_dir))
+
+			if (from.Accessor == "file" || from.Accessor == "") &&
+				from.Prefix != "" && !filepath.IsAbs(from.Prefix) {
+				from.Prefix = filepath.Join(test_dir, from.Prefix)
+			}
+		}
+		result = append(result, remapping)
+	}
+	return result
+}
+
+func runArtifactTest(
+	sm *services.Service,
+	config_obj *config_proto.Config,
+	spec *artifactTestSpec, test_dir string) (*ordereddict.Dict, error) {
+
+	// Freeze the time so results are repeatable.
+	closer := utils.MockTime(utils.NewMockClock(time.Unix(1590938885, 10)))
+	defer closer()
+
+	ctx := sm.Ctx
+
+	// Each test runs with its own remappings applied to all scopes.
+	test_config := proto.Clone(config_obj).(*config_proto.Config)
+	if len(spec.Remappings) > 0 {
+		test_config.Remappings = resolveTestRemappings(
+			test_dir, spec.Remappings)
+	}
+
+	launcher, err := services.GetLauncher(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	repository, err := getRepository(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &flows_proto.ArtifactCollectorArgs{
+		Artifacts: []string{spec.Artifact},
+	}
+	if len(spec.Parameters) > 0 {
+		keys := make([]string, 0, len(spec.Parameters))
+		for k := range spec.Parameters {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		parameters := &flows_proto.ArtifactParameters{}
+		for _, k := range keys {
+			parameters.Env = append(parameters.Env,
+				&actions_proto.VQLEnv{Key: k, Value: spec.Parameters[k]})
+		}
+		request.Specs = []*flows_proto.ArtifactSpec{{
+			Artifact:   spec.Artifact,
+			Parameters: parameters,
+		}}
+	}
+
+	queries, err := launcher.CompileCollectorArgs(ctx, config_obj,
+		acl_managers.NullACLManager{}, repository,
+		services.CompilerOptions{}, request)
+	if err != nil {
+		return nil, err
+	}
+
+	manager, err := services.GetRepositoryManager(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	log_writer.Clear()
+	results := ordereddict.NewDict()
+
+	for _, query := range queries {
+		env := ordereddict.NewDict()
+		for _, env_spec := range query.Env {
+			env.Set(env_spec.Key, env_spec.Value)
+		}
+
+		scope := manager.BuildScope(services.ScopeBuilder{
+			Config:     test_config,
+			ACLManager: acl_managers.NullACLManager{},
+			Logger:     log.New(log_writer, "", 0),
+			Env:        env,
+		})
+
+		for _, request := range query.Query {
+			vql, err := vfilter.Parse(request.VQL)
+			if err != nil {
+				scope.Close()
+				return nil, err
+			}
+
+			rows := []*ordereddict.Dict{}
+			for row := range vql.Eval(ctx, scope) {
+				dict := vfilter.RowToDict(ctx, scope, row)
+				for _, column := range spec.IgnoreColumns {
+					dict.Delete(column)
+				}
+				rows = append(rows, dict)
+			}
+
+			// Only named queries produce results.
+			if request.Name != "" {
+				results.Set(request.Name, rows)
+			}
+		}
+		scope.Close()
+	}
+
+	for _, msg := range fatalLogMessagesRegex {
+		matches, err := log_writer.Matches(msg)
+		if matches || err != nil {
+			return nil, fmt.Errorf("Log output matches %q", msg)
+		}
+	}
+
+	return results, nil
+}
+
+func doArtifactTest() error {
+	logging.DisableLogging()
+
+	config_obj, err := makeDefaultConfigLoader().
+		WithNullLoader().LoadAndValidate()
+	if err != nil {
+		return fmt.Errorf("Unable to create config: %w", err)
+	}
+
+	ctx, cancel := install_sig_handler()
+	defer cancel()
+
+	sm, err := startup.StartToolServices(ctx, config_obj)
+	defer sm.Close()
+
+	if err != nil {
+		return err
+	}
+
+	log_writer = &MemoryLogWriter{config_obj: config_obj}
+
+	file_paths, err := findArtifactTests(*artifact_command_test_paths)
+	if err != nil {
+		return err
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.ToolComponent)
+	logger.Info("<green>Running %v artifact tests</>", len(file_paths))
+
+	failures := []string{}
+	for _, file_path := range file_paths {
+		data, err := ioutil.ReadFile(file_path)
+		if err != nil {
+			return fmt.Errorf("Reading file: %w", err)
+		}
+
+		spec := &artifactTestSpec{}
+		err = utils.YamlUnmarshal(data, spec)
+		if err != nil {
+			return fmt.Errorf("%v: %w", file_path, err)
+		}
+
+		if spec.Name == "" {
+			spec.Name = strings.TrimSuffix(
+				filepath.Base(file_path), ARTIFACT_TEST_SUFFIX)
+		}
+
+		if *artifact_command_test_filter != "" &&
+			!strings.HasPrefix(spec.Name, *artifact_command_test_filter) {
+			continue
+		}
+
+		if spec.Artifact == "" {
+			return fmt.Errorf("%v: No artifact specified", file_path)
+		}
+
+		test_dir, err := filepath.Abs(filepath.Dir(file_path))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Running %v (%v)\n", spec.Name, spec.Artifact)
+		results, err := runArtifactTest(sm, config_obj, spec, test_dir)
+		if err != nil {
+			fmt.Printf("FAILED %v: %v\n", spec.Name, err)
+			failures = append(failures, spec.Name)
+			continue
+		}
+
+		serialized, err := json.MarshalIndentNormalized(results)
+		if err != nil {
+			return err
+		}
+		actual := string(serialized)
+
+		expected_path := strings.TrimSuffix(file_path, ARTIFACT_TEST_SUFFIX) +
+			ARTIFACT_EXPECTED_SUFFIX
+		expected, err := ioutil.ReadFile(expected_path)
+		if err != nil {
+			fmt.Printf("No expected results for %v:\n%v\n", spec.Name, actual)
+			failures = append(failures, spec.Name)
+
+		} else if strings.TrimSpace(string(expected)) != strings.TrimSpace(actual) {
+			dmp := diffmatchpatch.New()
+			diffs := dmp.DiffMain(string(expected), actual, false)
+			fmt.Printf("FAILED %v:\n%v\n", spec.Name, dmp.DiffPrettyText(diffs))
+			failures = append(failures, spec.Name)
+
+		} else {
+			fmt.Printf("PASSED %v\n", spec.Name)
+		}
+
+		if *artifact_command_test_update {
+			err = ioutil.WriteFile(expected_path, serialized, 0666)
+			if err != nil {
+				return fmt.Errorf("Unable to write expected results: %w", err)
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("Failed %v of %v artifact tests: %v",
+			len(failures), len(file_paths), failures)
+	}
+	return nil
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case artifact_command_test.FullCommand():
+			FatalIfError(artifact_command_test, doArtifactTest)
+
+		default:
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+func TestArtifactTestSpec(t *testing.T) {
+	test_dir := t.TempDir()
+	test_file := filepath.Join(test_dir, "runkeys.test.yaml")
+	err := os.WriteFile(test_file, []byte(`
+artifact: Custom.Windows.RunKeys
+parameters:
+  KeyGlob: "*"
+remappings:
+- type: mount
+  from:
+    accessor: file
+    prefix: fixtures/C
+  "on":
+    accessor: auto
+    prefix: "C:"
+    path_type: windows
+- type: mount
+  from:
+    accessor: raw_reg
+    prefix: '{"Path": "%TESTDIR%/fixtures/SOFTWARE", "DelegateAccessor": "file"}'
+    path_type: registry
+  "on":
+    accessor: registry
+    prefix: HKEY_LOCAL_MACHINE\Software
+    path_type: registry
+ignore_columns:
+- Mtime
+`), 0644)
+	assert.NoError(t, err)
+
+	// Other files are ignored.
+	err = os.WriteFile(filepath.Join(test_dir, "runkeys.expected.json"),
+		[]byte("{}"), 0644)
+	assert.NoError(t, err)
+
+	files, err := findArtifactTests([]string{test_dir})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{test_file}, files)
+
+	data, err := os.ReadFile(test_file)
+	assert.NoError(t, err)
+
+	spec := &artifactTestSpec{}
+	err = utils.YamlUnmarshal(data, spec)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Custom.Windows.RunKeys", spec.Artifact)
+	assert.Equal(t, "*", spec.Parameters["KeyGlob"])
+	assert.Equal(t, []string{"Mtime"}, spec.IgnoreColumns)
+
+	remappings := resolveTestRemappings(test_dir, spec.Remappings)
+	assert.Equal(t, 2, len(remappings))
+
+	// Relative file paths are resolved against the test directory.
+	assert.Equal(t, filepath.Join(test_dir, "fixtures", "C"),
+		remappings[0].From.Prefix)
+	assert.Equal(t, "C:", remappings[0].On.Prefix)
+
+	assert.Equal(t, `{"Path": "`+filepath.ToSlash(test_dir)+
+		`/fixtures/SOFTWARE", "DelegateAccessor": "file"}`,
+		remappings[1].From.Prefix)
+
+	// The original spec is not modified.
+	assert.Equal(t, "fixtures/C", spec.Remappings[0].From.Prefix)
+}
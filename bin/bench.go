@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
+	"www.velocidex.com/golang/velociraptor/config"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	crypto_utils "www.velocidex.com/golang/velociraptor/crypto/utils"
+	"www.velocidex.com/golang/velociraptor/json"
+	logging "www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/startup"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
+	"www.velocidex.com/golang/vfilter"
+)
+
+// The bench command measures how quickly this host runs the local
+// actions collections depend on. The report is JSON so it can be
+// kept to size deployments and compared between releases on the
+// same hardware.
+
+var (
+	bench_command = app.Command(
+		"bench", "Measure the throughput of local actions on this host.")
+
+	bench_command_duration = bench_command.Flag(
+		"duration", "Seconds to run each benchmark.").
+		Default("5").Int64()
+
+	bench_command_only = bench_command.Flag(
+		"only", "Only run these benchmarks (may be repeated).").
+		Enums("hash", "glob", "events", "crypto")
+
+	bench_command_path = bench_command.Flag(
+		"path", "Directory to glob (default a generated tree of small files).").
+		String()
+
+	bench_command_hash_size = bench_command.Flag(
+		"hash_size", "Size in MB of the file to hash.").
+		Default("64").Int64()
+
+	bench_command_output = bench_command.Flag(
+		"output", "Write the report to this file instead of stdout.").
+		String()
+)
+
+const (
+	BENCH_EVENT_ARTIFACT = "Server.Internal.Benchmark"
+
+	bench_event_artifact_definition = `
+name: Server.Internal.Benchmark
+description: An internal queue used by the bench command.
+type: INTERNAL
+`
+)
+
+type benchResult struct {
+	Name string `json:"name"`
+
+	// The number of units processed per second.
+	Rate float64 `json:"rate"`
+	Unit string  `json:"unit"`
+
+	Count   int64   `json:"count"`
+	Elapsed float64 `json:"elapsed_sec"`
+	Error   string  `json:"error,omitempty"`
+}
+
+type benchReport struct {
+	Version   string         `json:"version"`
+	Commit    string         `json:"commit"`
+	Hostname  string         `json:"hostname"`
+	OS        string         `json:"os"`
+	Arch      string         `json:"arch"`
+	NumCPU    int            `json:"num_cpu"`
+	Timestamp string         `json:"timestamp"`
+	Results   []*benchResult `json:"results"`
+}
+
+// Call fn repeatedly for the duration (but at least once). fn
+// returns the number of units it processed.
+func runBenchmark(ctx context.Context, name, unit string,
+	duration time.Duration, fn func() (int64, error)) *benchResult {
+	result := &benchResult{Name: name, Unit: unit}
+
+	start := time.Now()
+	for {
+		count, err := fn()
+		if err != nil {
+			result.Error = err.Error()
+			break
+		}
+		result.Count += count
+
+		if ctx.Err() != nil || time.Since(start) > duration {
+			break
+		}
+	}
+
+	result.Elapsed = time.Since(start).Seconds()
+	if result.Elapsed > 0 {
+		result.Rate = float64(result.Count) / result.Elapsed
+	}
+	return result
+}
+
+// Run the query and return the number of rows.
+func runBenchQuery(ctx context.Context, scope vfilter.Scope,
+	query string, env *ordereddict.Dict) (int64, error) {
+	vql, err := vfilter.Parse(query)
+	if err != nil {
+		return 0, err
+	}
+
+	sub_scope := scope.Copy()
+	defer sub_scope.Close()
+
+	sub_scope.AppendVars(env)
+
+	var count int64
+	for row := range vql.Eval(ctx, sub_scope) {
+		value, pres := sub_scope.Associative(row, "Value")
+		if !pres || utils.IsNil(value) {
+			return count, errors.New("Query returned no value")
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Hashes a file which was just written so it is usually read from
+// the page cache - this measures hashing and not the disk.
+func benchHash(ctx context.Context, scope vfilter.Scope,
+	tmpdir string, duration time.Duration) *benchResult {
+	path := filepath.Join(tmpdir, "hash.bin")
+	size := *bench_command_hash_size * 1024 * 1024
+
+	err := writeRandomFile(path, size)
+	if err != nil {
+		return &benchResult{Name: "hash_sha256", Error: err.Error()}
+	}
+
+	return runBenchmark(ctx, "hash_sha256", "MB/s", duration,
+		func() (int64, error) {
+			_, err := runBenchQuery(ctx, scope, `
+SELECT hash(path=Path, hashselect=["SHA256"]).SHA256 AS Value FROM scope()`,
+				ordereddict.NewDict().Set("Path", path))
+			return size / (1024 * 1024), err
+		})
+}
+
+func benchGlob(ctx context.Context, scope vfilter.Scope,
+	tmpdir string, duration time.Duration) *benchResult {
+	root := *bench_command_path
+	if root == "" {
+		root = filepath.Join(tmpdir, "glob")
+		err := writeGlobTree(root)
+		if err != nil {
+			return &benchResult{Name: "glob", Error: err.Error()}
+		}
+	}
+
+	return runBenchmark(ctx, "glob", "files/s", duration,
+		func() (int64, error) {
+			return runBenchQuery(ctx, scope, `
+SELECT OSPath AS Value FROM glob(globs="**", root=Root)`,
+				ordereddict.NewDict().Set("Root", root))
+		})
+}
+
+// Measure how quickly rows pushed into an event queue reach a
+// watcher. Client event artifacts are delivered through the same
+// queues.
+func benchEvents(ctx context.Context, config_obj *config_proto.Config,
+	duration time.Duration) *benchResult {
+	result := &benchResult{Name: "events", Unit: "rows/s"}
+
+	repository, err := getRepository(config_obj)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	_, err = repository.LoadYaml(bench_event_artifact_definition,
+		services.ArtifactOptions{ArtifactIsBuiltIn: true})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	journal, err := services.GetJournal(config_obj)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	sub_ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	events, closer := journal.Watch(sub_ctx, BENCH_EVENT_ARTIFACT, "bench")
+	defer closer()
+
+	batch := make([]*ordereddict.Dict, 0, 100)
+	for i := 0; i < 100; i++ {
+		batch = append(batch, ordereddict.NewDict().
+			Set("Id", i).
+			Set("Message", "The quick brown fox jumps over the lazy dog"))
+	}
+
+	// Do not get too far ahead of the watcher or the queue will
+	// buffer the rows to disk.
+	var sent, received int64
+	errors_chan := make(chan error, 1)
+	go func() {
+		for sub_ctx.Err() == nil {
+			if atomic.LoadInt64(&sent)-atomic.LoadInt64(&received) > 1000 {
+				time.Sleep(time.Millisecond)
+				continue
+			}
+
+			err := journal.Broadcast(sub_ctx, config_obj, batch,
+				BENCH_EVENT_ARTIFACT, "server", "")
+			if err != nil {
+				errors_chan <- err
+				cancel()
+				return
+			}
+			atomic.AddInt64(&sent, int64(len(batch)))
+		}
+	}()
+
+	start := time.Now()
+	for {
+		select {
+		case <-sub_ctx.Done():
+			select {
+			case err := <-errors_chan:
+				result.Error = err.Error()
+			default:
+			}
+
+			result.Elapsed = time.Since(start).Seconds()
+			if result.Elapsed > 0 {
+				result.Rate = float64(result.Count) / result.Elapsed
+			}
+			return result
+
+		case _, ok := <-events:
+			if !ok {
+				cancel()
+				continue
+			}
+			result.Count++
+			atomic.AddInt64(&received, 1)
+		}
+	}
+}
+
+func benchCrypto(ctx context.Context,
+	duration time.Duration) []*benchResult {
+	pem, err := crypto_utils.GeneratePrivateKey()
+	if err != nil {
+		return []*benchResult{{Name: "crypto", Error: err.Error()}}
+	}
+
+	key, err := crypto_utils.ParseRsaPrivateKeyFromPemStr(pem)
+	if err != nil {
+		return []*benchResult{{Name: "crypto", Error: err.Error()}}
+	}
+
+	data := make([]byte, 4096)
+	_, err = rand.Read(data)
+	if err != nil {
+		return []*benchResult{{Name: "crypto", Error: err.Error()}}
+	}
+
+	signature, err := crypto_utils.SignSHA256(key, data)
+	if err != nil {
+		return []*benchResult{{Name: "crypto", Error: err.Error()}}
+	}
+
+	// A typical task sent to a client.
+	message := &crypto_proto.VeloMessage{
+		SessionId: "F.1234",
+		FlowRequest: &crypto_proto.FlowRequest{
+			VQLClientActions: []*actions_proto.VQLCollectorArgs{{
+				Query: []*actions_proto.VQLRequest{{
+					Name: "Benchmark",
+					VQL:  fmt.Sprintf("SELECT * FROM info() WHERE Data = '%x'", data),
+				}},
+			}},
+		},
+	}
+
+	return []*benchResult{
+		runBenchmark(ctx, "rsa_sign", "ops/s", duration,
+			func() (int64, error) {
+				_, err := crypto_utils.SignSHA256(key, data)
+				return 1, err
+			}),
+
+		runBenchmark(ctx, "rsa_verify", "ops/s", duration,
+			func() (int64, error) {
+				return 1, crypto_utils.VerifySHA256(
+					&key.PublicKey, data, signature)
+			}),
+
+		runBenchmark(ctx, "seal_message", "ops/s", duration,
+			func() (int64, error) {
+				_, err := crypto_utils.SealMessage(&key.PublicKey, message)
+				return 1, err
+			}),
+	}
+}
+
+func writeRandomFile(path string, size int64) error {
+	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	_, err = io.CopyN(fd, rand.Reader, size)
+	return err
+}
+
+// A tree of 1000 small files in 20 directories.
+func writeGlobTree(root string) error {
+	for i := 0; i < 20; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir%02d", i))
+		err := os.MkdirAll(dir, 0700)
+		if err != nil {
+			return err
+		}
+
+		for j := 0; j < 50; j++ {
+			err = os.WriteFile(
+				filepath.Join(dir, fmt.Sprintf("file%02d.txt", j)),
+				[]byte("hello"), 0600)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func doBench() error {
+	logging.DisableLogging()
+
+	config_obj, err := makeDefaultConfigLoader().
+		WithNullLoader().LoadAndValidate()
+	if err != nil {
+		return fmt.Errorf("Unable to load config file: %w", err)
+	}
+
+	ctx, cancel := install_sig_handler()
+	defer cancel()
+
+	sm, err := startup.StartToolServices(ctx, config_obj)
+	defer sm.Close()
+
+	if err != nil {
+		return err
+	}
+
+	manager, err := services.GetRepositoryManager(config_obj)
+	if err != nil {
+		return err
+	}
+
+	logger := &LogWriter{config_obj: config_obj}
+	scope := manager.BuildScope(services.ScopeBuilder{
+		Config:     config_obj,
+		ACLManager: acl_managers.NullACLManager{},
+		Logger:     log.New(logger, "", 0),
+		Env:        ordereddict.NewDict(),
+	})
+	defer scope.Close()
+
+	tmpdir, err := os.MkdirTemp("", "velociraptor_bench")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	selected := func(name string) bool {
+		if len(*bench_command_only) == 0 {
+			return true
+		}
+		for _, item := range *bench_command_only {
+			if item == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	duration := time.Duration(*bench_command_duration) * time.Second
+	version := config.GetVersion()
+	hostname, _ := os.Hostname()
+
+	report := &benchReport{
+		Version:   version.Version,
+		Commit:    version.Commit,
+		Hostname:  hostname,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		NumCPU:    runtime.NumCPU(),
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	if selected("hash") {
+		report.Results = append(report.Results,
+			benchHash(ctx, scope, tmpdir, duration))
+	}
+
+	if selected("glob") {
+		report.Results = append(report.Results,
+			benchGlob(ctx, scope, tmpdir, duration))
+	}
+
+	if selected("events") {
+		report.Results = append(report.Results,
+			benchEvents(ctx, config_obj, duration))
+	}
+
+	if selected("crypto") {
+		report.Results = append(report.Results,
+			benchCrypto(ctx, duration)...)
+	}
+
+	out_fd := os.Stdout
+	if *bench_command_output != "" {
+		out_fd, err = os.OpenFile(*bench_command_output,
+			os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer out_fd.Close()
+	}
+
+	_, err = out_fd.Write(json.MustMarshalIndent(report))
+	if err != nil {
+		return err
+	}
+	_, err = out_fd.Write([]byte("\n"))
+	return err
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case bench_command.FullCommand():
+			FatalIfError(bench_command, doBench)
+
+		default:
+			return false
+		}
+		return true
+	})
+}
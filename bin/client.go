@@ -123,6 +123,14 @@ func runClientOnce(
 
 	executor.SetTempfile(config_obj)
 
+	// Modules must be loaded before any queries run so their
+	// plugins are available.
+	err = executor.LoadSignedModules(config_obj)
+	if err != nil {
+		logger := logging.GetLogger(config_obj, &logging.ClientComponent)
+		logger.Error("<red>LoadSignedModules Error:</> %v", err)
+	}
+
 	writeback_service := writeback.GetWritebackService()
 	writeback, err := writeback_service.GetWriteback(config_obj)
 	if err != nil {
@@ -60,6 +60,25 @@ var (
 	config_client_command = config_command.Command(
 		"client", "Dump the client's config file.")
 
+	config_deployment_script_command = config_command.Command(
+		"deployment_script", "Generate a script to deploy the client.")
+
+	config_deployment_script_os = config_deployment_script_command.Flag(
+		"os", "The OS to generate the script for.").
+		Default("windows").Enum("windows", "linux")
+
+	config_deployment_script_token = config_deployment_script_command.Flag(
+		"token", "The bootstrap token to use (default the first of Frontend.bootstrap_tokens).").
+		String()
+
+	config_deployment_script_tool = config_deployment_script_command.Flag(
+		"tool", "The inventory tool to download (default VelociraptorWindows or VelociraptorLinux).").
+		String()
+
+	config_deployment_script_one_liner = config_deployment_script_command.Flag(
+		"one_liner", "Emit the script as a single command line.").
+		Bool()
+
 	config_api_client_command = config_command.Command(
 		"api_client", "Dump an api_client config file.")
 
@@ -259,6 +278,11 @@ func doGenerateConfigNonInteractive() error {
 	// Users have to update the following fields.
 	config_obj.Client.ServerUrls = []string{"https://localhost:8000/"}
 
+	// The frontend certificate was just issued by our own CA so
+	// clients should only trust that (may be overridden by a merge
+	// when using a public certificate).
+	config_obj.Client.UseSelfSignedSsl = true
+
 	err = applyMergesAndPatches(config_obj,
 		*config_generate_command_merge_file,
 		*config_generate_command_merge,
@@ -413,6 +437,70 @@ func doDumpClientConfig() error {
 	return nil
 }
 
+func doDeploymentScript() error {
+	logging.DisableLogging()
+
+	config_obj, err := makeDefaultConfigLoader().
+		WithRequiredClient().
+		WithRequiredFrontend().LoadAndValidate()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := install_sig_handler()
+	defer cancel()
+
+	config_obj.Services = services.GenericToolServices()
+	sm, err := startup.StartToolServices(ctx, config_obj)
+	if err != nil {
+		return fmt.Errorf("Starting services: %w", err)
+	}
+	defer sm.Close()
+
+	config_obj, err = maybeGetOrgConfig(*config_command_org, config_obj)
+	if err != nil {
+		return err
+	}
+
+	if len(config_obj.Client.ServerUrls) == 0 {
+		return errors.New("No server_urls configured")
+	}
+
+	token := *config_deployment_script_token
+	if token == "" && config_obj.Frontend != nil &&
+		len(config_obj.Frontend.BootstrapTokens) > 0 {
+		token = config_obj.Frontend.BootstrapTokens[0]
+	}
+
+	client_config, err := yaml.Marshal(getClientConfig(config_obj))
+	if err != nil {
+		return fmt.Errorf("Unable to encode config: %w", err)
+	}
+
+	script, err := utils.GenerateDeploymentScript(
+		*config_deployment_script_os, utils.DeploymentScriptOptions{
+			ServerURL: config_obj.Client.ServerUrls[0],
+			Token:     token,
+			Config:    client_config,
+			Tool:      *config_deployment_script_tool,
+		})
+	if err != nil {
+		return err
+	}
+
+	if *config_deployment_script_one_liner {
+		script, err = utils.DeploymentOneLiner(
+			*config_deployment_script_os, script)
+		if err != nil {
+			return err
+		}
+		script += "\n"
+	}
+
+	fmt.Printf("%v", script)
+	return nil
+}
+
 func doDumpApiClientConfig() error {
 	logging.DisableLogging()
 
@@ -592,6 +680,9 @@ func init() {
 		case config_client_command.FullCommand():
 			FatalIfError(config_client_command, doDumpClientConfig)
 
+		case config_deployment_script_command.FullCommand():
+			FatalIfError(config_deployment_script_command, doDeploymentScript)
+
 		case config_api_client_command.FullCommand():
 			FatalIfError(config_api_client_command, doDumpApiClientConfig)
 
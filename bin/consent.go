@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Velocidex/yaml/v2"
+	"www.velocidex.com/golang/velociraptor/actions"
+	logging "www.velocidex.com/golang/velociraptor/logging"
+)
+
+var (
+	config_sign_consent_command = config_command.Command(
+		"sign_consent",
+		"Sign the client's consent notification with the CA key.")
+
+	config_sign_consent_command_message = config_sign_consent_command.Flag(
+		"message", "The message to show users (default Client.consent_message).").
+		String()
+)
+
+func doSignConsent() error {
+	logging.DisableLogging()
+
+	config_obj, err := makeDefaultConfigLoader().
+		WithRequiredCA().
+		WithRequiredClient().
+		LoadAndValidate()
+	if err != nil {
+		return fmt.Errorf("Unable to load config file: %w", err)
+	}
+
+	if *config_sign_consent_command_message != "" {
+		config_obj.Client.ConsentMessage = *config_sign_consent_command_message
+	}
+
+	if config_obj.Client.ConsentMessage == "" {
+		return errors.New("No consent message specified")
+	}
+
+	signature, err := actions.SignConsentMessage(
+		config_obj, config_obj.Client.ConsentMessage)
+	if err != nil {
+		return err
+	}
+	config_obj.Client.ConsentMessageSignature = signature
+
+	res, err := yaml.Marshal(config_obj)
+	if err != nil {
+		return fmt.Errorf("Unable to encode config: %w", err)
+	}
+	fmt.Printf("%v", string(res))
+	return nil
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case config_sign_consent_command.FullCommand():
+			FatalIfError(config_sign_consent_command, doSignConsent)
+
+		default:
+			return false
+		}
+
+		return true
+	})
+}
@@ -104,6 +104,13 @@ func doInstall(config_obj *config_proto.Config) (err error) {
 		return errors.Wrap(err, 0)
 	}
 	if pres {
+		// Remove any tamper protection so we can stop the service.
+		err = unprotectService(service_name)
+		if err != nil {
+			logger.Info("Error removing service protection %v. "+
+				"Will attempt to continue anyway.", err)
+		}
+
 		// We have to stop the service first, or we can not overwrite the file.
 		err = controlService(service_name, svc.Stop, svc.Stopped)
 		if err != nil {
@@ -245,6 +252,14 @@ func installService(
 		logger.Info("SetRecoveryActions() failed: %s", err)
 	}
 
+	// Only SYSTEM may stop or remove the service.
+	if config_obj.Client.TamperProtection {
+		err = executor.ProtectService(s)
+		if err != nil {
+			logger.Info("ProtectService() failed: %s", err)
+		}
+	}
+
 	// Try to create an event source but dont sweat it if it does
 	// not work.
 	err = eventlog.InstallAsEventCreate(
@@ -302,6 +317,23 @@ func controlService(name string, c svc.Cmd, to svc.State) error {
 	return nil
 }
 
+// Restore the default service ACL so administrators may stop and
+// remove a tamper protected service.
+func unprotectService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	return executor.UnprotectService(s)
+}
+
 func removeService(name string) error {
 	m, err := mgr.Connect()
 	if err != nil {
@@ -335,6 +367,12 @@ func doRemove() error {
 	logger := logging.GetLogger(config_obj, &logging.ClientComponent)
 	service_name := config_obj.Client.WindowsInstaller.ServiceName
 
+	err = unprotectService(service_name)
+	if err != nil {
+		logger.Info("Could not remove protection from service %s: %v",
+			service_name, err)
+	}
+
 	// Ensure the service is stopped first.
 	err = controlService(service_name, svc.Stop, svc.Stopped)
 	if err != nil {
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/json"
+	logging "www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/services/sanity"
+	"www.velocidex.com/golang/velociraptor/startup"
+)
+
+var (
+	migrate_command = app.Command(
+		"migrate", "Upgrade the datastore schema to the current release. The server must be stopped.")
+	migrate_command_dry_run = migrate_command.Flag(
+		"dry_run", "Only report what would change.").Bool()
+	migrate_command_status = migrate_command.Flag(
+		"status", "Show the schema version of each org.").Bool()
+	migrate_command_rollback = migrate_command.Flag(
+		"rollback_to", "Roll back migrations newer than this schema version.").
+		Default("-1").Int64()
+	migrate_command_org = migrate_command.Flag(
+		"org", "Only migrate this org (default all orgs).").String()
+)
+
+func doMigrate() error {
+	logging.DisableLogging()
+
+	config_obj, err := makeDefaultConfigLoader().
+		WithRequiredFrontend().
+		WithRequiredUser().LoadAndValidate()
+	if err != nil {
+		return fmt.Errorf("Unable to load config file: %w", err)
+	}
+
+	ctx, cancel := install_sig_handler()
+	defer cancel()
+
+	config_obj.Services = services.GenericToolServices()
+	config_obj.Services.IndexServer = true
+
+	sm, err := startup.StartToolServices(ctx, config_obj)
+	if err != nil {
+		return fmt.Errorf("Starting services: %w", err)
+	}
+	defer sm.Close()
+
+	org_manager, err := services.GetOrgManager()
+	if err != nil {
+		return err
+	}
+
+	for _, org_record := range org_manager.ListOrgs() {
+		if *migrate_command_org != "" && org_record.Id != *migrate_command_org {
+			continue
+		}
+
+		org_config_obj, err := org_manager.GetOrgConfig(org_record.Id)
+		if err != nil {
+			return err
+		}
+
+		version, err := sanity.GetSchemaVersion(org_config_obj)
+		if err != nil {
+			return err
+		}
+
+		result := ordereddict.NewDict().
+			Set("OrgId", org_record.Id).
+			Set("SchemaVersion", version).
+			Set("CurrentSchemaVersion", sanity.CurrentSchemaVersion()).
+			Set("DryRun", *migrate_command_dry_run)
+
+		var migrations []sanity.Migration
+		switch {
+		case *migrate_command_status:
+
+		case *migrate_command_rollback >= 0:
+			migrations, err = sanity.RollbackMigrations(ctx, org_config_obj,
+				*migrate_command_rollback, *migrate_command_dry_run)
+			result.Set("RolledBack", describeMigrations(migrations))
+
+		default:
+			migrations, err = sanity.RunMigrations(ctx, org_config_obj,
+				*migrate_command_dry_run)
+			result.Set("Applied", describeMigrations(migrations))
+		}
+
+		if err != nil {
+			result.Set("Error", err.Error())
+		}
+
+		fmt.Println(string(json.MustMarshalIndent(result)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func describeMigrations(migrations []sanity.Migration) []string {
+	result := []string{}
+	for _, m := range migrations {
+		result = append(result, fmt.Sprintf("%v: %v", m.Version, m.Description))
+	}
+	return result
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case migrate_command.FullCommand():
+			FatalIfError(migrate_command, doMigrate)
+
+		default:
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"www.velocidex.com/golang/velociraptor/executor"
+	logging "www.velocidex.com/golang/velociraptor/logging"
+)
+
+var (
+	module_command = app.Command(
+		"module", "Manage client extension modules.")
+
+	module_sign_command = module_command.Command(
+		"sign", "Sign a module or WebAssembly parser with the CA key.")
+
+	module_sign_command_file = module_sign_command.Arg(
+		"file", "The module to sign.").
+		Required().String()
+
+	module_verify_command = module_command.Command(
+		"verify", "Verify the signature of a module.")
+
+	module_verify_command_file = module_verify_command.Arg(
+		"file", "The module to verify.").
+		Required().String()
+)
+
+func doModuleSign() error {
+	logging.DisableLogging()
+
+	config_obj, err := makeDefaultConfigLoader().
+		WithRequiredCA().
+		LoadAndValidate()
+	if err != nil {
+		return fmt.Errorf("Unable to load config file: %w", err)
+	}
+
+	data, err := os.ReadFile(*module_sign_command_file)
+	if err != nil {
+		return err
+	}
+
+	signature, err := executor.SignModule(config_obj, data)
+	if err != nil {
+		return err
+	}
+
+	sig_file := *module_sign_command_file + executor.SIGNATURE_EXTENSION
+	err = os.WriteFile(sig_file, signature, 0644)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote signature to %v\n", sig_file)
+	fmt.Printf("Signature: %x\n", signature)
+	return nil
+}
+
+func doModuleVerify() error {
+	logging.DisableLogging()
+
+	config_obj, err := makeDefaultConfigLoader().
+		WithRequiredClient().
+		LoadAndValidate()
+	if err != nil {
+		return fmt.Errorf("Unable to load config file: %w", err)
+	}
+
+	data, err := os.ReadFile(*module_verify_command_file)
+	if err != nil {
+		return err
+	}
+
+	signature, err := os.ReadFile(
+		*module_verify_command_file + executor.SIGNATURE_EXTENSION)
+	if err != nil {
+		return err
+	}
+
+	err = executor.VerifyModule(config_obj, data, signature)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Module %v is correctly signed\n", *module_verify_command_file)
+	return nil
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case module_sign_command.FullCommand():
+			FatalIfError(module_sign_command, doModuleSign)
+
+		case module_verify_command.FullCommand():
+			FatalIfError(module_verify_command, doModuleVerify)
+
+		default:
+			return false
+		}
+
+		return true
+	})
+}
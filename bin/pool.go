@@ -52,6 +52,14 @@ var (
 
 	pool_client_start_rate = pool_client_command.Flag(
 		"start_rate", "How many clients per second to start.").Default("20").Uint64()
+
+	pool_client_time_scale = pool_client_command.Flag(
+		"time_scale", "Run the clients' clock this many times faster than real time to simulate poll and backoff behavior quickly.").
+		Default("1").Float64()
+
+	pool_client_mock_responses = pool_client_command.Flag(
+		"mock_responses", "A directory of canned query results (<QueryName>.json). Clients answer collections from these instead of running queries.").
+		ExistingDir()
 )
 
 type counter struct {
@@ -99,6 +107,13 @@ func doPoolClient() error {
 		return err
 	}
 
+	if *pool_client_mock_responses != "" {
+		err = executor.EnableMockResponses(*pool_client_mock_responses)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Make a copy of all the configs for each client.
 	serialized, _ := json.Marshal(client_config)
 	logger := logging.GetLogger(client_config, &logging.ClientComponent)
@@ -109,6 +124,9 @@ func doPoolClient() error {
 	// server to loadshed.
 	throttler := utils.NewThrottler(*pool_client_start_rate)
 
+	// All clients share the same simulated clock.
+	clock := utils.NewScaledClock(*pool_client_time_scale)
+
 	for i := 0; i < number_of_clients; i++ {
 		go func(i int) error {
 
@@ -164,9 +182,10 @@ func doPoolClient() error {
 				return fmt.Errorf("Can not create executor: %w", err)
 			}
 
-			_, err = http_comms.StartHttpCommunicatorService(
+			_, err = http_comms.StartHttpCommunicatorServiceWithClock(
 				sm.Ctx, sm.Wg, client_config, exe,
-				func(ctx context.Context, config_obj *config_proto.Config) {})
+				func(ctx context.Context, config_obj *config_proto.Config) {},
+				clock)
 			if err != nil {
 				logger.Error("StartHttpCommunicatorService: %v", err)
 				return err
@@ -20,9 +20,12 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
 
 	"github.com/Velocidex/ordereddict"
@@ -57,6 +60,30 @@ var (
 	repack_command_output = repack_command.Arg(
 		"output", "The filename to write the repacked binary.").
 		Required().String()
+
+	repack_command_version_info = repack_command.Flag(
+		"version_info", "Windows version information to set (e.g. CompanyName=Acme).").
+		StringMap()
+
+	repack_command_icon = repack_command.Flag(
+		"icon", "An .ico file to use as the Windows binary's icon.").
+		ExistingFile()
+
+	repack_command_sign_cert = repack_command.Flag(
+		"sign_cert", "Authenticode sign the output with this certificate (PEM).").
+		ExistingFile()
+
+	repack_command_sign_key = repack_command.Flag(
+		"sign_key", "The private key (PEM) for --sign_cert.").
+		ExistingFile()
+
+	repack_command_sign_timestamp_url = repack_command.Flag(
+		"sign_timestamp_url", "An RFC 3161 timestamp server to use when signing.").
+		String()
+
+	repack_command_sign_tool = repack_command.Flag(
+		"sign_tool", "The osslsigncode binary used for signing.").
+		Default("osslsigncode").String()
 )
 
 func doRepack() error {
@@ -137,22 +164,38 @@ func doRepack() error {
 			Set("UploadName", filepath.Base(output_path)),
 	}
 
-	query := `
-       SELECT repack(exe=Exe, accessor="file",
-          config=ConfigData, upload_name=UploadName) AS RepackInfo
-       FROM scope()
-`
+	extra_args := ""
 
 	// Repacking binaries requires a working inventory service -
 	// therefore a server config.
 	if len(*repack_command_binaries) > 0 {
-		query = `
-       SELECT repack(exe=Exe, accessor="file", binaries=Binaries,
-          config=ConfigData, upload_name=UploadName) AS RepackInfo
-       FROM scope()
-`
+		extra_args += ", binaries=Binaries"
+	}
+
+	if len(*repack_command_version_info) > 0 {
+		version_info := ordereddict.NewDict()
+		for k, v := range *repack_command_version_info {
+			version_info.Set(k, v)
+		}
+		builder.Env.Set("VersionInfo", version_info)
+		extra_args += ", version_info=VersionInfo"
+	}
+
+	if *repack_command_icon != "" {
+		icon, err := ioutil.ReadFile(*repack_command_icon)
+		if err != nil {
+			return err
+		}
+		builder.Env.Set("Icon", string(icon))
+		extra_args += ", icon=Icon"
 	}
 
+	query := fmt.Sprintf(`
+       SELECT repack(exe=Exe, accessor="file",
+          config=ConfigData, upload_name=UploadName %s) AS RepackInfo
+       FROM scope()
+`, extra_args)
+
 	manager, err := services.GetRepositoryManager(config_obj)
 	if err != nil {
 		return err
@@ -173,7 +216,44 @@ func doRepack() error {
 		}
 	}
 
-	return logger.Error
+	if logger.Error != nil {
+		return logger.Error
+	}
+
+	if *repack_command_sign_cert != "" {
+		return signBinary(ctx, output_path)
+	}
+
+	return nil
+}
+
+// Authenticode sign the binary in place using osslsigncode.
+func signBinary(ctx context.Context, path string) error {
+	if *repack_command_sign_key == "" {
+		return errors.New("--sign_key is required with --sign_cert")
+	}
+
+	signed_path := path + ".signed"
+	argv := []string{"sign",
+		"-certs", *repack_command_sign_cert,
+		"-key", *repack_command_sign_key,
+		"-h", "sha256",
+	}
+	if *repack_command_sign_timestamp_url != "" {
+		argv = append(argv, "-ts", *repack_command_sign_timestamp_url)
+	}
+	argv = append(argv, "-in", path, "-out", signed_path)
+
+	cmd := exec.CommandContext(ctx, *repack_command_sign_tool, argv...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		os.Remove(signed_path)
+		return fmt.Errorf("Signing with %v: %w", *repack_command_sign_tool, err)
+	}
+
+	return os.Rename(signed_path, path)
 }
 
 func init() {
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/constants"
+	"www.velocidex.com/golang/velociraptor/crypto"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/crypto/recorder"
+	"www.velocidex.com/golang/velociraptor/executor"
+	"www.velocidex.com/golang/velociraptor/flows"
+	"www.velocidex.com/golang/velociraptor/json"
+	logging "www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/startup"
+)
+
+var (
+	replay_command = app.Command(
+		"replay", "Replay a comms recording (see comms_recording_path in the config).")
+	replay_command_recording = replay_command.Arg(
+		"recording", "The recording file.").Required().String()
+	replay_command_server = replay_command.Flag(
+		"server", "Replay the messages received by the server through the flow processing code. Otherwise replay the messages received by the client through a local executor.").Bool()
+	replay_command_timeout = replay_command.Flag(
+		"timeout", "Stop waiting for client responses after this many seconds without output.").
+		Default("10").Int64()
+)
+
+// Feed the requests received from the server into a local executor
+// and print the responses.
+func doReplayClient() error {
+	config_obj, err := makeDefaultConfigLoader().
+		WithRequiredClient().LoadAndValidate()
+	if err != nil {
+		return fmt.Errorf("Unable to load config file: %w", err)
+	}
+
+	ctx, cancel := install_sig_handler()
+	defer cancel()
+
+	sm, err := startup.StartClientServices(ctx, config_obj, on_error)
+	defer sm.Close()
+	if err != nil {
+		return err
+	}
+
+	exe, err := executor.NewClientExecutor(ctx, "C.replay", config_obj)
+	if err != nil {
+		return fmt.Errorf("Can not create executor: %w", err)
+	}
+
+	// Print responses as they arrive.
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+
+		timeout := time.Duration(*replay_command_timeout) * time.Second
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-time.After(timeout):
+				return
+
+			case msg, ok := <-exe.ReadResponse():
+				if !ok {
+					return
+				}
+				fmt.Println(json.MustMarshalString(msg))
+			}
+		}
+	}()
+
+	err = recorder.ReadRecording(ctx, *replay_command_recording,
+		func(record *recorder.Record) error {
+			if record.Direction != recorder.RECEIVED {
+				return nil
+			}
+
+			message_list, err := record.MessageList()
+			if err != nil {
+				return err
+			}
+
+			for _, msg := range message_list.Job {
+				exe.ProcessRequest(ctx, msg)
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	<-done
+	return nil
+}
+
+// Feed the messages received from clients through the server's flow
+// processing code.
+func doReplayServer() error {
+	config_obj, err := makeDefaultConfigLoader().
+		WithRequiredFrontend().LoadAndValidate()
+	if err != nil {
+		return fmt.Errorf("Unable to load config file: %w", err)
+	}
+
+	ctx, cancel := install_sig_handler()
+	defer cancel()
+
+	config_obj.Services = services.GenericToolServices()
+	config_obj.Services.ClientInfo = true
+	config_obj.Services.HuntDispatcher = true
+
+	sm, err := startup.StartToolServices(ctx, config_obj)
+	if err != nil {
+		return fmt.Errorf("Starting services: %w", err)
+	}
+	defer sm.Close()
+
+	logger := logging.GetLogger(config_obj, &logging.ToolComponent)
+
+	count := 0
+	err = recorder.ReadRecording(ctx, *replay_command_recording,
+		func(record *recorder.Record) error {
+			if record.Direction != recorder.RECEIVED {
+				return nil
+			}
+
+			message_list, err := record.MessageList()
+			if err != nil {
+				return err
+			}
+
+			serialized, err := proto.Marshal(message_list)
+			if err != nil {
+				return err
+			}
+
+			message_info := &crypto.MessageInfo{
+				Version:       constants.CLIENT_API_VERSION,
+				RawCompressed: [][]byte{serialized},
+				Authenticated: true,
+				Source:        record.Source,
+				Compression:   crypto_proto.PackedMessageList_UNCOMPRESSED,
+				OrgId:         config_obj.OrgId,
+			}
+
+			err = replayServerMessages(ctx, sm.Config, message_info)
+			if err != nil {
+				logger.Error("Replaying messages from %v: %v", record.Source, err)
+			}
+
+			count += len(message_list.Job)
+			return nil
+		})
+
+	logger.Info("Replayed %v messages from %v", count, *replay_command_recording)
+	return err
+}
+
+func replayServerMessages(ctx context.Context,
+	config_obj *config_proto.Config, message_info *crypto.MessageInfo) error {
+	runner := flows.NewFlowRunner(ctx, config_obj)
+	defer runner.Close(ctx)
+
+	return runner.ProcessMessages(ctx, message_info)
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case replay_command.FullCommand():
+			if *replay_command_server {
+				FatalIfError(replay_command, doReplayServer)
+			} else {
+				FatalIfError(replay_command, doReplayClient)
+			}
+
+		default:
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/Velocidex/yaml/v2"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/crypto"
+	"www.velocidex.com/golang/velociraptor/json"
+	logging "www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/startup"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
+)
+
+const (
+	SERVER_BACKUP_MANIFEST = "manifest.json"
+)
+
+var (
+	server_backup_command = app.Command(
+		"server_backup", "Snapshot or restore the server's datastore and file store.")
+
+	server_backup_create = server_backup_command.Command(
+		"create", "Create a snapshot. Stop the server first so the snapshot is consistent.")
+	server_backup_create_output = server_backup_create.Arg(
+		"output", "The zip file to write the snapshot to.").Required().String()
+	server_backup_create_skip_filestore = server_backup_create.Flag(
+		"skip_filestore", "Only snapshot the datastore (client records, flows etc) but not collected files and results.").Bool()
+	server_backup_create_s3_bucket = server_backup_create.Flag(
+		"s3_bucket", "Also upload the snapshot to this S3 bucket. Credentials are taken from the environment.").String()
+	server_backup_create_s3_region = server_backup_create.Flag(
+		"s3_region", "The region of the S3 bucket.").String()
+
+	server_backup_restore = server_backup_command.Command(
+		"restore", "Restore a snapshot onto this server. Stop the server first.")
+	server_backup_restore_input = server_backup_restore.Arg(
+		"input", "The snapshot zip file.").Required().String()
+	server_backup_restore_force = server_backup_restore.Flag(
+		"force", "Restore even if the datastore is not empty.").Bool()
+	server_backup_restore_reissue_certs = server_backup_restore.Flag(
+		"reissue_certs", "Reissue the frontend certificates (e.g. when restoring onto new hardware) and write the new config to this file.").String()
+)
+
+type serverBackupManifest struct {
+	Version   string `json:"version"`
+	Timestamp int64  `json:"timestamp"`
+	Hostname  string `json:"hostname"`
+	Filestore bool   `json:"filestore"`
+}
+
+func getServerBackupDirs(
+	config_obj *config_proto.Config) (datastore, filestore string, err error) {
+	if config_obj.Datastore == nil || config_obj.Datastore.Location == "" {
+		return "", "", fmt.Errorf("Datastore location not configured")
+	}
+
+	datastore = config_obj.Datastore.Location
+	filestore = config_obj.Datastore.FilestoreDirectory
+	if filestore == "" || filepath.Clean(filestore) == filepath.Clean(datastore) {
+		filestore = ""
+	}
+	return datastore, filestore, nil
+}
+
+func doServerBackupCreate() error {
+	config_obj, err := makeDefaultConfigLoader().
+		WithRequiredFrontend().LoadAndValidate()
+	if err != nil {
+		return fmt.Errorf("Unable to load config file: %w", err)
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.ToolComponent)
+
+	datastore, filestore, err := getServerBackupDirs(config_obj)
+	if err != nil {
+		return err
+	}
+
+	output, err := filepath.Abs(*server_backup_create_output)
+	if err != nil {
+		return err
+	}
+
+	fd, err := os.OpenFile(output, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	zip_writer := zip.NewWriter(fd)
+
+	hostname, _ := os.Hostname()
+	manifest := &serverBackupManifest{
+		Version:   config_obj.Version.Version,
+		Timestamp: utils.GetTime().Now().Unix(),
+		Hostname:  hostname,
+		Filestore: !*server_backup_create_skip_filestore,
+	}
+
+	w, err := zip_writer.Create(SERVER_BACKUP_MANIFEST)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(json.MustMarshalIndent(manifest))
+	if err != nil {
+		return err
+	}
+
+	// When the file store and datastore are in the same directory
+	// (the default) the datastore snapshot contains both.
+	only_datastore := *server_backup_create_skip_filestore && filestore == ""
+
+	count, err := addDirToBackup(
+		zip_writer, datastore, "datastore", only_datastore, output)
+	if err != nil {
+		return err
+	}
+	logger.Info("Added %v files from the datastore %v", count, datastore)
+
+	if filestore != "" && !*server_backup_create_skip_filestore {
+		count, err := addDirToBackup(
+			zip_writer, filestore, "filestore", false, output)
+		if err != nil {
+			return err
+		}
+		logger.Info("Added %v files from the filestore %v", count, filestore)
+	}
+
+	err = zip_writer.Close()
+	if err != nil {
+		return err
+	}
+
+	err = fd.Close()
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Wrote snapshot to %v", output)
+
+	if *server_backup_create_s3_bucket != "" {
+		return uploadServerBackupToS3(config_obj, output)
+	}
+
+	return nil
+}
+
+// Add all files under root into the zip under prefix. When
+// only_datastore is set, only datastore files (*.db) are added.
+func addDirToBackup(zip_writer *zip.Writer,
+	root, prefix string, only_datastore bool, output string) (int, error) {
+	count := 0
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || !info.Mode().IsRegular() {
+			return nil
+		}
+
+		// Do not include the snapshot itself.
+		if path == output {
+			return nil
+		}
+
+		if only_datastore && !strings.HasSuffix(path, ".db") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = prefix + "/" + filepath.ToSlash(rel)
+		header.Method = zip.Deflate
+
+		w, err := zip_writer.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		_, err = io.Copy(w, in)
+		if err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+
+	return count, err
+}
+
+func uploadServerBackupToS3(config_obj *config_proto.Config, filename string) error {
+	ctx, cancel := install_sig_handler()
+	defer cancel()
+
+	config_obj.Services = services.GenericToolServices()
+	sm, err := startup.StartToolServices(ctx, config_obj)
+	if err != nil {
+		return fmt.Errorf("Starting services: %w", err)
+	}
+	defer sm.Close()
+
+	logger := &LogWriter{config_obj: sm.Config}
+	builder := services.ScopeBuilder{
+		Config:     sm.Config,
+		ACLManager: acl_managers.NewRoleACLManager(sm.Config, "administrator"),
+		Logger:     log.New(logger, "", 0),
+		Env: ordereddict.NewDict().
+			Set("Filename", filename).
+			Set("Name", filepath.Base(filename)).
+			Set("Bucket", *server_backup_create_s3_bucket).
+			Set("Region", *server_backup_create_s3_region),
+	}
+
+	query := `
+       SELECT upload_s3(file=Filename, accessor="file", name=Name,
+                        bucket=Bucket, region=Region) AS Upload
+       FROM scope()`
+
+	err = runQueryWithEnv(query, builder, "json")
+	if err != nil {
+		return err
+	}
+
+	return logger.Error
+}
+
+func doServerBackupRestore() error {
+	config_obj, err := makeDefaultConfigLoader().
+		WithRequiredFrontend().LoadAndValidate()
+	if err != nil {
+		return fmt.Errorf("Unable to load config file: %w", err)
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.ToolComponent)
+
+	datastore, filestore, err := getServerBackupDirs(config_obj)
+	if err != nil {
+		return err
+	}
+
+	// Refuse to overwrite an existing deployment by accident.
+	if !*server_backup_restore_force {
+		entries, _ := os.ReadDir(datastore)
+		if len(entries) > 0 {
+			return fmt.Errorf(
+				"Datastore %v is not empty. Use --force to restore over it",
+				datastore)
+		}
+	}
+
+	zip_reader, err := zip.OpenReader(*server_backup_restore_input)
+	if err != nil {
+		return err
+	}
+	defer zip_reader.Close()
+
+	manifest := &serverBackupManifest{}
+	member, err := zip_reader.Open(SERVER_BACKUP_MANIFEST)
+	if err != nil {
+		return fmt.Errorf("Not a server snapshot: %w", err)
+	}
+	data, err := io.ReadAll(member)
+	member.Close()
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return fmt.Errorf("Not a server snapshot: %w", err)
+	}
+
+	logger.Info("Restoring snapshot of %v taken by version %v",
+		manifest.Hostname, manifest.Version)
+
+	if filestore == "" {
+		filestore = datastore
+	}
+
+	count := 0
+	for _, f := range zip_reader.File {
+		var root, rel string
+		switch {
+		case strings.HasPrefix(f.Name, "datastore/"):
+			root, rel = datastore, strings.TrimPrefix(f.Name, "datastore/")
+		case strings.HasPrefix(f.Name, "filestore/"):
+			root, rel = filestore, strings.TrimPrefix(f.Name, "filestore/")
+		default:
+			continue
+		}
+
+		err = restoreBackupMember(f, root, rel)
+		if err != nil {
+			return err
+		}
+		count++
+	}
+
+	logger.Info("Restored %v files", count)
+
+	if *server_backup_restore_reissue_certs != "" {
+		return reissueRestoredCerts(config_obj, *server_backup_restore_reissue_certs)
+	}
+
+	return nil
+}
+
+func restoreBackupMember(f *zip.File, root, rel string) error {
+	// Make sure the member can not escape the root directory.
+	dest := filepath.Join(root, filepath.FromSlash(rel))
+	if !strings.HasPrefix(dest, filepath.Clean(root)+string(os.PathSeparator)) {
+		return fmt.Errorf("Invalid path in snapshot: %v", f.Name)
+	}
+
+	err := os.MkdirAll(filepath.Dir(dest), 0700)
+	if err != nil {
+		return err
+	}
+
+	in, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// The restored server may have a different hostname so we reissue
+// the frontend certificates for the existing keys.
+func reissueRestoredCerts(config_obj *config_proto.Config, filename string) error {
+	frontend_cert, err := crypto.ReissueServerCert(
+		config_obj, config_obj.Frontend.Certificate,
+		config_obj.Frontend.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("Unable to create Frontend cert: %w", err)
+	}
+
+	config_obj.Frontend.Certificate = frontend_cert.Cert
+	config_obj.Frontend.PrivateKey = frontend_cert.PrivateKey
+
+	gw_certificate, err := crypto.ReissueServerCert(
+		config_obj, config_obj.GUI.GwCertificate,
+		config_obj.GUI.GwPrivateKey)
+	if err != nil {
+		return fmt.Errorf("Unable to create gateway cert: %w", err)
+	}
+
+	config_obj.GUI.GwCertificate = gw_certificate.Cert
+	config_obj.GUI.GwPrivateKey = gw_certificate.PrivateKey
+
+	res, err := yaml.Marshal(config_obj)
+	if err != nil {
+		return err
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.ToolComponent)
+	logger.Info("Writing config with reissued certificates to %v", filename)
+
+	return os.WriteFile(filename, res, 0600)
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case server_backup_create.FullCommand():
+			FatalIfError(server_backup_create, doServerBackupCreate)
+
+		case server_backup_restore.FullCommand():
+			FatalIfError(server_backup_restore, doServerBackupRestore)
+
+		default:
+			return false
+		}
+		return true
+	})
+}
@@ -142,6 +142,7 @@ func GetDefaultConfig() *config_proto.Config {
 			DefaultClientMonitoringArtifacts: []string{
 				// Essential for client resource telemetry.
 				"Generic.Client.Stats",
+				"Generic.Client.ResourceUsage",
 			},
 			DynDns: &config_proto.DynDNSConfig{},
 			Resources: &config_proto.FrontendResourceControl{
@@ -29,7 +29,10 @@ func ValidateClientConfig(config_obj *config_proto.Config) error {
 		return errors.New("No Client.nonce configured")
 	}
 
-	if config_obj.Client.ServerUrls == nil {
+	// Clients with scheduled artifacts may run as standalone
+	// sensors without a server.
+	if config_obj.Client.ServerUrls == nil &&
+		len(config_obj.Client.ScheduledArtifacts) == 0 {
 		return errors.New("No Client.server_urls configured")
 	}
 
@@ -64,6 +67,8 @@ func ValidateClientConfig(config_obj *config_proto.Config) error {
 		}
 	}
 
+	expandInstallerTemplates(config_obj.Client)
+
 	config_obj.Version = GetVersion()
 	config_obj.Client.Version = config_obj.Version
 
@@ -81,9 +86,46 @@ func ValidateClientConfig(config_obj *config_proto.Config) error {
 		}
 	}
 
+	for _, url := range config_obj.Client.InternalServerUrls {
+		if !strings.HasSuffix(url, "/") {
+			return errors.New(
+				"Configuration Client.internal_server_urls must end with /")
+		}
+	}
+
+	// Preferences are matched to the server urls exactly.
+	for _, pref := range config_obj.Client.ServerUrlPreferences {
+		if !strings.HasSuffix(pref.Url, "/") {
+			return fmt.Errorf(
+				"Configuration Client.server_url_preferences url %v must end with /",
+				pref.Url)
+		}
+	}
+
 	return nil
 }
 
+// Expand deployment templates (e.g. $DEPLOYMENT_NAME) in the
+// installer settings so deployments can avoid well known names on
+// disk. Environment variables are expanded when the paths are used.
+func expandInstallerTemplates(client *config_proto.ClientConfig) {
+	nonce := client.Nonce
+
+	if client.WindowsInstaller != nil {
+		w := client.WindowsInstaller
+		w.ServiceName = utils.ExpandDeploymentTemplate(w.ServiceName, nonce)
+		w.InstallPath = utils.ExpandDeploymentTemplate(w.InstallPath, nonce)
+		w.ServiceDescription = utils.ExpandDeploymentTemplate(
+			w.ServiceDescription, nonce)
+	}
+
+	if client.DarwinInstaller != nil {
+		d := client.DarwinInstaller
+		d.ServiceName = utils.ExpandDeploymentTemplate(d.ServiceName, nonce)
+		d.InstallPath = utils.ExpandDeploymentTemplate(d.InstallPath, nonce)
+	}
+}
+
 func ValidateAutoexecConfig(config_obj *config_proto.Config) error {
 	return nil
 }
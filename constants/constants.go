@@ -27,6 +27,9 @@ const (
 
 	ENROLLMENT_WELL_KNOWN_FLOW = "E:Enrol"
 	MONITORING_WELL_KNOWN_FLOW = FLOW_PREFIX + "Monitoring"
+	PAUSE_WELL_KNOWN_FLOW      = FLOW_PREFIX + "Pause"
+	RESUME_WELL_KNOWN_FLOW     = FLOW_PREFIX + "Resume"
+	FAST_POLL_WELL_KNOWN_FLOW  = FLOW_PREFIX + "FastPoll"
 
 	FLOW_PREFIX             = "F."
 	FOREMAN_WELL_KNOWN_FLOW = "E.Foreman"
@@ -49,6 +52,19 @@ const (
 
 	USER_AGENT = "Velociraptor"
 
+	// When the reader uses a GET request the encrypted message is
+	// carried in this header instead of the request body.
+	VELOCIRAPTOR_MESSAGE_HEADER = "X-Velociraptor-Message"
+
+	// The client advertises the API versions it supports in this
+	// header and the server replies with the version it selected.
+	CLIENT_API_VERSION_HEADER = "X-Velociraptor-Api-Version"
+
+	// The client describes itself (version, OS and architecture) in
+	// this header so the frontend can classify requests before
+	// decrypting them.
+	CLIENT_INFO_HEADER = "X-Velociraptor-Client"
+
 	// Globals set in VQL scopes.
 	SCOPE_CONFIG            = "config"
 	SCOPE_SERVER_CONFIG     = "server_config"
@@ -0,0 +1,188 @@
+/*
+  Machine attestation at enrolment.
+
+  A client's identity is its key pair - anyone holding a copy of the
+  private key can enrol as that client. To make such spoofed
+  enrolments detectable the client embeds an attestation report
+  describing the machine it runs on in its CSR:
+
+  - The SMBIOS system UUID.
+  - The TPM version if a TPM is present. A TPM quote requires a TPM
+    software stack which the client does not ship, so only the TPM's
+    presence is reported.
+  - The SID of the Active Directory domain the machine is joined to
+    (Windows only).
+
+  The report is an extension of the CSR so it is covered by the CSR's
+  signature and bound to the client's key. The server verifies the
+  signature, stores the report and raises an alert when a client
+  re-enrols with a report which does not match the one it enrolled
+  with before.
+*/
+
+package attestation
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+var (
+	// The CSR extension holding the attestation report.
+	OID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+
+	mu     sync.Mutex
+	cached *Attestation
+)
+
+type Attestation struct {
+	SmbiosUuid string `json:"SmbiosUuid,omitempty"`
+	TpmVersion string `json:"TpmVersion,omitempty"`
+	DomainSid  string `json:"DomainSid,omitempty"`
+}
+
+// Collect the attestation report for this machine. The report does
+// not change while the client runs so it is only collected once.
+func Collect(ctx context.Context) *Attestation {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if cached == nil {
+		cached = collect(ctx)
+	}
+	return cached
+}
+
+// Returns the CSR extension carrying the attestation report.
+func Extension(attestation *Attestation) (pkix.Extension, error) {
+	serialized, err := json.Marshal(attestation)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	value, err := asn1.Marshal(serialized)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	return pkix.Extension{Id: OID, Value: value}, nil
+}
+
+// Extract the attestation report from a CSR. Returns nil if the CSR
+// has no report (e.g. it was made by an older client).
+func FromCSR(csr *x509.CertificateRequest) (*Attestation, error) {
+	for _, ext := range csr.Extensions {
+		if !ext.Id.Equal(OID) {
+			continue
+		}
+
+		var serialized []byte
+		_, err := asn1.Unmarshal(ext.Value, &serialized)
+		if err != nil {
+			return nil, err
+		}
+
+		result := &Attestation{}
+		err = json.Unmarshal(serialized, result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	return nil, nil
+}
+
+// Describe how the new report differs from the one the client
+// enrolled with before. Fields which were not reported before are
+// ignored so clients may start reporting them after an upgrade, but
+// a field which is no longer reported is a change.
+func Compare(old, current *Attestation) []string {
+	var result []string
+	if old == nil {
+		return nil
+	}
+
+	if current == nil {
+		return []string{"Attestation report is missing"}
+	}
+
+	check := func(name, old_value, current_value string) {
+		if old_value != "" && old_value != current_value {
+			result = append(result, fmt.Sprintf("%v changed from %q to %q",
+				name, old_value, current_value))
+		}
+	}
+
+	check("SmbiosUuid", old.SmbiosUuid, current.SmbiosUuid)
+	check("TpmVersion", old.TpmVersion, current.TpmVersion)
+	check("DomainSid", old.DomainSid, current.DomainSid)
+
+	return result
+}
+
+// Find the UUID of the System Information structure (type 1) in a
+// raw SMBIOS structure table.
+func parseSMBIOSUUID(table []byte) string {
+	for len(table) >= 4 {
+		struct_type := table[0]
+		length := int(table[1])
+		if length < 4 || length > len(table) {
+			return ""
+		}
+
+		// Type 127 is the end of the table.
+		if struct_type == 127 {
+			return ""
+		}
+
+		if struct_type == 1 && length >= 0x19 {
+			return formatSMBIOSUUID(table[8:24])
+		}
+
+		// Skip the formatted area and the strings that follow it,
+		// which end with a double null.
+		end := length
+		for end+1 < len(table) && (table[end] != 0 || table[end+1] != 0) {
+			end++
+		}
+
+		if end+2 > len(table) {
+			return ""
+		}
+		table = table[end+2:]
+	}
+
+	return ""
+}
+
+// Since SMBIOS 2.6 the first three fields of the UUID are little
+// endian. The UUID is formatted in lower case like Linux does. All
+// zeros or all ones mean the UUID is not set.
+func formatSMBIOSUUID(uuid []byte) string {
+	all_zero, all_ones := true, true
+	for _, b := range uuid {
+		if b != 0 {
+			all_zero = false
+		}
+		if b != 0xff {
+			all_ones = false
+		}
+	}
+
+	if all_zero || all_ones {
+		return ""
+	}
+
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(uuid[0:4]),
+		binary.LittleEndian.Uint16(uuid[4:6]),
+		binary.LittleEndian.Uint16(uuid[6:8]),
+		uuid[8:10], uuid[10:16])
+}
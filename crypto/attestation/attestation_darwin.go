@@ -0,0 +1,34 @@
+//go:build darwin
+// +build darwin
+
+package attestation
+
+import (
+	"context"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var (
+	platformUUIDRegex = regexp.MustCompile(`"IOPlatformUUID" = "([^"]+)"`)
+)
+
+// Macs have no TPM and are not joined to Windows domains so only the
+// platform UUID (which is the SMBIOS UUID) is reported.
+func collect(ctx context.Context) *Attestation {
+	result := &Attestation{}
+
+	output, err := exec.CommandContext(ctx,
+		"/usr/sbin/ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+	if err != nil {
+		return result
+	}
+
+	match := platformUUIDRegex.FindSubmatch(output)
+	if len(match) > 1 {
+		result.SmbiosUuid = strings.ToLower(string(match[1]))
+	}
+
+	return result
+}
@@ -0,0 +1,33 @@
+//go:build linux
+// +build linux
+
+package attestation
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+func collect(ctx context.Context) *Attestation {
+	result := &Attestation{}
+
+	// Only readable by root, which the client normally runs as.
+	uuid, err := os.ReadFile("/sys/class/dmi/id/product_uuid")
+	if err == nil {
+		result.SmbiosUuid = strings.ToLower(strings.TrimSpace(string(uuid)))
+	}
+
+	_, err = os.Stat("/sys/class/tpm/tpm0")
+	if err == nil {
+		result.TpmVersion = "present"
+
+		// Only reported by recent kernels.
+		version, err := os.ReadFile("/sys/class/tpm/tpm0/tpm_version_major")
+		if err == nil {
+			result.TpmVersion = strings.TrimSpace(string(version))
+		}
+	}
+
+	return result
+}
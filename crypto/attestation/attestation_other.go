@@ -0,0 +1,10 @@
+//go:build !linux && !windows && !darwin
+// +build !linux,!windows,!darwin
+
+package attestation
+
+import "context"
+
+func collect(ctx context.Context) *Attestation {
+	return &Attestation{}
+}
@@ -0,0 +1,101 @@
+package attestation
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttestationInCSR(t *testing.T) {
+	private_key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	report := &Attestation{
+		SmbiosUuid: "4c4c4544-0042-3510-8051-b4c04f4d4e32",
+		TpmVersion: "2",
+	}
+
+	ext, err := Extension(report)
+	assert.NoError(t, err)
+
+	der, err := x509.CreateCertificateRequest(rand.Reader,
+		&x509.CertificateRequest{
+			Subject:         pkix.Name{CommonName: "C.123"},
+			ExtraExtensions: []pkix.Extension{ext},
+		}, private_key)
+	assert.NoError(t, err)
+
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.NoError(t, err)
+	assert.NoError(t, csr.CheckSignature())
+
+	extracted, err := FromCSR(csr)
+	assert.NoError(t, err)
+	assert.Equal(t, report, extracted)
+
+	// CSRs from older clients have no report.
+	der, err = x509.CreateCertificateRequest(rand.Reader,
+		&x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "C.123"},
+		}, private_key)
+	assert.NoError(t, err)
+
+	csr, err = x509.ParseCertificateRequest(der)
+	assert.NoError(t, err)
+
+	extracted, err = FromCSR(csr)
+	assert.NoError(t, err)
+	assert.Nil(t, extracted)
+}
+
+func TestCompare(t *testing.T) {
+	old := &Attestation{SmbiosUuid: "a", DomainSid: "S-1-5-21-1-2-3"}
+
+	// Nothing to compare against on first enrolment.
+	assert.Empty(t, Compare(nil, old))
+
+	// Newly reported fields are not changes.
+	assert.Empty(t, Compare(old, &Attestation{
+		SmbiosUuid: "a", DomainSid: "S-1-5-21-1-2-3", TpmVersion: "2"}))
+
+	assert.Equal(t, []string{`SmbiosUuid changed from "a" to "b"`,
+		`DomainSid changed from "S-1-5-21-1-2-3" to ""`},
+		Compare(old, &Attestation{SmbiosUuid: "b"}))
+
+	assert.Equal(t, []string{"Attestation report is missing"},
+		Compare(old, nil))
+}
+
+func TestParseSMBIOSUUID(t *testing.T) {
+	table := []byte{
+		// Type 0 (BIOS Information) with one string.
+		0, 4, 0, 0, 'B', 'I', 'O', 'S', 0, 0,
+
+		// Type 1 (System Information) with no strings.
+		1, 0x1b, 1, 0, 1, 2, 3, 4,
+		0x44, 0x45, 0x4c, 0x4c, 0x42, 0x00, 0x10, 0x35,
+		0x80, 0x51, 0xb4, 0xc0, 0x4f, 0x4d, 0x4e, 0x32,
+		6, 0, 0, 0, 0,
+
+		// End of table.
+		127, 4, 2, 0, 0, 0,
+	}
+
+	assert.Equal(t, "4c4c4544-0042-3510-8051-b4c04f4d4e32",
+		parseSMBIOSUUID(table))
+
+	// Truncated tables do not crash.
+	for i := range table {
+		parseSMBIOSUUID(table[:i])
+	}
+
+	// An unset UUID is not reported.
+	unset := []byte{1, 0x19, 1, 0, 1, 2, 3, 4}
+	unset = append(unset, make([]byte, 17)...)
+	unset = append(unset, 0, 0)
+	assert.Equal(t, "", parseSMBIOSUUID(unset))
+}
@@ -0,0 +1,113 @@
+//go:build windows
+// +build windows
+
+package attestation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32                   = windows.NewLazySystemDLL("kernel32.dll")
+	procGetSystemFirmwareTable = kernel32.NewProc("GetSystemFirmwareTable")
+
+	tbs                   = windows.NewLazySystemDLL("tbs.dll")
+	procTbsiGetDeviceInfo = tbs.NewProc("Tbsi_GetDeviceInfo")
+)
+
+const (
+	// The 'RSMB' firmware table provider.
+	RSMB = 0x52534D42
+
+	// The RawSMBIOSData header before the structure table.
+	RAW_SMBIOS_HEADER_SIZE = 8
+)
+
+type tpmDeviceInfo struct {
+	StructVersion    uint32
+	TpmVersion       uint32
+	TpmInterfaceType uint32
+	TpmImpRevision   uint32
+}
+
+func collect(ctx context.Context) *Attestation {
+	return &Attestation{
+		SmbiosUuid: getSMBIOSUUID(),
+		TpmVersion: getTPMVersion(),
+		DomainSid:  getDomainSid(),
+	}
+}
+
+func getSMBIOSUUID() string {
+	err := procGetSystemFirmwareTable.Find()
+	if err != nil {
+		return ""
+	}
+
+	size, _, _ := procGetSystemFirmwareTable.Call(RSMB, 0, 0, 0)
+	if size <= RAW_SMBIOS_HEADER_SIZE {
+		return ""
+	}
+
+	buffer := make([]byte, size)
+	read, _, _ := procGetSystemFirmwareTable.Call(RSMB, 0,
+		uintptr(unsafe.Pointer(&buffer[0])), size)
+	if read != size {
+		return ""
+	}
+
+	return parseSMBIOSUUID(buffer[RAW_SMBIOS_HEADER_SIZE:])
+}
+
+func getTPMVersion() string {
+	err := procTbsiGetDeviceInfo.Find()
+	if err != nil {
+		return ""
+	}
+
+	info := &tpmDeviceInfo{StructVersion: 1}
+	res, _, _ := procTbsiGetDeviceInfo.Call(
+		unsafe.Sizeof(*info), uintptr(unsafe.Pointer(info)))
+
+	// Returns TBS_SUCCESS (0) only when a TPM is present.
+	if res != 0 {
+		return ""
+	}
+
+	switch info.TpmVersion {
+	case 1:
+		return "1.2"
+	case 2:
+		return "2"
+	default:
+		return fmt.Sprintf("%d", info.TpmVersion)
+	}
+}
+
+// The domain SID is the SID of the machine's domain account without
+// its last (relative) component. Machines which are not joined to a
+// domain have no such account.
+func getDomainSid() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+
+	sid, domain, _, err := windows.LookupSID("", hostname+"$")
+	if err != nil || strings.EqualFold(domain, hostname) {
+		return ""
+	}
+
+	sid_str := sid.String()
+	idx := strings.LastIndex(sid_str, "-")
+	if idx < 0 {
+		return ""
+	}
+	return sid_str[:idx]
+}
@@ -35,6 +35,11 @@ var (
 		Name: "rsa_verify_op",
 		Help: "Total number of rsa verify ops.",
 	})
+
+	VerificationFailureCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "crypto_verification_failures",
+		Help: "Total number of messages whose signature or HMAC did not verify.",
+	})
 )
 
 type _Cipher struct {
@@ -7,6 +7,8 @@ import (
 	"github.com/Velocidex/ttlcache/v2"
 	"github.com/go-errors/errors"
 	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	vcrypto "www.velocidex.com/golang/velociraptor/crypto"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
 	crypto_utils "www.velocidex.com/golang/velociraptor/crypto/utils"
 	"www.velocidex.com/golang/velociraptor/logging"
 	"www.velocidex.com/golang/velociraptor/utils"
@@ -16,6 +18,12 @@ type ClientCryptoManager struct {
 	CryptoManager
 }
 
+// Decrypt a task the server sealed with our public key.
+func (self *ClientCryptoManager) Unseal(
+	sealed *crypto_proto.SealedMessage) (*crypto_proto.VeloMessage, error) {
+	return crypto_utils.UnsealMessage(self.private_key, sealed)
+}
+
 // Adds the server certificate to the crypto manager.
 func (self *ClientCryptoManager) AddCertificate(
 	config_obj *config_proto.Config,
@@ -40,6 +48,14 @@ func (self *ClientCryptoManager) AddCertificate(
 		return "", err
 	}
 
+	// If the server key is pinned, the CA signature alone is not
+	// enough.
+	err = crypto_utils.VerifyPublicKeyPins(
+		server_cert, config_obj.Client.ServerKeyPins)
+	if err != nil {
+		return "", err
+	}
+
 	server_name := crypto_utils.GetSubjectName(server_cert)
 	err = self.Resolver.SetPublicKey(
 		config_obj, server_name, server_cert.PublicKey.(*rsa.PublicKey))
@@ -85,5 +101,29 @@ func NewClientCryptoManager(config_obj *config_proto.Config, client_private_key_
 		unauthenticated_lru: ttlcache.NewCache(),
 		caPool:              roots,
 		logger:              logger,
+		OnVerificationFailure: func(config_obj *config_proto.Config,
+			source string, err error) {
+			logger.Error("Message from %v failed verification: %v",
+				source, err)
+		},
 	}}, nil
 }
+
+// The server always signs its messages so the client never accepts
+// unauthenticated messages. Since the payload is authenticated
+// independently of the transport, a TLS terminating proxy is unable
+// to inject or modify messages.
+func (self *ClientCryptoManager) Decrypt(
+	cipher_text []byte) (*vcrypto.MessageInfo, error) {
+	msg_info, err := self.CryptoManager.Decrypt(cipher_text)
+	if err != nil {
+		return nil, err
+	}
+
+	// Empty messages carry nothing to process.
+	if len(msg_info.RawCompressed) > 0 && !msg_info.Authenticated {
+		return nil, UnauthenticatedError
+	}
+
+	return msg_info, nil
+}
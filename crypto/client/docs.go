@@ -4,4 +4,29 @@ package client
 
   This package contains the CryptoManager for the client.
 
+  Message integrity
+
+  Messages are protected independently of the transport (TLS) so
+  they remain confidential and authentic when the connection passes
+  through a TLS terminating proxy:
+
+  1. The sender generates a session cipher (AES key and HMAC key)
+     and signs it with its own RSA key. The cipher is encrypted to
+     the receiver's public key.
+
+  2. Every payload is encrypted with the session key and covered by
+     an HMAC using the session HMAC key.
+
+  3. The receiver verifies the HMAC and the signature over the
+     session cipher using the sender's known public key. Sessions
+     which verify are cached so subsequent payloads only need the
+     HMAC check.
+
+  The server must accept unauthenticated messages from unknown
+  clients during enrolment, but the client never accepts
+  unauthenticated messages from the server (see
+  ClientCryptoManager.Decrypt). Messages from known senders which
+  fail verification are reported through OnVerificationFailure - the
+  server raises an alert in Server.Internal.Alerts.
+
 */
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
@@ -21,6 +22,7 @@ import (
 	"google.golang.org/protobuf/proto"
 	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
 	vcrypto "www.velocidex.com/golang/velociraptor/crypto"
+	"www.velocidex.com/golang/velociraptor/crypto/attestation"
 	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
 	crypto_utils "www.velocidex.com/golang/velociraptor/crypto/utils"
 	"www.velocidex.com/golang/velociraptor/logging"
@@ -28,6 +30,13 @@ import (
 	"www.velocidex.com/golang/velociraptor/utils"
 )
 
+var (
+	hmacError = errors.New("HMAC did not verify")
+
+	// Returned when a message could not be attributed to its sender.
+	UnauthenticatedError = errors.New("Message is not authenticated")
+)
+
 type CryptoManager struct {
 	config      *config_proto.Config
 	private_key *rsa.PrivateKey
@@ -49,6 +58,20 @@ type CryptoManager struct {
 	caPool *x509.CertPool
 
 	logger *logging.LogContext
+
+	// Called when a message from a known sender fails verification
+	// (i.e. it was not signed by the sender's key or was modified in
+	// transit).
+	OnVerificationFailure func(config_obj *config_proto.Config,
+		source string, err error)
+}
+
+func (self *CryptoManager) verificationFailed(
+	config_obj *config_proto.Config, source string, err error) {
+	VerificationFailureCounter.Inc()
+	if self.OnVerificationFailure != nil {
+		self.OnVerificationFailure(config_obj, source, err)
+	}
 }
 
 // Clear all internal caches.
@@ -78,6 +101,14 @@ func (self *CryptoManager) GetCSR() ([]byte, error) {
 		SignatureAlgorithm: x509.SHA256WithRSA,
 	}
 
+	// Describe the machine we run on so the server can detect
+	// another machine enrolling with our key.
+	ext, err := attestation.Extension(
+		attestation.Collect(context.Background()))
+	if err == nil {
+		template.ExtraExtensions = append(template.ExtraExtensions, ext)
+	}
+
 	csrBytes, _ := x509.CreateCertificateRequest(
 		rand.Reader, &template, self.private_key)
 	return pem.EncodeToMemory(&pem.Block{
@@ -225,6 +256,7 @@ func (self *CryptoManager) getAuthState(
 	err := rsa.VerifyPKCS1v15(public_key, crypto.SHA256, hashed[:],
 		cipher_metadata.Signature)
 	if err != nil {
+		self.verificationFailed(config_obj, cipher_metadata.Source, err)
 		return false, errors.Wrap(err, 0)
 	}
 
@@ -270,7 +302,13 @@ func (self *CryptoManager) Decrypt(cipher_text []byte) (*vcrypto.MessageInfo, er
 		if !hmac.Equal(
 			CalcHMAC(communications, cipher.cipher_properties),
 			communications.FullHmac) {
-			return nil, errors.New("HMAC did not verify")
+			// The session was authenticated so the payload was
+			// modified in transit.
+			if cipher.authenticated {
+				self.verificationFailed(self.config,
+					cipher.cipher_metadata.Source, hmacError)
+			}
+			return nil, hmacError
 		}
 
 		msg_info, _, err := self.extractMessageInfo(
@@ -308,7 +346,7 @@ func (self *CryptoManager) Decrypt(cipher_text []byte) (*vcrypto.MessageInfo, er
 	if !hmac.Equal(
 		CalcHMAC(communications, cipher_properties),
 		communications.FullHmac) {
-		return nil, errors.New("HMAC did not verify")
+		return nil, hmacError
 	}
 
 	// Extract the serialized CipherMetadata.
@@ -193,9 +193,18 @@ func (self *TestSuite) _EncryptMessageListWithSpoofedPackedMessage(
 		return nil, errors.Wrap(err, 0)
 	}
 
-	compressed_message_lists := [][]byte{plain_text}
-	output_cipher, err := client.NewCipher(self.client_id,
+	return self._EncryptMessageListWithKeys(plain_text, self.client_id,
 		self.client_private_key, &self.server_private_key.PublicKey)
+}
+
+// Encrypt a message list from source, signed with signing_key and
+// encrypted to destination_key.
+func (self *TestSuite) _EncryptMessageListWithKeys(
+	plain_text []byte, source string,
+	signing_key *rsa.PrivateKey, destination_key *rsa.PublicKey) ([]byte, error) {
+
+	compressed_message_lists := [][]byte{plain_text}
+	output_cipher, err := client.NewCipher(source, signing_key, destination_key)
 	if err != nil {
 		return nil, err
 	}
@@ -311,6 +320,49 @@ func (self *TestSuite) TestEncryption() {
 	assert.Equal(t, c-initial_c, float64(1))
 }
 
+// Messages must be signed by the sender's key - even if an attacker
+// (e.g. a TLS terminating proxy) can encrypt to the receiver's public
+// key.
+func (self *TestSuite) TestForgedMessages() {
+	t := self.T()
+
+	attacker_key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	plain_text, err := proto.Marshal(&crypto_proto.MessageList{
+		Job: []*crypto_proto.VeloMessage{{Name: "Forged"}},
+	})
+	assert.NoError(t, err)
+
+	var failures []string
+	on_failure := func(config_obj *config_proto.Config, source string, err error) {
+		failures = append(failures, source)
+	}
+	self.client_manager.OnVerificationFailure = on_failure
+	self.server_manager.OnVerificationFailure = on_failure
+
+	// The client rejects forged server messages.
+	server_name := utils.GetSuperuserName(self.ConfigObj)
+	cipher_text, err := self._EncryptMessageListWithKeys(plain_text,
+		server_name, attacker_key, &self.client_private_key.PublicKey)
+	assert.NoError(t, err)
+
+	_, err = self.client_manager.Decrypt(cipher_text)
+	assert.Equal(t, crypto_client.UnauthenticatedError, err)
+
+	// The server treats forged client messages as unauthenticated
+	// and reports them.
+	cipher_text, err = self._EncryptMessageListWithKeys(plain_text,
+		self.client_id, attacker_key, &self.server_private_key.PublicKey)
+	assert.NoError(t, err)
+
+	message_info, err := self.server_manager.Decrypt(cipher_text)
+	assert.NoError(t, err)
+	assert.False(t, message_info.Authenticated)
+
+	assert.Equal(t, []string{server_name, self.client_id}, failures)
+}
+
 func (self *TestSuite) TestClientIDFromPublicKey() {
 	t := self.T()
 
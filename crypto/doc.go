@@ -48,5 +48,26 @@
    the cipher object. Note we check the hmac before anything else to
    reject malformed packets earlier and save some cycles.
 
+## Compatibility with GRR
+
+The transport messages (ClientCommunication, CipherProperties,
+CipherMetadata, PackedMessageList and MessageList) keep GRR's field
+numbers, and so do the envelope fields of VeloMessage which GRR's
+GrrMessage also has (session_id, request_id, response_id, source,
+auth_state, type and task_id). The envelope of a packet from one
+system therefore decodes with the other.
+
+There is no compatibility mode beyond that. A GRR server tasks its
+clients by naming a client action and passing serialized RDFValue
+arguments in the name, args and args_rdf_name fields, while
+Velociraptor clients only run VQL. VeloMessage still carries those
+fields from the old protocol, but nothing acts on them, so the
+executor ignores GRR requests. Likewise a GRR client does not
+understand VQL requests, and the results it returns are GRR
+RDFValues which the Velociraptor server can not store. Translating
+between the two would mean re-implementing GRR's client actions and
+flows. When migrating, run both agents side by side until the
+Velociraptor deployment covers the GRR flows in use.
+
 */
 package crypto
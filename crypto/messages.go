@@ -24,6 +24,10 @@ type MessageInfo struct {
 	RemoteAddr    string
 	Compression   crypto_proto.PackedMessageList_CompressionType
 	OrgId         string
+
+	// The version the client advertised in its request header
+	// (empty for older clients).
+	ClientVersion string
 }
 
 // Apply the callback on each job message. This saves memory since we
@@ -0,0 +1,62 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// Encode a message as a GRR server would send it to its client. The
+// field numbers follow GRR's GrrMessage.
+func grrMessage() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, "aff4:/C.1234/flows/F.1234")
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, 5)
+	b = protowire.AppendTag(b, 3, protowire.VarintType)
+	b = protowire.AppendVarint(b, 1)
+
+	// Client action name, arguments and their RDF type.
+	b = protowire.AppendTag(b, 4, protowire.BytesType)
+	b = protowire.AppendString(b, "ListDirectory")
+	b = protowire.AppendTag(b, 5, protowire.BytesType)
+	b = protowire.AppendBytes(b, []byte{0x0a, 0x00})
+	b = protowire.AppendTag(b, 6, protowire.BytesType)
+	b = protowire.AppendString(b, "aff4:/GRR")
+	b = protowire.AppendTag(b, 7, protowire.VarintType)
+	b = protowire.AppendVarint(b, 1)
+	b = protowire.AppendTag(b, 14, protowire.BytesType)
+	b = protowire.AppendString(b, "ListDirRequest")
+	b = protowire.AppendTag(b, 15, protowire.VarintType)
+	b = protowire.AppendVarint(b, 42)
+	return b
+}
+
+func TestGRREnvelopeCompatibility(t *testing.T) {
+	message_list := &MessageList{}
+	serialized := protowire.AppendTag(nil, 1, protowire.BytesType)
+	serialized = protowire.AppendBytes(serialized, grrMessage())
+
+	err := proto.Unmarshal(serialized, message_list)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(message_list.Job))
+
+	// The shared envelope decodes.
+	message := message_list.Job[0]
+	assert.Equal(t, "aff4:/C.1234/flows/F.1234", message.SessionId)
+	assert.Equal(t, uint64(5), message.RequestId)
+	assert.Equal(t, uint64(1), message.ResponseId)
+	assert.Equal(t, "aff4:/GRR", message.Source)
+	assert.Equal(t, VeloMessage_AUTHENTICATED, message.AuthState)
+	assert.Equal(t, uint64(42), message.TaskId)
+
+	// The GRR client action lands in the deprecated fields which
+	// nothing acts on, so nothing would run on the client.
+	assert.Equal(t, "ListDirectory", message.Name)
+	assert.Equal(t, "ListDirRequest", message.ArgsRdfName)
+	assert.Nil(t, message.VQLClientAction)
+	assert.Nil(t, message.FlowRequest)
+}
@@ -0,0 +1,146 @@
+/*
+  Records the decrypted messages exchanged between clients and the
+  server so field problems can be reproduced.
+
+  Each line in the recording is a JSON object holding one
+  MessageList: Either received from the other side of the
+  connection or sent to it.
+*/
+
+package recorder
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+const (
+	RECEIVED = "received"
+	SENT     = "sent"
+)
+
+type Record struct {
+	// Unix time in microseconds.
+	Timestamp int64  `json:"timestamp"`
+	Direction string `json:"direction"`
+
+	// The client id on the server side.
+	Source string `json:"source,omitempty"`
+
+	Messages json.RawMessage `json:"messages"`
+}
+
+func (self *Record) MessageList() (*crypto_proto.MessageList, error) {
+	result := &crypto_proto.MessageList{}
+	err := protojson.Unmarshal(self.Messages, result)
+	return result, err
+}
+
+type Recorder struct {
+	mu sync.Mutex
+	fd *os.File
+}
+
+func (self *Recorder) Record(
+	direction, source string, message_list *crypto_proto.MessageList) {
+	if self == nil || len(message_list.Job) == 0 {
+		return
+	}
+
+	serialized, err := protojson.Marshal(message_list)
+	if err != nil {
+		return
+	}
+
+	line, err := json.Marshal(&Record{
+		Timestamp: utils.GetTime().Now().UnixNano() / 1000,
+		Direction: direction,
+		Source:    source,
+		Messages:  serialized,
+	})
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	_, _ = self.fd.Write(line)
+}
+
+var (
+	mu        sync.Mutex
+	recorders = make(map[string]*Recorder)
+)
+
+// Get a recorder writing to filename. All callers recording to the
+// same file share the recorder. Returns nil if filename is empty -
+// recording into a nil recorder does nothing.
+func GetRecorder(filename string) *Recorder {
+	if filename == "" {
+		return nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	recorder, pres := recorders[filename]
+	if pres {
+		return recorder
+	}
+
+	fd, err := os.OpenFile(filename,
+		os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil
+	}
+
+	recorder = &Recorder{fd: fd}
+	recorders[filename] = recorder
+	return recorder
+}
+
+// Read all the records in the recording.
+func ReadRecording(ctx context.Context,
+	filename string, cb func(record *Record) error) error {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	reader := bufio.NewReader(fd)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 1 {
+			record := &Record{}
+			err := json.Unmarshal(line, record)
+			if err != nil {
+				return err
+			}
+
+			err = cb(record)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package recorder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	dir, err := os.MkdirTemp("", "recorder")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "recording.jsonl")
+	recorder := GetRecorder(filename)
+	assert.True(t, recorder == GetRecorder(filename))
+
+	recorder.Record(RECEIVED, "C.123", &crypto_proto.MessageList{
+		Job: []*crypto_proto.VeloMessage{{SessionId: "F.1", RequestId: 1}}})
+
+	// Empty message lists are not recorded.
+	recorder.Record(SENT, "C.123", &crypto_proto.MessageList{})
+
+	recorder.Record(SENT, "C.123", &crypto_proto.MessageList{
+		Job: []*crypto_proto.VeloMessage{{SessionId: "F.1", RequestId: 2}}})
+
+	// Recording to a nil recorder is a no-op.
+	GetRecorder("").Record(SENT, "", &crypto_proto.MessageList{})
+
+	var records []*Record
+	var ids []uint64
+	err = ReadRecording(context.Background(), filename,
+		func(record *Record) error {
+			records = append(records, record)
+			message_list, err := record.MessageList()
+			assert.NoError(t, err)
+			for _, msg := range message_list.Job {
+				ids = append(ids, msg.RequestId)
+			}
+			return nil
+		})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, RECEIVED, records[0].Direction)
+	assert.Equal(t, SENT, records[1].Direction)
+	assert.Equal(t, "C.123", records[0].Source)
+	assert.Equal(t, []uint64{1, 2}, ids)
+}
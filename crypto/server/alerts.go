@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+// Only raise one alert per client in this time.
+const verificationAlertInterval = 10 * time.Minute
+
+// Messages from enrolled clients are signed by the client's key. A
+// message which fails verification was either forged or modified in
+// transit (e.g. by a TLS terminating proxy) so we raise an alert.
+type verificationAlerter struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func (self *verificationAlerter) shouldAlert(client_id string) bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	now := utils.GetTime().Now()
+	last, pres := self.last[client_id]
+	if pres && now.Sub(last) < verificationAlertInterval {
+		return false
+	}
+
+	// Expire old entries so the map does not grow without bounds.
+	for k, v := range self.last {
+		if now.Sub(v) >= verificationAlertInterval {
+			delete(self.last, k)
+		}
+	}
+
+	self.last[client_id] = now
+	return true
+}
+
+func (self *verificationAlerter) Alert(
+	ctx context.Context, config_obj *config_proto.Config,
+	source string, verify_err error) {
+	client_id := utils.ClientIdFromSource(source)
+
+	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+	logger.Error("Message from %v failed verification: %v", source, verify_err)
+
+	if !self.shouldAlert(client_id) {
+		return
+	}
+
+	alert := &services.AlertMessage{
+		ClientId:  client_id,
+		AlertName: "Message verification failed",
+		Timestamp: utils.GetTime().Now(),
+		EventData: ordereddict.NewDict().
+			Set("Source", source).
+			Set("Error", verify_err.Error()),
+	}
+
+	serialized, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+	serialized = append(serialized, '\n')
+
+	journal, err := services.GetJournal(config_obj)
+	if err != nil {
+		return
+	}
+
+	err = journal.PushJsonlToArtifact(ctx, config_obj,
+		serialized, 1, "Server.Internal.Alerts", "server", "")
+	if err != nil {
+		logger.Error("Unable to raise verification alert: %v", err)
+	}
+}
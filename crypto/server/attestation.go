@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Velocidex/ordereddict"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/crypto/attestation"
+	crypto_utils "www.velocidex.com/golang/velociraptor/crypto/utils"
+	"www.velocidex.com/golang/velociraptor/datastore"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+// The attestation report a client enrolled with.
+type AttestationRecord struct {
+	ClientId    string                   `json:"ClientId"`
+	Attestation *attestation.Attestation `json:"Attestation"`
+	Enrolled    int64                    `json:"Enrolled"`
+
+	// How the report differed from the report the client enrolled
+	// with before.
+	Changes  []string                 `json:"Changes,omitempty"`
+	Previous *attestation.Attestation `json:"Previous,omitempty"`
+}
+
+type attestationIndexRecord struct {
+	ClientId string `json:"ClientId"`
+}
+
+func getRawDB(config_obj *config_proto.Config) (datastore.RawDataStore, error) {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	raw_db, ok := db.(datastore.RawDataStore)
+	if !ok {
+		return nil, errors.New("Datastore has no raw access.")
+	}
+	return raw_db, nil
+}
+
+func GetAttestation(config_obj *config_proto.Config,
+	client_id string) (*AttestationRecord, error) {
+	raw_db, err := getRawDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := raw_db.GetBuffer(config_obj,
+		paths.NewClientPathManager(client_id).Attestation())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.NotFoundError, client_id)
+	}
+
+	record := &AttestationRecord{}
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// Called when a client enrols. Verifies the attestation report in
+// the client's CSR and compares it with the report the client
+// enrolled with before and with the reports of other clients.
+func (self *ServerCryptoManager) ProcessAttestation(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	client_id string, csr_pem []byte) error {
+
+	csr, err := crypto_utils.ParseX509CSRFromPemStr(csr_pem)
+	if err != nil {
+		return err
+	}
+
+	// The report is only meaningful if it was signed by the
+	// client's key.
+	err = csr.CheckSignature()
+	if err != nil {
+		return err
+	}
+
+	report, err := attestation.FromCSR(csr)
+	if err != nil {
+		return err
+	}
+
+	var previous *attestation.Attestation
+	old_record, err := GetAttestation(config_obj, client_id)
+	if err == nil {
+		previous = old_record.Attestation
+	}
+
+	// Older clients do not send a report.
+	if report == nil && previous == nil {
+		return nil
+	}
+
+	changes := attestation.Compare(previous, report)
+	if len(changes) > 0 {
+		raiseAttestationAlert(ctx, config_obj, client_id,
+			"Enrolment attestation changed", ordereddict.NewDict().
+				Set("Changes", changes).
+				Set("Previous", previous).
+				Set("Attestation", report))
+	}
+
+	// Keep the last report we have.
+	if report == nil {
+		return nil
+	}
+
+	raw_db, err := getRawDB(config_obj)
+	if err != nil {
+		return err
+	}
+
+	// A machine should only ever have one client. Several clients
+	// reporting the same machine are either cloned (e.g. from a VM
+	// image with the client already enrolled) or spoofed.
+	if report.SmbiosUuid != "" {
+		index_path := paths.AttestationIndexPath(report.SmbiosUuid)
+		index := &attestationIndexRecord{}
+		data, err := raw_db.GetBuffer(config_obj, index_path)
+		if err == nil && json.Unmarshal(data, index) == nil &&
+			index.ClientId != client_id {
+			raiseAttestationAlert(ctx, config_obj, client_id,
+				"Enrolment attestation duplicated", ordereddict.NewDict().
+					Set("SmbiosUuid", report.SmbiosUuid).
+					Set("OtherClientId", index.ClientId))
+		}
+
+		data, err = json.Marshal(&attestationIndexRecord{ClientId: client_id})
+		if err != nil {
+			return err
+		}
+
+		err = raw_db.SetBuffer(config_obj, index_path, data, utils.SyncCompleter)
+		if err != nil {
+			return err
+		}
+	}
+
+	record := &AttestationRecord{
+		ClientId:    client_id,
+		Attestation: report,
+		Enrolled:    utils.GetTime().Now().Unix(),
+		Changes:     changes,
+	}
+	if len(changes) > 0 {
+		record.Previous = previous
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return raw_db.SetBuffer(config_obj,
+		paths.NewClientPathManager(client_id).Attestation(),
+		data, utils.SyncCompleter)
+}
+
+func raiseAttestationAlert(
+	ctx context.Context, config_obj *config_proto.Config,
+	client_id, name string, event_data *ordereddict.Dict) {
+
+	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+	logger.Error("%v for %v: %v", name, client_id,
+		json.MustMarshalString(event_data))
+
+	alert := &services.AlertMessage{
+		ClientId:  client_id,
+		AlertName: name,
+		Timestamp: utils.GetTime().Now(),
+		EventData: event_data,
+	}
+
+	serialized, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+	serialized = append(serialized, '\n')
+
+	journal, err := services.GetJournal(config_obj)
+	if err != nil {
+		return
+	}
+
+	err = journal.PushJsonlToArtifact(ctx, config_obj,
+		serialized, 1, "Server.Internal.Alerts", "server", "")
+	if err != nil {
+		logger.Error("Unable to raise attestation alert: %v", err)
+	}
+}
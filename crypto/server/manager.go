@@ -37,6 +37,12 @@ func (self *ServerCryptoManager) AddCertificateRequest(
 		return "", errors.New("Not RSA algorithm")
 	}
 
+	// The CSR must be signed by the key it presents.
+	err = csr.CheckSignature()
+	if err != nil {
+		return "", err
+	}
+
 	common_name := csr.Subject.CommonName
 	public_key := csr.PublicKey.(*rsa.PublicKey)
 
@@ -99,6 +105,12 @@ func NewServerCryptoManager(
 		CryptoManager: base,
 	}
 
+	alerter := &verificationAlerter{last: make(map[string]time.Time)}
+	base.OnVerificationFailure = func(config_obj *config_proto.Config,
+		source string, err error) {
+		alerter.Alert(ctx, config_obj, source, err)
+	}
+
 	err = journal.WatchQueueWithCB(ctx, config_obj, wg,
 		"Server.Internal.ClientDelete",
 		"CryptoServerManager",
@@ -34,3 +34,8 @@ type IClientCryptoManager interface {
 	ICryptoManager
 	AddCertificate(config_obj *config_proto.Config, certificate_pem []byte) (string, error)
 }
+
+// Implemented by crypto managers holding a client's private key.
+type IMessageUnsealer interface {
+	Unseal(sealed *crypto_proto.SealedMessage) (*crypto_proto.VeloMessage, error)
+}
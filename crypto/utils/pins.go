@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// The SHA256 fingerprint of the certificate's public key. Pinning the
+// key rather than the certificate allows the certificate to be
+// reissued with the same key.
+func PublicKeyFingerprint(cert *x509.Certificate) string {
+	hashed := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(hashed[:])
+}
+
+// Check the certificate's public key against the pinned
+// fingerprints. Pins may be written with colons (e.g. as printed by
+// openssl). An empty list accepts any key.
+func VerifyPublicKeyPins(cert *x509.Certificate, pins []string) error {
+	if len(pins) == 0 {
+		return nil
+	}
+
+	fingerprint := PublicKeyFingerprint(cert)
+	for _, pin := range pins {
+		pin = strings.ReplaceAll(strings.TrimSpace(pin), ":", "")
+		if strings.EqualFold(pin, fingerprint) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Public key %v does not match any pinned key",
+		fingerprint)
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func makeTestCert(t *testing.T, key *rsa.PrivateKey) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "VelociraptorServer"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(
+		rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return cert
+}
+
+func TestPublicKeyPins(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+
+	cert := makeTestCert(t, key)
+	fingerprint := PublicKeyFingerprint(cert)
+	assert.Equal(t, 64, len(fingerprint))
+
+	// No pins accepts everything.
+	assert.NoError(t, VerifyPublicKeyPins(cert, nil))
+	assert.NoError(t, VerifyPublicKeyPins(cert, []string{"aa", fingerprint}))
+
+	// Colon separated upper case pins are accepted.
+	var parts []string
+	for i := 0; i < len(fingerprint); i += 2 {
+		parts = append(parts, strings.ToUpper(fingerprint[i:i+2]))
+	}
+	assert.NoError(t, VerifyPublicKeyPins(cert, []string{strings.Join(parts, ":")}))
+
+	// Reissuing the certificate with the same key keeps the pin.
+	assert.Equal(t, fingerprint, PublicKeyFingerprint(makeTestCert(t, key)))
+
+	// A different key does not match.
+	other_key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	assert.Error(t, VerifyPublicKeyPins(makeTestCert(t, other_key),
+		[]string{fingerprint}))
+}
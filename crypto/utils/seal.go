@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+
+	"google.golang.org/protobuf/proto"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+)
+
+// Encrypt a message so only the holder of the private key can read
+// it. The server seals tasks with the client's public key before
+// storing them in the client's queue.
+func SealMessage(key *rsa.PublicKey,
+	message *crypto_proto.VeloMessage) (*crypto_proto.SealedMessage, error) {
+	serialized, err := proto.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	session_key := make([]byte, 32)
+	_, err = rand.Read(session_key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newSealingAEAD(session_key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted_key, err := rsa.EncryptOAEP(
+		sha256.New(), rand.Reader, key, session_key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &crypto_proto.SealedMessage{
+		EncryptedKey: encrypted_key,
+		Nonce:        nonce,
+		CipherText:   aead.Seal(nil, nonce, serialized, nil),
+		FlowRequest:  message.FlowRequest != nil,
+	}, nil
+}
+
+// Decrypt a message sealed by SealMessage.
+func UnsealMessage(key *rsa.PrivateKey,
+	sealed *crypto_proto.SealedMessage) (*crypto_proto.VeloMessage, error) {
+	session_key, err := rsa.DecryptOAEP(
+		sha256.New(), rand.Reader, key, sealed.EncryptedKey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newSealingAEAD(session_key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed.Nonce) != aead.NonceSize() {
+		return nil, errors.New("UnsealMessage: Invalid nonce")
+	}
+
+	serialized, err := aead.Open(nil, sealed.Nonce, sealed.CipherText, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &crypto_proto.VeloMessage{}
+	err = proto.Unmarshal(serialized, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func newSealingAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+)
+
+func TestSealMessage(t *testing.T) {
+	pem, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+
+	key, err := ParseRsaPrivateKeyFromPemStr(pem)
+	assert.NoError(t, err)
+
+	message := &crypto_proto.VeloMessage{
+		SessionId: "F.1234",
+		FlowRequest: &crypto_proto.FlowRequest{
+			VQLClientActions: []*actions_proto.VQLCollectorArgs{{
+				Query: []*actions_proto.VQLRequest{{
+					VQL: "SELECT * FROM info()",
+				}},
+			}},
+		},
+	}
+
+	sealed, err := SealMessage(&key.PublicKey, message)
+	assert.NoError(t, err)
+	assert.True(t, sealed.FlowRequest)
+	assert.NotContains(t, string(sealed.CipherText), "info()")
+
+	unsealed, err := UnsealMessage(key, sealed)
+	assert.NoError(t, err)
+	assert.True(t, proto.Equal(message, unsealed))
+
+	// Tampered messages do not unseal.
+	sealed.CipherText[0] ^= 1
+	_, err = UnsealMessage(key, sealed)
+	assert.Error(t, err)
+
+	// Other keys can not unseal the message.
+	other_pem, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+
+	other_key, err := ParseRsaPrivateKeyFromPemStr(other_pem)
+	assert.NoError(t, err)
+
+	sealed, err = SealMessage(&key.PublicKey, message)
+	assert.NoError(t, err)
+
+	_, err = UnsealMessage(other_key, sealed)
+	assert.Error(t, err)
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+)
+
+// Sign the SHA256 digest of data. Clients use this to sign result
+// batches so the server can prove which endpoint produced them.
+func SignSHA256(key *rsa.PrivateKey, data []byte) ([]byte, error) {
+	hashed := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+}
+
+// Verify a signature made by SignSHA256.
+func VerifySHA256(key *rsa.PublicKey, data, signature []byte) error {
+	hashed := sha256.Sum256(data)
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature)
+}
+
+// Verify a signature made by SignSHA256 with the private key of the
+// certificate (usually the CA).
+func VerifySHA256WithCertificate(cert_pem string, data, signature []byte) error {
+	cert, err := ParseX509CertFromPemStr([]byte(cert_pem))
+	if err != nil {
+		return err
+	}
+
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("Certificate does not have an RSA key")
+	}
+
+	return VerifySHA256(key, data, signature)
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestSignSHA256(t *testing.T) {
+	pem, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+
+	key, err := ParseRsaPrivateKeyFromPemStr(pem)
+	assert.NoError(t, err)
+
+	data := []byte("{\"Row\":1}\n{\"Row\":2}\n")
+	signature, err := SignSHA256(key, data)
+	assert.NoError(t, err)
+
+	assert.NoError(t, VerifySHA256(&key.PublicKey, data, signature))
+
+	// Modified rows do not verify.
+	assert.Error(t, VerifySHA256(&key.PublicKey,
+		[]byte("{\"Row\":1}\n"), signature))
+}
@@ -0,0 +1,180 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+var (
+	weekdays = map[string]time.Weekday{
+		"sun": time.Sunday,
+		"mon": time.Monday,
+		"tue": time.Tuesday,
+		"wed": time.Wednesday,
+		"thu": time.Thursday,
+		"fri": time.Friday,
+		"sat": time.Saturday,
+	}
+)
+
+// A single blackout window in the client's local time. Windows may
+// wrap around midnight (e.g. 22:00-06:00).
+type blackoutWindow struct {
+	// Minutes since midnight.
+	start, end int
+
+	// If empty the window applies every day.
+	days map[time.Weekday]bool
+}
+
+func (self blackoutWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+
+	// For windows that wrap around midnight the day is determined
+	// by the start of the window.
+	day := t.Weekday()
+	if self.start <= self.end {
+		if minute < self.start || minute >= self.end {
+			return false
+		}
+	} else {
+		if minute >= self.end && minute < self.start {
+			return false
+		}
+		if minute < self.end {
+			day = (day + 6) % 7
+		}
+	}
+
+	return len(self.days) == 0 || self.days[day]
+}
+
+// During a blackout the client only maintains its heartbeat with the
+// server. Regular collections and uploads are deferred until the
+// window ends. Urgent collections always run.
+type BlackoutSchedule struct {
+	windows []blackoutWindow
+	clock   utils.Clock
+}
+
+// Returns true if the time falls in any blackout window.
+func (self *BlackoutSchedule) InBlackout() bool {
+	if self == nil {
+		return false
+	}
+
+	now := self.clock.Now().Local()
+	for _, w := range self.windows {
+		if w.contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Block until the blackout ends or the context is done.
+func (self *BlackoutSchedule) Wait(ctx context.Context) error {
+	for self.InBlackout() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-self.clock.After(time.Minute):
+		}
+	}
+	return nil
+}
+
+func parseMinutes(spec string) (int, error) {
+	var hour, minute int
+	_, err := fmt.Sscanf(spec, "%d:%d", &hour, &minute)
+	if err != nil || hour < 0 || hour > 24 || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("Invalid time %v: expected HH:MM", spec)
+	}
+	return hour*60 + minute, nil
+}
+
+func parseDays(spec string) (map[time.Weekday]bool, error) {
+	result := make(map[time.Weekday]bool)
+	for _, item := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.ToLower(item), "-", 2)
+		first, pres := weekdays[parts[0]]
+		if !pres {
+			return nil, fmt.Errorf("Invalid day %v", parts[0])
+		}
+
+		last := first
+		if len(parts) == 2 {
+			last, pres = weekdays[parts[1]]
+			if !pres {
+				return nil, fmt.Errorf("Invalid day %v", parts[1])
+			}
+		}
+
+		for d := first; ; d = (d + 1) % 7 {
+			result[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// Parse a window specification of the form "[Mon-Fri ]HH:MM-HH:MM".
+func parseBlackoutWindow(spec string) (blackoutWindow, error) {
+	result := blackoutWindow{}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 1:
+	case 2:
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return result, err
+		}
+		result.days = days
+		fields = fields[1:]
+	default:
+		return result, fmt.Errorf("Invalid blackout window %v", spec)
+	}
+
+	times := strings.SplitN(fields[0], "-", 2)
+	if len(times) != 2 {
+		return result, fmt.Errorf("Invalid blackout window %v", spec)
+	}
+
+	var err error
+	result.start, err = parseMinutes(times[0])
+	if err != nil {
+		return result, err
+	}
+
+	result.end, err = parseMinutes(times[1])
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// Returns nil if there are no blackout windows configured.
+func NewBlackoutSchedule(
+	specs []string, clock utils.Clock) (*BlackoutSchedule, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	result := &BlackoutSchedule{clock: clock}
+	for _, spec := range specs {
+		window, err := parseBlackoutWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+		result.windows = append(result.windows, window)
+	}
+	return result, nil
+}
@@ -0,0 +1,55 @@
+package executor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+func TestBlackoutSchedule(t *testing.T) {
+	clock := &utils.MockClock{}
+
+	schedule, err := NewBlackoutSchedule([]string{
+		"Mon-Fri 09:00-17:00",
+		"22:00-06:00",
+	}, clock)
+	assert.NoError(t, err)
+
+	for _, testcase := range []struct {
+		time     string
+		expected bool
+	}{
+		// Monday morning during trading hours.
+		{"2024-01-01T10:00:00", true},
+		{"2024-01-01T08:59:00", false},
+		{"2024-01-01T17:00:00", false},
+
+		// Saturday during the day is not in blackout.
+		{"2024-01-06T10:00:00", false},
+
+		// The overnight window applies every day.
+		{"2024-01-06T23:00:00", true},
+		{"2024-01-07T05:59:00", true},
+		{"2024-01-07T06:00:00", false},
+	} {
+		now, err := time.ParseInLocation("2006-01-02T15:04:05",
+			testcase.time, time.Local)
+		assert.NoError(t, err)
+
+		clock.Set(now)
+		assert.Equal(t, testcase.expected, schedule.InBlackout(), testcase.time)
+	}
+
+	// No windows means no schedule.
+	schedule, err = NewBlackoutSchedule(nil, clock)
+	assert.NoError(t, err)
+	assert.False(t, schedule.InBlackout())
+
+	// Invalid specifications are rejected.
+	for _, spec := range []string{"09:00", "Funday 09:00-10:00", "9am-5pm"} {
+		_, err = NewBlackoutSchedule([]string{spec}, clock)
+		assert.Error(t, err, spec)
+	}
+}
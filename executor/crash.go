@@ -12,6 +12,7 @@ import (
 	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
 	"www.velocidex.com/golang/velociraptor/json"
 	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/responder"
 	"www.velocidex.com/golang/velociraptor/services/writeback"
 )
 
@@ -63,6 +64,7 @@ func CheckForCrashes(
 								msg.FlowStats.QueryStatus = append(
 									msg.FlowStats.QueryStatus, &crypto_proto.VeloStatus{
 										Status:       crypto_proto.VeloStatus_GENERIC_ERROR,
+										ErrorClass:   responder.ERROR_CLASS_CLIENT_CRASH,
 										ErrorMessage: "Client Crashed",
 									})
 							}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/protobuf/proto"
@@ -58,6 +59,11 @@ type Executor interface {
 	GetClientInfo() *actions_proto.ClientInfo
 
 	Nanny() *NannyService
+
+	// Returns true when the executor has too many pending requests
+	// to accept more. The communicator uses this to stop fetching
+	// new tasks from the server until the backlog clears.
+	IsBusy() bool
 }
 
 // A concerete implementation of a client executor.
@@ -72,16 +78,36 @@ type ClientExecutor struct {
 
 	config_obj *config_proto.Config
 
-	concurrency *utils.Concurrency
+	// Limits the number of concurrent collections in each priority
+	// class.
+	scheduler *flowScheduler
+
+	// Number of requests received from the server which have not
+	// completed yet.
+	pending     int64
+	max_pending int64
 
 	flow_manager  *responder.FlowManager
 	event_manager *actions.EventTable
+
+	// Defer regular collections during quiet hours.
+	blackout *BlackoutSchedule
+
+	// Set when the server paused the client.
+	pause *pauseState
+
+	clock utils.Clock
 }
 
 func (self *ClientExecutor) Nanny() *NannyService {
 	return Nanny
 }
 
+func (self *ClientExecutor) IsBusy() bool {
+	return self.max_pending > 0 &&
+		atomic.LoadInt64(&self.pending) >= self.max_pending
+}
+
 func (self *ClientExecutor) GetClientInfo() *actions_proto.ClientInfo {
 	return actions.GetClientInfo(self.ctx, self.config_obj)
 }
@@ -143,6 +169,12 @@ func (self *ClientExecutor) processRequestPlugin(
 		return
 	}
 
+	handler, pres := getWellKnownFlowHandler(req.SessionId)
+	if pres {
+		handler(self, ctx, config_obj, req)
+		return
+	}
+
 	if req.Cancel != nil {
 		// Try to cancel the flow and send a message if it worked
 		self.flow_manager.Cancel(ctx, req.SessionId)
@@ -154,13 +186,6 @@ func (self *ClientExecutor) processRequestPlugin(
 		return
 	}
 
-	if req.UpdateEventTable != nil {
-		self.event_manager.UpdateEventTable(
-			self.ctx, self.wg, config_obj,
-			self.Outbound, req.UpdateEventTable)
-		return
-	}
-
 	// This is the old deprecated VQLClientAction that is sent for old
 	// client compatibility. New clients ignore this and only process
 	// a FlowRequest message.
@@ -182,27 +207,63 @@ func NewClientExecutor(
 	ctx context.Context,
 	client_id string,
 	config_obj *config_proto.Config) (*ClientExecutor, error) {
+	return NewClientExecutorWithClock(
+		ctx, client_id, config_obj, utils.RealClock{})
+}
+
+// Create an executor which uses the clock for all its timing
+// decisions. Simulations and tests use a fake clock to drive the
+// executor deterministically.
+func NewClientExecutorWithClock(
+	ctx context.Context,
+	client_id string,
+	config_obj *config_proto.Config,
+	clock utils.Clock) (*ClientExecutor, error) {
 
 	level := int(config_obj.Client.Concurrency)
 	if level == 0 {
 		level = 2
 	}
 
+	var err error
+	max_pending := int64(config_obj.Client.MaxPendingRequests)
+	if max_pending == 0 {
+		max_pending = 100
+	}
+
 	wg := &sync.WaitGroup{}
 	self := &ClientExecutor{
 		ctx:          ctx,
 		client_id:    client_id,
 		Inbound:      make(chan *crypto_proto.VeloMessage, 10),
 		Outbound:     make(chan *crypto_proto.VeloMessage, 10),
-		concurrency:  utils.NewConcurrencyControl(level, time.Hour),
+		scheduler:    newFlowScheduler(level, time.Hour),
+		max_pending:  max_pending,
 		wg:           wg,
 		config_obj:   config_obj,
 		flow_manager: responder.NewFlowManager(ctx, config_obj),
+		clock:        clock,
 	}
 
-	// Install and initialize the event manager
+	// An invalid schedule should not stop the client from talking
+	// to the server.
+	self.blackout, err = NewBlackoutSchedule(
+		config_obj.Client.BlackoutWindows, clock)
+	if err != nil {
+		logger := logging.GetLogger(config_obj, &logging.ClientComponent)
+		logger.Error("NewClientExecutor: Ignoring blackout windows: %v", err)
+	}
+
+	self.pause = newPauseState(config_obj)
+
+	// Install and initialize the event manager. A paused client
+	// starts its monitoring queries when it is resumed.
 	self.event_manager = actions.NewEventTable(ctx, wg, config_obj)
-	self.event_manager.StartFromWriteback(ctx, wg, config_obj, self.Outbound)
+	if !self.pause.IsPaused() {
+		self.event_manager.StartFromWriteback(ctx, wg, config_obj, self.Outbound)
+	}
+
+	self.startScheduler(ctx, wg, config_obj)
 
 	// Drain messages from server and execute them, pushing
 	// results to the output channel.
@@ -246,8 +307,10 @@ func NewClientExecutor(
 				// server should never send us those.
 				if req.AuthState == crypto_proto.VeloMessage_AUTHENTICATED {
 					self.wg.Add(1)
+					atomic.AddInt64(&self.pending, 1)
 					go func() {
 						defer self.wg.Done()
+						defer atomic.AddInt64(&self.pending, -1)
 
 						DebugMessage(req, logger)
 						self.processRequestPlugin(config_obj, ctx, req)
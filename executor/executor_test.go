@@ -374,6 +374,55 @@ func (self *ExecutorTestSuite) TestTotalRowCount() {
 		stats.FlowStats.QueryStatus[0].ResultRows)
 }
 
+// When too many requests are pending the executor reports it is busy
+// so the communicator stops fetching more tasks.
+func (self *ExecutorTestSuite) TestBusy() {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Second)
+	defer cancel()
+
+	config_obj := config.GetDefaultConfig()
+	config_obj.Client.MaxPendingRequests = 1
+
+	executor, err := NewClientExecutor(ctx, "", config_obj)
+	require.NoError(self.T(), err)
+
+	// Drain outbound messages.
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-executor.Outbound:
+			}
+		}
+	}()
+
+	assert.True(self.T(), !executor.IsBusy())
+
+	executor.Inbound <- &crypto_proto.VeloMessage{
+		AuthState: crypto_proto.VeloMessage_AUTHENTICATED,
+		SessionId: fmt.Sprintf("F.XXX%d", utils.GetId()),
+		FlowRequest: &crypto_proto.FlowRequest{
+			VQLClientActions: []*actions_proto.VQLCollectorArgs{{
+				Query: []*actions_proto.VQLRequest{{
+					Name: "Query",
+					VQL:  "SELECT sleep(time=2) FROM scope()",
+				}},
+			}},
+		},
+	}
+
+	// While the query is running the executor is busy.
+	vtesting.WaitUntil(time.Second*5, self.T(), func() bool {
+		return executor.IsBusy()
+	})
+
+	// Once it completes it can accept more work.
+	vtesting.WaitUntil(time.Second*10, self.T(), func() bool {
+		return !executor.IsBusy()
+	})
+}
+
 func getFlowStat(messages []*crypto_proto.VeloMessage) *crypto_proto.VeloMessage {
 	for _, m := range messages {
 		if m.FlowStats != nil {
@@ -0,0 +1,77 @@
+package executor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/constants"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/logging"
+)
+
+var (
+	fast_poll_mu    sync.Mutex
+	fast_poll_until time.Time
+)
+
+// During an interactive investigation the operator may ask for a
+// client to poll as fast as possible for a limited time. While fast
+// polling the client ignores laptop mode and polls every min_poll
+// seconds. The window is not persisted - the client reverts to its
+// normal poll schedule when it expires or when the client restarts.
+func IsFastPolling() bool {
+	fast_poll_mu.Lock()
+	defer fast_poll_mu.Unlock()
+
+	return Clock.Now().Before(fast_poll_until)
+}
+
+// Apply the directive. A zero duration ends the window
+// early. Directives which expired while the client was offline are
+// ignored. Returns true if the directive was applied.
+func setFastPoll(directive *crypto_proto.PollDirective) bool {
+	fast_poll_mu.Lock()
+	defer fast_poll_mu.Unlock()
+
+	now := Clock.Now()
+	if directive.Duration > 0 && directive.Expires > 0 &&
+		now.Unix() > int64(directive.Expires) {
+		return false
+	}
+
+	if directive.Duration == 0 {
+		fast_poll_until = time.Time{}
+		return true
+	}
+
+	fast_poll_until = now.Add(time.Duration(directive.Duration) * time.Second)
+	return true
+}
+
+func processFastPollFlow(
+	self *ClientExecutor, ctx context.Context,
+	config_obj *config_proto.Config, req *crypto_proto.VeloMessage) {
+	if req.PollDirective == nil {
+		return
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.ClientComponent)
+	if !setFastPoll(req.PollDirective) {
+		logger.Info("Ignoring expired fast poll request from the server")
+		return
+	}
+
+	if req.PollDirective.Duration == 0 {
+		logger.Info("Fast poll mode ended by the server")
+		return
+	}
+
+	logger.Info("Fast poll mode requested by the server for %v",
+		time.Duration(req.PollDirective.Duration)*time.Second)
+}
+
+func init() {
+	RegisterWellKnownFlow(constants.FAST_POLL_WELL_KNOWN_FLOW, processFastPollFlow)
+}
@@ -0,0 +1,46 @@
+package executor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+func TestFastPoll(t *testing.T) {
+	clock := &utils.MockClock{}
+	old_clock := Clock
+	defer func() { Clock = old_clock }()
+	Clock = clock
+
+	now := time.Unix(1700000000, 0)
+	clock.Set(now)
+	assert.False(t, IsFastPolling())
+
+	// Fast poll for 10 minutes.
+	assert.True(t, setFastPoll(&crypto_proto.PollDirective{
+		Duration: 600,
+		Expires:  uint64(now.Unix()) + 600,
+	}))
+	assert.True(t, IsFastPolling())
+
+	// Automatically reverts when the window passes.
+	clock.Set(now.Add(601 * time.Second))
+	assert.False(t, IsFastPolling())
+
+	// A directive received after it expired is ignored.
+	assert.False(t, setFastPoll(&crypto_proto.PollDirective{
+		Duration: 600,
+		Expires:  uint64(now.Unix()) + 600,
+	}))
+	assert.False(t, IsFastPolling())
+
+	// A zero duration ends the window early.
+	assert.True(t, setFastPoll(&crypto_proto.PollDirective{Duration: 600}))
+	assert.True(t, IsFastPolling())
+
+	assert.True(t, setFastPoll(&crypto_proto.PollDirective{}))
+	assert.False(t, IsFastPolling())
+}
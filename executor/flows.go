@@ -8,6 +8,7 @@ import (
 	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
 	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
 	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/logging"
 	"www.velocidex.com/golang/velociraptor/responder"
 )
 
@@ -20,10 +21,38 @@ func (self *ClientExecutor) ProcessFlowRequest(
 	flow_context := self.flow_manager.FlowContext(self.Outbound, req)
 	defer flow_context.Close()
 
+	// Regular collections wait for the blackout window to end. Urgent
+	// collections may be used to override the blackout.
+	if !req.Urgent && self.blackout.InBlackout() {
+		flow_context.AddLogMessage(ctx, logging.INFO,
+			"Client is in a blackout window - deferring collection")
+
+		err := self.blackout.Wait(ctx)
+		if err != nil {
+			responder.MakeErrorResponse(
+				self.Outbound, req.SessionId, err.Error())
+			return
+		}
+	}
+
+	if !req.Urgent && self.pause.IsPaused() {
+		flow_context.AddLogMessage(ctx, logging.INFO,
+			"Client is paused - deferring collection")
+
+		err := self.pause.Wait(ctx)
+		if err != nil {
+			responder.MakeErrorResponse(
+				self.Outbound, req.SessionId, err.Error())
+			return
+		}
+	}
+
 	// Control concurrency for the entire collection at once. If a
-	// collection has many queries, they all run concurrently.
+	// collection has many queries, they all run concurrently. Hunt
+	// collections give way to interactive collections.
 	if !req.Urgent {
-		cancel, err := self.concurrency.StartConcurrencyControl(ctx)
+		cancel, err := self.scheduler.Start(
+			ctx, getPriorityClass(req.SessionId))
 		if err != nil {
 			responder.MakeErrorResponse(
 				self.Outbound, req.SessionId, err.Error())
@@ -0,0 +1,144 @@
+/*
+   Mock responses allow the pool client to act as a fleet of fake
+   clients which answer collections with canned results instead of
+   running any queries. This is useful for developing the server and
+   GUI, or for demos, without needing real endpoints.
+
+   Canned results are stored in a directory as JSONL files named
+   after the query name. For example the results for the
+   Generic.Client.Info/BasicInformation source are read from:
+
+   <dir>/Generic.Client.Info/BasicInformation.json
+
+   Queries without a canned result file return no rows. Files are
+   read for each request so they may be edited while the clients are
+   running.
+*/
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
+	"www.velocidex.com/golang/velociraptor/constants"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+var (
+	// When set, pool clients answer flow requests from this
+	// directory.
+	mockResponseDir string
+)
+
+// Answer all pool client collections from canned results in dir.
+func EnableMockResponses(dir string) error {
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if !stat.IsDir() {
+		return fmt.Errorf("Mock responses: %v is not a directory", dir)
+	}
+
+	pool_mu.Lock()
+	defer pool_mu.Unlock()
+
+	mockResponseDir = dir
+	return nil
+}
+
+func getMockResponseDir() string {
+	pool_mu.Lock()
+	defer pool_mu.Unlock()
+
+	return mockResponseDir
+}
+
+// Load the canned rows for the named query.
+func loadMockRows(dir, name string) ([]*ordereddict.Dict, error) {
+	if name == "" || strings.Contains(name, "..") {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return utils.ParseJsonToDicts(data)
+}
+
+// Build the messages a real client would send in response to the
+// flow request: a VQLResponse for each query with canned results
+// followed by the final FlowStats.
+func getMockResponses(
+	dir string, message *crypto_proto.VeloMessage) []*crypto_proto.VeloMessage {
+	var result []*crypto_proto.VeloMessage
+
+	now := uint64(utils.GetTime().Now().UnixNano() / 1000)
+	stats := &crypto_proto.FlowStats{
+		FlowComplete: true,
+		TraceParent:  message.FlowRequest.TraceParent,
+	}
+
+	for _, action := range message.FlowRequest.VQLClientActions {
+		status := &crypto_proto.VeloStatus{
+			Status:       crypto_proto.VeloStatus_OK,
+			FirstActive:  now,
+			LastActive:   now,
+			QueryId:      action.QueryId,
+			TotalQueries: action.TotalQueries,
+		}
+
+		for query_idx, query := range action.Query {
+			rows, err := loadMockRows(dir, query.Name)
+			if err != nil {
+				status.Status = crypto_proto.VeloStatus_GENERIC_ERROR
+				status.ErrorMessage = fmt.Sprintf("%v: %v", query.Name, err)
+				continue
+			}
+
+			if len(rows) == 0 {
+				continue
+			}
+
+			serialized, err := utils.DictsToJson(rows, nil)
+			if err != nil {
+				continue
+			}
+
+			result = append(result, &crypto_proto.VeloMessage{
+				SessionId: message.SessionId,
+				VQLResponse: &actions_proto.VQLResponse{
+					Query:         query,
+					QueryId:       uint64(query_idx),
+					JSONLResponse: string(serialized),
+					Columns:       rows[0].Keys(),
+					TotalRows:     uint64(len(rows)),
+					Timestamp:     now,
+				}})
+
+			status.ResultRows += int64(len(rows))
+			status.NamesWithResponse = append(
+				status.NamesWithResponse, query.Name)
+		}
+
+		stats.QueryStatus = append(stats.QueryStatus, status)
+	}
+
+	return append(result, &crypto_proto.VeloMessage{
+		SessionId: message.SessionId,
+		RequestId: constants.STATS_SINK,
+		FlowStats: stats,
+	})
+}
@@ -0,0 +1,74 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
+	"www.velocidex.com/golang/velociraptor/constants"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+)
+
+func TestMockResponses(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "Generic.Client.Info"), 0700)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "Generic.Client.Info", "BasicInformation.json"),
+		[]byte(`{"Hostname":"demo","OS":"windows"}
+{"Hostname":"demo2","OS":"linux"}
+`), 0600)
+	require.NoError(t, err)
+
+	message := &crypto_proto.VeloMessage{
+		SessionId: "F.1234",
+		FlowRequest: &crypto_proto.FlowRequest{
+			VQLClientActions: []*actions_proto.VQLCollectorArgs{{
+				QueryId:      1,
+				TotalQueries: 1,
+				Query: []*actions_proto.VQLRequest{
+					{VQL: "LET X = SELECT * FROM info()"},
+					{
+						Name: "Generic.Client.Info/BasicInformation",
+						VQL:  "SELECT * FROM X",
+					},
+					{
+						Name: "Generic.Client.Info/Users",
+						VQL:  "SELECT * FROM Artifact.Windows.Sys.Users()",
+					},
+				},
+			}},
+		},
+	}
+
+	responses := getMockResponses(dir, message)
+	require.Equal(t, 2, len(responses))
+
+	response := responses[0].VQLResponse
+	assert.Equal(t, "F.1234", responses[0].SessionId)
+	assert.Equal(t, uint64(2), response.TotalRows)
+	assert.Equal(t, uint64(1), response.QueryId)
+	assert.Equal(t, []string{"Hostname", "OS"}, response.Columns)
+	assert.Equal(t, `{"Hostname":"demo","OS":"windows"}
+{"Hostname":"demo2","OS":"linux"}
+`, response.JSONLResponse)
+
+	// Pool clients make the hostname unique.
+	transformed := maybeTransformResponse(response, 5)
+	assert.Contains(t, transformed.JSONLResponse, `"Hostname":"demo-5"`)
+
+	// The flow is completed with a single status per action.
+	stats := responses[1]
+	assert.Equal(t, constants.STATS_SINK, stats.RequestId)
+	assert.True(t, stats.FlowStats.FlowComplete)
+	require.Equal(t, 1, len(stats.FlowStats.QueryStatus))
+
+	status := stats.FlowStats.QueryStatus[0]
+	assert.Equal(t, crypto_proto.VeloStatus_OK, status.Status)
+	assert.Equal(t, int64(2), status.ResultRows)
+	assert.Equal(t, []string{"Generic.Client.Info/BasicInformation"},
+		status.NamesWithResponse)
+}
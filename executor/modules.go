@@ -0,0 +1,133 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	crypto_utils "www.velocidex.com/golang/velociraptor/crypto/utils"
+	"www.velocidex.com/golang/velociraptor/logging"
+)
+
+// Extension modules allow specialized capabilities (usually new VQL
+// plugins and functions registered from the module's init()) to be
+// deployed to clients without rebuilding the agent.
+//
+// Modules are Go plugins built against exactly the same version of
+// Velociraptor as the client. Since a module runs with the full
+// privileges of the client, every module must be signed with the
+// deployment's CA key - the client verifies the signature against
+// the CA certificate embedded in its config and refuses to load
+// anything else.
+
+const (
+	MODULE_EXTENSION    = ".so"
+	SIGNATURE_EXTENSION = ".sig"
+)
+
+var (
+	modules_mu     sync.Mutex
+	loaded_modules []string
+)
+
+// Sign a module with the CA private key. The signature is stored
+// next to the module with a .sig extension.
+func SignModule(config_obj *config_proto.Config, data []byte) ([]byte, error) {
+	if config_obj.CA == nil || config_obj.CA.PrivateKey == "" {
+		return nil, errors.New("SignModule: CA private key not available")
+	}
+
+	key, err := crypto_utils.ParseRsaPrivateKeyFromPemStr(
+		[]byte(config_obj.CA.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return crypto_utils.SignSHA256(key, data)
+}
+
+// Verify the module was signed by the CA.
+func VerifyModule(config_obj *config_proto.Config, data, signature []byte) error {
+	if config_obj.Client == nil || config_obj.Client.CaCertificate == "" {
+		return errors.New("VerifyModule: No CA certificate configured")
+	}
+
+	return crypto_utils.VerifySHA256WithCertificate(
+		config_obj.Client.CaCertificate, data, signature)
+}
+
+// Load all the signed modules in the Client.module_directory. A
+// module which fails verification or can not be loaded is skipped
+// so it can not prevent the client from starting.
+func LoadSignedModules(config_obj *config_proto.Config) error {
+	if config_obj.Client == nil || config_obj.Client.ModuleDirectory == "" {
+		return nil
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.ClientComponent)
+
+	dir := config_obj.Client.ModuleDirectory
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("LoadSignedModules: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, MODULE_EXTENSION) {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		err := loadSignedModule(config_obj, path)
+		if err != nil {
+			logger.Error("<red>LoadSignedModules:</> Not loading %v: %v",
+				path, err)
+			continue
+		}
+
+		logger.Info("LoadSignedModules: Loaded module %v", path)
+
+		modules_mu.Lock()
+		loaded_modules = append(loaded_modules, name)
+		modules_mu.Unlock()
+	}
+
+	return nil
+}
+
+func loadSignedModule(config_obj *config_proto.Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	signature, err := os.ReadFile(path + SIGNATURE_EXTENSION)
+	if err != nil {
+		return fmt.Errorf("Module is not signed: %w", err)
+	}
+
+	err = VerifyModule(config_obj, data, signature)
+	if err != nil {
+		return fmt.Errorf("Invalid module signature: %w", err)
+	}
+
+	// Load exactly the data we verified so the module can not be
+	// replaced after it was checked.
+	return loadModule(data)
+}
+
+// The names of all modules loaded so far.
+func GetLoadedModules() []string {
+	modules_mu.Lock()
+	defer modules_mu.Unlock()
+
+	result := append([]string{}, loaded_modules...)
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package executor
+
+import "errors"
+
+// Go plugins are not supported on this platform.
+func loadModule(data []byte) error {
+	return errors.New("Modules are not supported on this platform")
+}
@@ -0,0 +1,37 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package executor
+
+import (
+	"os"
+	"plugin"
+)
+
+// Go plugins can only be opened from a file so the verified data is
+// written to a private temporary file first. The file can be removed
+// as soon as the plugin is mapped.
+func loadModule(data []byte) error {
+	tmpfile, err := os.CreateTemp("", "module*.so")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpfile.Name())
+
+	err = tmpfile.Chmod(0700)
+	if err != nil {
+		tmpfile.Close()
+		return err
+	}
+
+	_, err = tmpfile.Write(data)
+	tmpfile.Close()
+	if err != nil {
+		return err
+	}
+
+	// The module registers its capabilities from its init()
+	// functions.
+	_, err = plugin.Open(tmpfile.Name())
+	return err
+}
@@ -0,0 +1,61 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"www.velocidex.com/golang/velociraptor/config"
+	"www.velocidex.com/golang/velociraptor/crypto"
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func TestModuleSignatures(t *testing.T) {
+	ca, err := crypto.GenerateCACert(2048)
+	assert.NoError(t, err)
+
+	config_obj := config.GetDefaultConfig()
+	config_obj.CA.PrivateKey = ca.PrivateKey
+	config_obj.Client.CaCertificate = ca.Cert
+
+	data := []byte("module data")
+	signature, err := SignModule(config_obj, data)
+	assert.NoError(t, err)
+
+	assert.NoError(t, VerifyModule(config_obj, data, signature))
+
+	// Modified modules are rejected.
+	assert.Error(t, VerifyModule(config_obj, []byte("modified"), signature))
+
+	// So are modules signed by another CA.
+	other_ca, err := crypto.GenerateCACert(2048)
+	assert.NoError(t, err)
+	config_obj.Client.CaCertificate = other_ca.Cert
+	assert.Error(t, VerifyModule(config_obj, data, signature))
+}
+
+func TestLoadSignedModulesRejectsUnsigned(t *testing.T) {
+	ca, err := crypto.GenerateCACert(2048)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+
+	config_obj := config.GetDefaultConfig()
+	config_obj.Client.CaCertificate = ca.Cert
+	config_obj.Client.ModuleDirectory = dir
+
+	// An unsigned module and a module with a bad signature.
+	path := filepath.Join(dir, "unsigned.so")
+	assert.NoError(t, os.WriteFile(path, []byte("data"), 0600))
+	assert.Error(t, loadSignedModule(config_obj, path))
+
+	path = filepath.Join(dir, "badsig.so")
+	assert.NoError(t, os.WriteFile(path, []byte("data"), 0600))
+	assert.NoError(t, os.WriteFile(path+SIGNATURE_EXTENSION,
+		[]byte("sig"), 0600))
+	assert.Error(t, loadSignedModule(config_obj, path))
+
+	// Bad modules are skipped and do not prevent startup.
+	assert.NoError(t, LoadSignedModules(config_obj))
+	assert.Equal(t, 0, len(GetLoadedModules()))
+}
@@ -0,0 +1,159 @@
+package executor
+
+import (
+	"context"
+	"sync"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/constants"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/responder"
+	"www.velocidex.com/golang/velociraptor/services/writeback"
+)
+
+// The server may pause a client during incident containment or a
+// change freeze. While paused the client stops its monitoring
+// queries and defers regular collections until it is resumed. Urgent
+// collections still run so the server can always reach the
+// client. The state is kept in the writeback so it survives a
+// restart.
+type pauseState struct {
+	mu     sync.Mutex
+	paused bool
+
+	// Closed when the client is resumed.
+	resumed chan bool
+}
+
+func newPauseState(config_obj *config_proto.Config) *pauseState {
+	self := &pauseState{
+		resumed: make(chan bool),
+	}
+
+	writeback_service := writeback.GetWritebackService()
+	wb, err := writeback_service.GetWriteback(config_obj)
+	if err == nil && wb.Paused {
+		self.paused = true
+	} else {
+		close(self.resumed)
+	}
+
+	return self
+}
+
+func (self *pauseState) IsPaused() bool {
+	if self == nil {
+		return false
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.paused
+}
+
+// Change the pause state and record it in the writeback. Returns
+// true if the state changed.
+func (self *pauseState) Set(
+	config_obj *config_proto.Config, paused bool) (bool, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.paused == paused {
+		return false, nil
+	}
+
+	writeback_service := writeback.GetWritebackService()
+	err := writeback_service.MutateWriteback(config_obj,
+		func(wb *config_proto.Writeback) error {
+			wb.Paused = paused
+			return writeback.WritebackUpdateLevel2
+		})
+	if err != nil {
+		return false, err
+	}
+
+	self.paused = paused
+	if paused {
+		self.resumed = make(chan bool)
+	} else {
+		close(self.resumed)
+	}
+
+	return true, nil
+}
+
+// Block until the client is resumed or the context is done.
+func (self *pauseState) Wait(ctx context.Context) error {
+	self.mu.Lock()
+	resumed := self.resumed
+	self.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-resumed:
+		return nil
+	}
+}
+
+// Event table updates received while paused are stored so they take
+// effect when the client is resumed.
+func (self *pauseState) storeEventTable(
+	config_obj *config_proto.Config, req *crypto_proto.VeloMessage) error {
+	writeback_service := writeback.GetWritebackService()
+	return writeback_service.MutateWriteback(config_obj,
+		func(wb *config_proto.Writeback) error {
+			if wb.EventQueries != nil &&
+				wb.EventQueries.Version >= req.UpdateEventTable.Version {
+				return writeback.WritebackNoUpdate
+			}
+			wb.EventQueries = req.UpdateEventTable
+			return writeback.WritebackUpdateLevel2
+		})
+}
+
+func processPauseFlow(
+	self *ClientExecutor, ctx context.Context,
+	config_obj *config_proto.Config, req *crypto_proto.VeloMessage) {
+	changed, err := self.pause.Set(config_obj, true)
+	if err != nil {
+		responder.MakeErrorResponse(self.Outbound, req.SessionId, err.Error())
+		return
+	}
+
+	if !changed {
+		return
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.ClientComponent)
+	logger.Info("Client paused by the server - stopping monitoring queries")
+
+	self.event_manager.Close()
+}
+
+func processResumeFlow(
+	self *ClientExecutor, ctx context.Context,
+	config_obj *config_proto.Config, req *crypto_proto.VeloMessage) {
+	changed, err := self.pause.Set(config_obj, false)
+	if err != nil {
+		responder.MakeErrorResponse(self.Outbound, req.SessionId, err.Error())
+		return
+	}
+
+	if !changed {
+		return
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.ClientComponent)
+	logger.Info("Client resumed by the server - restarting monitoring queries")
+
+	self.event_manager.StartFromWriteback(
+		self.ctx, self.wg, config_obj, self.Outbound)
+}
+
+func init() {
+	RegisterWellKnownFlow(constants.PAUSE_WELL_KNOWN_FLOW, processPauseFlow)
+	RegisterWellKnownFlow(constants.RESUME_WELL_KNOWN_FLOW, processResumeFlow)
+}
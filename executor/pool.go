@@ -276,6 +276,10 @@ func (self *PoolClientExecutor) Nanny() *NannyService {
 	return Nanny
 }
 
+func (self *PoolClientExecutor) IsBusy() bool {
+	return self.delegate.IsBusy()
+}
+
 func (self *PoolClientExecutor) FlowManager() *responder.FlowManager {
 	return self.delegate.FlowManager()
 }
@@ -309,6 +313,15 @@ func (self *PoolClientExecutor) ProcessRequest(
 	ctx context.Context,
 	message *crypto_proto.VeloMessage) {
 
+	// Fake clients do not run any queries.
+	mock_dir := getMockResponseDir()
+	if mock_dir != "" {
+		if message.FlowRequest != nil {
+			self.sendMockResponses(ctx, mock_dir, message)
+		}
+		return
+	}
+
 	if message.UpdateEventTable != nil {
 		self.delegate.maybeUpdateEventTable(ctx, message)
 		return
@@ -345,6 +358,20 @@ func (self *PoolClientExecutor) ProcessRequest(
 	self.delegate.ProcessRequest(ctx, message)
 }
 
+func (self *PoolClientExecutor) sendMockResponses(
+	ctx context.Context, dir string, message *crypto_proto.VeloMessage) {
+	for _, response := range getMockResponses(dir, message) {
+		response.VQLResponse = maybeTransformResponse(
+			response.VQLResponse, self.id)
+
+		select {
+		case <-ctx.Done():
+			return
+		case self.Outbound <- response:
+		}
+	}
+}
+
 // A Pool Client is a virtualized client running in a goroutine which
 // emulates a full blown client. Flow Requests are cached globally in
 // a transaction so they can be replayed back for all clients. This
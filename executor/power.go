@@ -0,0 +1,47 @@
+package executor
+
+import (
+	"sync"
+	"time"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+)
+
+var (
+	power_mu         sync.Mutex
+	power_state      PowerState
+	power_state_time time.Time
+)
+
+// The client's power and network state. Laptops on battery power or
+// on metered (e.g. mobile broadband) connections should use fewer
+// resources.
+type PowerState struct {
+	OnBattery bool
+	Metered   bool
+}
+
+// Get the current power state. Detection touches the filesystem or
+// calls into the OS so we cache it for a minute.
+func GetPowerState() PowerState {
+	power_mu.Lock()
+	defer power_mu.Unlock()
+
+	now := Clock.Now()
+	if now.Sub(power_state_time) > time.Minute {
+		power_state = getPowerState()
+		power_state_time = now
+	}
+	return power_state
+}
+
+// Returns true if the client is configured for laptop mode and is
+// currently on battery power or a metered connection.
+func IsResourceConstrained(config_obj *config_proto.Config) bool {
+	if config_obj.Client == nil || !config_obj.Client.LaptopMode {
+		return false
+	}
+
+	state := GetPowerState()
+	return state.OnBattery || state.Metered
+}
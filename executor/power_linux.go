@@ -0,0 +1,52 @@
+//go:build linux
+// +build linux
+
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func readSysFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func getPowerState() PowerState {
+	result := PowerState{}
+
+	// We are on battery if there is a battery but no mains power.
+	has_battery := false
+	on_mains := false
+	supplies, _ := filepath.Glob("/sys/class/power_supply/*")
+	for _, supply := range supplies {
+		switch readSysFile(filepath.Join(supply, "type")) {
+		case "Battery":
+			has_battery = true
+		case "Mains":
+			if readSysFile(filepath.Join(supply, "online")) == "1" {
+				on_mains = true
+			}
+		}
+	}
+	result.OnBattery = has_battery && !on_mains
+
+	// Mobile broadband interfaces are usually metered.
+	interfaces, _ := filepath.Glob("/sys/class/net/*")
+	for _, iface := range interfaces {
+		name := filepath.Base(iface)
+		if (strings.HasPrefix(name, "wwan") ||
+			strings.HasPrefix(name, "wwp") ||
+			strings.HasPrefix(name, "ppp")) &&
+			readSysFile(filepath.Join(iface, "operstate")) != "down" {
+			result.Metered = true
+		}
+	}
+
+	return result
+}
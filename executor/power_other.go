@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package executor
+
+// Power state detection is not supported on this platform.
+func getPowerState() PowerState {
+	return PowerState{}
+}
@@ -0,0 +1,44 @@
+//go:build windows
+// +build windows
+
+package executor
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                 = syscall.NewLazyDLL("kernel32.dll")
+	procGetSystemPowerStatus = kernel32.NewProc("GetSystemPowerStatus")
+)
+
+// https://learn.microsoft.com/en-us/windows/win32/api/winbase/ns-winbase-system_power_status
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+// NOTE: Metered connections are only exposed through the WinRT
+// network cost APIs so we do not detect them on Windows.
+func getPowerState() PowerState {
+	result := PowerState{}
+
+	status := systemPowerStatus{}
+	r1, _, _ := procGetSystemPowerStatus.Call(
+		uintptr(unsafe.Pointer(&status)))
+	if r1 == 0 {
+		return result
+	}
+
+	// ACLineStatus 0 means offline. BatteryFlag 128 means there is
+	// no system battery.
+	result.OnBattery = status.ACLineStatus == 0 &&
+		status.BatteryFlag != 128
+
+	return result
+}
@@ -0,0 +1,200 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+// Collections are scheduled in priority classes. An analyst waiting
+// on an interactive collection should not have to wait for a long
+// running hunt collection on the same endpoint to finish.
+//
+// - Hunt collections and locally scheduled artifacts are background
+//   collections. They share Client.concurrency slots and only start
+//   when no interactive collection is waiting.
+//
+// - Interactive collections have their own Client.concurrency slots
+//   so they never queue behind background collections. When the
+//   background collections hold all the slots, interactive
+//   collections run alongside them and background collections are
+//   held back until the client is under the limit again.
+//
+// Urgent collections bypass the scheduler entirely.
+
+type priorityClass int
+
+const (
+	PRIORITY_INTERACTIVE priorityClass = iota
+	PRIORITY_BACKGROUND
+)
+
+func (self priorityClass) String() string {
+	switch self {
+	case PRIORITY_INTERACTIVE:
+		return "interactive"
+	default:
+		return "background"
+	}
+}
+
+var (
+	schedulerRunning = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "client_scheduler_running_collections",
+		Help: "Number of collections currently running in each priority class.",
+	}, []string{"class"})
+
+	schedulerWaiting = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "client_scheduler_waiting_collections",
+		Help: "Number of collections waiting for a slot in each priority class.",
+	}, []string{"class"})
+)
+
+// Hunts are collected under a flow id derived from the hunt id.
+func getPriorityClass(session_id string) priorityClass {
+	_, is_hunt := utils.ExtractHuntId(session_id)
+	if is_hunt {
+		return PRIORITY_BACKGROUND
+	}
+	return PRIORITY_INTERACTIVE
+}
+
+type flowScheduler struct {
+	mu sync.Mutex
+
+	size    int
+	timeout time.Duration
+
+	running map[priorityClass]int
+
+	// Waiters in each class in arrival order. Each channel is
+	// closed when the waiter is granted a slot.
+	waiting map[priorityClass][]chan bool
+}
+
+func newFlowScheduler(size int, timeout time.Duration) *flowScheduler {
+	return &flowScheduler{
+		size:    size,
+		timeout: timeout,
+		running: make(map[priorityClass]int),
+		waiting: make(map[priorityClass][]chan bool),
+	}
+}
+
+// Blocks until the collection may run. Returns a function which
+// must be called when the collection is done.
+func (self *flowScheduler) Start(
+	ctx context.Context, class priorityClass) (func(), error) {
+	self.mu.Lock()
+	if len(self.waiting[class]) == 0 && self.canRun(class) {
+		self.grant(class)
+		self.mu.Unlock()
+		return func() { self.done(class) }, nil
+	}
+
+	ready := make(chan bool)
+	self.waiting[class] = append(self.waiting[class], ready)
+	schedulerWaiting.WithLabelValues(class.String()).Inc()
+	self.mu.Unlock()
+
+	select {
+	case <-ready:
+		return func() { self.done(class) }, nil
+
+	case <-ctx.Done():
+		if self.cancelWait(class, ready) {
+			return nil, errors.New("Scheduler: Cancelled while waiting")
+		}
+
+	case <-time.After(self.timeout):
+		if self.cancelWait(class, ready) {
+			return nil, errors.New("Scheduler: Timed out waiting for a slot")
+		}
+	}
+
+	// We were granted a slot while giving up - give it back.
+	self.done(class)
+	return nil, errors.New("Scheduler: Cancelled while waiting")
+}
+
+// Returns true if a slot is available for the class. Called with the
+// lock held.
+func (self *flowScheduler) canRun(class priorityClass) bool {
+	switch class {
+	case PRIORITY_INTERACTIVE:
+		return self.running[PRIORITY_INTERACTIVE] < self.size
+
+	default:
+		total := self.running[PRIORITY_INTERACTIVE] +
+			self.running[PRIORITY_BACKGROUND]
+		return total < self.size &&
+			len(self.waiting[PRIORITY_INTERACTIVE]) == 0
+	}
+}
+
+// Called with the lock held.
+func (self *flowScheduler) grant(class priorityClass) {
+	self.running[class]++
+	schedulerRunning.WithLabelValues(class.String()).Inc()
+}
+
+func (self *flowScheduler) done(class priorityClass) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.running[class]--
+	schedulerRunning.WithLabelValues(class.String()).Dec()
+
+	self.wakeWaiters()
+}
+
+// Hand out free slots to waiters, interactive collections first.
+// Called with the lock held.
+func (self *flowScheduler) wakeWaiters() {
+	for _, class := range []priorityClass{
+		PRIORITY_INTERACTIVE, PRIORITY_BACKGROUND} {
+		for len(self.waiting[class]) > 0 && self.canRun(class) {
+			ready := self.waiting[class][0]
+			self.waiting[class] = self.waiting[class][1:]
+			schedulerWaiting.WithLabelValues(class.String()).Dec()
+
+			self.grant(class)
+			close(ready)
+		}
+	}
+}
+
+// Remove the waiter from the queue. Returns false if the waiter was
+// already granted a slot.
+func (self *flowScheduler) cancelWait(
+	class priorityClass, ready chan bool) bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for idx, waiter := range self.waiting[class] {
+		if waiter == ready {
+			self.waiting[class] = append(
+				self.waiting[class][:idx], self.waiting[class][idx+1:]...)
+			schedulerWaiting.WithLabelValues(class.String()).Dec()
+
+			// A cancelled interactive waiter may have been
+			// holding back background collections.
+			self.wakeWaiters()
+			return true
+		}
+	}
+	return false
+}
+
+// The number of collections running and waiting in the class.
+func (self *flowScheduler) Stats(class priorityClass) (running, waiting int) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.running[class], len(self.waiting[class])
+}
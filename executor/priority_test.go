@@ -0,0 +1,104 @@
+package executor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriorityClass(t *testing.T) {
+	assert.Equal(t, PRIORITY_BACKGROUND, getPriorityClass("F.1234.H"))
+	assert.Equal(t, PRIORITY_INTERACTIVE, getPriorityClass("F.1234"))
+	assert.Equal(t, PRIORITY_INTERACTIVE, getPriorityClass("F.Monitoring"))
+}
+
+func TestFlowScheduler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scheduler := newFlowScheduler(1, time.Hour)
+
+	// Start the collection in the background and return a channel
+	// which receives its done function once it is running.
+	start := func(class priorityClass) chan func() {
+		result := make(chan func(), 1)
+		go func() {
+			done, err := scheduler.Start(ctx, class)
+			assert.NoError(t, err)
+			result <- done
+		}()
+		return result
+	}
+
+	waitForWaiters := func(class priorityClass, count int) {
+		for ctx.Err() == nil {
+			_, waiting := scheduler.Stats(class)
+			if waiting == count {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("Timed out waiting for %v waiters", class)
+	}
+
+	// A hunt takes the only slot.
+	hunt1_done := <-start(PRIORITY_BACKGROUND)
+
+	// An interactive collection does not wait behind the hunt.
+	interactive1_done := <-start(PRIORITY_INTERACTIVE)
+
+	// But another hunt has to wait.
+	hunt2 := start(PRIORITY_BACKGROUND)
+	waitForWaiters(PRIORITY_BACKGROUND, 1)
+
+	// A second interactive collection waits for the first.
+	interactive2 := start(PRIORITY_INTERACTIVE)
+	waitForWaiters(PRIORITY_INTERACTIVE, 1)
+
+	// The first hunt finishing does not free a slot - the client is
+	// still at its limit.
+	hunt1_done()
+	running, _ := scheduler.Stats(PRIORITY_BACKGROUND)
+	assert.Equal(t, 0, running)
+	_, waiting := scheduler.Stats(PRIORITY_BACKGROUND)
+	assert.Equal(t, 1, waiting)
+
+	// The waiting interactive collection runs before the hunt.
+	interactive1_done()
+	interactive2_done := <-interactive2
+
+	_, waiting = scheduler.Stats(PRIORITY_BACKGROUND)
+	assert.Equal(t, 1, waiting)
+
+	// Only once all interactive collections are done does the hunt
+	// run.
+	interactive2_done()
+	hunt2_done := <-hunt2
+	hunt2_done()
+
+	running, waiting = scheduler.Stats(PRIORITY_BACKGROUND)
+	assert.Equal(t, 0, running)
+	assert.Equal(t, 0, waiting)
+}
+
+func TestFlowSchedulerCancel(t *testing.T) {
+	scheduler := newFlowScheduler(1, time.Hour)
+
+	done, err := scheduler.Start(context.Background(), PRIORITY_BACKGROUND)
+	assert.NoError(t, err)
+	defer done()
+
+	// A cancelled collection gives up its place in the queue.
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err = scheduler.Start(ctx, PRIORITY_BACKGROUND)
+	assert.Error(t, err)
+
+	running, waiting := scheduler.Stats(PRIORITY_BACKGROUND)
+	assert.Equal(t, 1, running)
+	assert.Equal(t, 0, waiting)
+}
@@ -0,0 +1,109 @@
+package executor
+
+import (
+	"context"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/constants"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/services/writeback"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql/psutils"
+)
+
+const (
+	RESTART_CONFIRMATION_ARTIFACT = "Generic.Client.RestartConfirmation"
+)
+
+var (
+	// Overridden in tests.
+	bootTime = psutils.BootTimeWithContext
+)
+
+// The restart() VQL function records the restart it scheduled in the
+// writeback. When the client starts up again we confirm the restart
+// actually happened and report how long the client was down.
+func ConfirmRestart(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	exe Executor) error {
+
+	var pending *config_proto.PendingRestart
+
+	writeback_service := writeback.GetWritebackService()
+	err := writeback_service.MutateWriteback(config_obj,
+		func(wb *config_proto.Writeback) error {
+			if wb.PendingRestart == nil {
+				return writeback.WritebackNoUpdate
+			}
+			pending = wb.PendingRestart
+			wb.PendingRestart = nil
+			return writeback.WritebackUpdateLevel2
+		})
+	if err != nil || pending == nil {
+		return err
+	}
+
+	now := utils.GetTime().Now()
+	row := restartConfirmation(ctx, pending, now)
+
+	logger := logging.GetLogger(config_obj, &logging.ClientComponent)
+	logger.Info("<green>Confirming %v restart</> requested by %v",
+		pending.Action, pending.FlowId)
+
+	serialized, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	exe.SendToServer(&crypto_proto.VeloMessage{
+		SessionId: constants.MONITORING_WELL_KNOWN_FLOW,
+		VQLResponse: &actions_proto.VQLResponse{
+			JSONLResponse: string(serialized) + "\n",
+			TotalRows:     1,
+			Query: &actions_proto.VQLRequest{
+				Name: RESTART_CONFIRMATION_ARTIFACT,
+			},
+			Timestamp: uint64(now.UnixNano() / 1000),
+		},
+		Urgent: true,
+	})
+
+	return nil
+}
+
+func restartConfirmation(ctx context.Context,
+	pending *config_proto.PendingRestart, now time.Time) *ordereddict.Dict {
+
+	scheduled := time.Unix(int64(pending.RequestedTime+pending.Delay), 0)
+
+	// The agent restarts in process so if we got here it restarted.
+	confirmed := true
+	if pending.Action == "host" {
+		// The host rebooted if its boot time changed. If we could
+		// not tell the boot time before, we can not confirm it now.
+		boot_time, err := bootTime(ctx)
+		confirmed = err == nil && pending.BootTime > 0 &&
+			boot_time > pending.BootTime
+	}
+
+	// Time between the scheduled restart and the client coming back.
+	downtime := now.Sub(scheduled)
+	if downtime < 0 {
+		downtime = 0
+	}
+
+	return ordereddict.NewDict().
+		Set("FlowId", pending.FlowId).
+		Set("Action", pending.Action).
+		Set("Requested", time.Unix(int64(pending.RequestedTime), 0).UTC()).
+		Set("Scheduled", scheduled.UTC()).
+		Set("Restarted", now.UTC()).
+		Set("Confirmed", confirmed).
+		Set("DowntimeSec", int64(downtime.Seconds()))
+}
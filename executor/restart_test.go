@@ -0,0 +1,61 @@
+package executor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+)
+
+func TestRestartConfirmation(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000600, 0)
+
+	old_boot_time := bootTime
+	defer func() { bootTime = old_boot_time }()
+
+	bootTime = func(ctx context.Context) (uint64, error) {
+		return 1700000500, nil
+	}
+
+	// Host rebooted: the boot time changed.
+	row := restartConfirmation(ctx, &config_proto.PendingRestart{
+		FlowId:        "F.1234",
+		Action:        "host",
+		RequestedTime: 1700000000,
+		Delay:         60,
+		BootTime:      1600000000,
+	}, now)
+
+	confirmed, _ := row.Get("Confirmed")
+	assert.Equal(t, true, confirmed)
+
+	downtime, _ := row.Get("DowntimeSec")
+	assert.Equal(t, int64(540), downtime)
+
+	// The boot time did not change so the host never rebooted.
+	row = restartConfirmation(ctx, &config_proto.PendingRestart{
+		Action:        "host",
+		RequestedTime: 1700000000,
+		BootTime:      1700000500,
+	}, now)
+
+	confirmed, _ = row.Get("Confirmed")
+	assert.Equal(t, false, confirmed)
+
+	// Agent restarts are always confirmed and the downtime is never
+	// negative.
+	row = restartConfirmation(ctx, &config_proto.PendingRestart{
+		Action:        "agent",
+		RequestedTime: 1700000590,
+		Delay:         60,
+	}, now)
+
+	confirmed, _ = row.Get("Confirmed")
+	assert.Equal(t, true, confirmed)
+
+	downtime, _ = row.Get("DowntimeSec")
+	assert.Equal(t, int64(0), downtime)
+}
@@ -0,0 +1,156 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"www.velocidex.com/golang/velociraptor/actions"
+	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/responder"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
+)
+
+// An artifact collected locally on a recurring schedule.
+type scheduledArtifact struct {
+	artifact string
+	period   time.Duration
+}
+
+// Parse a schedule specification of the form "<interval> <artifact>".
+func parseScheduledArtifact(spec string) (scheduledArtifact, error) {
+	result := scheduledArtifact{}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 2 {
+		return result, fmt.Errorf(
+			"Invalid schedule %q: expected '<interval> <artifact>'", spec)
+	}
+
+	period, err := time.ParseDuration(fields[0])
+	if err != nil {
+		return result, fmt.Errorf("Invalid schedule %q: %w", spec, err)
+	}
+
+	if period < time.Minute {
+		return result, fmt.Errorf(
+			"Invalid schedule %q: interval must be at least 1m", spec)
+	}
+
+	result.artifact = fields[1]
+	result.period = period
+	return result, nil
+}
+
+// Scheduled artifacts run without a server. Their results are sent
+// through the monitoring flow so they are buffered by the
+// communicator until a server is reachable. Runs are skipped while
+// the client is paused or in a blackout window.
+func (self *ClientExecutor) startScheduler(
+	ctx context.Context, wg *sync.WaitGroup,
+	config_obj *config_proto.Config) {
+
+	logger := logging.GetLogger(config_obj, &logging.ClientComponent)
+	monitoring_manager := responder.NewMonitoringManager(ctx)
+
+	for _, spec := range config_obj.Client.ScheduledArtifacts {
+		schedule, err := parseScheduledArtifact(spec)
+		if err != nil {
+			logger.Error("startScheduler: %v", err)
+			continue
+		}
+
+		logger.Info("<green>Scheduling</> %v every %v",
+			schedule.artifact, schedule.period)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				if !self.pause.IsPaused() && !self.blackout.InBlackout() {
+					err := self.runScheduledArtifact(
+						ctx, config_obj, monitoring_manager, schedule)
+					if err != nil {
+						logger.Error("Scheduled artifact %v: %v",
+							schedule.artifact, err)
+					}
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-self.clock.After(schedule.period):
+				}
+			}
+		}()
+	}
+}
+
+func (self *ClientExecutor) runScheduledArtifact(
+	ctx context.Context, config_obj *config_proto.Config,
+	monitoring_manager *responder.MonitoringManager,
+	schedule scheduledArtifact) error {
+
+	launcher, err := services.GetLauncher(config_obj)
+	if err != nil {
+		return err
+	}
+
+	manager, err := services.GetRepositoryManager(config_obj)
+	if err != nil {
+		return err
+	}
+
+	repository, err := manager.GetGlobalRepository(config_obj)
+	if err != nil {
+		return err
+	}
+
+	queries, err := launcher.CompileCollectorArgs(ctx, config_obj,
+		acl_managers.NullACLManager{}, repository,
+		services.CompilerOptions{}, &flows_proto.ArtifactCollectorArgs{
+			Artifacts: []string{schedule.artifact},
+		})
+	if err != nil {
+		return err
+	}
+
+	// Scheduled artifacts give way to interactive collections like
+	// hunts do.
+	cancel, err := self.scheduler.Start(ctx, PRIORITY_BACKGROUND)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	for _, query := range queries {
+		artifact_name := actions.GetQueryName(query.Query)
+		if artifact_name == "" {
+			continue
+		}
+
+		query_responder := responder.NewMonitoringResponder(
+			ctx, config_obj, monitoring_manager,
+			self.Outbound, artifact_name)
+
+		wg.Add(1)
+		go func(query *actions_proto.VQLCollectorArgs) {
+			defer wg.Done()
+
+			actions.VQLClientAction{}.StartQuery(
+				config_obj, ctx, query_responder, query)
+		}(query)
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package executor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScheduledArtifact(t *testing.T) {
+	schedule, err := parseScheduledArtifact("1h Generic.Client.Info")
+	assert.NoError(t, err)
+	assert.Equal(t, "Generic.Client.Info", schedule.artifact)
+	assert.Equal(t, time.Hour, schedule.period)
+
+	schedule, err = parseScheduledArtifact("  90m   Custom.Artifact/Source ")
+	assert.NoError(t, err)
+	assert.Equal(t, "Custom.Artifact/Source", schedule.artifact)
+	assert.Equal(t, 90*time.Minute, schedule.period)
+
+	for _, spec := range []string{
+		"",
+		"Generic.Client.Info",
+		"1h",
+		"hourly Generic.Client.Info",
+		"10s Generic.Client.Info",
+		"1h Generic.Client.Info extra",
+	} {
+		_, err := parseScheduledArtifact(spec)
+		assert.Error(t, err, spec)
+	}
+}
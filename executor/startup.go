@@ -21,5 +21,17 @@ func RunStartupTasks(
 		logger.Error("<red>CheckForCrashes Error:</> %v", err)
 	}
 
+	err = StartTamperProtection(ctx, config_obj, wg, exe)
+	if err != nil {
+		logger := logging.GetLogger(config_obj, &logging.ClientComponent)
+		logger.Error("<red>StartTamperProtection Error:</> %v", err)
+	}
+
+	err = ConfirmRestart(ctx, config_obj, exe)
+	if err != nil {
+		logger := logging.GetLogger(config_obj, &logging.ClientComponent)
+		logger.Error("<red>ConfirmRestart Error:</> %v", err)
+	}
+
 	return nil
 }
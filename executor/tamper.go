@@ -0,0 +1,115 @@
+package executor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/constants"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+const (
+	TAMPER_ARTIFACT = "Generic.Client.Tamper"
+)
+
+var (
+	TamperCheckPeriod = time.Minute
+)
+
+// Platform specific tamper protection.
+type tamperProtector interface {
+	// Apply the protection.
+	Protect() error
+
+	// Check the protection is still in place, restoring it if
+	// needed. Returns a description of each tampering attempt
+	// detected.
+	Check() []string
+}
+
+// Protect the client from being stopped or removed by local users
+// and report any tampering attempts to the server.
+func StartTamperProtection(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	wg *sync.WaitGroup,
+	exe Executor) error {
+
+	if config_obj.Client == nil || !config_obj.Client.TamperProtection {
+		return nil
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.ClientComponent)
+
+	protector, err := newTamperProtector(config_obj)
+	if err != nil {
+		return err
+	}
+
+	err = protector.Protect()
+	if err != nil {
+		// Keep watching even if we could not fully protect
+		// ourselves.
+		logger.Error("StartTamperProtection: %v", err)
+	}
+
+	logger.Info("<green>Tamper protection enabled</>")
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-Clock.After(TamperCheckPeriod):
+				for _, event := range protector.Check() {
+					logger.Info("<red>Tamper attempt detected:</> %v", event)
+					reportTamper(exe, event)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Tamper alerts are sent through the monitoring flow so the server
+// routes them into the alert queue.
+func reportTamper(exe Executor, event string) {
+	alert := &services.AlertMessage{
+		Timestamp: utils.GetTime().Now(),
+		AlertName: "ClientTamper",
+		EventData: ordereddict.NewDict().
+			Set("Description", event),
+	}
+
+	serialized, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+
+	exe.SendToServer(&crypto_proto.VeloMessage{
+		SessionId: constants.MONITORING_WELL_KNOWN_FLOW,
+		RequestId: constants.LOG_SINK,
+		LogMessage: &crypto_proto.LogMessage{
+			NumberOfRows: 1,
+			Jsonl: json.Format(
+				"{\"client_time\":%d,\"level\":%q,\"message\":%q}\n",
+				int(utils.GetTime().Now().Unix()), logging.ALERT,
+				string(serialized)),
+			Level:    logging.ALERT,
+			Artifact: TAMPER_ARTIFACT,
+		},
+		Urgent: true,
+	})
+}
@@ -0,0 +1,177 @@
+//go:build linux
+// +build linux
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+)
+
+const (
+	client_unit_path  = "/etc/systemd/system/velociraptor_client.service"
+	client_unit_wants = "/etc/systemd/system/multi-user.target.wants/velociraptor_client.service"
+)
+
+// A file we keep immutable and restore if it is removed.
+type protectedFile struct {
+	path string
+	mode os.FileMode
+
+	// Restore the file from this path if set, otherwise from data.
+	source string
+	data   []byte
+}
+
+func (self *protectedFile) restore() error {
+	data := self.data
+	if self.source != "" {
+		var err error
+		data, err = os.ReadFile(self.source)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := os.MkdirAll(filepath.Dir(self.path), 0700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(self.path, data, self.mode)
+}
+
+// On Linux we set the immutable bit on the client binary and its
+// systemd unit. A watchdog restores the files and the immutable bit
+// if they are changed. Note that package upgrades need to clear the
+// immutable bit first (chattr -i).
+type linuxTamperProtector struct {
+	files []*protectedFile
+}
+
+func newTamperProtector(
+	config_obj *config_proto.Config) (tamperProtector, error) {
+	result := &linuxTamperProtector{}
+
+	binary, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	// The running binary is always available from /proc even if
+	// it was deleted.
+	stat, err := os.Stat(binary)
+	if err != nil {
+		return nil, err
+	}
+	result.files = append(result.files, &protectedFile{
+		path:   binary,
+		mode:   stat.Mode(),
+		source: "/proc/self/exe",
+	})
+
+	// Keep a copy of the unit file so we can reinstall it.
+	stat, err = os.Stat(client_unit_path)
+	if err == nil {
+		data, err := os.ReadFile(client_unit_path)
+		if err != nil {
+			return nil, err
+		}
+
+		result.files = append(result.files, &protectedFile{
+			path: client_unit_path,
+			mode: stat.Mode(),
+			data: data,
+		})
+	}
+
+	return result, nil
+}
+
+func (self *linuxTamperProtector) Protect() error {
+	for _, file := range self.files {
+		err := setImmutable(file.path)
+		if err != nil {
+			return fmt.Errorf("Setting immutable bit on %v: %w", file.path, err)
+		}
+	}
+	return nil
+}
+
+func (self *linuxTamperProtector) Check() (result []string) {
+	for _, file := range self.files {
+		_, err := os.Lstat(file.path)
+		if os.IsNotExist(err) {
+			result = append(result, fmt.Sprintf(
+				"%v was removed: Reinstalling", file.path))
+
+			err = file.restore()
+			if err != nil {
+				result = append(result, fmt.Sprintf(
+					"Unable to reinstall %v: %v", file.path, err))
+				continue
+			}
+		}
+
+		immutable, err := isImmutable(file.path)
+		if err == nil && !immutable {
+			result = append(result, fmt.Sprintf(
+				"Immutable bit was removed from %v", file.path))
+			_ = setImmutable(file.path)
+		}
+	}
+
+	// Re-enable the service if it was disabled.
+	_, err := os.Stat(client_unit_path)
+	if err == nil {
+		_, err = os.Lstat(client_unit_wants)
+		if os.IsNotExist(err) {
+			result = append(result, "Client service was disabled: Re-enabling")
+			_ = os.Symlink(client_unit_path, client_unit_wants)
+		}
+	}
+
+	return result
+}
+
+func getFileFlags(path string) (int, *os.File, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	flags, err := unix.IoctlGetInt(int(fd.Fd()), unix.FS_IOC_GETFLAGS)
+	if err != nil {
+		fd.Close()
+		return 0, nil, err
+	}
+	return flags, fd, nil
+}
+
+func isImmutable(path string) (bool, error) {
+	flags, fd, err := getFileFlags(path)
+	if err != nil {
+		return false, err
+	}
+	defer fd.Close()
+
+	return flags&unix.FS_IMMUTABLE_FL != 0, nil
+}
+
+func setImmutable(path string) error {
+	flags, fd, err := getFileFlags(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	if flags&unix.FS_IMMUTABLE_FL != 0 {
+		return nil
+	}
+
+	return unix.IoctlSetPointerInt(int(fd.Fd()), unix.FS_IOC_SETFLAGS,
+		flags|unix.FS_IMMUTABLE_FL)
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package executor
+
+import (
+	"errors"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+)
+
+// Tamper protection is not supported on this platform.
+func newTamperProtector(
+	config_obj *config_proto.Config) (tamperProtector, error) {
+	return nil, errors.New("Tamper protection is not supported on this platform")
+}
@@ -0,0 +1,150 @@
+//go:build windows
+// +build windows
+
+package executor
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc/mgr"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+)
+
+const (
+	// Only SYSTEM may stop, reconfigure or delete the
+	// service. Administrators may still start it and change its
+	// DACL so the installer can upgrade the service.
+	protected_service_sddl = "D:(A;;CCDCLCSWRPWPDTLOCRSDRCWDWO;;;SY)" +
+		"(A;;CCLCSWRPLOCRRCWD;;;BA)(A;;CCLCSWLOCRRC;;;IU)(A;;CCLCSWLOCRRC;;;SU)"
+
+	// The default service DACL.
+	default_service_sddl = "D:(A;;CCLCSWRPWPDTLOCRRC;;;SY)" +
+		"(A;;CCDCLCSWRPWPDTLOCRSDRCWDWO;;;BA)(A;;CCLCSWLOCRRC;;;IU)(A;;CCLCSWLOCRRC;;;SU)"
+
+	// Only SYSTEM may terminate or open the process. Administrators
+	// may only query it (PROCESS_QUERY_LIMITED_INFORMATION). Note
+	// that users holding SeDebugPrivilege bypass this check.
+	protected_process_sddl = "D:P(A;;0x1fffff;;;SY)(A;;0x1000;;;BA)"
+)
+
+func setSDDL(handle windows.Handle,
+	object_type windows.SE_OBJECT_TYPE, sddl string) error {
+	sd, err := windows.SecurityDescriptorFromString(sddl)
+	if err != nil {
+		return err
+	}
+
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return err
+	}
+
+	return windows.SetSecurityInfo(handle, object_type,
+		windows.DACL_SECURITY_INFORMATION, nil, nil, dacl, nil)
+}
+
+func getSDDL(handle windows.Handle, object_type windows.SE_OBJECT_TYPE) (
+	string, error) {
+	sd, err := windows.GetSecurityInfo(handle, object_type,
+		windows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return "", err
+	}
+	return sd.String(), nil
+}
+
+// Restrict the service so only SYSTEM can stop or remove it.
+func ProtectService(service *mgr.Service) error {
+	return setSDDL(service.Handle, windows.SE_SERVICE, protected_service_sddl)
+}
+
+// Restore the default service DACL. Used by the installer before
+// upgrading or removing the service.
+func UnprotectService(service *mgr.Service) error {
+	return setSDDL(service.Handle, windows.SE_SERVICE, default_service_sddl)
+}
+
+// On Windows we protect the service and the running process with
+// ACLs. A watchdog restores the service ACL and start type if they
+// are changed.
+type windowsTamperProtector struct {
+	service_name string
+
+	// The service DACL as read back after protecting it.
+	expected_sddl string
+}
+
+func newTamperProtector(
+	config_obj *config_proto.Config) (tamperProtector, error) {
+	if config_obj.Client.WindowsInstaller == nil ||
+		config_obj.Client.WindowsInstaller.ServiceName == "" {
+		return nil, errors.New("Tamper protection: No service name configured")
+	}
+
+	return &windowsTamperProtector{
+		service_name: config_obj.Client.WindowsInstaller.ServiceName,
+	}, nil
+}
+
+func (self *windowsTamperProtector) Protect() error {
+	err := setSDDL(windows.CurrentProcess(),
+		windows.SE_KERNEL_OBJECT, protected_process_sddl)
+	if err != nil {
+		return fmt.Errorf("Protecting process: %w", err)
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	service, err := m.OpenService(self.service_name)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+
+	err = ProtectService(service)
+	if err != nil {
+		return fmt.Errorf("Protecting service: %w", err)
+	}
+
+	self.expected_sddl, err = getSDDL(service.Handle, windows.SE_SERVICE)
+	return err
+}
+
+func (self *windowsTamperProtector) Check() (result []string) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil
+	}
+	defer m.Disconnect()
+
+	service, err := m.OpenService(self.service_name)
+	if err != nil {
+		return []string{fmt.Sprintf(
+			"Unable to open service %v: %v", self.service_name, err)}
+	}
+	defer service.Close()
+
+	sddl, err := getSDDL(service.Handle, windows.SE_SERVICE)
+	if err == nil && self.expected_sddl != "" && sddl != self.expected_sddl {
+		result = append(result, fmt.Sprintf(
+			"Service %v ACL was changed to %v: Restoring",
+			self.service_name, sddl))
+		_ = ProtectService(service)
+	}
+
+	config, err := service.Config()
+	if err == nil && config.StartType != mgr.StartAutomatic {
+		result = append(result, fmt.Sprintf(
+			"Service %v start type was changed: Restoring", self.service_name))
+		config.StartType = mgr.StartAutomatic
+		_ = service.UpdateConfig(config)
+	}
+
+	return result
+}
@@ -34,6 +34,10 @@ func (self *_TestExecutor) Nanny() *NannyService {
 	return Nanny
 }
 
+func (self *_TestExecutor) IsBusy() bool {
+	return false
+}
+
 func (self *_TestExecutor) GetClientInfo() *actions_proto.ClientInfo {
 	return &actions_proto.ClientInfo{}
 }
@@ -0,0 +1,77 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/constants"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/responder"
+)
+
+// Messages sent by the server to a well known session id are
+// processed by a registered handler instead of the regular flow
+// machinery. This allows system flows to be added without special
+// casing them in the executor.
+type WellKnownFlowHandler func(
+	self *ClientExecutor, ctx context.Context,
+	config_obj *config_proto.Config, req *crypto_proto.VeloMessage)
+
+var (
+	well_known_mu       sync.Mutex
+	well_known_handlers = make(map[string]WellKnownFlowHandler)
+)
+
+func RegisterWellKnownFlow(session_id string, handler WellKnownFlowHandler) {
+	well_known_mu.Lock()
+	defer well_known_mu.Unlock()
+
+	well_known_handlers[session_id] = handler
+}
+
+func getWellKnownFlowHandler(session_id string) (WellKnownFlowHandler, bool) {
+	well_known_mu.Lock()
+	defer well_known_mu.Unlock()
+
+	handler, pres := well_known_handlers[session_id]
+	return handler, pres
+}
+
+// The monitoring flow maintains the client's event table.
+func processMonitoringFlow(
+	self *ClientExecutor, ctx context.Context,
+	config_obj *config_proto.Config, req *crypto_proto.VeloMessage) {
+
+	if req.UpdateEventTable != nil {
+		if self.pause.IsPaused() {
+			err := self.pause.storeEventTable(config_obj, req)
+			if err != nil {
+				responder.MakeErrorResponse(
+					self.Outbound, req.SessionId, err.Error())
+			}
+			return
+		}
+
+		self.event_manager.UpdateEventTable(
+			self.ctx, self.wg, config_obj,
+			self.Outbound, req.UpdateEventTable)
+		return
+	}
+
+	// The monitoring flow can not be cancelled.
+	if req.Cancel != nil {
+		return
+	}
+
+	responder.MakeErrorResponse(self.Outbound,
+		req.SessionId, fmt.Sprintf(
+			"Unsupported payload for message: %v", json.MustMarshalString(req)))
+}
+
+func init() {
+	RegisterWellKnownFlow(constants.MONITORING_WELL_KNOWN_FLOW,
+		processMonitoringFlow)
+}
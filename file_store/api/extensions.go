@@ -64,6 +64,9 @@ func GetExtensionForFilestore(path_spec FSPathSpec) string {
 	case PATH_TYPE_FILESTORE_DB_JSON:
 		return ".json.db"
 
+	case PATH_TYPE_FILESTORE_COLUMNS:
+		return ".colz"
+
 	case PATH_TYPE_FILESTORE_ANY:
 		return ""
 	}
@@ -128,5 +131,9 @@ func GetFileStorePathTypeFromExtension(name string) (PathType, string) {
 		return PATH_TYPE_FILESTORE_YAML, name[:len(name)-5]
 	}
 
+	if strings.HasSuffix(name, ".colz") {
+		return PATH_TYPE_FILESTORE_COLUMNS, name[:len(name)-5]
+	}
+
 	return PATH_TYPE_FILESTORE_ANY, name
 }
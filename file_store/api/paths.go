@@ -106,6 +106,9 @@ const (
 
 	// Arbitrary extensions.
 	PATH_TYPE_FILESTORE_ANY
+
+	// Compressed column files holding compacted result sets.
+	PATH_TYPE_FILESTORE_COLUMNS
 )
 
 type _PathSpec interface {
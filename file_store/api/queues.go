@@ -37,6 +37,10 @@ type ResultSetFileProperties struct {
 	Path               FSPathSpec
 	StartTime, EndTime time.Time
 	Size               int64
+
+	// Set when the file is not in the default file store (e.g. it
+	// was moved to the cold storage tier).
+	FileStore FileStore `json:"-"`
 }
 
 // Path manager tells the filestore where to store things.
@@ -0,0 +1,43 @@
+package file_store
+
+import (
+	"google.golang.org/protobuf/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/file_store/api"
+	"www.velocidex.com/golang/velociraptor/file_store/directory"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+var (
+	// Key of org id to cache cold filestores
+	g_cold = make(map[string]api.FileStore)
+)
+
+// The cold storage tier holds old event results moved out of the
+// file store. It is a directory file store rooted at
+// Datastore.retention.cold_directory. Returns nil when the cold
+// tier is not configured.
+func GetColdFileStore(config_obj *config_proto.Config) api.FileStore {
+	if config_obj == nil || config_obj.Datastore == nil ||
+		config_obj.Datastore.Retention == nil ||
+		config_obj.Datastore.Retention.ColdDirectory == "" {
+		return nil
+	}
+
+	fs_mu.Lock()
+	defer fs_mu.Unlock()
+
+	org_id := utils.NormalizedOrgId(config_obj.OrgId)
+	impl, pres := g_cold[org_id]
+	if pres {
+		return impl
+	}
+
+	cold_config := proto.Clone(config_obj).(*config_proto.Config)
+	cold_config.Datastore.FilestoreDirectory =
+		config_obj.Datastore.Retention.ColdDirectory
+
+	impl = directory.NewDirectoryFileStore(cold_config)
+	g_cold[org_id] = impl
+	return impl
+}
@@ -116,4 +116,5 @@ func Reset() {
 	defer fs_mu.Unlock()
 
 	g_impl = make(map[string]api.FileStore)
+	g_cold = make(map[string]api.FileStore)
 }
@@ -84,6 +84,12 @@ type: INTERNAL
 name: Server.Internal.ClientTasks
 type: INTERNAL
 `, `
+name: Server.Internal.GroupTasks
+type: INTERNAL
+`, `
+name: Server.Internal.WatchList
+type: INTERNAL
+`, `
 name: Generic.Client.Info
 type: CLIENT
 sources:
@@ -440,6 +440,9 @@ func (self *TestSuite) TestClientUploaderStoreFile() {
 
 	assert.Equal(self.T(), len(event_rows), 1)
 
+	event_flow_id, _ := event_rows[0].GetString("FlowId")
+	assert.Equal(self.T(), event_flow_id, self.flow_id)
+
 	vfs_path, _ = event_rows[0].GetString("VFSPath")
 	assert.Equal(self.T(), vfs_path,
 		flow_path_manager.GetUploadsFile("ntfs", "foo", []string{"foo"}).
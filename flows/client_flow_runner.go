@@ -11,7 +11,6 @@ import (
 	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
 	artifacts "www.velocidex.com/golang/velociraptor/artifacts"
 	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
-	constants "www.velocidex.com/golang/velociraptor/constants"
 	"www.velocidex.com/golang/velociraptor/crypto"
 	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
 	"www.velocidex.com/golang/velociraptor/datastore"
@@ -25,6 +24,8 @@ import (
 	"www.velocidex.com/golang/velociraptor/services"
 	"www.velocidex.com/golang/velociraptor/services/launcher"
 	utils "www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/utils/tracing"
+	"www.velocidex.com/golang/velociraptor/utils/usage"
 )
 
 /*
@@ -55,6 +56,9 @@ type ClientFlowRunner struct {
 	flow_completion_messages []*ordereddict.Dict
 
 	upload_completion_messages []*ordereddict.Dict
+
+	// Completed flows with uploads which may not have been parsed.
+	dark_data_candidates []*flows_proto.ArtifactCollectorContext
 }
 
 func NewFlowRunner(
@@ -97,6 +101,16 @@ func (self *ClientFlowRunner) Complete() {
 				row, "System.Upload.Completion")
 		}
 	}
+
+	// The upload metadata is now written so we can record the
+	// uploads which were not parsed.
+	for _, stats := range self.dark_data_candidates {
+		err := launcher.RecordDarkData(self.ctx, self.config_obj, stats)
+		if err != nil {
+			logger := logging.GetLogger(self.config_obj, &logging.FrontendComponent)
+			logger.Error("RecordDarkData: %v", err)
+		}
+	}
 }
 
 func (self *ClientFlowRunner) ProcessMonitoringMessage(
@@ -240,19 +254,47 @@ func (self *ClientFlowRunner) MonitoringVQLResponse(
 	data := json.AppendJsonlItem(
 		[]byte(response.JSONLResponse), "ClientId", client_id)
 
+	self.recordStoredRows(ctx, client_id, response.TotalRows)
+
 	return journal.PushJsonlToArtifact(ctx,
 		self.config_obj, data, int(response.TotalRows),
 		query_name, client_id, flow_id)
 }
 
+// Account the rows stored for the client against its org and labels.
+func (self *ClientFlowRunner) recordStoredRows(
+	ctx context.Context, client_id string, rows uint64) {
+	var labels []string
+	labeler := services.GetLabeler(self.config_obj)
+	if labeler != nil {
+		labels = labeler.GetClientLabels(ctx, self.config_obj, client_id)
+	}
+
+	usage.AddRowsStored(utils.NormalizedOrgId(self.config_obj.OrgId),
+		labels, int64(rows))
+}
+
 func (self *ClientFlowRunner) ProcessSingleMessage(
 	ctx context.Context, msg *crypto_proto.VeloMessage) error {
 
 	flow_id := msg.SessionId
 	client_id := msg.Source
 
-	if flow_id == constants.MONITORING_WELL_KNOWN_FLOW {
-		return self.ProcessMonitoringMessage(ctx, msg)
+	// Expand columnar responses so the rest of the pipeline only
+	// deals with JSONL.
+	if msg.VQLResponse != nil && msg.VQLResponse.ColumnarResponse != "" {
+		jsonl, err := utils.DecodeColumnarJSONL(
+			[]byte(msg.VQLResponse.ColumnarResponse))
+		if err != nil {
+			return fmt.Errorf("VQLResponse: %w", err)
+		}
+		msg.VQLResponse.JSONLResponse = string(jsonl)
+		msg.VQLResponse.ColumnarResponse = ""
+	}
+
+	handler, pres := getWellKnownFlowHandler(flow_id)
+	if pres {
+		return handler(self, ctx, msg)
 	}
 
 	// Should never happen because these are filled in from the crypto
@@ -261,6 +303,8 @@ func (self *ClientFlowRunner) ProcessSingleMessage(
 		return fmt.Errorf("Empty SessionId: %v", msg)
 	}
 
+	self.watchFlow(client_id, flow_id, msg)
+
 	if msg.LogMessage != nil {
 		err := self.LogMessage(ctx, client_id, flow_id, msg.LogMessage)
 		if err != nil {
@@ -278,6 +322,8 @@ func (self *ClientFlowRunner) ProcessSingleMessage(
 	}
 
 	if msg.FlowStats != nil {
+		self.releaseTaskLease(client_id, flow_id)
+
 		err := self.FlowStats(ctx, client_id, flow_id, msg.FlowStats)
 		if err != nil {
 			return fmt.Errorf("FlowStats: %w", err)
@@ -353,6 +399,7 @@ func (self *ClientFlowRunner) FileBuffer(
 			ordereddict.NewDict().
 				Set("Timestamp", time.Now().UTC().Unix()).
 				Set("ClientId", client_id).
+				Set("FlowId", flow_id).
 				Set("VFSPath", file_path_manager.Path().AsClientPath()).
 				Set("UploadName", file_buffer.Pathspec.Path).
 				Set("Accessor", file_buffer.Pathspec.Accessor).
@@ -427,6 +474,39 @@ func (self *ClientFlowRunner) Close(ctx context.Context) {
 	self.closer()
 }
 
+// The client is working on the flow so it does not need to be
+// delivered again.
+func (self *ClientFlowRunner) releaseTaskLease(client_id, flow_id string) {
+	if self.config_obj.Defaults.GetTaskLeaseTimeoutSec() == 0 {
+		return
+	}
+
+	client_info_manager, err := services.GetClientInfoManager(self.config_obj)
+	if err == nil {
+		client_info_manager.ReleaseTaskLease(client_id, flow_id)
+	}
+}
+
+// Keep track of the client's activity on the flow so we notice when
+// the client stops responding.
+func (self *ClientFlowRunner) watchFlow(
+	client_id, flow_id string, msg *crypto_proto.VeloMessage) {
+	if self.config_obj.Defaults.GetFlowOrphanTimeoutSec() == 0 {
+		return
+	}
+
+	client_info_manager, err := services.GetClientInfoManager(self.config_obj)
+	if err != nil {
+		return
+	}
+
+	if msg.FlowStats != nil && msg.FlowStats.FlowComplete {
+		client_info_manager.FlowDone(client_id, flow_id)
+	} else {
+		client_info_manager.FlowActive(client_id, flow_id)
+	}
+}
+
 func (self *ClientFlowRunner) FlowStats(
 	ctx context.Context, client_id, flow_id string,
 	msg *crypto_proto.FlowStats) error {
@@ -443,6 +523,8 @@ func (self *ClientFlowRunner) FlowStats(
 		TotalLogs:                  msg.TotalLogs,
 		ActiveTime:                 msg.Timestamp,
 		QueryStats:                 msg.QueryStatus,
+		TotalNetworkBytesSent:      msg.TotalBytesSent,
+		TotalNetworkBytesReceived:  msg.TotalBytesReceived,
 	}
 
 	// Deobfuscate artifact names
@@ -479,6 +561,14 @@ func (self *ClientFlowRunner) FlowStats(
 				Set("Flow", stats).
 				Set("FlowId", flow_id).
 				Set("ClientId", client_id))
+
+		tracing.ExportCollection(msg.TraceParent, client_id, flow_id,
+			stats.QueryStats)
+
+		if stats.TotalUploadedFiles > 0 {
+			self.dark_data_candidates = append(
+				self.dark_data_candidates, stats)
+		}
 	}
 
 	return nil
@@ -520,6 +610,11 @@ func (self *ClientFlowRunner) VQLResponse(
 
 	rs_writer.WriteJSONL(
 		[]byte(response.JSONLResponse), response.TotalRows)
+	self.recordStoredRows(ctx, client_id, response.TotalRows)
+
+	if len(response.Signature) > 0 {
+		return self.storeSignature(ctx, client_id, flow_id, response)
+	}
 
 	return nil
 }
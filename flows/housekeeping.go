@@ -20,15 +20,21 @@ package flows
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/Velocidex/ordereddict"
 	errors "github.com/go-errors/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/protobuf/proto"
 	api_proto "www.velocidex.com/golang/velociraptor/api/proto"
 	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/logging"
 	"www.velocidex.com/golang/velociraptor/services"
 	utils "www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
 )
 
 var (
@@ -87,6 +93,16 @@ func CheckClientStatus(
 		}
 	}
 
+	err = maybeReinterrogate(ctx, config_obj, client_manager, client_id)
+	if err != nil {
+		return err
+	}
+
+	err = maybeReissueOrphanedFlows(ctx, config_obj, client_manager, client_id)
+	if err != nil {
+		return err
+	}
+
 	// Check the client's hunt status
 	// Process any needed hunts.
 	dispatcher, err := services.GetHuntDispatcher(config_obj)
@@ -160,3 +176,109 @@ func CheckClientStatus(
 	})
 	return nil
 }
+
+// Trigger the interrogation service when the client record is too
+// old. The interrogation service will check again before scheduling
+// the collection so it is ok to do this on every poll.
+func maybeReinterrogate(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	client_manager services.ClientInfoManager,
+	client_id string) error {
+
+	if config_obj.Defaults == nil ||
+		config_obj.Defaults.ReinterrogatePeriodHours <= 0 {
+		return nil
+	}
+
+	client_info, err := client_manager.Get(ctx, client_id)
+	if err != nil || !client_info.NeedsInterrogation(config_obj) {
+		return nil
+	}
+
+	journal, err := services.GetJournal(config_obj)
+	if err != nil {
+		return err
+	}
+
+	journal.PushRowsToArtifactAsync(ctx, config_obj,
+		ordereddict.NewDict().Set("ClientId", client_id),
+		"Server.Internal.Enrollment")
+	return nil
+}
+
+// Flows which were orphaned while the client was away are cancelled
+// on the client in case it is still working on them and the same
+// artifacts are collected again in a new flow.
+func maybeReissueOrphanedFlows(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	client_manager services.ClientInfoManager,
+	client_id string) error {
+
+	flow_ids := client_manager.TakeOrphanedFlows(client_id)
+	if len(flow_ids) == 0 {
+		return nil
+	}
+
+	launcher, err := services.GetLauncher(config_obj)
+	if err != nil {
+		return err
+	}
+
+	manager, err := services.GetRepositoryManager(config_obj)
+	if err != nil {
+		return err
+	}
+
+	repository, err := manager.GetGlobalRepository(config_obj)
+	if err != nil {
+		return err
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+
+	for _, flow_id := range flow_ids {
+		collection_context, err := launcher.Storage().LoadCollectionContext(
+			ctx, config_obj, client_id, flow_id)
+		if err != nil {
+			return err
+		}
+
+		// The flow was cancelled or resumed in the meantime.
+		if collection_context.State != flows_proto.ArtifactCollectorContext_ORPHANED ||
+			collection_context.Request == nil {
+			continue
+		}
+
+		err = client_manager.QueueMessageForClient(ctx, client_id,
+			&crypto_proto.VeloMessage{
+				Cancel:    &crypto_proto.Cancel{},
+				SessionId: flow_id,
+			}, services.NOTIFY_CLIENT, utils.BackgroundWriter)
+		if err != nil {
+			return err
+		}
+
+		request := proto.Clone(collection_context.Request).(*flows_proto.ArtifactCollectorArgs)
+		new_flow_id, err := launcher.ScheduleArtifactCollection(
+			ctx, config_obj, acl_managers.NullACLManager{},
+			repository, request, nil)
+		if err != nil {
+			return err
+		}
+
+		collection_context.Status = fmt.Sprintf(
+			"%v. Collected again in %v", collection_context.Status, new_flow_id)
+		err = launcher.Storage().WriteFlow(
+			ctx, config_obj, collection_context, utils.BackgroundWriter)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Client %v returned, collecting orphaned flow %v again in %v",
+			client_id, flow_id, new_flow_id)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package flows
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/Velocidex/ordereddict"
+	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	crypto_utils "www.velocidex.com/golang/velociraptor/crypto/utils"
+	"www.velocidex.com/golang/velociraptor/datastore"
+	"www.velocidex.com/golang/velociraptor/file_store"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/result_sets"
+)
+
+func getClientPublicKey(
+	config_obj *config_proto.Config, client_id string) (*rsa.PublicKey, error) {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	pem := &crypto_proto.PublicKey{}
+	err = db.GetSubject(config_obj,
+		paths.NewClientPathManager(client_id).Key(), pem)
+	if err != nil {
+		return nil, err
+	}
+
+	return crypto_utils.PemToPublicKey(pem.Pem)
+}
+
+// Store the client's signature over a result batch next to the
+// results. Anyone holding the client's public key can later check
+// that the rows were produced by this client. We also verify the
+// signature on receipt so tampered batches are flagged immediately.
+func (self *ClientFlowRunner) storeSignature(
+	ctx context.Context, client_id, flow_id string,
+	response *actions_proto.VQLResponse) error {
+
+	digest := sha256.Sum256([]byte(response.JSONLResponse))
+
+	verified := false
+	public_key, err := getClientPublicKey(self.config_obj, client_id)
+	if err == nil {
+		verified = crypto_utils.VerifySHA256(public_key,
+			[]byte(response.JSONLResponse), response.Signature) == nil
+	}
+
+	flow_path_manager := paths.NewFlowPathManager(client_id, flow_id)
+	file_store_factory := file_store.GetFileStore(self.config_obj)
+	rs_writer, err := result_sets.NewResultSetWriter(
+		file_store_factory, flow_path_manager.Signatures(),
+		json.DefaultEncOpts(), self.completer.GetCompletionFunc(),
+		result_sets.AppendMode)
+	if err != nil {
+		return err
+	}
+	defer rs_writer.Close()
+
+	rs_writer.Write(ordereddict.NewDict().
+		Set("Timestamp", response.Timestamp).
+		Set("Artifact", response.Query.Name).
+		Set("QueryId", response.QueryId).
+		Set("Part", response.Part).
+		Set("StartRow", response.QueryStartRow).
+		Set("Rows", response.TotalRows).
+		Set("SHA256", hex.EncodeToString(digest[:])).
+		Set("Signature", base64.StdEncoding.EncodeToString(response.Signature)).
+		Set("Verified", verified))
+
+	return nil
+}
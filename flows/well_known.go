@@ -0,0 +1,68 @@
+package flows
+
+import (
+	"context"
+	"sync"
+
+	"www.velocidex.com/golang/velociraptor/constants"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+)
+
+// Messages the client sends to a well known session id are processed
+// by a registered handler instead of being stored in a collection.
+// New system flows only need to register a handler here.
+type WellKnownFlowHandler func(
+	self *ClientFlowRunner, ctx context.Context,
+	msg *crypto_proto.VeloMessage) error
+
+var (
+	well_known_mu       sync.Mutex
+	well_known_handlers = make(map[string]WellKnownFlowHandler)
+)
+
+func RegisterWellKnownFlow(session_id string, handler WellKnownFlowHandler) {
+	well_known_mu.Lock()
+	defer well_known_mu.Unlock()
+
+	well_known_handlers[session_id] = handler
+}
+
+func getWellKnownFlowHandler(session_id string) (WellKnownFlowHandler, bool) {
+	well_known_mu.Lock()
+	defer well_known_mu.Unlock()
+
+	handler, pres := well_known_handlers[session_id]
+	return handler, pres
+}
+
+// The foreman checkin is sent with every poll. It is processed for
+// each message list by CheckClientStatus so we only need to record
+// the client heartbeat here.
+func processForemanCheckin(
+	self *ClientFlowRunner, ctx context.Context,
+	msg *crypto_proto.VeloMessage) error {
+	checkin := msg.ForemanCheckin
+	if checkin == nil || checkin.Status == "" || msg.Source == "" {
+		return nil
+	}
+
+	client_info_manager, err := services.GetClientInfoManager(self.config_obj)
+	if err != nil {
+		return err
+	}
+
+	return client_info_manager.UpdateStats(ctx, msg.Source, &services.Stats{
+		HeartbeatStatus: checkin.Status,
+		QueuedBytes:     checkin.QueuedBytes,
+		DroppedMessages: checkin.DroppedMessages,
+		DroppedBytes:    checkin.DroppedBytes,
+	})
+}
+
+func init() {
+	RegisterWellKnownFlow(constants.MONITORING_WELL_KNOWN_FLOW,
+		(*ClientFlowRunner).ProcessMonitoringMessage)
+	RegisterWellKnownFlow(constants.FOREMAN_WELL_KNOWN_FLOW,
+		processForemanCheckin)
+}
@@ -161,6 +161,22 @@ export default class FlowOverview extends React.Component {
                     <dt className="col-4">{T("State")}</dt>
                     <dd className="col-8">{ T(flow.state) }</dd>
 
+                    { flow.state === "RUNNING" && flow.progress_total > 0 &&
+                      <Fragment>
+                        <dt className="col-4">{T("Progress")}</dt>
+                        <dd className="col-8">
+                          {(flow.progress_percent || 0).toFixed(1)} % ({
+                            flow.progress_done || 0} / {flow.progress_total})
+                        </dd>
+                        <dt className="col-4">{T("Estimated Completion")}</dt>
+                        <dd className="col-8">
+                          { flow.estimated_completion_time ?
+                            <VeloTimestamp usec={flow.estimated_completion_time / 1000}/> :
+                            T("Unknown") }
+                        </dd>
+                      </Fragment>
+                    }
+
                     { flow.state === "ERROR" &&
                       <Fragment>
                         <dt className="col-4">{T("Error")}</dt>
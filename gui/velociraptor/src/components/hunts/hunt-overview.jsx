@@ -231,6 +231,21 @@ export default class HuntOverview extends React.Component {
                     <dt className="col-4">{T("Finished clients")}</dt>
                     <dd className="col-8">{stats.total_clients_with_results || 0}</dd>
 
+                    { hunt.state === "RUNNING" && stats.total_clients_scheduled > 0 &&
+                      <React.Fragment>
+                        <dt className="col-4">{T("Progress")}</dt>
+                        <dd className="col-8">
+                          {(stats.progress_percent || 0).toFixed(1)} %
+                        </dd>
+                        <dt className="col-4">{T("Estimated Completion")}</dt>
+                        <dd className="col-8">
+                          { stats.estimated_completion_time ?
+                            <VeloTimestamp usec={stats.estimated_completion_time / 1000}/> :
+                            T("Unknown") }
+                        </dd>
+                      </React.Fragment>
+                    }
+
 
                     <dt className="col-4">{T("Download Results")}</dt>
                     <dd className="col-8">
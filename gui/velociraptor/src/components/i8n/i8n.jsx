@@ -39,6 +39,28 @@ function dict(item) {
     }
 };
 
+// The BCP 47 locale used to format numbers and dates for the
+// selected language.
+export function Locale() {
+    let lang = (window.globals && window.globals.lang) || "en";
+    switch (lang) {
+    case "por":
+        return "pt";
+
+    case "jp":
+        return "ja";
+
+    case "es":
+    case "de":
+    case "fr":
+    case "vi":
+        return lang;
+
+    default:
+        return "en-US";
+    }
+};
+
 function T(item, ...args) {
     let lang = (window.globals && window.globals.lang) || "en";
     let d = dict(item);
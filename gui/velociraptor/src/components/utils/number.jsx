@@ -3,6 +3,7 @@ import "./number.css";
 import React from 'react';
 import PropTypes from 'prop-types';
 import _ from 'lodash';
+import { Locale } from '../i8n/i8n.jsx';
 
 export default class NumberFormatter extends React.Component {
     static propTypes = {
@@ -13,7 +14,7 @@ export default class NumberFormatter extends React.Component {
         return (
             <div className="numeric">
             { _.isNumber(this.props.value) &&
-              JSON.stringify(this.props.value)
+              new Intl.NumberFormat(Locale()).format(this.props.value)
             }
             </div>
         );
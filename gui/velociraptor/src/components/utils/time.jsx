@@ -6,14 +6,19 @@ import moment from 'moment';
 import 'moment-timezone';
 import Tooltip from 'react-bootstrap/Tooltip';
 import OverlayTrigger from 'react-bootstrap/OverlayTrigger';
-import T from '../i8n/i8n.jsx';
+import T, { Locale } from '../i8n/i8n.jsx';
 import UserConfig from '../core/user.jsx';
 
-const renderToolTip = (props, ts) => {
+// The tooltip shows the time in the user's locale since the table
+// itself always uses ISO format.
+const renderToolTip = (props, ts, timezone) => {
     let now = new Date().getTime();
     let difference = (now-ts.getTime());
+    let localized = ts.toLocaleString(Locale(), {timeZone: timezone});
     return <Tooltip {...props}>
              {T("HumanizeDuration", difference)}
+             <br/>
+             {localized}
            </Tooltip>;
 };
 
@@ -120,7 +125,7 @@ class VeloTimestamp extends Component {
 
         return <OverlayTrigger
                  delay={{show: 250, hide: 400}}
-                 overlay={(props)=>renderToolTip(props, ts)}>
+                 overlay={(props)=>renderToolTip(props, ts, timezone)}>
                  <div className="timestamp">
                    {formatted_ts}
                  </div>
@@ -363,6 +363,61 @@ class HexViewTab  extends React.Component {
     }
 }
 
+// Shows the detected type and strings of the start of the file
+// without downloading all of it.
+class TriageTab extends React.Component {
+    static propTypes = {
+        params:  PropTypes.object,
+    }
+
+    state = {
+        preview: {},
+        loading: true,
+    }
+
+    componentDidMount = () => {
+        this.source = CancelToken.source();
+
+        let params = Object.assign({}, this.props.params);
+        params.offset = 0;
+        delete params.length;
+
+        api.get("v1/PreviewVFSFile", params, this.source.token).then(
+            response=>{
+                if (response && response.data) {
+                    this.setState({preview: response.data, loading: false});
+                }
+            });
+    }
+
+    componentWillUnmount() {
+        this.source.cancel("unmounted");
+    }
+
+    render() {
+        let preview = this.state.preview;
+
+        return <Container className="file-hex-view">
+                 <Spinner loading={this.state.loading}/>
+                 <dl className="row">
+                   <dt className="col-2">{T("Type")}</dt>
+                   <dd className="col-10">{preview.Type}</dd>
+                   <dt className="col-2">{T("Mime Type")}</dt>
+                   <dd className="col-10">{preview.MimeType}</dd>
+                   <dt className="col-2">{T("Size")}</dt>
+                   <dd className="col-10">{preview.Size}</dd>
+                 </dl>
+                 <Row>
+                   <Col sm="12" className="hexdump-pane">
+                     <div className="panel textdump">
+                       {_.map(preview.Strings, (x, idx)=><div key={idx}>{x}</div>)}
+                     </div>
+                   </Col>
+                 </Row>
+               </Container>;
+    }
+}
+
 class InspectDialog extends React.Component {
     static propTypes = {
         params:  PropTypes.object,
@@ -412,6 +467,11 @@ class InspectDialog extends React.Component {
                                     size={this.props.size}/>
                     }
                   </Tab>
+                  <Tab eventKey="triage" title={T("Triage")}>
+                    { this.state.tab === "triage" &&
+                      <TriageTab params={this.props.params}/>
+                    }
+                  </Tab>
                   <Tab eventKey="details" title={T("Details")}>
                     { this.state.tab === "details" &&
                       <>
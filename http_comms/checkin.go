@@ -0,0 +1,44 @@
+package http_comms
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	// Closed and replaced whenever an immediate check-in is
+	// requested. All the communicator loops wait on it in addition
+	// to their regular poll timers.
+	checkin_mu   sync.Mutex
+	checkin_chan = make(chan bool)
+
+	// Local events may fire in bursts so do not allow them to
+	// hammer the server.
+	checkin_limiter = rate.NewLimiter(rate.Every(time.Second), 1)
+)
+
+func checkinRequested() <-chan bool {
+	checkin_mu.Lock()
+	defer checkin_mu.Unlock()
+
+	return checkin_chan
+}
+
+// Ask the communicator to contact the server now rather than waiting
+// for the current poll interval to elapse. This allows significant
+// local events to be delivered to the server promptly. Returns false
+// if the request was rate limited.
+func TriggerCheckin() bool {
+	if !checkin_limiter.Allow() {
+		return false
+	}
+
+	checkin_mu.Lock()
+	defer checkin_mu.Unlock()
+
+	close(checkin_chan)
+	checkin_chan = make(chan bool)
+	return true
+}
@@ -20,6 +20,7 @@ package http_comms
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -27,6 +28,9 @@ import (
 	"net/http"
 	"net/http/httptrace"
 	"net/url"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -41,12 +45,14 @@ import (
 	"www.velocidex.com/golang/velociraptor/constants"
 	"www.velocidex.com/golang/velociraptor/crypto"
 	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/crypto/recorder"
 	"www.velocidex.com/golang/velociraptor/crypto/storage"
 	"www.velocidex.com/golang/velociraptor/executor"
 	"www.velocidex.com/golang/velociraptor/json"
 	"www.velocidex.com/golang/velociraptor/logging"
 	"www.velocidex.com/golang/velociraptor/services/writeback"
 	"www.velocidex.com/golang/velociraptor/utils"
+	http_utils "www.velocidex.com/golang/velociraptor/utils/http"
 	"www.velocidex.com/golang/velociraptor/vql/networking"
 )
 
@@ -58,17 +64,60 @@ var (
 	// enrolment (sending HTTP 406 status).
 	EnrolError = errors.New("EnrolError")
 
+	noServerError = errors.New("No server configured")
+
 	mu   sync.Mutex
 	Rand func(int) int = rand.Intn
 
 	proxyHandler = http.ProxyFromEnvironment
 
 	MaxRetryCount = 2
+
+	// The longest backoff requested by the server we honor. This must
+	// be shorter than the nanny's connection delay.
+	MaxBackoff = 5 * time.Minute
+
+	// The API versions this client is able to speak. The server
+	// selects one of these.
+	SupportedApiVersions = []uint32{constants.CLIENT_API_VERSION}
 )
 
+// Returned from connector's Post() when the frontend is overloaded
+// and defers our upload (sending HTTP 429). The client should wait
+// before sending again.
+type BackoffError struct {
+	Wait time.Duration
+}
+
+func (self *BackoffError) Error() string {
+	return fmt.Sprintf("Server requested backoff for %v", self.Wait)
+}
+
+// Returned from connector's Post() when the server refuses the
+// message we sent (HTTP 4xx). Sending the same message again will
+// not help so the caller should drop it.
+type RejectedError struct {
+	Status  string
+	Message string
+}
+
+func (self *RejectedError) Error() string {
+	if self.Message == "" {
+		return fmt.Sprintf("Server rejected message: %v", self.Status)
+	}
+	return fmt.Sprintf("Server rejected message: %v %v",
+		self.Status, self.Message)
+}
+
 // Responsible for maybe enrolling the client. Enrollments should not
 // be done too frequently and should only be done in response for the
 // 406 HTTP codes.
+//
+// The server may ask the client to re-enrol at any time (for example
+// if its key was lost from the datastore). The CSR is always derived
+// from the private key in the writeback so the client keeps its
+// client id across re-enrolments and no operator intervention is
+// needed.
 type Enroller struct {
 	config_obj           *config_proto.Config
 	manager              crypto.ICryptoManager
@@ -94,7 +143,7 @@ func (self *Enroller) MaybeEnrol() {
 			return
 		}
 
-		self.last_enrollment_time = time.Now()
+		self.last_enrollment_time = now
 		self.logger.Info("Enrolling")
 
 		go self.executor.SendToServer(&crypto_proto.VeloMessage{
@@ -155,6 +204,21 @@ type HTTPConnector struct {
 	redirect_to_server int
 	nanny              *executor.NannyService
 
+	// The API version selected by the current server.
+	api_version uint32
+
+	// If set, the urls are selected from the configured profiles
+	// and may be switched when the client moves between networks.
+	roaming bool
+
+	// The urls are ordered by region - this many urls at the front
+	// are in the client's region.
+	local_urls int
+
+	// When we failed over to another region, we try the local
+	// frontends again at this time.
+	failback_time time.Time
+
 	clock utils.Clock
 }
 
@@ -199,16 +263,23 @@ func NewHTTPConnector(
 		crypto.AddPublicRoots(transport.TLSClientConfig.RootCAs)
 	}
 
+	// Detect and report TLS inspecting proxies between us and the
+	// server.
+	err = networking.EnableInterceptionDetection(
+		transport.TLSClientConfig, config_obj.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	urls, local_urls := orderServerUrls(config_obj.Client, urls)
+
 	self := &HTTPConnector{
 		config_obj: config_obj,
 		manager:    manager,
 		logger:     logger,
 		clock:      clock,
 
-		// Start with a random URL from the set of
-		// preconfigured URLs. This should distribute clients
-		// randomly to all frontends.
-		current_url_idx: GetRand()(len(urls)),
+		local_urls: local_urls,
 
 		minPoll:    time.Duration(1) * time.Second,
 		maxPoll:    time.Duration(max_poll) * time.Second,
@@ -239,12 +310,24 @@ func (self *HTTPConnector) GetCurrentUrl(handler string) string {
 func (self *HTTPConnector) prepareRequest(
 	ctx context.Context, name, handler string,
 	data []byte, urgent bool) (*http.Request, error) {
-	reader := bytes.NewReader(data)
-	req, err := http.NewRequestWithContext(ctx,
-		"POST", self.GetCurrentUrl(handler), reader)
+	target := self.GetCurrentUrl(handler)
+	method := "POST"
+	var body io.Reader = bytes.NewReader(data)
+
+	// The reader may use a GET request which carries the encrypted
+	// message in a header. This keeps the reader connection free of
+	// request bodies so it behaves as a plain long poll. Websocket
+	// connections always carry the message in the body.
+	if handler == "reader" && self.config_obj.Client.ReaderUseGet &&
+		strings.HasPrefix(target, "http") {
+		method = "GET"
+		body = nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
 	if err != nil {
 		self.logger.Info("Post to %v returned %v - advancing to next server\n",
-			self.GetCurrentUrl(handler), err)
+			target, err)
 		self.advanceToNextServer(ctx)
 		return nil, errors.Wrap(err, 0)
 	}
@@ -263,13 +346,47 @@ func (self *HTTPConnector) prepareRequest(
 
 	req.Header.Set("User-Agent", constants.USER_AGENT)
 	req.Header.Set("Content-Type", "application/binary")
+	if method == "GET" {
+		req.Header.Set(constants.VELOCIRAPTOR_MESSAGE_HEADER,
+			base64.StdEncoding.EncodeToString(data))
+	}
+
 	if urgent {
 		req.Header.Set("X-Priority", "urgent")
 	}
 
+	http_utils.AdvertiseApiVersions(req, SupportedApiVersions)
+	http_utils.SetClientInfo(req, http_utils.ClientInfo{
+		Version: self.config_obj.GetVersion().GetVersion(),
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+	})
+
 	return req, nil
 }
 
+// Record the API version the server selected. Older servers do not
+// take part in the negotiation and always speak our version.
+func (self *HTTPConnector) checkApiVersion(resp *http.Response) error {
+	selected := http_utils.SelectedApiVersion(resp)
+	if selected == 0 {
+		return nil
+	}
+
+	if !utils.InUint32(SupportedApiVersions, selected) {
+		return fmt.Errorf("Server selected unsupported API version %v", selected)
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.api_version != selected {
+		self.logger.Info("HTTPConnector: Negotiated API version %v", selected)
+		self.api_version = selected
+	}
+	return nil
+}
+
 // Implement retry behavior so we can retry some errors
 // immediately. This avoids having to backoff for temporary errors.
 func (self *HTTPConnector) retryPost(
@@ -297,13 +414,20 @@ func (self *HTTPConnector) retryPost(
 					name, handler, resp.StatusCode)
 				continue
 
-				// 503 is retryable a couple times.
+				// 503 is retryable a couple times unless the server
+				// told us how long to wait.
 			case http.StatusServiceUnavailable:
-				logger.Debug("%v: Retrying connection to %v: Status %v, %v",
-					name, handler, resp.StatusCode, resp.Status)
+				if resp.Header.Get("Retry-After") == "" &&
+					count < MaxRetryCount {
+					logger.Debug("%v: Retrying connection to %v: Status %v, %v",
+						name, handler, resp.StatusCode, resp.Status)
 
-				count++
-				continue
+					if resp.Body != nil {
+						resp.Body.Close()
+					}
+					count++
+					continue
+				}
 			}
 		}
 
@@ -345,7 +469,8 @@ func (self *HTTPConnector) Post(
 
 	now := utils.GetTime().Now()
 	resp, err := self.retryPost(ctx, name, handler, data, urgent)
-	if resp != nil {
+	// Responses emulated for websocket errors have no body.
+	if resp != nil && resp.Body != nil {
 		defer resp.Body.Close()
 	}
 
@@ -382,6 +507,7 @@ func (self *HTTPConnector) Post(
 		// add it to our list of URLs to try when another
 		// frontend fails. It could be a new frontend that was
 		// spun up after the client is created.
+		self.mu.Lock()
 		found := false
 		for idx, url := range self.urls {
 			// Yep we already knew about it.
@@ -409,8 +535,11 @@ func (self *HTTPConnector) Post(
 		// redirecting us again.
 		if self.redirect_to_server <= 0 {
 			self.redirect_to_server = 200
+			self.mu.Unlock()
 
 		} else {
+			self.mu.Unlock()
+
 			// For safety we wait after redirect in case we end up
 			// in a redirect loop.
 			wait := self.maxPoll + time.Duration(
@@ -421,25 +550,46 @@ func (self *HTTPConnector) Post(
 
 		return nil, RedirectError
 
-		// This error means something went wrong in processing the
-		// message we sent - we do not want to retry sending this
-		// message because the server already attempted to process it
-		// but it didnt work for some reason.
-	case 400:
-		data := &bytes.Buffer{}
-		_, err := utils.Copy(ctx, data, resp.Body)
-		if err != nil {
-			return nil, errors.Wrap(err, 0)
-		}
-
-		self.logger.Error("%s: Error: %v %v", name, resp.Status, string(data.Bytes()))
-
-		return &bytes.Buffer{}, nil
-
 	case 406:
 		return nil, EnrolError
 
+		// The frontend is overloaded and deferred our upload. Do not
+		// advance to the next server - just wait as directed.
+	case http.StatusTooManyRequests:
+		wait := retryAfter(resp, time.Minute)
+		self.logger.Info("%s: Server is overloaded, backing off for %v",
+			name, wait)
+		return nil, &BackoffError{Wait: wait}
+
+		// The frontend is temporarily unable to handle us (e.g. it
+		// is shutting down or its datastore is unavailable). The
+		// other frontends are likely in the same state so we stay
+		// with this one.
+	case http.StatusServiceUnavailable, http.StatusConflict:
+		wait := retryAfter(resp, self.maxPoll)
+		self.logger.Info("%s: Server is unavailable (%v), backing off for %v",
+			name, resp.Status, wait)
+		return nil, &BackoffError{Wait: wait}
+
+		// These are generated by a proxy in front of the frontend
+		// when it can not reach it. This is the same as a network
+		// error so try the next frontend.
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		self.logger.Info("Post to %v returned %v - advancing\n",
+			self.GetCurrentUrl(handler), resp.StatusCode)
+
+		self.advanceToNextServer(ctx)
+		return nil, errors.New(resp.Status)
+
 	case 200:
+		err := self.checkApiVersion(resp)
+		if err != nil {
+			self.logger.Info("Post to %v: %v - advancing\n",
+				self.GetCurrentUrl(handler), err)
+			self.advanceToNextServer(ctx)
+			return nil, errors.Wrap(err, 0)
+		}
+
 		encrypted := &bytes.Buffer{}
 
 		// We need to be able to cancel the read here so we do not use
@@ -455,21 +605,81 @@ func (self *HTTPConnector) Post(
 		// Remember the last successful index.
 		self.mu.Lock()
 		self.last_success_idx = self.current_url_idx
+		self.maybeFailback()
 		self.mu.Unlock()
 
 		return encrypted, nil
 
 	default:
-		self.logger.Info("Post to %v returned %v - advancing\n",
-			self.GetCurrentUrl(handler), resp.StatusCode)
+		// Something went wrong in processing the message we sent
+		// - the server already attempted to process it so sending
+		// it again will not help.
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return nil, self.rejected(ctx, name, resp)
+		}
 
-		// POST error - rotate to next URL
-		self.advanceToNextServer(ctx)
+		// The frontend failed to process the message (e.g. 500). It
+		// is reachable so there is no point trying another
+		// frontend - the caller will send the message again to
+		// this one after waiting.
+		self.logger.Info("Post to %v returned %v - retrying later\n",
+			self.GetCurrentUrl(handler), resp.StatusCode)
 
 		return nil, errors.New(resp.Status)
 	}
 }
 
+func (self *HTTPConnector) rejected(
+	ctx context.Context, name string, resp *http.Response) error {
+	data := &bytes.Buffer{}
+	if resp.Body != nil {
+		_, _ = utils.Copy(ctx, data, io.LimitReader(resp.Body, 4096))
+	}
+
+	self.logger.Error("%s: Error: %v %v", name, resp.Status, data.String())
+
+	// The frontend could not authenticate our message. It may have
+	// been rekeyed so fetch its certificate again before the next
+	// message.
+	if resp.StatusCode == http.StatusForbidden {
+		self.mu.Lock()
+		self.server_name = ""
+		self.mu.Unlock()
+	}
+
+	return &RejectedError{
+		Status:  resp.Status,
+		Message: strings.TrimSpace(data.String()),
+	}
+}
+
+// Parse the Retry-After header which may be either a number of
+// seconds or a HTTP date. The wait is capped at MaxBackoff.
+func retryAfter(resp *http.Response, default_wait time.Duration) time.Duration {
+	wait := default_wait
+	header := resp.Header.Get("Retry-After")
+	if header != "" {
+		seconds, err := strconv.Atoi(header)
+		if err == nil {
+			if seconds > 0 {
+				wait = time.Duration(seconds) * time.Second
+			}
+
+		} else if when, err := http.ParseTime(header); err == nil {
+			delay := when.Sub(utils.GetTime().Now())
+			if delay > 0 {
+				wait = delay
+			}
+		}
+	}
+
+	if wait > MaxBackoff {
+		wait = MaxBackoff
+	}
+
+	return wait
+}
+
 // When we have any failures contacting any server, we advance our url
 // index to the next frontend. When we went all the way around the
 // loop we wait to backoff.  Therefore when switching from one FE to
@@ -481,7 +691,9 @@ func (self *HTTPConnector) advanceToNextServer(ctx context.Context) {
 	// Advance the current URL to the next one in
 	// line. Reset the server name (will be fetched from
 	// the PEM) and do not use redirects.
-	self.current_url_idx = ((self.current_url_idx + 1) % len(self.urls))
+	if len(self.urls) > 0 {
+		self.current_url_idx = ((self.current_url_idx + 1) % len(self.urls))
+	}
 	self.redirect_to_server = 0
 	self.server_name = ""
 
@@ -513,6 +725,8 @@ func (self *HTTPConnector) advanceToNextServer(ctx context.Context) {
 			return
 		}
 
+		self.maybeSwitchProfile(ctx)
+
 	} else {
 		self.mu.Unlock()
 	}
@@ -564,6 +778,12 @@ func (self *HTTPConnector) rekeyNextServer(ctx context.Context) error {
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
+	// A standalone sensor keeps buffering until a server is
+	// configured.
+	if len(self.urls) == 0 {
+		return noServerError
+	}
+
 	// Try to fetch the server pem.
 	url := self.urls[self.current_url_idx]
 
@@ -684,6 +904,11 @@ type NotificationReader struct {
 
 	limiter *rate.Limiter
 
+	// Total number of messages received from the server. The
+	// reader reconnects immediately after receiving tasks since
+	// more are likely to follow.
+	received_count int64
+
 	// Pause the PumpRingBufferToSendMessage loop - stops transmitting
 	// data to the server temporarily. New data will still be queued
 	// in the ring buffer if there is room.
@@ -697,6 +922,10 @@ type NotificationReader struct {
 
 	clock utils.Clock
 
+	// The sender's queue - reported in the heartbeat.
+	data_queue     IRingBuffer
+	last_heartbeat time.Time
+
 	// Send the server Server.Internal.ClientInfo messages
 	// periodically. This is sent outside the executor queues to avoid
 	// having the message accumulate in the ring buffer file, but it
@@ -767,6 +996,11 @@ func (self *NotificationReader) sendMessageList(
 	compression crypto_proto.PackedMessageList_CompressionType) {
 
 	for {
+		// Add random wait between polls to avoid
+		// synchronization of endpoints.
+		wait := self.maxPoll + time.Duration(
+			GetRand()(int(self.maxPollDev)))*time.Second
+
 		if atomic.LoadInt32(&self.IsPaused) == 0 {
 			err := self.SendToURL(ctx, message_list, urgent, compression)
 			// Success!
@@ -774,6 +1008,14 @@ func (self *NotificationReader) sendMessageList(
 				return
 			}
 
+			// The server asked us to back off for a while - add some
+			// jitter so deferred clients do not all return at once.
+			backoff, ok := err.(*BackoffError)
+			if ok {
+				wait = backoff.Wait + time.Duration(
+					GetRand()(int(self.maxPollDev)))*time.Second
+			}
+
 			// If we are being redirected do not wait -
 			// just retry again.
 
@@ -790,11 +1032,6 @@ func (self *NotificationReader) sendMessageList(
 		}
 
 		// If we are paused we need to wait a bit before trying again
-
-		// Add random wait between polls to avoid
-		// synchronization of endpoints.
-		wait := self.maxPoll + time.Duration(
-			GetRand()(int(self.maxPollDev)))*time.Second
 		self.logger.Info("Sleeping for %v", wait)
 
 		// While we wait to reconnect we need to update the nanny or
@@ -812,6 +1049,37 @@ func (self *NotificationReader) sendMessageList(
 
 }
 
+// Summarize the messages in a batch for logging.
+func describeBatch(
+	ctx context.Context, config_obj *config_proto.Config,
+	message_list [][]byte,
+	compression crypto_proto.PackedMessageList_CompressionType) string {
+	message_info := &crypto.MessageInfo{
+		RawCompressed: message_list,
+		Compression:   compression,
+	}
+
+	count := 0
+	sessions := make(map[string]bool)
+	err := message_info.IterateJobs(ctx, config_obj,
+		func(ctx context.Context, msg *crypto_proto.VeloMessage) error {
+			count++
+			sessions[msg.SessionId] = true
+			return nil
+		})
+	if err != nil {
+		return fmt.Sprintf("%v messages (%v)", count, err)
+	}
+
+	session_ids := make([]string, 0, len(sessions))
+	for k := range sessions {
+		session_ids = append(session_ids, k)
+	}
+	sort.Strings(session_ids)
+
+	return fmt.Sprintf("%v messages for sessions %v", count, session_ids)
+}
+
 func (self *NotificationReader) SendToURL(
 	ctx context.Context,
 	message_list [][]byte,
@@ -854,6 +1122,16 @@ func (self *NotificationReader) SendToURL(
 		return nil
 	}
 
+	// The server will never accept this batch - drop it so the
+	// rest of the queue is not held up behind it.
+	rejected, ok := err.(*RejectedError)
+	if ok {
+		self.logger.Error("%s: Dropping batch of %v: %v", self.name,
+			describeBatch(ctx, self.config_obj, message_list, compression),
+			rejected)
+		return nil
+	}
+
 	if err != nil {
 		return err
 	}
@@ -863,9 +1141,35 @@ func (self *NotificationReader) SendToURL(
 		return err
 	}
 
+	// Record the messages received from the server if needed.
+	comms_recorder := recorder.GetRecorder(
+		self.config_obj.Client.CommsRecordingPath)
+	if comms_recorder != nil {
+		received := &crypto_proto.MessageList{}
+		defer comms_recorder.Record(recorder.RECEIVED, "", received)
+
+		_ = message_info.IterateJobs(ctx, self.config_obj,
+			func(ctx context.Context, msg *crypto_proto.VeloMessage) error {
+				received.Job = append(received.Job, msg)
+				return nil
+			})
+	}
+
 	return message_info.IterateJobs(ctx, self.config_obj,
 		func(ctx context.Context, msg *crypto_proto.VeloMessage) error {
 
+			// Tasks may be sealed with our public key while they
+			// wait in the server's queue.
+			if msg.Sealed != nil {
+				unsealed, err := self.unseal(msg)
+				if err != nil {
+					self.logger.Error("%s: Unable to unseal task for %v: %v",
+						self.name, msg.SessionId, err)
+					return nil
+				}
+				msg = unsealed
+			}
+
 			// Abort the client, but leave the client
 			// running a bit to send acks. NOTE: This has
 			// to happen before the executor gets to this
@@ -873,16 +1177,37 @@ func (self *NotificationReader) SendToURL(
 			// executor dies.
 			if msg.KillKillKill != nil {
 				go func() {
-					<-time.After(10 * time.Second)
+					<-self.clock.After(10 * time.Second)
 					self.maybeCallOnExit()
 				}()
 			}
 
+			atomic.AddInt64(&self.received_count, 1)
 			self.executor.ProcessRequest(ctx, msg)
 			return nil
 		})
 }
 
+func (self *NotificationReader) unseal(
+	msg *crypto_proto.VeloMessage) (*crypto_proto.VeloMessage, error) {
+	unsealer, ok := self.manager.(crypto.IMessageUnsealer)
+	if !ok {
+		return nil, errors.New("Crypto manager can not unseal tasks")
+	}
+
+	result, err := unsealer.Unseal(msg.Sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	// The frontend sets these on the envelope.
+	result.TaskId = msg.TaskId
+	result.AuthState = msg.AuthState
+	result.OrgId = msg.OrgId
+	result.Source = msg.Source
+	return result, nil
+}
+
 func (self *NotificationReader) maybeCallOnExit() {
 	if self.on_exit != nil {
 		self.on_exit()
@@ -916,9 +1241,30 @@ func (self *NotificationReader) Start(
 		for {
 			self.executor.Nanny().UpdateReadFromServer()
 
+			// Do not fetch more tasks while the executor is still
+			// working through its backlog - they will just queue
+			// up in memory.
+			if self.executor.IsBusy() {
+				self.logger.Debug("%s: Executor is busy - deferring task fetch",
+					self.name)
+
+				err := self.maybeSendHeartbeat(ctx)
+				if err != nil {
+					self.logger.Debug("%s: Sending heartbeat: %v", self.name, err)
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-self.clock.After(self.minPoll):
+					continue
+				}
+			}
+
 			// The Reader does not send any server bound
 			// messages - it is blocked reading server
 			// responses.
+			received := atomic.LoadInt64(&self.received_count)
 			message_list := self.GetMessageList()
 			serialized_message_list, err := proto.Marshal(message_list)
 			if err == nil {
@@ -935,18 +1281,41 @@ func (self *NotificationReader) Start(
 				}
 			}
 
+			// The server just delivered tasks to us - reconnect
+			// immediately so follow up tasks are not delayed.
+			if atomic.LoadInt64(&self.received_count) > received {
+				continue
+			}
+
 			select {
 			case <-ctx.Done():
 				return
 
+			case <-checkinRequested():
+				continue
+
 				// Reconnect quickly for low latency.
-			case <-self.clock.After(self.minPoll):
+			case <-self.clock.After(self.pollInterval()):
 				continue
 			}
 		}
 	}()
 }
 
+// Laptops on battery power or metered connections poll less
+// frequently, unless the server asked the client to fast poll.
+func (self *NotificationReader) pollInterval() time.Duration {
+	if executor.IsFastPolling() {
+		return self.minPoll
+	}
+
+	if self.maxPoll > self.minPoll &&
+		executor.IsResourceConstrained(self.config_obj) {
+		return self.maxPoll
+	}
+	return self.minPoll
+}
+
 // Velociraptor's foreman is very quick (since it is just an int
 // comparison between the client's last hunt timestamp and the
 // server's last hunt timestamp). It is therefore ok to send a foreman
@@ -956,12 +1325,15 @@ func (self *NotificationReader) GetMessageList() *crypto_proto.MessageList {
 	defer self.mu.Unlock()
 
 	// Send this every message
+	checkin := &actions_proto.ForemanCheckin{
+		LastEventTableVersion: self.executor.EventManager().Version(),
+	}
+	self.fillHeartbeat(checkin)
+
 	result := &crypto_proto.MessageList{
 		Job: []*crypto_proto.VeloMessage{{
-			SessionId: constants.FOREMAN_WELL_KNOWN_FLOW,
-			ForemanCheckin: &actions_proto.ForemanCheckin{
-				LastEventTableVersion: self.executor.EventManager().Version(),
-			},
+			SessionId:      constants.FOREMAN_WELL_KNOWN_FLOW,
+			ForemanCheckin: checkin,
 		}}}
 
 	// Attach the Server.Internal.ClientInfo message very
@@ -1051,13 +1423,9 @@ func NewHTTPCommunicator(
 		clock:      clock,
 	}
 
-	// Shuffle the list of URLs so that if a server goes down,
-	// clients will be distributed better accross
+	// The connector orders the urls by region and weight so that if
+	// a server goes down, clients will be distributed better accross
 	// the remaining servers.
-	rand.Seed(utils.GetTime().Now().UnixNano())
-	rand.Shuffle(len(urls), func(i, j int) {
-		urls[i], urls[j] = urls[j], urls[i]
-	})
 	connector, err := NewHTTPConnector(
 		config_obj, crypto_manager, logger, urls,
 		executor.Nanny(), clock)
@@ -1065,6 +1433,14 @@ func NewHTTPCommunicator(
 		return nil, err
 	}
 
+	// Only switch profiles if we were started from one of them.
+	connector.roaming = hasServerProfiles(config_obj.Client) &&
+		(sameUrlSet(urls, config_obj.Client.ServerUrls) ||
+			sameUrlSet(urls, config_obj.Client.InternalServerUrls))
+
+	// Allow the server to push new URLs to us.
+	registerConnector(ctx, connector)
+
 	rb := NewLocalBuffer(ctx, executor.FlowManager(), config_obj)
 
 	// Truncate the file to ensure we always start with a clean
@@ -1137,6 +1513,7 @@ func NewHTTPCommunicator(
 
 		// The handler for receiving messages from the server.
 		"reader", child_on_exit, clock)
+	receiver.data_queue = rb
 
 	result := &HTTPCommunicator{
 		config_obj: config_obj,
@@ -64,9 +64,10 @@ func (self *FakeClock) Sleep(d time.Duration) {
 }
 
 type Response struct {
-	data     string
-	status   int
-	location string
+	data        string
+	status      int
+	location    string
+	retry_after string
 }
 
 type FakeServer struct {
@@ -118,6 +119,10 @@ func NewFakeServer() *FakeServer {
 				rw.Header()["Location"] = []string{response.location}
 			}
 
+			if response.retry_after != "" {
+				rw.Header().Set("Retry-After", response.retry_after)
+			}
+
 			if response.status == 200 {
 				self.Log("response: %v 200", response.data)
 				rw.Write([]byte(response.data))
@@ -305,7 +310,6 @@ func (self *CommsTestSuite) TestServerError() {
 	self.frontend1.responses = []*Response{
 		{data: self.config_obj.Frontend.Certificate, status: 200},
 		{data: "", status: 500},
-		{data: self.config_obj.Frontend.Certificate, status: 200},
 		{data: string(self.empty_response), status: 200},
 	}
 
@@ -322,11 +326,10 @@ func (self *CommsTestSuite) TestServerError() {
 		"request: /reader",
 		"response:  500",
 
-		// Client will sleep to back off and try to rekey
-		"sleep: 10",
+		// Client will sleep to back off and send the same message
+		// again. The server is reachable so there is no need to
+		// rekey.
 		"sleep: 10",
-		"request: /server.pem",
-		"response: -----BEGIN CERTIFICATE-----",
 
 		// This one worked and should be successful.
 		"request: /reader",
@@ -334,6 +337,125 @@ func (self *CommsTestSuite) TestServerError() {
 	})
 }
 
+// A 4xx response means the server will never accept the message so
+// the batch is dropped rather than sent again.
+func (self *CommsTestSuite) TestServerRejectsMessage() {
+	urls := []string{self.frontend1.URL, self.frontend2.URL}
+	mock_clock := utils.NewMockClock(time.Unix(100, 0))
+	cancel := utils.MockTime(mock_clock)
+	defer cancel()
+
+	clock := &FakeClock{
+		MockClock: mock_clock,
+		events:    &self.frontend1.events}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crypto_manager := &crypto_test.NullCryptoManager{}
+	communicator, err := NewHTTPCommunicator(ctx, self.config_obj, crypto_manager,
+		executor.NewTestExecutor(), urls, nil, clock)
+	assert.NoError(self.T(), err)
+
+	self.frontend1.responses = []*Response{
+		{data: self.config_obj.Frontend.Certificate, status: 200},
+		{data: "", status: 400},
+
+		// The server could not authenticate us - rekey.
+		{data: "", status: 403},
+		{data: self.config_obj.Frontend.Certificate, status: 200},
+		{data: string(self.empty_response), status: 200},
+	}
+
+	// Each batch is sent once.
+	for i := 0; i < 3; i++ {
+		communicator.receiver.sendMessageList(context.Background(), nil,
+			!URGENT, crypto_proto.PackedMessageList_ZCOMPRESSION)
+	}
+
+	checkResponses(self.T(), self.frontend1.events, []string{
+		"0 request: /server.pem",
+		"1 response: -----BEGIN CERTIFICATE-",
+
+		// The first batch is dropped without backing off.
+		"2 request: /reader",
+		"3 response:  400",
+
+		"4 request: /reader",
+		"5 response:  403",
+
+		// The next batch fetches the certificate again from the
+		// same frontend.
+		"6 request: /server.pem",
+		"7 response: -----BEGIN CERTIFICATE-",
+		"8 request: /reader",
+		"9 response: \n\vx\x01\x01\x00\x00\xff\xff\x00\x00\x00\x01 200",
+	})
+
+	checkResponses(self.T(), self.frontend2.events, []string{})
+}
+
+// A 503 with a Retry-After header backs off for as long as the server
+// asked without switching frontends.
+func (self *CommsTestSuite) TestServerUnavailable() {
+	urls := []string{self.frontend1.URL, self.frontend2.URL}
+	mock_clock := utils.NewMockClock(time.Unix(100, 0))
+	cancel := utils.MockTime(mock_clock)
+	defer cancel()
+
+	clock := &FakeClock{
+		MockClock: mock_clock,
+		events:    &self.frontend1.events}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crypto_manager := &crypto_test.NullCryptoManager{}
+	communicator, err := NewHTTPCommunicator(ctx, self.config_obj, crypto_manager,
+		executor.NewTestExecutor(), urls, nil, clock)
+	assert.NoError(self.T(), err)
+
+	self.frontend1.responses = []*Response{
+		{data: self.config_obj.Frontend.Certificate, status: 200},
+		{data: "", status: 503, retry_after: "30"},
+		{data: string(self.empty_response), status: 200},
+	}
+
+	communicator.receiver.sendMessageList(context.Background(), nil,
+		!URGENT, crypto_proto.PackedMessageList_ZCOMPRESSION)
+
+	checkResponses(self.T(), self.frontend1.events, []string{
+		"0 request: /server.pem",
+		"1 response: -----BEGIN CERTIFICATE-",
+		"2 request: /reader",
+		"3 response:  503",
+		"4 sleep: 30",
+		"5 request: /reader",
+		"6 response: \n\vx\x01\x01\x00\x00\xff\xff\x00\x00\x00\x01 200",
+	})
+
+	checkResponses(self.T(), self.frontend2.events, []string{})
+}
+
+func TestRetryAfter(t *testing.T) {
+	closer := utils.MockTime(utils.NewMockClock(time.Unix(100, 0)))
+	defer closer()
+
+	resp := &http.Response{Header: http.Header{}}
+	assert.Equal(t, 10*time.Second, retryAfter(resp, 10*time.Second))
+
+	resp.Header.Set("Retry-After", "20")
+	assert.Equal(t, 20*time.Second, retryAfter(resp, 10*time.Second))
+
+	resp.Header.Set("Retry-After",
+		time.Unix(160, 0).UTC().Format(http.TimeFormat))
+	assert.Equal(t, time.Minute, retryAfter(resp, 10*time.Second))
+
+	// Capped to MaxBackoff
+	resp.Header.Set("Retry-After", "86400")
+	assert.Equal(t, MaxBackoff, retryAfter(resp, 10*time.Second))
+}
+
 // Client configured with two frontends. Frontend1 is down returning
 // 500, Frontend2 is down too.
 func (self *CommsTestSuite) TestMultiFrontends() {
@@ -477,8 +599,9 @@ func (self *CommsTestSuite) TestMultiFrontendsAllIsBorked() {
 }
 
 // With 2 FE configured if FE 1 fails intermittantly (perhaps due to
-// load), client should back off and try FE1 one more time before
-// switching to FE2
+// load), client should back off and try FE1 again rather than
+// switching to FE2 - the frontend is reachable so a server error is
+// not a reason to rotate.
 func (self *CommsTestSuite) TestMultiFrontendsIntermittantFailure() {
 	urls := []string{self.frontend1.URL, self.frontend2.URL}
 	mock_clock := utils.NewMockClock(time.Unix(100, 0))
@@ -504,7 +627,6 @@ func (self *CommsTestSuite) TestMultiFrontendsIntermittantFailure() {
 
 		// Emit a single failure.
 		{data: "", status: 500},
-		{data: self.config_obj.Frontend.Certificate, status: 200},
 		{data: string(self.empty_response), status: 200},
 	}
 
@@ -529,16 +651,14 @@ func (self *CommsTestSuite) TestMultiFrontendsIntermittantFailure() {
 		"2 request: /reader",
 		"3 response:  500",
 		"4 sleep: 10",
-	})
-
-	checkResponses(self.T(), self.frontend2.events, []string{
-		"5 request: /server.pem",
-		"6 response: -----BEGIN CERTIFICAT",
 
 		// This time we get through.
-		"7 request: /reader",
-		"8 response: \n\vx\x01\x01\x00\x00\xff\xff\x00\x00\x00\x01 200",
+		"5 request: /reader",
+		"6 response: \n\vx\x01\x01\x00\x00\xff\xff\x00\x00\x00\x01 200",
 	})
+
+	// FE2 is never contacted.
+	checkResponses(self.T(), self.frontend2.events, []string{})
 }
 
 // With 2 FE configured if FE 1 fails we switch to FE2 and when that
@@ -567,7 +687,7 @@ func (self *CommsTestSuite) TestMultiFrontendsHeavyFailure() {
 		{data: self.config_obj.Frontend.Certificate, status: 200},
 
 		// Emit a single failure.
-		{data: "", status: 500},
+		{data: "", status: 502},
 
 		{data: self.config_obj.Frontend.Certificate, status: 200},
 		{data: string(self.empty_response), status: 200},
@@ -575,7 +695,7 @@ func (self *CommsTestSuite) TestMultiFrontendsHeavyFailure() {
 
 	self.frontend2.responses = []*Response{
 		{data: self.config_obj.Frontend.Certificate, status: 200},
-		{data: "", status: 500},
+		{data: "", status: 502},
 	}
 
 	communicator.receiver.sendMessageList(context.Background(), nil,
@@ -593,7 +713,7 @@ func (self *CommsTestSuite) TestMultiFrontendsHeavyFailure() {
 		// Now client tries to connect for real - failed and
 		// switch immediately to FE2
 		"2 request: /reader",
-		"3 response:  500",
+		"3 response:  502",
 
 		"4 sleep: 10",
 		"9 sleep: 10",
@@ -615,7 +735,7 @@ func (self *CommsTestSuite) TestMultiFrontendsHeavyFailure() {
 
 		// ERROR - switch back but this time we sleep.
 		"7 request: /reader",
-		"8 response:  500",
+		"8 response:  502",
 	})
 }
 
@@ -718,7 +838,7 @@ func (self *CommsTestSuite) TestMultiFrontendRedirectWithErrors() {
 		{data: "", status: 301, location: self.frontend2.URL},
 
 		{data: self.config_obj.Frontend.Certificate, status: 200},
-		{data: "", status: 500},
+		{data: "", status: 502},
 
 		{data: self.config_obj.Frontend.Certificate, status: 200},
 		{data: string(self.empty_response), status: 200},
@@ -728,7 +848,7 @@ func (self *CommsTestSuite) TestMultiFrontendRedirectWithErrors() {
 		{data: self.config_obj.Frontend.Certificate, status: 200},
 		{data: string(self.empty_response), status: 200},
 
-		{data: "", status: 500},
+		{data: "", status: 502},
 		{data: self.config_obj.Frontend.Certificate, status: 200},
 		{data: string(self.empty_response), status: 200},
 	}
@@ -759,7 +879,7 @@ func (self *CommsTestSuite) TestMultiFrontendRedirectWithErrors() {
 		// Try to connect to FE1 but there is an error. NOTE
 		// r=1 is now removed.
 		"13 request: /reader",
-		"14 response:  500",
+		"14 response:  502",
 
 		// Now must sleep since we tried all endpoints and
 		// they all failed.
@@ -780,7 +900,7 @@ func (self *CommsTestSuite) TestMultiFrontendRedirectWithErrors() {
 		// the r=1 parameter to avoid another redirect. FE2 is
 		// down now.
 		"8 request: /reader?r=1",
-		"9 response:  500",
+		"9 response:  502",
 
 		// After sleep switch to FE2 and succeed.
 		"17 request: /server.pem",
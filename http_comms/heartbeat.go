@@ -0,0 +1,83 @@
+package http_comms
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+)
+
+const (
+	HEARTBEAT_IDLE      = "idle"
+	HEARTBEAT_BUSY      = "busy"
+	HEARTBEAT_UPLOADING = "uploading"
+)
+
+// The heartbeat is carried in the foreman checkin which is sent with
+// every reader poll. It is tiny so it is never held back by the data
+// channel.
+func (self *NotificationReader) fillHeartbeat(
+	checkin *actions_proto.ForemanCheckin) {
+	checkin.Status = HEARTBEAT_IDLE
+
+	if self.data_queue != nil {
+		checkin.QueuedBytes = self.data_queue.TotalSize()
+		if checkin.QueuedBytes > 0 {
+			checkin.Status = HEARTBEAT_UPLOADING
+		}
+		checkin.DroppedMessages, checkin.DroppedBytes =
+			self.data_queue.DropStats()
+	}
+
+	if self.executor.IsBusy() {
+		checkin.Status = HEARTBEAT_BUSY
+	}
+
+	if self.config_obj.Version != nil {
+		checkin.Version = self.config_obj.Version.Version
+	}
+}
+
+// When the executor is busy we stop fetching tasks, but still need
+// to tell the server we are alive. The heartbeat is posted to the
+// control handler which never delivers tasks. It is sent at most
+// once per max poll period and bypasses the limiter.
+func (self *NotificationReader) maybeSendHeartbeat(ctx context.Context) error {
+	period := self.maxPoll
+	if period == 0 {
+		period = 60 * time.Second
+	}
+
+	now := self.clock.Now()
+	if now.Sub(self.last_heartbeat) < period {
+		return nil
+	}
+
+	if self.connector.ServerName() == "" {
+		return nil
+	}
+
+	serialized, err := proto.Marshal(self.GetMessageList())
+	if err != nil {
+		return err
+	}
+
+	cipher_text, err := self.manager.Encrypt(
+		[][]byte{serialized},
+		crypto_proto.PackedMessageList_UNCOMPRESSED,
+		self.config_obj.Client.Nonce,
+		self.connector.ServerName())
+	if err != nil {
+		return err
+	}
+
+	_, err = self.connector.Post(ctx, self.name, "control", cipher_text, URGENT)
+	if err != nil {
+		return err
+	}
+
+	self.last_heartbeat = now
+	return nil
+}
@@ -0,0 +1,125 @@
+package http_comms
+
+import (
+	"google.golang.org/protobuf/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/constants"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/logging"
+)
+
+// What the ring buffer does when it is full. By default producers
+// (i.e. the running queries) are blocked until the buffer drains to
+// the server. The drop policies keep the queries running at the cost
+// of losing some data, which is counted and reported to the server
+// in the client heartbeat.
+const (
+	OVERFLOW_BLOCK_PRODUCERS      = "block-producers"
+	OVERFLOW_DROP_OLDEST          = "drop-oldest"
+	OVERFLOW_DROP_LOWEST_PRIORITY = "drop-lowest-priority"
+)
+
+// Message priorities used by the drop-lowest-priority policy.
+const (
+	// Client event data - there is always more of it.
+	PRIORITY_LOW = iota
+
+	// Collection results and logs.
+	PRIORITY_NORMAL
+
+	// Flow completion and urgent messages are never dropped since
+	// the server can not complete the flow without them.
+	PRIORITY_CRITICAL
+)
+
+func getOverflowPolicy(config_obj *config_proto.Config) string {
+	policy := ""
+	if config_obj.Client != nil && config_obj.Client.LocalBuffer != nil {
+		policy = config_obj.Client.LocalBuffer.OverflowPolicy
+	}
+
+	switch policy {
+	case "", OVERFLOW_BLOCK_PRODUCERS:
+		return OVERFLOW_BLOCK_PRODUCERS
+
+	case OVERFLOW_DROP_OLDEST, OVERFLOW_DROP_LOWEST_PRIORITY:
+		return policy
+
+	default:
+		logger := logging.GetLogger(config_obj, &logging.ClientComponent)
+		logger.Error("Unknown local buffer overflow_policy %v: using %v",
+			policy, OVERFLOW_BLOCK_PRODUCERS)
+		return OVERFLOW_BLOCK_PRODUCERS
+	}
+}
+
+// The priority of a queued item is the highest priority of the
+// messages in it.
+func itemPriority(item []byte) int {
+	message_list := &crypto_proto.MessageList{}
+	err := proto.Unmarshal(item, message_list)
+	if err != nil {
+		return PRIORITY_NORMAL
+	}
+
+	result := PRIORITY_LOW
+	for _, message := range message_list.Job {
+		if message.Urgent || message.FlowStats != nil ||
+			message.Status != nil {
+			return PRIORITY_CRITICAL
+		}
+
+		if message.SessionId != constants.MONITORING_WELL_KNOWN_FLOW {
+			result = PRIORITY_NORMAL
+		}
+	}
+
+	return result
+}
+
+// Choose which items to drop to free up excess bytes. Each item
+// occupies its length plus overhead bytes in the buffer. Returns
+// which items should be dropped, or nil if nothing can be dropped.
+func selectDrops(policy string, items [][]byte, excess, overhead uint64) []bool {
+	priorities := make([]int, len(items))
+	for idx, item := range items {
+		priorities[idx] = itemPriority(item)
+	}
+
+	// Drop oldest first, either regardless of priority or starting
+	// with the lowest priority.
+	var passes []int
+	switch policy {
+	case OVERFLOW_DROP_OLDEST:
+		passes = []int{PRIORITY_NORMAL}
+	case OVERFLOW_DROP_LOWEST_PRIORITY:
+		passes = []int{PRIORITY_LOW, PRIORITY_NORMAL}
+	default:
+		return nil
+	}
+
+	result := make([]bool, len(items))
+	dropped := false
+	var freed uint64
+
+	for _, max_priority := range passes {
+		for idx, item := range items {
+			if freed >= excess {
+				break
+			}
+
+			if result[idx] || priorities[idx] > max_priority {
+				continue
+			}
+
+			result[idx] = true
+			dropped = true
+			freed += uint64(len(item)) + overhead
+		}
+	}
+
+	if !dropped {
+		return nil
+	}
+	return result
+}
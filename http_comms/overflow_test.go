@@ -0,0 +1,128 @@
+package http_comms
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
+	"www.velocidex.com/golang/velociraptor/config"
+	"www.velocidex.com/golang/velociraptor/constants"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/responder"
+)
+
+func makeItem(t *testing.T, session_id, data string, flow_stats bool) []byte {
+	message := &crypto_proto.VeloMessage{
+		SessionId: session_id,
+		VQLResponse: &actions_proto.VQLResponse{
+			JSONLResponse: data,
+		},
+	}
+	if flow_stats {
+		message.FlowStats = &crypto_proto.FlowStats{}
+	}
+
+	serialized, err := proto.Marshal(&crypto_proto.MessageList{
+		Job: []*crypto_proto.VeloMessage{message},
+	})
+	assert.NoError(t, err)
+	return serialized
+}
+
+func TestSelectDrops(t *testing.T) {
+	event := makeItem(t, constants.MONITORING_WELL_KNOWN_FLOW, "event", false)
+	result := makeItem(t, "F.1234", "result", false)
+	stats := makeItem(t, "F.1234", "stats", true)
+
+	assert.Equal(t, PRIORITY_LOW, itemPriority(event))
+	assert.Equal(t, PRIORITY_NORMAL, itemPriority(result))
+	assert.Equal(t, PRIORITY_CRITICAL, itemPriority(stats))
+
+	items := [][]byte{stats, result, event, result}
+
+	// Oldest droppable items go first.
+	assert.Equal(t, []bool{false, true, false, false},
+		selectDrops(OVERFLOW_DROP_OLDEST, items, 1, 0))
+
+	// Events go before collection results.
+	assert.Equal(t, []bool{false, false, true, false},
+		selectDrops(OVERFLOW_DROP_LOWEST_PRIORITY, items, 1, 0))
+	assert.Equal(t, []bool{false, true, true, false},
+		selectDrops(OVERFLOW_DROP_LOWEST_PRIORITY, items,
+			uint64(len(event)+1), 0))
+
+	// Flow stats are never dropped.
+	assert.Nil(t, selectDrops(OVERFLOW_DROP_OLDEST, [][]byte{stats}, 1, 0))
+	assert.Nil(t, selectDrops(OVERFLOW_BLOCK_PRODUCERS, items, 1, 0))
+}
+
+func TestRingBufferOverflow(t *testing.T) {
+	config_obj := config.GetDefaultConfig()
+	config_obj.Client.LocalBuffer.OverflowPolicy = OVERFLOW_DROP_OLDEST
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := makeItem(t, "F.1234", "first", false)
+	second := makeItem(t, "F.1234", "second", false)
+
+	flow_manager := responder.NewFlowManager(ctx, config_obj)
+	ring_buffer := NewRingBuffer(config_obj, flow_manager,
+		uint64(len(second)+1))
+
+	// The buffer is full so the first item is dropped instead of
+	// blocking.
+	ring_buffer.Enqueue(first)
+	ring_buffer.Enqueue(second)
+
+	dropped_messages, dropped_bytes := ring_buffer.DropStats()
+	assert.Equal(t, uint64(1), dropped_messages)
+	assert.Equal(t, uint64(len(first)), dropped_bytes)
+	assert.Equal(t, uint64(len(second)), ring_buffer.TotalSize())
+	assert.Equal(t, second, ring_buffer.Lease(1000))
+}
+
+func TestFileRingBufferOverflow(t *testing.T) {
+	PREPARE_FOR_TESTS = true
+
+	filename := getTempFile(t)
+	defer os.Remove(filename)
+
+	event := makeItem(t, constants.MONITORING_WELL_KNOWN_FLOW, "event", false)
+	result := makeItem(t, "F.1234", "result", false)
+
+	config_obj := config.GetDefaultConfig()
+	config_obj.Client.LocalBuffer.OverflowPolicy = OVERFLOW_DROP_LOWEST_PRIORITY
+	config_obj.Client.LocalBuffer.DiskSize = uint64(len(event) + len(result) + 16)
+
+	null_logger, _ := test.NewNullLogger()
+	logger := &logging.LogContext{Logger: null_logger}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	flow_manager := responder.NewFlowManager(ctx, config_obj)
+	ring_buffer, err := NewFileBasedRingBuffer(ctx, config_obj,
+		filename, flow_manager, logger)
+	assert.NoError(t, err)
+	defer ring_buffer.Close()
+
+	// The third item overflows the buffer so the event is dropped
+	// and the file compacted.
+	ring_buffer.Enqueue(event)
+	ring_buffer.Enqueue(result)
+	ring_buffer.Enqueue(result)
+
+	dropped_messages, dropped_bytes := ring_buffer.DropStats()
+	assert.Equal(t, uint64(1), dropped_messages)
+	assert.Equal(t, uint64(len(event)), dropped_bytes)
+	assert.Equal(t, uint64(2*len(result)), ring_buffer.TotalSize())
+
+	lease := ring_buffer.Lease(1000)
+	assert.Equal(t, append(append([]byte{}, result...), result...), lease)
+}
@@ -0,0 +1,116 @@
+package http_comms
+
+import (
+	"time"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+)
+
+var (
+	// How long to stay on a frontend in another region before
+	// trying the local frontends again.
+	failbackInterval = 10 * time.Minute
+)
+
+// Order the urls so that frontends in the client's own region come
+// first, followed by frontends in other regions. Within each region
+// the urls are shuffled with a probability proportional to their
+// weight, so clients are spread over the frontends according to
+// their capacity. The connector tries the urls in order so it only
+// fails over to remote regions when no local frontend is reachable.
+//
+// Returns the ordered urls and the number of local urls at the
+// front of the list.
+func orderServerUrls(
+	client_config *config_proto.ClientConfig, urls []string) ([]string, int) {
+
+	weights := make(map[string]int)
+	regions := make(map[string]string)
+	for _, pref := range client_config.ServerUrlPreferences {
+		weights[pref.Url] = int(pref.Weight)
+		regions[pref.Url] = pref.Region
+	}
+
+	var local, remote []string
+	for _, url := range urls {
+		region := regions[url]
+		if client_config.Region == "" || region == "" ||
+			region == client_config.Region {
+			local = append(local, url)
+		} else {
+			remote = append(remote, url)
+		}
+	}
+
+	result := weightedShuffle(local, weights)
+	result = append(result, weightedShuffle(remote, weights)...)
+
+	return result, len(local)
+}
+
+func weightedShuffle(urls []string, weights map[string]int) []string {
+	weight := func(url string) int {
+		w := weights[url]
+		if w <= 0 {
+			return 1
+		}
+		return w
+	}
+
+	remaining := append([]string{}, urls...)
+	result := make([]string, 0, len(urls))
+	rand := GetRand()
+
+	for len(remaining) > 0 {
+		total := 0
+		for _, url := range remaining {
+			total += weight(url)
+		}
+
+		// Pick the next url with a probability proportional to its
+		// weight.
+		pick := rand(total)
+		idx := len(remaining) - 1
+		for i, url := range remaining {
+			pick -= weight(url)
+			if pick < 0 {
+				idx = i
+				break
+			}
+		}
+
+		result = append(result, remaining[idx])
+		remaining = append(remaining[:idx], remaining[idx+1:]...)
+	}
+
+	return result
+}
+
+// Called with the lock held after a successful request. When we
+// failed over to a frontend in another region we periodically go
+// back to the local frontends in case they became available again.
+func (self *HTTPConnector) maybeFailback() {
+	if self.local_urls == 0 || self.current_url_idx < self.local_urls {
+		self.failback_time = time.Time{}
+		return
+	}
+
+	now := self.clock.Now()
+	if self.failback_time.IsZero() {
+		self.failback_time = now.Add(failbackInterval)
+		return
+	}
+
+	if now.Before(self.failback_time) {
+		return
+	}
+
+	self.logger.Info("HTTPConnector: Retrying local frontend %v",
+		self.urls[0])
+
+	self.failback_time = time.Time{}
+	self.current_url_idx = 0
+	self.last_success_idx = 0
+	self.redirect_to_server = 0
+	self.server_name = ""
+}
@@ -0,0 +1,59 @@
+package http_comms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+)
+
+func TestOrderServerUrls(t *testing.T) {
+	mu.Lock()
+	old_rand := Rand
+	Rand = func(int) int { return 0 }
+	mu.Unlock()
+
+	defer func() {
+		mu.Lock()
+		Rand = old_rand
+		mu.Unlock()
+	}()
+
+	urls := []string{
+		"https://us1/", "https://eu1/", "https://eu2/", "https://other/",
+	}
+
+	client_config := &config_proto.ClientConfig{
+		Region: "eu",
+		ServerUrlPreferences: []*config_proto.ServerUrlPreference{
+			{Url: "https://us1/", Region: "us", Weight: 10},
+			{Url: "https://eu1/", Region: "eu", Weight: 1},
+			{Url: "https://eu2/", Region: "eu", Weight: 5},
+		},
+	}
+
+	// Local urls come first, urls without a region are considered
+	// local. The remote region is only used last.
+	ordered, local := orderServerUrls(client_config, urls)
+	assert.Equal(t, 3, local)
+	assert.Equal(t, "https://us1/", ordered[3])
+
+	// Within the region the first url is picked when rand returns 0.
+	assert.Equal(t, []string{
+		"https://eu1/", "https://eu2/", "https://other/"}, ordered[:3])
+
+	// The last pick falls on the heaviest url in the region.
+	mu.Lock()
+	Rand = func(n int) int { return n - 1 }
+	mu.Unlock()
+
+	ordered, _ = orderServerUrls(client_config, urls)
+	assert.Equal(t, "https://other/", ordered[0])
+	assert.Equal(t, "https://eu2/", ordered[1])
+
+	// Without a client region all urls are local.
+	client_config.Region = ""
+	ordered, local = orderServerUrls(client_config, urls)
+	assert.Equal(t, 4, local)
+	assert.Equal(t, 4, len(ordered))
+}
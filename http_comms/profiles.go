@@ -0,0 +1,76 @@
+package http_comms
+
+import (
+	"context"
+	"net"
+	"time"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+var (
+	// Can be overridden in tests.
+	lookupHost = net.DefaultResolver.LookupHost
+)
+
+// Roaming clients (e.g. laptops) may need to use different frontends
+// when they are on premises and when they are remote. If an internal
+// URL set is configured, we probe for a host that only resolves on
+// the internal network to decide which set to use.
+func hasServerProfiles(client_config *config_proto.ClientConfig) bool {
+	return len(client_config.InternalServerUrls) > 0 &&
+		client_config.InternalProbeHost != ""
+}
+
+func selectServerUrls(
+	ctx context.Context,
+	client_config *config_proto.ClientConfig) []string {
+	if !hasServerProfiles(client_config) {
+		return client_config.ServerUrls
+	}
+
+	sub_ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	addrs, err := lookupHost(sub_ctx, client_config.InternalProbeHost)
+	if err == nil && len(addrs) > 0 {
+		return client_config.InternalServerUrls
+	}
+
+	return client_config.ServerUrls
+}
+
+// Called when none of the current servers are reachable. The client
+// may have moved between the internal and external networks so
+// switch to the other URL set if needed.
+func (self *HTTPConnector) maybeSwitchProfile(ctx context.Context) {
+	self.mu.Lock()
+	roaming := self.roaming
+	current := self.urls
+	self.mu.Unlock()
+
+	if !roaming {
+		return
+	}
+
+	urls := selectServerUrls(ctx, self.config_obj.Client)
+	if len(urls) > 0 && !sameUrlSet(urls, current) {
+		self.SetUrls(urls)
+	}
+}
+
+// The connector shuffles its urls so compare them regardless of
+// order.
+func sameUrlSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, url := range a {
+		if !utils.InString(b, url) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,239 @@
+package http_comms
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/logging"
+)
+
+const (
+	RELAY_USER = "velociraptor"
+
+	// Maximum number of neighbours tunneled at the same time.
+	MAX_RELAY_CONNECTIONS = 1000
+)
+
+// A client which can reach the frontend may relay connections for
+// neighbours in an isolated segment which can not. The relay is a
+// HTTP CONNECT proxy which only tunnels to the frontends in its own
+// config. The neighbour's TLS session terminates on the frontend and
+// messages are encrypted to the server's key so the relay can not
+// read or tamper with the traffic.
+//
+// Neighbours authenticate to the relay with a token derived from the
+// deployment nonce so the relay can not be used by outsiders.
+type relay struct {
+	ctx        context.Context
+	config_obj *config_proto.Config
+	token      string
+	allowed    map[string]bool
+	sem        chan bool
+	dialer     net.Dialer
+}
+
+// The token neighbours present to the relay. It is derived from the
+// nonce so the nonce itself is never sent over the wire.
+func RelayToken(nonce string) string {
+	hash := sha256.Sum256([]byte("velociraptor relay:" + nonce))
+	return hex.EncodeToString(hash[:])
+}
+
+// The proxy URL neighbours use to reach the frontend via the relay.
+func RelayProxyUrl(client_config *config_proto.ClientConfig) (*url.URL, error) {
+	relay_url := client_config.RelayUrl
+	if !strings.Contains(relay_url, "://") {
+		relay_url = "http://" + relay_url
+	}
+
+	result, err := url.Parse(relay_url)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Scheme != "http" {
+		return nil, errors.New("Relay URL must be a http URL: " + relay_url)
+	}
+
+	result.User = url.UserPassword(RELAY_USER, RelayToken(client_config.Nonce))
+	return result, nil
+}
+
+// Collect the host:port of all frontends the relay may tunnel to.
+func relayTargets(client_config *config_proto.ClientConfig) map[string]bool {
+	result := make(map[string]bool)
+	for _, urls := range [][]string{
+		client_config.ServerUrls, client_config.InternalServerUrls} {
+		for _, server_url := range urls {
+			parsed, err := url.Parse(server_url)
+			if err != nil {
+				continue
+			}
+
+			port := parsed.Port()
+			if port == "" {
+				switch parsed.Scheme {
+				case "http", "ws":
+					port = "80"
+				default:
+					port = "443"
+				}
+			}
+			result[net.JoinHostPort(parsed.Hostname(), port)] = true
+		}
+	}
+	return result
+}
+
+func (self *relay) authenticated(req *http.Request) bool {
+	auth := req.Header.Get("Proxy-Authorization")
+	encoded, ok := strings.CutPrefix(auth, "Basic ")
+	if !ok {
+		return false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+
+	user, password, ok := strings.Cut(string(decoded), ":")
+	return ok && user == RELAY_USER &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(self.token)) == 1
+}
+
+func (self *relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodConnect {
+		http.Error(w, "Only CONNECT is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !self.authenticated(req) {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="velociraptor"`)
+		http.Error(w, "Unauthorized", http.StatusProxyAuthRequired)
+		return
+	}
+
+	if !self.allowed[req.Host] {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	select {
+	case self.sem <- true:
+		defer func() { <-self.sem }()
+	default:
+		http.Error(w, "Too many connections", http.StatusServiceUnavailable)
+		return
+	}
+
+	upstream, err := self.dialer.DialContext(req.Context(), "tcp", req.Host)
+	if err != nil {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	if err != nil {
+		return
+	}
+
+	// Copy in both directions until either side closes.
+	done := make(chan bool, 2)
+	go func() {
+		_, _ = io.Copy(upstream, buf)
+		done <- true
+	}()
+
+	go func() {
+		_, _ = io.Copy(conn, upstream)
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-self.ctx.Done():
+	}
+}
+
+// Start relaying for neighbours if the client is configured to.
+func StartRelay(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	config_obj *config_proto.Config) error {
+	if config_obj.Client == nil || config_obj.Client.RelayListen == "" {
+		return nil
+	}
+
+	if config_obj.Client.Nonce == "" {
+		return errors.New("StartRelay: Client nonce is required for relaying")
+	}
+
+	self := &relay{
+		ctx:        ctx,
+		config_obj: config_obj,
+		token:      RelayToken(config_obj.Client.Nonce),
+		allowed:    relayTargets(config_obj.Client),
+		sem:        make(chan bool, MAX_RELAY_CONNECTIONS),
+		dialer:     net.Dialer{Timeout: 30 * time.Second},
+	}
+
+	listener, err := net.Listen("tcp", config_obj.Client.RelayListen)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Handler:           self,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.ClientComponent)
+	logger.Info("Relaying connections for neighbours on <green>%v</>",
+		listener.Addr())
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			logger.Error("StartRelay: %v", err)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package http_comms
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+)
+
+func relayGet(t *testing.T, proxy_url *url.URL, target string) (string, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyURL(proxy_url),
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+
+	resp, err := client.Get(target)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	return string(data), err
+}
+
+func TestRelay(t *testing.T) {
+	frontend := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("hello from frontend"))
+		}))
+	defer frontend.Close()
+
+	other := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("should not be reachable"))
+		}))
+	defer other.Close()
+
+	client_config := &config_proto.ClientConfig{
+		Nonce:      "Test Nonce",
+		ServerUrls: []string{frontend.URL + "/"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	relay_server := httptest.NewServer(&relay{
+		ctx:     ctx,
+		token:   RelayToken(client_config.Nonce),
+		allowed: relayTargets(client_config),
+		sem:     make(chan bool, 1),
+	})
+	defer relay_server.Close()
+
+	client_config.RelayUrl = relay_server.URL
+	proxy_url, err := RelayProxyUrl(client_config)
+	require.NoError(t, err)
+
+	// The frontend is reachable through the relay.
+	data, err := relayGet(t, proxy_url, frontend.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello from frontend", data)
+
+	// Other hosts are not.
+	_, err = relayGet(t, proxy_url, other.URL)
+	assert.Error(t, err)
+
+	// Neighbours from a different deployment are rejected.
+	bad_url := *proxy_url
+	bad_url.User = url.UserPassword(RELAY_USER, RelayToken("Other Nonce"))
+	_, err = relayGet(t, &bad_url, frontend.URL)
+	assert.Error(t, err)
+}
@@ -47,6 +47,10 @@ type IRingBuffer interface {
 	// AvailableBytes and LeasedBytes
 	TotalSize() uint64
 
+	// How many messages and bytes were dropped because the buffer
+	// was full.
+	DropStats() (uint64, uint64)
+
 	Commit()
 	Reset()
 	Close()
@@ -120,6 +124,10 @@ type FileBasedRingBuffer struct {
 	log_ctx *logging.LogContext
 
 	flow_manager *responder.FlowManager
+
+	overflow_policy  string
+	dropped_messages uint64
+	dropped_bytes    uint64
 }
 
 func (self *FileBasedRingBuffer) Enqueue(item []byte) {
@@ -165,10 +173,116 @@ func (self *FileBasedRingBuffer) Enqueue(item []byte) {
 	// effect of blocking the executor and stopping the query
 	// until we return.
 	for self.header.WritePointer > self.header.MaxSize && !self.closed {
+		if self._dropOverflow() {
+			continue
+		}
 		self.c.Wait()
 	}
 }
 
+func (self *FileBasedRingBuffer) DropStats() (uint64, uint64) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.dropped_messages, self.dropped_bytes
+}
+
+// Apply the overflow policy by dropping records and compacting the
+// file. Records are only moved when nothing is leased, otherwise we
+// wait for the lease to be committed. Returns true if any records
+// were dropped. Assumes FileBasedRingBuffer is already under lock.
+func (self *FileBasedRingBuffer) _dropOverflow() bool {
+	if self.overflow_policy == OVERFLOW_BLOCK_PRODUCERS ||
+		self.leased_pointer != self.header.ReadPointer {
+		return false
+	}
+
+	items, err := self._readRecords(
+		self.header.ReadPointer, self.header.WritePointer)
+	if err != nil {
+		return false
+	}
+
+	excess := uint64(self.header.WritePointer - self.header.MaxSize)
+	drops := selectDrops(self.overflow_policy, items, excess, 8)
+	if drops == nil {
+		return false
+	}
+
+	// Records only ever move towards the start of the file so we
+	// can rewrite them in place.
+	offset := int64(FirstRecordOffset)
+	available := int64(0)
+	for idx, item := range items {
+		if drops[idx] {
+			self.dropped_messages++
+			self.dropped_bytes += uint64(len(item))
+			continue
+		}
+
+		binary.LittleEndian.PutUint64(self.write_buf, uint64(len(item)))
+		_, err := self.fd.WriteAt(self.write_buf, offset)
+		if err != nil {
+			self._Truncate()
+			return true
+		}
+		_, err = self.fd.WriteAt(item, offset+8)
+		if err != nil {
+			self._Truncate()
+			return true
+		}
+		offset += 8 + int64(len(item))
+		available += int64(len(item))
+	}
+
+	_ = self.fd.Truncate(offset)
+	self.header.ReadPointer = FirstRecordOffset
+	self.header.WritePointer = offset
+	self.header.AvailableBytes = available
+	self.header.LeasedBytes = 0
+	self.leased_pointer = FirstRecordOffset
+
+	serialized, _ := self.header.MarshalBinary()
+	_, _ = self.fd.WriteAt(serialized, 0)
+
+	self.log_ctx.WithFields(logrus.Fields{
+		"policy":           self.overflow_policy,
+		"dropped_messages": self.dropped_messages,
+		"dropped_bytes":    self.dropped_bytes,
+	}).Info("File Ring Buffer: Buffer full - dropped data")
+
+	return true
+}
+
+// Read all the records between the offsets. Assumes
+// FileBasedRingBuffer is already under lock.
+func (self *FileBasedRingBuffer) _readRecords(start, end int64) ([][]byte, error) {
+	var result [][]byte
+
+	for offset := start; offset < end; {
+		_, err := self.fd.ReadAt(self.read_buf, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		length := int64(binary.LittleEndian.Uint64(self.read_buf))
+		if length > constants.MAX_MEMORY*2 || length <= 0 {
+			return nil, errors.New("Invalid record length")
+		}
+
+		item := make([]byte, length)
+		_, err = self.fd.ReadAt(item, offset+8)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, item)
+		offset += 8 + length
+	}
+
+	return result, nil
+}
+
 func (self *FileBasedRingBuffer) TotalSize() uint64 {
 	self.mu.Lock()
 	defer self.mu.Unlock()
@@ -223,18 +337,19 @@ func (self *FileBasedRingBuffer) Lease(size uint64) []byte {
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
-	result := []byte{}
+	var result []byte
 
 	for self.header.WritePointer > self.leased_pointer {
 		n, err := self.fd.ReadAt(self.read_buf, self.leased_pointer)
 		if err == nil && n == len(self.read_buf) {
 			length := int64(binary.LittleEndian.Uint64(self.read_buf))
 
-			// File might be corrupt - just reset the entire file.
+			// File might be corrupt - drop this and all following
+			// records but still deliver what we have.
 			if length > constants.MAX_MEMORY*2 || length <= 0 {
 				self.log_ctx.Error("Possible corruption detected - item length is too large.")
-				self._Truncate()
-				return nil
+				self._DiscardFrom(self.leased_pointer)
+				return result
 			}
 			item := make([]byte, length)
 			n, err := self.fd.ReadAt(item, self.leased_pointer+8)
@@ -242,8 +357,8 @@ func (self *FileBasedRingBuffer) Lease(size uint64) []byte {
 				self.log_ctx.Errorf(
 					"Possible corruption detected - expected item of length %v received %v.",
 					length, n)
-				self._Truncate()
-				return nil
+				self._DiscardFrom(self.leased_pointer)
+				return result
 			}
 
 			// Filter the item from any blacklisted flow ids
@@ -263,13 +378,77 @@ func (self *FileBasedRingBuffer) Lease(size uint64) []byte {
 
 		} else {
 			self.log_ctx.Error("Possible corruption detected: file too short.")
-			self._Truncate()
+			self._DiscardFrom(self.leased_pointer)
+			return result
 		}
 	}
 
 	return result
 }
 
+// _DiscardFrom drops all records starting at offset. Records before
+// the offset are still valid and will be delivered. Assumes
+// FileBasedRingBuffer is already under lock.
+func (self *FileBasedRingBuffer) _DiscardFrom(offset int64) {
+	if offset <= self.header.ReadPointer {
+		self._Truncate()
+		return
+	}
+
+	_ = self.fd.Truncate(offset)
+	self.header.WritePointer = offset
+	self.header.AvailableBytes = 0
+
+	serialized, _ := self.header.MarshalBinary()
+	_, _ = self.fd.WriteAt(serialized, 0)
+
+	self.c.Broadcast()
+}
+
+// Walk the records that are not yet committed and drop any trailing
+// records which were only partially written when the client
+// crashed. Returns the offset after the last valid record and the
+// number of payload bytes before it.
+func validateRecords(fd *os.File, header *Header,
+	log_ctx *logging.LogContext) (int64, int64) {
+
+	st, err := fd.Stat()
+	if err != nil {
+		return header.ReadPointer, 0
+	}
+
+	file_size := st.Size()
+	buf := make([]byte, 8)
+	offset := header.ReadPointer
+	total := int64(0)
+
+	for offset < header.WritePointer {
+		n, err := fd.ReadAt(buf, offset)
+		if err != nil || n != len(buf) {
+			log_ctx.Error("Possible corruption detected: file too short.")
+			break
+		}
+
+		length := int64(binary.LittleEndian.Uint64(buf))
+		if length > constants.MAX_MEMORY*2 || length <= 0 {
+			log_ctx.Error("Possible corruption detected - item length is too large.")
+			break
+		}
+
+		if offset+8+length > file_size {
+			log_ctx.Errorf(
+				"Possible corruption detected - expected item of length %v received %v.",
+				length, file_size-offset-8)
+			break
+		}
+
+		offset += 8 + length
+		total += length
+	}
+
+	return offset, total
+}
+
 // _Truncate returns the file to a virgin state. Assumes
 // FileBasedRingBuffer is already under lock.
 func (self *FileBasedRingBuffer) _Truncate() {
@@ -326,6 +505,9 @@ func (self *FileBasedRingBuffer) Commit() {
 	serialized, _ := self.header.MarshalBinary()
 	_, _ = self.fd.WriteAt(serialized, 0)
 
+	// Blocked writers may now be able to drop records.
+	self.c.Broadcast()
+
 	logger.WithFields(logrus.Fields{
 		"header": json.MustMarshalString(self.header),
 	}).Info("File Ring Buffer: Commit")
@@ -419,15 +601,41 @@ func newFileBasedRingBuffer(
 		header.LeasedBytes = 0
 	}
 
+	// If we crashed while writing a record, the header may point
+	// past the end of the valid data. Drop the partial record but
+	// keep everything before it.
+	if header.WritePointer > header.ReadPointer {
+		valid_pointer, available := validateRecords(fd, header, log_ctx)
+		if valid_pointer != header.WritePointer {
+			if valid_pointer <= header.ReadPointer {
+				header.ReadPointer = FirstRecordOffset
+				valid_pointer = FirstRecordOffset
+			}
+			header.WritePointer = valid_pointer
+			header.AvailableBytes = available
+
+			err = fd.Truncate(valid_pointer)
+			if err != nil {
+				return nil, err
+			}
+			serialized, _ := header.MarshalBinary()
+			_, err = fd.WriteAt(serialized, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	result := &FileBasedRingBuffer{
-		config_obj:     config_obj,
-		fd:             fd,
-		header:         header,
-		read_buf:       make([]byte, 8),
-		write_buf:      make([]byte, 8),
-		leased_pointer: header.ReadPointer,
-		log_ctx:        log_ctx,
-		flow_manager:   flow_manager,
+		config_obj:      config_obj,
+		fd:              fd,
+		header:          header,
+		read_buf:        make([]byte, 8),
+		write_buf:       make([]byte, 8),
+		leased_pointer:  header.ReadPointer,
+		log_ctx:         log_ctx,
+		flow_manager:    flow_manager,
+		overflow_policy: getOverflowPolicy(config_obj),
 	}
 
 	result.c = sync.NewCond(&result.mu)
@@ -466,6 +674,10 @@ type RingBuffer struct {
 	Size uint64
 
 	flow_manager *responder.FlowManager
+
+	overflow_policy  string
+	dropped_messages uint64
+	dropped_bytes    uint64
 }
 
 func (self *RingBuffer) Reset() {
@@ -504,10 +716,58 @@ func (self *RingBuffer) Enqueue(item []byte) {
 	// effect of blocking the executor and stopping the query
 	// until we return.
 	for self.total_length > self.Size && !self.closed {
+		if self.dropOverflow() {
+			continue
+		}
 		self.c.Wait()
 	}
 }
 
+func (self *RingBuffer) DropStats() (uint64, uint64) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.dropped_messages, self.dropped_bytes
+}
+
+// Apply the overflow policy to the messages which are not leased.
+// Returns true if any messages were dropped. Assumes RingBuffer is
+// already under lock.
+func (self *RingBuffer) dropOverflow() bool {
+	if self.overflow_policy == OVERFLOW_BLOCK_PRODUCERS {
+		return false
+	}
+
+	candidates := self.messages[self.leased_idx:]
+	drops := selectDrops(self.overflow_policy, candidates,
+		self.total_length-self.Size, 0)
+	if drops == nil {
+		return false
+	}
+
+	kept := make([][]byte, 0, len(self.messages))
+	kept = append(kept, self.messages[:self.leased_idx]...)
+	for idx, item := range candidates {
+		if drops[idx] {
+			self.dropped_messages++
+			self.dropped_bytes += uint64(len(item))
+			self.total_length -= uint64(len(item))
+			continue
+		}
+		kept = append(kept, item)
+	}
+	self.messages = kept
+
+	logger := logging.GetLogger(self.config_obj, &logging.ClientComponent)
+	logger.WithFields(logrus.Fields{
+		"policy":           self.overflow_policy,
+		"dropped_messages": self.dropped_messages,
+		"dropped_bytes":    self.dropped_bytes,
+	}).Info("Ring Buffer: Buffer full - dropped data")
+
+	return true
+}
+
 func (self *RingBuffer) TotalSize() uint64 {
 	self.mu.Lock()
 	defer self.mu.Unlock()
@@ -661,10 +921,11 @@ func (self *RingBuffer) Commit() {
 func NewRingBuffer(config_obj *config_proto.Config,
 	flow_manager *responder.FlowManager, size uint64) *RingBuffer {
 	result := &RingBuffer{
-		messages:     make([][]byte, 0),
-		Size:         size,
-		config_obj:   config_obj,
-		flow_manager: flow_manager,
+		messages:        make([][]byte, 0),
+		Size:            size,
+		config_obj:      config_obj,
+		flow_manager:    flow_manager,
+		overflow_policy: getOverflowPolicy(config_obj),
 	}
 	result.c = sync.NewCond(&result.mu)
 
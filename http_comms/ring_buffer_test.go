@@ -297,6 +297,64 @@ func TestRingBufferCorruption(t *testing.T) {
 	assert.Equal(t, int64(FirstRecordOffset), ring_buffer.header.WritePointer)
 }
 
+// A crash while writing a record should only lose that record - all
+// previously queued records are still delivered.
+func TestRingBufferPartialWrite(t *testing.T) {
+	PREPARE_FOR_TESTS = true
+
+	filename := getTempFile(t)
+	test_string := "Hello"    // 5 bytes
+	test_string2 := "Goodbye" // 7 bytes
+
+	defer os.Remove(filename)
+
+	ring_buffer, flow_manager := createRB(t, filename)
+	ring_buffer.Enqueue([]byte(test_string))
+	ring_buffer.Enqueue([]byte(test_string2))
+
+	// Simulate a torn write by chopping the end of the last record.
+	second_record := int64(FirstRecordOffset + 8 + len(test_string))
+	err := os.Truncate(filename, second_record+8+3)
+	assert.NoError(t, err)
+
+	ring_buffer = openRB(t, filename, flow_manager)
+	assert.Equal(t, true, checkLogMessage(hook,
+		"Possible corruption detected - expected item of length 7 received 3."))
+
+	// Only the first record is available.
+	assert.Equal(t, int64(len(test_string)), ring_buffer.header.AvailableBytes)
+	assert.Equal(t, second_record, ring_buffer.header.WritePointer)
+
+	st, err := os.Stat(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, second_record, st.Size())
+
+	// New records are appended after the valid data.
+	ring_buffer.Enqueue([]byte(test_string2))
+
+	// Corrupt the new record after the file was opened - leasing
+	// still delivers the first record.
+	fd, err := os.OpenFile(filename, os.O_RDWR, 0700)
+	assert.NoError(t, err)
+	_, err = fd.WriteAt([]byte{20, 0, 0, 0xff, 0xff, 0, 0, 0}, second_record)
+	assert.NoError(t, err)
+	fd.Close()
+
+	lease := ring_buffer.Lease(100)
+	assert.Equal(t, []byte(test_string), lease)
+	assert.Equal(t, true, checkLogMessage(hook,
+		"Possible corruption detected - item length is too large."))
+
+	assert.Equal(t, int64(0), ring_buffer.header.AvailableBytes)
+	assert.Equal(t, int64(len(test_string)), ring_buffer.header.LeasedBytes)
+
+	ring_buffer.Commit()
+
+	st, err = os.Stat(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(FirstRecordOffset), st.Size())
+}
+
 func checkLogMessage(hook *test.Hook, msg string) bool {
 	defer hook.Reset()
 
@@ -28,7 +28,6 @@ import (
 	"context"
 	"sync"
 	"sync/atomic"
-	"time"
 
 	"github.com/go-errors/errors"
 	"golang.org/x/time/rate"
@@ -36,6 +35,7 @@ import (
 	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
 	"www.velocidex.com/golang/velociraptor/crypto"
 	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/crypto/recorder"
 	"www.velocidex.com/golang/velociraptor/executor"
 	"www.velocidex.com/golang/velociraptor/logging"
 	"www.velocidex.com/golang/velociraptor/utils"
@@ -59,6 +59,9 @@ type Sender struct {
 	// An in-memory ring buffer for urgent packets.
 	urgent_buffer *RingBuffer
 
+	// During blackout windows only urgent messages are sent.
+	blackout *executor.BlackoutSchedule
+
 	clock utils.Clock
 }
 
@@ -97,7 +100,7 @@ func (self *Sender) PumpExecutorToRingBuffer(ctx context.Context) {
 
 			// Keep the nanny alive to ensure we are still inside this
 			// loop.
-		case <-time.After(self.maxPoll):
+		case <-self.clock.After(self.maxPoll):
 			continue
 
 		case msg, ok := <-executor_chan:
@@ -106,6 +109,10 @@ func (self *Sender) PumpExecutorToRingBuffer(ctx context.Context) {
 				return
 			}
 
+			recorder.GetRecorder(self.config_obj.Client.CommsRecordingPath).
+				Record(recorder.SENT, "", &crypto_proto.MessageList{
+					Job: []*crypto_proto.VeloMessage{msg}})
+
 			if msg.Urgent {
 				// Urgent messages are queued in
 				// memory and dispatched separately.
@@ -119,6 +126,8 @@ func (self *Sender) PumpExecutorToRingBuffer(ctx context.Context) {
 					continue
 				}
 				self.urgent_buffer.Enqueue(serialized_msg)
+				self.executor.FlowManager().RecordBytesSent(
+					msg.SessionId, uint64(len(serialized_msg)))
 
 			} else {
 				// NOTE: This is kind of a hack. We hold in
@@ -146,6 +155,8 @@ func (self *Sender) PumpExecutorToRingBuffer(ctx context.Context) {
 				// no room in the ring buffer. While waiting
 				// here we block the executor channel.
 				self.ring_buffer.Enqueue(serialized_msg)
+				self.executor.FlowManager().RecordBytesSent(
+					msg.SessionId, uint64(len(serialized_msg)))
 			}
 
 			// We have just filled the message queue with
@@ -195,8 +206,11 @@ func (self *Sender) PumpRingBufferToSendMessage(ctx context.Context) {
 			}
 
 			// Grab some messages from the ring buffer.
-			compressed_messages = LeaseAndCompress(self.ring_buffer,
-				self.config_obj.Client.MaxUploadSize, compression)
+			compressed_messages = nil
+			if !self.shouldDeferResults() {
+				compressed_messages = LeaseAndCompress(self.ring_buffer,
+					self.config_obj.Client.MaxUploadSize, compression)
+			}
 			if len(compressed_messages) > 0 {
 				// sendMessageList will block until the messages are
 				// successfully sent to the server. When it returns we
@@ -222,14 +236,45 @@ func (self *Sender) PumpRingBufferToSendMessage(ctx context.Context) {
 		case <-release:
 			continue
 
+			// A local event requested an immediate check-in.
+		case <-checkinRequested():
+			continue
+
 			// Wait a minimum amount of time to allow for
 			// responses to be queued in the same POST.
-		case <-self.clock.After(self.minPoll):
+		case <-self.clock.After(self.pollInterval()):
 			continue
 		}
 	}
 }
 
+// Regular messages may wait in the ring buffer for a better time to
+// send them. Urgent flows always deliver their results.
+func (self *Sender) shouldDeferResults() bool {
+	if self.executor.FlowManager().HasUrgentFlows() {
+		return false
+	}
+
+	// Wait until the blackout window ends.
+	if self.blackout.InBlackout() {
+		return true
+	}
+
+	// On battery power or metered connections we only send small
+	// amounts of data. Results are sent immediately while fast
+	// polling.
+	if !executor.IsFastPolling() &&
+		executor.IsResourceConstrained(self.config_obj) {
+		max_upload := self.config_obj.Client.LaptopModeMaxUpload
+		if max_upload == 0 {
+			max_upload = 1024 * 1024
+		}
+		return self.ring_buffer.AvailableBytes() > max_upload
+	}
+
+	return false
+}
+
 // The sender simply sends any server bound messages to the server. We
 // only send messages when responses are pending.
 func (self *Sender) Start(
@@ -255,6 +300,12 @@ func (self *Sender) Start(
 	}()
 }
 
+func newBlackoutSchedule(
+	config_obj *config_proto.Config,
+	clock utils.Clock) (*executor.BlackoutSchedule, error) {
+	return executor.NewBlackoutSchedule(config_obj.Client.BlackoutWindows, clock)
+}
+
 func NewSender(
 	config_obj *config_proto.Config,
 	connector IConnector,
@@ -273,6 +324,9 @@ func NewSender(
 		return nil, errors.New("Client not configured")
 	}
 
+	// Invalid schedules are reported by the executor.
+	blackout, _ := newBlackoutSchedule(config_obj, clock)
+
 	result := &Sender{
 		NotificationReader: NewNotificationReader(
 			config_obj, connector, crypto_manager,
@@ -285,8 +339,9 @@ func NewSender(
 		// skip the buffer ahead of normal queries.
 		urgent_buffer: NewRingBuffer(config_obj, executor.FlowManager(),
 			2*config_obj.Client.MaxUploadSize),
-		release: make(chan bool),
-		clock:   clock,
+		release:  make(chan bool),
+		clock:    clock,
+		blackout: blackout,
 	}
 
 	return result, nil
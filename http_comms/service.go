@@ -19,6 +19,20 @@ func StartHttpCommunicatorService(
 	exe executor.Executor,
 	on_error func(ctx context.Context, config_obj *config_proto.Config)) (
 	*HTTPCommunicator, error) {
+	return StartHttpCommunicatorServiceWithClock(
+		ctx, wg, config_obj, exe, on_error, utils.RealClock{})
+}
+
+// Start the communicator using the clock for all poll and backoff
+// timing.
+func StartHttpCommunicatorServiceWithClock(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	config_obj *config_proto.Config,
+	exe executor.Executor,
+	on_error func(ctx context.Context, config_obj *config_proto.Config),
+	clock utils.Clock) (
+	*HTTPCommunicator, error) {
 
 	if config_obj.Client == nil {
 		return nil, nil
@@ -36,15 +50,22 @@ func StartHttpCommunicatorService(
 		return nil, err
 	}
 
+	// URLs pushed by the server take precedence over the config
+	// file.
+	urls := selectServerUrls(ctx, config_obj.Client)
+	if len(writeback.ServerUrls) > 0 {
+		urls = writeback.ServerUrls
+	}
+
 	// Now start the communicator so we can talk with the server.
 	comm, err := NewHTTPCommunicator(
 		ctx,
 		config_obj,
 		crypto_manager,
 		exe,
-		config_obj.Client.ServerUrls,
+		urls,
 		func() { on_error(ctx, config_obj) },
-		utils.RealClock{},
+		clock,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("Can not create HTTPCommunicator: %w", err)
@@ -57,5 +78,10 @@ func StartHttpCommunicatorService(
 		comm.Run(ctx, wg)
 	}()
 
+	err = StartRelay(ctx, wg, config_obj)
+	if err != nil {
+		return nil, fmt.Errorf("Can not start relay: %w", err)
+	}
+
 	return comm, nil
 }
@@ -0,0 +1,92 @@
+package http_comms
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+var (
+	// All the connectors currently running in this process. The
+	// server may push new URLs to the client which are applied to
+	// all of them.
+	connectors_mu sync.Mutex
+	connectors    = make(map[*HTTPConnector]bool)
+)
+
+func registerConnector(ctx context.Context, connector *HTTPConnector) {
+	connectors_mu.Lock()
+	connectors[connector] = true
+	connectors_mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		connectors_mu.Lock()
+		delete(connectors, connector)
+		connectors_mu.Unlock()
+	}()
+}
+
+// Make sure the urls are suitable for the connector.
+func ValidateServerUrls(urls []string) error {
+	if len(urls) == 0 {
+		return errors.New("No server URLs provided")
+	}
+
+	for _, url := range urls {
+		if !strings.HasSuffix(url, "/") {
+			return errors.New("Server URL must end with a /: " + url)
+		}
+
+		if !strings.HasPrefix(url, "https://") &&
+			!strings.HasPrefix(url, "http://") &&
+			!strings.HasPrefix(url, "wss://") &&
+			!strings.HasPrefix(url, "ws://") {
+			return errors.New("Unsupported scheme for server URL: " + url)
+		}
+	}
+	return nil
+}
+
+// Switch all running connectors to the new set of URLs.
+func UpdateServerUrls(urls []string) error {
+	err := ValidateServerUrls(urls)
+	if err != nil {
+		return err
+	}
+
+	connectors_mu.Lock()
+	defer connectors_mu.Unlock()
+
+	for connector := range connectors {
+		// URLs pushed by the server override any profiles.
+		connector.mu.Lock()
+		connector.roaming = false
+		connector.mu.Unlock()
+
+		connector.SetUrls(urls)
+	}
+	return nil
+}
+
+// Replace the URL list atomically. Requests already in flight
+// complete against the old URL, but all new requests go to the new
+// list. The new server must present a valid certificate before we
+// send it any messages so we force a rekey.
+func (self *HTTPConnector) SetUrls(urls []string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.urls, self.local_urls = orderServerUrls(self.config_obj.Client, urls)
+	self.current_url_idx = 0
+	self.last_success_idx = 0
+	self.failback_time = time.Time{}
+	self.redirect_to_server = 0
+	self.server_name = ""
+
+	self.logger.Info("HTTPConnector: Switching to new server URLs %v", self.urls)
+}
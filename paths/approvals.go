@@ -0,0 +1,15 @@
+package paths
+
+import "www.velocidex.com/golang/velociraptor/file_store/api"
+
+// Approvals authorize a single collection of an artifact which
+// requires dual authorization.
+func ApprovalPath(approval_id string) api.DSPathSpec {
+	return APPROVALS_ROOT.AddChild(approval_id).SetTag("Approval")
+}
+
+// Reviews record that a custom artifact definition was reviewed
+// before it may be hunted.
+func ArtifactReviewPath(name string) api.DSPathSpec {
+	return ARTIFACT_REVIEWS_ROOT.AddChild(name).SetTag("ArtifactReview")
+}
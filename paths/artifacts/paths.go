@@ -253,19 +253,45 @@ func (self *ArtifactPathManager) get_event_files(path_for_writing api.FSPathSpec
 		return nil, err
 	}
 	result := make([]*api.ResultSetFileProperties, 0, len(children))
-	for _, child := range children {
-		// We only want to see the JSON files
-		if child.PathSpec().Type() != api.PATH_TYPE_FILESTORE_JSON {
-			continue
+
+	// Older days may have moved to the warm or cold storage
+	// tiers. While a day is being moved it may appear in two tiers
+	// - prefer the more recent tier.
+	days := make(map[time.Time]bool)
+	add_files := func(children []api.FileInfo,
+		file_type api.PathType, file_store_factory api.FileStore) {
+		for _, child := range children {
+			if child.PathSpec().Type() != file_type {
+				continue
+			}
+
+			timestamp := DayNameToTimestamp(child.Name())
+			if !timestamp.IsZero() {
+				if days[timestamp] {
+					continue
+				}
+				days[timestamp] = true
+			}
+
+			result = append(result, &api.ResultSetFileProperties{
+				Path:      child.PathSpec(),
+				StartTime: timestamp,
+				EndTime:   timestamp.Add(24 * time.Hour),
+				Size:      child.Size(),
+				FileStore: file_store_factory,
+			})
 		}
+	}
+
+	add_files(children, api.PATH_TYPE_FILESTORE_JSON, nil)
+	add_files(children, api.PATH_TYPE_FILESTORE_COLUMNS, nil)
 
-		timestamp := DayNameToTimestamp(child.Name())
-		result = append(result, &api.ResultSetFileProperties{
-			Path:      child.PathSpec(),
-			StartTime: timestamp,
-			EndTime:   timestamp.Add(24 * time.Hour),
-			Size:      child.Size(),
-		})
+	cold_store := file_store.GetColdFileStore(self.config_obj)
+	if cold_store != nil {
+		cold_children, err := cold_store.ListDirectory(dir_name)
+		if err == nil {
+			add_files(cold_children, api.PATH_TYPE_FILESTORE_COLUMNS, cold_store)
+		}
 	}
 
 	sort.Slice(result, func(i, j int) bool {
@@ -0,0 +1,9 @@
+package paths
+
+import "www.velocidex.com/golang/velociraptor/file_store/api"
+
+// The client which last enrolled with this SMBIOS UUID.
+func AttestationIndexPath(smbios_uuid string) api.DSPathSpec {
+	return ATTESTATION_INDEX_ROOT.AddChild("smbios_uuid", smbios_uuid).
+		SetTag("AttestationIndex")
+}
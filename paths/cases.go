@@ -0,0 +1,9 @@
+package paths
+
+import "www.velocidex.com/golang/velociraptor/file_store/api"
+
+// Where we store the case record. Cases are stored in the org they
+// belong to.
+func CasePath(case_id string) api.DSPathSpec {
+	return CASES_ROOT.AddChild(case_id).SetTag("Case")
+}
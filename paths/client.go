@@ -52,12 +52,26 @@ func (self ClientPathManager) Metadata() api.DSPathSpec {
 		SetType(api.PATH_TYPE_DATASTORE_JSON)
 }
 
+// Analyst tags and notes about the client.
+func (self ClientPathManager) Annotations() api.FSPathSpec {
+	return self.root.AddChild("annotations").AsFilestorePath().
+		SetType(api.PATH_TYPE_FILESTORE_JSON).
+		SetTag("ClientAnnotations")
+}
+
 // Store each client's public key so we can communicate with it.
 func (self ClientPathManager) Key() api.DSPathSpec {
 	return self.root.AddChild("key").
 		SetTag("ClientKey")
 }
 
+// The machine attestation report the client last enrolled with.
+func (self ClientPathManager) Attestation() api.DSPathSpec {
+	return self.root.AddChild("attestation").
+		SetType(api.PATH_TYPE_DATASTORE_JSON).
+		SetTag("ClientAttestation")
+}
+
 // Queue tasks for the client in a directory within the client's main directory.
 func (self ClientPathManager) TasksDirectory() api.DSPathSpec {
 	return self.root.AddChild("tasks").
@@ -70,6 +84,13 @@ func (self ClientPathManager) Task(task_id uint64) api.DSPathSpec {
 		SetTag("ClientTask")
 }
 
+// Records that a group task was already scheduled on this client.
+func (self ClientPathManager) GroupTask(task_id string) api.DSPathSpec {
+	return self.root.AddChild("group_tasks", task_id).
+		SetType(api.PATH_TYPE_DATASTORE_JSON).
+		SetTag("ClientGroupTask")
+}
+
 func (self ClientPathManager) Flow(flow_id string) *FlowPathManager {
 	return NewFlowPathManager(self.client_id, flow_id)
 }
@@ -53,6 +53,37 @@ var (
 	ACL_ROOT = path_specs.NewUnsafeDatastorePath("acl").
 			SetType(api.PATH_TYPE_DATASTORE_JSON)
 
+	API_KEYS_ROOT = path_specs.NewSafeDatastorePath("api_keys").
+			SetType(api.PATH_TYPE_DATASTORE_JSON)
+
+	CASES_ROOT = path_specs.NewSafeDatastorePath("cases").
+			SetType(api.PATH_TYPE_DATASTORE_JSON)
+
+	GROUP_TASKS_ROOT = path_specs.NewSafeDatastorePath("group_tasks").
+				SetType(api.PATH_TYPE_DATASTORE_JSON)
+
+	WATCH_LIST_ROOT = path_specs.NewSafeDatastorePath("watch_list").
+			SetType(api.PATH_TYPE_DATASTORE_JSON)
+
+	APPROVALS_ROOT = path_specs.NewSafeDatastorePath("approvals").
+			SetType(api.PATH_TYPE_DATASTORE_JSON)
+
+	ARTIFACT_REVIEWS_ROOT = path_specs.NewSafeDatastorePath("artifact_reviews").
+				SetType(api.PATH_TYPE_DATASTORE_JSON)
+
+	DARK_DATA_ROOT = path_specs.NewSafeDatastorePath("dark_data").
+			SetType(api.PATH_TYPE_DATASTORE_JSON)
+
+	// Maps machine identifiers reported at enrolment to the client
+	// which reported them.
+	ATTESTATION_INDEX_ROOT = path_specs.NewUnsafeDatastorePath("attestation_index").
+				SetType(api.PATH_TYPE_DATASTORE_JSON)
+
+	// Maps the hashes of executables reported by clients to the
+	// clients which have them.
+	HASH_INVENTORY_ROOT = path_specs.NewSafeDatastorePath("hash_inventory").
+				SetType(api.PATH_TYPE_DATASTORE_JSON)
+
 	ORGS_ROOT = path_specs.NewSafeDatastorePath("orgs").
 			SetType(api.PATH_TYPE_DATASTORE_JSON)
 
@@ -88,4 +119,10 @@ var (
 
 	ThirdPartyInventory = path_specs.NewSafeDatastorePath(
 		"config", "inventory").SetType(api.PATH_TYPE_DATASTORE_JSON)
+
+	// The lease held by the leader node. This is stored in the file
+	// store so it is not cached by the datastore and is visible to
+	// all nodes immediately.
+	LEADER_LEASE = path_specs.NewSafeFilestorePath(
+		"config", "leader_lease").SetType(api.PATH_TYPE_FILESTORE_JSON)
 )
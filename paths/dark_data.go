@@ -0,0 +1,8 @@
+package paths
+
+import "www.velocidex.com/golang/velociraptor/file_store/api"
+
+// Uploads of a flow which were not parsed into any results.
+func DarkDataPath(client_id, flow_id string) api.DSPathSpec {
+	return DARK_DATA_ROOT.AddChild(client_id, flow_id).SetTag("DarkData")
+}
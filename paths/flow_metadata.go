@@ -70,6 +70,22 @@ func (self FlowPathManager) Log() api.FSPathSpec {
 		SetType(api.PATH_TYPE_FILESTORE_JSON)
 }
 
+// Analyst tags and notes about the flow and its results.
+func (self FlowPathManager) Annotations() api.FSPathSpec {
+	return self.Path().AddChild("annotations").
+		AsFilestorePath().
+		SetTag("Annotations").
+		SetType(api.PATH_TYPE_FILESTORE_JSON)
+}
+
+// Client signatures over the result batches of the flow.
+func (self FlowPathManager) Signatures() api.FSPathSpec {
+	return self.Path().AddChild("signatures").
+		AsFilestorePath().
+		SetTag("Signatures").
+		SetType(api.PATH_TYPE_FILESTORE_JSON)
+}
+
 func (self FlowPathManager) LogLegacy() api.FSPathSpec {
 	return self.Path().AddChild("logs").
 		AsFilestorePath().
@@ -0,0 +1,8 @@
+package paths
+
+import "www.velocidex.com/golang/velociraptor/file_store/api"
+
+// Group tasks are collections addressed to all clients with a label.
+func GroupTaskPath(task_id string) api.DSPathSpec {
+	return GROUP_TASKS_ROOT.AddChild(task_id).SetTag("GroupTask")
+}
@@ -0,0 +1,14 @@
+package paths
+
+import "www.velocidex.com/golang/velociraptor/file_store/api"
+
+// All the clients which reported a file with this hash.
+func HashInventoryDirectory(hash string) api.DSPathSpec {
+	return HASH_INVENTORY_ROOT.AddChild(hash)
+}
+
+// The files with this hash on the client.
+func HashInventoryPath(hash, client_id string) api.DSPathSpec {
+	return HASH_INVENTORY_ROOT.AddChild(hash, client_id).
+		SetTag("HashInventory")
+}
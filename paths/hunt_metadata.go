@@ -71,3 +71,10 @@ func (self HuntPathManager) ClientErrors() api.FSPathSpec {
 	return HUNTS_ROOT.AddChild(self.hunt_id + "_errors").
 		AsFilestorePath()
 }
+
+// Records the scheduling progress of each client so a hunt can
+// resume after a server restart.
+func (self HuntPathManager) Progress() api.FSPathSpec {
+	return HUNTS_ROOT.AddChild(self.hunt_id + "_progress").
+		AsFilestorePath()
+}
@@ -23,4 +23,7 @@ func (self *PathManagerTestSuite) TestHuntPathManager() {
 
 	assert.Equal(self.T(), "/fs/hunts/H.1234_errors.json",
 		self.getFilestorePath(manager.ClientErrors()))
+
+	assert.Equal(self.T(), "/fs/hunts/H.1234_progress.json",
+		self.getFilestorePath(manager.Progress()))
 }
@@ -57,3 +57,9 @@ func (self UserPathManager) FavoriteDir(type_name string) api.DSPathSpec {
 func NewUserPathManager(username string) *UserPathManager {
 	return &UserPathManager{username}
 }
+
+// Where we store API keys. Keys are global to the server and are
+// stored in the root org.
+func ApiKeyPath(id string) api.DSPathSpec {
+	return API_KEYS_ROOT.AddChild(id).SetTag("ApiKey")
+}
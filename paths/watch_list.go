@@ -0,0 +1,8 @@
+package paths
+
+import "www.velocidex.com/golang/velociraptor/file_store/api"
+
+// Clients to raise an alert for when they next check in.
+func WatchListPath(client_id string) api.DSPathSpec {
+	return WATCH_LIST_ROOT.AddChild(client_id).SetTag("WatchedClient")
+}
@@ -37,3 +37,14 @@ type Responder interface {
 	FlowContext() *FlowContext
 	Close()
 }
+
+// Classes of errors reported in VeloStatus.ErrorClass. These allow
+// the server to tell a query that failed from one which was stopped
+// for operational reasons.
+const (
+	ERROR_CLASS_GENERIC        = "GENERIC"
+	ERROR_CLASS_RESOURCE_LIMIT = "RESOURCE_LIMIT"
+	ERROR_CLASS_CANCELLED      = "CANCELLED"
+	ERROR_CLASS_LOG            = "ERROR_LOG"
+	ERROR_CLASS_CLIENT_CRASH   = "CLIENT_CRASH"
+)
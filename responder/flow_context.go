@@ -10,6 +10,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"google.golang.org/protobuf/proto"
 	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
 	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
 	constants "www.velocidex.com/golang/velociraptor/constants"
@@ -32,10 +33,19 @@ type FlowContext struct {
 	// The original request.
 	req *crypto_proto.FlowRequest
 
+	// Urgent flows bypass the client's blackout windows.
+	urgent bool
+
 	// Flow wide totals
 	total_rows           uint64
 	total_uploaded_bytes uint64
 
+	// Network usage attributed to this flow. Received bytes are the
+	// size of the original request, sent bytes are counted as
+	// messages are queued for the server.
+	total_bytes_sent     uint64
+	total_bytes_received uint64
+
 	// Send the messages to this channel
 	output chan *crypto_proto.VeloMessage
 
@@ -119,11 +129,14 @@ func newFlowContext(ctx context.Context,
 		wg:             &sync.WaitGroup{},
 		output:         output,
 		req:            req.FlowRequest,
+		urgent:         req.Urgent,
 		frequency_msec: frequency_msec,
 		config_obj:     config_obj,
 		flow_id:        flow_id,
 		owner:          owner,
 		checkpoint:     makeCheckpoint(config_obj, flow_id),
+
+		total_bytes_received: uint64(proto.Size(req)),
 	}
 
 	go func() {
@@ -250,7 +263,7 @@ func (self *FlowContext) Cancel() {
 func (self *FlowContext) _Cancel() {
 	// Cancel all outstanding queries
 	for _, r := range self.responders {
-		r.RaiseError(self.ctx, "Cancelled")
+		r.raiseErrorWithClass(ERROR_CLASS_CANCELLED, "Cancelled")
 	}
 
 	self.addLogMessage("ERROR",
@@ -352,7 +365,8 @@ func (self *FlowContext) flushLogMessages(ctx context.Context) {
 }
 
 // Alert messages are sent in their own packet because the server will
-// redirect them into the alert queue.
+// redirect them into the alert queue. They are sent as urgent
+// messages so they are not delayed behind regular results.
 func (self *FlowContext) sendAlertMessage(
 	ctx context.Context, level string,
 	// msg containes serialized services.AlertMessage
@@ -373,7 +387,12 @@ func (self *FlowContext) sendAlertMessage(
 				"{\"client_time\":%d,\"level\":%q,\"message\":%q}\n",
 				int(utils.GetTime().Now().Unix()), level, msg),
 			Level: logging.ALERT,
-		}}
+		},
+
+		// Alerts bypass the ring buffer so they are delivered
+		// promptly even during a blackout window.
+		Urgent: true,
+	}
 }
 
 func (self *FlowContext) AddLogMessage(
@@ -396,6 +415,10 @@ func (self *FlowContext) addLogMessage(level string, msg string) {
 		int(utils.GetTime().Now().Unix()), level, msg)...)
 }
 
+func (self *FlowContext) AddBytesSent(count uint64) {
+	atomic.AddUint64(&self.total_bytes_sent, count)
+}
+
 func (self *FlowContext) NextUploadId() int64 {
 	new_id := int64(atomic.AddInt32(&self.upload_id, 1))
 	return new_id - 1
@@ -460,7 +483,10 @@ func (self *FlowContext) getStats() *crypto_proto.VeloMessage {
 	result := &crypto_proto.VeloMessage{
 		SessionId: self.flow_id,
 		RequestId: constants.STATS_SINK,
-		FlowStats: &crypto_proto.FlowStats{},
+		FlowStats: &crypto_proto.FlowStats{
+			TotalBytesSent:     atomic.LoadUint64(&self.total_bytes_sent),
+			TotalBytesReceived: atomic.LoadUint64(&self.total_bytes_received),
+		},
 	}
 
 	// Fill in all the responder's stats.
@@ -472,6 +498,7 @@ func (self *FlowContext) getStats() *crypto_proto.VeloMessage {
 	if self.isFlowComplete() {
 		// Let the server know this is the final message in the flow.
 		result.FlowStats.FlowComplete = true
+		result.FlowStats.TraceParent = self.req.TraceParent
 		self.final_stats_sent = true
 	}
 
@@ -97,6 +97,39 @@ func (self *FlowManager) Cancel(ctx context.Context, flow_id string) {
 	}
 }
 
+// Returns true if any urgent flows are currently running.
+func (self *FlowManager) HasUrgentFlows() bool {
+	if self == nil {
+		return false
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for _, flow_context := range self.in_flight {
+		if flow_context.urgent {
+			return true
+		}
+	}
+	return false
+}
+
+// Attribute network usage to an in flight flow. Messages for flows
+// which are not running (e.g. monitoring) are not tracked.
+func (self *FlowManager) RecordBytesSent(flow_id string, count uint64) {
+	if self == nil {
+		return
+	}
+
+	self.mu.Lock()
+	flow_context, pres := self.in_flight[flow_id]
+	self.mu.Unlock()
+
+	if pres {
+		flow_context.AddBytesSent(count)
+	}
+}
+
 func (self *FlowManager) FlowContext(
 	output chan *crypto_proto.VeloMessage,
 	req *crypto_proto.VeloMessage) *FlowContext {
@@ -96,7 +96,8 @@ func (self *MonitoringContext) NextUploadId() int64 {
 }
 
 // Alert messages are sent in their own packet because the server will
-// redirect them into the alert queue.
+// redirect them into the alert queue. They are sent as urgent
+// messages so they are not delayed behind regular results.
 func (self *MonitoringContext) sendAlertMessage(
 	ctx context.Context, level string,
 
@@ -119,7 +120,12 @@ func (self *MonitoringContext) sendAlertMessage(
 				int(utils.GetTime().Now().Unix()), level, msg),
 			Level:    logging.ALERT,
 			Artifact: self.artifact,
-		}}
+		},
+
+		// Alerts bypass the ring buffer so they are delivered
+		// promptly even during a blackout window.
+		Urgent: true,
+	}
 }
 
 func (self *MonitoringContext) AddLogMessage(
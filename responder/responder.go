@@ -111,6 +111,12 @@ func (self *FlowResponder) GetStatus() *crypto_proto.VeloStatus {
 	// Duration is in milli seconds
 	status.Duration = int64(status.LastActive-status.FirstActive) * 1000
 
+	// A failed query which already sent some data has partial
+	// results. This is different from a query which failed without
+	// producing anything.
+	status.Partial = status.Status == crypto_proto.VeloStatus_GENERIC_ERROR &&
+		(status.ResultRows > 0 || status.UploadedFiles > 0)
+
 	return status
 }
 
@@ -140,6 +146,16 @@ func (self *FlowResponder) updateStats(message *crypto_proto.VeloMessage) {
 	}
 }
 
+// Called from VQL to report how far the query progressed. The
+// server uses this to estimate when the collection will complete.
+func (self *FlowResponder) SetProgress(total, done int64) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.status.ProgressTotal = total
+	self.status.ProgressDone = done
+}
+
 // Called from VQL to send a response back to the server.
 func (self *FlowResponder) AddResponse(message *crypto_proto.VeloMessage) {
 	self.mu.Lock()
@@ -154,7 +170,7 @@ func (self *FlowResponder) AddResponse(message *crypto_proto.VeloMessage) {
 		if err != nil {
 			// If we exceeded the limits cancel the entire
 			// collection.
-			self.RaiseError(self.ctx, err.Error())
+			self.raiseErrorWithClass(ERROR_CLASS_RESOURCE_LIMIT, err.Error())
 			self.flow_context.Cancel()
 		}
 	}
@@ -162,7 +178,7 @@ func (self *FlowResponder) AddResponse(message *crypto_proto.VeloMessage) {
 	if message.VQLResponse != nil {
 		err := self.flow_context.ChargeRows(message.VQLResponse.TotalRows)
 		if err != nil {
-			self.RaiseError(self.ctx, err.Error())
+			self.raiseErrorWithClass(ERROR_CLASS_RESOURCE_LIMIT, err.Error())
 			self.flow_context.Cancel()
 		}
 	}
@@ -178,12 +194,17 @@ func (self *FlowResponder) AddResponse(message *crypto_proto.VeloMessage) {
 }
 
 func (self *FlowResponder) RaiseError(ctx context.Context, message string) {
+	self.raiseErrorWithClass(ERROR_CLASS_GENERIC, message)
+}
+
+func (self *FlowResponder) raiseErrorWithClass(class, message string) {
 	// Mark the query as having an error.
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
 	if self.status.Status == crypto_proto.VeloStatus_PROGRESS {
 		self.status.Status = crypto_proto.VeloStatus_GENERIC_ERROR
+		self.status.ErrorClass = class
 		self.status.ErrorMessage = message
 		self.status.Backtrace = string(debug.Stack())
 	}
@@ -210,7 +231,7 @@ func (self *FlowResponder) Log(ctx context.Context, level string, msg string) {
 	// Capture the first message at error level.
 	// FIXME: Support server provided error regex patterns
 	if level == logging.ERROR {
-		self.RaiseError(ctx, msg)
+		self.raiseErrorWithClass(ERROR_CLASS_LOG, msg)
 	}
 
 	self.mu.Lock()
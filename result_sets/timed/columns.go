@@ -0,0 +1,288 @@
+package timed
+
+// Days which are rarely queried are compacted into column files. A
+// column file holds all the rows of a day grouped by column rather
+// than by row. The values in a column are similar so they compress
+// much better. The file is a gzip compressed JSON object.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/file_store/api"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/timelines"
+)
+
+const (
+	COLUMN_FILE_VERSION = 1
+)
+
+type columnFile struct {
+	Version int `json:"version"`
+
+	// The timestamp of each row in nanoseconds.
+	Timestamps []int64 `json:"timestamps"`
+
+	Columns []string `json:"columns"`
+
+	// The serialized values of each column, one for each row.
+	Values [][]json.RawMessage `json:"values"`
+
+	// Rows which do not have a column at all (rather than a null
+	// value) keyed by column index.
+	Missing map[int][]int `json:"missing,omitempty"`
+}
+
+// Compact the day's JSON file into a column file at dest.
+func CompactToColumns(
+	ctx context.Context,
+	file_store_factory api.FileStore, src api.FSPathSpec,
+	dest_store api.FileStore, dest api.FSPathSpec) error {
+
+	// Open the JSON file the same way queries do so old files
+	// without a time index are upgraded.
+	src_reader := &TimedResultSetReader{
+		files:              []*api.ResultSetFileProperties{{Path: src}},
+		file_store_factory: file_store_factory,
+	}
+	defer src_reader.Close()
+
+	reader, err := src_reader.GetReader()
+	if err != nil {
+		return err
+	}
+
+	data := &columnFile{
+		Version: COLUMN_FILE_VERSION,
+		Missing: make(map[int][]int),
+	}
+	column_idx := make(map[string]int)
+
+	for item := range reader.Read(ctx) {
+		row_idx := len(data.Timestamps)
+		data.Timestamps = append(data.Timestamps, item.Time.UnixNano())
+
+		for _, name := range item.Row.Keys() {
+			value, _ := item.Row.Get(name)
+			serialized, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+
+			idx, pres := column_idx[name]
+			if !pres {
+				// A new column: all the previous rows are
+				// missing it.
+				idx = len(data.Columns)
+				column_idx[name] = idx
+				data.Columns = append(data.Columns, name)
+				data.Values = append(data.Values,
+					make([]json.RawMessage, row_idx, row_idx+1))
+				for i := 0; i < row_idx; i++ {
+					data.Missing[idx] = append(data.Missing[idx], i)
+				}
+			}
+			data.Values[idx] = append(data.Values[idx], serialized)
+		}
+
+		// Pad the columns this row does not have.
+		for idx := range data.Columns {
+			if len(data.Values[idx]) <= row_idx {
+				data.Values[idx] = append(data.Values[idx], nil)
+				data.Missing[idx] = append(data.Missing[idx], row_idx)
+			}
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	serialized, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a
+	// partial column file.
+	tmp_path := dest.SetType(api.PATH_TYPE_FILESTORE_TMP)
+	err = writeCompressed(dest_store, tmp_path, serialized)
+	if err != nil {
+		return err
+	}
+
+	return dest_store.Move(tmp_path, dest)
+}
+
+func writeCompressed(
+	file_store_factory api.FileStore, path api.FSPathSpec, data []byte) error {
+	fd, err := file_store_factory.WriteFile(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	err = fd.Truncate()
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	_, err = zw.Write(data)
+	if err != nil {
+		return err
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+
+	_, err = fd.Write(buf.Bytes())
+	return err
+}
+
+// Reads the rows of a column file.
+type ColumnReader struct {
+	id          string
+	data        *columnFile
+	current_idx int
+
+	// Column index -> rows missing the column.
+	missing map[int]map[int]bool
+}
+
+func (self *ColumnReader) SeekToTime(timestamp time.Time) error {
+	timestamp_int := timestamp.UnixNano()
+	self.current_idx = sort.Search(len(self.data.Timestamps), func(i int) bool {
+		return self.data.Timestamps[i] >= timestamp_int
+	})
+
+	if self.current_idx >= len(self.data.Timestamps) {
+		return io.EOF
+	}
+	return nil
+}
+
+func (self *ColumnReader) Read(ctx context.Context) <-chan timelines.TimelineItem {
+	output_chan := make(chan timelines.TimelineItem)
+
+	go func() {
+		defer close(output_chan)
+
+		for ; self.current_idx < len(self.data.Timestamps); self.current_idx++ {
+			row, err := self.getRow(self.current_idx)
+			if err != nil {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+
+			case output_chan <- timelines.TimelineItem{
+				Source: self.id,
+				Row:    row,
+				Time:   time.Unix(0, self.data.Timestamps[self.current_idx]),
+			}:
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+// Rebuild the row's JSON so it is parsed exactly like rows read
+// from the JSON files.
+func (self *ColumnReader) getRow(row_idx int) (*ordereddict.Dict, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for idx, name := range self.data.Columns {
+		if self.missing[idx][row_idx] {
+			continue
+		}
+
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+
+		serialized_name, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(serialized_name)
+		buf.WriteByte(':')
+
+		value := self.data.Values[idx][row_idx]
+		if len(value) == 0 {
+			value = json.RawMessage("null")
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	row := ordereddict.NewDict()
+	err := row.UnmarshalJSON(buf.Bytes())
+	return row, err
+}
+
+func (self *ColumnReader) Close() {}
+
+func NewColumnReader(
+	file_store_factory api.FileStore, path api.FSPathSpec) (*ColumnReader, error) {
+	fd, err := file_store_factory.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	zr, err := gzip.NewReader(fd)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	serialized, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &columnFile{}
+	err = json.Unmarshal(serialized, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.Version != COLUMN_FILE_VERSION ||
+		len(data.Values) != len(data.Columns) {
+		return nil, errors.New("ColumnReader: Unsupported column file")
+	}
+
+	for _, values := range data.Values {
+		if len(values) != len(data.Timestamps) {
+			return nil, errors.New("ColumnReader: Corrupted column file")
+		}
+	}
+
+	missing := make(map[int]map[int]bool)
+	for idx, rows := range data.Missing {
+		missing[idx] = make(map[int]bool)
+		for _, row := range rows {
+			missing[idx][row] = true
+		}
+	}
+
+	return &ColumnReader{
+		id:      path.Base(),
+		data:    data,
+		missing: missing,
+	}, nil
+}
@@ -41,12 +41,21 @@ import (
 // from it, so reading from already constructed cursors is extremely
 // quick.
 
+// Reads a single file in any of the storage tiers. Recent days are
+// JSON files with a time index and older days may be compacted into
+// column files.
+type DayReader interface {
+	SeekToTime(timestamp time.Time) error
+	Read(ctx context.Context) <-chan timelines.TimelineItem
+	Close()
+}
+
 type TimedResultSetReader struct {
 	mu sync.Mutex
 
 	files              []*api.ResultSetFileProperties
 	current_files_idx  int
-	current_reader     *timelines.TimelineReader
+	current_reader     DayReader
 	start              time.Time
 	end                time.Time
 	file_store_factory api.FileStore
@@ -129,14 +138,14 @@ func (self *TimedResultSetReader) _Close() {
 	}
 }
 
-func (self *TimedResultSetReader) GetReader() (*timelines.TimelineReader, error) {
+func (self *TimedResultSetReader) GetReader() (DayReader, error) {
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
 	return self.getReader()
 }
 
-func (self *TimedResultSetReader) getReader() (*timelines.TimelineReader, error) {
+func (self *TimedResultSetReader) getReader() (DayReader, error) {
 	if self.current_reader != nil {
 		return self.current_reader, nil
 	}
@@ -149,6 +158,21 @@ func (self *TimedResultSetReader) getReader() (*timelines.TimelineReader, error)
 			return nil, io.EOF
 		}
 
+		if current_file.Path.Type() == api.PATH_TYPE_FILESTORE_COLUMNS {
+			file_store_factory := self.file_store_factory
+			if current_file.FileStore != nil {
+				file_store_factory = current_file.FileStore
+			}
+
+			reader, err := NewColumnReader(file_store_factory, current_file.Path)
+			if err != nil {
+				return nil, err
+			}
+
+			self.current_reader = reader
+			return reader, nil
+		}
+
 		path_manager := paths.NewTimelinePathManager(
 			"", current_file.Path)
 		reader, err := timelines.NewTimelineReader(
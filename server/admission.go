@@ -0,0 +1,92 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+)
+
+const (
+	// Urgent messages always bypass concurrency control.
+	PRIORITY_URGENT = "urgent"
+
+	// Heartbeats and small messages.
+	PRIORITY_NORMAL = "normal"
+
+	// Large uploads which can be deferred when the frontend is
+	// overloaded.
+	PRIORITY_BULK = "bulk"
+)
+
+var (
+	admissionCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frontend_admission_count",
+		Help: "Number of client requests by priority class and admission decision.",
+	}, []string{"priority", "decision"})
+)
+
+// Classify the request by the priority the client advertises and the
+// size of its payload.
+func requestPriority(
+	config_obj *config_proto.Config, req *http.Request) string {
+	if req.Header.Get("X-Priority") == PRIORITY_URGENT {
+		return PRIORITY_URGENT
+	}
+
+	bulk_size := int64(1024 * 1024)
+	if config_obj.Frontend != nil &&
+		config_obj.Frontend.Resources != nil &&
+		config_obj.Frontend.Resources.BulkUploadSize > 0 {
+		bulk_size = int64(config_obj.Frontend.Resources.BulkUploadSize)
+	}
+
+	if req.ContentLength > bulk_size {
+		return PRIORITY_BULK
+	}
+
+	return PRIORITY_NORMAL
+}
+
+// Decide if the request should be deferred. Only bulk uploads are
+// ever shed - clients are told how long to back off for in the
+// Retry-After header.
+func (self *Server) shouldShed(
+	config_obj *config_proto.Config, priority string) bool {
+	if priority != PRIORITY_BULK ||
+		config_obj.Frontend == nil ||
+		config_obj.Frontend.Resources == nil {
+		return false
+	}
+
+	percent := config_obj.Frontend.Resources.ShedBulkUploadsPercent
+	if percent == 0 {
+		return false
+	}
+
+	return self.Concurrency().Utilization()*100 >= float64(percent)
+}
+
+func (self *Server) admitRequest(
+	config_obj *config_proto.Config,
+	w http.ResponseWriter, req *http.Request) bool {
+	priority := requestPriority(config_obj, req)
+
+	if self.shouldShed(config_obj, priority) {
+		admissionCounter.WithLabelValues(priority, "deferred").Inc()
+
+		backoff := uint64(60)
+		if config_obj.Frontend.Resources.BulkUploadBackoff > 0 {
+			backoff = config_obj.Frontend.Resources.BulkUploadBackoff
+		}
+
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", backoff))
+		http.Error(w, "Overloaded", http.StatusTooManyRequests)
+		return false
+	}
+
+	admissionCounter.WithLabelValues(priority, "accepted").Inc()
+	return true
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/velociraptor/config"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+func TestAdmissionControl(t *testing.T) {
+	config_obj := config.GetDefaultConfig()
+	config_obj.Frontend.Resources.BulkUploadSize = 10
+	config_obj.Frontend.Resources.ShedBulkUploadsPercent = 50
+	config_obj.Frontend.Resources.BulkUploadBackoff = 30
+
+	server_obj := &Server{
+		concurrency: utils.NewConcurrencyControl(2, time.Second),
+	}
+
+	small := httptest.NewRequest("POST", "/control", bytes.NewReader([]byte("hi")))
+	bulk := httptest.NewRequest("POST", "/control",
+		bytes.NewReader(bytes.Repeat([]byte("x"), 100)))
+	urgent := httptest.NewRequest("POST", "/control",
+		bytes.NewReader(bytes.Repeat([]byte("x"), 100)))
+	urgent.Header.Set("X-Priority", "urgent")
+
+	assert.Equal(t, PRIORITY_NORMAL, requestPriority(config_obj, small))
+	assert.Equal(t, PRIORITY_BULK, requestPriority(config_obj, bulk))
+	assert.Equal(t, PRIORITY_URGENT, requestPriority(config_obj, urgent))
+
+	// An idle frontend accepts everything.
+	assert.True(t, server_obj.admitRequest(config_obj, httptest.NewRecorder(), bulk))
+
+	// Use up half the concurrency slots.
+	cancel, err := server_obj.Concurrency().StartConcurrencyControl(
+		context.Background())
+	assert.NoError(t, err)
+	defer cancel()
+
+	// Bulk uploads are deferred with a backoff directive.
+	w := httptest.NewRecorder()
+	assert.False(t, server_obj.admitRequest(config_obj, w, bulk))
+	assert.Equal(t, 429, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	// Everything else is still accepted.
+	assert.True(t, server_obj.admitRequest(config_obj, httptest.NewRecorder(), small))
+	assert.True(t, server_obj.admitRequest(config_obj, httptest.NewRecorder(), urgent))
+}
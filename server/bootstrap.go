@@ -0,0 +1,123 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+var (
+	bootstrapCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frontend_bootstrap_downloads",
+		Help: "Number of client binaries served from the bootstrap endpoint.",
+	}, []string{"tool"})
+
+	unauthorizedError = errors.New("Unauthorized")
+)
+
+// Only the client binaries may be fetched through the bootstrap
+// endpoint - other tools are available through the usual
+// mechanisms.
+func isBootstrapTool(name string) bool {
+	return strings.HasPrefix(name, "Velociraptor") &&
+		!strings.ContainsAny(name, "/\\")
+}
+
+// Tokens are accepted in the Authorization header (as a bearer
+// token) or the token query parameter to make it easy to use from
+// simple scripts.
+func checkBootstrapToken(config_obj *config_proto.Config, r *http.Request) bool {
+	if config_obj.Frontend == nil {
+		return false
+	}
+
+	token := r.URL.Query().Get("token")
+	auth := r.Header.Get("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	if token == "" {
+		return false
+	}
+
+	for _, allowed := range config_obj.Frontend.BootstrapTokens {
+		if allowed != "" && subtle.ConstantTimeCompare(
+			[]byte(token), []byte(allowed)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Serve the current client binaries from the inventory so bootstrap
+// scripts always fetch the version matching the server. For example:
+//
+// curl -H "Authorization: Bearer <token>" https://frontend/bootstrap/VelociraptorLinux
+func bootstrap(config_obj *config_proto.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !checkBootstrapToken(config_obj, r) {
+			returnError(config_obj, w, http.StatusUnauthorized, unauthorizedError)
+			return
+		}
+
+		tool_name := r.URL.Path
+		if !isBootstrapTool(tool_name) {
+			returnError(config_obj, w, 404, notFoundError)
+			return
+		}
+
+		inventory, err := services.GetInventory(config_obj)
+		if err != nil {
+			returnError(config_obj, w, 500, err)
+			return
+		}
+
+		// Materialize the tool if needed.
+		tool, err := inventory.GetToolInfo(r.Context(), config_obj, tool_name, "")
+		if err != nil {
+			returnError(config_obj, w, 404, err)
+			return
+		}
+
+		path_manager := paths.NewInventoryPathManager(config_obj, tool)
+		path_spec, file_store_factory, err := path_manager.Path()
+		if err != nil {
+			returnError(config_obj, w, 404, err)
+			return
+		}
+
+		fd, err := file_store_factory.ReadFile(path_spec)
+		if err != nil {
+			returnError(config_obj, w, 404, err)
+			return
+		}
+		defer fd.Close()
+
+		bootstrapCounter.WithLabelValues(tool_name).Inc()
+
+		filename := tool.Filename
+		if filename == "" {
+			filename = tool_name
+		}
+
+		w.Header().Set("Content-Disposition", "attachment; filename="+
+			url.PathEscape(filename))
+		w.Header().Set("Content-Type", "binary/octet-stream")
+		if tool.Hash != "" {
+			w.Header().Set("X-Velociraptor-SHA256", tool.Hash)
+		}
+		w.WriteHeader(200)
+
+		utils.Copy(r.Context(), w, fd)
+	})
+}
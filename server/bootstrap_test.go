@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/velociraptor/config"
+)
+
+func TestBootstrapToken(t *testing.T) {
+	config_obj := config.GetDefaultConfig()
+
+	// No tokens configured means the endpoint is disabled.
+	r := httptest.NewRequest("GET", "/bootstrap/VelociraptorLinux?token=", nil)
+	assert.False(t, checkBootstrapToken(config_obj, r))
+
+	config_obj.Frontend.BootstrapTokens = []string{"old", "secret"}
+
+	r = httptest.NewRequest("GET", "/bootstrap/VelociraptorLinux?token=secret", nil)
+	assert.True(t, checkBootstrapToken(config_obj, r))
+
+	r = httptest.NewRequest("GET", "/bootstrap/VelociraptorLinux", nil)
+	r.Header.Set("Authorization", "Bearer old")
+	assert.True(t, checkBootstrapToken(config_obj, r))
+
+	r = httptest.NewRequest("GET", "/bootstrap/VelociraptorLinux?token=wrong", nil)
+	assert.False(t, checkBootstrapToken(config_obj, r))
+
+	assert.True(t, isBootstrapTool("VelociraptorWindowsMSI"))
+	assert.False(t, isBootstrapTool("Autorunsc"))
+	assert.False(t, isBootstrapTool("Velociraptor/../secret"))
+}
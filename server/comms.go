@@ -20,6 +20,7 @@ package server
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
 	"html"
 	"io"
@@ -28,6 +29,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"sync/atomic"
 	"time"
 
@@ -97,6 +99,11 @@ var (
 		Help: "Number responses to enrol (406).",
 	})
 
+	enrollmentRejectedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "frontend_enroll_rejected",
+		Help: "Number of enrolment requests rejected because the enrolment queue is full.",
+	})
+
 	urgentCounter = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "frontend_urgent_responses",
 		Help: "Number urgent responses received.",
@@ -160,6 +167,10 @@ func PrepareFrontendMux(
 		http.StripPrefix(base,
 			downloadPublic(config_obj, []string{"public"}))))
 
+	// Token gated download of the current client binaries.
+	router.Handle(base+"/bootstrap/", GetLoggingHandler(config_obj, "/bootstrap")(
+		http.StripPrefix(base+"/bootstrap/", bootstrap(config_obj))))
+
 	return nil
 }
 
@@ -268,7 +279,10 @@ func readWithLimits(
 		receiveDecryptionErrors.Inc()
 		return nil, errors.New("Unable to decrypt")
 	}
-	message_info.RemoteAddr = utils.RemoteAddr(req, config_obj.Frontend.GetProxyHeader())
+	message_info.RemoteAddr = utils.RemoteAddrFromTrustedProxy(
+		req, config_obj.Frontend.GetProxyHeader(),
+		config_obj.Frontend.GetTrustedProxies())
+	message_info.ClientVersion = clientVersion(req)
 	server_obj.Debug("Received a post of length %v from %v (%v)",
 		n, message_info.RemoteAddr, message_info.Source)
 
@@ -301,6 +315,10 @@ func receive_client_messages(
 			panic("http handler is not a flusher")
 		}
 
+		if !negotiateApiVersion(server_obj, w, req) {
+			return
+		}
+
 		// Allow a limited time to read from the client because this
 		// is the hot path.
 		ctx, cancel := context.WithTimeout(req.Context(), 600*time.Second)
@@ -323,6 +341,12 @@ func receive_client_messages(
 
 		receiveCounter.Inc()
 
+		// Under load defer bulk uploads before they take up a
+		// concurrency slot.
+		if !server_obj.admitRequest(config_obj, w, req) {
+			return
+		}
+
 		priority := req.Header.Get("X-Priority")
 		// For urgent messages skip concurrency control - This
 		// allows clients with urgent messages to always be
@@ -510,10 +534,13 @@ func send_client_messages(
 			panic("http handler is not a flusher")
 		}
 
+		if !negotiateApiVersion(server_obj, w, req) {
+			return
+		}
+
 		sendCounter.Inc()
 
-		body, err := ioutil.ReadAll(
-			io.LimitReader(req.Body, constants.MAX_MEMORY))
+		body, err := readReaderBody(req)
 		if err != nil {
 			server_obj.Error("Unable to read body: %v", err)
 			http.Error(w, "", http.StatusServiceUnavailable)
@@ -527,8 +554,10 @@ func send_client_messages(
 			http.Error(w, "", http.StatusForbidden)
 			return
 		}
-		message_info.RemoteAddr = utils.RemoteAddr(
-			req, config_obj.Frontend.GetProxyHeader())
+		message_info.RemoteAddr = utils.RemoteAddrFromTrustedProxy(
+			req, config_obj.Frontend.GetProxyHeader(),
+			config_obj.Frontend.GetTrustedProxies())
+		message_info.ClientVersion = clientVersion(req)
 
 		// Reject unauthenticated messages. This ensures
 		// untrusted clients are not allowed to keep
@@ -630,7 +659,7 @@ func send_client_messages(
 		// close the connection and expect the client to
 		// reconnect again. We add a bit of jitter to ensure
 		// clients do not get synchronized.
-		wait := time.Duration(org_config_obj.Client.MaxPoll+
+		wait := time.Duration(longPollTimeout(config_obj, org_config_obj)+
 			uint64(rand.Intn(30))) * time.Second
 
 		deadline := time.After(wait)
@@ -722,6 +751,60 @@ func send_client_messages(
 	})
 }
 
+// How long to hold the reader connection open waiting for tasks. A
+// task arriving during this time is delivered immediately.
+func longPollTimeout(
+	config_obj *config_proto.Config, org_config_obj *config_proto.Config) uint64 {
+	if config_obj.Frontend != nil && config_obj.Frontend.Resources != nil &&
+		config_obj.Frontend.Resources.LongPollTimeout > 0 {
+		return config_obj.Frontend.Resources.LongPollTimeout
+	}
+	return org_config_obj.Client.MaxPoll
+}
+
+// The reader may be a POST with the encrypted message in the body or
+// a GET with the message in a header (Client.reader_use_get).
+// Select the API version for this request and tell the client about
+// it. Returns false if the client does not speak any version we
+// understand.
+func negotiateApiVersion(
+	server_obj *Server, w http.ResponseWriter, req *http.Request) bool {
+	api_version, err := http_utils.NegotiateApiVersion(
+		req, constants.CLIENT_API_VERSION)
+	if err != nil {
+		server_obj.Debug("Rejecting request from %v: %v", req.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusUpgradeRequired)
+		return false
+	}
+
+	if api_version > 0 {
+		w.Header().Set(constants.CLIENT_API_VERSION_HEADER,
+			strconv.FormatUint(uint64(api_version), 10))
+	}
+
+	return true
+}
+
+// The version the client advertised in its request header. This is
+// not authenticated so it is only used to restrict what the client
+// may do - a client misrepresenting its version only affects itself.
+func clientVersion(req *http.Request) string {
+	info, _ := http_utils.GetClientInfo(req)
+	return info.Version
+}
+
+func readReaderBody(req *http.Request) ([]byte, error) {
+	if req.Method == "GET" {
+		header := req.Header.Get(constants.VELOCIRAPTOR_MESSAGE_HEADER)
+		if len(header) > constants.MAX_MEMORY {
+			return nil, packetTooLargeError
+		}
+		return base64.StdEncoding.DecodeString(header)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(req.Body, constants.MAX_MEMORY))
+}
+
 func GetLoggingHandler(config_obj *config_proto.Config,
 	handler string) func(http.Handler) http.Handler {
 	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
@@ -750,6 +833,13 @@ func GetLoggingHandler(config_obj *config_proto.Config,
 
 func downloadPublic(
 	config_obj *config_proto.Config, prefix []string) http.Handler {
+	cache_size := int64(DEFAULT_PUBLIC_CACHE_SIZE)
+	if config_obj.Frontend != nil && config_obj.Frontend.Resources != nil &&
+		config_obj.Frontend.Resources.PublicCacheSize > 0 {
+		cache_size = int64(config_obj.Frontend.Resources.PublicCacheSize)
+	}
+	cache := newPublicCache(cache_size)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		path_spec := paths.FSPathSpecFromClientPath(r.URL.Path)
 		components := path_spec.Components()
@@ -763,24 +853,66 @@ func downloadPublic(
 		}
 
 		file_store_factory := file_store.GetFileStore(config_obj)
-		fd, err := file_store_factory.ReadFile(path_spec)
+		entry, err := cache.Get(file_store_factory, path_spec)
 		if err != nil {
 			returnError(config_obj, w, 404, err)
 			return
 		}
 
-		// From here on we already sent the headers and we can
-		// not really report an error to the client.
+		if entry == nil {
+			streamPublic(config_obj, w, r, file_store_factory, path_spec)
+			return
+		}
+
+		// Clients may revalidate their copy using the content hash.
+		w.Header().Set("ETag", entry.etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == entry.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
 		w.Header().Set("Content-Disposition", "attachment; filename="+
 			url.PathEscape(path_spec.Base())+api.GetExtensionForFilestore(path_spec))
 
 		w.Header().Set("Content-Type", "binary/octet-stream")
-		w.WriteHeader(200)
 
-		utils.Copy(r.Context(), w, fd)
+		// Support range requests so clients can resume interrupted
+		// downloads (If-Range is checked against the ETag).
+		http.ServeContent(w, r, "", entry.mod_time, bytes.NewReader(entry.data))
 	})
 }
 
+func streamPublic(config_obj *config_proto.Config,
+	w http.ResponseWriter, r *http.Request,
+	file_store_factory api.FileStore, path_spec api.FSPathSpec) {
+	fd, err := file_store_factory.ReadFile(path_spec)
+	if err != nil {
+		returnError(config_obj, w, 404, err)
+		return
+	}
+	defer fd.Close()
+
+	w.Header().Set("Content-Disposition", "attachment; filename="+
+		url.PathEscape(path_spec.Base())+api.GetExtensionForFilestore(path_spec))
+
+	w.Header().Set("Content-Type", "binary/octet-stream")
+
+	// Large files are served in ranges so clients can download them
+	// in chunks and resume interrupted downloads.
+	stat, err := fd.Stat()
+	if err == nil {
+		http.ServeContent(w, r, "", stat.ModTime(), fd)
+		return
+	}
+
+	// From here on we already sent the headers and we can
+	// not really report an error to the client.
+	w.WriteHeader(200)
+
+	utils.Copy(r.Context(), w, fd)
+}
+
 func returnError(
 	config_obj *config_proto.Config,
 	w http.ResponseWriter, code int, err error) {
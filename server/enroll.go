@@ -44,6 +44,14 @@ func enroll(
 		return err
 	}
 
+	// Failing to process the attestation report does not prevent
+	// enrolment.
+	err = server.manager.ProcessAttestation(ctx, config_obj, client_id, csr.Pem)
+	if err != nil {
+		logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+		logger.Error("While processing attestation for %v: %v", client_id, err)
+	}
+
 	journal, err := services.GetJournal(config_obj)
 	if err != nil {
 		return err
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Velocidex/ttlcache/v2"
+	"github.com/juju/ratelimit"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+var (
+	enrollmentThrottledError = errors.New("Enrolment rate exceeded")
+	enrollmentQueueFullError = errors.New("Enrolment queue full")
+)
+
+// Limits the number of enrolment requests accepted from each source
+// address. Counters are kept in fixed one minute windows which expire
+// from the cache so idle addresses do not consume memory.
+type enrollmentThrottler struct {
+	mu  sync.Mutex
+	lru *ttlcache.Cache
+	max uint64
+}
+
+func newEnrollmentThrottler(max uint64) *enrollmentThrottler {
+	result := &enrollmentThrottler{
+		lru: ttlcache.NewCache(),
+		max: max,
+	}
+	result.lru.SetTTL(time.Minute)
+	result.lru.SkipTTLExtensionOnHit(true)
+
+	return result
+}
+
+func (self *enrollmentThrottler) Allow(remote_addr string) bool {
+	// Only throttle on the host part - clients connect from
+	// ephemeral ports.
+	host, _, err := net.SplitHostPort(remote_addr)
+	if err != nil {
+		host = remote_addr
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	count_any, err := self.lru.Get(host)
+	if err != nil {
+		count := uint64(1)
+		self.lru.Set(host, &count)
+		return true
+	}
+
+	// Increment the counter in place: setting the key again would
+	// extend its expiry and the window would never reset.
+	count, ok := count_any.(*uint64)
+	if !ok {
+		return true
+	}
+
+	if *count >= self.max {
+		return false
+	}
+
+	*count++
+	return true
+}
+
+func (self *enrollmentThrottler) Close() {
+	self.lru.Close()
+}
+
+// Limits the global rate at which enrolment requests are processed
+// using a token bucket. Requests wait for a token in a bounded queue
+// - when the queue is full they are rejected so the client retries
+// later.
+type enrollmentSigningLimiter struct {
+	bucket    *ratelimit.Bucket
+	max_queue int64
+	queued    int64
+	clock     utils.Clock
+}
+
+func newEnrollmentSigningLimiter(
+	rate, queue_depth uint64, clock utils.Clock) *enrollmentSigningLimiter {
+	if queue_depth == 0 {
+		queue_depth = 100
+	}
+
+	return &enrollmentSigningLimiter{
+		bucket:    ratelimit.NewBucketWithRate(float64(rate), int64(rate)),
+		max_queue: int64(queue_depth),
+		clock:     clock,
+	}
+}
+
+// Wait until the request may be processed.
+func (self *enrollmentSigningLimiter) Wait(ctx context.Context) error {
+	if atomic.AddInt64(&self.queued, 1) > self.max_queue {
+		atomic.AddInt64(&self.queued, -1)
+		return enrollmentQueueFullError
+	}
+	defer atomic.AddInt64(&self.queued, -1)
+
+	wait := self.bucket.Take(1)
+	if wait == 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-self.clock.After(wait):
+		return nil
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vtesting"
+)
+
+func TestEnrollmentThrottler(t *testing.T) {
+	throttler := newEnrollmentThrottler(2)
+	defer throttler.Close()
+
+	// Different source ports from the same host share a quota.
+	assert.True(t, throttler.Allow("10.0.0.1:1234"))
+	assert.True(t, throttler.Allow("10.0.0.1:1235"))
+	assert.False(t, throttler.Allow("10.0.0.1:1236"))
+
+	// Other hosts are unaffected.
+	assert.True(t, throttler.Allow("10.0.0.2:1234"))
+
+	// Addresses from a proxy header have no port.
+	assert.True(t, throttler.Allow("10.0.0.3"))
+}
+
+func TestEnrollmentSigningLimiter(t *testing.T) {
+	limiter := newEnrollmentSigningLimiter(1, 2, utils.RealClock{})
+
+	// Use up the available token so the next request has to
+	// wait.
+	assert.NoError(t, limiter.Wait(context.Background()))
+
+	// Fill the queue with waiting requests.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = limiter.Wait(ctx)
+		}()
+	}
+
+	vtesting.WaitUntil(5*time.Second, t, func() bool {
+		return atomic.LoadInt64(&limiter.queued) == 2
+	})
+
+	// Further requests are rejected immediately.
+	assert.Equal(t, enrollmentQueueFullError, limiter.Wait(ctx))
+
+	cancel()
+	wg.Wait()
+}
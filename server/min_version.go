@@ -0,0 +1,274 @@
+package server
+
+// Clients older than Frontend.resources.min_client_version may send
+// results the server no longer interprets correctly. Turning them
+// away would leave them stranded on the old version, so instead the
+// frontend only serves them a collection of the upgrade artifacts.
+// Everything else they send (apart from the upgrade collection's own
+// results) is written to Server.Internal.Quarantine rather than into
+// their flows.
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/protobuf/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/crypto"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
+)
+
+const (
+	// Marks the collections launched to upgrade outdated clients.
+	upgradeCreator = "ClientUpgrade"
+
+	// How long to wait before launching another upgrade collection
+	// on a client which is still outdated.
+	upgradeRetryPeriod = time.Hour
+)
+
+var (
+	defaultUpgradeArtifacts = []string{
+		"Admin.Client.Upgrade.Windows",
+		"Admin.Client.Upgrade.Debian",
+		"Admin.Client.Upgrade.RedHat",
+	}
+
+	quarantineCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "frontend_quarantined_messages",
+		Help: "Number of messages from outdated clients which were quarantined.",
+	})
+
+	upgradeCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "frontend_client_upgrades",
+		Help: "Number of upgrade collections launched on outdated clients.",
+	})
+)
+
+type upgradeFlow struct {
+	flow_id  string
+	launched time.Time
+}
+
+type upgradeTracker struct {
+	mu sync.Mutex
+
+	min_version string
+	artifacts   []string
+
+	// The last upgrade collection launched on each outdated client.
+	flows map[string]*upgradeFlow
+}
+
+func newUpgradeTracker(config_obj *config_proto.Config) *upgradeTracker {
+	result := &upgradeTracker{
+		artifacts: defaultUpgradeArtifacts,
+		flows:     make(map[string]*upgradeFlow),
+	}
+
+	if config_obj.Frontend != nil && config_obj.Frontend.Resources != nil {
+		result.min_version = config_obj.Frontend.Resources.MinClientVersion
+		if len(config_obj.Frontend.Resources.ClientUpgradeArtifacts) > 0 {
+			result.artifacts = config_obj.Frontend.Resources.ClientUpgradeArtifacts
+		}
+	}
+
+	return result
+}
+
+// Clients which do not advertise their version are never outdated.
+func (self *upgradeTracker) IsOutdated(message_info *crypto.MessageInfo) bool {
+	if self.min_version == "" || message_info.ClientVersion == "" {
+		return false
+	}
+
+	return utils.CompareVersions("velociraptor",
+		message_info.ClientVersion, self.min_version) < 0
+}
+
+// Quarantine all the messages which do not belong to the upgrade
+// collection. Returns a MessageInfo with the remaining messages.
+func (self *upgradeTracker) Quarantine(
+	ctx context.Context, config_obj *config_proto.Config,
+	message_info *crypto.MessageInfo) (*crypto.MessageInfo, error) {
+
+	allowed := &crypto_proto.MessageList{}
+	var quarantined []*ordereddict.Dict
+
+	// Many messages belong to the same session.
+	is_upgrade := make(map[string]bool)
+
+	err := message_info.IterateJobs(ctx, config_obj,
+		func(ctx context.Context, msg *crypto_proto.VeloMessage) error {
+			upgrade, pres := is_upgrade[msg.SessionId]
+			if !pres {
+				upgrade = self.isUpgradeFlow(
+					ctx, config_obj, message_info.Source, msg.SessionId)
+				is_upgrade[msg.SessionId] = upgrade
+			}
+
+			if upgrade {
+				allowed.Job = append(allowed.Job, msg)
+				return nil
+			}
+
+			quarantined = append(quarantined, ordereddict.NewDict().
+				Set("ClientId", message_info.Source).
+				Set("ClientVersion", message_info.ClientVersion).
+				Set("SessionId", msg.SessionId).
+				Set("RequestId", msg.RequestId).
+				Set("Message", msg))
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(quarantined) > 0 {
+		quarantineCounter.Add(float64(len(quarantined)))
+
+		journal, err := services.GetJournal(config_obj)
+		if err != nil {
+			return nil, err
+		}
+
+		err = journal.PushRowsToArtifact(ctx, config_obj, quarantined,
+			"Server.Internal.Quarantine", message_info.Source, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	serialized, err := proto.Marshal(allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	result := *message_info
+	result.RawCompressed = [][]byte{serialized}
+	result.Compression = crypto_proto.PackedMessageList_UNCOMPRESSED
+
+	return &result, nil
+}
+
+func (self *upgradeTracker) isUpgradeFlow(
+	ctx context.Context, config_obj *config_proto.Config,
+	client_id, session_id string) bool {
+	self.mu.Lock()
+	flow, pres := self.flows[client_id]
+	self.mu.Unlock()
+
+	if pres && flow.flow_id != "" && flow.flow_id == session_id {
+		return true
+	}
+
+	// The collection may have been launched by another frontend or
+	// before this frontend restarted.
+	launcher, err := services.GetLauncher(config_obj)
+	if err != nil {
+		return false
+	}
+
+	collection_context, err := launcher.Storage().LoadCollectionContext(
+		ctx, config_obj, client_id, session_id)
+	if err != nil {
+		return false
+	}
+
+	return collection_context.Request.GetCreator() == upgradeCreator
+}
+
+// Returns the tasks to upgrade the client. An upgrade collection is
+// launched at most once every upgradeRetryPeriod for each client.
+func (self *upgradeTracker) UpgradeTasks(
+	ctx context.Context, config_obj *config_proto.Config,
+	client_id string) ([]*crypto_proto.VeloMessage, error) {
+
+	now := utils.GetTime().Now()
+
+	self.mu.Lock()
+	flow, pres := self.flows[client_id]
+	if pres && now.Sub(flow.launched) < upgradeRetryPeriod {
+		self.mu.Unlock()
+		return nil, nil
+	}
+
+	// Record the attempt even if it fails so we do not recompile the
+	// artifacts on every poll.
+	flow = &upgradeFlow{launched: now}
+	self.flows[client_id] = flow
+	self.expire(now)
+	self.mu.Unlock()
+
+	manager, err := services.GetRepositoryManager(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	repository, err := manager.GetGlobalRepository(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	launcher, err := services.GetLauncher(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &flows_proto.ArtifactCollectorArgs{
+		Creator:   upgradeCreator,
+		ClientId:  client_id,
+		Artifacts: self.artifacts,
+	}
+
+	compiled, err := launcher.CompileCollectorArgs(
+		ctx, config_obj, acl_managers.NullACLManager{}, repository,
+		services.CompilerOptions{}, request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send the task directly to the client rather than queuing it
+	// - the client's queued tasks are held until it is upgraded. The
+	// task is ready once the collection is written.
+	task_chan := make(chan *crypto_proto.VeloMessage, 1)
+	flow_id, err := launcher.WriteArtifactCollectionRecord(
+		ctx, config_obj, request, compiled,
+		func(task *crypto_proto.VeloMessage) {
+			task_chan <- task
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	self.mu.Lock()
+	flow.flow_id = flow_id
+	self.mu.Unlock()
+
+	upgradeCounter.Inc()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case task := <-task_chan:
+		return []*crypto_proto.VeloMessage{task}, nil
+	}
+}
+
+// Forget clients which were not seen for a while. Called with the
+// lock held.
+func (self *upgradeTracker) expire(now time.Time) {
+	for client_id, flow := range self.flows {
+		if now.Sub(flow.launched) > 2*upgradeRetryPeriod {
+			delete(self.flows, client_id)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"www.velocidex.com/golang/velociraptor/file_store/api"
+)
+
+const (
+	// Default size of the public payload cache (100mb).
+	DEFAULT_PUBLIC_CACHE_SIZE = 100 * 1024 * 1024
+)
+
+var (
+	publicCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "frontend_public_cache_hits",
+		Help: "Number of public files served from the cache.",
+	})
+
+	publicCacheMiss = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "frontend_public_cache_miss",
+		Help: "Number of public files read from the filestore.",
+	})
+)
+
+type publicCacheEntry struct {
+	key      string
+	data     []byte
+	etag     string
+	size     int64
+	mod_time time.Time
+}
+
+// Caches files served from the public directory in the filestore
+// (tools, artifact bundles etc). During a hunt many clients fetch the
+// same payload at the same time so we keep recently used files in
+// memory. Entries are validated against the filestore's size and
+// modification time on each request so updated files are never
+// served stale.
+type publicCache struct {
+	mu sync.Mutex
+
+	max_size int64
+	size     int64
+
+	evict_list *list.List
+	items      map[string]*list.Element
+}
+
+func newPublicCache(max_size int64) *publicCache {
+	return &publicCache{
+		max_size:   max_size,
+		evict_list: list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get the content of the file, either from the cache or from the
+// filestore. The returned entry must not be modified. Files too large
+// to cache return a nil entry and should be streamed by the caller.
+func (self *publicCache) Get(
+	file_store_factory api.FileStore,
+	path_spec api.FSPathSpec) (*publicCacheEntry, error) {
+
+	stat, err := file_store_factory.StatFile(path_spec)
+	if err != nil {
+		return nil, err
+	}
+
+	key := path_spec.AsClientPath()
+	entry, pres := self.get(key)
+	if pres && entry.size == stat.Size() &&
+		entry.mod_time.Equal(stat.ModTime()) {
+		publicCacheHits.Inc()
+		return entry, nil
+	}
+	publicCacheMiss.Inc()
+
+	// Very large files are not worth displacing the rest of the
+	// cache for.
+	if stat.Size() > self.max_size/4 {
+		return nil, nil
+	}
+
+	fd, err := file_store_factory.ReadFile(path_spec)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	data, err := ioutil.ReadAll(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(data)
+	entry = &publicCacheEntry{
+		key:      key,
+		data:     data,
+		etag:     `"` + hex.EncodeToString(hash[:]) + `"`,
+		size:     stat.Size(),
+		mod_time: stat.ModTime(),
+	}
+	self.set(entry)
+
+	return entry, nil
+}
+
+func (self *publicCache) get(key string) (*publicCacheEntry, bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	element, pres := self.items[key]
+	if !pres {
+		return nil, false
+	}
+
+	self.evict_list.MoveToFront(element)
+	return element.Value.(*publicCacheEntry), true
+}
+
+func (self *publicCache) set(entry *publicCacheEntry) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	element, pres := self.items[entry.key]
+	if pres {
+		self.removeElement(element)
+	}
+
+	self.items[entry.key] = self.evict_list.PushFront(entry)
+	self.size += int64(len(entry.data))
+
+	for self.size > self.max_size {
+		oldest := self.evict_list.Back()
+		if oldest == nil {
+			break
+		}
+		self.removeElement(oldest)
+	}
+}
+
+func (self *publicCache) removeElement(element *list.Element) {
+	entry := element.Value.(*publicCacheEntry)
+	self.evict_list.Remove(element)
+	delete(self.items, entry.key)
+	self.size -= int64(len(entry.data))
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"www.velocidex.com/golang/velociraptor/config"
+	"www.velocidex.com/golang/velociraptor/file_store/api"
+	"www.velocidex.com/golang/velociraptor/file_store/memory"
+	"www.velocidex.com/golang/velociraptor/file_store/path_specs"
+)
+
+func writePublicFile(t *testing.T,
+	file_store_factory api.FileStore, path_spec api.FSPathSpec, data string) {
+	fd, err := file_store_factory.WriteFile(path_spec)
+	require.NoError(t, err)
+
+	require.NoError(t, fd.Truncate())
+	_, err = fd.Write([]byte(data))
+	require.NoError(t, err)
+	fd.Close()
+}
+
+func TestPublicCache(t *testing.T) {
+	config_obj := config.GetDefaultConfig()
+	file_store_factory := memory.NewMemoryFileStore(config_obj)
+
+	cache := newPublicCache(100)
+
+	small := path_specs.NewUnsafeFilestorePath("public", "cache_test_small")
+	writePublicFile(t, file_store_factory, small, "hello")
+
+	entry, err := cache.Get(file_store_factory, small)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(entry.data))
+	etag := entry.etag
+
+	// Second read comes from the cache.
+	entry, err = cache.Get(file_store_factory, small)
+	assert.NoError(t, err)
+	assert.Equal(t, etag, entry.etag)
+	assert.Equal(t, int64(5), cache.size)
+
+	// Changing the file invalidates the cached copy.
+	writePublicFile(t, file_store_factory, small, "goodbye")
+	entry, err = cache.Get(file_store_factory, small)
+	assert.NoError(t, err)
+	assert.Equal(t, "goodbye", string(entry.data))
+	assert.NotEqual(t, etag, entry.etag)
+	assert.Equal(t, int64(7), cache.size)
+
+	// Large files are not cached at all.
+	large := path_specs.NewUnsafeFilestorePath("public", "cache_test_large")
+	writePublicFile(t, file_store_factory, large, string(make([]byte, 50)))
+
+	entry, err = cache.Get(file_store_factory, large)
+	assert.NoError(t, err)
+	assert.Nil(t, entry)
+
+	// Filling the cache evicts the least recently used entries.
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		path_spec := path_specs.NewUnsafeFilestorePath("public", name)
+		writePublicFile(t, file_store_factory, path_spec,
+			string(make([]byte, 20)))
+		_, err = cache.Get(file_store_factory, path_spec)
+		assert.NoError(t, err)
+	}
+	assert.True(t, cache.size <= 100)
+
+	_, pres := cache.get(small.AsClientPath())
+	assert.False(t, pres)
+}
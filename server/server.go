@@ -33,11 +33,13 @@ import (
 	"www.velocidex.com/golang/velociraptor/constants"
 	"www.velocidex.com/golang/velociraptor/crypto"
 	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/crypto/recorder"
 	crypto_server "www.velocidex.com/golang/velociraptor/crypto/server"
 	"www.velocidex.com/golang/velociraptor/flows"
 	"www.velocidex.com/golang/velociraptor/logging"
 	"www.velocidex.com/golang/velociraptor/services"
 	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/utils/usage"
 )
 
 const (
@@ -55,6 +57,9 @@ type Server struct {
 	reader_concurrency  *utils.Concurrency
 	concurrency_timeout time.Duration
 	throttler           *utils.Throttler
+	enroll_throttler    *enrollmentThrottler
+	enroll_limiter      *enrollmentSigningLimiter
+	upgrades            *upgradeTracker
 
 	// The server dynamically adjusts concurrency. This signals exit.
 	done chan bool
@@ -82,6 +87,9 @@ func (self *Server) Close() {
 	if self.throttler != nil {
 		self.throttler.Close()
 	}
+	if self.enroll_throttler != nil {
+		self.enroll_throttler.Close()
+	}
 }
 
 func NewServer(ctx context.Context,
@@ -130,6 +138,24 @@ func NewServer(ctx context.Context,
 		result.throttler = utils.NewThrottler(config_obj.Frontend.Resources.ConnectionsPerSecond)
 	}
 
+	if config_obj.Frontend.Resources.EnrollmentsPerIpPerMinute > 0 {
+		result.logger.Info("Throttling enrolments to %v per minute per address",
+			config_obj.Frontend.Resources.EnrollmentsPerIpPerMinute)
+		result.enroll_throttler = newEnrollmentThrottler(
+			config_obj.Frontend.Resources.EnrollmentsPerIpPerMinute)
+	}
+
+	if config_obj.Frontend.Resources.EnrollmentSigningRate > 0 {
+		result.logger.Info("Limiting enrolments to %v per second",
+			config_obj.Frontend.Resources.EnrollmentSigningRate)
+		result.enroll_limiter = newEnrollmentSigningLimiter(
+			config_obj.Frontend.Resources.EnrollmentSigningRate,
+			config_obj.Frontend.Resources.EnrollmentQueueDepth,
+			utils.RealClock{})
+	}
+
+	result.upgrades = newUpgradeTracker(config_obj)
+
 	if config_obj.Frontend.Resources.GlobalUploadRate > 0 {
 		result.logger.Info("Global upload rate set to %v bytes per second",
 			config_obj.Frontend.Resources.GlobalUploadRate)
@@ -158,6 +184,16 @@ func (self *Server) ProcessSingleUnauthenticatedMessage(
 			return err
 		}
 
+		// Wait for our turn to enrol. If too many clients are
+		// already waiting the client will retry later.
+		if self.enroll_limiter != nil {
+			err = self.enroll_limiter.Wait(ctx)
+			if err != nil {
+				enrollmentRejectedCounter.Inc()
+				return err
+			}
+		}
+
 		err = enroll(ctx, config_obj, self, message.CSR)
 		if err != nil {
 			self.logger.Error(fmt.Sprintf("Enrol Error: %s", err))
@@ -172,6 +208,13 @@ func (self *Server) ProcessUnauthenticatedMessages(
 	ctx context.Context, config_obj *config_proto.Config,
 	message_info *crypto.MessageInfo) error {
 
+	// Reject floods of enrolment requests before doing any expensive
+	// work on them.
+	if self.enroll_throttler != nil &&
+		!self.enroll_throttler.Allow(message_info.RemoteAddr) {
+		return enrollmentThrottledError
+	}
+
 	return message_info.IterateJobs(ctx, config_obj,
 		self.ProcessSingleUnauthenticatedMessage)
 }
@@ -208,6 +251,25 @@ func (self *Server) Decrypt(ctx context.Context, request []byte) (
 	return message_info, nil
 }
 
+// Account the bytes received from the client against its org and
+// labels.
+func recordIngestedBytes(ctx context.Context,
+	config_obj *config_proto.Config, message_info *crypto.MessageInfo) {
+	var size int64
+	for _, raw := range message_info.RawCompressed {
+		size += int64(len(raw))
+	}
+
+	var labels []string
+	labeler := services.GetLabeler(config_obj)
+	if labeler != nil {
+		labels = labeler.GetClientLabels(ctx, config_obj, message_info.Source)
+	}
+
+	usage.AddBytesIngested(
+		utils.NormalizedOrgId(config_obj.OrgId), labels, size)
+}
+
 func (self *Server) Process(
 	ctx context.Context,
 	message_info *crypto.MessageInfo,
@@ -226,6 +288,34 @@ func (self *Server) Process(
 		return nil, 0, err
 	}
 
+	recordIngestedBytes(ctx, config_obj, message_info)
+
+	var comms_recorder *recorder.Recorder
+	if config_obj.Frontend != nil {
+		comms_recorder = recorder.GetRecorder(
+			config_obj.Frontend.CommsRecordingPath)
+	}
+
+	if comms_recorder != nil {
+		received := &crypto_proto.MessageList{}
+		_ = message_info.IterateJobs(ctx, config_obj,
+			func(ctx context.Context, msg *crypto_proto.VeloMessage) error {
+				received.Job = append(received.Job, msg)
+				return nil
+			})
+		comms_recorder.Record(recorder.RECEIVED, message_info.Source, received)
+	}
+
+	// Clients which are too old only get to complete their upgrade.
+	outdated := self.upgrades.IsOutdated(message_info)
+	if outdated {
+		message_info, err = self.upgrades.Quarantine(
+			ctx, config_obj, message_info)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
 	// Older clients
 	if message_info.Version < constants.CLIENT_API_VERSION_0_6_8 {
 		runner := flows.NewLegacyFlowRunner(config_obj)
@@ -274,7 +364,16 @@ func (self *Server) Process(
 	}
 
 	message_list := &crypto_proto.MessageList{}
-	if drain_requests_for_client {
+	if drain_requests_for_client && outdated {
+		tasks, err := self.upgrades.UpgradeTasks(
+			ctx, config_obj, message_info.Source)
+		if err != nil {
+			self.Error("Unable to upgrade client %v (version %v): %v",
+				message_info.Source, message_info.ClientVersion, err)
+		}
+		message_list.Job = append(message_list.Job, tasks...)
+
+	} else if drain_requests_for_client {
 		tasks, err := client_info_manager.GetClientTasks(ctx, message_info.Source)
 		if err == nil {
 			message_list.Job = append(message_list.Job, tasks...)
@@ -287,6 +386,8 @@ func (self *Server) Process(
 		}
 	*/
 
+	comms_recorder.Record(recorder.SENT, message_info.Source, message_list)
+
 	nonce := ""
 	if config_obj.Client != nil {
 		nonce = config_obj.Client.Nonce
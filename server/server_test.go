@@ -15,6 +15,7 @@ import (
 	"github.com/sebdah/goldie"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"google.golang.org/protobuf/proto"
 	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
 	"www.velocidex.com/golang/velociraptor/api"
 	api_proto "www.velocidex.com/golang/velociraptor/api/proto"
@@ -73,6 +74,9 @@ sources:
 `, `
 name: Server.Internal.Alerts
 type: SERVER_EVENT
+`, `
+name: Server.Internal.Quarantine
+type: INTERNAL
 `}
 )
 
@@ -779,6 +783,115 @@ func (self *ServerTestSuite) TestUnknownFlow() {
 	assert.NoError(t, err)
 }
 
+// Clients older than the minimum version are only served an upgrade
+// collection and their other results are quarantined.
+func (self *ServerTestSuite) TestOutdatedClient() {
+	t := self.T()
+
+	self.ConfigObj.Frontend.Resources.MinClientVersion = "0.7.0"
+	self.ConfigObj.Frontend.Resources.ClientUpgradeArtifacts = []string{
+		"Generic.Client.Info"}
+
+	server_obj, err := server.NewServer(self.Sm.Ctx, self.ConfigObj, self.Sm.Wg)
+	require.NoError(t, err)
+
+	// A regular collection is waiting for the client.
+	flow_id, err := self.createArtifactCollection()
+	require.NoError(t, err)
+
+	client_info_manager, err := services.GetClientInfoManager(self.ConfigObj)
+	require.NoError(t, err)
+
+	vtesting.WaitUntil(time.Second, t, func() bool {
+		tasks, err := client_info_manager.PeekClientTasks(self.Ctx, self.client_id)
+		assert.NoError(t, err)
+		return len(tasks) == 1
+	})
+
+	message_info := func(version string,
+		messages ...*crypto_proto.VeloMessage) *crypto.MessageInfo {
+		serialized, err := proto.Marshal(&crypto_proto.MessageList{Job: messages})
+		require.NoError(t, err)
+
+		return &crypto.MessageInfo{
+			Version:       constants.CLIENT_API_VERSION,
+			RawCompressed: [][]byte{serialized},
+			Authenticated: true,
+			Source:        self.client_id,
+			ClientVersion: version,
+		}
+	}
+
+	// The outdated client only receives the upgrade collection.
+	response, count, err := server_obj.Process(self.Ctx,
+		message_info("0.6.9"), server.DrainRequestsForClient)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	received, err := self.client_crypto.Decrypt(response)
+	require.NoError(t, err)
+
+	var upgrade_flow_id string
+	err = received.IterateJobs(self.Ctx, self.ConfigObj,
+		func(ctx context.Context, msg *crypto_proto.VeloMessage) error {
+			upgrade_flow_id = msg.SessionId
+			return nil
+		})
+	require.NoError(t, err)
+	assert.True(t, upgrade_flow_id != "")
+	assert.True(t, upgrade_flow_id != flow_id)
+
+	// The regular collection is still queued.
+	tasks, err := client_info_manager.PeekClientTasks(self.Ctx, self.client_id)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(tasks))
+	assert.Equal(t, flow_id, tasks[0].SessionId)
+
+	// The upgrade collection is not launched again on the next poll.
+	_, count, err = server_obj.Process(self.Ctx,
+		message_info("0.6.9"), server.DrainRequestsForClient)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// Results for the upgrade collection are processed but all
+	// other results are quarantined.
+	wg := &sync.WaitGroup{}
+	quarantined := []*ordereddict.Dict{}
+
+	wg.Add(1)
+	services.GetPublishedEvents(
+		self.ConfigObj, "Server.Internal.Quarantine", wg, 1, &quarantined)
+
+	_, _, err = server_obj.Process(self.Ctx, message_info("0.6.9",
+		&crypto_proto.VeloMessage{
+			SessionId: flow_id,
+			LogMessage: &crypto_proto.LogMessage{
+				Jsonl: "{\"message\":\"Quarantined\"}\n",
+			},
+		}, &crypto_proto.VeloMessage{
+			SessionId: upgrade_flow_id,
+			LogMessage: &crypto_proto.LogMessage{
+				Jsonl: "{\"message\":\"Upgrading\"}\n",
+			},
+		}), server.DoNotDrainRequestsForClient)
+	require.NoError(t, err)
+
+	wg.Wait()
+
+	session_id, _ := quarantined[0].GetString("SessionId")
+	assert.Equal(t, flow_id, session_id)
+
+	self.RequiredFilestoreContains(
+		paths.NewFlowPathManager(self.client_id, upgrade_flow_id).Log(),
+		"Upgrading")
+
+	// Up to date clients receive their queued tasks.
+	_, count, err = server_obj.Process(self.Ctx,
+		message_info("0.7.1"), server.DrainRequestsForClient)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
 func TestServerTestSuite(t *testing.T) {
 	suite.Run(t, new(ServerTestSuite))
 }
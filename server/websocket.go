@@ -132,8 +132,10 @@ func ws_receive_client_messages(
 			return send_error(ws, err, http.StatusForbidden)
 		}
 
-		message_info.RemoteAddr = utils.RemoteAddr(
-			req, config_obj.Frontend.GetProxyHeader())
+		message_info.RemoteAddr = utils.RemoteAddrFromTrustedProxy(
+			req, config_obj.Frontend.GetProxyHeader(),
+			config_obj.Frontend.GetTrustedProxies())
+		message_info.ClientVersion = clientVersion(req)
 
 		server_obj.Debug("Received a WS post of length %v from %v (%v)",
 			len(message), message_info.RemoteAddr, message_info.Source)
@@ -264,8 +266,10 @@ func ws_send_client_messages(
 			return send_error(ws, err, http.StatusForbidden)
 		}
 
-		message_info.RemoteAddr = utils.RemoteAddr(
-			req, config_obj.Frontend.GetProxyHeader())
+		message_info.RemoteAddr = utils.RemoteAddrFromTrustedProxy(
+			req, config_obj.Frontend.GetProxyHeader(),
+			config_obj.Frontend.GetTrustedProxies())
+		message_info.ClientVersion = clientVersion(req)
 
 		server_obj.Debug("Received a WS post of length %v from %v (%v)",
 			len(message), message_info.RemoteAddr, message_info.Source)
@@ -24,4 +24,15 @@ type AlertMessage struct {
 	// Managed by the server
 	AssignedToUser string `json:"assigned_user,omitempty"`
 	Actioned       bool   `json:"actioned,omitempty"`
+
+	// Set when the alert enters the triage workflow.
+	AlertId string `json:"alert_id,omitempty"`
+	State   string `json:"state,omitempty"`
 }
+
+// The lifecycle of a triaged alert.
+const (
+	ALERT_STATE_NEW          = "new"
+	ALERT_STATE_ACKNOWLEDGED = "acknowledged"
+	ALERT_STATE_CLOSED       = "closed"
+)
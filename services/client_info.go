@@ -2,12 +2,15 @@ package services
 
 import (
 	"context"
+	"time"
 
 	"github.com/Velocidex/ordereddict"
 	"google.golang.org/protobuf/proto"
 	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
 	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
 	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/utils"
 )
 
 const (
@@ -28,6 +31,12 @@ type Stats struct {
 	LastHuntTimestamp     uint64 `json:"LastHuntTimestamp,omitempty"`
 	LastEventTableVersion uint64 `json:"LastEventTableVersion,omitempty"`
 	IpAddress             string `json:"IpAddress,omitempty"`
+
+	// From the client heartbeat.
+	HeartbeatStatus string `json:"HeartbeatStatus,omitempty"`
+	QueuedBytes     uint64 `json:"QueuedBytes,omitempty"`
+	DroppedMessages uint64 `json:"DroppedMessages,omitempty"`
+	DroppedBytes    uint64 `json:"DroppedBytes,omitempty"`
 }
 
 func GetClientInfoManager(config_obj *config_proto.Config) (ClientInfoManager, error) {
@@ -39,6 +48,37 @@ func GetClientInfoManager(config_obj *config_proto.Config) (ClientInfoManager, e
 	return org_manager.Services(config_obj.OrgId).ClientInfoManager()
 }
 
+// A group task is a single collection request addressed to all the
+// clients carrying a label. Rather than queuing the request for each
+// client up front, the collection is scheduled on each client when
+// it next checks in (until the task expires).
+type GroupTask struct {
+	Id      string `json:"Id"`
+	Label   string `json:"Label"`
+	Creator string `json:"Creator"`
+	Created int64  `json:"Created"`
+	Expires int64  `json:"Expires"`
+
+	// The compiled collection request - the ClientId is filled in
+	// for each client.
+	Request *flows_proto.ArtifactCollectorArgs `json:"-"`
+}
+
+// A watched client raises an alert when it next checks in. This
+// allows analysts to be notified as soon as a client which is
+// currently offline returns. An optional collection is launched on
+// the client at the same time.
+type WatchedClient struct {
+	ClientId string `json:"ClientId"`
+	Comment  string `json:"Comment"`
+	Creator  string `json:"Creator"`
+	Created  int64  `json:"Created"`
+
+	// The compiled collection request to launch when the client
+	// checks in (may be nil).
+	Request *flows_proto.ArtifactCollectorArgs `json:"-"`
+}
+
 type ClientInfo struct {
 	// The original info from disk
 	actions_proto.ClientInfo
@@ -61,6 +101,23 @@ func (self ClientInfo) OS() ClientOS {
 	return Unknown
 }
 
+// Clients are interrogated when they first enroll and optionally
+// again when the last interrogation is too old.
+func (self ClientInfo) NeedsInterrogation(config_obj *config_proto.Config) bool {
+	if self.LastInterrogateFlowId == "" {
+		return true
+	}
+
+	if config_obj.Defaults == nil ||
+		config_obj.Defaults.ReinterrogatePeriodHours <= 0 {
+		return false
+	}
+
+	period := time.Duration(config_obj.Defaults.ReinterrogatePeriodHours) * time.Hour
+	last := time.Unix(int64(self.LastInterrogateTime), 0)
+	return utils.GetTime().Now().Sub(last) > period
+}
+
 type ClientInfoManager interface {
 	ListClients(ctx context.Context) <-chan string
 
@@ -111,6 +168,44 @@ type ClientInfoManager interface {
 		client_id string,
 		req *crypto_proto.VeloMessage) error
 
+	// Queue a collection for all clients with the label. The
+	// collection is only scheduled on each client when it checks in.
+	QueueGroupTask(ctx context.Context, task *GroupTask) (*GroupTask, error)
+
+	// List the group tasks which have not expired yet.
+	ListGroupTasks(ctx context.Context) ([]*GroupTask, error)
+
+	// Remove the group task so it is not scheduled on any more
+	// clients.
+	DeleteGroupTask(ctx context.Context, id string) error
+
+	// Raise an alert when the client next checks in. The client is
+	// removed from the watch list once the alert fires.
+	WatchClient(ctx context.Context, watch *WatchedClient) (*WatchedClient, error)
+
+	// List the clients which did not check in since they were
+	// watched.
+	ListWatchedClients(ctx context.Context) ([]*WatchedClient, error)
+
+	// Stop watching the client.
+	UnwatchClient(ctx context.Context, client_id string) error
+
+	// The client reported progress on a flow so its request was
+	// received and does not need to be delivered again.
+	ReleaseTaskLease(client_id, flow_id string)
+
+	// The client sent a message for the flow. Flows which are not
+	// heard from for a while are marked as orphaned.
+	FlowActive(client_id, flow_id string)
+
+	// The flow is complete or cancelled and no longer needs to be
+	// watched.
+	FlowDone(client_id, flow_id string)
+
+	// Return and forget the flows which were orphaned while the
+	// client was away so they can be issued again.
+	TakeOrphanedFlows(client_id string) []string
+
 	// Be able to manipulate the client and server metadata.
 	GetMetadata(ctx context.Context,
 		client_id string) (*ordereddict.Dict, error)
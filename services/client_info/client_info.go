@@ -62,6 +62,16 @@ type ClientInfoManager struct {
 	mutation_manager *MutationManager
 
 	storage *Store
+
+	// Only set when task leasing is enabled.
+	leases *taskLeases
+
+	// Only set when orphaned flow detection is enabled.
+	watchdog *flowWatchdog
+
+	group_tasks *groupTasks
+
+	watch_list *watchList
 }
 
 func (self *ClientInfoManager) ListClients(ctx context.Context) <-chan string {
@@ -159,6 +169,15 @@ func (self *ClientInfoManager) UpdateStats(
 		record.LastEventTableVersion = stats.LastEventTableVersion
 	}
 
+	// The heartbeat changes on every poll so it is only kept on
+	// this frontend and not synced through the mutation manager.
+	if stats.HeartbeatStatus != "" {
+		record.HeartbeatStatus = stats.HeartbeatStatus
+		record.QueuedBytes = stats.QueuedBytes
+		record.DroppedMessages = stats.DroppedMessages
+		record.DroppedBytes = stats.DroppedBytes
+	}
+
 	return self.storage.SetRecord(record)
 }
 
@@ -179,6 +198,24 @@ func (self *ClientInfoManager) Start(
 		self.MutationSync(ctx, config_obj)
 	}()
 
+	if self.leases != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			self.requeueExpiredLeases(ctx, config_obj)
+		}()
+	}
+
+	if self.watchdog != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			self.markOrphanedFlows(ctx, config_obj)
+		}()
+	}
+
 	// Only the master node writes to storage - there is no need to
 	// flush to disk that frequently because the master keeps a hot
 	// copy of the data in memory.
@@ -238,6 +275,34 @@ func (self *ClientInfoManager) Start(
 		return err
 	}
 
+	// All frontends reload the group tasks when they change.
+	err = self.group_tasks.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = journal.WatchQueueWithCB(ctx, config_obj, wg,
+		"Server.Internal.GroupTasks",
+		"ClientInfoManager",
+		self.ProcessGroupTasks)
+	if err != nil {
+		return err
+	}
+
+	// All frontends reload the watch list when it changes.
+	err = self.watch_list.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = journal.WatchQueueWithCB(ctx, config_obj, wg,
+		"Server.Internal.WatchList",
+		"ClientInfoManager",
+		self.ProcessWatchList)
+	if err != nil {
+		return err
+	}
+
 	// The master will be informed when new clients appear.
 	err = journal.WatchQueueWithCB(ctx, config_obj, wg,
 		"Server.Internal.ClientPing",
@@ -465,9 +530,23 @@ func NewClientInfoManager(
 		config_obj:       config_obj,
 		uuid:             utils.GetGUID(),
 		mutation_manager: NewMutationManager(),
+		group_tasks:      newGroupTasks(config_obj),
+		watch_list:       newWatchList(config_obj),
 	}
 	service.storage = NewStorage(service.uuid)
 
+	if config_obj.Defaults != nil &&
+		config_obj.Defaults.TaskLeaseTimeoutSec > 0 {
+		service.leases = newTaskLeases(time.Duration(
+			config_obj.Defaults.TaskLeaseTimeoutSec) * time.Second)
+	}
+
+	if config_obj.Defaults != nil &&
+		config_obj.Defaults.FlowOrphanTimeoutSec > 0 {
+		service.watchdog = newFlowWatchdog(time.Duration(
+			config_obj.Defaults.FlowOrphanTimeoutSec) * time.Second)
+	}
+
 	err := service.storage.LoadFromSnapshot(ctx, config_obj)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,417 @@
+/*
+  Group tasks allow a single collection to be addressed to all the
+  clients carrying a label.
+
+  Queuing a collection on every client in a large deployment
+  requires a queue write per client up front. Instead we store a
+  single group task and schedule the collection on each client when
+  it checks in. We remember which clients already received the task
+  so each client only runs it once.
+
+  All frontends follow the Server.Internal.GroupTasks queue to reload
+  the active group tasks when they change.
+*/
+
+package client_info
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Velocidex/ordereddict"
+	"google.golang.org/protobuf/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/datastore"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+// How we store the group task in the datastore. The request is
+// stored as a serialized protobuf.
+type groupTaskRecord struct {
+	Id      string `json:"Id"`
+	Label   string `json:"Label"`
+	Creator string `json:"Creator"`
+	Created int64  `json:"Created"`
+	Expires int64  `json:"Expires"`
+	Request []byte `json:"Request"`
+}
+
+// Written for each client the group task was scheduled on.
+type groupTaskDelivery struct {
+	FlowId    string `json:"FlowId"`
+	Scheduled int64  `json:"Scheduled"`
+}
+
+type groupTasks struct {
+	mu sync.Mutex
+
+	config_obj *config_proto.Config
+
+	// Active group tasks by id.
+	tasks map[string]*services.GroupTask
+
+	// Group task id -> client ids the task was scheduled on.
+	delivered map[string]map[string]bool
+}
+
+func newGroupTasks(config_obj *config_proto.Config) *groupTasks {
+	return &groupTasks{
+		config_obj: config_obj,
+		tasks:      make(map[string]*services.GroupTask),
+		delivered:  make(map[string]map[string]bool),
+	}
+}
+
+func (self *groupTasks) Get(id string) (*services.GroupTask, error) {
+	raw_db, err := getRawDB(self.config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := raw_db.GetBuffer(self.config_obj, paths.GroupTaskPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.NotFoundError, id)
+	}
+
+	record := &groupTaskRecord{}
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &flows_proto.ArtifactCollectorArgs{}
+	err = proto.Unmarshal(record.Request, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &services.GroupTask{
+		Id:      record.Id,
+		Label:   record.Label,
+		Creator: record.Creator,
+		Created: record.Created,
+		Expires: record.Expires,
+		Request: request,
+	}, nil
+}
+
+func (self *groupTasks) Set(task *services.GroupTask) error {
+	raw_db, err := getRawDB(self.config_obj)
+	if err != nil {
+		return err
+	}
+
+	serialized, err := proto.Marshal(task.Request)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(&groupTaskRecord{
+		Id:      task.Id,
+		Label:   task.Label,
+		Creator: task.Creator,
+		Created: task.Created,
+		Expires: task.Expires,
+		Request: serialized,
+	})
+	if err != nil {
+		return err
+	}
+
+	return raw_db.SetBuffer(self.config_obj, paths.GroupTaskPath(task.Id),
+		data, utils.SyncCompleter)
+}
+
+// Reload the active group tasks from the datastore. Expired tasks
+// are removed by the master.
+func (self *groupTasks) Load(ctx context.Context) error {
+	db, err := datastore.GetDB(self.config_obj)
+	if err != nil {
+		return err
+	}
+
+	children, err := db.ListChildren(self.config_obj, paths.GROUP_TASKS_ROOT)
+	if err != nil {
+		return err
+	}
+
+	now := utils.GetTime().Now().Unix()
+	tasks := make(map[string]*services.GroupTask)
+	for _, child := range children {
+		if child.IsDir() {
+			continue
+		}
+
+		task, err := self.Get(child.Base())
+		if err != nil {
+			continue
+		}
+
+		if task.Expires < now {
+			if services.IsMaster(self.config_obj) {
+				_ = db.DeleteSubject(self.config_obj,
+					paths.GroupTaskPath(task.Id))
+			}
+			continue
+		}
+		tasks[task.Id] = task
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.tasks = tasks
+	for id := range self.delivered {
+		_, pres := tasks[id]
+		if !pres {
+			delete(self.delivered, id)
+		}
+	}
+
+	return nil
+}
+
+func (self *groupTasks) List() []*services.GroupTask {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	now := utils.GetTime().Now().Unix()
+	result := make([]*services.GroupTask, 0, len(self.tasks))
+	for _, task := range self.tasks {
+		if task.Expires >= now {
+			result = append(result, task)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created < result[j].Created
+	})
+	return result
+}
+
+// Claim all the active tasks which were not yet scheduled on the
+// client. The common case of no group tasks requires no IO.
+func (self *groupTasks) claim(client_id string) []*services.GroupTask {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if len(self.tasks) == 0 {
+		return nil
+	}
+
+	now := utils.GetTime().Now().Unix()
+	var result []*services.GroupTask
+	for id, task := range self.tasks {
+		if task.Expires < now {
+			continue
+		}
+
+		delivered, pres := self.delivered[id]
+		if !pres {
+			delivered = make(map[string]bool)
+			self.delivered[id] = delivered
+		}
+
+		if delivered[client_id] {
+			continue
+		}
+		delivered[client_id] = true
+		result = append(result, task)
+	}
+
+	return result
+}
+
+func (self *groupTasks) unclaim(client_id, id string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	delivered, pres := self.delivered[id]
+	if pres {
+		delete(delivered, client_id)
+	}
+}
+
+// Schedule any outstanding group tasks on the client.
+func (self *ClientInfoManager) scheduleGroupTasks(
+	ctx context.Context, client_id string) {
+
+	if client_id == "server" {
+		return
+	}
+
+	tasks := self.group_tasks.claim(client_id)
+	if len(tasks) == 0 {
+		return
+	}
+
+	labeler := services.GetLabeler(self.config_obj)
+	if labeler == nil {
+		return
+	}
+
+	for _, task := range tasks {
+		// The client may be labeled later so it needs to be
+		// checked again.
+		if !labeler.IsLabelSet(ctx, self.config_obj, client_id, task.Label) {
+			self.group_tasks.unclaim(client_id, task.Id)
+			continue
+		}
+
+		err := self.scheduleGroupTask(ctx, client_id, task)
+		if err != nil {
+			logger := logging.GetLogger(self.config_obj, &logging.FrontendComponent)
+			logger.Error("ClientInfoManager: scheduling group task %v on %v: %v",
+				task.Id, client_id, err)
+		}
+	}
+}
+
+func (self *ClientInfoManager) scheduleGroupTask(
+	ctx context.Context, client_id string, task *services.GroupTask) error {
+
+	raw_db, err := getRawDB(self.config_obj)
+	if err != nil {
+		return err
+	}
+
+	// The task may have been scheduled before a restart or by
+	// another frontend.
+	client_path_manager := paths.NewClientPathManager(client_id)
+	_, err = raw_db.GetBuffer(self.config_obj,
+		client_path_manager.GroupTask(task.Id))
+	if err == nil {
+		return nil
+	}
+
+	launcher, err := services.GetLauncher(self.config_obj)
+	if err != nil {
+		return err
+	}
+
+	request := proto.Clone(task.Request).(*flows_proto.ArtifactCollectorArgs)
+	request.ClientId = client_id
+	request.FlowId = ""
+
+	flow_id, err := launcher.WriteArtifactCollectionRecord(
+		ctx, self.config_obj, request, task.Request.CompiledCollectorArgs,
+		func(message *crypto_proto.VeloMessage) {
+			// Queue and notify the client about the new tasks
+			err := self.QueueMessageForClient(ctx, client_id, message,
+				services.NOTIFY_CLIENT, utils.BackgroundWriter)
+			if err != nil {
+				logger := logging.GetLogger(self.config_obj, &logging.FrontendComponent)
+				logger.Error("ClientInfoManager: queuing group task %v on %v: %v",
+					task.Id, client_id, err)
+			}
+		})
+	if err != nil {
+		self.group_tasks.unclaim(client_id, task.Id)
+		return err
+	}
+
+	data, err := json.Marshal(&groupTaskDelivery{
+		FlowId:    flow_id,
+		Scheduled: utils.GetTime().Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return raw_db.SetBuffer(self.config_obj,
+		client_path_manager.GroupTask(task.Id), data, utils.BackgroundWriter)
+}
+
+func (self *ClientInfoManager) QueueGroupTask(
+	ctx context.Context, task *services.GroupTask) (*services.GroupTask, error) {
+
+	if task.Label == "" {
+		return nil, errors.New("QueueGroupTask: a label is required")
+	}
+
+	if task.Request == nil || len(task.Request.CompiledCollectorArgs) == 0 {
+		return nil, errors.New("QueueGroupTask: request must be compiled")
+	}
+
+	now := utils.GetTime().Now().Unix()
+	if task.Expires <= now {
+		return nil, errors.New("QueueGroupTask: task expires in the past")
+	}
+
+	task.Id = "G." + utils.NextId()
+	task.Created = now
+
+	err := self.group_tasks.Set(task)
+	if err != nil {
+		return nil, err
+	}
+
+	return task, self.notifyGroupTasks(ctx, task.Id)
+}
+
+func (self *ClientInfoManager) ListGroupTasks(
+	ctx context.Context) ([]*services.GroupTask, error) {
+	return self.group_tasks.List(), nil
+}
+
+func (self *ClientInfoManager) DeleteGroupTask(
+	ctx context.Context, id string) error {
+	db, err := datastore.GetDB(self.config_obj)
+	if err != nil {
+		return err
+	}
+
+	err = db.DeleteSubject(self.config_obj, paths.GroupTaskPath(id))
+	if err != nil {
+		return err
+	}
+
+	return self.notifyGroupTasks(ctx, id)
+}
+
+// Reload the group tasks and tell all the other frontends to do the
+// same.
+func (self *ClientInfoManager) notifyGroupTasks(
+	ctx context.Context, id string) error {
+	err := self.group_tasks.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	journal, err := services.GetJournal(self.config_obj)
+	if err != nil {
+		return err
+	}
+
+	return journal.PushRowsToArtifact(ctx, self.config_obj,
+		[]*ordereddict.Dict{ordereddict.NewDict().Set("Id", id)},
+		"Server.Internal.GroupTasks", "server", "")
+}
+
+func (self *ClientInfoManager) ProcessGroupTasks(
+	ctx context.Context, config_obj *config_proto.Config,
+	row *ordereddict.Dict) error {
+	return self.group_tasks.Load(ctx)
+}
+
+func getRawDB(config_obj *config_proto.Config) (datastore.RawDataStore, error) {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	raw_db, ok := db.(datastore.RawDataStore)
+	if !ok {
+		return nil, errors.New("Datastore has no raw access.")
+	}
+	return raw_db, nil
+}
@@ -0,0 +1,79 @@
+package client_info_test
+
+import (
+	"time"
+
+	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vtesting"
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func (self *ClientInfoTestSuite) TestGroupTasks() {
+	client_info_manager, err := services.GetClientInfoManager(self.ConfigObj)
+	assert.NoError(self.T(), err)
+
+	labeler := services.GetLabeler(self.ConfigObj)
+	err = labeler.SetClientLabel(self.Ctx, self.ConfigObj, self.client_id, "Group1")
+	assert.NoError(self.T(), err)
+
+	task, err := client_info_manager.QueueGroupTask(self.Ctx, &services.GroupTask{
+		Label:   "Group1",
+		Expires: utils.GetTime().Now().Add(time.Hour).Unix(),
+		Request: &flows_proto.ArtifactCollectorArgs{
+			Artifacts: []string{"Generic.Client.Info"},
+			CompiledCollectorArgs: []*actions_proto.VQLCollectorArgs{{
+				Query: []*actions_proto.VQLRequest{{VQL: "SELECT * FROM info()"}},
+			}},
+		},
+	})
+	assert.NoError(self.T(), err)
+
+	tasks, err := client_info_manager.ListGroupTasks(self.Ctx)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 1, len(tasks))
+	assert.Equal(self.T(), task.Id, tasks[0].Id)
+
+	// A client without the label does not receive the collection.
+	other_client_id := "C.5678"
+	_, err = client_info_manager.GetClientTasks(self.Ctx, other_client_id)
+	assert.NoError(self.T(), err)
+
+	queued, err := client_info_manager.PeekClientTasks(self.Ctx, other_client_id)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 0, len(queued))
+
+	// Checking in schedules the collection on the labeled client.
+	_, err = client_info_manager.GetClientTasks(self.Ctx, self.client_id)
+	assert.NoError(self.T(), err)
+
+	vtesting.WaitUntil(2*time.Second, self.T(), func() bool {
+		queued, err := client_info_manager.PeekClientTasks(
+			self.Ctx, self.client_id)
+		assert.NoError(self.T(), err)
+		return len(queued) == 1 && queued[0].FlowRequest != nil
+	})
+
+	delivered, err := client_info_manager.GetClientTasks(self.Ctx, self.client_id)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 1, len(delivered))
+
+	// The collection is only scheduled once on each client.
+	delivered, err = client_info_manager.GetClientTasks(self.Ctx, self.client_id)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 0, len(delivered))
+
+	queued, err = client_info_manager.PeekClientTasks(self.Ctx, self.client_id)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 0, len(queued))
+
+	// Removing the task stops it from being scheduled.
+	err = client_info_manager.DeleteGroupTask(self.Ctx, task.Id)
+	assert.NoError(self.T(), err)
+
+	tasks, err = client_info_manager.ListGroupTasks(self.Ctx)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 0, len(tasks))
+}
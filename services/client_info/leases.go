@@ -0,0 +1,138 @@
+package client_info
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+type taskLease struct {
+	task    *crypto_proto.VeloMessage
+	expires time.Time
+}
+
+// Flow requests are removed from the queue when they are delivered to
+// the client. If the client crashes before it starts processing them
+// the collection would silently never run. We therefore keep a lease
+// on each delivered request until the client reports any progress on
+// the flow. Expired leases are queued again.
+type taskLeases struct {
+	mu      sync.Mutex
+	timeout time.Duration
+
+	// client id -> flow id -> lease
+	leases map[string]map[string]*taskLease
+}
+
+func newTaskLeases(timeout time.Duration) *taskLeases {
+	return &taskLeases{
+		timeout: timeout,
+		leases:  make(map[string]map[string]*taskLease),
+	}
+}
+
+func (self *taskLeases) Lease(
+	client_id string, tasks []*crypto_proto.VeloMessage) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	expires := utils.GetTime().Now().Add(self.timeout)
+	for _, task := range tasks {
+		// Other tasks do not produce a response we can wait for.
+		if !isFlowRequest(task) {
+			continue
+		}
+
+		client_leases, pres := self.leases[client_id]
+		if !pres {
+			client_leases = make(map[string]*taskLease)
+			self.leases[client_id] = client_leases
+		}
+		client_leases[task.SessionId] = &taskLease{
+			task:    task,
+			expires: expires,
+		}
+	}
+}
+
+// Sealed tasks record whether they hold a flow request.
+func isFlowRequest(task *crypto_proto.VeloMessage) bool {
+	return task.FlowRequest != nil ||
+		(task.Sealed != nil && task.Sealed.FlowRequest)
+}
+
+func (self *taskLeases) Release(client_id, flow_id string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	client_leases, pres := self.leases[client_id]
+	if !pres {
+		return
+	}
+
+	delete(client_leases, flow_id)
+	if len(client_leases) == 0 {
+		delete(self.leases, client_id)
+	}
+}
+
+// Remove and return all the expired tasks by client id.
+func (self *taskLeases) Expired(
+	now time.Time) map[string][]*crypto_proto.VeloMessage {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	result := make(map[string][]*crypto_proto.VeloMessage)
+	for client_id, client_leases := range self.leases {
+		for flow_id, lease := range client_leases {
+			if now.After(lease.expires) {
+				result[client_id] = append(result[client_id], lease.task)
+				delete(client_leases, flow_id)
+			}
+		}
+		if len(client_leases) == 0 {
+			delete(self.leases, client_id)
+		}
+	}
+	return result
+}
+
+// Periodically queue expired tasks again.
+func (self *ClientInfoManager) requeueExpiredLeases(
+	ctx context.Context, config_obj *config_proto.Config) {
+
+	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-time.After(utils.Jitter(10 * time.Second)):
+			expired := self.leases.Expired(utils.GetTime().Now())
+			for client_id, tasks := range expired {
+				logger.Info("ClientInfoManager: Client %v did not respond to %v "+
+					"delivered tasks, queuing them again.", client_id, len(tasks))
+
+				err := self.QueueMessagesForClient(
+					ctx, client_id, tasks, services.NOTIFY_CLIENT)
+				if err != nil {
+					logger.Error("ClientInfoManager: requeue tasks for %v: %v",
+						client_id, err)
+				}
+			}
+		}
+	}
+}
+
+func (self *ClientInfoManager) ReleaseTaskLease(client_id, flow_id string) {
+	if self.leases != nil {
+		self.leases.Release(client_id, flow_id)
+	}
+}
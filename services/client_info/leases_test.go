@@ -0,0 +1,47 @@
+package client_info
+
+import (
+	"testing"
+	"time"
+
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func TestTaskLeases(t *testing.T) {
+	leases := newTaskLeases(time.Minute)
+
+	leases.Lease("C.1", []*crypto_proto.VeloMessage{
+		{SessionId: "F.1", FlowRequest: &crypto_proto.FlowRequest{}},
+		{SessionId: "F.2", FlowRequest: &crypto_proto.FlowRequest{}},
+
+		// Cancellations are not leased.
+		{SessionId: "F.3", Cancel: &crypto_proto.Cancel{}},
+
+		// Sealed flow requests are leased but other sealed tasks
+		// are not.
+		{SessionId: "F.4", Sealed: &crypto_proto.SealedMessage{FlowRequest: true}},
+		{SessionId: "F.5", Sealed: &crypto_proto.SealedMessage{}},
+	})
+
+	_, pres := leases.leases["C.1"]["F.4"]
+	assert.True(t, pres)
+	_, pres = leases.leases["C.1"]["F.5"]
+	assert.True(t, !pres)
+
+	// Nothing expired yet.
+	now := utils.GetTime().Now()
+	assert.Equal(t, 0, len(leases.Expired(now)))
+
+	// The client responded to F.1
+	leases.Release("C.1", "F.1")
+	leases.Release("C.1", "F.4")
+
+	expired := leases.Expired(now.Add(2 * time.Minute))
+	assert.Equal(t, 1, len(expired["C.1"]))
+	assert.Equal(t, "F.2", expired["C.1"][0].SessionId)
+
+	// Expired leases are only returned once.
+	assert.Equal(t, 0, len(leases.Expired(now.Add(2*time.Minute))))
+}
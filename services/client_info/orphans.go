@@ -0,0 +1,192 @@
+package client_info
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+// Clients send messages for running flows regularly (results, logs
+// and at least the query heartbeat). If a client stops sending
+// messages in the middle of a collection (e.g. it crashed or went
+// offline) the flow would remain in the RUNNING state forever. The
+// watchdog tracks the last time each in flight flow was heard from
+// and reports flows which were silent for too long.
+type flowWatchdog struct {
+	mu      sync.Mutex
+	timeout time.Duration
+
+	// client id -> flow id -> last active
+	flows map[string]map[string]time.Time
+
+	// client id -> orphaned flow ids
+	orphaned map[string][]string
+}
+
+func newFlowWatchdog(timeout time.Duration) *flowWatchdog {
+	return &flowWatchdog{
+		timeout:  timeout,
+		flows:    make(map[string]map[string]time.Time),
+		orphaned: make(map[string][]string),
+	}
+}
+
+func (self *flowWatchdog) Active(client_id, flow_id string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	client_flows, pres := self.flows[client_id]
+	if !pres {
+		client_flows = make(map[string]time.Time)
+		self.flows[client_id] = client_flows
+	}
+	client_flows[flow_id] = utils.GetTime().Now()
+}
+
+func (self *flowWatchdog) Done(client_id, flow_id string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	client_flows, pres := self.flows[client_id]
+	if !pres {
+		return
+	}
+
+	delete(client_flows, flow_id)
+	if len(client_flows) == 0 {
+		delete(self.flows, client_id)
+	}
+}
+
+// Remove and return all the flows not heard from since the timeout
+// by client id.
+func (self *flowWatchdog) Expired(now time.Time) map[string][]string {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	result := make(map[string][]string)
+	for client_id, client_flows := range self.flows {
+		for flow_id, last_active := range client_flows {
+			if now.Sub(last_active) > self.timeout {
+				result[client_id] = append(result[client_id], flow_id)
+				delete(client_flows, flow_id)
+			}
+		}
+		if len(client_flows) == 0 {
+			delete(self.flows, client_id)
+		}
+	}
+	return result
+}
+
+func (self *flowWatchdog) AddOrphaned(client_id, flow_id string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.orphaned[client_id] = append(self.orphaned[client_id], flow_id)
+}
+
+func (self *flowWatchdog) TakeOrphaned(client_id string) []string {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	result, pres := self.orphaned[client_id]
+	if pres {
+		delete(self.orphaned, client_id)
+	}
+	return result
+}
+
+// Periodically mark flows which were silent for too long as
+// orphaned.
+func (self *ClientInfoManager) markOrphanedFlows(
+	ctx context.Context, config_obj *config_proto.Config) {
+
+	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-time.After(utils.Jitter(10 * time.Second)):
+			expired := self.watchdog.Expired(utils.GetTime().Now())
+			for client_id, flow_ids := range expired {
+				for _, flow_id := range flow_ids {
+					err := self.markFlowOrphaned(ctx, config_obj, client_id, flow_id)
+					if err != nil {
+						logger.Error("ClientInfoManager: marking flow %v orphaned: %v",
+							flow_id, err)
+						continue
+					}
+
+					logger.Info("ClientInfoManager: Client %v stopped responding "+
+						"to flow %v, marking it as orphaned.", client_id, flow_id)
+				}
+			}
+		}
+	}
+}
+
+func (self *ClientInfoManager) markFlowOrphaned(
+	ctx context.Context, config_obj *config_proto.Config,
+	client_id, flow_id string) error {
+
+	launcher, err := services.GetLauncher(config_obj)
+	if err != nil {
+		return err
+	}
+
+	collection_context, err := launcher.Storage().LoadCollectionContext(
+		ctx, config_obj, client_id, flow_id)
+	if err != nil {
+		return err
+	}
+
+	// The flow completed after all.
+	if collection_context.State != flows_proto.ArtifactCollectorContext_RUNNING {
+		return nil
+	}
+
+	collection_context.State = flows_proto.ArtifactCollectorContext_ORPHANED
+	collection_context.Status = fmt.Sprintf(
+		"Client stopped responding: no messages received for %v",
+		self.watchdog.timeout)
+
+	err = launcher.Storage().WriteFlow(
+		ctx, config_obj, collection_context, utils.BackgroundWriter)
+	if err != nil {
+		return err
+	}
+
+	if config_obj.Defaults.GetReissueOrphanedFlows() {
+		self.watchdog.AddOrphaned(client_id, flow_id)
+	}
+	return nil
+}
+
+func (self *ClientInfoManager) FlowActive(client_id, flow_id string) {
+	if self.watchdog != nil {
+		self.watchdog.Active(client_id, flow_id)
+	}
+}
+
+func (self *ClientInfoManager) FlowDone(client_id, flow_id string) {
+	if self.watchdog != nil {
+		self.watchdog.Done(client_id, flow_id)
+	}
+}
+
+func (self *ClientInfoManager) TakeOrphanedFlows(client_id string) []string {
+	if self.watchdog == nil {
+		return nil
+	}
+	return self.watchdog.TakeOrphaned(client_id)
+}
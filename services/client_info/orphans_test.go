@@ -0,0 +1,36 @@
+package client_info
+
+import (
+	"testing"
+	"time"
+
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func TestFlowWatchdog(t *testing.T) {
+	watchdog := newFlowWatchdog(time.Minute)
+
+	watchdog.Active("C.1", "F.1")
+	watchdog.Active("C.1", "F.2")
+	watchdog.Active("C.2", "F.3")
+
+	// Nothing expired yet.
+	now := utils.GetTime().Now()
+	assert.Equal(t, 0, len(watchdog.Expired(now)))
+
+	// F.1 completed
+	watchdog.Done("C.1", "F.1")
+
+	expired := watchdog.Expired(now.Add(2 * time.Minute))
+	assert.Equal(t, []string{"F.2"}, expired["C.1"])
+	assert.Equal(t, []string{"F.3"}, expired["C.2"])
+
+	// Expired flows are only returned once.
+	assert.Equal(t, 0, len(watchdog.Expired(now.Add(2*time.Minute))))
+
+	// Orphaned flows are handed out once when the client returns.
+	watchdog.AddOrphaned("C.1", "F.2")
+	assert.Equal(t, []string{"F.2"}, watchdog.TakeOrphaned("C.1"))
+	assert.Equal(t, 0, len(watchdog.TakeOrphaned("C.1")))
+}
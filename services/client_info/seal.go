@@ -0,0 +1,62 @@
+package client_info
+
+import (
+	"fmt"
+
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	crypto_utils "www.velocidex.com/golang/velociraptor/crypto/utils"
+	"www.velocidex.com/golang/velociraptor/datastore"
+	"www.velocidex.com/golang/velociraptor/paths"
+)
+
+// When Defaults.encrypt_client_tasks is set, tasks are sealed with
+// the client's public key before they are written to the client's
+// queue. Someone with access to the datastore can then not see which
+// investigative steps are pending against an endpoint - only the
+// client itself can unseal the task. The session id and urgency stay
+// in the clear so the server can still cancel and schedule tasks.
+func (self *ClientInfoManager) maybeSealTask(client_id string,
+	task *crypto_proto.VeloMessage) (*crypto_proto.VeloMessage, error) {
+
+	if self.config_obj.Defaults == nil ||
+		!self.config_obj.Defaults.EncryptClientTasks ||
+
+		// Server artifacts are run by the server itself.
+		client_id == "server" ||
+
+		// Tasks which are queued again are already sealed.
+		task.Sealed != nil {
+		return task, nil
+	}
+
+	db, err := datastore.GetDB(self.config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	pem := &crypto_proto.PublicKey{}
+	err = db.GetSubject(self.config_obj,
+		paths.NewClientPathManager(client_id).Key(), pem)
+	if err != nil || len(pem.Pem) == 0 {
+		return nil, fmt.Errorf("Unable to seal task for %v: no public key",
+			client_id)
+	}
+
+	key, err := crypto_utils.PemToPublicKey(pem.Pem)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := crypto_utils.SealMessage(key, task)
+	if err != nil {
+		return nil, err
+	}
+
+	return &crypto_proto.VeloMessage{
+		SessionId: task.SessionId,
+		RequestId: task.RequestId,
+		Urgent:    task.Urgent,
+		TaskId:    task.TaskId,
+		Sealed:    sealed,
+	}, nil
+}
@@ -130,6 +130,11 @@ func (self *ClientInfoManager) QueueMessagesForClient(
 		// Task ID is related to time.
 		task.TaskId = currentTaskId()
 
+		task, err = self.maybeSealTask(client_id, task)
+		if err != nil {
+			return err
+		}
+
 		err = db.SetSubjectWithCompletion(self.config_obj,
 			client_path_manager.Task(task.TaskId),
 			task, completer.GetCompletionFunc())
@@ -163,10 +168,15 @@ func (self *ClientInfoManager) QueueMessageForClient(
 		return err
 	}
 
+	task, err := self.maybeSealTask(client_id, req)
+	if err != nil {
+		return err
+	}
+
 	client_path_manager := paths.NewClientPathManager(client_id)
 	return db.SetSubjectWithCompletion(self.config_obj,
 		client_path_manager.Task(req.TaskId),
-		req, func() {
+		task, func() {
 			if completion != nil {
 				completion()
 			}
@@ -233,6 +243,13 @@ func (self *ClientInfoManager) GetClientTasks(
 	ctx context.Context, client_id string) (
 	[]*crypto_proto.VeloMessage, error) {
 
+	// Group tasks are scheduled on the client's queue as it checks
+	// in.
+	self.scheduleGroupTasks(ctx, client_id)
+
+	// Watched clients raise an alert as they check in.
+	self.checkWatchList(ctx, client_id)
+
 	err := self.storage.Modify(ctx, client_id,
 		func(client_info *services.ClientInfo) (*services.ClientInfo, error) {
 			if client_info == nil {
@@ -273,6 +290,7 @@ func (self *ClientInfoManager) GetClientTasks(
 	}
 
 	result := []*crypto_proto.VeloMessage{}
+	var leased []*crypto_proto.VeloMessage
 	for _, task_urn := range tasks {
 		task_urn = task_urn.SetTag("ClientTask")
 
@@ -291,10 +309,20 @@ func (self *ClientInfoManager) GetClientTasks(
 			return nil, err
 		}
 
+		// Keep the original task in case it needs to be queued
+		// again. Sealed tasks are kept sealed.
+		if self.leases != nil && isFlowRequest(message) {
+			leased = append(leased,
+				proto.Clone(message).(*crypto_proto.VeloMessage))
+		}
+
 		// Handle backwards compatibility with older clients by expanding
 		// FlowRequest into separate VQLClientActions. Newer clients will
 		// ignore bare VQLClientActions and older clients will ignore
 		// FlowRequest.
+		//
+		// Sealed tasks are only sent to clients which can unseal them
+		// so they are never expanded.
 		if message.FlowRequest != nil &&
 			len(message.FlowRequest.VQLClientActions) > 0 {
 
@@ -322,6 +350,10 @@ func (self *ClientInfoManager) GetClientTasks(
 		result = append(result, message)
 	}
 
+	if len(leased) > 0 {
+		self.leases.Lease(client_id, leased)
+	}
+
 	return result, nil
 }
 
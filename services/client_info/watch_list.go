@@ -0,0 +1,373 @@
+/*
+  The watch list raises an alert when a specific client next checks
+  in.
+
+  Analysts often wait for an offline client to return before they can
+  continue an investigation. Rather than polling the client's last
+  seen time, the client is added to the watch list. When the client
+  checks in an alert is sent to Server.Internal.Alerts and an
+  optional collection is launched on it immediately. The client is
+  then removed from the watch list so the alert only fires once.
+
+  All frontends follow the Server.Internal.WatchList queue to reload
+  the watch list when it changes.
+*/
+
+package client_info
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"google.golang.org/protobuf/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/datastore"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+// How we store the watched client in the datastore. The request is
+// stored as a serialized protobuf.
+type watchRecord struct {
+	ClientId string `json:"ClientId"`
+	Comment  string `json:"Comment"`
+	Creator  string `json:"Creator"`
+	Created  int64  `json:"Created"`
+	Request  []byte `json:"Request,omitempty"`
+}
+
+type watchList struct {
+	mu sync.Mutex
+
+	config_obj *config_proto.Config
+
+	// Watched clients by client id.
+	clients map[string]*services.WatchedClient
+}
+
+func newWatchList(config_obj *config_proto.Config) *watchList {
+	return &watchList{
+		config_obj: config_obj,
+		clients:    make(map[string]*services.WatchedClient),
+	}
+}
+
+func (self *watchList) Get(client_id string) (*services.WatchedClient, error) {
+	raw_db, err := getRawDB(self.config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := raw_db.GetBuffer(self.config_obj, paths.WatchListPath(client_id))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.NotFoundError, client_id)
+	}
+
+	record := &watchRecord{}
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &services.WatchedClient{
+		ClientId: record.ClientId,
+		Comment:  record.Comment,
+		Creator:  record.Creator,
+		Created:  record.Created,
+	}
+
+	if len(record.Request) > 0 {
+		result.Request = &flows_proto.ArtifactCollectorArgs{}
+		err = proto.Unmarshal(record.Request, result.Request)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (self *watchList) Set(watch *services.WatchedClient) error {
+	raw_db, err := getRawDB(self.config_obj)
+	if err != nil {
+		return err
+	}
+
+	record := &watchRecord{
+		ClientId: watch.ClientId,
+		Comment:  watch.Comment,
+		Creator:  watch.Creator,
+		Created:  watch.Created,
+	}
+
+	if watch.Request != nil {
+		record.Request, err = proto.Marshal(watch.Request)
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return raw_db.SetBuffer(self.config_obj,
+		paths.WatchListPath(watch.ClientId), data, utils.SyncCompleter)
+}
+
+// Reload the watch list from the datastore.
+func (self *watchList) Load(ctx context.Context) error {
+	db, err := datastore.GetDB(self.config_obj)
+	if err != nil {
+		return err
+	}
+
+	children, err := db.ListChildren(self.config_obj, paths.WATCH_LIST_ROOT)
+	if err != nil {
+		return err
+	}
+
+	clients := make(map[string]*services.WatchedClient)
+	for _, child := range children {
+		if child.IsDir() {
+			continue
+		}
+
+		watch, err := self.Get(child.Base())
+		if err != nil {
+			continue
+		}
+		clients[watch.ClientId] = watch
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.clients = clients
+
+	return nil
+}
+
+func (self *watchList) List() []*services.WatchedClient {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	result := make([]*services.WatchedClient, 0, len(self.clients))
+	for _, watch := range self.clients {
+		result = append(result, watch)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created < result[j].Created
+	})
+	return result
+}
+
+// Remove the client from the in memory watch list. The common case
+// of an unwatched client requires no IO.
+func (self *watchList) claim(client_id string) *services.WatchedClient {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	watch, pres := self.clients[client_id]
+	if !pres {
+		return nil
+	}
+	delete(self.clients, client_id)
+	return watch
+}
+
+// Fire the alert if the client is watched.
+func (self *ClientInfoManager) checkWatchList(
+	ctx context.Context, client_id string) {
+
+	if client_id == "server" {
+		return
+	}
+
+	watch := self.watch_list.claim(client_id)
+	if watch == nil {
+		return
+	}
+
+	logger := logging.GetLogger(self.config_obj, &logging.FrontendComponent)
+
+	// Another frontend may have seen the client check in already
+	// and removed it from the watch list.
+	_, err := self.watch_list.Get(client_id)
+	if err != nil {
+		return
+	}
+
+	err = self.UnwatchClient(ctx, client_id)
+	if err != nil {
+		logger.Error("ClientInfoManager: removing %v from watch list: %v",
+			client_id, err)
+	}
+
+	flow_id := ""
+	if watch.Request != nil {
+		flow_id, err = self.launchWatchCollection(ctx, watch)
+		if err != nil {
+			logger.Error("ClientInfoManager: launching collection on "+
+				"watched client %v: %v", client_id, err)
+		}
+	}
+
+	hostname := ""
+	record, err := self.storage.GetRecord(client_id)
+	if err == nil {
+		hostname = record.Hostname
+	}
+
+	self.raiseWatchAlert(ctx, watch, ordereddict.NewDict().
+		Set("ClientId", client_id).
+		Set("Hostname", hostname).
+		Set("Comment", watch.Comment).
+		Set("Creator", watch.Creator).
+		Set("WatchedSince", time.Unix(watch.Created, 0).UTC()).
+		Set("FlowId", flow_id))
+}
+
+func (self *ClientInfoManager) launchWatchCollection(
+	ctx context.Context, watch *services.WatchedClient) (string, error) {
+
+	launcher, err := services.GetLauncher(self.config_obj)
+	if err != nil {
+		return "", err
+	}
+
+	request := proto.Clone(watch.Request).(*flows_proto.ArtifactCollectorArgs)
+	request.ClientId = watch.ClientId
+	request.FlowId = ""
+
+	return launcher.WriteArtifactCollectionRecord(
+		ctx, self.config_obj, request, watch.Request.CompiledCollectorArgs,
+		func(message *crypto_proto.VeloMessage) {
+			// Queue and notify the client about the new tasks
+			err := self.QueueMessageForClient(ctx, watch.ClientId, message,
+				services.NOTIFY_CLIENT, utils.BackgroundWriter)
+			if err != nil {
+				logger := logging.GetLogger(self.config_obj, &logging.FrontendComponent)
+				logger.Error("ClientInfoManager: queuing collection on "+
+					"watched client %v: %v", watch.ClientId, err)
+			}
+		})
+}
+
+func (self *ClientInfoManager) raiseWatchAlert(ctx context.Context,
+	watch *services.WatchedClient, event_data *ordereddict.Dict) {
+
+	logger := logging.GetLogger(self.config_obj, &logging.FrontendComponent)
+	logger.Info("ClientInfoManager: Watched client %v checked in: %v",
+		watch.ClientId, json.MustMarshalString(event_data))
+
+	flow_id, _ := event_data.GetString("FlowId")
+	alert := &services.AlertMessage{
+		ClientId:  watch.ClientId,
+		AlertName: "Watched client checked in",
+		Timestamp: utils.GetTime().Now(),
+		EventData: event_data,
+		FlowId:    flow_id,
+	}
+
+	serialized, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+	serialized = append(serialized, '\n')
+
+	journal, err := services.GetJournal(self.config_obj)
+	if err != nil {
+		return
+	}
+
+	err = journal.PushJsonlToArtifact(ctx, self.config_obj,
+		serialized, 1, "Server.Internal.Alerts", "server", "")
+	if err != nil {
+		logger.Error("ClientInfoManager: Unable to raise watch list alert: %v", err)
+	}
+}
+
+func (self *ClientInfoManager) WatchClient(
+	ctx context.Context,
+	watch *services.WatchedClient) (*services.WatchedClient, error) {
+
+	err := self.ValidateClientId(watch.ClientId)
+	if err != nil {
+		return nil, err
+	}
+
+	if watch.ClientId == "server" {
+		return nil, errors.New("WatchClient: the server can not be watched")
+	}
+
+	if watch.Request != nil && len(watch.Request.CompiledCollectorArgs) == 0 {
+		return nil, errors.New("WatchClient: request must be compiled")
+	}
+
+	watch.Created = utils.GetTime().Now().Unix()
+
+	err = self.watch_list.Set(watch)
+	if err != nil {
+		return nil, err
+	}
+
+	return watch, self.notifyWatchList(ctx, watch.ClientId)
+}
+
+func (self *ClientInfoManager) ListWatchedClients(
+	ctx context.Context) ([]*services.WatchedClient, error) {
+	return self.watch_list.List(), nil
+}
+
+func (self *ClientInfoManager) UnwatchClient(
+	ctx context.Context, client_id string) error {
+	db, err := datastore.GetDB(self.config_obj)
+	if err != nil {
+		return err
+	}
+
+	err = db.DeleteSubject(self.config_obj, paths.WatchListPath(client_id))
+	if err != nil {
+		return err
+	}
+
+	return self.notifyWatchList(ctx, client_id)
+}
+
+// Reload the watch list and tell all the other frontends to do the
+// same.
+func (self *ClientInfoManager) notifyWatchList(
+	ctx context.Context, client_id string) error {
+	err := self.watch_list.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	journal, err := services.GetJournal(self.config_obj)
+	if err != nil {
+		return err
+	}
+
+	return journal.PushRowsToArtifact(ctx, self.config_obj,
+		[]*ordereddict.Dict{ordereddict.NewDict().Set("ClientId", client_id)},
+		"Server.Internal.WatchList", "server", "")
+}
+
+func (self *ClientInfoManager) ProcessWatchList(
+	ctx context.Context, config_obj *config_proto.Config,
+	row *ordereddict.Dict) error {
+	return self.watch_list.Load(ctx)
+}
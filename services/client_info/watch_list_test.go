@@ -0,0 +1,76 @@
+package client_info_test
+
+import (
+	"time"
+
+	actions_proto "www.velocidex.com/golang/velociraptor/actions/proto"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/vtesting"
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func (self *ClientInfoTestSuite) TestWatchList() {
+	client_info_manager, err := services.GetClientInfoManager(self.ConfigObj)
+	assert.NoError(self.T(), err)
+
+	_, err = client_info_manager.WatchClient(self.Ctx, &services.WatchedClient{
+		ClientId: self.client_id,
+		Comment:  "Laptop of interest",
+		Request: &flows_proto.ArtifactCollectorArgs{
+			Artifacts: []string{"Generic.Client.Info"},
+			CompiledCollectorArgs: []*actions_proto.VQLCollectorArgs{{
+				Query: []*actions_proto.VQLRequest{{VQL: "SELECT * FROM info()"}},
+			}},
+		},
+	})
+	assert.NoError(self.T(), err)
+
+	// The server can not be watched.
+	_, err = client_info_manager.WatchClient(self.Ctx, &services.WatchedClient{
+		ClientId: "server",
+	})
+	assert.Error(self.T(), err)
+
+	watched, err := client_info_manager.ListWatchedClients(self.Ctx)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 1, len(watched))
+	assert.Equal(self.T(), "Laptop of interest", watched[0].Comment)
+
+	// Other clients checking in do not affect the watch list.
+	_, err = client_info_manager.GetClientTasks(self.Ctx, "C.5678")
+	assert.NoError(self.T(), err)
+
+	watched, err = client_info_manager.ListWatchedClients(self.Ctx)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 1, len(watched))
+
+	// Checking in removes the client from the watch list and
+	// launches the collection.
+	_, err = client_info_manager.GetClientTasks(self.Ctx, self.client_id)
+	assert.NoError(self.T(), err)
+
+	watched, err = client_info_manager.ListWatchedClients(self.Ctx)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 0, len(watched))
+
+	vtesting.WaitUntil(2*time.Second, self.T(), func() bool {
+		queued, err := client_info_manager.PeekClientTasks(
+			self.Ctx, self.client_id)
+		assert.NoError(self.T(), err)
+		return len(queued) == 1 && queued[0].FlowRequest != nil
+	})
+
+	// Removing a client from the watch list.
+	_, err = client_info_manager.WatchClient(self.Ctx, &services.WatchedClient{
+		ClientId: "C.5678",
+	})
+	assert.NoError(self.T(), err)
+
+	err = client_info_manager.UnwatchClient(self.Ctx, "C.5678")
+	assert.NoError(self.T(), err)
+
+	watched, err = client_info_manager.ListWatchedClients(self.Ctx)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 0, len(watched))
+}
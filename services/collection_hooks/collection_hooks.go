@@ -0,0 +1,330 @@
+/*
+  Collection hooks glue external processing into the server.
+
+  Each hook in Defaults.collection_hooks names a regex of artifacts
+  and an external program and/or a webhook. When a collection of a
+  matching artifact completes, the service builds a manifest
+  describing the collection (its state, where its result sets and
+  uploads are stored in the filestore) and passes it as JSON to the
+  program on its stdin, or POSTs it to the webhook.
+
+  Hooks run on the master node only and each runs in its own
+  goroutine so a slow hook does not hold up flow completion
+  processing.
+*/
+
+package collection_hooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/file_store"
+	"www.velocidex.com/golang/velociraptor/file_store/api"
+	"www.velocidex.com/golang/velociraptor/file_store/path_specs"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/paths/artifacts"
+	"www.velocidex.com/golang/velociraptor/result_sets"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/services/journal"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+const (
+	DEFAULT_HOOK_TIMEOUT = 600
+)
+
+type ManifestResult struct {
+	Artifact string `json:"Artifact"`
+
+	// The result set's filename in the filestore.
+	Path string `json:"Path"`
+}
+
+type ManifestUpload struct {
+	VFSPath string `json:"VFSPath"`
+	Path    string `json:"Path"`
+	Size    int64  `json:"Size"`
+}
+
+// The manifest passed to the hooks.
+type Manifest struct {
+	OrgId              string            `json:"OrgId"`
+	ClientId           string            `json:"ClientId"`
+	FlowId             string            `json:"FlowId"`
+	Artifacts          []string          `json:"Artifacts"`
+	Creator            string            `json:"Creator"`
+	State              string            `json:"State"`
+	Status             string            `json:"Status"`
+	CreateTime         time.Time         `json:"CreateTime"`
+	ActiveTime         time.Time         `json:"ActiveTime"`
+	TotalRows          uint64            `json:"TotalRows"`
+	TotalUploadedFiles uint64            `json:"TotalUploadedFiles"`
+	TotalUploadedBytes uint64            `json:"TotalUploadedBytes"`
+	Results            []*ManifestResult `json:"Results"`
+	Uploads            []*ManifestUpload `json:"Uploads"`
+}
+
+type hook struct {
+	*config_proto.CollectionHook
+	artifact_regex *regexp.Regexp
+}
+
+func (self *hook) timeout() time.Duration {
+	if self.Timeout > 0 {
+		return time.Duration(self.Timeout) * time.Second
+	}
+	return DEFAULT_HOOK_TIMEOUT * time.Second
+}
+
+// Does the hook apply to any of the artifacts?
+func (self *hook) matches(artifacts []string) bool {
+	for _, artifact := range artifacts {
+		if self.artifact_regex.MatchString(artifact) {
+			return true
+		}
+	}
+	return false
+}
+
+type CollectionHookService struct {
+	wg    *sync.WaitGroup
+	hooks []*hook
+}
+
+func compileHooks(config_obj *config_proto.Config) []*hook {
+	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+
+	var result []*hook
+	for _, h := range config_obj.Defaults.GetCollectionHooks() {
+		if len(h.Exec) == 0 && h.Webhook == "" {
+			logger.Error("CollectionHook %v: Neither exec nor webhook is set",
+				h.Name)
+			continue
+		}
+
+		re, err := regexp.Compile(h.Artifact)
+		if err != nil {
+			logger.Error("CollectionHook %v: Invalid artifact regex: %v",
+				h.Name, err)
+			continue
+		}
+
+		result = append(result, &hook{
+			CollectionHook: h,
+			artifact_regex: re,
+		})
+	}
+	return result
+}
+
+func (self *CollectionHookService) ProcessFlowCompletion(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	row *ordereddict.Dict) error {
+
+	flow, err := journal.GetFlowFromQueue(ctx, config_obj, row)
+	if err != nil {
+		return err
+	}
+
+	var hooks []*hook
+	artifacts := getArtifacts(flow)
+	for _, h := range self.hooks {
+		if h.matches(artifacts) {
+			hooks = append(hooks, h)
+		}
+	}
+
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	manifest, err := buildManifest(ctx, config_obj, flow)
+	if err != nil {
+		return err
+	}
+
+	serialized, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range hooks {
+		self.wg.Add(1)
+		go func(h *hook) {
+			defer self.wg.Done()
+
+			logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+			err := runHook(ctx, h, serialized)
+			if err != nil {
+				logger.Error("CollectionHook %v: flow %v: %v",
+					h.Name, manifest.FlowId, err)
+				return
+			}
+			logger.Info("CollectionHook %v: Processed flow %v from %v",
+				h.Name, manifest.FlowId, manifest.ClientId)
+		}(h)
+	}
+
+	return nil
+}
+
+func getArtifacts(flow *flows_proto.ArtifactCollectorContext) []string {
+	if flow.Request != nil && len(flow.Request.Artifacts) > 0 {
+		return flow.Request.Artifacts
+	}
+	return flow.ArtifactsWithResults
+}
+
+func buildManifest(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	flow *flows_proto.ArtifactCollectorContext) (*Manifest, error) {
+
+	result := &Manifest{
+		OrgId:              utils.NormalizedOrgId(config_obj.OrgId),
+		ClientId:           flow.ClientId,
+		FlowId:             flow.SessionId,
+		Artifacts:          getArtifacts(flow),
+		State:              flow.State.String(),
+		Status:             flow.Status,
+		CreateTime:         time.UnixMicro(int64(flow.CreateTime)).UTC(),
+		ActiveTime:         time.UnixMicro(int64(flow.ActiveTime)).UTC(),
+		TotalRows:          flow.TotalCollectedRows,
+		TotalUploadedFiles: flow.TotalUploadedFiles,
+		TotalUploadedBytes: flow.TotalUploadedBytes,
+	}
+
+	if flow.Request != nil {
+		result.Creator = flow.Request.Creator
+	}
+
+	for _, name := range flow.ArtifactsWithResults {
+		path_manager, err := artifacts.NewArtifactPathManager(ctx,
+			config_obj, flow.ClientId, flow.SessionId, name)
+		if err != nil {
+			return nil, err
+		}
+
+		path, err := path_manager.GetPathForWriting()
+		if err != nil {
+			return nil, err
+		}
+
+		result.Results = append(result.Results, &ManifestResult{
+			Artifact: name,
+			Path:     path.AsFilestoreFilename(config_obj),
+		})
+	}
+
+	if flow.TotalUploadedFiles == 0 {
+		return result, nil
+	}
+
+	flow_path_manager := paths.NewFlowPathManager(
+		flow.ClientId, flow.SessionId)
+	file_store_factory := file_store.GetFileStore(config_obj)
+	reader, err := result_sets.NewResultSetReader(
+		file_store_factory, flow_path_manager.UploadMetadata())
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	for row := range reader.Rows(ctx) {
+		// Skip the index files of sparse uploads.
+		upload_type, _ := row.GetString("Type")
+		if upload_type == "idx" {
+			continue
+		}
+
+		components, pres := row.GetStrings("_Components")
+		if !pres || len(components) == 0 {
+			continue
+		}
+
+		vfs_path, _ := row.GetString("vfs_path")
+		size, _ := row.GetInt64("file_size")
+		result.Uploads = append(result.Uploads, &ManifestUpload{
+			VFSPath: vfs_path,
+			Path: path_specs.NewUnsafeFilestorePath(components...).
+				SetType(api.PATH_TYPE_FILESTORE_ANY).
+				AsFilestoreFilename(config_obj),
+			Size: size,
+		})
+	}
+
+	return result, nil
+}
+
+func runHook(ctx context.Context, h *hook, manifest []byte) error {
+	sub_ctx, cancel := context.WithTimeout(ctx, h.timeout())
+	defer cancel()
+
+	if len(h.Exec) > 0 {
+		cmd := exec.CommandContext(sub_ctx, h.Exec[0], h.Exec[1:]...)
+		cmd.Stdin = bytes.NewReader(manifest)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%v: %w: %s", h.Exec[0], err, output)
+		}
+	}
+
+	if h.Webhook != "" {
+		req, err := http.NewRequestWithContext(sub_ctx, "POST", h.Webhook,
+			bytes.NewReader(manifest))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return errors.New("Webhook returned " + resp.Status)
+		}
+	}
+
+	return nil
+}
+
+func NewCollectionHookService(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	config_obj *config_proto.Config) error {
+
+	hooks := compileHooks(config_obj)
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+	logger.Info("<green>Starting</> Collection Hook Service for %v with %v hooks.",
+		services.GetOrgName(config_obj), len(hooks))
+
+	service := &CollectionHookService{
+		wg:    wg,
+		hooks: hooks,
+	}
+
+	return journal.WatchQueueWithCB(ctx, config_obj, wg,
+		"System.Flow.Completion", "CollectionHookService",
+		service.ProcessFlowCompletion)
+}
@@ -0,0 +1,96 @@
+package collection_hooks
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+)
+
+func TestCompileHooks(t *testing.T) {
+	config_obj := &config_proto.Config{
+		Defaults: &config_proto.Defaults{
+			CollectionHooks: []*config_proto.CollectionHook{{
+				Name:     "NoAction",
+				Artifact: ".",
+			}, {
+				Name:     "BadRegex",
+				Artifact: "(",
+				Webhook:  "http://localhost/",
+			}, {
+				Name:     "Good",
+				Artifact: "^Windows.KapeFiles.Targets$",
+				Webhook:  "http://localhost/",
+			}},
+		},
+	}
+
+	hooks := compileHooks(config_obj)
+	assert.Equal(t, 1, len(hooks))
+	assert.Equal(t, "Good", hooks[0].Name)
+
+	assert.True(t, hooks[0].matches(
+		[]string{"Generic.Client.Info", "Windows.KapeFiles.Targets"}))
+	assert.False(t, hooks[0].matches(
+		[]string{"Windows.KapeFiles.Targets.Extra"}))
+}
+
+func TestRunHook(t *testing.T) {
+	manifest := []byte(`{"ClientId":"C.123","FlowId":"F.123"}`)
+
+	// The webhook receives the manifest.
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "POST", r.Method)
+			received, _ = ioutil.ReadAll(r.Body)
+		}))
+	defer server.Close()
+
+	ctx := context.Background()
+	err := runHook(ctx, &hook{CollectionHook: &config_proto.CollectionHook{
+		Webhook: server.URL,
+	}}, manifest)
+	assert.NoError(t, err)
+	assert.Equal(t, manifest, received)
+
+	// Errors from the webhook are reported.
+	failing := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+	defer failing.Close()
+
+	err = runHook(ctx, &hook{CollectionHook: &config_proto.CollectionHook{
+		Webhook: failing.URL,
+	}}, manifest)
+	assert.Error(t, err)
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	// The program receives the manifest on stdin.
+	output := filepath.Join(t.TempDir(), "manifest.json")
+	err = runHook(ctx, &hook{CollectionHook: &config_proto.CollectionHook{
+		Exec: []string{"/bin/sh", "-c", "cat > " + output},
+	}}, manifest)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, manifest, data)
+
+	// Failing programs are reported.
+	err = runHook(ctx, &hook{CollectionHook: &config_proto.CollectionHook{
+		Exec: []string{"/bin/sh", "-c", "exit 1"},
+	}}, manifest)
+	assert.Error(t, err)
+}
@@ -15,6 +15,7 @@ import (
 
 	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
 	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/services"
 )
 
 var (
@@ -38,6 +39,12 @@ func (self *DynDNSService) updateIP(
 		return
 	}
 
+	// When several masters are running only the leader updates the
+	// DNS so clients follow the leader when it fails over.
+	if !services.IsLeader(config_obj) {
+		return
+	}
+
 	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
 	logger.Info("DynDns: Checking DNS with %v", self.external_ip_url)
 
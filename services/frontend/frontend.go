@@ -27,6 +27,11 @@ import (
 	"www.velocidex.com/golang/velociraptor/services"
 	"www.velocidex.com/golang/velociraptor/services/journal"
 	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/utils/usage"
+)
+
+const (
+	usageReportInterval = time.Minute
 )
 
 var (
@@ -47,6 +52,7 @@ func PushMetrics(ctx context.Context, wg *sync.WaitGroup,
 			NodeName: node_name,
 		}
 		rows := make([]*ordereddict.Dict, 1)
+		last_usage_push := time.Now()
 
 		for {
 			// Wait for 10 seconds between updates
@@ -73,6 +79,11 @@ func PushMetrics(ctx context.Context, wg *sync.WaitGroup,
 					rows, "Server.Internal.FrontendMetrics",
 					"server", "")
 			}
+
+			if time.Now().Sub(last_usage_push) > usageReportInterval {
+				pushUsage(ctx, node_name)
+				last_usage_push = time.Now()
+			}
 		}
 
 	}()
@@ -80,6 +91,49 @@ func PushMetrics(ctx context.Context, wg *sync.WaitGroup,
 	return nil
 }
 
+// Write the usage accumulated by this frontend into each org's
+// Server.Monitor.Usage artifact. Usage which can not be written is
+// kept for the next time.
+func pushUsage(ctx context.Context, node_name string) {
+	org_manager, err := services.GetOrgManager()
+	if err != nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, record := range usage.Drain() {
+		err := pushOrgUsage(ctx, org_manager, node_name, now, record)
+		if err != nil {
+			usage.Restore(record)
+		}
+	}
+}
+
+func pushOrgUsage(ctx context.Context, org_manager services.OrgManager,
+	node_name string, now time.Time, record *usage.Usage) error {
+	org_config_obj, err := org_manager.GetOrgConfig(record.OrgId)
+	if err != nil {
+		// The org was removed - drop its usage.
+		return nil
+	}
+
+	journal, err := services.GetJournal(org_config_obj)
+	if err != nil {
+		return err
+	}
+
+	return journal.PushRowsToArtifact(ctx, org_config_obj,
+		[]*ordereddict.Dict{ordereddict.NewDict().
+			Set("Timestamp", now).
+			Set("Node", node_name).
+			Set("OrgId", record.OrgId).
+			Set("Label", record.Label).
+			Set("BytesIngested", record.BytesIngested).
+			Set("RowsStored", record.RowsStored).
+			Set("ApiCalls", record.ApiCalls)},
+		"Server.Monitor.Usage", "server", "")
+}
+
 func calculateMetrics(metrics *FrontendMetrics) error {
 	now := time.Now()
 
@@ -0,0 +1,284 @@
+/*
+  The hash inventory service maintains a server side index of the
+  executables found on each client.
+
+  Clients running the Generic.Client.HashInventory event artifact
+  slowly hash all the executables in standard locations and keep a
+  local inventory. Only changes to the inventory (added, modified and
+  removed files) are sent to the server. This service follows the
+  artifact's event queue and records for each SHA256 hash the clients
+  which have a file with that hash and the paths of those files.
+
+  Looking up a hash across the entire fleet is then a single
+  directory listing in the datastore rather than a hunt.
+*/
+
+package hash_inventory
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Velocidex/ordereddict"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/datastore"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/services/journal"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+const (
+	HASH_INVENTORY_ARTIFACT = "Generic.Client.HashInventory"
+)
+
+var (
+	sha256Regex = regexp.MustCompile("^[0-9a-f]{64}$")
+
+	invalidHashError = errors.New("Invalid SHA256 hash")
+)
+
+// The files with a hash on a single client.
+type HashInventoryRecord struct {
+	Hash     string   `json:"Hash"`
+	ClientId string   `json:"ClientId"`
+	Paths    []string `json:"Paths"`
+	Size     int64    `json:"Size"`
+	Updated  int64    `json:"Updated"`
+}
+
+type HashInventoryService struct {
+	// Serialize updates to the same records.
+	mu sync.Mutex
+}
+
+func getRawDB(config_obj *config_proto.Config) (datastore.RawDataStore, error) {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	raw_db, ok := db.(datastore.RawDataStore)
+	if !ok {
+		return nil, errors.New("Datastore has no raw access.")
+	}
+	return raw_db, nil
+}
+
+func normalizeHash(hash string) (string, error) {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	if !sha256Regex.MatchString(hash) {
+		return "", invalidHashError
+	}
+	return hash, nil
+}
+
+// Find all the clients with a file matching the SHA256 hash.
+func LookupHash(config_obj *config_proto.Config,
+	hash string) ([]*HashInventoryRecord, error) {
+	hash, err := normalizeHash(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	raw_db, err := getRawDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	children, err := db.ListChildren(config_obj,
+		paths.HashInventoryDirectory(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*HashInventoryRecord{}
+	for _, child := range children {
+		if child.IsDir() {
+			continue
+		}
+
+		record, err := getRecord(config_obj, raw_db, hash, child.Base())
+		if err != nil {
+			continue
+		}
+		result = append(result, record)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ClientId < result[j].ClientId
+	})
+
+	return result, nil
+}
+
+func getRecord(config_obj *config_proto.Config,
+	raw_db datastore.RawDataStore,
+	hash, client_id string) (*HashInventoryRecord, error) {
+	data, err := raw_db.GetBuffer(config_obj,
+		paths.HashInventoryPath(hash, client_id))
+	if err != nil {
+		return nil, err
+	}
+
+	record := &HashInventoryRecord{}
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Process a single change to a client's inventory.
+func (self *HashInventoryService) ProcessRow(
+	ctx context.Context, config_obj *config_proto.Config,
+	row *ordereddict.Dict) error {
+
+	client_id, _ := row.GetString("ClientId")
+	if client_id == "" {
+		return errors.New("Unknown ClientId")
+	}
+
+	action, _ := row.GetString("Action")
+	os_path, _ := row.GetString("OSPath")
+	size, _ := row.GetInt64("Size")
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	switch action {
+	case "Added":
+		hash, _ := row.GetString("SHA256")
+		return self.addPath(config_obj, hash, client_id, os_path, size)
+
+	case "Modified":
+		old_hash, _ := row.GetString("OldSHA256")
+		err := self.removePath(config_obj, old_hash, client_id, os_path)
+		if err != nil && !errors.Is(err, invalidHashError) {
+			return err
+		}
+
+		hash, _ := row.GetString("SHA256")
+		return self.addPath(config_obj, hash, client_id, os_path, size)
+
+	case "Removed":
+		old_hash, _ := row.GetString("OldSHA256")
+		return self.removePath(config_obj, old_hash, client_id, os_path)
+
+	default:
+		return errors.New("Unknown inventory action " + action)
+	}
+}
+
+func (self *HashInventoryService) addPath(
+	config_obj *config_proto.Config,
+	hash, client_id, os_path string, size int64) error {
+	hash, err := normalizeHash(hash)
+	if err != nil {
+		return err
+	}
+
+	raw_db, err := getRawDB(config_obj)
+	if err != nil {
+		return err
+	}
+
+	record, err := getRecord(config_obj, raw_db, hash, client_id)
+	if err != nil {
+		record = &HashInventoryRecord{
+			Hash:     hash,
+			ClientId: client_id,
+		}
+	}
+
+	if !utils.InString(record.Paths, os_path) {
+		record.Paths = append(record.Paths, os_path)
+		sort.Strings(record.Paths)
+	}
+	record.Size = size
+	record.Updated = utils.GetTime().Now().Unix()
+
+	return setRecord(config_obj, raw_db, record)
+}
+
+func (self *HashInventoryService) removePath(
+	config_obj *config_proto.Config,
+	hash, client_id, os_path string) error {
+	hash, err := normalizeHash(hash)
+	if err != nil {
+		return err
+	}
+
+	raw_db, err := getRawDB(config_obj)
+	if err != nil {
+		return err
+	}
+
+	record, err := getRecord(config_obj, raw_db, hash, client_id)
+	if err != nil {
+		// Nothing to remove.
+		return nil
+	}
+
+	var remaining []string
+	for _, p := range record.Paths {
+		if p != os_path {
+			remaining = append(remaining, p)
+		}
+	}
+
+	// The client has no more files with this hash.
+	if len(remaining) == 0 {
+		db, err := datastore.GetDB(config_obj)
+		if err != nil {
+			return err
+		}
+
+		return db.DeleteSubjectWithCompletion(config_obj,
+			paths.HashInventoryPath(hash, client_id), utils.SyncCompleter)
+	}
+
+	record.Paths = remaining
+	record.Updated = utils.GetTime().Now().Unix()
+
+	return setRecord(config_obj, raw_db, record)
+}
+
+func setRecord(config_obj *config_proto.Config,
+	raw_db datastore.RawDataStore, record *HashInventoryRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return raw_db.SetBuffer(config_obj,
+		paths.HashInventoryPath(record.Hash, record.ClientId),
+		data, utils.SyncCompleter)
+}
+
+func NewHashInventoryService(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	config_obj *config_proto.Config) error {
+
+	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+	logger.Info("<green>Starting</> Hash Inventory Service for %v.",
+		services.GetOrgName(config_obj))
+
+	service := &HashInventoryService{}
+
+	return journal.WatchQueueWithCB(ctx, config_obj, wg,
+		HASH_INVENTORY_ARTIFACT, "HashInventoryService",
+		service.ProcessRow)
+}
@@ -0,0 +1,95 @@
+package hash_inventory
+
+import (
+	"testing"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"www.velocidex.com/golang/velociraptor/file_store/test_utils"
+)
+
+const (
+	hash1 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	hash2 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+)
+
+type HashInventoryTestSuite struct {
+	test_utils.TestSuite
+}
+
+func (self *HashInventoryTestSuite) TestProcessRows() {
+	service := &HashInventoryService{}
+
+	process := func(client_id, action, os_path, hash, old_hash string) {
+		err := service.ProcessRow(self.Ctx, self.ConfigObj,
+			ordereddict.NewDict().
+				Set("ClientId", client_id).
+				Set("Action", action).
+				Set("OSPath", os_path).
+				Set("Size", 10).
+				Set("SHA256", hash).
+				Set("OldSHA256", old_hash))
+		assert.NoError(self.T(), err)
+	}
+
+	process("C.1", "Added", "/bin/a", hash1, "")
+	process("C.1", "Added", "/bin/b", hash1, "")
+	process("C.2", "Added", "/usr/bin/a", hash1, "")
+
+	records, err := LookupHash(self.ConfigObj, hash1)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 2, len(records))
+	assert.Equal(self.T(), "C.1", records[0].ClientId)
+	assert.Equal(self.T(), []string{"/bin/a", "/bin/b"}, records[0].Paths)
+	assert.Equal(self.T(), "C.2", records[1].ClientId)
+
+	// Hashes are case insensitive.
+	records, err = LookupHash(self.ConfigObj, "E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855")
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 2, len(records))
+
+	// A modified file moves to the new hash.
+	process("C.2", "Modified", "/usr/bin/a", hash2, hash1)
+
+	records, err = LookupHash(self.ConfigObj, hash1)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 1, len(records))
+	assert.Equal(self.T(), "C.1", records[0].ClientId)
+
+	records, err = LookupHash(self.ConfigObj, hash2)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 1, len(records))
+	assert.Equal(self.T(), "C.2", records[0].ClientId)
+	assert.Equal(self.T(), []string{"/usr/bin/a"}, records[0].Paths)
+
+	// Removing the files removes the client.
+	process("C.1", "Removed", "/bin/a", "", hash1)
+
+	records, err = LookupHash(self.ConfigObj, hash1)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 1, len(records))
+	assert.Equal(self.T(), []string{"/bin/b"}, records[0].Paths)
+
+	process("C.1", "Removed", "/bin/b", "", hash1)
+
+	records, err = LookupHash(self.ConfigObj, hash1)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 0, len(records))
+
+	// Invalid hashes are rejected.
+	_, err = LookupHash(self.ConfigObj, "../../etc")
+	assert.Error(self.T(), err)
+
+	err = service.ProcessRow(self.Ctx, self.ConfigObj,
+		ordereddict.NewDict().
+			Set("ClientId", "C.1").
+			Set("Action", "Added").
+			Set("OSPath", "/bin/c").
+			Set("SHA256", "../../etc"))
+	assert.Error(self.T(), err)
+}
+
+func TestHashInventoryService(t *testing.T) {
+	suite.Run(t, &HashInventoryTestSuite{})
+}
@@ -46,7 +46,9 @@ import (
 	"encoding/base32"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"path"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -63,6 +65,7 @@ import (
 	"www.velocidex.com/golang/velociraptor/logging"
 	"www.velocidex.com/golang/velociraptor/services"
 	"www.velocidex.com/golang/velociraptor/services/journal"
+	"www.velocidex.com/golang/velociraptor/services/launcher"
 	"www.velocidex.com/golang/velociraptor/utils"
 	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
 )
@@ -211,6 +214,7 @@ func (self *HuntDispatcher) GetHunt(
 
 	// Normalize the hunt object
 	FindCollectedArtifacts(ctx, self.config_obj, hunt)
+	updateHuntProgress(hunt)
 
 	return hunt, true
 }
@@ -313,7 +317,8 @@ func (self *HuntDispatcher) Close(ctx context.Context) {
 
 func (self *HuntDispatcher) checkForExpiry(
 	ctx context.Context, config_obj *config_proto.Config) {
-	if self.I_am_master {
+	// Only the leader expires hunts when several masters are running.
+	if self.I_am_master && services.IsLeader(config_obj) {
 		// Check if the hunt is expired and adjust its state if so
 		now := uint64(utils.GetTime().Now().UnixNano() / 1000)
 
@@ -381,6 +386,13 @@ func (self *HuntDispatcher) CreateHunt(
 		return nil, errors.New("Hunt expiry is in the past!")
 	}
 
+	if hunt.Condition != nil && hunt.Condition.HostnameRegex != "" {
+		_, err := regexp.Compile(hunt.Condition.HostnameRegex)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid hostname regex: %w", err)
+		}
+	}
+
 	// Set the artifacts information in the hunt object itself.
 	hunt.Artifacts = hunt.StartRequest.Artifacts
 	hunt.ArtifactSources = []string{}
@@ -401,6 +413,20 @@ func (self *HuntDispatcher) CreateHunt(
 		return nil, err
 	}
 
+	// Hunts are not addressed to a single client so can not be
+	// approved.
+	err = launcher.RejectDualAuthorization(
+		ctx, config_obj, repository, hunt.StartRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	err = launcher.RejectUnreviewedArtifacts(
+		ctx, config_obj, repository, hunt.StartRequest)
+	if err != nil {
+		return nil, err
+	}
+
 	// Compile the start request and store it in the hunt. We will
 	// use this compiled version to launch all other flows from
 	// this hunt rather than re-compile the artifact each
@@ -67,8 +67,9 @@ func (self *HuntDispatcher) ListHunts(
 
 				// Clone the hunts so we can remove
 				// them from the locked section.
-				items = append(items,
-					proto.Clone(hunt).(*api_proto.Hunt))
+				item := proto.Clone(hunt).(*api_proto.Hunt)
+				updateHuntProgress(item)
+				items = append(items, item)
 			}
 			return nil
 		})
@@ -3,8 +3,10 @@ package hunt_dispatcher
 import (
 	"context"
 
+	api_proto "www.velocidex.com/golang/velociraptor/api/proto"
 	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
 	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
 )
 
 func GetArtifactSources(
@@ -27,3 +29,18 @@ func GetArtifactSources(
 	}
 	return result
 }
+
+// Estimate the hunt's progress from the number of scheduled clients
+// which completed. New clients may still be scheduled while the hunt
+// is running so this is only an estimate for the currently scheduled
+// clients.
+func updateHuntProgress(hunt *api_proto.Hunt) {
+	if hunt.Stats == nil || hunt.State != api_proto.Hunt_RUNNING {
+		return
+	}
+
+	now := uint64(utils.GetTime().Now().UnixNano() / 1000)
+	hunt.Stats.ProgressPercent, hunt.Stats.EstimatedCompletionTime =
+		utils.EstimateProgress(hunt.Stats.TotalClientsWithResults,
+			hunt.Stats.TotalClientsScheduled, hunt.StartTime, now)
+}
@@ -0,0 +1,87 @@
+package hunt_manager
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/dustin/go-humanize"
+	api_proto "www.velocidex.com/golang/velociraptor/api/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+// The error rate is meaningless for the first few completions so we
+// only enforce it after this many clients returned.
+const MIN_CLIENTS_FOR_ERROR_RATE = 10
+
+// Returns a description of the exceeded budget or "" if the hunt is
+// within its budget.
+func checkHuntBudget(hunt_obj *api_proto.Hunt) string {
+	stats := hunt_obj.Stats
+	if stats == nil {
+		return ""
+	}
+
+	if hunt_obj.MaxTotalUploadBytes > 0 &&
+		stats.TotalUploadedBytes > hunt_obj.MaxTotalUploadBytes {
+		return fmt.Sprintf("Uploaded %v exceeds budget of %v",
+			humanize.Bytes(stats.TotalUploadedBytes),
+			humanize.Bytes(hunt_obj.MaxTotalUploadBytes))
+	}
+
+	if hunt_obj.MaxTotalExecutionSeconds > 0 &&
+		stats.TotalExecutionSeconds > hunt_obj.MaxTotalExecutionSeconds {
+		return fmt.Sprintf("Execution time %.0fs exceeds budget of %.0fs",
+			stats.TotalExecutionSeconds, hunt_obj.MaxTotalExecutionSeconds)
+	}
+
+	if hunt_obj.MaxErrorRate > 0 &&
+		stats.TotalClientsWithResults >= MIN_CLIENTS_FOR_ERROR_RATE {
+		error_rate := float64(stats.TotalClientsWithErrors) /
+			float64(stats.TotalClientsWithResults)
+		if error_rate > hunt_obj.MaxErrorRate {
+			return fmt.Sprintf("Error rate %.2f exceeds budget of %.2f",
+				error_rate, hunt_obj.MaxErrorRate)
+		}
+	}
+
+	return ""
+}
+
+// Let the hunt's creator know the hunt was paused by raising an
+// alert assigned to them.
+func notifyHuntBudgetExceeded(
+	ctx context.Context, config_obj *config_proto.Config,
+	hunt_id, creator, reason string) error {
+
+	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+	logger.Info("HuntManager: Pausing hunt %v: %v", hunt_id, reason)
+
+	alert := &services.AlertMessage{
+		ClientId:  "server",
+		AlertName: "HuntBudgetExceeded",
+		Timestamp: utils.GetTime().Now().UTC(),
+		EventData: ordereddict.NewDict().
+			Set("HuntId", hunt_id).
+			Set("Reason", reason),
+		ArtifactType:   "SERVER_MONITORING",
+		AssignedToUser: creator,
+	}
+
+	serialized, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	serialized = append(serialized, '\n')
+
+	journal, err := services.GetJournal(config_obj)
+	if err != nil {
+		return err
+	}
+	return journal.PushJsonlToArtifact(ctx, config_obj,
+		serialized, 1, "Server.Internal.Alerts", "server", "")
+}
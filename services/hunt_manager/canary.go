@@ -0,0 +1,65 @@
+package hunt_manager
+
+import (
+	"context"
+	"fmt"
+
+	api_proto "www.velocidex.com/golang/velociraptor/api/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+)
+
+// A canary hunt is first scheduled on CanaryClients clients. Once
+// they all completed, the health gate decides if the hunt expands
+// to the rest of the fleet. Client upgrades are collected using
+// hunts so they can be rolled out the same way.
+func inCanaryStage(hunt_obj *api_proto.Hunt) bool {
+	return hunt_obj.CanaryClients > 0 &&
+		(hunt_obj.Stats == nil || !hunt_obj.Stats.CanaryComplete)
+}
+
+// Returns true when the canary stage is complete. If the canary
+// clients failed the health gate a reason is returned too.
+func checkCanary(hunt_obj *api_proto.Hunt) (bool, string) {
+	if !inCanaryStage(hunt_obj) || hunt_obj.Stats == nil ||
+		hunt_obj.Stats.TotalClientsWithResults < hunt_obj.CanaryClients {
+		return false, ""
+	}
+
+	stats := hunt_obj.Stats
+	error_rate := float64(stats.TotalClientsWithErrors) /
+		float64(stats.TotalClientsWithResults)
+	if error_rate > hunt_obj.CanaryMaxErrorRate {
+		return true, fmt.Sprintf(
+			"Canary error rate %.2f exceeds health gate of %.2f",
+			error_rate, hunt_obj.CanaryMaxErrorRate)
+	}
+
+	return true, ""
+}
+
+func checkCanaryParticipation(
+	ctx context.Context, config_obj *config_proto.Config,
+	hunt_obj *api_proto.Hunt, client_id string) error {
+	if !inCanaryStage(hunt_obj) {
+		return nil
+	}
+
+	// Clients rejected here will participate again when the hunt
+	// expands.
+	if hunt_obj.Stats != nil &&
+		hunt_obj.Stats.TotalClientsScheduled >= hunt_obj.CanaryClients {
+		return fmt.Errorf("Hunt %v: waiting for canary clients to complete",
+			hunt_obj.HuntId)
+	}
+
+	if hunt_obj.CanaryLabel != "" {
+		labeler := services.GetLabeler(config_obj)
+		if !labeler.IsLabelSet(ctx, config_obj, client_id, hunt_obj.CanaryLabel) {
+			return fmt.Errorf("Hunt %v: %v is not a canary client",
+				hunt_obj.HuntId, client_id)
+		}
+	}
+
+	return nil
+}
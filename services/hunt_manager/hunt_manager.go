@@ -50,6 +50,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
 	"sync"
 	"time"
 
@@ -94,6 +95,11 @@ type HuntManager struct {
 	// Limits how quickly we schedule hunts. Should be fast enough
 	// to be reasoable without overloading frontends
 	limiter *rate.Limiter
+
+	// The last recorded state of each client in each hunt. Loaded
+	// from the hunt's progress table on first use.
+	progress_mu sync.Mutex
+	progress    map[string]map[string]string
 }
 
 func (self *HuntManager) Start(
@@ -105,7 +111,14 @@ func (self *HuntManager) Start(
 		services.GetOrgName(config_obj),
 		config_obj.Frontend.Resources.NotificationsPerSecond)
 
-	err := journal.WatchQueueWithCB(ctx, config_obj, wg,
+	// Pick up running hunts where we left off before processing
+	// any new events.
+	err := self.resumeHunts(ctx, config_obj)
+	if err != nil {
+		logger.Error("HuntManager: Resuming hunts: %v", err)
+	}
+
+	err = journal.WatchQueueWithCB(ctx, config_obj, wg,
 		"Server.Internal.HuntModification",
 		"HuntManager",
 		self.ProcessMutation)
@@ -163,6 +176,10 @@ func (self *HuntManager) ProcessMutation(
 		return err
 	}
 
+	if mutation.State == api_proto.Hunt_ARCHIVED {
+		self.forgetProgress(mutation.HuntId)
+	}
+
 	return self.processMutation(ctx, config_obj, mutation)
 }
 
@@ -175,6 +192,9 @@ func (self *HuntManager) processMutation(
 		return err
 	}
 
+	// Set if the hunt was paused because it exceeded its budget.
+	var budget_exceeded, creator string
+
 	modification := dispatcher.ModifyHuntObject(
 		ctx, mutation.HuntId,
 		func(hunt_obj *api_proto.Hunt) services.HuntModificationAction {
@@ -215,6 +235,59 @@ func (self *HuntManager) processMutation(
 				modification = services.HuntFlushToDatastoreAsync
 			}
 
+			if mutation.Stats.TotalUploadedBytes > 0 {
+				hunt_obj.Stats.TotalUploadedBytes +=
+					mutation.Stats.TotalUploadedBytes
+
+				modification = services.HuntFlushToDatastoreAsync
+			}
+
+			if mutation.Stats.TotalExecutionSeconds > 0 {
+				hunt_obj.Stats.TotalExecutionSeconds +=
+					mutation.Stats.TotalExecutionSeconds
+
+				modification = services.HuntFlushToDatastoreAsync
+			}
+
+			// A running hunt that exceeds its budget is paused so
+			// no new clients are scheduled.
+			if hunt_obj.State == api_proto.Hunt_RUNNING {
+				reason := checkHuntBudget(hunt_obj)
+				if reason != "" {
+					hunt_obj.Stats.Stopped = true
+					hunt_obj.State = api_proto.Hunt_PAUSED
+					hunt_obj.Stats.BudgetExceeded = reason
+					budget_exceeded = reason
+					creator = hunt_obj.Creator
+
+					modification = services.HuntPropagateChanges
+				}
+			}
+
+			// When all the canary clients completed either expand
+			// the hunt to the rest of the fleet or halt it.
+			if hunt_obj.State == api_proto.Hunt_RUNNING {
+				done, reason := checkCanary(hunt_obj)
+				if done && reason != "" {
+					hunt_obj.Stats.Stopped = true
+					hunt_obj.State = api_proto.Hunt_PAUSED
+					hunt_obj.Stats.BudgetExceeded = reason
+					budget_exceeded = reason
+					creator = hunt_obj.Creator
+
+					modification = services.HuntPropagateChanges
+
+				} else if done {
+					// Restarting the hunt makes all clients
+					// participate again.
+					hunt_obj.Stats.CanaryComplete = true
+					hunt_obj.StartTime = uint64(
+						utils.GetTime().Now().UnixNano() / 1000)
+
+					modification = services.HuntTriggerParticipation
+				}
+			}
+
 			// These modifications affect the state of the hunt and so
 			// need to propagate to all minions
 			// immediately. Eventually they will also hit the
@@ -263,6 +336,15 @@ func (self *HuntManager) processMutation(
 			return modification
 		})
 
+	if budget_exceeded != "" {
+		err := notifyHuntBudgetExceeded(ctx, config_obj,
+			mutation.HuntId, creator, budget_exceeded)
+		if err != nil {
+			logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+			logger.Error("HuntManager: %v", err)
+		}
+	}
+
 	// Force the dispatcher to write the index.
 	if modification == services.HuntPropagateChanges {
 		return dispatcher.Refresh(ctx, config_obj)
@@ -298,6 +380,12 @@ func (self *HuntManager) maybeDirectlyAssignFlow(
 		return err
 	}
 
+	err = self.setProgress(ctx, config_obj, mutation.HuntId,
+		assignment.ClientId, assignment.FlowId, PROGRESS_COMPLETED)
+	if err != nil {
+		return err
+	}
+
 	path_manager := paths.NewHuntPathManager(mutation.HuntId)
 	err = journal.AppendToResultSet(config_obj,
 		path_manager.Clients(), []*ordereddict.Dict{
@@ -341,10 +429,11 @@ func (self *HuntManager) ProcessInterrogation(
 
 	return self.participateInRunningHunts(ctx, config_obj, client_id,
 		// When a new client is interrogated, it can only really
-		// affect hunts with OS conditions.
+		// affect hunts with OS or hostname conditions.
 		func(hunt *api_proto.Hunt) bool {
 			return hunt.Condition != nil &&
-				hunt.Condition.GetOs() != nil
+				(hunt.Condition.GetOs() != nil ||
+					hunt.Condition.HostnameRegex != "")
 		})
 }
 
@@ -389,6 +478,32 @@ func (self *HuntManager) ProcessFlowCompletion(
 		return nil
 	}
 
+	client_id, _ := row.GetString("ClientId")
+	if client_id == "" {
+		client_id = flow.ClientId
+	}
+
+	// The completion may be delivered again after a restart. It
+	// was already counted.
+	state, err := self.getProgress(ctx, config_obj, hunt_id, client_id)
+	if err != nil {
+		return err
+	}
+
+	if state == PROGRESS_COMPLETED || state == PROGRESS_ERROR {
+		return nil
+	}
+
+	state = PROGRESS_COMPLETED
+	if flow.State == flows_proto.ArtifactCollectorContext_ERROR {
+		state = PROGRESS_ERROR
+	}
+
+	err = self.setProgress(ctx, config_obj, hunt_id, client_id, flow_id, state)
+	if err != nil {
+		return err
+	}
+
 	// Flow is complete so add it to the hunt stats. We send a
 	// mutation to the hunt dispatcher to mediate internal hunt state
 	// manipulation.
@@ -405,11 +520,16 @@ func (self *HuntManager) ProcessFlowCompletion(
 		mutation.Stats.TotalClientsWithErrors = 1
 	}
 
+	// Account the collection's resources against the hunt's budget.
+	mutation.Stats.TotalUploadedBytes = flow.TotalUploadedBytes
+	mutation.Stats.TotalExecutionSeconds = float64(
+		flow.ExecutionDuration) / 1e9
+
 	// The minion hunt dispatcher does not actually care about flow
 	// status, so we dont bother broadcasting a mutation for them. We
 	// only need to update the local hunt dispatcher on the master
 	// node which will flush to disk eventually.
-	err := self.processMutation(ctx, config_obj, mutation)
+	err = self.processMutation(ctx, config_obj, mutation)
 	if err != nil {
 		return err
 	}
@@ -545,14 +665,40 @@ func (self *HuntManager) ProcessParticipationWithError(
 		return err
 	}
 
+	// The index may not have been written if the server stopped
+	// while scheduling. This also loads the hunt's progress so the
+	// stats are up to date.
+	state, err := self.getProgress(ctx, config_obj,
+		participation_row.HuntId, participation_row.ClientId)
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case PROGRESS_SCHEDULED, PROGRESS_COMPLETED, PROGRESS_ERROR:
+		return fmt.Errorf("hunt_manager: %v already scheduled on client %v",
+			participation_row.HuntId, participation_row.ClientId)
+	}
+
 	hunt_obj, pres := dispatcher.GetHunt(ctx, participation_row.HuntId)
 	if !pres {
 		return fmt.Errorf("Hunt %v not known", participation_row.HuntId)
 	}
 
+	// The server stopped after the flow was written but before we
+	// recorded it. Finish recording it rather than task the client
+	// again.
+	if state == PROGRESS_SCHEDULING {
+		flow_id := hunt_obj.StartRequest.GetFlowId()
+		if self.flowExists(ctx, config_obj, participation_row.ClientId, flow_id) {
+			return self.recordHuntOnClient(ctx, config_obj,
+				hunt_obj.HuntId, participation_row.ClientId, flow_id)
+		}
+	}
+
 	// The event may override the regular hunt logic.
 	if participation_row.Override {
-		return scheduleHuntOnClient(ctx, config_obj,
+		return self.scheduleHuntOnClient(ctx, config_obj,
 			hunt_obj, participation_row.ClientId)
 	}
 
@@ -574,6 +720,17 @@ func (self *HuntManager) ProcessParticipationWithError(
 		participation_row.ClientId) {
 		return fmt.Errorf("Hunt %v: hunt label does not match with %v",
 			participation_row.HuntId, participation_row.ClientId)
+
+	} else if !huntMatchesClient(hunt_obj, client_info) {
+		return fmt.Errorf("Hunt %v: %v does not match client condition",
+			participation_row.HuntId, participation_row.ClientId)
+	}
+
+	// During the canary stage only a few clients are scheduled.
+	err = checkCanaryParticipation(ctx, config_obj, hunt_obj,
+		participation_row.ClientId)
+	if err != nil {
+		return err
 	}
 
 	// Hunt limit exceeded or it expired - we stop it.
@@ -594,7 +751,7 @@ func (self *HuntManager) ProcessParticipationWithError(
 
 	// Use hunt information to launch the flow against this
 	// client.
-	return scheduleHuntOnClient(ctx,
+	return self.scheduleHuntOnClient(ctx,
 		config_obj, hunt_obj, participation_row.ClientId)
 }
 
@@ -609,6 +766,7 @@ func NewHuntManager(
 	}
 
 	result := &HuntManager{
+		progress: make(map[string]map[string]string),
 		limiter: rate.NewLimiter(rate.Limit(
 			config_obj.Frontend.Resources.NotificationsPerSecond), 1),
 		scope: manager.BuildScope(
@@ -694,6 +852,29 @@ func huntMatchesOS(hunt_obj *api_proto.Hunt, client_info *services.ClientInfo) b
 	return true
 }
 
+// Check the hostname and enrollment time conditions.
+func huntMatchesClient(
+	hunt_obj *api_proto.Hunt, client_info *services.ClientInfo) bool {
+	if hunt_obj.Condition == nil {
+		return true
+	}
+
+	if hunt_obj.Condition.EnrolledAfter > 0 &&
+		client_info.FirstSeenAt < hunt_obj.Condition.EnrolledAfter {
+		return false
+	}
+
+	if hunt_obj.Condition.HostnameRegex != "" {
+		// The regex is validated when the hunt is created.
+		re, err := regexp.Compile("(?i)" + hunt_obj.Condition.HostnameRegex)
+		if err != nil || !re.MatchString(client_info.Hostname) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // Check if we already launched it on this client. We maintain
 // a data store index of all the clients and hunts to be able
 // to quickly check if a certain hunt ran on a particular
@@ -737,7 +918,7 @@ func setHuntRanOnClient(config_obj *config_proto.Config,
 	return nil
 }
 
-func scheduleHuntOnClient(
+func (self *HuntManager) scheduleHuntOnClient(
 	ctx context.Context,
 	config_obj *config_proto.Config,
 	hunt_obj *api_proto.Hunt, client_id string) error {
@@ -765,6 +946,15 @@ func scheduleHuntOnClient(
 	// Direct the request against our client and schedule it.
 	request.ClientId = client_id
 
+	// Hunt flow ids are the same on all clients so if the server
+	// stops before the flow is recorded we can tell if it was
+	// written.
+	err = self.setProgress(ctx, config_obj, hunt_id, client_id,
+		request.FlowId, PROGRESS_SCHEDULING)
+	if err != nil {
+		return err
+	}
+
 	flow_id, err := launcher.ScheduleArtifactCollection(
 		ctx, config_obj, acl_managers.NullACLManager{},
 		repository, request, nil)
@@ -772,6 +962,32 @@ func scheduleHuntOnClient(
 		return err
 	}
 
+	return self.recordHuntOnClient(ctx, config_obj, hunt_id, client_id, flow_id)
+}
+
+// Check if the hunt's flow was written on the client.
+func (self *HuntManager) flowExists(
+	ctx context.Context, config_obj *config_proto.Config,
+	client_id, flow_id string) bool {
+	if flow_id == "" {
+		return false
+	}
+
+	launcher, err := services.GetLauncher(config_obj)
+	if err != nil {
+		return false
+	}
+
+	_, err = launcher.Storage().LoadCollectionContext(
+		ctx, config_obj, client_id, flow_id)
+	return err == nil
+}
+
+// Record the flow scheduled on the client in the hunt.
+func (self *HuntManager) recordHuntOnClient(
+	ctx context.Context, config_obj *config_proto.Config,
+	hunt_id, client_id, flow_id string) error {
+
 	journal, err := services.GetJournal(config_obj)
 	if err != nil {
 		return err
@@ -793,6 +1009,12 @@ func scheduleHuntOnClient(
 		return err
 	}
 
+	err = self.setProgress(ctx, config_obj, hunt_id, client_id,
+		flow_id, PROGRESS_SCHEDULED)
+	if err != nil {
+		return err
+	}
+
 	// Modify the hunt stats.
 	dispatcher, err := services.GetHuntDispatcher(config_obj)
 	if err != nil {
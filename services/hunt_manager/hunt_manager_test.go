@@ -599,6 +599,80 @@ func (self *HuntTestSuite) TestHuntClientOSCondition() {
 	assert.Error(t, err)
 }
 
+func (self *HuntTestSuite) TestHuntClientHostnameCondition() {
+	t := self.T()
+
+	// Only recently enrolled workstations should run this hunt.
+	hunt_obj := &api_proto.Hunt{
+		HuntId:       self.hunt_id,
+		StartRequest: self.expected,
+		State:        api_proto.Hunt_RUNNING,
+		Stats:        &api_proto.HuntStats{},
+		Expires:      uint64(time.Now().Add(7*24*time.Hour).UTC().UnixNano() / 1000),
+		Condition: &api_proto.HuntCondition{
+			HostnameRegex: "^WKS-",
+			EnrolledAfter: 1000,
+		},
+	}
+	flow_id := hunt_obj.StartRequest.FlowId
+
+	client_info_manager, err := services.GetClientInfoManager(self.ConfigObj)
+	assert.NoError(t, err)
+
+	clients := []*services.ClientInfo{
+		{actions_proto.ClientInfo{
+			ClientId: "C.12331", Hostname: "wks-01", FirstSeenAt: 2000}},
+
+		// Does not match the hostname regex.
+		{actions_proto.ClientInfo{
+			ClientId: "C.12332", Hostname: "SRV-01", FirstSeenAt: 2000}},
+
+		// Enrolled before the cutoff.
+		{actions_proto.ClientInfo{
+			ClientId: "C.12333", Hostname: "WKS-02", FirstSeenAt: 500}},
+	}
+
+	rows := []*ordereddict.Dict{}
+	for _, client_info := range clients {
+		err = client_info_manager.Set(self.Ctx, client_info)
+		assert.NoError(t, err)
+
+		rows = append(rows, ordereddict.NewDict().
+			Set("HuntId", self.hunt_id).
+			Set("ClientId", client_info.ClientId))
+	}
+
+	db, err := datastore.GetDB(self.ConfigObj)
+	assert.NoError(t, err)
+
+	hunt_path_manager := paths.NewHuntPathManager(hunt_obj.HuntId)
+	err = db.SetSubject(self.ConfigObj, hunt_path_manager.Path(), hunt_obj)
+	assert.NoError(t, err)
+
+	hunt_dispatcher, err := services.GetHuntDispatcher(self.ConfigObj)
+	assert.NoError(t, err)
+	hunt_dispatcher.Refresh(self.Ctx, self.ConfigObj)
+
+	// Simulate a System.Hunt.Participation event
+	journal, err := services.GetJournal(self.ConfigObj)
+	assert.NoError(t, err)
+
+	journal.PushRowsToArtifact(self.Ctx, self.ConfigObj,
+		rows, "System.Hunt.Participation", self.client_id, "")
+
+	vtesting.WaitUntil(5*time.Second, self.T(), func() bool {
+		_, err = self.storage_manager.LoadCollectionContext(
+			self.Ctx, self.ConfigObj, "C.12331", flow_id)
+		return err == nil
+	})
+
+	for _, client_id := range []string{"C.12332", "C.12333"} {
+		_, err = self.storage_manager.LoadCollectionContext(
+			self.Ctx, self.ConfigObj, client_id, flow_id)
+		assert.Error(t, err, client_id)
+	}
+}
+
 // When interrogating for the first time, the initial client record
 // has no OS populated so might not trigger an OS condition hunt. This
 // test ensures that after interrogating the client gets another
@@ -837,6 +911,133 @@ func (self *HuntTestSuite) TestHuntManagerErrors() {
 	})
 }
 
+// A hunt exceeding its upload budget is paused.
+func (self *HuntTestSuite) TestHuntManagerBudget() {
+	hunt_obj := &api_proto.Hunt{
+		HuntId:              self.hunt_id,
+		Creator:             "admin",
+		StartRequest:        self.expected,
+		State:               api_proto.Hunt_RUNNING,
+		Stats:               &api_proto.HuntStats{},
+		Expires:             uint64(time.Now().Add(7*24*time.Hour).UTC().UnixNano() / 1000),
+		MaxTotalUploadBytes: 1000,
+	}
+
+	db, err := datastore.GetDB(self.ConfigObj)
+	assert.NoError(self.T(), err)
+
+	hunt_path_manager := paths.NewHuntPathManager(hunt_obj.HuntId)
+	err = db.SetSubject(self.ConfigObj, hunt_path_manager.Path(), hunt_obj)
+	assert.NoError(self.T(), err)
+
+	dispatcher, err := services.GetHuntDispatcher(self.ConfigObj)
+	assert.NoError(self.T(), err)
+	dispatcher.Refresh(self.Ctx, self.ConfigObj)
+
+	journal, err := services.GetJournal(self.ConfigObj)
+	assert.NoError(self.T(), err)
+
+	// The collection uploaded more than the hunt's budget.
+	flow_obj := &flows_proto.ArtifactCollectorContext{
+		Request:            proto.Clone(hunt_obj.StartRequest).(*flows_proto.ArtifactCollectorArgs),
+		State:              flows_proto.ArtifactCollectorContext_FINISHED,
+		TotalUploadedBytes: 2000,
+		ExecutionDuration:  5 * int64(time.Second),
+	}
+
+	assert.NoError(self.T(), journal.PushRowsToArtifact(self.Ctx, self.ConfigObj,
+		[]*ordereddict.Dict{ordereddict.NewDict().
+			Set("Timestamp", time.Now().UTC().Unix()).
+			Set("Flow", flow_obj).
+			Set("FlowId", utils.CreateFlowIdFromHuntId(self.hunt_id)).
+			Set("ClientId", self.client_id),
+		}, "System.Flow.Completion", self.client_id, ""))
+
+	vtesting.WaitUntil(5*time.Second, self.T(), func() bool {
+		h, _ := dispatcher.GetHunt(self.Ctx, hunt_obj.HuntId)
+		return h.State == api_proto.Hunt_PAUSED
+	})
+
+	h, _ := dispatcher.GetHunt(self.Ctx, hunt_obj.HuntId)
+	assert.True(self.T(), h.Stats.Stopped)
+	assert.Equal(self.T(), uint64(2000), h.Stats.TotalUploadedBytes)
+	assert.Equal(self.T(), float64(5), h.Stats.TotalExecutionSeconds)
+	assert.Contains(self.T(), h.Stats.BudgetExceeded, "exceeds budget")
+}
+
+// A restarted server resumes the hunt from its progress table.
+func (self *HuntTestSuite) TestHuntManagerResume() {
+	hunt_obj := &api_proto.Hunt{
+		HuntId:       self.hunt_id,
+		StartRequest: self.expected,
+		State:        api_proto.Hunt_RUNNING,
+		Stats:        &api_proto.HuntStats{},
+		Expires:      uint64(time.Now().Add(7*24*time.Hour).UTC().UnixNano() / 1000),
+	}
+
+	db, err := datastore.GetDB(self.ConfigObj)
+	assert.NoError(self.T(), err)
+
+	hunt_path_manager := paths.NewHuntPathManager(hunt_obj.HuntId)
+	err = db.SetSubject(self.ConfigObj, hunt_path_manager.Path(), hunt_obj)
+	assert.NoError(self.T(), err)
+
+	dispatcher, err := services.GetHuntDispatcher(self.ConfigObj)
+	assert.NoError(self.T(), err)
+	dispatcher.Refresh(self.Ctx, self.ConfigObj)
+
+	journal, err := services.GetJournal(self.ConfigObj)
+	assert.NoError(self.T(), err)
+
+	// Before the restart the client completed the hunt but the
+	// stats were never written and the hunt index was lost.
+	flow_id := hunt_obj.StartRequest.FlowId
+	err = journal.AppendToResultSet(self.ConfigObj,
+		hunt_path_manager.Progress(), []*ordereddict.Dict{
+			ordereddict.NewDict().
+				Set("ClientId", self.client_id).
+				Set("FlowId", flow_id).
+				Set("State", hunt_manager.PROGRESS_SCHEDULED),
+			ordereddict.NewDict().
+				Set("ClientId", self.client_id).
+				Set("FlowId", flow_id).
+				Set("State", hunt_manager.PROGRESS_COMPLETED),
+		}, services.JournalOptions{Sync: true})
+	assert.NoError(self.T(), err)
+
+	// The client is not tasked again.
+	err = hunt_manager.HuntManagerForTests.ProcessParticipationWithError(
+		self.Ctx, self.ConfigObj, ordereddict.NewDict().
+			Set("HuntId", hunt_obj.HuntId).
+			Set("ClientId", self.client_id))
+	assert.Error(self.T(), err)
+
+	_, err = self.storage_manager.LoadCollectionContext(self.Ctx,
+		self.ConfigObj, self.client_id, flow_id)
+	assert.Error(self.T(), err)
+
+	// The stats are recovered from the progress table.
+	h, _ := dispatcher.GetHunt(self.Ctx, hunt_obj.HuntId)
+	assert.Equal(self.T(), uint64(1), h.Stats.TotalClientsScheduled)
+	assert.Equal(self.T(), uint64(1), h.Stats.TotalClientsWithResults)
+
+	// A completion delivered again is not counted twice.
+	flow_obj := &flows_proto.ArtifactCollectorContext{
+		Request: proto.Clone(hunt_obj.StartRequest).(*flows_proto.ArtifactCollectorArgs),
+		State:   flows_proto.ArtifactCollectorContext_FINISHED,
+	}
+
+	err = hunt_manager.HuntManagerForTests.ProcessFlowCompletion(
+		self.Ctx, self.ConfigObj, ordereddict.NewDict().
+			Set("Flow", flow_obj).
+			Set("FlowId", flow_id).
+			Set("ClientId", self.client_id))
+	assert.NoError(self.T(), err)
+
+	h, _ = dispatcher.GetHunt(self.Ctx, hunt_obj.HuntId)
+	assert.Equal(self.T(), uint64(1), h.Stats.TotalClientsWithResults)
+}
+
 func TestHuntTestSuite(t *testing.T) {
 	suite.Run(t, &HuntTestSuite{
 		client_id: "C.234",
@@ -0,0 +1,222 @@
+package hunt_manager
+
+// The hunt manager records every change in a client's progress
+// through a hunt in the hunt's progress table. Each row is written
+// synchronously so the table survives a server restart. The first
+// time the hunt manager sees a hunt it replays the table and resumes
+// where it left off:
+//
+// - Clients which were scheduled, completed or errored are never
+//   tasked again.
+// - A client which was being scheduled when the server stopped is
+//   only tasked if its flow was never written.
+// - Completions which were already counted are not counted again.
+// - The hunt stats, which are only lazily written to the datastore,
+//   are corrected from the table.
+
+import (
+	"context"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	api_proto "www.velocidex.com/golang/velociraptor/api/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/file_store"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/result_sets"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+const (
+	PROGRESS_SCHEDULING = "Scheduling"
+	PROGRESS_SCHEDULED  = "Scheduled"
+	PROGRESS_COMPLETED  = "Completed"
+	PROGRESS_ERROR      = "Error"
+)
+
+// Returns the client's last recorded state in the hunt or "" if
+// the client never participated.
+func (self *HuntManager) getProgress(
+	ctx context.Context, config_obj *config_proto.Config,
+	hunt_id, client_id string) (string, error) {
+	self.progress_mu.Lock()
+	defer self.progress_mu.Unlock()
+
+	clients, err := self.loadProgress(ctx, config_obj, hunt_id)
+	if err != nil {
+		return "", err
+	}
+
+	return clients[client_id], nil
+}
+
+func (self *HuntManager) setProgress(
+	ctx context.Context, config_obj *config_proto.Config,
+	hunt_id, client_id, flow_id, state string) error {
+	self.progress_mu.Lock()
+	defer self.progress_mu.Unlock()
+
+	clients, err := self.loadProgress(ctx, config_obj, hunt_id)
+	if err != nil {
+		return err
+	}
+
+	journal, err := services.GetJournal(config_obj)
+	if err != nil {
+		return err
+	}
+
+	path_manager := paths.NewHuntPathManager(hunt_id)
+	err = journal.AppendToResultSet(config_obj, path_manager.Progress(),
+		[]*ordereddict.Dict{ordereddict.NewDict().
+			Set("ClientId", client_id).
+			Set("FlowId", flow_id).
+			Set("State", state).
+			Set("Timestamp", utils.GetTime().Now().Unix())},
+		services.JournalOptions{Sync: true})
+	if err != nil {
+		return err
+	}
+
+	clients[client_id] = state
+	return nil
+}
+
+// Archived hunts will not see any more activity.
+func (self *HuntManager) forgetProgress(hunt_id string) {
+	self.progress_mu.Lock()
+	defer self.progress_mu.Unlock()
+
+	delete(self.progress, hunt_id)
+}
+
+// Replay the hunt's progress table. Called with the lock held.
+func (self *HuntManager) loadProgress(
+	ctx context.Context, config_obj *config_proto.Config,
+	hunt_id string) (map[string]string, error) {
+	clients, pres := self.progress[hunt_id]
+	if pres {
+		return clients, nil
+	}
+
+	path_manager := paths.NewHuntPathManager(hunt_id)
+	file_store_factory := file_store.GetFileStore(config_obj)
+	rs_reader, err := result_sets.NewResultSetReader(
+		file_store_factory, path_manager.Progress())
+	if err != nil {
+		return nil, err
+	}
+	defer rs_reader.Close()
+
+	clients = make(map[string]string)
+	for row := range rs_reader.Rows(ctx) {
+		client_id, _ := row.GetString("ClientId")
+		state, _ := row.GetString("State")
+		if client_id != "" {
+			clients[client_id] = state
+		}
+	}
+
+	self.progress[hunt_id] = clients
+
+	if len(clients) > 0 {
+		self.reconcileStats(ctx, config_obj, hunt_id, clients)
+	}
+
+	return clients, nil
+}
+
+// Stats increments which were not yet written when the server
+// stopped are lost. The progress table tells us what they should
+// be. Counters are never decreased since hunts started before the
+// progress table existed only have part of their history in it.
+func (self *HuntManager) reconcileStats(
+	ctx context.Context, config_obj *config_proto.Config,
+	hunt_id string, clients map[string]string) {
+
+	var scheduled, with_results, with_errors uint64
+	for _, state := range clients {
+		switch state {
+		case PROGRESS_SCHEDULED:
+			scheduled++
+		case PROGRESS_COMPLETED:
+			scheduled++
+			with_results++
+		case PROGRESS_ERROR:
+			scheduled++
+			with_results++
+			with_errors++
+		}
+	}
+
+	dispatcher, err := services.GetHuntDispatcher(config_obj)
+	if err != nil {
+		return
+	}
+
+	dispatcher.ModifyHuntObject(ctx, hunt_id,
+		func(hunt_obj *api_proto.Hunt) services.HuntModificationAction {
+			if hunt_obj == nil {
+				return services.HuntUnmodified
+			}
+
+			if hunt_obj.Stats == nil {
+				hunt_obj.Stats = &api_proto.HuntStats{}
+			}
+
+			stats := hunt_obj.Stats
+			if stats.TotalClientsScheduled >= scheduled &&
+				stats.TotalClientsWithResults >= with_results &&
+				stats.TotalClientsWithErrors >= with_errors {
+				return services.HuntUnmodified
+			}
+
+			logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+			logger.Info("<green>HuntManager</>: Resuming %v with %v clients scheduled, %v completed and %v errored",
+				hunt_id, scheduled, with_results, with_errors)
+
+			stats.TotalClientsScheduled = max(stats.TotalClientsScheduled, scheduled)
+			stats.TotalClientsWithResults = max(stats.TotalClientsWithResults, with_results)
+			stats.TotalClientsWithErrors = max(stats.TotalClientsWithErrors, with_errors)
+
+			return services.HuntFlushToDatastoreAsync
+		})
+}
+
+// Replay the progress of all running hunts so their stats are
+// correct as soon as the hunt manager starts.
+func (self *HuntManager) resumeHunts(
+	ctx context.Context, config_obj *config_proto.Config) error {
+	dispatcher, err := services.GetHuntDispatcher(config_obj)
+	if err != nil {
+		return err
+	}
+
+	var hunt_ids []string
+	err = dispatcher.ApplyFuncOnHunts(ctx, services.OnlyRunningHunts,
+		func(hunt *api_proto.Hunt) error {
+			hunt_ids = append(hunt_ids, hunt.HuntId)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	start := utils.GetTime().Now()
+	for _, hunt_id := range hunt_ids {
+		_, err := self.getProgress(ctx, config_obj, hunt_id, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(hunt_ids) > 0 {
+		logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+		logger.Info("<green>HuntManager</>: Loaded progress of %v running hunts in %v",
+			len(hunt_ids), utils.GetTime().Now().Sub(start).Round(time.Millisecond))
+	}
+
+	return nil
+}
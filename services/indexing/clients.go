@@ -87,6 +87,10 @@ func GetApiClient(
 	result.FirstSeenAt = public_key_info.EnrollTime
 	result.LastSeenAt = client_info.Ping
 	result.LastIp = client_info.IpAddress
+	result.HeartbeatStatus = client_info.HeartbeatStatus
+	result.QueuedBytes = client_info.QueuedBytes
+	result.DroppedMessages = client_info.DroppedMessages
+	result.DroppedBytes = client_info.DroppedBytes
 
 	return result, nil
 }
@@ -152,5 +156,9 @@ func (self *Indexer) _FastGetApiClient(
 		LastIp:                      client_info.IpAddress,
 		LastInterrogateFlowId:       client_info.LastInterrogateFlowId,
 		LastInterrogateArtifactName: client_info.LastInterrogateArtifactName,
+		HeartbeatStatus:             client_info.HeartbeatStatus,
+		QueuedBytes:                 client_info.QueuedBytes,
+		DroppedMessages:             client_info.DroppedMessages,
+		DroppedBytes:                client_info.DroppedBytes,
 	}, nil
 }
@@ -121,9 +121,10 @@ func (self *EnrollmentService) ProcessEnrollment(
 	client_info, err := client_info_manager.Get(ctx, client_id)
 
 	// If we have a valid client record we do not need to
-	// interrogate. Interrogation happens automatically only once
-	// - the first time a client appears.
-	if err == nil && client_info.LastInterrogateFlowId != "" {
+	// interrogate. Interrogation happens automatically the first
+	// time a client appears and then periodically if
+	// Defaults.reinterrogate_period_hours is set.
+	if err == nil && !client_info.NeedsInterrogation(config_obj) {
 		return nil
 	}
 
@@ -145,7 +146,7 @@ func (self *EnrollmentService) ProcessEnrollment(
 
 	// Try again in case things changed while we waited for the limiter.
 	client_info, err = client_info_manager.Get(ctx, client_id)
-	if err == nil && client_info.LastInterrogateFlowId != "" {
+	if err == nil && !client_info.NeedsInterrogation(config_obj) {
 		return nil
 	}
 
@@ -215,6 +216,7 @@ func (self *EnrollmentService) ProcessEnrollment(
 			}
 			client_info.LastInterrogateFlowId = flow_id
 			client_info.LastInterrogateArtifactName = interrogation_artifact
+			client_info.LastInterrogateTime = uint64(utils.GetTime().Now().Unix())
 
 			return client_info, nil
 		})
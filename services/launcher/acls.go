@@ -70,6 +70,13 @@ func checkRequiredPermissions(
 	// Principal must have ALL permissions to succeed.
 	for _, perm := range artifact.RequiredPermissions {
 		permission := acls.GetPermission(perm)
+
+		// Dual authorization is checked against approvals when the
+		// collection is scheduled.
+		if permission == acls.DUAL_AUTHORIZATION {
+			continue
+		}
+
 		perm, err := acl_manager.CheckAccess(permission)
 		if !perm {
 			if err != nil {
@@ -0,0 +1,353 @@
+/*
+  Some artifacts are too sensitive to be collected on the say so of
+  a single user (for example artifacts collecting credential
+  stores). Such artifacts list the DUAL_AUTHORIZATION permission in
+  their required_permissions.
+
+  Before collecting such an artifact, one user requests an approval
+  to collect the artifact from a specific client and a second user
+  grants it. The approval may then be used by either user to
+  schedule exactly one collection before it expires.
+
+  Hunts and group tasks can not collect these artifacts since they
+  are not addressed to a single client.
+*/
+
+package launcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"www.velocidex.com/golang/velociraptor/acls"
+	artifacts_proto "www.velocidex.com/golang/velociraptor/artifacts/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/datastore"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+var (
+	// Serialize updates to approvals so each approval is only
+	// used once.
+	approvals_mu sync.Mutex
+)
+
+type Approval struct {
+	Id        string `json:"Id"`
+	ClientId  string `json:"ClientId"`
+	Artifact  string `json:"Artifact"`
+	Reason    string `json:"Reason"`
+	Requester string `json:"Requester"`
+	Created   int64  `json:"Created"`
+	Expires   int64  `json:"Expires"`
+
+	// Set when a second user grants the approval.
+	Approver string `json:"Approver,omitempty"`
+	Approved int64  `json:"Approved,omitempty"`
+
+	// Set when the approval is used to schedule a collection.
+	UsedBy string `json:"UsedBy,omitempty"`
+	Used   int64  `json:"Used,omitempty"`
+	FlowId string `json:"FlowId,omitempty"`
+}
+
+func RequiresDualAuthorization(artifact *artifacts_proto.Artifact) bool {
+	for _, perm := range artifact.RequiredPermissions {
+		if acls.GetPermission(perm) == acls.DUAL_AUTHORIZATION {
+			return true
+		}
+	}
+	return false
+}
+
+func RequestApproval(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	approval *Approval) (*Approval, error) {
+
+	if approval.Requester == "" {
+		return nil, errors.New("RequestApproval: requester must be specified")
+	}
+
+	if approval.ClientId == "" || approval.ClientId == "server" {
+		return nil, errors.New("RequestApproval: a client id must be specified")
+	}
+
+	if approval.Artifact == "" {
+		return nil, errors.New("RequestApproval: artifact must be specified")
+	}
+
+	now := utils.GetTime().Now().Unix()
+	if approval.Expires <= now {
+		return nil, errors.New("RequestApproval: expiry time is in the past")
+	}
+
+	approval.Id = "A." + utils.NextId()
+	approval.Created = now
+	approval.Approver = ""
+	approval.Approved = 0
+	approval.UsedBy = ""
+	approval.Used = 0
+	approval.FlowId = ""
+
+	err := setApproval(config_obj, approval)
+	if err != nil {
+		return nil, err
+	}
+
+	return approval, nil
+}
+
+// Grant the approval. The approver must be a different user than
+// the requester.
+func GrantApproval(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	principal, id string) (*Approval, error) {
+
+	approvals_mu.Lock()
+	defer approvals_mu.Unlock()
+
+	approval, err := GetApproval(config_obj, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if principal == "" || principal == approval.Requester {
+		return nil, fmt.Errorf(
+			"%w: Approval %v must be granted by a user other than %v",
+			acls.PermissionDenied, id, approval.Requester)
+	}
+
+	if approval.Approved > 0 {
+		return nil, fmt.Errorf("Approval %v is already granted by %v",
+			id, approval.Approver)
+	}
+
+	now := utils.GetTime().Now().Unix()
+	if approval.Expires < now {
+		return nil, fmt.Errorf("Approval %v has expired", id)
+	}
+
+	approval.Approver = principal
+	approval.Approved = now
+
+	err = setApproval(config_obj, approval)
+	if err != nil {
+		return nil, err
+	}
+
+	return approval, nil
+}
+
+func GetApproval(
+	config_obj *config_proto.Config, id string) (*Approval, error) {
+	raw_db, err := getRawDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := raw_db.GetBuffer(config_obj, paths.ApprovalPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.NotFoundError, id)
+	}
+
+	approval := &Approval{}
+	err = json.Unmarshal(data, approval)
+	if err != nil {
+		return nil, err
+	}
+
+	return approval, nil
+}
+
+func ListApprovals(
+	ctx context.Context,
+	config_obj *config_proto.Config) ([]*Approval, error) {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	children, err := db.ListChildren(config_obj, paths.APPROVALS_ROOT)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*Approval, 0, len(children))
+	for _, child := range children {
+		if child.IsDir() {
+			continue
+		}
+
+		approval, err := GetApproval(config_obj, child.Base())
+		if err != nil {
+			continue
+		}
+		result = append(result, approval)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created < result[j].Created
+	})
+
+	return result, nil
+}
+
+// Claim an approval for each artifact in the request which requires
+// dual authorization. The claimed approvals are returned so the
+// caller can record the flow id once the collection is scheduled.
+func claimApprovals(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	repository services.Repository,
+	collector_request *flows_proto.ArtifactCollectorArgs) ([]*Approval, error) {
+
+	var required []string
+	for _, name := range collector_request.Artifacts {
+		artifact, pres := repository.Get(ctx, config_obj, name)
+		if pres && RequiresDualAuthorization(artifact) {
+			required = append(required, artifact.Name)
+		}
+	}
+
+	if len(required) == 0 {
+		return nil, nil
+	}
+
+	client_id := collector_request.ClientId
+	if client_id == "" || client_id == "server" {
+		return nil, fmt.Errorf(
+			"%w: Artifacts %v require dual authorization and may only be collected from a single client",
+			acls.PermissionDenied, required)
+	}
+
+	approvals_mu.Lock()
+	defer approvals_mu.Unlock()
+
+	approvals, err := ListApprovals(ctx, config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	now := utils.GetTime().Now().Unix()
+	principal := collector_request.Creator
+	var result []*Approval
+
+	for _, name := range required {
+		var claimed *Approval
+		for _, approval := range approvals {
+			if approval.ClientId == client_id &&
+				approval.Artifact == name &&
+				approval.Approved > 0 &&
+				approval.Used == 0 &&
+				approval.Expires >= now &&
+				principal != "" &&
+				(principal == approval.Requester ||
+					principal == approval.Approver) {
+				claimed = approval
+				break
+			}
+		}
+
+		if claimed == nil {
+			// Release anything we claimed already.
+			unclaimApprovals(config_obj, result)
+			return nil, fmt.Errorf(
+				"%w: Collecting %v from %v requires an approval granted by a second user",
+				acls.PermissionDenied, name, client_id)
+		}
+
+		claimed.UsedBy = principal
+		claimed.Used = now
+		err := setApproval(config_obj, claimed)
+		if err != nil {
+			unclaimApprovals(config_obj, result)
+			return nil, err
+		}
+		result = append(result, claimed)
+	}
+
+	return result, nil
+}
+
+// Release the approvals when the collection could not be scheduled.
+func releaseApprovals(config_obj *config_proto.Config, approvals []*Approval) {
+	approvals_mu.Lock()
+	defer approvals_mu.Unlock()
+
+	unclaimApprovals(config_obj, approvals)
+}
+
+func unclaimApprovals(config_obj *config_proto.Config, approvals []*Approval) {
+	for _, approval := range approvals {
+		approval.UsedBy = ""
+		approval.Used = 0
+		_ = setApproval(config_obj, approval)
+	}
+}
+
+func recordApprovals(
+	config_obj *config_proto.Config, approvals []*Approval, flow_id string) {
+	approvals_mu.Lock()
+	defer approvals_mu.Unlock()
+
+	for _, approval := range approvals {
+		approval.FlowId = flow_id
+		_ = setApproval(config_obj, approval)
+	}
+}
+
+func setApproval(config_obj *config_proto.Config, approval *Approval) error {
+	raw_db, err := getRawDB(config_obj)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(approval)
+	if err != nil {
+		return err
+	}
+
+	return raw_db.SetBuffer(config_obj, paths.ApprovalPath(approval.Id),
+		data, utils.SyncCompleter)
+}
+
+func getRawDB(config_obj *config_proto.Config) (datastore.RawDataStore, error) {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	raw_db, ok := db.(datastore.RawDataStore)
+	if !ok {
+		return nil, errors.New("Datastore has no raw access.")
+	}
+	return raw_db, nil
+}
+
+// Collections which are not addressed to a single client (e.g. hunts
+// and group tasks) can not be approved so must not include artifacts
+// requiring dual authorization.
+func RejectDualAuthorization(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	repository services.Repository,
+	collector_request *flows_proto.ArtifactCollectorArgs) error {
+	for _, name := range collector_request.Artifacts {
+		artifact, pres := repository.Get(ctx, config_obj, name)
+		if pres && RequiresDualAuthorization(artifact) {
+			return fmt.Errorf(
+				"%w: Artifact %v requires dual authorization and may only be collected from a single client",
+				acls.PermissionDenied, artifact.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package launcher_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/velociraptor/acls"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/services/launcher"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
+)
+
+func (self *LauncherTestSuite) TestDualAuthorization() {
+	repository := self.LoadArtifacts(`
+name: Test.Artifact.DualAuthorization
+required_permissions:
+- DUAL_AUTHORIZATION
+
+sources:
+- query:  |
+    SELECT * FROM info()
+`)
+
+	request := &flows_proto.ArtifactCollectorArgs{
+		Creator:   "UserA",
+		ClientId:  "C.1234",
+		Artifacts: []string{"Test.Artifact.DualAuthorization"},
+	}
+
+	launcher_service, err := services.GetLauncher(self.ConfigObj)
+	assert.NoError(self.T(), err)
+
+	schedule := func(creator string) (string, error) {
+		return launcher_service.ScheduleArtifactCollection(
+			self.Ctx, self.ConfigObj, acl_managers.NullACLManager{},
+			repository, &flows_proto.ArtifactCollectorArgs{
+				Creator:   creator,
+				ClientId:  request.ClientId,
+				Artifacts: request.Artifacts,
+			}, nil)
+	}
+
+	// No approval yet.
+	_, err = schedule("UserA")
+	assert.Error(self.T(), err)
+	assert.True(self.T(), errors.Is(err, acls.PermissionDenied))
+
+	approval, err := launcher.RequestApproval(self.Ctx, self.ConfigObj,
+		&launcher.Approval{
+			ClientId:  "C.1234",
+			Artifact:  "Test.Artifact.DualAuthorization",
+			Reason:    "Testing",
+			Requester: "UserA",
+			Expires:   utils.GetTime().Now().Add(time.Hour).Unix(),
+		})
+	assert.NoError(self.T(), err)
+
+	// Not granted yet.
+	_, err = schedule("UserA")
+	assert.Error(self.T(), err)
+
+	// The requester can not grant their own approval.
+	_, err = launcher.GrantApproval(
+		self.Ctx, self.ConfigObj, "UserA", approval.Id)
+	assert.Error(self.T(), err)
+
+	_, err = launcher.GrantApproval(
+		self.Ctx, self.ConfigObj, "UserB", approval.Id)
+	assert.NoError(self.T(), err)
+
+	// Only the requester or approver may use the approval.
+	_, err = schedule("UserC")
+	assert.Error(self.T(), err)
+
+	flow_id, err := schedule("UserB")
+	assert.NoError(self.T(), err)
+
+	// The approval is only good for one collection.
+	_, err = schedule("UserA")
+	assert.Error(self.T(), err)
+
+	approval, err = launcher.GetApproval(self.ConfigObj, approval.Id)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), "UserB", approval.UsedBy)
+	assert.Equal(self.T(), flow_id, approval.FlowId)
+
+	// Hunts can never collect the artifact.
+	err = launcher.RejectDualAuthorization(
+		self.Ctx, self.ConfigObj, repository,
+		&flows_proto.ArtifactCollectorArgs{
+			Artifacts: request.Artifacts,
+		})
+	assert.Error(self.T(), err)
+}
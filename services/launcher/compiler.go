@@ -343,15 +343,17 @@ func mergeSources(
 		// TODO: Backwards compatibility for older clients.
 		if precondition != "" {
 			result.Query = append(result.Query, &actions_proto.VQLRequest{
-				Name: name,
+				Name:       name,
+				PiiColumns: artifact.PiiColumns,
 				VQL: fmt.Sprintf(
 					"SELECT * FROM if(then=%s, condition=%s, else={SELECT * FROM scope() WHERE log(message='Query skipped due to precondition') AND FALSE})",
 					source_result, precondition_var),
 			})
 		} else {
 			result.Query = append(result.Query, &actions_proto.VQLRequest{
-				Name: name,
-				VQL:  "SELECT * FROM " + source_result,
+				Name:       name,
+				PiiColumns: artifact.PiiColumns,
+				VQL:        "SELECT * FROM " + source_result,
 			})
 		}
 	}
@@ -0,0 +1,229 @@
+/*
+  Dark data are files uploaded by a collection which never made it
+  into any parsed results - for example the artifact's parser failed
+  on the file or the file was in a format the artifact did not
+  understand.
+
+  Without tracking these the evidence is easily lost: the collection
+  simply shows an error or no rows and nobody looks at the uploads
+  again. When a collection completes we record its unparsed uploads
+  so they can be listed with dark_data() and reprocessed by a server
+  artifact with reprocess_uploads().
+*/
+
+package launcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/datastore"
+	"www.velocidex.com/golang/velociraptor/file_store"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/result_sets"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+type DarkDataUpload struct {
+	VFSPath string `json:"VFSPath"`
+	Size    int64  `json:"Size"`
+}
+
+type DarkData struct {
+	ClientId  string            `json:"ClientId"`
+	FlowId    string            `json:"FlowId"`
+	Artifacts []string          `json:"Artifacts"`
+	Reason    string            `json:"Reason"`
+	Uploads   []*DarkDataUpload `json:"Uploads"`
+	Created   int64             `json:"Created"`
+
+	// Set when the uploads are reprocessed.
+	ReprocessedBy   string `json:"ReprocessedBy,omitempty"`
+	Reprocessed     int64  `json:"Reprocessed,omitempty"`
+	ReprocessFlowId string `json:"ReprocessFlowId,omitempty"`
+}
+
+// Returns why the uploads of the collection were not parsed, or an
+// empty string if they were.
+func darkDataReason(stats *flows_proto.ArtifactCollectorContext) string {
+	if stats.TotalUploadedFiles == 0 {
+		return ""
+	}
+
+	for _, s := range stats.QueryStats {
+		if s.UploadedFiles == 0 {
+			continue
+		}
+
+		if s.Status != crypto_proto.VeloStatus_OK {
+			return fmt.Sprintf("Query failed: %v", s.ErrorMessage)
+		}
+
+		if s.ResultRows == 0 {
+			return "Query uploaded files but returned no results"
+		}
+	}
+
+	return ""
+}
+
+// Called when a collection completes to record its uploads if
+// they were not parsed.
+func RecordDarkData(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	stats *flows_proto.ArtifactCollectorContext) error {
+
+	reason := darkDataReason(stats)
+	if reason == "" {
+		return nil
+	}
+
+	record := &DarkData{
+		ClientId: stats.ClientId,
+		FlowId:   stats.SessionId,
+		Reason:   reason,
+		Created:  utils.GetTime().Now().Unix(),
+	}
+
+	// The stats only contain the dynamic fields so get the
+	// artifacts from the stored collection.
+	storage := &FlowStorageManager{}
+	collection_context, err := storage.LoadCollectionContext(
+		ctx, config_obj, stats.ClientId, stats.SessionId)
+	if err == nil && collection_context.Request != nil {
+		record.Artifacts = collection_context.Request.Artifacts
+	}
+
+	flow_path_manager := paths.NewFlowPathManager(
+		stats.ClientId, stats.SessionId)
+	file_store_factory := file_store.GetFileStore(config_obj)
+	reader, err := result_sets.NewResultSetReader(
+		file_store_factory, flow_path_manager.UploadMetadata())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for row := range reader.Rows(ctx) {
+		// Skip the index files of sparse uploads.
+		upload_type, _ := row.GetString("Type")
+		if upload_type == "idx" {
+			continue
+		}
+
+		vfs_path, pres := row.GetString("vfs_path")
+		if !pres {
+			continue
+		}
+
+		size, _ := row.GetInt64("file_size")
+		record.Uploads = append(record.Uploads, &DarkDataUpload{
+			VFSPath: vfs_path,
+			Size:    size,
+		})
+	}
+
+	if len(record.Uploads) == 0 {
+		return nil
+	}
+
+	return SetDarkData(config_obj, record)
+}
+
+func GetDarkData(config_obj *config_proto.Config,
+	client_id, flow_id string) (*DarkData, error) {
+	raw_db, err := getRawDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := raw_db.GetBuffer(config_obj,
+		paths.DarkDataPath(client_id, flow_id))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.NotFoundError, flow_id)
+	}
+
+	record := &DarkData{}
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func SetDarkData(config_obj *config_proto.Config, record *DarkData) error {
+	raw_db, err := getRawDB(config_obj)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return raw_db.SetBuffer(config_obj,
+		paths.DarkDataPath(record.ClientId, record.FlowId),
+		data, utils.SyncCompleter)
+}
+
+// List the dark data of a client, or of all clients if client_id is
+// empty. Oldest first.
+func ListDarkData(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	client_id string) ([]*DarkData, error) {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	client_ids := []string{client_id}
+	if client_id == "" {
+		client_ids = nil
+		children, err := db.ListChildren(config_obj, paths.DARK_DATA_ROOT)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, child := range children {
+			if child.IsDir() {
+				client_ids = append(client_ids, child.Base())
+			}
+		}
+	}
+
+	result := []*DarkData{}
+	for _, client_id := range client_ids {
+		children, err := db.ListChildren(config_obj,
+			paths.DARK_DATA_ROOT.AddChild(client_id))
+		if err != nil {
+			continue
+		}
+
+		for _, child := range children {
+			if child.IsDir() {
+				continue
+			}
+
+			record, err := GetDarkData(config_obj, client_id, child.Base())
+			if err != nil {
+				continue
+			}
+			result = append(result, record)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created < result[j].Created
+	})
+
+	return result, nil
+}
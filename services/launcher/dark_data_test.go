@@ -0,0 +1,78 @@
+package launcher_test
+
+import (
+	"github.com/Velocidex/ordereddict"
+	"github.com/stretchr/testify/assert"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/file_store"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/result_sets"
+	"www.velocidex.com/golang/velociraptor/services/launcher"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+func (self *LauncherTestSuite) TestDarkData() {
+	client_id := "C.1234"
+	flow_id := "F.DarkData"
+
+	// The flow uploaded a file and a sparse index.
+	flow_path_manager := paths.NewFlowPathManager(client_id, flow_id)
+	rs_writer, err := result_sets.NewResultSetWriter(
+		file_store.GetFileStore(self.ConfigObj),
+		flow_path_manager.UploadMetadata(), json.DefaultEncOpts(),
+		utils.SyncCompleter, result_sets.TruncateMode)
+	assert.NoError(self.T(), err)
+
+	rs_writer.Write(ordereddict.NewDict().
+		Set("vfs_path", "/clients/C.1234/collections/F.DarkData/uploads/auto/C:/test.db").
+		Set("Type", "").
+		Set("file_size", 100))
+	rs_writer.Write(ordereddict.NewDict().
+		Set("vfs_path", "/clients/C.1234/collections/F.DarkData/uploads/auto/C:/test.db.idx").
+		Set("Type", "idx").
+		Set("file_size", 100))
+	rs_writer.Close()
+
+	stats := &flows_proto.ArtifactCollectorContext{
+		ClientId:           client_id,
+		SessionId:          flow_id,
+		TotalUploadedFiles: 1,
+		QueryStats: []*crypto_proto.VeloStatus{{
+			Status:        crypto_proto.VeloStatus_OK,
+			UploadedFiles: 1,
+			ResultRows:    10,
+		}},
+	}
+
+	// The query returned results so the upload was parsed.
+	err = launcher.RecordDarkData(self.Ctx, self.ConfigObj, stats)
+	assert.NoError(self.T(), err)
+
+	records, err := launcher.ListDarkData(self.Ctx, self.ConfigObj, "")
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 0, len(records))
+
+	// The parser failed.
+	stats.QueryStats[0].Status = crypto_proto.VeloStatus_GENERIC_ERROR
+	stats.QueryStats[0].ErrorMessage = "Not a sqlite file"
+
+	err = launcher.RecordDarkData(self.Ctx, self.ConfigObj, stats)
+	assert.NoError(self.T(), err)
+
+	records, err = launcher.ListDarkData(self.Ctx, self.ConfigObj, client_id)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 1, len(records))
+	assert.Equal(self.T(), flow_id, records[0].FlowId)
+	assert.Equal(self.T(), "Query failed: Not a sqlite file", records[0].Reason)
+
+	// The sparse index is not dark data.
+	assert.Equal(self.T(), 1, len(records[0].Uploads))
+	assert.Equal(self.T(), int64(100), records[0].Uploads[0].Size)
+
+	// Other clients have no dark data.
+	records, err = launcher.ListDarkData(self.Ctx, self.ConfigObj, "C.5678")
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 0, len(records))
+}
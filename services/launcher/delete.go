@@ -122,6 +122,12 @@ func (self *FlowStorageManager) DeleteFlow(
 	r.emit_ds("Task", flow_path_manager.Task())
 	r.emit_ds("Stats", flow_path_manager.Stats())
 
+	// Only report the dark data record if there is one.
+	_, err = GetDarkData(config_obj, client_id, flow_id)
+	if err == nil {
+		r.emit_ds("DarkData", paths.DarkDataPath(client_id, flow_id))
+	}
+
 	// Walk the flow's datastore and filestore
 	db, err := datastore.GetDB(config_obj)
 	if err != nil {
@@ -287,19 +293,28 @@ func (self *Launcher) DeleteEvents(
 			var error_message string
 
 			if really_do_it {
-				err := file_store_factory.Delete(f.Path)
+				// Older days may be in another storage tier.
+				tier_store := file_store_factory
+				if f.FileStore != nil {
+					tier_store = f.FileStore
+				}
+
+				err := tier_store.Delete(f.Path)
 				if err != nil {
 					error_message = fmt.Sprintf(
 						"Error deleting %v: %v",
 						f.Path.AsClientPath(), err)
 				}
 
-				path_spec := f.Path.SetType(api.PATH_TYPE_FILESTORE_JSON_TIME_INDEX)
-				err = file_store_factory.Delete(path_spec)
-				if err != nil {
-					error_message += fmt.Sprintf(
-						"Error deleting %v: %v",
-						path_spec.AsClientPath(), err)
+				// Column files have no time index.
+				if f.Path.Type() == api.PATH_TYPE_FILESTORE_JSON {
+					path_spec := f.Path.SetType(api.PATH_TYPE_FILESTORE_JSON_TIME_INDEX)
+					err = tier_store.Delete(path_spec)
+					if err != nil {
+						error_message += fmt.Sprintf(
+							"Error deleting %v: %v",
+							path_spec.AsClientPath(), err)
+					}
 				}
 			}
 
@@ -133,7 +133,8 @@ func (self *Launcher) CancelFlow(
 	collection_context, err := self.Storage().LoadCollectionContext(
 		ctx, config_obj, client_id, flow_id)
 	if err == nil {
-		if collection_context.State != flows_proto.ArtifactCollectorContext_RUNNING {
+		if collection_context.State != flows_proto.ArtifactCollectorContext_RUNNING &&
+			collection_context.State != flows_proto.ArtifactCollectorContext_ORPHANED {
 			return nil, errors.New("Flow is not in the running state. " +
 				"Can only cancel running flows.")
 		}
@@ -159,6 +160,10 @@ func (self *Launcher) CancelFlow(
 		return nil, err
 	}
 
+	// Do not deliver the flow again if it was already sent.
+	client_manager.ReleaseTaskLease(client_id, flow_id)
+	client_manager.FlowDone(client_id, flow_id)
+
 	// Cancel all the relevant tasks
 	for _, task := range tasks {
 		if task.SessionId == flow_id {
@@ -217,6 +222,8 @@ func UpdateFlowStats(collection_context *flows_proto.ArtifactCollectorContext) {
 	collection_context.TotalUploadedFiles = 0
 	collection_context.TotalCollectedRows = 0
 	collection_context.TotalLogs = 0
+	collection_context.ProgressTotal = 0
+	collection_context.ProgressDone = 0
 	collection_context.ActiveTime = 0
 	collection_context.StartTime = 0
 
@@ -250,6 +257,7 @@ func UpdateFlowStats(collection_context *flows_proto.ArtifactCollectorContext) {
 			collection_context.State = flows_proto.ArtifactCollectorContext_ERROR
 			collection_context.Status = s.ErrorMessage
 			collection_context.Backtrace = s.Backtrace
+			collection_context.ErrorClass = s.ErrorClass
 		}
 
 		// Query is considered complete if it is in the ERROR or OK state
@@ -258,6 +266,17 @@ func UpdateFlowStats(collection_context *flows_proto.ArtifactCollectorContext) {
 			completed_count++
 		}
 
+		// A completed query has processed all its items, even if
+		// its last progress report was before it finished.
+		if s.ProgressTotal > 0 {
+			collection_context.ProgressTotal += uint64(s.ProgressTotal)
+			if s.Status == crypto_proto.VeloStatus_OK {
+				collection_context.ProgressDone += uint64(s.ProgressTotal)
+			} else {
+				collection_context.ProgressDone += uint64(s.ProgressDone)
+			}
+		}
+
 		// Merge the NamesWithResponse for all the queries.
 		for _, a := range s.NamesWithResponse {
 			if a != "" &&
@@ -278,6 +297,27 @@ func UpdateFlowStats(collection_context *flows_proto.ArtifactCollectorContext) {
 		collection_context.State == flows_proto.ArtifactCollectorContext_RUNNING {
 		collection_context.State = flows_proto.ArtifactCollectorContext_FINISHED
 	}
+
+	updateFlowProgress(collection_context)
+}
+
+// Estimate the completion percentage and time of the collection from
+// the progress reported by its queries.
+func updateFlowProgress(collection_context *flows_proto.ArtifactCollectorContext) {
+	collection_context.ProgressPercent = 0
+	collection_context.EstimatedCompletionTime = 0
+
+	switch collection_context.State {
+	case flows_proto.ArtifactCollectorContext_FINISHED:
+		collection_context.ProgressPercent = 100
+		collection_context.EstimatedCompletionTime = collection_context.ActiveTime
+
+	case flows_proto.ArtifactCollectorContext_RUNNING:
+		collection_context.ProgressPercent,
+			collection_context.EstimatedCompletionTime = utils.EstimateProgress(
+			collection_context.ProgressDone, collection_context.ProgressTotal,
+			collection_context.StartTime, collection_context.ActiveTime)
+	}
 }
 
 func (self *Launcher) Storage() services.FlowStorer {
@@ -118,6 +118,7 @@ package launcher
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/go-errors/errors"
@@ -132,6 +133,7 @@ import (
 	"www.velocidex.com/golang/velociraptor/logging"
 	"www.velocidex.com/golang/velociraptor/services"
 	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/utils/tracing"
 	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
 )
 
@@ -555,6 +557,14 @@ func (self *Launcher) ScheduleArtifactCollection(
 			"ScheduleArtifactCollection can only be called on the master node")
 	}
 
+	// Artifacts requiring dual authorization need an approval
+	// granted by a second user.
+	approvals, err := claimApprovals(
+		ctx, config_obj, repository, collector_request)
+	if err != nil {
+		return "", err
+	}
+
 	args := collector_request.CompiledCollectorArgs
 	if args == nil {
 		// Compile and cache the compilation for next time
@@ -568,12 +578,13 @@ func (self *Launcher) ScheduleArtifactCollection(
 				ObfuscateNames: true,
 			}, collector_request)
 		if err != nil {
+			releaseApprovals(config_obj, approvals)
 			return "", err
 		}
 		args = append(args, compiled...)
 	}
 
-	return self.WriteArtifactCollectionRecord(
+	flow_id, err := self.WriteArtifactCollectionRecord(
 		ctx, config_obj, collector_request, args,
 		func(task *crypto_proto.VeloMessage) {
 			client_manager, err := services.GetClientInfoManager(config_obj)
@@ -586,6 +597,13 @@ func (self *Launcher) ScheduleArtifactCollection(
 				ctx, collector_request.ClientId, task,
 				services.NOTIFY_CLIENT, completion)
 		})
+	if err != nil {
+		releaseApprovals(config_obj, approvals)
+		return "", err
+	}
+
+	recordApprovals(config_obj, approvals, flow_id)
+	return flow_id, nil
 }
 
 func (self *Launcher) WriteArtifactCollectionRecord(
@@ -656,6 +674,21 @@ func (self *Launcher) WriteArtifactCollectionRecord(
 		task.Urgent = true
 	}
 
+	// Start a trace for the collection. The client echoes the
+	// traceparent back when the collection is done.
+	if tracing.Enabled() {
+		span := tracing.StartSpan("ScheduleArtifactCollection",
+			tracing.SpanContext{})
+		span.SetAttribute("client_id", client_id).
+			SetAttribute("flow_id", session_id).
+			SetAttribute("creator", collector_request.Creator).
+			SetAttribute("artifacts",
+				strings.Join(collector_request.Artifacts, ","))
+		defer span.Finish()
+
+		task.FlowRequest.TraceParent = span.TraceParent()
+	}
+
 	// Generate a new collection context for this flow.
 	collection_context := &flows_proto.ArtifactCollectorContext{
 		SessionId:           session_id,
@@ -665,6 +698,7 @@ func (self *Launcher) WriteArtifactCollectionRecord(
 		ClientId:            client_id,
 		TotalRequests:       int64(len(vql_collector_args)),
 		OutstandingRequests: int64(len(vql_collector_args)),
+		TraceParent:         task.FlowRequest.TraceParent,
 	}
 
 	// Record the tasks for provenance of what we actually did.
@@ -0,0 +1,366 @@
+/*
+  Linting checks custom artifacts for problems before they are
+  collected widely. Unlike the validation done when an artifact is
+  loaded, linting reports all the problems it finds:
+
+  - Queries which do not parse.
+  - Plugins or functions which are banned by the configuration.
+  - Calls to other artifacts which do not exist or pass parameters
+    the artifact does not declare.
+  - Plugins or functions requiring permissions which the artifact
+    does not list in its required_permissions. Client artifacts run
+    with full privileges on the endpoint so the required permissions
+    are the only thing stopping a user from gaining capabilities
+    (e.g. EXECVE) they do not have.
+
+  The checks are done on the text of the query so they are
+  approximate.
+*/
+
+package launcher
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	artifacts_proto "www.velocidex.com/golang/velociraptor/artifacts/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+const (
+	LINT_ERROR   = "error"
+	LINT_WARNING = "warning"
+)
+
+var (
+	string_literal_regex = regexp.MustCompile(
+		`(?s)'''.*?'''|'(?:\\.|[^'\\])*'|"(?:\\.|[^"\\])*"`)
+	call_regex          = regexp.MustCompile(`([.a-zA-Z0-9_]*[a-zA-Z_][a-zA-Z0-9_]*)\s*\(`)
+	let_regex           = regexp.MustCompile(`(?i)\bLET\s+([a-zA-Z_][a-zA-Z0-9_]*)`)
+	artifact_args_regex = regexp.MustCompile(`([a-zA-Z_][a-zA-Z0-9_]*)\s*=[^~=>]`)
+
+	// Keywords which may be followed by a bracket.
+	vql_keywords = []string{
+		"select", "from", "where", "and", "or", "not", "in", "let",
+		"as", "limit", "order", "by", "group", "explain",
+	}
+
+	// Collecting any client artifact implies these permissions.
+	client_permissions = []acls.ACL_PERMISSION{
+		acls.FILESYSTEM_READ, acls.MACHINE_STATE,
+	}
+
+	vql_info_mu sync.Mutex
+	vql_info    map[string]*vqlInfo
+)
+
+type LintResult struct {
+	Artifact string `json:"Artifact"`
+	Level    string `json:"Level"`
+	Message  string `json:"Message"`
+}
+
+type LintOptions struct {
+	// Plugins and functions the artifact may not use.
+	BannedPlugins []string
+}
+
+// Information about a plugin or function.
+type vqlInfo struct {
+	Type        string
+	Permissions []acls.ACL_PERMISSION
+}
+
+func HasLintErrors(results []*LintResult) bool {
+	for _, r := range results {
+		if r.Level == LINT_ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+func LintArtifact(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	repository services.Repository,
+	artifact *artifacts_proto.Artifact,
+	options LintOptions) []*LintResult {
+
+	var result []*LintResult
+	report := func(level, format string, args ...interface{}) {
+		result = append(result, &LintResult{
+			Artifact: artifact.Name,
+			Level:    level,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	queries := []string{artifact.Precondition, artifact.Export}
+	for _, source := range artifact.Sources {
+		queries = append(queries, source.Precondition, source.Query)
+	}
+
+	// Names of stored queries which may be called like plugins.
+	defined := make(map[string]bool)
+	var bodies []string
+
+	for _, query := range queries {
+		if query == "" {
+			continue
+		}
+
+		_, err := vfilter.MultiParse(query)
+		if err != nil {
+			report(LINT_ERROR, "Query does not parse: %v", err)
+			continue
+		}
+
+		body := string_literal_regex.ReplaceAllString(stripComments(query), "''")
+		for _, hit := range let_regex.FindAllStringSubmatch(body, -1) {
+			defined[hit[1]] = true
+		}
+		bodies = append(bodies, body)
+	}
+
+	// Stored queries may also come from imported artifacts.
+	for _, name := range artifact.Imports {
+		imported, pres := repository.Get(ctx, config_obj, name)
+		if !pres {
+			report(LINT_ERROR, "Imported artifact %v not found", name)
+			continue
+		}
+		for _, hit := range let_regex.FindAllStringSubmatch(
+			imported.Export, -1) {
+			defined[hit[1]] = true
+		}
+	}
+
+	declared := make(map[string]bool)
+	for _, p := range artifact.Parameters {
+		if p.Name == "" {
+			report(LINT_ERROR, "Parameter has no name")
+			continue
+		}
+		if declared[p.Name] {
+			report(LINT_WARNING, "Parameter %v is declared more than once", p.Name)
+		}
+		declared[p.Name] = true
+	}
+
+	required := make(map[acls.ACL_PERMISSION]bool)
+	for _, perm := range artifact.RequiredPermissions {
+		permission := acls.GetPermission(perm)
+		if permission == acls.NO_PERMISSIONS {
+			report(LINT_ERROR, "Unknown required permission %v", perm)
+			continue
+		}
+		required[permission] = true
+	}
+
+	is_client := true
+	switch strings.ToLower(artifact.Type) {
+	case "server", "server_event":
+		is_client = false
+	}
+
+	if is_client {
+		for _, perm := range client_permissions {
+			required[perm] = true
+		}
+	}
+
+	info := getVQLInfo()
+	seen := make(map[string]bool)
+
+	for _, body := range bodies {
+		for _, hit := range call_regex.FindAllStringSubmatchIndex(body, -1) {
+			name := body[hit[2]:hit[3]]
+
+			if strings.HasPrefix(name, "Artifact.") {
+				lintArtifactCall(ctx, config_obj, repository,
+					strings.TrimPrefix(name, "Artifact."),
+					body[hit[1]:], report)
+				continue
+			}
+
+			// Method calls or keywords.
+			if strings.Contains(name, ".") ||
+				utils.InString(vql_keywords, strings.ToLower(name)) ||
+				defined[name] || seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			if utils.InString(options.BannedPlugins, name) {
+				report(LINT_ERROR, "Use of %v is not allowed", name)
+				continue
+			}
+
+			item, pres := info[name]
+			if !pres {
+				report(LINT_WARNING,
+					"Unknown plugin or function %v (it may only be available on some platforms)",
+					name)
+				continue
+			}
+
+			if len(item.Permissions) == 0 {
+				continue
+			}
+
+			// Any one of the listed permissions is sufficient.
+			allowed := false
+			for _, perm := range item.Permissions {
+				if required[perm] {
+					allowed = true
+					break
+				}
+			}
+			if allowed {
+				continue
+			}
+
+			// Server artifacts run with the permissions of the user
+			// collecting them so the missing permission will be
+			// enforced anyway.
+			level := LINT_WARNING
+			if is_client {
+				level = LINT_ERROR
+			}
+			report(level, "%v %v requires %v which is not listed in required_permissions",
+				item.Type, name, item.Permissions[0])
+		}
+	}
+
+	// Parameters not referenced in any query are probably a mistake.
+	all := strings.Join(bodies, "\n")
+	for _, p := range artifact.Parameters {
+		if p.Name == "" {
+			continue
+		}
+		used, _ := regexp.MatchString(`\b`+regexp.QuoteMeta(p.Name)+`\b`, all)
+		if !used {
+			report(LINT_WARNING, "Parameter %v is not used", p.Name)
+		}
+	}
+
+	return result
+}
+
+// Check a call to another artifact. The rest of the query following
+// the opening bracket is given in args.
+func lintArtifactCall(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	repository services.Repository,
+	name, args string,
+	report func(level, format string, args ...interface{})) {
+
+	called, pres := repository.Get(ctx, config_obj, name)
+	if !pres {
+		report(LINT_ERROR, "Unknown artifact reference %v", name)
+		return
+	}
+
+	// Find the matching closing bracket.
+	depth := 1
+	for i, c := range args {
+		switch c {
+		case '(', '{', '[':
+			depth++
+		case ')', '}', ']':
+			depth--
+		}
+		if depth == 0 {
+			args = args[:i]
+			break
+		}
+	}
+
+	// Only consider top level arguments.
+	var top_level strings.Builder
+	depth = 0
+	for _, c := range args {
+		switch c {
+		case '(', '{', '[':
+			depth++
+		case ')', '}', ']':
+			depth--
+		default:
+			if depth == 0 {
+				top_level.WriteRune(c)
+			}
+		}
+	}
+
+	parameters := []string{"source", "preconditions"}
+	for _, p := range called.Parameters {
+		parameters = append(parameters, p.Name)
+	}
+
+	for _, hit := range artifact_args_regex.FindAllStringSubmatch(
+		top_level.String(), -1) {
+		if !utils.InString(parameters, hit[1]) {
+			report(LINT_ERROR, "Artifact %v has no parameter %v",
+				called.Name, hit[1])
+		}
+	}
+}
+
+func getVQLInfo() map[string]*vqlInfo {
+	vql_info_mu.Lock()
+	defer vql_info_mu.Unlock()
+
+	if vql_info != nil {
+		return vql_info
+	}
+
+	scope := vql_subsystem.MakeScope()
+	defer scope.Close()
+
+	vql_info = make(map[string]*vqlInfo)
+	info := scope.Describe(types.NewTypeMap())
+	for _, item := range info.Plugins {
+		vql_info[item.Name] = &vqlInfo{
+			Type:        "Plugin",
+			Permissions: getPermissions(item.Metadata),
+		}
+	}
+
+	for _, item := range info.Functions {
+		vql_info[item.Name] = &vqlInfo{
+			Type:        "Function",
+			Permissions: getPermissions(item.Metadata),
+		}
+	}
+
+	return vql_info
+}
+
+func getPermissions(metadata *ordereddict.Dict) []acls.ACL_PERMISSION {
+	var result []acls.ACL_PERMISSION
+	if metadata == nil {
+		return nil
+	}
+
+	perms, _ := metadata.Get("permissions")
+	perms_str, _ := perms.(string)
+	for _, perm := range strings.Split(perms_str, ",") {
+		permission := acls.GetPermission(strings.TrimSpace(perm))
+		if permission != acls.NO_PERMISSIONS {
+			result = append(result, permission)
+		}
+	}
+	return result
+}
@@ -0,0 +1,170 @@
+/*
+  Custom artifacts may be written by many users but hunts and group
+  tasks collect them across the entire fleet. When
+  defaults.require_artifact_review is set, a custom artifact must be
+  reviewed before it can be collected this way.
+
+  A review applies to the exact definition of the artifact so
+  changing the artifact requires a new review. Artifacts with lint
+  errors can not be reviewed.
+*/
+
+package launcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"www.velocidex.com/golang/velociraptor/acls"
+	artifacts_proto "www.velocidex.com/golang/velociraptor/artifacts/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+type ArtifactReview struct {
+	Artifact string `json:"Artifact"`
+
+	// The hash of the artifact definition which was reviewed.
+	Hash     string `json:"Hash"`
+	Reviewer string `json:"Reviewer"`
+	Reviewed int64  `json:"Reviewed"`
+	Comment  string `json:"Comment,omitempty"`
+}
+
+func ArtifactHash(artifact *artifacts_proto.Artifact) string {
+	hash := sha256.Sum256([]byte(artifact.Raw))
+	return hex.EncodeToString(hash[:])
+}
+
+// Only custom artifacts need to be reviewed.
+func needsReview(artifact *artifacts_proto.Artifact) bool {
+	return !artifact.BuiltIn && !artifact.CompiledIn
+}
+
+func ReviewArtifact(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	repository services.Repository,
+	principal, name, comment string) (*ArtifactReview, error) {
+
+	if principal == "" {
+		return nil, fmt.Errorf("ReviewArtifact: reviewer must be specified")
+	}
+
+	artifact, pres := repository.Get(ctx, config_obj, name)
+	if !pres {
+		return nil, fmt.Errorf("%w: Artifact %v", utils.NotFoundError, name)
+	}
+
+	if !needsReview(artifact) {
+		return nil, fmt.Errorf("Artifact %v is built in and does not need a review",
+			artifact.Name)
+	}
+
+	results := LintArtifact(ctx, config_obj, repository, artifact, LintOptions{
+		BannedPlugins: config_obj.Defaults.GetBannedArtifactPlugins(),
+	})
+	for _, r := range results {
+		if r.Level == LINT_ERROR {
+			return nil, fmt.Errorf("Artifact %v can not be reviewed: %v",
+				artifact.Name, r.Message)
+		}
+	}
+
+	review := &ArtifactReview{
+		Artifact: artifact.Name,
+		Hash:     ArtifactHash(artifact),
+		Reviewer: principal,
+		Reviewed: utils.GetTime().Now().Unix(),
+		Comment:  comment,
+	}
+
+	raw_db, err := getRawDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(review)
+	if err != nil {
+		return nil, err
+	}
+
+	err = raw_db.SetBuffer(config_obj, paths.ArtifactReviewPath(artifact.Name),
+		data, utils.SyncCompleter)
+	if err != nil {
+		return nil, err
+	}
+
+	return review, nil
+}
+
+func GetArtifactReview(
+	config_obj *config_proto.Config, name string) (*ArtifactReview, error) {
+	raw_db, err := getRawDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := raw_db.GetBuffer(config_obj, paths.ArtifactReviewPath(name))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.NotFoundError, name)
+	}
+
+	review := &ArtifactReview{}
+	err = json.Unmarshal(data, review)
+	if err != nil {
+		return nil, err
+	}
+
+	return review, nil
+}
+
+// Returns true if the current definition of the artifact was
+// reviewed.
+func IsArtifactReviewed(
+	config_obj *config_proto.Config, artifact *artifacts_proto.Artifact) bool {
+	if !needsReview(artifact) {
+		return true
+	}
+
+	review, err := GetArtifactReview(config_obj, artifact.Name)
+	return err == nil && review.Hash == ArtifactHash(artifact)
+}
+
+// Collections addressed to many clients (e.g. hunts and group
+// tasks) may only include reviewed artifacts. This includes any
+// artifacts they depend on.
+func RejectUnreviewedArtifacts(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	repository services.Repository,
+	collector_request *flows_proto.ArtifactCollectorArgs) error {
+	if !config_obj.Defaults.GetRequireArtifactReview() {
+		return nil
+	}
+
+	dependency := make(map[string]int)
+	for _, name := range collector_request.Artifacts {
+		err := GetQueryDependencies(ctx, config_obj, repository,
+			fmt.Sprintf("SELECT * FROM Artifact.%s()", name), 0, dependency)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name := range dependency {
+		artifact, pres := repository.Get(ctx, config_obj, name)
+		if pres && !IsArtifactReviewed(config_obj, artifact) {
+			return fmt.Errorf(
+				"%w: Artifact %v must be reviewed before it can be collected from many clients",
+				acls.PermissionDenied, artifact.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package launcher_test
+
+import (
+	"errors"
+
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/velociraptor/acls"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/services/launcher"
+)
+
+func (self *LauncherTestSuite) TestArtifactReview() {
+	manager, err := services.GetRepositoryManager(self.ConfigObj)
+	assert.NoError(self.T(), err)
+
+	repository, err := manager.GetGlobalRepository(self.ConfigObj)
+	assert.NoError(self.T(), err)
+
+	load := func(definition string) {
+		_, err := repository.LoadYaml(definition, services.ArtifactOptions{
+			ValidateArtifact:  true,
+			ArtifactIsBuiltIn: false})
+		assert.NoError(self.T(), err)
+	}
+
+	load(`
+name: Custom.Test.Format
+parameters:
+- name: Message
+- name: Unused
+sources:
+- query: |
+    SELECT format(format="%v", args=Message) AS Message FROM scope()
+`)
+
+	load(`
+name: Custom.Test.Kill
+sources:
+- name: Kill
+  query: |
+    LET Pids = SELECT 1 AS Pid FROM scope()
+    SELECT * FROM foreach(row=Pids, query={
+       SELECT pskill(pid=Pid), 'pskill(' AS Text FROM scope()
+    })
+- name: Call
+  query: |
+    SELECT * FROM Artifact.Custom.Test.Format(Message="Hi", Bogus=1)
+`)
+
+	lint := func(name string, options launcher.LintOptions) []string {
+		artifact, pres := repository.Get(self.Ctx, self.ConfigObj, name)
+		assert.True(self.T(), pres)
+
+		var result []string
+		for _, r := range launcher.LintArtifact(
+			self.Ctx, self.ConfigObj, repository, artifact, options) {
+			result = append(result, r.Level+": "+r.Message)
+		}
+		return result
+	}
+
+	assert.Equal(self.T(), []string{
+		"warning: Parameter Unused is not used",
+	}, lint("Custom.Test.Format", launcher.LintOptions{}))
+
+	assert.Equal(self.T(), []string{
+		"error: Function pskill requires EXECVE which is not listed in required_permissions",
+		"error: Artifact Custom.Test.Format has no parameter Bogus",
+	}, lint("Custom.Test.Kill", launcher.LintOptions{}))
+
+	assert.Equal(self.T(), []string{
+		"error: Use of format is not allowed",
+		"warning: Parameter Unused is not used",
+	}, lint("Custom.Test.Format", launcher.LintOptions{
+		BannedPlugins: []string{"format"},
+	}))
+
+	// Artifacts with lint errors can not be reviewed.
+	_, err = launcher.ReviewArtifact(self.Ctx, self.ConfigObj, repository,
+		"UserA", "Custom.Test.Kill", "")
+	assert.Error(self.T(), err)
+
+	// Reviews are only required when configured.
+	request := &flows_proto.ArtifactCollectorArgs{
+		Artifacts: []string{"Custom.Test.Format"},
+	}
+	err = launcher.RejectUnreviewedArtifacts(
+		self.Ctx, self.ConfigObj, repository, request)
+	assert.NoError(self.T(), err)
+
+	self.ConfigObj.Defaults.RequireArtifactReview = true
+	defer func() {
+		self.ConfigObj.Defaults.RequireArtifactReview = false
+	}()
+
+	err = launcher.RejectUnreviewedArtifacts(
+		self.Ctx, self.ConfigObj, repository, request)
+	assert.True(self.T(), errors.Is(err, acls.PermissionDenied))
+
+	review, err := launcher.ReviewArtifact(self.Ctx, self.ConfigObj,
+		repository, "UserA", "Custom.Test.Format", "Looks good")
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), "UserA", review.Reviewer)
+
+	err = launcher.RejectUnreviewedArtifacts(
+		self.Ctx, self.ConfigObj, repository, request)
+	assert.NoError(self.T(), err)
+
+	// Changing the artifact requires another review.
+	load(`
+name: Custom.Test.Format
+parameters:
+- name: Message
+sources:
+- query: |
+    SELECT format(format="%v!", args=Message) AS Message FROM scope()
+`)
+
+	err = launcher.RejectUnreviewedArtifacts(
+		self.Ctx, self.ConfigObj, repository, request)
+	assert.Error(self.T(), err)
+}
@@ -253,6 +253,13 @@ func (self *FlowStorageManager) LoadCollectionContext(
 		collection_context.QueryStats = stats_context.QueryStats
 	}
 
+	// Network usage is only reported by the client in the stats.
+	if stats_context.TotalNetworkBytesSent > 0 ||
+		stats_context.TotalNetworkBytesReceived > 0 {
+		collection_context.TotalNetworkBytesSent = stats_context.TotalNetworkBytesSent
+		collection_context.TotalNetworkBytesReceived = stats_context.TotalNetworkBytesReceived
+	}
+
 	UpdateFlowStats(collection_context)
 	return collection_context, nil
 }
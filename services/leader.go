@@ -0,0 +1,46 @@
+package services
+
+import (
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+)
+
+// Several master nodes may share the same datastore for high
+// availability. In that case only one of them (the leader) should
+// run background schedulers like hunt expiry, otherwise these will
+// run multiple times. The leader is elected using a lease stored in
+// the datastore.
+type LeaderElection interface {
+	// Are we currently holding the lease?
+	IsLeader() bool
+
+	// The name of the node currently holding the lease.
+	Leader() string
+}
+
+var (
+	global_leader_election LeaderElection
+)
+
+func RegisterLeaderElection(election LeaderElection) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	global_leader_election = election
+}
+
+// Should this node run background schedulers? When leader election
+// is not configured all master nodes are leaders.
+func IsLeader(config_obj *config_proto.Config) bool {
+	if !IsMaster(config_obj) {
+		return false
+	}
+
+	mu.Lock()
+	election := global_leader_election
+	mu.Unlock()
+
+	if election == nil {
+		return true
+	}
+	return election.IsLeader()
+}
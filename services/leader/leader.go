@@ -0,0 +1,227 @@
+/*
+  Elects a leader among several master nodes sharing the same
+  datastore.
+
+  Each node periodically tries to acquire or renew a lease stored in
+  the file store. The lease names the node holding it and the time it
+  expires. A node may take the lease when it is free, expired or
+  already held by itself. If the leader dies, it stops renewing the
+  lease and another node takes over when the lease expires.
+
+  The file store does not support an atomic compare and swap, so
+  after writing the lease we read it back to detect another node
+  writing at the same time. The last writer wins and the other node
+  will notice on the next read back.
+*/
+
+package leader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/file_store"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+type Lease struct {
+	Node    string `json:"node"`
+	Expires int64  `json:"expires"`
+}
+
+type LeaderElection struct {
+	mu sync.Mutex
+
+	config_obj *config_proto.Config
+	node       string
+	ttl        time.Duration
+
+	is_leader bool
+	leader    string
+}
+
+func NewLeaderElection(
+	config_obj *config_proto.Config, ttl time.Duration) *LeaderElection {
+	return &LeaderElection{
+		config_obj: config_obj,
+		node: fmt.Sprintf("%v-%v",
+			services.GetNodeName(config_obj.Frontend), utils.GetGUID()),
+		ttl: ttl,
+	}
+}
+
+func (self *LeaderElection) IsLeader() bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.is_leader
+}
+
+func (self *LeaderElection) Leader() string {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.leader
+}
+
+// Try to acquire or renew the lease.
+func (self *LeaderElection) Update(ctx context.Context) error {
+	now := utils.GetTime().Now()
+
+	lease, err := self.readLease()
+	if err == nil && lease.Node != self.node &&
+		lease.Expires > now.UnixNano() {
+		self.setLeader(lease.Node)
+		return nil
+	}
+
+	err = self.writeLease(&Lease{
+		Node:    self.node,
+		Expires: now.Add(self.ttl).UnixNano(),
+	})
+	if err != nil {
+		self.setLeader("")
+		return err
+	}
+
+	// Make sure no one else wrote the lease at the same time.
+	lease, err = self.readLease()
+	if err != nil {
+		self.setLeader("")
+		return err
+	}
+
+	self.setLeader(lease.Node)
+	return nil
+}
+
+// Give up the lease if we hold it so another node can take over
+// immediately.
+func (self *LeaderElection) Release() error {
+	if !self.IsLeader() {
+		return nil
+	}
+
+	self.setLeader("")
+	return self.writeLease(&Lease{})
+}
+
+func (self *LeaderElection) setLeader(leader string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	is_leader := leader == self.node
+	if is_leader != self.is_leader {
+		logger := logging.GetLogger(self.config_obj, &logging.FrontendComponent)
+		if is_leader {
+			logger.Info("<green>LeaderElection</>: %v is now the leader", self.node)
+		} else {
+			logger.Info("<red>LeaderElection</>: %v is no longer the leader", self.node)
+		}
+	}
+
+	self.is_leader = is_leader
+	self.leader = leader
+}
+
+func (self *LeaderElection) readLease() (*Lease, error) {
+	file_store_factory := file_store.GetFileStore(self.config_obj)
+	fd, err := file_store_factory.ReadFile(paths.LEADER_LEASE)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	data, err := ioutil.ReadAll(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	lease := &Lease{}
+	err = json.Unmarshal(data, lease)
+	return lease, err
+}
+
+func (self *LeaderElection) writeLease(lease *Lease) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+
+	file_store_factory := file_store.GetFileStore(self.config_obj)
+	fd, err := file_store_factory.WriteFileWithCompletion(
+		paths.LEADER_LEASE, utils.SyncCompleter)
+	if err != nil {
+		return err
+	}
+
+	err = fd.Truncate()
+	if err != nil {
+		fd.Close()
+		return err
+	}
+
+	_, err = fd.Write(data)
+	if err != nil {
+		fd.Close()
+		return err
+	}
+
+	return fd.Close()
+}
+
+func StartLeaderElection(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	config_obj *config_proto.Config) error {
+
+	if config_obj.Defaults == nil ||
+		config_obj.Defaults.LeaderLeaseSec <= 0 ||
+		!services.IsMaster(config_obj) {
+		return nil
+	}
+
+	ttl := time.Duration(config_obj.Defaults.LeaderLeaseSec) * time.Second
+	election := NewLeaderElection(config_obj, ttl)
+
+	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+	logger.Info("<green>Starting</> Leader Election as %v with lease %v",
+		election.node, ttl)
+
+	err := election.Update(ctx)
+	if err != nil {
+		logger.Error("LeaderElection: %v", err)
+	}
+
+	services.RegisterLeaderElection(election)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer election.Release()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+				// Renew well before the lease expires.
+			case <-time.After(utils.Jitter(ttl / 3)):
+				err := election.Update(ctx)
+				if err != nil {
+					logger.Error("LeaderElection: %v", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package leader_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"www.velocidex.com/golang/velociraptor/file_store/test_utils"
+	"www.velocidex.com/golang/velociraptor/services/leader"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+type LeaderTestSuite struct {
+	test_utils.TestSuite
+}
+
+func (self *LeaderTestSuite) TestLeaderElection() {
+	clock := utils.NewMockClock(time.Unix(1700000000, 0))
+	closer := utils.MockTime(clock)
+	defer closer()
+
+	ttl := 30 * time.Second
+	node1 := leader.NewLeaderElection(self.ConfigObj, ttl)
+	node2 := leader.NewLeaderElection(self.ConfigObj, ttl)
+
+	// The first node takes the lease.
+	assert.NoError(self.T(), node1.Update(self.Ctx))
+	assert.NoError(self.T(), node2.Update(self.Ctx))
+
+	assert.True(self.T(), node1.IsLeader())
+	assert.True(self.T(), !node2.IsLeader())
+	assert.Equal(self.T(), node1.Leader(), node2.Leader())
+
+	// Renewing the lease keeps node1 the leader.
+	clock.Set(time.Unix(1700000020, 0))
+	assert.NoError(self.T(), node1.Update(self.Ctx))
+	assert.NoError(self.T(), node2.Update(self.Ctx))
+	assert.True(self.T(), node1.IsLeader())
+	assert.True(self.T(), !node2.IsLeader())
+
+	// node1 stops renewing - node2 takes over when the lease expires.
+	clock.Set(time.Unix(1700000060, 0))
+	assert.NoError(self.T(), node2.Update(self.Ctx))
+	assert.True(self.T(), node2.IsLeader())
+
+	assert.NoError(self.T(), node1.Update(self.Ctx))
+	assert.True(self.T(), !node1.IsLeader())
+
+	// Releasing the lease allows node1 to take over immediately.
+	assert.NoError(self.T(), node2.Release())
+	assert.NoError(self.T(), node1.Update(self.Ctx))
+	assert.True(self.T(), node1.IsLeader())
+}
+
+func TestLeaderElection(t *testing.T) {
+	suite.Run(t, &LeaderTestSuite{})
+}
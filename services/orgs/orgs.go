@@ -205,6 +205,12 @@ func (self *OrgManager) makeNewConfigObj(
 			result.Datastore.Location, "orgs", record.Id)
 		result.Datastore.FilestoreDirectory = filepath.Join(
 			result.Datastore.FilestoreDirectory, "orgs", record.Id)
+
+		if result.Datastore.Retention != nil &&
+			result.Datastore.Retention.ColdDirectory != "" {
+			result.Datastore.Retention.ColdDirectory = filepath.Join(
+				result.Datastore.Retention.ColdDirectory, "orgs", record.Id)
+		}
 	}
 
 	return result
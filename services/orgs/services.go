@@ -17,8 +17,10 @@ import (
 	"www.velocidex.com/golang/velociraptor/services/broadcast"
 	"www.velocidex.com/golang/velociraptor/services/client_info"
 	"www.velocidex.com/golang/velociraptor/services/client_monitoring"
+	"www.velocidex.com/golang/velociraptor/services/collection_hooks"
 	"www.velocidex.com/golang/velociraptor/services/ddclient"
 	"www.velocidex.com/golang/velociraptor/services/frontend"
+	"www.velocidex.com/golang/velociraptor/services/hash_inventory"
 	"www.velocidex.com/golang/velociraptor/services/hunt_dispatcher"
 	"www.velocidex.com/golang/velociraptor/services/hunt_manager"
 	"www.velocidex.com/golang/velociraptor/services/indexing"
@@ -27,9 +29,11 @@ import (
 	"www.velocidex.com/golang/velociraptor/services/journal"
 	"www.velocidex.com/golang/velociraptor/services/labels"
 	"www.velocidex.com/golang/velociraptor/services/launcher"
+	"www.velocidex.com/golang/velociraptor/services/leader"
 	"www.velocidex.com/golang/velociraptor/services/notebook"
 	"www.velocidex.com/golang/velociraptor/services/notifications"
 	"www.velocidex.com/golang/velociraptor/services/repository"
+	"www.velocidex.com/golang/velociraptor/services/retention"
 	"www.velocidex.com/golang/velociraptor/services/sanity"
 	"www.velocidex.com/golang/velociraptor/services/scheduler"
 	"www.velocidex.com/golang/velociraptor/services/secrets"
@@ -360,6 +364,13 @@ func (self *OrgManager) startRootOrgServices(
 		}
 	}
 
+	// Start leader election before any of the schedulers that
+	// depend on it.
+	err = leader.StartLeaderElection(ctx, wg, org_config)
+	if err != nil {
+		return err
+	}
+
 	err = ddclient.StartDynDNSService(
 		ctx, wg, org_config)
 	if err != nil {
@@ -663,6 +674,31 @@ func (self *OrgManager) startOrgFromContext(org_ctx *OrgContext) (err error) {
 		service_container.mu.Unlock()
 	}
 
+	// Collection hooks run with the server artifacts on the master
+	// node.
+	if spec.ServerArtifacts {
+		err = collection_hooks.NewCollectionHookService(ctx, wg, org_config)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Index the hash inventories sent by clients.
+	if spec.ServerArtifacts {
+		err = hash_inventory.NewHashInventoryService(ctx, wg, org_config)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Move older event results to the warm and cold storage tiers.
+	if spec.ServerArtifacts {
+		err = retention.NewRetentionService(ctx, wg, org_config)
+		if err != nil {
+			return err
+		}
+	}
+
 	if spec.ClientMonitoring {
 		client_event_manager, err := client_monitoring.NewClientMonitoringService(ctx, wg, org_config)
 		if err != nil {
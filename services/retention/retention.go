@@ -0,0 +1,243 @@
+/*
+  The retention service moves older event artifact results through
+  storage tiers.
+
+  Event artifacts are written to a JSON file for each day (the hot
+  tier). Once a day is older than Datastore.retention.hot_days it is
+  compacted into a compressed column file in the file store (the
+  warm tier). Once it is older than cold_days the column file is
+  moved to the cold_directory (the cold tier).
+
+  Each step writes the new copy completely before removing the old
+  one, so a crash at any point leaves the day readable from at least
+  one tier. Readers prefer the more recent tier when a day is found
+  in two tiers.
+*/
+
+package retention
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/file_store"
+	"www.velocidex.com/golang/velociraptor/file_store/api"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/paths/artifacts"
+	"www.velocidex.com/golang/velociraptor/result_sets/timed"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+type RetentionService struct {
+	config_obj *config_proto.Config
+}
+
+// Move all the days which are due to the next tier.
+func (self *RetentionService) Compact(ctx context.Context) error {
+	retention := self.config_obj.Datastore.GetRetention()
+	now := utils.GetTime().Now()
+
+	// A day is only moved once all of it is older than the cutoff.
+	warm_cutoff := now.Add(-time.Duration(retention.GetHotDays()) * 24 * time.Hour)
+	cold_cutoff := now.Add(-time.Duration(retention.GetColdDays()) * 24 * time.Hour)
+
+	file_store_factory := file_store.GetFileStore(self.config_obj)
+	cold_store := file_store.GetColdFileStore(self.config_obj)
+
+	logger := logging.GetLogger(self.config_obj, &logging.FrontendComponent)
+
+	process := func(urn api.FSPathSpec, info os.FileInfo) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		day := artifacts.DayNameToTimestamp(urn.Base())
+		if day.IsZero() {
+			return nil
+		}
+		day_end := day.Add(24 * time.Hour)
+
+		switch urn.Type() {
+		case api.PATH_TYPE_FILESTORE_JSON:
+			if day_end.After(warm_cutoff) {
+				return nil
+			}
+
+			err := self.compact(ctx, file_store_factory, urn)
+			if err != nil {
+				logger.Error("RetentionService: Compacting %v: %v",
+					urn.AsClientPath(), err)
+				return nil
+			}
+
+			// The day may also be due for the cold tier.
+			urn = urn.SetType(api.PATH_TYPE_FILESTORE_COLUMNS)
+			fallthrough
+
+		case api.PATH_TYPE_FILESTORE_COLUMNS:
+			if cold_store == nil || retention.GetColdDays() == 0 ||
+				day_end.After(cold_cutoff) {
+				return nil
+			}
+
+			err := self.moveToCold(file_store_factory, cold_store, urn)
+			if err != nil {
+				logger.Error("RetentionService: Moving %v to cold storage: %v",
+					urn.AsClientPath(), err)
+			}
+		}
+
+		return nil
+	}
+
+	err := api.Walk(file_store_factory, paths.SERVER_MONITORING_ROOT, process)
+	if err != nil {
+		return err
+	}
+
+	// Only walk the clients' monitoring directories - the rest of
+	// the client's directory holds collections and uploads.
+	clients_root := paths.CLIENTS_ROOT.AsFilestorePath()
+	children, err := file_store_factory.ListDirectory(clients_root)
+	if err != nil {
+		return nil
+	}
+
+	for _, child := range children {
+		if !child.IsDir() {
+			continue
+		}
+
+		err = api.Walk(file_store_factory,
+			child.PathSpec().AddChild("monitoring"), process)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (self *RetentionService) compact(
+	ctx context.Context, file_store_factory api.FileStore,
+	urn api.FSPathSpec) error {
+	err := timed.CompactToColumns(ctx, file_store_factory, urn,
+		file_store_factory, urn.SetType(api.PATH_TYPE_FILESTORE_COLUMNS))
+	if err != nil {
+		return err
+	}
+
+	err = file_store_factory.Delete(urn)
+	if err != nil {
+		return err
+	}
+
+	// Old files may not have a time index.
+	err = file_store_factory.Delete(
+		urn.SetType(api.PATH_TYPE_FILESTORE_JSON_TIME_INDEX))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (self *RetentionService) moveToCold(
+	file_store_factory, cold_store api.FileStore, urn api.FSPathSpec) error {
+	err := copyFile(file_store_factory, cold_store, urn)
+	if err != nil {
+		return err
+	}
+
+	return file_store_factory.Delete(urn)
+}
+
+// Copy to a temporary file first so readers never see a partial
+// file in the cold tier.
+func copyFile(src_store, dest_store api.FileStore, urn api.FSPathSpec) error {
+	reader, err := src_store.ReadFile(urn)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	tmp_path := urn.SetType(api.PATH_TYPE_FILESTORE_TMP)
+	writer, err := dest_store.WriteFile(tmp_path)
+	if err != nil {
+		return err
+	}
+
+	err = writer.Truncate()
+	if err == nil {
+		_, err = io.Copy(writer, reader)
+	}
+
+	// Close flushes the file so must happen before the move.
+	close_err := writer.Close()
+	if err != nil {
+		return err
+	}
+	if close_err != nil {
+		return close_err
+	}
+
+	return dest_store.Move(tmp_path, urn)
+}
+
+func NewRetentionService(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	config_obj *config_proto.Config) error {
+
+	result := &RetentionService{config_obj: config_obj}
+
+	retention := config_obj.Datastore.GetRetention()
+	if retention.GetHotDays() == 0 {
+		return nil
+	}
+
+	delay := time.Hour
+	if retention.CompactionPeriodSec > 0 {
+		delay = time.Duration(retention.CompactionPeriodSec) * time.Second
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+	logger.Info("<green>Starting</> Retention Service for %v every %v",
+		services.GetOrgName(config_obj), delay)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		last_run := time.Time{}
+
+		for {
+			// The mocked clock in tests does not wait in After()
+			// so avoid compacting too quickly.
+			if utils.GetTime().Now().Sub(last_run) < time.Second {
+				utils.SleepWithCtx(ctx, time.Minute)
+			} else {
+				err := result.Compact(ctx)
+				if err != nil {
+					logger.Error("RetentionService: %v", err)
+				}
+				last_run = utils.GetTime().Now()
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-utils.GetTime().After(utils.Jitter(delay)):
+			}
+		}
+	}()
+
+	return nil
+}
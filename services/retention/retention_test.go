@@ -0,0 +1,127 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/file_store"
+	"www.velocidex.com/golang/velociraptor/file_store/api"
+	"www.velocidex.com/golang/velociraptor/file_store/test_utils"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/paths/artifacts"
+	"www.velocidex.com/golang/velociraptor/result_sets"
+	"www.velocidex.com/golang/velociraptor/result_sets/timed"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+type RetentionTestSuite struct {
+	test_utils.TestSuite
+}
+
+func (self *RetentionTestSuite) SetupTest() {
+	self.ConfigObj = self.LoadConfig()
+	self.LoadArtifactsIntoConfig([]string{`
+name: Windows.Events.ProcessCreation
+type: CLIENT_EVENT
+`})
+	self.TestSuite.SetupTest()
+}
+
+func (self *RetentionTestSuite) readAll(
+	path_manager api.PathManager) string {
+	file_store_factory := file_store.GetFileStore(self.ConfigObj)
+	rs_reader, err := result_sets.NewTimedResultSetReader(
+		self.Ctx, file_store_factory, path_manager)
+	assert.NoError(self.T(), err)
+	defer rs_reader.Close()
+
+	rows := []*ordereddict.Dict{}
+	for row := range rs_reader.Rows(self.Ctx) {
+		rows = append(rows, row)
+	}
+	return string(json.MustMarshalIndent(rows))
+}
+
+func (self *RetentionTestSuite) TestTiers() {
+	clock := utils.NewMockClock(time.Unix(1587800000, 0))
+	closer := utils.MockTime(clock)
+	defer closer()
+
+	path_manager, err := artifacts.NewArtifactPathManager(
+		self.Ctx, self.ConfigObj, "C.12312", "",
+		"Windows.Events.ProcessCreation")
+	assert.NoError(self.T(), err)
+
+	file_store_factory := file_store.GetFileStore(self.ConfigObj)
+	writer, err := timed.NewTimedResultSetWriter(
+		file_store_factory, path_manager, nil, utils.SyncCompleter)
+	assert.NoError(self.T(), err)
+
+	// Write events over 6 days (2020-04-25 to 2020-04-30).
+	for i := int64(0); i < 50; i++ {
+		now := 1587800000 + 10000*i
+		clock.Set(time.Unix(now, 0).UTC())
+
+		writer.Write(ordereddict.NewDict().
+			Set("Now", now).
+			Set("Even", i%2 == 0))
+		writer.Flush()
+	}
+	writer.Close()
+
+	before := self.readAll(path_manager)
+
+	self.ConfigObj.Datastore.Retention = &config_proto.ResultRetentionConfig{
+		HotDays:       1,
+		ColdDays:      3,
+		ColdDirectory: self.T().TempDir(),
+	}
+
+	service := &RetentionService{config_obj: self.ConfigObj}
+	err = service.Compact(self.Ctx)
+	assert.NoError(self.T(), err)
+
+	// Each tier holds some of the days.
+	tiers := make(map[string]string)
+	list := func(fs api.FileStore, tier string) {
+		dir_name := path_manager.Path().Dir()
+		children, err := fs.ListDirectory(dir_name)
+		assert.NoError(self.T(), err)
+		for _, child := range children {
+			path_spec := child.PathSpec()
+			if path_spec.Type() == api.PATH_TYPE_FILESTORE_JSON ||
+				path_spec.Type() == api.PATH_TYPE_FILESTORE_COLUMNS {
+				tiers[path_spec.Base()+
+					api.GetExtensionForFilestore(path_spec)] = tier
+			}
+		}
+	}
+
+	list(file_store_factory, "hot/warm")
+	list(file_store.GetColdFileStore(self.ConfigObj), "cold")
+
+	assert.Equal(self.T(), map[string]string{
+		"2020-04-25.colz": "cold",
+		"2020-04-26.colz": "cold",
+		"2020-04-27.colz": "hot/warm",
+		"2020-04-28.colz": "hot/warm",
+		"2020-04-29.json": "hot/warm",
+		"2020-04-30.json": "hot/warm",
+	}, tiers)
+
+	// Queries see the same rows across the tiers.
+	assert.Equal(self.T(), before, self.readAll(path_manager))
+
+	// Compacting again is a no-op.
+	err = service.Compact(self.Ctx)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), before, self.readAll(path_manager))
+}
+
+func TestRetentionService(t *testing.T) {
+	suite.Run(t, &RetentionTestSuite{})
+}
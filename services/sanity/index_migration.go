@@ -12,7 +12,7 @@ import (
 )
 
 func maybeMigrateClientIndex(
-	ctx context.Context, config_obj *config_proto.Config) error {
+	ctx context.Context, config_obj *config_proto.Config, dry_run bool) error {
 
 	db, err := datastore.GetDB(config_obj)
 	if err != nil {
@@ -48,8 +48,45 @@ func maybeMigrateClientIndex(
 			if count%500 == 0 {
 				logger.Info("Converted %v index items to the new format", count)
 			}
+			if dry_run {
+				return nil
+			}
 			return indexer.SetIndex(client_id, term)
 		})
 
+	if dry_run {
+		logger.Info("Would convert %v index items to the new format", count)
+	}
+
+	return err
+}
+
+// The legacy index is not removed by the migration so rolling back
+// only needs to remove the new index.
+func rollbackClientIndex(
+	ctx context.Context, config_obj *config_proto.Config, dry_run bool) error {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return err
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+
+	count := 0
+	err = datastore.Walk(config_obj, db, paths.CLIENT_INDEX_URN,
+		datastore.WalkWithoutDirectories,
+		func(path api.DSPathSpec) error {
+			count++
+			if dry_run {
+				return nil
+			}
+			return db.DeleteSubject(config_obj, path)
+		})
+
+	if dry_run {
+		logger.Info("Would remove %v items from the client index", count)
+	} else {
+		logger.Info("Removed %v items from the client index", count)
+	}
 	return err
 }
@@ -0,0 +1,180 @@
+package sanity
+
+import (
+	"context"
+	"fmt"
+
+	api_proto "www.velocidex.com/golang/velociraptor/api/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/datastore"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/paths"
+)
+
+// A migration transforms the datastore from one schema version to
+// the next. Migrations must be idempotent since they may be
+// interrupted and run again. When dry_run is set the migration
+// should only report what it would change.
+type Migration struct {
+	// The schema version after this migration is applied.
+	Version     int64
+	Description string
+
+	Upgrade func(ctx context.Context,
+		config_obj *config_proto.Config, dry_run bool) error
+
+	// Undo the migration. May be nil if the migration can not be
+	// rolled back.
+	Rollback func(ctx context.Context,
+		config_obj *config_proto.Config, dry_run bool) error
+}
+
+// Migrations in order of their versions. New migrations must be
+// appended with the next version.
+var migrations = []Migration{{
+	Version:     1,
+	Description: "Convert the legacy client index to the new format",
+	Upgrade:     maybeMigrateClientIndex,
+	Rollback:    rollbackClientIndex,
+}}
+
+// The schema version this binary expects.
+func CurrentSchemaVersion() int64 {
+	return migrations[len(migrations)-1].Version
+}
+
+func GetMigrations() []Migration {
+	return migrations
+}
+
+func GetSchemaVersion(config_obj *config_proto.Config) (int64, error) {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return 0, err
+	}
+
+	// If the state is not there the version is 0
+	state := &api_proto.ServerState{}
+	state_path_manager := &paths.ServerStatePathManager{}
+	_ = db.GetSubject(config_obj, state_path_manager.Path(), state)
+	return state.SchemaVersion, nil
+}
+
+func setSchemaVersion(config_obj *config_proto.Config, version int64) error {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return err
+	}
+
+	state := &api_proto.ServerState{}
+	state_path_manager := &paths.ServerStatePathManager{}
+	_ = db.GetSubject(config_obj, state_path_manager.Path(), state)
+	state.SchemaVersion = version
+	return db.SetSubject(config_obj, state_path_manager.Path(), state)
+}
+
+// Apply all migrations newer than the stored schema version. The
+// schema version is recorded after each migration so an interrupted
+// upgrade resumes where it stopped. If a migration fails it is
+// rolled back.
+func RunMigrations(ctx context.Context,
+	config_obj *config_proto.Config, dry_run bool) ([]Migration, error) {
+	current, err := GetSchemaVersion(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if current > CurrentSchemaVersion() {
+		return nil, fmt.Errorf(
+			"Datastore schema version %v is newer than this release supports (%v). Use a newer release or roll back the schema first.",
+			current, CurrentSchemaVersion())
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+
+	var applied []Migration
+	for _, migration := range migrations {
+		if migration.Version <= current {
+			continue
+		}
+
+		logger.Info("Applying datastore migration %v: %v",
+			migration.Version, migration.Description)
+
+		err := migration.Upgrade(ctx, config_obj, dry_run)
+		if err != nil {
+			if migration.Rollback != nil && !dry_run {
+				rb_err := migration.Rollback(ctx, config_obj, false)
+				if rb_err != nil {
+					logger.Error("Unable to roll back migration %v: %v",
+						migration.Version, rb_err)
+				}
+			}
+			return applied, fmt.Errorf("Migration %v failed: %w",
+				migration.Version, err)
+		}
+
+		applied = append(applied, migration)
+		if dry_run {
+			continue
+		}
+
+		err = setSchemaVersion(config_obj, migration.Version)
+		if err != nil {
+			return applied, err
+		}
+	}
+
+	return applied, nil
+}
+
+// Roll back migrations newer than version, newest first.
+func RollbackMigrations(ctx context.Context,
+	config_obj *config_proto.Config,
+	version int64, dry_run bool) ([]Migration, error) {
+	current, err := GetSchemaVersion(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+
+	var rolled_back []Migration
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version <= version || migration.Version > current {
+			continue
+		}
+
+		if migration.Rollback == nil {
+			return rolled_back, fmt.Errorf(
+				"Migration %v can not be rolled back", migration.Version)
+		}
+
+		logger.Info("Rolling back datastore migration %v: %v",
+			migration.Version, migration.Description)
+
+		err := migration.Rollback(ctx, config_obj, dry_run)
+		if err != nil {
+			return rolled_back, fmt.Errorf("Rollback of migration %v failed: %w",
+				migration.Version, err)
+		}
+
+		rolled_back = append(rolled_back, migration)
+		if dry_run {
+			continue
+		}
+
+		previous := int64(0)
+		if i > 0 {
+			previous = migrations[i-1].Version
+		}
+
+		err = setSchemaVersion(config_obj, previous)
+		if err != nil {
+			return rolled_back, err
+		}
+	}
+
+	return rolled_back, nil
+}
@@ -134,7 +134,8 @@ func (self *SanityChecks) Check(
 		return err
 	}
 
-	err = maybeMigrateClientIndex(ctx, config_obj)
+	// Bring the datastore schema up to date.
+	_, err = RunMigrations(ctx, config_obj, false)
 	if err != nil {
 		return err
 	}
@@ -224,6 +224,44 @@ func (self *ServicesTestSuite) TestCreateUserInOrgs() {
 	goldie.Assert(self.T(), "TestCreateUserInOrgs", serialized)
 }
 
+// Check that datastore migrations are versioned and can be rolled back.
+func (self *ServicesTestSuite) TestMigrations() {
+	version, err := sanity.GetSchemaVersion(self.ConfigObj)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), int64(0), version)
+
+	// A dry run does not change the schema version.
+	applied, err := sanity.RunMigrations(self.Ctx, self.ConfigObj, true)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), len(sanity.GetMigrations()), len(applied))
+
+	version, err = sanity.GetSchemaVersion(self.ConfigObj)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), int64(0), version)
+
+	applied, err = sanity.RunMigrations(self.Ctx, self.ConfigObj, false)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), len(sanity.GetMigrations()), len(applied))
+
+	version, err = sanity.GetSchemaVersion(self.ConfigObj)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), sanity.CurrentSchemaVersion(), version)
+
+	// Migrations are only applied once.
+	applied, err = sanity.RunMigrations(self.Ctx, self.ConfigObj, false)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 0, len(applied))
+
+	rolled_back, err := sanity.RollbackMigrations(
+		self.Ctx, self.ConfigObj, 0, false)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), len(sanity.GetMigrations()), len(rolled_back))
+
+	version, err = sanity.GetSchemaVersion(self.ConfigObj)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), int64(0), version)
+}
+
 func TestSanityService(t *testing.T) {
 	suite.Run(t, &ServicesTestSuite{})
 }
@@ -24,6 +24,7 @@ import (
 	"www.velocidex.com/golang/velociraptor/services"
 	"www.velocidex.com/golang/velociraptor/services/launcher"
 	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/utils/tracing"
 	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
 	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
 	"www.velocidex.com/golang/vfilter"
@@ -314,6 +315,9 @@ func (self *contextManager) maybeSendCompletionMessage(ctx context.Context) {
 	}
 	journal.PushRowsToArtifactAsync(ctx, self.config_obj,
 		row, "System.Flow.Completion")
+
+	tracing.ExportCollection(flow_context.TraceParent, "server",
+		self.session_id, flow_context.QueryStats)
 }
 
 func (self *contextManager) RunQuery(
@@ -0,0 +1,299 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/datastore"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+// API keys allow automation to authenticate to the REST API as a
+// user without going through the interactive login flow. The key is
+// presented as a bearer token:
+//
+// Authorization: Bearer vrk_<id>_<secret>
+//
+// Only the hash of the secret is stored on the server so the key
+// can not be recovered after it was created.
+const API_KEY_PREFIX = "vrk_"
+
+var (
+	InvalidApiKeyError = errors.New("Invalid API key")
+	ExpiredApiKeyError = errors.New("API key expired")
+	RevokedApiKeyError = errors.New("API key revoked")
+
+	limiter_mu sync.Mutex
+	limiters   = make(map[string]*rate.Limiter)
+)
+
+type ApiKey struct {
+	Id          string `json:"id"`
+	Username    string `json:"username"`
+	Description string `json:"description,omitempty"`
+
+	// Hex encoded sha256 of the secret part of the key.
+	Hash string `json:"hash"`
+
+	// If set, the key may only be used to access these orgs.
+	Orgs []string `json:"orgs,omitempty"`
+
+	// Maximum number of requests per second allowed with this key
+	// (0 means unlimited).
+	RateLimit float64 `json:"rate_limit,omitempty"`
+
+	Created int64 `json:"created"`
+	Expires int64 `json:"expires,omitempty"`
+	Revoked int64 `json:"revoked,omitempty"`
+}
+
+// Create a new API key for the user. The full key is only returned
+// here and is never stored.
+func CreateApiKey(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	username, description string,
+	orgs []string, rate_limit float64,
+	expires time.Time) (string, *ApiKey, error) {
+
+	if username == "" {
+		return "", nil, errors.New("Must set a username")
+	}
+
+	id := make([]byte, 8)
+	secret := make([]byte, 24)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = rand.Read(secret)
+	if err != nil {
+		return "", nil, err
+	}
+
+	record := &ApiKey{
+		Id:          hex.EncodeToString(id),
+		Username:    username,
+		Description: description,
+		Hash:        hashApiKeySecret(hex.EncodeToString(secret)),
+		Orgs:        orgs,
+		RateLimit:   rate_limit,
+		Created:     utils.GetTime().Now().Unix(),
+	}
+
+	if !expires.IsZero() {
+		record.Expires = expires.Unix()
+	}
+
+	err = setApiKey(config_obj, record)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := API_KEY_PREFIX + record.Id + "_" + hex.EncodeToString(secret)
+	return key, record, nil
+}
+
+// List all API keys. If username is set only list keys for this user.
+func ListApiKeys(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	username string) ([]*ApiKey, error) {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	children, err := db.ListChildren(config_obj, paths.API_KEYS_ROOT)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*ApiKey{}
+	for _, child := range children {
+		if child.IsDir() {
+			continue
+		}
+
+		record, err := getApiKey(config_obj, child.Base())
+		if err != nil {
+			continue
+		}
+
+		if username != "" && record.Username != username {
+			continue
+		}
+		result = append(result, record)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created < result[j].Created
+	})
+
+	return result, nil
+}
+
+// Revoke the API key. The record is kept so the key's use can still
+// be attributed in the audit log.
+func RevokeApiKey(
+	ctx context.Context,
+	config_obj *config_proto.Config, id string) (*ApiKey, error) {
+	record, err := getApiKey(config_obj, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if record.Revoked == 0 {
+		record.Revoked = utils.GetTime().Now().Unix()
+		err = setApiKey(config_obj, record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	limiter_mu.Lock()
+	delete(limiters, id)
+	limiter_mu.Unlock()
+
+	return record, nil
+}
+
+// Verify the key and return its record if it is valid.
+func VerifyApiKey(
+	ctx context.Context,
+	config_obj *config_proto.Config, key string) (*ApiKey, error) {
+	id, secret, err := ParseApiKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := getApiKey(config_obj, id)
+	if err != nil {
+		return nil, InvalidApiKeyError
+	}
+
+	if subtle.ConstantTimeCompare(
+		[]byte(hashApiKeySecret(secret)), []byte(record.Hash)) != 1 {
+		return nil, InvalidApiKeyError
+	}
+
+	if record.Revoked > 0 {
+		return record, RevokedApiKeyError
+	}
+
+	if record.Expires > 0 &&
+		utils.GetTime().Now().Unix() > record.Expires {
+		return record, ExpiredApiKeyError
+	}
+
+	return record, nil
+}
+
+// Split the key into its id and secret parts.
+func ParseApiKey(key string) (id string, secret string, err error) {
+	if !strings.HasPrefix(key, API_KEY_PREFIX) {
+		return "", "", InvalidApiKeyError
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(key, API_KEY_PREFIX), "_", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", InvalidApiKeyError
+	}
+
+	_, err = hex.DecodeString(parts[0])
+	if err != nil {
+		return "", "", InvalidApiKeyError
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// Returns true if the key is within its rate limit.
+func AllowApiKey(record *ApiKey) bool {
+	if record.RateLimit <= 0 {
+		return true
+	}
+
+	limiter_mu.Lock()
+	defer limiter_mu.Unlock()
+
+	limiter, pres := limiters[record.Id]
+	if !pres || limiter.Limit() != rate.Limit(record.RateLimit) {
+		burst := int(record.RateLimit)
+		if burst < 1 {
+			burst = 1
+		}
+		limiter = rate.NewLimiter(rate.Limit(record.RateLimit), burst)
+		limiters[record.Id] = limiter
+	}
+
+	return limiter.Allow()
+}
+
+func hashApiKeySecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+func getApiKey(config_obj *config_proto.Config, id string) (*ApiKey, error) {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	raw_db, ok := db.(datastore.RawDataStore)
+	if !ok {
+		return nil, errors.New("Datastore has no raw access.")
+	}
+
+	data, err := raw_db.GetBuffer(config_obj, paths.ApiKeyPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.NotFoundError, id)
+	}
+
+	record := &ApiKey{}
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, err
+	}
+
+	if record.Id != id {
+		return nil, fmt.Errorf("%w: %v", utils.NotFoundError, id)
+	}
+
+	return record, nil
+}
+
+func setApiKey(config_obj *config_proto.Config, record *ApiKey) error {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return err
+	}
+
+	raw_db, ok := db.(datastore.RawDataStore)
+	if !ok {
+		return errors.New("Datastore has no raw access.")
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return raw_db.SetBuffer(config_obj, paths.ApiKeyPath(record.Id),
+		data, utils.SyncCompleter)
+}
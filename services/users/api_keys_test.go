@@ -0,0 +1,64 @@
+package users_test
+
+import (
+	"time"
+
+	"www.velocidex.com/golang/velociraptor/services/users"
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func (self *UserManagerTestSuite) TestApiKeys() {
+	key, record, err := users.CreateApiKey(self.Ctx, self.ConfigObj,
+		"OrgAdmin", "Automation", []string{"O1"}, 1, time.Time{})
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), "OrgAdmin", record.Username)
+
+	// Only the hash is stored.
+	id, secret, err := users.ParseApiKey(key)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), record.Id, id)
+	assert.NotContains(self.T(), record.Hash, secret)
+
+	verified, err := users.VerifyApiKey(self.Ctx, self.ConfigObj, key)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), []string{"O1"}, verified.Orgs)
+
+	// A key with the wrong secret is rejected.
+	_, err = users.VerifyApiKey(self.Ctx, self.ConfigObj, key+"00")
+	assert.ErrorContains(self.T(), err, "Invalid API key")
+
+	_, err = users.VerifyApiKey(self.Ctx, self.ConfigObj, "vrk_nothex_secret")
+	assert.ErrorContains(self.T(), err, "Invalid API key")
+
+	// Rate limit is 1 request per second
+	assert.True(self.T(), users.AllowApiKey(verified))
+	assert.True(self.T(), !users.AllowApiKey(verified))
+
+	// Expired keys are rejected.
+	expired_key, _, err := users.CreateApiKey(self.Ctx, self.ConfigObj,
+		"AdminO1", "", nil, 0, time.Now().Add(-time.Hour))
+	assert.NoError(self.T(), err)
+
+	_, err = users.VerifyApiKey(self.Ctx, self.ConfigObj, expired_key)
+	assert.ErrorContains(self.T(), err, "API key expired")
+
+	records, err := users.ListApiKeys(self.Ctx, self.ConfigObj, "")
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 2, len(records))
+
+	records, err = users.ListApiKeys(self.Ctx, self.ConfigObj, "OrgAdmin")
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 1, len(records))
+
+	// Revoked keys are rejected but still listed.
+	_, err = users.RevokeApiKey(self.Ctx, self.ConfigObj, record.Id)
+	assert.NoError(self.T(), err)
+
+	_, err = users.VerifyApiKey(self.Ctx, self.ConfigObj, key)
+	assert.ErrorContains(self.T(), err, "API key revoked")
+
+	records, err = users.ListApiKeys(self.Ctx, self.ConfigObj, "OrgAdmin")
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), 1, len(records))
+	assert.True(self.T(), records[0].Revoked > 0)
+}
@@ -16,6 +16,7 @@ import (
 	"www.velocidex.com/golang/velociraptor/logging"
 	"www.velocidex.com/golang/velociraptor/services"
 	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/utils/usage"
 )
 
 func (self UserManager) GetUserFromContext(ctx context.Context) (
@@ -49,6 +50,9 @@ func (self UserManager) GetUserFromContext(ctx context.Context) (
 	}
 
 	org_config_obj, err = org_manager.GetOrgConfig(user_record.CurrentOrg)
+	if err == nil {
+		usage.AddApiCall(utils.NormalizedOrgId(org_config_obj.OrgId))
+	}
 	return user_record, org_config_obj, err
 }
 
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"regexp"
 	"runtime"
 
 	"github.com/Velocidex/yaml/v2"
@@ -147,11 +146,7 @@ func WritebackLocation(
 	return result, nil
 }
 
-var (
-	org_id_regex = regexp.MustCompile("\\$NONCE|%NONCE%")
-)
-
 func expandOrgId(path, nonce string) string {
-	path = org_id_regex.ReplaceAllString(path, utils.SanitizeString(nonce))
+	path = utils.ExpandDeploymentTemplate(path, nonce)
 	return utils.ExpandEnv(path)
 }
@@ -3,11 +3,14 @@ package startup
 import (
 	"context"
 
+	"www.velocidex.com/golang/velociraptor/actions"
 	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
 	"www.velocidex.com/golang/velociraptor/executor"
+	"www.velocidex.com/golang/velociraptor/logging"
 	"www.velocidex.com/golang/velociraptor/services"
 	"www.velocidex.com/golang/velociraptor/services/encrypted_logs"
 	"www.velocidex.com/golang/velociraptor/services/orgs"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
 )
 
 // StartClientServices starts the various services needed by the
@@ -23,6 +26,16 @@ func StartClientServices(
 		config_obj.Services = services.ClientServicesSpec()
 	}
 
+	// In forensic mode the client must not be able to change the
+	// endpoint so remove anything which could.
+	if config_obj.Client != nil && config_obj.Client.ForensicMode {
+		removed := vql_subsystem.EnforceVQLDenyList(
+			actions.ForensicDeniedPermissions...)
+		logger := logging.GetLogger(config_obj, &logging.ClientComponent)
+		logger.Info("<green>Forensic mode</>: Removed VQL plugins and functions %v",
+			removed)
+	}
+
 	// Wait for all services to properly start
 	// before we begin the comms.
 	sm := services.NewServiceManager(ctx, config_obj)
@@ -0,0 +1,75 @@
+package uploads
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// A reader which limits the rate at which data is read. Uploaders
+// read as fast as possible so throttling the reader limits the
+// bandwidth used by a single upload without affecting other
+// queries.
+type throttledReader struct {
+	reader  io.Reader
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+func (self *throttledReader) Read(buf []byte) (int, error) {
+	// Never read more than we are allowed to send in one go.
+	burst := self.limiter.Burst()
+	if len(buf) > burst {
+		buf = buf[:burst]
+	}
+
+	n, err := self.reader.Read(buf)
+	if n > 0 {
+		wait_err := self.limiter.WaitN(self.ctx, n)
+		if wait_err != nil {
+			return n, wait_err
+		}
+	}
+	return n, err
+}
+
+// Preserve the ranges of sparse files so they are still uploaded
+// sparsely.
+type throttledRangeReader struct {
+	*throttledReader
+	range_reader RangeReader
+}
+
+func (self *throttledRangeReader) Seek(offset int64, whence int) (int64, error) {
+	return self.range_reader.Seek(offset, whence)
+}
+
+func (self *throttledRangeReader) Ranges() []Range {
+	return self.range_reader.Ranges()
+}
+
+// Wrap the reader so it delivers at most bytes_per_sec. A rate of 0
+// means unlimited.
+func NewThrottledReader(ctx context.Context,
+	reader io.Reader, bytes_per_sec uint64) io.Reader {
+	if bytes_per_sec == 0 {
+		return reader
+	}
+
+	result := &throttledReader{
+		reader:  reader,
+		ctx:     ctx,
+		limiter: rate.NewLimiter(rate.Limit(bytes_per_sec), int(bytes_per_sec)),
+	}
+
+	range_reader, ok := reader.(RangeReader)
+	if ok {
+		return &throttledRangeReader{
+			throttledReader: result,
+			range_reader:    range_reader,
+		}
+	}
+
+	return result
+}
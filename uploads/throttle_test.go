@@ -0,0 +1,57 @@
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testRangeReader struct {
+	*bytes.Reader
+}
+
+func (self testRangeReader) Ranges() []Range {
+	return []Range{{Offset: 0, Length: 2}, {Offset: 5, Length: 5, IsSparse: true}}
+}
+
+func TestThrottledReader(t *testing.T) {
+	ctx := context.Background()
+	data := []byte("0123456789")
+
+	// No limit returns the original reader.
+	reader := bytes.NewReader(data)
+	assert.Equal(t, io.Reader(reader), NewThrottledReader(ctx, reader, 0))
+
+	// Reads are capped to the rate.
+	throttled := NewThrottledReader(ctx, bytes.NewReader(data), 4)
+	buf := make([]byte, 10)
+	n, err := throttled.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, "0123", string(buf[:n]))
+
+	// Sparse readers keep their ranges.
+	throttled = NewThrottledReader(ctx, testRangeReader{bytes.NewReader(data)}, 4)
+	range_reader, ok := throttled.(RangeReader)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(range_reader.Ranges()))
+
+	_, err = range_reader.Seek(5, io.SeekStart)
+	assert.NoError(t, err)
+	n, err = range_reader.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "5678", string(buf[:n]))
+
+	// Cancelling the context aborts a throttled read.
+	sub_ctx, cancel := context.WithCancel(ctx)
+	throttled = NewThrottledReader(sub_ctx, bytes.NewReader(data), 4)
+	_, err = throttled.Read(buf)
+	assert.NoError(t, err)
+
+	cancel()
+	_, err = throttled.Read(buf)
+	assert.Error(t, err)
+}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// A Bloom filter is a compact probabilistic set. Testing an item
+// which was added always succeeds, but an item which was not added
+// may also match with a small, configurable false positive rate.
+//
+// This allows large indicator lists to be sent to clients as a
+// filter which is much smaller than the list itself and does not
+// reveal its contents. Matches on the client are only candidates and
+// must be verified against the full list on the server.
+type BloomFilter struct {
+	bits   []uint64
+	m      uint64
+	k      uint32
+	values uint64
+}
+
+const (
+	bloomFilterMagic = "VBF1"
+
+	// Refuse to create or parse filters larger than this many bits
+	// (128mb).
+	maxBloomFilterBits = 1 << 30
+)
+
+var (
+	invalidBloomFilterError = errors.New("Invalid bloom filter")
+)
+
+// Create a new filter sized to hold n items with the false positive
+// rate p.
+func NewBloomFilter(n uint64, p float64) (*BloomFilter, error) {
+	if n == 0 {
+		n = 1
+	}
+
+	if p <= 0 || p >= 1 {
+		return nil, errors.New("False positive rate must be between 0 and 1")
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	if m > maxBloomFilterBits {
+		return nil, errors.New("Bloom filter is too large")
+	}
+
+	k := uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &BloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}, nil
+}
+
+// Derive the k bit positions from two independent hashes
+// (Kirsch-Mitzenmacher).
+func (self *BloomFilter) locations(item string) []uint64 {
+	sum := sha256.Sum256([]byte(item))
+	h1 := binary.LittleEndian.Uint64(sum[0:8])
+	h2 := binary.LittleEndian.Uint64(sum[8:16])
+
+	result := make([]uint64, 0, self.k)
+	for i := uint64(0); i < uint64(self.k); i++ {
+		result = append(result, (h1+i*h2)%self.m)
+	}
+	return result
+}
+
+func (self *BloomFilter) Add(item string) {
+	for _, loc := range self.locations(item) {
+		self.bits[loc/64] |= 1 << (loc % 64)
+	}
+	self.values++
+}
+
+func (self *BloomFilter) Test(item string) bool {
+	for _, loc := range self.locations(item) {
+		if self.bits[loc/64]&(1<<(loc%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// The number of items added to the filter.
+func (self *BloomFilter) Len() uint64 {
+	return self.values
+}
+
+// The size of the filter in bytes.
+func (self *BloomFilter) Size() uint64 {
+	return uint64(len(self.bits)) * 8
+}
+
+// Serialize the filter into a compressed base64 string suitable for
+// passing as an artifact parameter.
+func (self *BloomFilter) Serialize() (string, error) {
+	buf := &bytes.Buffer{}
+	buf.Write([]byte(bloomFilterMagic))
+
+	w := zlib.NewWriter(buf)
+	for _, v := range []interface{}{self.m, self.k, self.values, self.bits} {
+		err := binary.Write(w, binary.LittleEndian, v)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err := w.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func ParseBloomFilter(serialized string) (*BloomFilter, error) {
+	data, err := base64.StdEncoding.DecodeString(serialized)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, []byte(bloomFilterMagic)) {
+		return nil, invalidBloomFilterError
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(data[len(bloomFilterMagic):]))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	result := &BloomFilter{}
+	for _, v := range []interface{}{&result.m, &result.k, &result.values} {
+		err := binary.Read(r, binary.LittleEndian, v)
+		if err != nil {
+			return nil, invalidBloomFilterError
+		}
+	}
+
+	if result.m == 0 || result.m > maxBloomFilterBits || result.k == 0 {
+		return nil, invalidBloomFilterError
+	}
+
+	result.bits = make([]uint64, (result.m+63)/64)
+	err = binary.Read(r, binary.LittleEndian, result.bits)
+	if err != nil {
+		return nil, invalidBloomFilterError
+	}
+
+	// There should be no trailing data.
+	_, err = r.Read(make([]byte, 1))
+	if err != io.EOF {
+		return nil, invalidBloomFilterError
+	}
+
+	return result, nil
+}
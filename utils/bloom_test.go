@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloomFilter(t *testing.T) {
+	filter, err := NewBloomFilter(1000, 0.001)
+	assert.NoError(t, err)
+
+	for i := 0; i < 1000; i++ {
+		filter.Add(fmt.Sprintf("indicator%d", i))
+	}
+	assert.Equal(t, uint64(1000), filter.Len())
+
+	serialized, err := filter.Serialize()
+	assert.NoError(t, err)
+
+	parsed, err := ParseBloomFilter(serialized)
+	assert.NoError(t, err)
+	assert.Equal(t, filter.Len(), parsed.Len())
+
+	// All added items must match.
+	for i := 0; i < 1000; i++ {
+		assert.True(t, parsed.Test(fmt.Sprintf("indicator%d", i)))
+	}
+
+	// Few other items should match.
+	false_positives := 0
+	for i := 0; i < 10000; i++ {
+		if parsed.Test(fmt.Sprintf("other%d", i)) {
+			false_positives++
+		}
+	}
+	assert.Less(t, false_positives, 50)
+
+	// Corrupted filters are rejected.
+	_, err = ParseBloomFilter(serialized[:len(serialized)/2])
+	assert.Error(t, err)
+
+	_, err = ParseBloomFilter("hello")
+	assert.Error(t, err)
+
+	_, err = NewBloomFilter(10, 2)
+	assert.Error(t, err)
+}
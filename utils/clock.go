@@ -73,6 +73,37 @@ func (self RealClockWithOffset) Now() time.Time {
 	return time.Now().Add(self.Duration)
 }
 
+// A clock that runs Scale times faster than real time from the
+// time it was created. Simulations use it to compress hours of poll
+// and backoff behavior into minutes.
+type ScaledClock struct {
+	start time.Time
+	scale float64
+}
+
+func (self *ScaledClock) Now() time.Time {
+	elapsed := time.Since(self.start)
+	return self.start.Add(time.Duration(float64(elapsed) * self.scale))
+}
+
+func (self *ScaledClock) After(d time.Duration) <-chan time.Time {
+	return time.After(time.Duration(float64(d) / self.scale))
+}
+
+func (self *ScaledClock) Sleep(d time.Duration) {
+	time.Sleep(time.Duration(float64(d) / self.scale))
+}
+
+func NewScaledClock(scale float64) *ScaledClock {
+	if scale <= 0 {
+		scale = 1
+	}
+	return &ScaledClock{
+		start: time.Now(),
+		scale: scale,
+	}
+}
+
 type MockClock struct {
 	mu      sync.Mutex
 	mockNow time.Time
@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"unicode/utf8"
+
+	"github.com/Velocidex/json"
+	errors "github.com/go-errors/errors"
+)
+
+var (
+	NotColumnarError = errors.New("Rows do not share the same columns")
+)
+
+// A batch of rows stored column by column. Column names are only
+// stored once and string columns are front coded: each value only
+// stores the part that differs from the previous row. This works
+// well for typical results where many rows share long path
+// prefixes.
+type columnarBatch struct {
+	Columns []string         `json:"columns"`
+	Rows    int              `json:"rows"`
+	Data    []columnarColumn `json:"data"`
+}
+
+type columnarColumn struct {
+	// Columns that contain non string values are stored verbatim.
+	Values []json.RawMessage `json:"values,omitempty"`
+
+	// Each string shares Prefix[i] bytes with the previous string
+	// in the column followed by Suffix[i].
+	Prefix []int    `json:"prefix,omitempty"`
+	Suffix []string `json:"suffix,omitempty"`
+}
+
+// Read the next JSON object from the decoder preserving the key
+// order and the raw values.
+func readRawObject(dec *json.Decoder) ([]string, []json.RawMessage, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, nil, errors.New("Invalid JSON object")
+	}
+
+	var keys []string
+	var values []json.RawMessage
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		key, ok := tok.(string)
+		if !ok {
+			return nil, nil, errors.New("Invalid JSON object")
+		}
+
+		var value json.RawMessage
+		err = dec.Decode(&value)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	// Consume the closing }
+	_, err = dec.Token()
+	return keys, values, err
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	// Do not split a multi byte character between the prefix and
+	// suffix because the suffix must remain valid utf8.
+	for i > 0 && i < len(b) && !utf8.RuneStart(b[i]) {
+		i--
+	}
+	return i
+}
+
+// Encode a JSONL batch into the columnar format. All rows must have
+// the same columns in the same order otherwise NotColumnarError is
+// returned and the caller should send the JSONL as is.
+func EncodeColumnarJSONL(jsonl []byte) ([]byte, error) {
+	batch := &columnarBatch{}
+	var columns [][]json.RawMessage
+
+	dec := json.NewDecoder(bytes.NewReader(jsonl))
+	for {
+		keys, values, err := readRawObject(dec)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if batch.Rows == 0 {
+			batch.Columns = keys
+			columns = make([][]json.RawMessage, len(keys))
+
+		} else if !sameColumns(batch.Columns, keys) {
+			return nil, NotColumnarError
+		}
+
+		for i, value := range values {
+			columns[i] = append(columns[i], value)
+		}
+		batch.Rows++
+	}
+
+	for _, values := range columns {
+		batch.Data = append(batch.Data, encodeColumn(values))
+	}
+
+	return json.Marshal(batch)
+}
+
+func encodeColumn(values []json.RawMessage) columnarColumn {
+	str_values := make([]string, 0, len(values))
+	for _, value := range values {
+		var str string
+		if len(value) == 0 || value[0] != '"' ||
+			json.Unmarshal(value, &str) != nil {
+			return columnarColumn{Values: values}
+		}
+		str_values = append(str_values, str)
+	}
+
+	result := columnarColumn{
+		Prefix: make([]int, 0, len(str_values)),
+		Suffix: make([]string, 0, len(str_values)),
+	}
+
+	last := ""
+	for _, str := range str_values {
+		prefix := commonPrefix(last, str)
+		result.Prefix = append(result.Prefix, prefix)
+		result.Suffix = append(result.Suffix, str[prefix:])
+		last = str
+	}
+
+	return result
+}
+
+// Expand a columnar batch back into JSONL.
+func DecodeColumnarJSONL(data []byte) ([]byte, error) {
+	batch := &columnarBatch{}
+	err := json.Unmarshal(data, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(batch.Data) != len(batch.Columns) {
+		return nil, errors.New("Columnar batch: Invalid number of columns")
+	}
+
+	// Expand every column into its raw JSON values.
+	columns := make([][]json.RawMessage, 0, len(batch.Data))
+	for _, column := range batch.Data {
+		values, err := decodeColumn(column, batch.Rows)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, values)
+	}
+
+	keys := make([][]byte, 0, len(batch.Columns))
+	for _, column := range batch.Columns {
+		key, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	result := &bytes.Buffer{}
+	for row := 0; row < batch.Rows; row++ {
+		result.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				result.WriteByte(',')
+			}
+			result.Write(key)
+			result.WriteByte(':')
+			result.Write(columns[i][row])
+		}
+		result.WriteString("}\n")
+	}
+
+	return result.Bytes(), nil
+}
+
+func decodeColumn(column columnarColumn, rows int) ([]json.RawMessage, error) {
+	if len(column.Values) > 0 {
+		if len(column.Values) != rows {
+			return nil, errors.New("Columnar batch: Invalid number of rows")
+		}
+		return column.Values, nil
+	}
+
+	if len(column.Prefix) != rows || len(column.Suffix) != rows {
+		return nil, errors.New("Columnar batch: Invalid number of rows")
+	}
+
+	result := make([]json.RawMessage, 0, rows)
+	last := ""
+	for i, prefix := range column.Prefix {
+		if prefix < 0 || prefix > len(last) {
+			return nil, errors.New("Columnar batch: Invalid prefix")
+		}
+
+		last = last[:prefix] + column.Suffix[i]
+		serialized, err := json.Marshal(last)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, serialized)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"testing"
+
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func TestColumnarJSONL(t *testing.T) {
+	jsonl := `{"OSPath":"C:\\Windows\\System32\\notepad.exe","Size":10,"Name":"notepad.exe"}
+{"OSPath":"C:\\Windows\\System32\\cmd.exe","Size":20,"Name":"cmd.exe"}
+{"OSPath":"C:\\Windows\\System32\\drivers\\etc\\hosts","Size":null,"Name":"hosts"}
+{"OSPath":"C:\\Windows\\Système\\日本語","Size":{"A":1},"Name":"日本"}
+`
+
+	encoded, err := EncodeColumnarJSONL([]byte(jsonl))
+	assert.NoError(t, err)
+
+	decoded, err := DecodeColumnarJSONL(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, jsonl, string(decoded))
+
+	// Rows with different columns can not be encoded.
+	_, err = EncodeColumnarJSONL([]byte("{\"A\":1}\n{\"B\":2}\n"))
+	assert.Error(t, err)
+
+	// Empty batches round trip.
+	encoded, err = EncodeColumnarJSONL(nil)
+	assert.NoError(t, err)
+
+	decoded, err = DecodeColumnarJSONL(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, "", string(decoded))
+}
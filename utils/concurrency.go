@@ -42,6 +42,15 @@ func (self *Concurrency) EndConcurrencyControl() {
 	concurrencyControl.Dec()
 }
 
+// The fraction of concurrency slots currently in use.
+func (self *Concurrency) Utilization() float64 {
+	size := cap(self.concurrency)
+	if size == 0 {
+		return 0
+	}
+	return float64(len(self.concurrency)) / float64(size)
+}
+
 func NewConcurrencyControl(size int, timeout time.Duration) *Concurrency {
 	return &Concurrency{
 		timeout:     timeout,
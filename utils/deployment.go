@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"regexp"
+	"strings"
+)
+
+var (
+	deployment_template_regex = regexp.MustCompile(
+		`\$(NONCE|DEPLOYMENT_NAME)|%(NONCE|DEPLOYMENT_NAME)%`)
+)
+
+// Derive a name from the deployment's nonce. The name is stable for
+// all clients in the deployment but differs between deployments so it
+// can not be used to fingerprint the client.
+func DeploymentName(nonce string) string {
+	consonants := "bcdfghjklmnprstvz"
+	vowels := "aeiou"
+
+	hash := sha256.Sum256([]byte("deployment name:" + nonce))
+	result := make([]byte, 0, 8)
+	for i := 0; i < 8; i++ {
+		if i%2 == 0 {
+			result = append(result, consonants[int(hash[i])%len(consonants)])
+		} else {
+			result = append(result, vowels[int(hash[i])%len(vowels)])
+		}
+	}
+	return string(result)
+}
+
+// Expand the deployment templates in a path or name:
+//
+//   - $NONCE or %NONCE% expands to the client nonce.
+//   - $DEPLOYMENT_NAME or %DEPLOYMENT_NAME% expands to a name derived
+//     from the nonce.
+func ExpandDeploymentTemplate(in, nonce string) string {
+	return deployment_template_regex.ReplaceAllStringFunc(in,
+		func(match string) string {
+			if strings.Contains(match, "NONCE") {
+				return SanitizeString(nonce)
+			}
+			return DeploymentName(nonce)
+		})
+}
@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf16"
+)
+
+// Parameters used to generate a deployment script.
+type DeploymentScriptOptions struct {
+	// The frontend URL the client binary is fetched from (usually the
+	// first of the client's server_urls).
+	ServerURL string
+
+	// A bootstrap token accepted by the frontend.
+	Token string
+
+	// The client config to install.
+	Config []byte
+
+	// The inventory tool to download (defaults to VelociraptorWindows
+	// or VelociraptorLinux).
+	Tool string
+}
+
+// Scripts are rendered from templates with the config embedded as
+// base64 so line endings are preserved exactly and the config hash
+// can be verified after it is written.
+var deploymentScriptTemplates = map[string]string{
+	"windows": `# Velociraptor deployment script - generated for {{.ServerURL}}
+$ErrorActionPreference = "Stop"
+[Net.ServicePointManager]::SecurityProtocol = [Net.SecurityProtocolType]::Tls12
+
+$Url = "{{.BootstrapURL}}"
+$Token = "{{.Token}}"
+$ConfigHash = "{{.ConfigHash}}"
+$Config = "{{.ConfigBase64}}"
+
+$TempDir = Join-Path $env:TEMP ("velociraptor_" + [guid]::NewGuid())
+New-Item -ItemType Directory -Path $TempDir | Out-Null
+$Binary = Join-Path $TempDir "velociraptor.exe"
+$ConfigPath = Join-Path $TempDir "client.config.yaml"
+
+try {
+  $Response = Invoke-WebRequest -UseBasicParsing -Uri $Url -OutFile $Binary -PassThru ` + "`" + `
+      -Headers @{ Authorization = "Bearer $Token" }
+  $BinaryHash = $Response.Headers["X-Velociraptor-SHA256"]
+  if ($BinaryHash -and (Get-FileHash -Algorithm SHA256 $Binary).Hash -ne $BinaryHash) {
+    throw "Binary hash mismatch"
+  }
+
+  [IO.File]::WriteAllBytes($ConfigPath, [Convert]::FromBase64String($Config))
+  if ((Get-FileHash -Algorithm SHA256 $ConfigPath).Hash -ne $ConfigHash) {
+    throw "Config hash mismatch"
+  }
+
+  & $Binary --config $ConfigPath service install
+  if ($LASTEXITCODE -ne 0) {
+    throw "Service install failed"
+  }
+} finally {
+  Remove-Item -Recurse -Force $TempDir
+}
+`,
+
+	"linux": `#!/bin/bash
+# Velociraptor deployment script - generated for {{.ServerURL}}
+set -euo pipefail
+
+URL="{{.BootstrapURL}}"
+TOKEN="{{.Token}}"
+CONFIG_HASH="{{.ConfigHash}}"
+CONFIG="{{.ConfigBase64}}"
+
+BINARY=/usr/local/bin/velociraptor
+CONFIG_PATH=/etc/velociraptor/client.config.yaml
+
+WORKDIR=$(mktemp -d)
+trap 'rm -rf "$WORKDIR"' EXIT
+
+curl -fsS -D "$WORKDIR/headers" -H "Authorization: Bearer $TOKEN" \
+     -o "$WORKDIR/velociraptor" "$URL"
+
+BINARY_HASH=$(grep -i '^X-Velociraptor-SHA256:' "$WORKDIR/headers" | \
+     cut -d: -f2 | tr -d ' \r' | tr 'A-F' 'a-f' || true)
+if [ -n "$BINARY_HASH" ]; then
+  echo "$BINARY_HASH  $WORKDIR/velociraptor" | sha256sum -c --quiet
+fi
+
+echo "$CONFIG" | base64 -d > "$WORKDIR/client.config.yaml"
+echo "$CONFIG_HASH  $WORKDIR/client.config.yaml" | sha256sum -c --quiet
+
+mkdir -p "$(dirname "$CONFIG_PATH")"
+install -m 0755 "$WORKDIR/velociraptor" "$BINARY"
+install -m 0600 "$WORKDIR/client.config.yaml" "$CONFIG_PATH"
+
+cat > /etc/systemd/system/velociraptor_client.service <<'EOF'
+[Unit]
+Description=Velociraptor client
+After=network.target
+
+[Service]
+Type=simple
+Restart=always
+RestartSec=120
+LimitNOFILE=20000
+Environment=LANG=en_US.UTF-8
+ExecStart=/usr/local/bin/velociraptor --config /etc/velociraptor/client.config.yaml client --quiet
+
+[Install]
+WantedBy=multi-user.target
+EOF
+
+systemctl daemon-reload
+systemctl enable --now velociraptor_client
+`,
+}
+
+var deploymentScriptTools = map[string]string{
+	"windows": "VelociraptorWindows",
+	"linux":   "VelociraptorLinux",
+}
+
+// Generate a script which downloads the client binary from the
+// frontend's bootstrap endpoint, installs the embedded config after
+// verifying its hash and starts the client service.
+func GenerateDeploymentScript(
+	target_os string, options DeploymentScriptOptions) (string, error) {
+	text, pres := deploymentScriptTemplates[target_os]
+	if !pres {
+		return "", fmt.Errorf("Unsupported OS %v for deployment script", target_os)
+	}
+
+	if options.ServerURL == "" {
+		return "", errors.New("No server URL for deployment script")
+	}
+
+	if options.Token == "" {
+		return "", errors.New("A bootstrap token is required for deployment scripts")
+	}
+
+	// The values are embedded in quoted strings so must not be able
+	// to break out of them.
+	for _, value := range []string{options.ServerURL, options.Token, options.Tool} {
+		if strings.ContainsAny(value, "\"'`$\\\r\n") {
+			return "", fmt.Errorf("Invalid characters in %v", value)
+		}
+	}
+
+	tool := options.Tool
+	if tool == "" {
+		tool = deploymentScriptTools[target_os]
+	}
+
+	hash := sha256.Sum256(options.Config)
+	config_hash := hex.EncodeToString(hash[:])
+
+	// PowerShell's Get-FileHash returns an upper case hash.
+	if target_os == "windows" {
+		config_hash = strings.ToUpper(config_hash)
+	}
+
+	tmpl, err := template.New(target_os).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	out := &bytes.Buffer{}
+	err = tmpl.Execute(out, map[string]string{
+		"ServerURL":    options.ServerURL,
+		"BootstrapURL": strings.TrimSuffix(options.ServerURL, "/") + "/bootstrap/" + tool,
+		"Token":        options.Token,
+		"ConfigHash":   config_hash,
+		"ConfigBase64": base64.StdEncoding.EncodeToString(options.Config),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+// Wrap a deployment script into a single command line which can be
+// pasted into a shell or pushed by a software deployment tool.
+func DeploymentOneLiner(target_os, script string) (string, error) {
+	switch target_os {
+	case "windows":
+		// PowerShell's -EncodedCommand takes base64 encoded UTF16-LE.
+		buf := &bytes.Buffer{}
+		for _, c := range utf16.Encode([]rune(script)) {
+			_ = binary.Write(buf, binary.LittleEndian, c)
+		}
+		return "powershell.exe -NoProfile -ExecutionPolicy Bypass -EncodedCommand " +
+			base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+
+	case "linux":
+		return "echo " + base64.StdEncoding.EncodeToString([]byte(script)) +
+			" | base64 -d | sudo bash", nil
+
+	default:
+		return "", fmt.Errorf("Unsupported OS %v for deployment script", target_os)
+	}
+}
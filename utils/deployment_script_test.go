@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateDeploymentScript(t *testing.T) {
+	options := DeploymentScriptOptions{
+		ServerURL: "https://velociraptor.example.com:8000/",
+		Token:     "secret",
+		Config:    []byte("Client:\n  server_urls:\n  - https://velociraptor.example.com:8000/\n"),
+	}
+
+	script, err := GenerateDeploymentScript("linux", options)
+	assert.NoError(t, err)
+	assert.Contains(t, script,
+		`URL="https://velociraptor.example.com:8000/bootstrap/VelociraptorLinux"`)
+	assert.Contains(t, script,
+		"CONFIG=\""+base64.StdEncoding.EncodeToString(options.Config)+"\"")
+
+	// PowerShell hashes are upper case.
+	script, err = GenerateDeploymentScript("windows", options)
+	assert.NoError(t, err)
+	assert.Contains(t, script, "/bootstrap/VelociraptorWindows")
+	assert.Regexp(t, `\$ConfigHash = "[0-9A-F]{64}"`, script)
+
+	one_liner, err := DeploymentOneLiner("windows", script)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(one_liner, "powershell.exe "))
+	assert.NotContains(t, one_liner, "\n")
+
+	// Values may not escape their quotes.
+	options.Token = `"; rm -rf /; echo "`
+	_, err = GenerateDeploymentScript("linux", options)
+	assert.Error(t, err)
+
+	_, err = GenerateDeploymentScript("darwin", options)
+	assert.Error(t, err)
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandDeploymentTemplate(t *testing.T) {
+	name := DeploymentName("nonce")
+	assert.Equal(t, 8, len(name))
+
+	// Names are stable within a deployment but differ between
+	// deployments.
+	assert.Equal(t, name, DeploymentName("nonce"))
+	assert.NotEqual(t, name, DeploymentName("other nonce"))
+
+	assert.Equal(t, `C:\Program Files\`+name+`\`+name+`.exe`,
+		ExpandDeploymentTemplate(
+			`C:\Program Files\$DEPLOYMENT_NAME\%DEPLOYMENT_NAME%.exe`, "nonce"))
+
+	assert.Equal(t, "/etc/nonce.yaml",
+		ExpandDeploymentTemplate("/etc/$NONCE.yaml", "nonce"))
+}
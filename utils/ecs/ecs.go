@@ -0,0 +1,283 @@
+/*
+Map Velociraptor rows into the Elastic Common Schema (ECS).
+
+SIEMs are usually configured around a normalized schema so detections
+and dashboards work across data sources. Output modules can
+optionally pass each row through a Mapper before forwarding it:
+
+  - Well known Velociraptor columns (ClientId, Pid, CommandLine, OSPath
+    etc) are renamed to their ECS fields.
+  - The first timestamp like column becomes @timestamp.
+  - All other columns are preserved under the velociraptor.* namespace
+    so they do not clash with ECS fields.
+  - Columns starting with _ are passed through unchanged since they are
+    usually directives for the output module (e.g. _index).
+
+Nested ECS fields (e.g. process.parent.pid) are emitted as nested
+objects.
+
+The text schema is used for full text indexing of arbitrary
+artifacts. Only the context columns (client, host, artifact and flow)
+are mapped - all other columns are flattened into the ECS message
+field. This keeps the index mapping stable no matter which artifacts
+are indexed.
+*/
+package ecs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/json"
+)
+
+const (
+	VERSION = "8.11.0"
+
+	// Columns without a mapping are stored under this namespace.
+	NAMESPACE = "velociraptor"
+)
+
+// Columns which may contain the event time, in order of preference.
+var timestampColumns = []string{
+	"@timestamp", "Timestamp", "timestamp", "Time", "EventTime", "_ts",
+}
+
+var defaultMapping = map[string]string{
+	// Host and agent
+	"ClientId": "agent.id",
+	"Hostname": "host.hostname",
+	"Fqdn":     "host.name",
+	"OS":       "host.os.type",
+
+	// Collection
+	"Artifact": "event.dataset",
+	"FlowId":   "event.id",
+
+	// Process
+	"Pid":         "process.pid",
+	"Ppid":        "process.parent.pid",
+	"CommandLine": "process.command_line",
+	"Exe":         "process.executable",
+	"Username":    "user.name",
+
+	// Files
+	"OSPath":   "file.path",
+	"FullPath": "file.path",
+	"Size":     "file.size",
+	"Mtime":    "file.mtime",
+	"Ctime":    "file.ctime",
+
+	// Network
+	"SrcIP":   "source.ip",
+	"SrcPort": "source.port",
+	"DstIP":   "destination.ip",
+	"DstPort": "destination.port",
+}
+
+// Columns which are mapped by the text schema. All other columns are
+// flattened into the message.
+var textContextColumns = []string{
+	"ClientId", "Hostname", "Fqdn", "OS", "Artifact", "FlowId",
+}
+
+type Mapper struct {
+	mapping map[string]string
+
+	// Flatten unmapped columns into the message field.
+	text bool
+}
+
+// Create a new mapper. Overrides map column names to ECS field names
+// and take precedence over the default mapping.
+func NewMapper(overrides *ordereddict.Dict) (*Mapper, error) {
+	result := &Mapper{mapping: make(map[string]string)}
+	for k, v := range defaultMapping {
+		result.mapping[k] = v
+	}
+
+	if overrides != nil {
+		for _, k := range overrides.Keys() {
+			v, _ := overrides.Get(k)
+			field, ok := v.(string)
+			if !ok || field == "" {
+				return nil, fmt.Errorf(
+					"ecs: mapping for %v must be a field name", k)
+			}
+			result.mapping[k] = field
+		}
+	}
+
+	return result, nil
+}
+
+// Create a mapper for full text indexing. Overrides map additional
+// context columns to ECS field names.
+func NewTextMapper(overrides *ordereddict.Dict) (*Mapper, error) {
+	mapper, err := NewMapper(overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Mapper{mapping: make(map[string]string), text: true}
+	for _, k := range textContextColumns {
+		result.mapping[k] = mapper.mapping[k]
+	}
+
+	if overrides != nil {
+		for _, k := range overrides.Keys() {
+			result.mapping[k] = mapper.mapping[k]
+		}
+	}
+
+	return result, nil
+}
+
+// Parse the schema argument common to output modules. Returns nil if
+// rows should be forwarded unchanged.
+func GetMapper(schema string, overrides *ordereddict.Dict) (*Mapper, error) {
+	switch schema {
+	case "", "raw":
+		return nil, nil
+
+	case "ecs":
+		return NewMapper(overrides)
+
+	case "text":
+		return NewTextMapper(overrides)
+
+	default:
+		return nil, fmt.Errorf("Unsupported schema %v", schema)
+	}
+}
+
+func (self *Mapper) Map(row *ordereddict.Dict) *ordereddict.Dict {
+	result := ordereddict.NewDict()
+
+	timestamp_column := ""
+	for _, column := range timestampColumns {
+		value, pres := row.Get(column)
+		if pres {
+			timestamp_column = column
+			result.Set("@timestamp", normalizeTime(value))
+			break
+		}
+	}
+
+	var message []string
+	for _, k := range row.Keys() {
+		if k == timestamp_column {
+			continue
+		}
+
+		value, _ := row.Get(k)
+		field, pres := self.mapping[k]
+		if !pres && self.text && !strings.HasPrefix(k, "_") {
+			message = append(message, k+": "+textValue(value))
+			continue
+		}
+
+		if !pres {
+			if strings.HasPrefix(k, "_") {
+				result.Set(k, value)
+				continue
+			}
+			field = NAMESPACE + "." + k
+		}
+
+		// If the field is taken (e.g. both OSPath and FullPath are
+		// present) keep the original column.
+		if !setField(result, field, value) {
+			setField(result, NAMESPACE+"."+k, value)
+		}
+	}
+
+	if self.text {
+		setField(result, "message", strings.Join(message, "\n"))
+	}
+
+	setField(result, "event.module", NAMESPACE)
+	setField(result, "ecs.version", VERSION)
+
+	return result
+}
+
+// Set a dotted field name as nested objects. Returns false if the
+// field is already set.
+func setField(row *ordereddict.Dict, field string, value interface{}) bool {
+	parts := strings.Split(field, ".")
+	for _, part := range parts[:len(parts)-1] {
+		existing, pres := row.Get(part)
+		if !pres {
+			child := ordereddict.NewDict()
+			row.Set(part, child)
+			row = child
+			continue
+		}
+
+		child, ok := existing.(*ordereddict.Dict)
+		if !ok {
+			return false
+		}
+		row = child
+	}
+
+	last := parts[len(parts)-1]
+	_, pres := row.Get(last)
+	if pres {
+		return false
+	}
+	row.Set(last, value)
+	return true
+}
+
+// ECS timestamps are ISO8601 strings. Numbers are treated as epoch
+// seconds.
+func normalizeTime(value interface{}) interface{} {
+	var ts time.Time
+
+	switch t := value.(type) {
+	case time.Time:
+		ts = t
+	case *time.Time:
+		ts = *t
+	case int64:
+		ts = time.Unix(t, 0)
+	case uint64:
+		ts = time.Unix(int64(t), 0)
+	case int:
+		ts = time.Unix(int64(t), 0)
+	case float64:
+		ts = time.Unix(0, int64(t*1e9))
+	default:
+		return value
+	}
+
+	return ts.UTC().Format(time.RFC3339Nano)
+}
+
+// Flatten a value into text for the message field.
+func textValue(value interface{}) string {
+	switch t := value.(type) {
+	case string:
+		return t
+
+	case []byte:
+		return string(t)
+
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+
+	case int, int32, int64, uint32, uint64, float64, bool:
+		return fmt.Sprintf("%v", t)
+
+	default:
+		serialized, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprintf("%v", value)
+		}
+		return string(serialized)
+	}
+}
@@ -0,0 +1,83 @@
+package ecs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"www.velocidex.com/golang/velociraptor/json"
+)
+
+func TestMapper(t *testing.T) {
+	mapper, err := NewMapper(ordereddict.NewDict().
+		Set("EventID", "event.code"))
+	require.NoError(t, err)
+
+	row := ordereddict.NewDict().
+		Set("Timestamp", time.Unix(1700000000, 0)).
+		Set("_ts", 1700000001).
+		Set("ClientId", "C.1234").
+		Set("Pid", 10).
+		Set("Ppid", 1).
+		Set("OSPath", `C:\Windows\notepad.exe`).
+		Set("FullPath", `C:\Windows\notepad.exe`).
+		Set("EventID", 4688).
+		Set("Extra", "Foo").
+		Set("_index", "myindex")
+
+	mapped := mapper.Map(row)
+	serialized, err := json.Marshal(mapped)
+	require.NoError(t, err)
+
+	assert.Equal(t, `{"@timestamp":"2023-11-14T22:13:20Z","_ts":1700000001,`+
+		`"agent":{"id":"C.1234"},"process":{"pid":10,"parent":{"pid":1}},`+
+		`"file":{"path":"C:\\Windows\\notepad.exe"},`+
+		`"velociraptor":{"FullPath":"C:\\Windows\\notepad.exe","Extra":"Foo"},`+
+		`"event":{"code":4688,"module":"velociraptor"},`+
+		`"_index":"myindex","ecs":{"version":"8.11.0"}}`,
+		string(serialized))
+}
+
+func TestGetMapper(t *testing.T) {
+	mapper, err := GetMapper("", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, mapper)
+
+	mapper, err = GetMapper("ecs", nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, mapper)
+
+	_, err = GetMapper("ocsf", nil)
+	assert.Error(t, err)
+
+	_, err = GetMapper("ecs", ordereddict.NewDict().Set("EventID", 1))
+	assert.Error(t, err)
+}
+
+func TestTextMapper(t *testing.T) {
+	mapper, err := GetMapper("text", nil)
+	require.NoError(t, err)
+
+	row := ordereddict.NewDict().
+		Set("Timestamp", time.Unix(1700000000, 0)).
+		Set("ClientId", "C.1234").
+		Set("Artifact", "Windows.Registry.RecentDocs").
+		Set("Pid", 10).
+		Set("Value", "secret.docx").
+		Set("Data", ordereddict.NewDict().Set("Type", "REG_SZ")).
+		Set("_index", "myindex")
+
+	mapped := mapper.Map(row)
+	serialized, err := json.Marshal(mapped)
+	require.NoError(t, err)
+
+	assert.Equal(t, `{"@timestamp":"2023-11-14T22:13:20Z",`+
+		`"agent":{"id":"C.1234"},`+
+		`"event":{"dataset":"Windows.Registry.RecentDocs","module":"velociraptor"},`+
+		`"_index":"myindex",`+
+		`"message":"Pid: 10\nValue: secret.docx\nData: {\"Type\":\"REG_SZ\"}",`+
+		`"ecs":{"version":"8.11.0"}}`,
+		string(serialized))
+}
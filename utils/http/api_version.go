@@ -0,0 +1,69 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"www.velocidex.com/golang/velociraptor/constants"
+)
+
+var (
+	UnsupportedApiVersionError = errors.New("No supported API version")
+)
+
+// The client advertises all the API versions it is able to speak in
+// each request. The server selects the highest version it also
+// supports and echoes it back in the same header. Older clients do
+// not send the header at all so in that case the version in the
+// message envelope is used.
+func AdvertiseApiVersions(req *http.Request, versions []uint32) {
+	parts := make([]string, 0, len(versions))
+	for _, v := range versions {
+		parts = append(parts, strconv.FormatUint(uint64(v), 10))
+	}
+	req.Header.Set(constants.CLIENT_API_VERSION_HEADER,
+		strings.Join(parts, ","))
+}
+
+// Select the highest version advertised by the client which is not
+// newer than max_supported. Returns 0 if the client did not
+// advertise any versions.
+func NegotiateApiVersion(
+	req *http.Request, max_supported uint32) (uint32, error) {
+	header := req.Header.Get(constants.CLIENT_API_VERSION_HEADER)
+	if header == "" {
+		return 0, nil
+	}
+
+	var result uint32
+	for _, part := range strings.Split(header, ",") {
+		v, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid API version %v", part)
+		}
+
+		if uint32(v) <= max_supported && uint32(v) > result {
+			result = uint32(v)
+		}
+	}
+
+	if result == 0 {
+		return 0, UnsupportedApiVersionError
+	}
+
+	return result, nil
+}
+
+// Returns the version selected by the server or 0 if the server did
+// not take part in the negotiation (older servers).
+func SelectedApiVersion(resp *http.Response) uint32 {
+	v, err := strconv.ParseUint(
+		resp.Header.Get(constants.CLIENT_API_VERSION_HEADER), 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(v)
+}
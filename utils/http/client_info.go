@@ -0,0 +1,41 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"www.velocidex.com/golang/velociraptor/constants"
+)
+
+// Describes the client sending a request. This is sent in the clear
+// so the frontend can meter or reject classes of clients without
+// decrypting the message. Since it is not authenticated it must only
+// be used to restrict clients - a client misrepresenting itself only
+// affects itself.
+type ClientInfo struct {
+	Version string
+	OS      string
+	Arch    string
+}
+
+func SetClientInfo(req *http.Request, info ClientInfo) {
+	req.Header.Set(constants.CLIENT_INFO_HEADER,
+		fmt.Sprintf("%s %s/%s", info.Version, info.OS, info.Arch))
+}
+
+// Returns false if the client did not send the header (older
+// clients).
+func GetClientInfo(req *http.Request) (ClientInfo, bool) {
+	header := req.Header.Get(constants.CLIENT_INFO_HEADER)
+	if header == "" {
+		return ClientInfo{}, false
+	}
+
+	result := ClientInfo{}
+	version, platform, _ := strings.Cut(header, " ")
+	result.Version = version
+	result.OS, result.Arch, _ = strings.Cut(platform, "/")
+
+	return result, true
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	windows_drive_path_regex = regexp.MustCompile(`^[a-zA-Z]:[\\/]`)
+	escaped_surrogate_regex  = regexp.MustCompile(`%u(D[89A-Fa-f][0-9A-Fa-f]{2})`)
+)
+
+// Convert an absolute Windows path into the extended length form
+// (\\?\C:\... or \\?\UNC\server\share\...). This lifts the
+// MAX_PATH (260 chars) limit and stops the Win32 layer from
+// mangling names with trailing dots or spaces. Device paths and
+// relative paths are returned unchanged.
+func ToLongPath(path string) string {
+	if strings.HasPrefix(path, `\\?\`) || strings.HasPrefix(path, `\\.\`) {
+		return path
+	}
+
+	// The extended form does not accept forward slashes.
+	if windows_drive_path_regex.MatchString(path) {
+		return `\\?\` + strings.ReplaceAll(path, "/", `\`)
+	}
+
+	if strings.HasPrefix(path, `\\`) {
+		return `\\?\UNC\` + strings.ReplaceAll(path[2:], "/", `\`)
+	}
+
+	return path
+}
+
+// Windows filenames are UTF-16 but do not need to be valid: they may
+// contain unpaired surrogates. Go represents these as WTF-8 which is
+// not valid UTF-8, so the name would be replaced with U+FFFD when
+// serialized and could not be opened again. We escape unpaired
+// surrogates as %uDXXX so the name round trips through the results.
+func EscapeSurrogates(name string) string {
+	// Fast path - nearly all names are fine.
+	if !strings.Contains(name, "\xed") {
+		return name
+	}
+
+	result := make([]byte, 0, len(name)+8)
+	for i := 0; i < len(name); i++ {
+		// WTF-8 encodes surrogates U+D800 to U+DFFF as
+		// ED [A0-BF] [80-BF]
+		if name[i] == 0xed && i+2 < len(name) &&
+			name[i+1] >= 0xa0 && name[i+1] <= 0xbf &&
+			name[i+2] >= 0x80 && name[i+2] <= 0xbf {
+			code := 0xd000 | int(name[i+1]&0x3f)<<6 | int(name[i+2]&0x3f)
+			result = append(result, fmt.Sprintf("%%u%04X", code)...)
+			i += 2
+			continue
+		}
+		result = append(result, name[i])
+	}
+
+	return string(result)
+}
+
+// Reverse EscapeSurrogates() to get the name to pass to the OS.
+func UnescapeSurrogates(name string) string {
+	if !strings.Contains(name, "%u") {
+		return name
+	}
+
+	return escaped_surrogate_regex.ReplaceAllStringFunc(name,
+		func(match string) string {
+			code, err := strconv.ParseUint(match[2:], 16, 16)
+			if err != nil {
+				return match
+			}
+			return string([]byte{
+				0xed,
+				0x80 | byte(code>>6)&0x3f,
+				0x80 | byte(code)&0x3f,
+			})
+		})
+}
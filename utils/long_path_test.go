@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"testing"
+
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func TestToLongPath(t *testing.T) {
+	assert.Equal(t, `\\?\C:\Windows\System32`, ToLongPath(`C:\Windows\System32`))
+	assert.Equal(t, `\\?\C:\Windows\System32`, ToLongPath(`C:/Windows/System32`))
+	assert.Equal(t, `\\?\UNC\server\share\file.txt`,
+		ToLongPath(`\\server\share\file.txt`))
+
+	// Device and relative paths are not changed.
+	assert.Equal(t, `\\.\C:\Windows`, ToLongPath(`\\.\C:\Windows`))
+	assert.Equal(t, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1\Windows`,
+		ToLongPath(`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1\Windows`))
+	assert.Equal(t, `Windows\System32`, ToLongPath(`Windows\System32`))
+}
+
+func TestSurrogateEscaping(t *testing.T) {
+	// An unpaired high surrogate (U+D83D) in WTF-8 form.
+	name := "file\xed\xa0\xbd.txt"
+	escaped := EscapeSurrogates(name)
+	assert.Equal(t, "file%uD83D.txt", escaped)
+	assert.Equal(t, name, UnescapeSurrogates(escaped))
+
+	// Valid UTF-8 is not changed.
+	assert.Equal(t, "файл 😀.txt", EscapeSurrogates("файл 😀.txt"))
+	assert.Equal(t, "100%u.txt", UnescapeSurrogates("100%u.txt"))
+}
@@ -0,0 +1,135 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Parquet metadata is serialized with the Thrift compact protocol. We
+// only need to write a handful of structs so we encode them by hand
+// instead of pulling in a Thrift runtime.
+
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+type thriftWriter struct {
+	buf bytes.Buffer
+
+	// Each nested struct tracks the last field id written so field
+	// headers can use the short delta form.
+	last_field []int16
+}
+
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{}
+}
+
+func (self *thriftWriter) Bytes() []byte {
+	return self.buf.Bytes()
+}
+
+func (self *thriftWriter) varint(v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	self.buf.Write(tmp[:n])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+func (self *thriftWriter) fieldHeader(id int16, field_type byte) {
+	last := self.last_field[len(self.last_field)-1]
+	delta := id - last
+	if delta > 0 && delta <= 15 {
+		self.buf.WriteByte(byte(delta)<<4 | field_type)
+	} else {
+		self.buf.WriteByte(field_type)
+		self.varint(zigzag(int64(id)))
+	}
+	self.last_field[len(self.last_field)-1] = id
+}
+
+func (self *thriftWriter) I32(id int16, v int32) {
+	self.fieldHeader(id, thriftI32)
+	self.varint(zigzag(int64(v)))
+}
+
+func (self *thriftWriter) I64(id int16, v int64) {
+	self.fieldHeader(id, thriftI64)
+	self.varint(zigzag(v))
+}
+
+func (self *thriftWriter) Bool(id int16, v bool) {
+	if v {
+		self.fieldHeader(id, thriftTrue)
+	} else {
+		self.fieldHeader(id, thriftFalse)
+	}
+}
+
+func (self *thriftWriter) String(id int16, v string) {
+	self.fieldHeader(id, thriftBinary)
+	self.varint(uint64(len(v)))
+	self.buf.WriteString(v)
+}
+
+func (self *thriftWriter) listHeader(id int16, elem_type byte, size int) {
+	self.fieldHeader(id, thriftList)
+	if size < 15 {
+		self.buf.WriteByte(byte(size)<<4 | elem_type)
+	} else {
+		self.buf.WriteByte(0xf0 | elem_type)
+		self.varint(uint64(size))
+	}
+}
+
+func (self *thriftWriter) I32List(id int16, values []int32) {
+	self.listHeader(id, thriftI32, len(values))
+	for _, v := range values {
+		self.varint(zigzag(int64(v)))
+	}
+}
+
+func (self *thriftWriter) StringList(id int16, values []string) {
+	self.listHeader(id, thriftBinary, len(values))
+	for _, v := range values {
+		self.varint(uint64(len(v)))
+		self.buf.WriteString(v)
+	}
+}
+
+// Write a list of structs, each encoded by the callback.
+func (self *thriftWriter) StructList(id int16, size int, cb func(idx int)) {
+	self.listHeader(id, thriftStruct, size)
+	for i := 0; i < size; i++ {
+		self.begin()
+		cb(i)
+		self.end()
+	}
+}
+
+func (self *thriftWriter) Struct(id int16, cb func()) {
+	self.fieldHeader(id, thriftStruct)
+	self.begin()
+	cb()
+	self.end()
+}
+
+// Structs are delimited by begin() and end(), including the top
+// level struct.
+func (self *thriftWriter) begin() {
+	self.last_field = append(self.last_field, 0)
+}
+
+func (self *thriftWriter) end() {
+	self.buf.WriteByte(0)
+	self.last_field = self.last_field[:len(self.last_field)-1]
+}
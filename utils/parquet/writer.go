@@ -0,0 +1,315 @@
+/*
+A minimal streaming Parquet writer.
+
+All columns are stored as optional UTF8 strings - complex values
+should be serialized to JSON by the caller. Rows are buffered in
+memory until a row group is full, then each column is written as a
+single gzip compressed data page. Data lake tools (Spark, Athena,
+BigQuery, DuckDB etc) can read these files directly.
+
+Since the output is written sequentially the writer can stream
+directly into an upload without touching the local disk.
+*/
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	MAGIC = "PAR1"
+
+	// Row groups are flushed when either limit is reached.
+	DEFAULT_ROW_GROUP_ROWS  = 50000
+	DEFAULT_ROW_GROUP_BYTES = 64 * 1024 * 1024
+
+	// Parquet enums
+	typeByteArray      = 6
+	repetitionOptional = 1
+	convertedUTF8      = 0
+	encodingPlain      = 0
+	encodingRLE        = 3
+	codecGzip          = 2
+	pageTypeData       = 0
+)
+
+type columnChunk struct {
+	offset            int64
+	num_values        int64
+	uncompressed_size int64
+	compressed_size   int64
+}
+
+type rowGroup struct {
+	columns         []columnChunk
+	num_rows        int64
+	total_byte_size int64
+}
+
+type countingWriter struct {
+	io.Writer
+	offset int64
+}
+
+func (self *countingWriter) Write(buf []byte) (int, error) {
+	n, err := self.Writer.Write(buf)
+	self.offset += int64(n)
+	return n, err
+}
+
+type Writer struct {
+	out     *countingWriter
+	columns []string
+
+	// Buffered values for the current row group by column. A nil
+	// value is NULL.
+	values         [][]*string
+	rows           int
+	buffered_bytes int
+
+	row_groups []rowGroup
+	total_rows int64
+
+	RowGroupRows  int
+	RowGroupBytes int
+}
+
+func NewWriter(out io.Writer, columns []string) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("parquet: No columns specified")
+	}
+
+	self := &Writer{
+		out:           &countingWriter{Writer: out},
+		columns:       columns,
+		values:        make([][]*string, len(columns)),
+		RowGroupRows:  DEFAULT_ROW_GROUP_ROWS,
+		RowGroupBytes: DEFAULT_ROW_GROUP_BYTES,
+	}
+
+	_, err := self.out.Write([]byte(MAGIC))
+	if err != nil {
+		return nil, err
+	}
+
+	return self, nil
+}
+
+func (self *Writer) Columns() []string {
+	return self.columns
+}
+
+// Number of rows written so far.
+func (self *Writer) Rows() int64 {
+	return self.total_rows + int64(self.rows)
+}
+
+// Bytes written to the output so far.
+func (self *Writer) Size() int64 {
+	return self.out.offset
+}
+
+// Write a row. The row must have a value for each column.
+func (self *Writer) Write(row []*string) error {
+	if len(row) != len(self.columns) {
+		return errors.New("parquet: Row does not match the schema")
+	}
+
+	for idx, value := range row {
+		self.values[idx] = append(self.values[idx], value)
+		if value != nil {
+			self.buffered_bytes += len(*value) + 4
+		}
+	}
+	self.rows++
+
+	if self.rows >= self.RowGroupRows ||
+		self.buffered_bytes >= self.RowGroupBytes {
+		return self.flush()
+	}
+	return nil
+}
+
+func (self *Writer) flush() error {
+	if self.rows == 0 {
+		return nil
+	}
+
+	row_group := rowGroup{num_rows: int64(self.rows)}
+	for idx := range self.columns {
+		chunk, err := self.writeColumn(self.values[idx])
+		if err != nil {
+			return err
+		}
+		row_group.columns = append(row_group.columns, chunk)
+		row_group.total_byte_size += chunk.uncompressed_size
+		self.values[idx] = nil
+	}
+
+	self.row_groups = append(self.row_groups, row_group)
+	self.total_rows += int64(self.rows)
+	self.rows = 0
+	self.buffered_bytes = 0
+
+	return nil
+}
+
+// Definition levels are encoded with the RLE/bit packed hybrid
+// encoding. With a bit width of 1 we only need RLE runs.
+func encodeDefinitionLevels(values []*string) []byte {
+	levels := &bytes.Buffer{}
+	var tmp [binary.MaxVarintLen64]byte
+
+	for i := 0; i < len(values); {
+		present := values[i] != nil
+		j := i
+		for j < len(values) && (values[j] != nil) == present {
+			j++
+		}
+
+		n := binary.PutUvarint(tmp[:], uint64(j-i)<<1)
+		levels.Write(tmp[:n])
+		if present {
+			levels.WriteByte(1)
+		} else {
+			levels.WriteByte(0)
+		}
+		i = j
+	}
+
+	result := make([]byte, 4, levels.Len()+4)
+	binary.LittleEndian.PutUint32(result, uint32(levels.Len()))
+	return append(result, levels.Bytes()...)
+}
+
+func (self *Writer) writeColumn(values []*string) (columnChunk, error) {
+	chunk := columnChunk{
+		offset:     self.out.offset,
+		num_values: int64(len(values)),
+	}
+
+	page := &bytes.Buffer{}
+	page.Write(encodeDefinitionLevels(values))
+
+	var length [4]byte
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		binary.LittleEndian.PutUint32(length[:], uint32(len(*value)))
+		page.Write(length[:])
+		page.WriteString(*value)
+	}
+
+	compressed := &bytes.Buffer{}
+	zw := gzip.NewWriter(compressed)
+	_, err := zw.Write(page.Bytes())
+	if err != nil {
+		return chunk, err
+	}
+	err = zw.Close()
+	if err != nil {
+		return chunk, err
+	}
+
+	header := newThriftWriter()
+	header.begin()
+	header.I32(1, pageTypeData)
+	header.I32(2, int32(page.Len()))
+	header.I32(3, int32(compressed.Len()))
+	header.Struct(5, func() {
+		header.I32(1, int32(len(values)))
+		header.I32(2, encodingPlain)
+		header.I32(3, encodingRLE)
+		header.I32(4, encodingRLE)
+	})
+	header.end()
+
+	_, err = self.out.Write(header.Bytes())
+	if err != nil {
+		return chunk, err
+	}
+
+	_, err = self.out.Write(compressed.Bytes())
+	if err != nil {
+		return chunk, err
+	}
+
+	header_len := int64(len(header.Bytes()))
+	chunk.uncompressed_size = header_len + int64(page.Len())
+	chunk.compressed_size = header_len + int64(compressed.Len())
+
+	return chunk, nil
+}
+
+func (self *Writer) footer() []byte {
+	t := newThriftWriter()
+	t.begin()
+	t.I32(1, 1)
+
+	// The schema is a flat list with the root element first.
+	t.StructList(2, len(self.columns)+1, func(idx int) {
+		if idx == 0 {
+			t.String(4, "schema")
+			t.I32(5, int32(len(self.columns)))
+			return
+		}
+		t.I32(1, typeByteArray)
+		t.I32(3, repetitionOptional)
+		t.String(4, self.columns[idx-1])
+		t.I32(6, convertedUTF8)
+	})
+
+	t.I64(3, self.total_rows)
+
+	t.StructList(4, len(self.row_groups), func(idx int) {
+		row_group := self.row_groups[idx]
+		t.StructList(1, len(row_group.columns), func(col int) {
+			chunk := row_group.columns[col]
+			t.I64(2, chunk.offset)
+			t.Struct(3, func() {
+				t.I32(1, typeByteArray)
+				t.I32List(2, []int32{encodingPlain, encodingRLE})
+				t.StringList(3, []string{self.columns[col]})
+				t.I32(4, codecGzip)
+				t.I64(5, chunk.num_values)
+				t.I64(6, chunk.uncompressed_size)
+				t.I64(7, chunk.compressed_size)
+				t.I64(9, chunk.offset)
+			})
+		})
+		t.I64(2, row_group.total_byte_size)
+		t.I64(3, row_group.num_rows)
+	})
+
+	t.String(6, "velociraptor")
+	t.end()
+
+	return t.Bytes()
+}
+
+// Flush any buffered rows and write the footer. The underlying
+// writer is not closed.
+func (self *Writer) Close() error {
+	err := self.flush()
+	if err != nil {
+		return err
+	}
+
+	footer := self.footer()
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+
+	for _, data := range [][]byte{footer, length[:], []byte(MAGIC)} {
+		_, err := self.out.Write(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A generic Thrift compact protocol decoder used to check the
+// metadata we write. Structs decode to map[int16]interface{} and
+// lists to []interface{}.
+type thriftReader struct {
+	*bytes.Reader
+}
+
+func (self *thriftReader) varint() uint64 {
+	v, _ := binary.ReadUvarint(self)
+	return v
+}
+
+func (self *thriftReader) zigzag() int64 {
+	v := self.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (self *thriftReader) value(field_type byte) interface{} {
+	switch field_type {
+	case thriftTrue:
+		return true
+	case thriftFalse:
+		return false
+	case thriftI32, thriftI64:
+		return self.zigzag()
+	case thriftBinary:
+		buf := make([]byte, self.varint())
+		_, _ = io.ReadFull(self, buf)
+		return string(buf)
+	case thriftList:
+		header, _ := self.ReadByte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(self.varint())
+		}
+		result := []interface{}{}
+		for i := 0; i < size; i++ {
+			result = append(result, self.value(header&0x0f))
+		}
+		return result
+	case thriftStruct:
+		return self.readStruct()
+	}
+	panic("Unsupported type")
+}
+
+func (self *thriftReader) readStruct() map[int16]interface{} {
+	result := make(map[int16]interface{})
+	var last int16
+	for {
+		header, err := self.ReadByte()
+		if err != nil || header == 0 {
+			return result
+		}
+
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(self.zigzag())
+		}
+		result[id] = self.value(header & 0x0f)
+		last = id
+	}
+}
+
+func readColumn(t *testing.T, data []byte, offset int64, count int) []*string {
+	reader := &thriftReader{bytes.NewReader(data[offset:])}
+	header := reader.readStruct()
+	assert.Equal(t, int64(count), header[5].(map[int16]interface{})[1])
+
+	compressed := make([]byte, header[3].(int64))
+	_, err := io.ReadFull(reader, compressed)
+	require.NoError(t, err)
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	page, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, header[2].(int64), int64(len(page)))
+
+	// Decode the RLE definition levels.
+	levels_len := binary.LittleEndian.Uint32(page)
+	levels := bytes.NewReader(page[4 : 4+levels_len])
+	present := []bool{}
+	for levels.Len() > 0 {
+		run, _ := binary.ReadUvarint(levels)
+		value, _ := levels.ReadByte()
+		for i := uint64(0); i < run>>1; i++ {
+			present = append(present, value == 1)
+		}
+	}
+	require.Equal(t, count, len(present))
+
+	values := page[4+levels_len:]
+	result := []*string{}
+	for _, p := range present {
+		if !p {
+			result = append(result, nil)
+			continue
+		}
+		length := binary.LittleEndian.Uint32(values)
+		value := string(values[4 : 4+length])
+		result = append(result, &value)
+		values = values[4+length:]
+	}
+	return result
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func TestWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	writer, err := NewWriter(out, []string{"Name", "Value"})
+	require.NoError(t, err)
+
+	// Force several row groups.
+	writer.RowGroupRows = 2
+
+	rows := [][]*string{
+		{str("a"), str("1")},
+		{str("b"), nil},
+		{nil, str(`{"x":1}`)},
+	}
+	for _, row := range rows {
+		require.NoError(t, writer.Write(row))
+	}
+	assert.Error(t, writer.Write([]*string{str("short")}))
+	require.NoError(t, writer.Close())
+
+	data := out.Bytes()
+	assert.Equal(t, MAGIC, string(data[:4]))
+	assert.Equal(t, MAGIC, string(data[len(data)-4:]))
+
+	footer_len := binary.LittleEndian.Uint32(data[len(data)-8:])
+	footer_start := len(data) - 8 - int(footer_len)
+	reader := &thriftReader{bytes.NewReader(data[footer_start : len(data)-8])}
+	metadata := reader.readStruct()
+
+	assert.Equal(t, int64(3), metadata[3])
+
+	schema := metadata[2].([]interface{})
+	assert.Equal(t, 3, len(schema))
+	assert.Equal(t, "Name", schema[1].(map[int16]interface{})[4])
+	assert.Equal(t, "Value", schema[2].(map[int16]interface{})[4])
+
+	// Reassemble the columns from all row groups.
+	names := []string{"Name", "Value"}
+	columns := [][]*string{nil, nil}
+	for _, rg := range metadata[4].([]interface{}) {
+		row_group := rg.(map[int16]interface{})
+		num_rows := int(row_group[3].(int64))
+		for idx, cc := range row_group[1].([]interface{}) {
+			meta := cc.(map[int16]interface{})[3].(map[int16]interface{})
+			assert.Equal(t, []interface{}{names[idx]}, meta[3])
+			columns[idx] = append(columns[idx],
+				readColumn(t, data, meta[9].(int64), num_rows)...)
+		}
+	}
+
+	for i, row := range rows {
+		for idx, value := range row {
+			assert.Equal(t, value, columns[idx][i])
+		}
+	}
+}
@@ -57,3 +57,29 @@ func NewDurationProgressWriter(
 
 	return self, cancel
 }
+
+// Estimate the completion percentage and time of a task which
+// processed done out of total items between start and now (both in
+// usec since epoch). The estimate assumes the remaining items will be
+// processed at the same rate. The completion time is 0 when it can
+// not be estimated yet.
+func EstimateProgress(done, total, start, now uint64) (
+	percent float64, completion uint64) {
+	if total == 0 {
+		return 0, 0
+	}
+
+	if done >= total {
+		return 100, now
+	}
+
+	percent = float64(done) * 100 / float64(total)
+	if done == 0 || now <= start {
+		return percent, 0
+	}
+
+	elapsed := float64(now - start)
+	remaining := elapsed * float64(total-done) / float64(done)
+
+	return percent, now + uint64(remaining)
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateProgress(t *testing.T) {
+	// Nothing to estimate without a total.
+	percent, completion := EstimateProgress(10, 0, 100, 200)
+	assert.Equal(t, float64(0), percent)
+	assert.Equal(t, uint64(0), completion)
+
+	// No rate yet.
+	percent, completion = EstimateProgress(0, 10, 100, 200)
+	assert.Equal(t, float64(0), percent)
+	assert.Equal(t, uint64(0), completion)
+
+	// A quarter done in 100 usec - 300 usec to go.
+	percent, completion = EstimateProgress(25, 100, 100, 200)
+	assert.Equal(t, float64(25), percent)
+	assert.Equal(t, uint64(500), completion)
+
+	// Reporting more than expected is capped.
+	percent, completion = EstimateProgress(120, 100, 100, 200)
+	assert.Equal(t, float64(100), percent)
+	assert.Equal(t, uint64(200), completion)
+}
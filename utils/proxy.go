@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"net"
 	"net/http"
+	"strings"
 )
 
 // Retrieve the Remote Address from a request in a reverse-proxy compatible way.
@@ -13,3 +15,54 @@ func RemoteAddr(req *http.Request, header string) string {
 	}
 	return req.RemoteAddr
 }
+
+// Like RemoteAddr but only trust the header when the connection
+// comes from one of the trusted proxy networks. This prevents clients
+// connecting directly from spoofing their address. Proxies append
+// the address they received the connection from, so we walk the
+// list from the right and return the first untrusted address.
+func RemoteAddrFromTrustedProxy(
+	req *http.Request, header string, trusted_proxies []string) string {
+	if len(header) == 0 || len(trusted_proxies) == 0 {
+		return RemoteAddr(req, header)
+	}
+
+	networks := make([]*net.IPNet, 0, len(trusted_proxies))
+	for _, cidr := range trusted_proxies {
+		_, network, err := net.ParseCIDR(cidr)
+		if err == nil {
+			networks = append(networks, network)
+		}
+	}
+
+	is_trusted := func(addr string) bool {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		ip := net.ParseIP(strings.TrimSpace(host))
+		if ip == nil {
+			return false
+		}
+		for _, network := range networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !is_trusted(req.RemoteAddr) {
+		return req.RemoteAddr
+	}
+
+	addresses := strings.Split(req.Header.Get(header), ",")
+	for i := len(addresses) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(addresses[i])
+		if addr != "" && !is_trusted(addr) {
+			return addr
+		}
+	}
+
+	return req.RemoteAddr
+}
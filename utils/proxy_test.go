@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"net/http"
+	"testing"
+
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func TestRemoteAddrFromTrustedProxy(t *testing.T) {
+	header := "X-Forwarded-For"
+	trusted := []string{"10.0.0.0/8"}
+
+	makeRequest := func(remote_addr, forwarded string) *http.Request {
+		req := &http.Request{
+			RemoteAddr: remote_addr,
+			Header:     make(http.Header),
+		}
+		req.Header.Set(header, forwarded)
+		return req
+	}
+
+	// Connection from the trusted proxy: use the client address.
+	assert.Equal(t, "1.2.3.4", RemoteAddrFromTrustedProxy(
+		makeRequest("10.1.1.1:443", "1.2.3.4"), header, trusted))
+
+	// The client may prepend a spoofed address - we only take the
+	// address the proxy added.
+	assert.Equal(t, "1.2.3.4", RemoteAddrFromTrustedProxy(
+		makeRequest("10.1.1.1:443", "5.6.7.8, 1.2.3.4, 10.2.2.2"),
+		header, trusted))
+
+	// Direct connections can not spoof the header.
+	assert.Equal(t, "8.8.8.8:1234", RemoteAddrFromTrustedProxy(
+		makeRequest("8.8.8.8:1234", "1.2.3.4"), header, trusted))
+
+	// Without trusted proxies the header is used as before.
+	assert.Equal(t, "1.2.3.4", RemoteAddrFromTrustedProxy(
+		makeRequest("8.8.8.8:1234", "1.2.3.4"), header, nil))
+}
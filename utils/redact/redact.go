@@ -0,0 +1,257 @@
+/*
+Redact sensitive information from result rows.
+
+Results are often shared with third parties (e.g. exported for an
+external team or forwarded to a SIEM run by a service provider). The
+redaction rules in the config remove personal information such as
+usernames or document contents from the rows as they leave the
+server:
+
+  - A rule applies to the artifacts matching its artifact regex and
+    the columns matching its column regex. Nested fields are matched
+    by their own name and a rule matching a column also applies to
+    everything nested below it.
+  - Without a value regex the entire value is replaced.
+  - With a value regex only the matching parts of strings are
+    replaced.
+  - Instead of fixed text, sensitive data may be replaced with a
+    (salted) hash so equal values can still be correlated.
+*/
+package redact
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/Velocidex/ordereddict"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+)
+
+const (
+	DEFAULT_REPLACEMENT = "[REDACTED]"
+)
+
+type rule struct {
+	artifact    *regexp.Regexp
+	column      *regexp.Regexp
+	regex       *regexp.Regexp
+	replacement string
+	hash        bool
+	salt        string
+}
+
+func (self *rule) replace(value string) string {
+	if self.hash {
+		hash := sha256.Sum256([]byte(self.salt + value))
+		return hex.EncodeToString(hash[:8])
+	}
+	return self.replacement
+}
+
+func (self *rule) redactString(value string) string {
+	if self.regex == nil {
+		return self.replace(value)
+	}
+
+	if self.hash {
+		return self.regex.ReplaceAllStringFunc(value, self.replace)
+	}
+	return self.regex.ReplaceAllString(value, self.replacement)
+}
+
+// A nil Redactor passes rows through unchanged.
+type Redactor struct {
+	rules []*rule
+}
+
+func NewRedactor(rules []*config_proto.RedactionRule) (*Redactor, error) {
+	self := &Redactor{}
+
+	compile := func(expr string) (*regexp.Regexp, error) {
+		if expr == "" {
+			return nil, nil
+		}
+		return regexp.Compile(expr)
+	}
+
+	for idx, r := range rules {
+		item := &rule{
+			replacement: r.Replacement,
+			hash:        r.Hash,
+			salt:        r.Salt,
+		}
+
+		if item.replacement == "" {
+			item.replacement = DEFAULT_REPLACEMENT
+		}
+
+		var err error
+		item.artifact, err = compile(r.Artifact)
+		if err == nil {
+			item.column, err = compile(r.Column)
+		}
+		if err == nil {
+			item.regex, err = compile(r.Regex)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Redaction rule %d: %w", idx, err)
+		}
+
+		self.rules = append(self.rules, item)
+	}
+
+	return self, nil
+}
+
+// Returns a Redactor with only the rules applying to the artifact,
+// or nil if no rules apply.
+func (self *Redactor) ForArtifact(name string) *Redactor {
+	if self == nil {
+		return nil
+	}
+
+	result := &Redactor{}
+	for _, r := range self.rules {
+		if r.artifact == nil || r.artifact.MatchString(name) {
+			result.rules = append(result.rules, r)
+		}
+	}
+
+	if len(result.rules) == 0 {
+		return nil
+	}
+	return result
+}
+
+// Returns a redacted copy of the row.
+func (self *Redactor) Redact(row *ordereddict.Dict) *ordereddict.Dict {
+	if self == nil {
+		return row
+	}
+
+	return self.redactDict(row, nil)
+}
+
+func (self *Redactor) redactDict(
+	row *ordereddict.Dict, active []*rule) *ordereddict.Dict {
+	result := ordereddict.NewDict()
+	for _, k := range row.Keys() {
+		v, _ := row.Get(k)
+		result.Set(k, self.redactValue(k, v, active))
+	}
+	return result
+}
+
+func (self *Redactor) redactValue(
+	key string, value interface{}, inherited []*rule) interface{} {
+
+	// Rules matching this column apply to everything below it.
+	active := inherited
+	for _, r := range self.rules {
+		if r.column == nil || r.column.MatchString(key) {
+			active = append(active[:len(active):len(active)], r)
+		}
+	}
+
+	for _, r := range active {
+		if r.regex == nil {
+			return r.redactString(fmt.Sprintf("%v", value))
+		}
+	}
+
+	switch t := value.(type) {
+	case *ordereddict.Dict:
+		return self.redactDict(t, active)
+
+	case []interface{}:
+		result := make([]interface{}, 0, len(t))
+		for _, item := range t {
+			result = append(result, self.redactValue(key, item, active))
+		}
+		return result
+
+	case string:
+		for _, r := range active {
+			t = r.redactString(t)
+		}
+		return t
+
+	default:
+		return value
+	}
+}
+
+// Redact a row serialized as a JSON object.
+func (self *Redactor) RedactJSON(serialized []byte) ([]byte, error) {
+	if self == nil {
+		return serialized, nil
+	}
+
+	row := ordereddict.NewDict()
+	err := json.Unmarshal(serialized, row)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(self.Redact(row))
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// Redact a stream of JSONL rows. Rows which can not be parsed are
+// dropped since they can not be redacted.
+func (self *Redactor) RedactJSONL(
+	ctx context.Context, in <-chan []byte) <-chan []byte {
+	if self == nil {
+		return in
+	}
+
+	output_chan := make(chan []byte)
+	go func() {
+		defer close(output_chan)
+
+		for serialized := range in {
+			for _, line := range bytes.Split(serialized, []byte("\n")) {
+				if len(bytes.TrimSpace(line)) == 0 {
+					continue
+				}
+
+				redacted, err := self.RedactJSON(line)
+				if err != nil {
+					continue
+				}
+
+				select {
+				case <-ctx.Done():
+					// Drain the input so the producer does not block.
+					for range in {
+					}
+					return
+				case output_chan <- append(redacted, '\n'):
+				}
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+// Build a Redactor from the configured rules.
+func FromConfig(config_obj *config_proto.Config) (*Redactor, error) {
+	rules := config_obj.Defaults.GetRedactionRules()
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("No redaction rules are configured")
+	}
+	return NewRedactor(rules)
+}
@@ -0,0 +1,66 @@
+package redact
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+)
+
+func TestRedactor(t *testing.T) {
+	redactor, err := NewRedactor([]*config_proto.RedactionRule{
+		// Mask usernames everywhere.
+		{Column: "^(Username|User)$", Hash: true, Salt: "S"},
+
+		// Remove document contents from one artifact.
+		{Artifact: "^Windows.Office", Column: "^Content$"},
+
+		// Mask email addresses in any string.
+		{Regex: `[a-zA-Z0-9.]+@([a-z.]+)`, Replacement: "xxx@$1"},
+	})
+	require.NoError(t, err)
+
+	row := []byte(`{"Pid":1,"Username":"bob","Content":"secret","Details":{"User":"alice","Mail":["mike@example.com (work)"]}}`)
+
+	redacted, err := redactor.ForArtifact("Generic.Client.Info").RedactJSON(row)
+	require.NoError(t, err)
+	assert.Equal(t, `{"Pid":1,"Username":"794af1f017485866","Content":"secret","Details":{"User":"5a6ea82770e648cd","Mail":["xxx@example.com (work)"]}}`,
+		string(redacted))
+
+	redacted, err = redactor.ForArtifact("Windows.Office.Documents").RedactJSON(row)
+	require.NoError(t, err)
+	assert.Contains(t, string(redacted), `"Content":"[REDACTED]"`)
+
+	// Rules only apply to matching artifacts.
+	redactor, err = NewRedactor([]*config_proto.RedactionRule{
+		{Artifact: "^Windows.Office", Column: "^Content$"},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, redactor.ForArtifact("Generic.Client.Info"))
+
+	// A nil redactor passes data through.
+	var nil_redactor *Redactor
+	redacted, err = nil_redactor.RedactJSON(row)
+	require.NoError(t, err)
+	assert.Equal(t, row, redacted)
+
+	// Streams drop rows which can not be redacted.
+	in := make(chan []byte, 2)
+	in <- []byte("{\"Content\":\"a\"}\n{\"Content\":\"b\"}\n")
+	in <- []byte("not json\n")
+	close(in)
+
+	var lines []string
+	for line := range redactor.RedactJSONL(context.Background(), in) {
+		lines = append(lines, string(line))
+	}
+	assert.Equal(t, []string{
+		"{\"Content\":\"[REDACTED]\"}\n",
+		"{\"Content\":\"[REDACTED]\"}\n",
+	}, lines)
+
+	_, err = NewRedactor([]*config_proto.RedactionRule{{Column: "("}})
+	assert.Error(t, err)
+}
@@ -51,6 +51,16 @@ func InString(hay []string, needle string) bool {
 	return false
 }
 
+func InUint32(hay []uint32, needle uint32) bool {
+	for _, x := range hay {
+		if x == needle {
+			return true
+		}
+	}
+
+	return false
+}
+
 func StringSliceEq(a []string, b []string) bool {
 	if len(a) != len(b) {
 		return false
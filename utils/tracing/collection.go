@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+)
+
+// Reconstruct spans for a completed collection from the query stats
+// reported back by the client. The client does not need to reach the
+// collector itself - the timings travel back with the FlowStats.
+func ExportCollection(trace_parent, client_id, flow_id string,
+	stats []*crypto_proto.VeloStatus) {
+	if !Enabled() || len(stats) == 0 {
+		return
+	}
+
+	parent, ok := ParseTraceParent(trace_parent)
+	if !ok {
+		return
+	}
+
+	collection := StartSpan("Collection", parent)
+	collection.Kind = SPAN_KIND_SERVER
+	collection.SetAttribute("client_id", client_id).
+		SetAttribute("flow_id", flow_id)
+
+	var first_active, last_active uint64
+	for _, s := range stats {
+		if first_active == 0 || s.FirstActive < first_active {
+			first_active = s.FirstActive
+		}
+		if s.LastActive > last_active {
+			last_active = s.LastActive
+		}
+	}
+	collection.Start = fromMicros(first_active)
+	collection.End = fromMicros(last_active)
+
+	for _, s := range stats {
+		name := s.Artifact
+		if name == "" {
+			name = fmt.Sprintf("Query %d/%d", s.QueryId+1, s.TotalQueries)
+		}
+
+		query := StartSpan(name, collection.SpanContext)
+		query.Kind = SPAN_KIND_SERVER
+		query.Start = fromMicros(s.FirstActive)
+		query.End = fromMicros(s.LastActive)
+		query.Error = s.ErrorMessage
+		query.SetAttribute("client_id", client_id).
+			SetAttribute("flow_id", flow_id).
+			SetAttribute("result_rows", s.ResultRows).
+			SetAttribute("log_rows", s.LogRows).
+			SetAttribute("uploaded_bytes", s.UploadedBytes)
+		if len(s.NamesWithResponse) > 0 {
+			query.SetAttribute("artifacts",
+				strings.Join(s.NamesWithResponse, ","))
+		}
+		if s.ErrorClass != "" {
+			query.SetAttribute("error_class", s.ErrorClass)
+		}
+
+		if query.Error != "" && collection.Error == "" {
+			collection.Error = query.Error
+		}
+		Export(query)
+	}
+
+	Export(collection)
+}
+
+func fromMicros(ts uint64) time.Time {
+	return time.Unix(0, int64(ts)*1000)
+}
@@ -0,0 +1,281 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/logging"
+)
+
+var (
+	spansDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tracing_spans_dropped",
+		Help: "Number of trace spans dropped because the exporter fell behind.",
+	})
+
+	spansExported = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tracing_spans_exported",
+		Help: "Number of trace spans exported to the OTLP collector.",
+	})
+
+	mu       sync.Mutex
+	exporter *otlpExporter
+)
+
+const (
+	// Spans are batched and sent periodically.
+	EXPORT_PERIOD = 5 * time.Second
+
+	// Drop spans if the collector is unreachable rather than
+	// growing without bounds.
+	MAX_QUEUED_SPANS = 10000
+)
+
+// Tracing is enabled when an exporter is running.
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return exporter != nil
+}
+
+// Queue a finished span for export. This is a noop when tracing is
+// not enabled.
+func Export(span *Span) {
+	mu.Lock()
+	e := exporter
+	mu.Unlock()
+
+	if e != nil {
+		e.Add(span)
+	}
+}
+
+type otlpExporter struct {
+	endpoint string
+	client   *http.Client
+
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (self *otlpExporter) Add(span *Span) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if len(self.spans) >= MAX_QUEUED_SPANS {
+		spansDropped.Inc()
+		return
+	}
+	self.spans = append(self.spans, span)
+}
+
+func (self *otlpExporter) flush(ctx context.Context) error {
+	self.mu.Lock()
+	spans := self.spans
+	self.spans = nil
+	self.mu.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+
+	serialized, err := json.Marshal(encodeSpans(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", self.endpoint,
+		bytes.NewReader(serialized))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := self.client.Do(req)
+	if err != nil {
+		spansDropped.Add(float64(len(spans)))
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		spansDropped.Add(float64(len(spans)))
+		return fmt.Errorf("OTLP collector returned %v", resp.Status)
+	}
+
+	spansExported.Add(float64(len(spans)))
+	return nil
+}
+
+// Encode the spans as an OTLP/HTTP JSON ExportTraceServiceRequest.
+func encodeSpans(spans []*Span) map[string]interface{} {
+	encoded := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		item := map[string]interface{}{
+			"traceId":           span.TraceId,
+			"spanId":            span.SpanId,
+			"name":              span.Name,
+			"kind":              span.Kind,
+			"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+			"attributes":        encodeAttributes(span),
+		}
+		if span.ParentSpanId != "" {
+			item["parentSpanId"] = span.ParentSpanId
+		}
+
+		// STATUS_CODE_ERROR
+		if span.Error != "" {
+			item["status"] = map[string]interface{}{
+				"code":    2,
+				"message": span.Error,
+			}
+		}
+		encoded = append(encoded, item)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []interface{}{
+						attribute("service.name", "velociraptor"),
+					},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "velociraptor"},
+						"spans": encoded,
+					},
+				},
+			},
+		},
+	}
+}
+
+func encodeAttributes(span *Span) []interface{} {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	keys := make([]string, 0, len(span.attributes))
+	for k := range span.attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, attribute(k, span.attributes[k]))
+	}
+	return result
+}
+
+func attribute(key string, value interface{}) map[string]interface{} {
+	var encoded map[string]interface{}
+
+	switch t := value.(type) {
+	case bool:
+		encoded = map[string]interface{}{"boolValue": t}
+	case int:
+		encoded = map[string]interface{}{"intValue": strconv.FormatInt(int64(t), 10)}
+	case int64:
+		encoded = map[string]interface{}{"intValue": strconv.FormatInt(t, 10)}
+	case uint64:
+		encoded = map[string]interface{}{"intValue": strconv.FormatUint(t, 10)}
+	default:
+		encoded = map[string]interface{}{"stringValue": fmt.Sprintf("%v", t)}
+	}
+
+	return map[string]interface{}{"key": key, "value": encoded}
+}
+
+// Default to the standard OTLP/HTTP traces path if only a host is
+// given.
+func normalizeEndpoint(endpoint string) (string, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", fmt.Errorf("Unsupported OTLP endpoint %v", endpoint)
+	}
+
+	if parsed.Path == "" || parsed.Path == "/" {
+		parsed.Path = "/v1/traces"
+	}
+	return parsed.String(), nil
+}
+
+func StartOTLPExporter(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	config_obj *config_proto.Config) error {
+
+	endpoint := config_obj.Monitoring.GetOtlpEndpoint()
+	if endpoint == "" {
+		return nil
+	}
+
+	endpoint, err := normalizeEndpoint(endpoint)
+	if err != nil {
+		return err
+	}
+
+	logger := logging.GetLogger(config_obj, &logging.FrontendComponent)
+	logger.Info("<green>Starting</> OTLP trace exporter to %v", endpoint)
+
+	e := &otlpExporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+
+	mu.Lock()
+	exporter = e
+	mu.Unlock()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			mu.Lock()
+			if exporter == e {
+				exporter = nil
+			}
+			mu.Unlock()
+
+			// Try to send any remaining spans on shutdown.
+			sub_ctx, cancel := context.WithTimeout(
+				context.Background(), 10*time.Second)
+			defer cancel()
+			_ = e.flush(sub_ctx)
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-time.After(EXPORT_PERIOD):
+				err := e.flush(ctx)
+				if err != nil {
+					logger.Debug("OTLP trace exporter: %v", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+Distributed tracing of collections.
+
+When a collection is scheduled the launcher starts a span and stores
+its W3C traceparent in the FlowRequest. The client echoes the
+traceparent back in the final FlowStats message, and the server then
+reconstructs spans for each query the client ran from the reported
+query stats. All spans are exported to an OTLP/HTTP collector so
+operators can see where the latency in a collection comes from
+(waiting in the queue, running on the client etc).
+
+Tracing is only enabled when Monitoring.otlp_endpoint is set.
+*/
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+const (
+	SPAN_KIND_INTERNAL = 1
+	SPAN_KIND_SERVER   = 2
+	SPAN_KIND_CLIENT   = 3
+)
+
+type SpanContext struct {
+	TraceId string
+	SpanId  string
+}
+
+func (self SpanContext) IsValid() bool {
+	return isHex(self.TraceId, 32) && isHex(self.SpanId, 16)
+}
+
+// Format as a W3C traceparent header value.
+func (self SpanContext) TraceParent() string {
+	if !self.IsValid() {
+		return ""
+	}
+	return "00-" + self.TraceId + "-" + self.SpanId + "-01"
+}
+
+func ParseTraceParent(trace_parent string) (SpanContext, bool) {
+	parts := strings.Split(trace_parent, "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return SpanContext{}, false
+	}
+
+	result := SpanContext{TraceId: parts[1], SpanId: parts[2]}
+	return result, result.IsValid()
+}
+
+type Span struct {
+	SpanContext
+
+	ParentSpanId string
+	Name         string
+	Kind         int
+	Start        time.Time
+	End          time.Time
+	Error        string
+
+	mu         sync.Mutex
+	attributes map[string]interface{}
+}
+
+// Start a new span. If the parent is not valid a new trace is
+// started.
+func StartSpan(name string, parent SpanContext) *Span {
+	result := &Span{
+		Name:  name,
+		Kind:  SPAN_KIND_INTERNAL,
+		Start: utils.GetTime().Now(),
+		SpanContext: SpanContext{
+			TraceId: parent.TraceId,
+			SpanId:  newId(8),
+		},
+		attributes: make(map[string]interface{}),
+	}
+
+	if parent.IsValid() {
+		result.ParentSpanId = parent.SpanId
+	} else {
+		result.TraceId = newId(16)
+	}
+
+	return result
+}
+
+// Attributes may be strings, bools or integers.
+func (self *Span) SetAttribute(key string, value interface{}) *Span {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.attributes[key] = value
+	return self
+}
+
+func (self *Span) SetError(err error) {
+	if err != nil {
+		self.Error = err.Error()
+	}
+}
+
+// Finish the span now and queue it for export.
+func (self *Span) Finish() {
+	self.End = utils.GetTime().Now()
+	Export(self)
+}
+
+func newId(length int) string {
+	buf := make([]byte, length)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// An all zero id is invalid according to the W3C spec.
+func isHex(value string, length int) bool {
+	if len(value) != length || strings.Trim(value, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+)
+
+func TestTraceParent(t *testing.T) {
+	span := StartSpan("Test", SpanContext{})
+	assert.True(t, span.IsValid())
+	assert.Equal(t, "", span.ParentSpanId)
+
+	parsed, ok := ParseTraceParent(span.TraceParent())
+	assert.True(t, ok)
+	assert.Equal(t, span.SpanContext, parsed)
+
+	// Children share the trace id.
+	child := StartSpan("Child", parsed)
+	assert.Equal(t, span.TraceId, child.TraceId)
+	assert.Equal(t, span.SpanId, child.ParentSpanId)
+	assert.NotEqual(t, span.SpanId, child.SpanId)
+
+	for _, invalid := range []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01",
+	} {
+		_, ok := ParseTraceParent(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestExportCollection(t *testing.T) {
+	e := &otlpExporter{}
+	mu.Lock()
+	exporter = e
+	mu.Unlock()
+
+	defer func() {
+		mu.Lock()
+		exporter = nil
+		mu.Unlock()
+	}()
+
+	launch := StartSpan("ScheduleArtifactCollection", SpanContext{})
+	ExportCollection(launch.TraceParent(), "C.123", "F.123",
+		[]*crypto_proto.VeloStatus{{
+			FirstActive:  1000000,
+			LastActive:   3000000,
+			ResultRows:   5,
+			QueryId:      0,
+			TotalQueries: 2,
+		}, {
+			Artifact:     "Generic.Client.Info",
+			FirstActive:  2000000,
+			LastActive:   4000000,
+			ErrorMessage: "Timeout",
+		}})
+
+	// Two queries and the collection span.
+	assert.Equal(t, 3, len(e.spans))
+
+	collection := e.spans[2]
+	assert.Equal(t, launch.TraceId, collection.TraceId)
+	assert.Equal(t, launch.SpanId, collection.ParentSpanId)
+	assert.Equal(t, int64(1), collection.Start.Unix())
+	assert.Equal(t, int64(4), collection.End.Unix())
+	assert.Equal(t, "Timeout", collection.Error)
+
+	assert.Equal(t, "Query 1/2", e.spans[0].Name)
+	assert.Equal(t, "Generic.Client.Info", e.spans[1].Name)
+	for _, query := range e.spans[:2] {
+		assert.Equal(t, collection.SpanId, query.ParentSpanId)
+	}
+
+	encoded := encodeSpans(e.spans)
+	spans := encoded["resourceSpans"].([]interface{})[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]map[string]interface{})
+	assert.Equal(t, "2000000000", spans[1]["startTimeUnixNano"])
+	assert.Equal(t, map[string]interface{}{
+		"code": 2, "message": "Timeout"}, spans[1]["status"])
+
+	// No trace parent means no spans.
+	e.spans = nil
+	ExportCollection("", "C.123", "F.123", []*crypto_proto.VeloStatus{{}})
+	assert.Equal(t, 0, len(e.spans))
+}
@@ -0,0 +1,164 @@
+/*
+  Usage accounting for shared deployments.
+
+  Each frontend counts the bytes it receives from clients, the result
+  rows it stores and the API calls it serves, broken down by org and
+  by client label. The frontend service periodically drains these
+  counters into the Server.Monitor.Usage artifact of each org, so
+  usage reports can be produced over any time range for chargeback.
+
+  Counters with an empty label are the totals for the org. A client
+  with several labels is counted against each of them.
+*/
+
+package usage
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	bytesIngestedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "usage_bytes_ingested",
+		Help: "Total bytes received from clients by org.",
+	}, []string{"org"})
+
+	rowsStoredCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "usage_rows_stored",
+		Help: "Total result rows stored by org.",
+	}, []string{"org"})
+
+	apiCallsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "usage_api_calls",
+		Help: "Total API calls served by org.",
+	}, []string{"org"})
+
+	tracker = NewTracker()
+)
+
+type Counters struct {
+	BytesIngested int64 `json:"BytesIngested"`
+	RowsStored    int64 `json:"RowsStored"`
+	ApiCalls      int64 `json:"ApiCalls"`
+}
+
+func (self *Counters) add(other *Counters) {
+	self.BytesIngested += other.BytesIngested
+	self.RowsStored += other.RowsStored
+	self.ApiCalls += other.ApiCalls
+}
+
+func (self *Counters) IsZero() bool {
+	return self.BytesIngested == 0 && self.RowsStored == 0 &&
+		self.ApiCalls == 0
+}
+
+type Usage struct {
+	OrgId string
+	Label string
+	Counters
+}
+
+type key struct {
+	org_id, label string
+}
+
+type Tracker struct {
+	mu       sync.Mutex
+	counters map[key]*Counters
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		counters: make(map[key]*Counters),
+	}
+}
+
+// Add the counters to the org total and to each label.
+func (self *Tracker) Add(org_id string, labels []string, counters *Counters) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.addLocked(key{org_id: org_id}, counters)
+	for _, label := range labels {
+		if label != "" {
+			self.addLocked(key{org_id: org_id, label: label}, counters)
+		}
+	}
+}
+
+func (self *Tracker) addLocked(k key, counters *Counters) {
+	existing, pres := self.counters[k]
+	if !pres {
+		existing = &Counters{}
+		self.counters[k] = existing
+	}
+	existing.add(counters)
+}
+
+// Return the usage accumulated since the last call and reset the
+// counters. Sorted by org then label.
+func (self *Tracker) Drain() []*Usage {
+	self.mu.Lock()
+	counters := self.counters
+	self.counters = make(map[key]*Counters)
+	self.mu.Unlock()
+
+	result := make([]*Usage, 0, len(counters))
+	for k, v := range counters {
+		if v.IsZero() {
+			continue
+		}
+		result = append(result, &Usage{
+			OrgId:    k.org_id,
+			Label:    k.label,
+			Counters: *v,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].OrgId != result[j].OrgId {
+			return result[i].OrgId < result[j].OrgId
+		}
+		return result[i].Label < result[j].Label
+	})
+
+	return result
+}
+
+// Put back usage which could not be reported so it is reported
+// next time.
+func (self *Tracker) Restore(usage *Usage) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.addLocked(key{org_id: usage.OrgId, label: usage.Label},
+		&usage.Counters)
+}
+
+func AddBytesIngested(org_id string, labels []string, n int64) {
+	bytesIngestedCounter.WithLabelValues(org_id).Add(float64(n))
+	tracker.Add(org_id, labels, &Counters{BytesIngested: n})
+}
+
+func AddRowsStored(org_id string, labels []string, n int64) {
+	rowsStoredCounter.WithLabelValues(org_id).Add(float64(n))
+	tracker.Add(org_id, labels, &Counters{RowsStored: n})
+}
+
+func AddApiCall(org_id string) {
+	apiCallsCounter.WithLabelValues(org_id).Inc()
+	tracker.Add(org_id, nil, &Counters{ApiCalls: 1})
+}
+
+func Drain() []*Usage {
+	return tracker.Drain()
+}
+
+func Restore(usage *Usage) {
+	tracker.Restore(usage)
+}
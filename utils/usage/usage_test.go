@@ -0,0 +1,43 @@
+package usage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker()
+	tracker.Add("O123", []string{"Finance", ""}, &Counters{BytesIngested: 100})
+	tracker.Add("O123", []string{"Finance", "Servers"}, &Counters{RowsStored: 5})
+	tracker.Add("root", nil, &Counters{ApiCalls: 1})
+
+	usage := tracker.Drain()
+	assert.Equal(t, 4, len(usage))
+
+	// The org total includes everything.
+	assert.Equal(t, "O123", usage[0].OrgId)
+	assert.Equal(t, "", usage[0].Label)
+	assert.Equal(t, int64(100), usage[0].BytesIngested)
+	assert.Equal(t, int64(5), usage[0].RowsStored)
+
+	assert.Equal(t, "Finance", usage[1].Label)
+	assert.Equal(t, int64(100), usage[1].BytesIngested)
+	assert.Equal(t, int64(5), usage[1].RowsStored)
+
+	assert.Equal(t, "Servers", usage[2].Label)
+	assert.Equal(t, int64(0), usage[2].BytesIngested)
+
+	assert.Equal(t, "root", usage[3].OrgId)
+	assert.Equal(t, int64(1), usage[3].ApiCalls)
+
+	// Draining resets the counters.
+	assert.Equal(t, 0, len(tracker.Drain()))
+
+	// Restored usage is reported again.
+	tracker.Restore(usage[3])
+	tracker.Add("root", nil, &Counters{ApiCalls: 1})
+	usage = tracker.Drain()
+	assert.Equal(t, 1, len(usage))
+	assert.Equal(t, int64(2), usage[0].ApiCalls)
+}
@@ -0,0 +1,319 @@
+package wasm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A decoded instruction. Function bodies are decoded once when the
+// module is loaded so the interpreter does not need to parse
+// immediates or search for the end of blocks.
+type instr struct {
+	op uint16
+
+	// The main immediate: an index, a constant, a memory offset or
+	// for blocks the number of params (high 32 bits) and results
+	// (low 32 bits).
+	a uint64
+
+	// For block, loop, if and else: the index of the matching end.
+	b uint32
+
+	// For if: the index of the matching else or 0 if there is none.
+	c uint32
+
+	// The label depths of br_table.
+	table []uint32
+}
+
+const (
+	opUnreachable  = 0x00
+	opNop          = 0x01
+	opBlock        = 0x02
+	opLoop         = 0x03
+	opIf           = 0x04
+	opElse         = 0x05
+	opEnd          = 0x0b
+	opBr           = 0x0c
+	opBrIf         = 0x0d
+	opBrTable      = 0x0e
+	opReturn       = 0x0f
+	opCall         = 0x10
+	opCallIndirect = 0x11
+	opDrop         = 0x1a
+	opSelect       = 0x1b
+	opSelectTyped  = 0x1c
+	opLocalGet     = 0x20
+	opLocalSet     = 0x21
+	opLocalTee     = 0x22
+	opGlobalGet    = 0x23
+	opGlobalSet    = 0x24
+	opMemorySize   = 0x3f
+	opMemoryGrow   = 0x40
+	opI32Const     = 0x41
+	opI64Const     = 0x42
+	opF32Const     = 0x43
+	opF64Const     = 0x44
+
+	// Prefixed instructions are stored as 0xfc00 | sub opcode.
+	opPrefix     = 0xfc
+	opMemoryCopy = 0xfc0a
+	opMemoryFill = 0xfc0b
+)
+
+func (self *Module) blockType(r *reader) (uint64, error) {
+	b, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch b {
+	case 0x40:
+		return 0, nil
+	case byte(I32), byte(I64), byte(F32), byte(F64):
+		return 1, nil
+	}
+
+	// Otherwise this is a type index encoded as a signed LEB128.
+	r.pos--
+	idx, err := r.readS64(33)
+	if err != nil {
+		return 0, err
+	}
+
+	if idx < 0 || int(idx) >= len(self.types) {
+		return 0, errors.New("wasm: invalid block type")
+	}
+
+	t := self.types[idx]
+	return uint64(len(t.Params))<<32 | uint64(len(t.Results)), nil
+}
+
+// Decode the instructions of a function body and resolve the
+// targets of all blocks.
+func (self *Module) compile(fn *function, r *reader) ([]instr, error) {
+	fn_type := self.types[fn.typeIdx]
+	num_locals := uint64(len(fn_type.Params) + len(fn.locals))
+
+	var code []instr
+
+	// Indexes of the currently open block, loop and if
+	// instructions.
+	var blocks []int
+
+	for {
+		if r.eof() {
+			return nil, errUnexpectedEOF
+		}
+
+		b, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+
+		in := instr{op: uint16(b)}
+
+		switch b {
+		case opUnreachable, opNop, opReturn, opDrop, opSelect:
+
+		case opBlock, opLoop, opIf:
+			in.a, err = self.blockType(r)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, len(code))
+
+		case opElse:
+			if len(blocks) == 0 || code[blocks[len(blocks)-1]].op != opIf ||
+				code[blocks[len(blocks)-1]].c != 0 {
+				return nil, errors.New("wasm: unexpected else")
+			}
+			code[blocks[len(blocks)-1]].c = uint32(len(code))
+
+		case opEnd:
+			// The end of the function body.
+			if len(blocks) == 0 {
+				if !r.eof() {
+					return nil, errors.New("wasm: data after end of function")
+				}
+				return append(code, in), nil
+			}
+
+			start := blocks[len(blocks)-1]
+			blocks = blocks[:len(blocks)-1]
+
+			code[start].b = uint32(len(code))
+			if code[start].c != 0 {
+				code[code[start].c].b = uint32(len(code))
+			}
+
+		case opBr, opBrIf:
+			in.a, err = readIndex(r, uint64(len(blocks))+1)
+			if err != nil {
+				return nil, err
+			}
+
+		case opBrTable:
+			n, err := r.readCount()
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < n; i++ {
+				depth, err := readIndex(r, uint64(len(blocks))+1)
+				if err != nil {
+					return nil, err
+				}
+				in.table = append(in.table, uint32(depth))
+			}
+			in.a, err = readIndex(r, uint64(len(blocks))+1)
+			if err != nil {
+				return nil, err
+			}
+
+		case opCall:
+			in.a, err = readIndex(r, uint64(self.numFunctions()))
+			if err != nil {
+				return nil, err
+			}
+
+		case opCallIndirect:
+			in.a, err = readIndex(r, uint64(len(self.types)))
+			if err != nil {
+				return nil, err
+			}
+			table, err := r.readByte()
+			if err != nil {
+				return nil, err
+			}
+			if table != 0 || self.table == nil {
+				return nil, errors.New("wasm: invalid table")
+			}
+
+		case opSelectTyped:
+			_, err = readValueTypes(r)
+			if err != nil {
+				return nil, err
+			}
+			in.op = opSelect
+
+		case opLocalGet, opLocalSet, opLocalTee:
+			in.a, err = readIndex(r, num_locals)
+			if err != nil {
+				return nil, err
+			}
+
+		case opGlobalGet, opGlobalSet:
+			in.a, err = readIndex(r, uint64(len(self.globals)))
+			if err != nil {
+				return nil, err
+			}
+			if b == opGlobalSet && !self.globals[in.a].mutable {
+				return nil, errors.New("wasm: global is immutable")
+			}
+
+		case opMemorySize, opMemoryGrow:
+			if self.memory == nil {
+				return nil, errors.New("wasm: no memory defined")
+			}
+			_, err = r.readByte()
+			if err != nil {
+				return nil, err
+			}
+
+		case opI32Const:
+			v, err := r.readS32()
+			if err != nil {
+				return nil, err
+			}
+			in.a = uint64(uint32(v))
+
+		case opI64Const:
+			v, err := r.readS64(64)
+			if err != nil {
+				return nil, err
+			}
+			in.a = uint64(v)
+
+		case opF32Const:
+			v, err := r.readU32Fixed()
+			if err != nil {
+				return nil, err
+			}
+			in.a = uint64(v)
+
+		case opF64Const:
+			in.a, err = r.readU64Fixed()
+			if err != nil {
+				return nil, err
+			}
+
+		case opPrefix:
+			sub, err := r.readU32()
+			if err != nil {
+				return nil, err
+			}
+			in.op = opPrefix<<8 | uint16(sub)
+
+			switch {
+			case sub <= 7:
+				// Saturating truncation.
+
+			case in.op == opMemoryCopy, in.op == opMemoryFill:
+				if self.memory == nil {
+					return nil, errors.New("wasm: no memory defined")
+				}
+				reserved := 1
+				if in.op == opMemoryCopy {
+					reserved = 2
+				}
+				_, err = r.readBytes(reserved)
+				if err != nil {
+					return nil, err
+				}
+
+			default:
+				return nil, fmt.Errorf("wasm: unsupported instruction 0xfc %d", sub)
+			}
+
+		default:
+			switch {
+			// Loads and stores
+			case b >= 0x28 && b <= 0x3e:
+				if self.memory == nil {
+					return nil, errors.New("wasm: no memory defined")
+				}
+
+				// The alignment is only a hint.
+				_, err = r.readU32()
+				if err != nil {
+					return nil, err
+				}
+
+				offset, err := r.readU32()
+				if err != nil {
+					return nil, err
+				}
+				in.a = uint64(offset)
+
+			// Numeric instructions have no immediates.
+			case b >= 0x45 && b <= 0xc4:
+
+			default:
+				return nil, fmt.Errorf("wasm: unsupported instruction 0x%x", b)
+			}
+		}
+
+		code = append(code, in)
+	}
+}
+
+func readIndex(r *reader, limit uint64) (uint64, error) {
+	idx, err := r.readU32()
+	if err != nil {
+		return 0, err
+	}
+	if uint64(idx) >= limit {
+		return 0, fmt.Errorf("wasm: index %d out of range", idx)
+	}
+	return uint64(idx), nil
+}
@@ -0,0 +1,242 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+var (
+	ErrFuelExhausted = errors.New("wasm: instruction limit exceeded")
+)
+
+// A function provided by the host to the module.
+type HostFunction struct {
+	Type FuncType
+	Call func(instance *Instance, args []uint64) ([]uint64, error)
+}
+
+type Config struct {
+	// Host functions keyed by "module.name". A module importing
+	// anything else can not be instantiated.
+	Imports map[string]*HostFunction
+
+	// The maximum size of memory in pages (default 256 = 16MB).
+	MaxMemoryPages uint32
+
+	// The maximum number of instructions the instance may execute
+	// over its lifetime (default 1e9).
+	Fuel int64
+
+	// The maximum depth of nested calls (default 256).
+	MaxCallDepth int
+
+	// The maximum number of values on a function's stack (default
+	// 65536).
+	MaxStack int
+}
+
+// A trap aborts execution of the module.
+type Trap struct {
+	Message string
+}
+
+func (self Trap) Error() string {
+	return "wasm: trap: " + self.Message
+}
+
+func trap(format string, args ...interface{}) {
+	panic(Trap{Message: fmt.Sprintf(format, args...)})
+}
+
+// An instantiated module.
+type Instance struct {
+	module  *Module
+	config  Config
+	ctx     context.Context
+	host    []*HostFunction
+	memory  []byte
+	maxPage uint32
+	globals []uint64
+	table   []int64
+	fuel    int64
+	depth   int
+}
+
+func Instantiate(ctx context.Context,
+	module *Module, config Config) (*Instance, error) {
+
+	if config.MaxMemoryPages == 0 {
+		config.MaxMemoryPages = 256
+	}
+
+	if config.Fuel == 0 {
+		config.Fuel = 1000000000
+	}
+
+	if config.MaxCallDepth == 0 {
+		config.MaxCallDepth = 256
+	}
+
+	if config.MaxStack == 0 {
+		config.MaxStack = 65536
+	}
+
+	self := &Instance{
+		module: module,
+		config: config,
+		ctx:    ctx,
+		fuel:   config.Fuel,
+	}
+
+	for _, imp := range module.imports {
+		name := imp.module + "." + imp.name
+		host, pres := config.Imports[name]
+		if !pres {
+			return nil, fmt.Errorf("wasm: unknown import %v", name)
+		}
+
+		if !host.Type.Equal(module.types[imp.typeIdx]) {
+			return nil, fmt.Errorf("wasm: import %v has type %v, expected %v",
+				name, module.types[imp.typeIdx], host.Type)
+		}
+		self.host = append(self.host, host)
+	}
+
+	if module.memory != nil {
+		self.maxPage = config.MaxMemoryPages
+		if module.memory.hasMax && module.memory.max < self.maxPage {
+			self.maxPage = module.memory.max
+		}
+
+		if module.memory.min > self.maxPage {
+			return nil, fmt.Errorf("wasm: module requires %d memory pages, limit is %d",
+				module.memory.min, self.maxPage)
+		}
+		self.memory = make([]byte, int(module.memory.min)*PageSize)
+	}
+
+	for _, g := range module.globals {
+		self.globals = append(self.globals, g.init)
+	}
+
+	if module.table != nil {
+		self.table = make([]int64, module.table.min)
+		for i := range self.table {
+			self.table[i] = -1
+		}
+	}
+
+	for _, segment := range module.elements {
+		if uint64(segment.offset)+uint64(len(segment.funcs)) >
+			uint64(len(self.table)) {
+			return nil, errors.New("wasm: element segment out of bounds")
+		}
+
+		for i, idx := range segment.funcs {
+			self.table[int(segment.offset)+i] = int64(idx)
+		}
+	}
+
+	for _, segment := range module.data {
+		if uint64(segment.offset)+uint64(len(segment.data)) >
+			uint64(len(self.memory)) {
+			return nil, errors.New("wasm: data segment out of bounds")
+		}
+		copy(self.memory[segment.offset:], segment.data)
+	}
+
+	if module.start >= 0 {
+		err := self.runStart()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return self, nil
+}
+
+func (self *Instance) runStart() (err error) {
+	defer recoverTrap(&err)
+
+	self.call(uint32(self.module.start), nil)
+	return nil
+}
+
+// Convert a panic in the interpreter into an error. Invalid code
+// may also cause runtime errors (e.g. stack underflow) which are
+// reported as traps as well.
+func recoverTrap(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	switch t := r.(type) {
+	case Trap:
+		*err = t
+	case runtime.Error:
+		*err = Trap{Message: t.Error()}
+	case error:
+		*err = t
+	default:
+		*err = Trap{Message: fmt.Sprintf("%v", r)}
+	}
+}
+
+// Call an exported function.
+func (self *Instance) Call(name string, args ...uint64) (result []uint64, err error) {
+	exp, pres := self.module.exports[name]
+	if !pres || exp.kind != externalFunction {
+		return nil, fmt.Errorf("wasm: function %v is not exported", name)
+	}
+
+	fn_type := self.module.functionType(exp.index)
+	if len(args) != len(fn_type.Params) {
+		return nil, fmt.Errorf("wasm: function %v takes %d arguments",
+			name, len(fn_type.Params))
+	}
+
+	defer recoverTrap(&err)
+
+	self.depth = 0
+	result = self.call(exp.index, args)
+	return append([]uint64{}, result...), nil
+}
+
+// Returns true if the module exports a function of this type.
+func (self *Instance) HasFunction(name string, fn_type FuncType) bool {
+	exp, pres := self.module.exports[name]
+	return pres && exp.kind == externalFunction &&
+		self.module.functionType(exp.index).Equal(fn_type)
+}
+
+// The linear memory of the instance. The slice is invalidated when
+// the memory grows.
+func (self *Instance) Memory() []byte {
+	return self.memory
+}
+
+// Copy a range of memory out of the instance.
+func (self *Instance) Read(ptr, length uint32) ([]byte, error) {
+	end := uint64(ptr) + uint64(length)
+	if end > uint64(len(self.memory)) {
+		return nil, errors.New("wasm: read out of bounds")
+	}
+
+	result := make([]byte, length)
+	copy(result, self.memory[ptr:end])
+	return result, nil
+}
+
+// Copy data into the memory of the instance.
+func (self *Instance) Write(ptr uint32, data []byte) error {
+	end := uint64(ptr) + uint64(len(data))
+	if end > uint64(len(self.memory)) {
+		return errors.New("wasm: write out of bounds")
+	}
+
+	copy(self.memory[ptr:end], data)
+	return nil
+}
@@ -0,0 +1,860 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+)
+
+// A branch target.
+type label struct {
+	// The instruction to continue at.
+	cont int
+
+	// The stack height when the block was entered.
+	height int
+
+	// The number of values carried by a branch to this label.
+	arity int
+
+	// Branches to a loop do not leave it.
+	loop bool
+}
+
+// The state of a single function invocation.
+type frame struct {
+	instance *Instance
+	stack    []uint64
+	labels   []label
+	locals   []uint64
+}
+
+func (self *frame) push(v uint64) {
+	self.stack = append(self.stack, v)
+}
+
+func (self *frame) pop() uint64 {
+	n := len(self.stack) - 1
+	v := self.stack[n]
+	self.stack = self.stack[:n]
+	return v
+}
+
+func (self *frame) pushBool(v bool) {
+	if v {
+		self.push(1)
+	} else {
+		self.push(0)
+	}
+}
+
+func (self *frame) pushI32(v uint32) {
+	self.push(uint64(v))
+}
+
+func (self *frame) popI32() uint32 {
+	return uint32(self.pop())
+}
+
+func (self *frame) pushF32(v float32) {
+	self.push(uint64(math.Float32bits(v)))
+}
+
+func (self *frame) popF32() float32 {
+	return math.Float32frombits(uint32(self.pop()))
+}
+
+func (self *frame) pushF64(v float64) {
+	self.push(math.Float64bits(v))
+}
+
+func (self *frame) popF64() float64 {
+	return math.Float64frombits(self.pop())
+}
+
+// Take the branch to the label at this depth and return the
+// instruction to continue at.
+func (self *frame) branch(depth uint64) int {
+	idx := len(self.labels) - 1 - int(depth)
+	l := self.labels[idx]
+
+	n := len(self.stack)
+	copy(self.stack[l.height:], self.stack[n-l.arity:n])
+	self.stack = self.stack[:l.height+l.arity]
+
+	if l.loop {
+		self.labels = self.labels[:idx+1]
+	} else {
+		self.labels = self.labels[:idx]
+	}
+	return l.cont
+}
+
+func (self *Instance) call(idx uint32, args []uint64) []uint64 {
+	if int(idx) < len(self.host) {
+		result, err := self.host[idx].Call(self, args)
+		if err != nil {
+			panic(err)
+		}
+		return result
+	}
+
+	self.depth++
+	defer func() {
+		self.depth--
+	}()
+
+	if self.depth > self.config.MaxCallDepth {
+		trap("call stack exhausted")
+	}
+
+	fn := self.module.functions[int(idx)-len(self.host)]
+	fn_type := self.module.types[fn.typeIdx]
+
+	f := &frame{
+		instance: self,
+		locals:   make([]uint64, len(fn_type.Params)+len(fn.locals)),
+	}
+	copy(f.locals, args)
+
+	return f.execute(fn, fn_type)
+}
+
+// Pop the arguments for a call off the stack.
+func (self *frame) args(fn_type FuncType) []uint64 {
+	n := len(fn_type.Params)
+	args := make([]uint64, n)
+	copy(args, self.stack[len(self.stack)-n:])
+	self.stack = self.stack[:len(self.stack)-n]
+	return args
+}
+
+// Calculate the effective address of a memory access.
+func (self *frame) address(offset uint64, size uint64) uint64 {
+	ea := uint64(self.popI32()) + offset
+	if ea+size > uint64(len(self.instance.memory)) {
+		trap("out of bounds memory access")
+	}
+	return ea
+}
+
+func (self *frame) execute(fn *function, fn_type FuncType) []uint64 {
+	instance := self.instance
+	code := fn.code
+
+	// The function body is a block whose end returns.
+	self.labels = append(self.labels, label{
+		cont: len(code), arity: len(fn_type.Results)})
+
+	pc := 0
+	for pc < len(code) {
+		in := &code[pc]
+
+		instance.fuel--
+		if instance.fuel < 0 {
+			panic(ErrFuelExhausted)
+		}
+
+		if instance.fuel&0xffff == 0 && instance.ctx != nil {
+			select {
+			case <-instance.ctx.Done():
+				panic(instance.ctx.Err())
+			default:
+			}
+		}
+
+		if len(self.stack) > instance.config.MaxStack {
+			trap("value stack exhausted")
+		}
+
+		switch in.op {
+		case opUnreachable:
+			trap("unreachable")
+
+		case opNop:
+
+		case opBlock:
+			params := int(in.a >> 32)
+			self.labels = append(self.labels, label{
+				cont:   int(in.b) + 1,
+				height: len(self.stack) - params,
+				arity:  int(in.a & 0xffffffff),
+			})
+
+		case opLoop:
+			params := int(in.a >> 32)
+			self.labels = append(self.labels, label{
+				cont:   pc + 1,
+				height: len(self.stack) - params,
+				arity:  params,
+				loop:   true,
+			})
+
+		case opIf:
+			cond := self.popI32()
+			params := int(in.a >> 32)
+			l := label{
+				cont:   int(in.b) + 1,
+				height: len(self.stack) - params,
+				arity:  int(in.a & 0xffffffff),
+			}
+
+			if cond == 0 {
+				if in.c == 0 {
+					// No else branch - skip the whole block.
+					pc = int(in.b) + 1
+					continue
+				}
+				self.labels = append(self.labels, l)
+				pc = int(in.c) + 1
+				continue
+			}
+			self.labels = append(self.labels, l)
+
+		case opElse:
+			// The end of the then branch.
+			self.labels = self.labels[:len(self.labels)-1]
+			pc = int(in.b) + 1
+			continue
+
+		case opEnd:
+			self.labels = self.labels[:len(self.labels)-1]
+
+		case opBr:
+			pc = self.branch(in.a)
+			continue
+
+		case opBrIf:
+			if self.popI32() != 0 {
+				pc = self.branch(in.a)
+				continue
+			}
+
+		case opBrTable:
+			idx := self.popI32()
+			depth := in.a
+			if uint64(idx) < uint64(len(in.table)) {
+				depth = uint64(in.table[idx])
+			}
+			pc = self.branch(depth)
+			continue
+
+		case opReturn:
+			return self.stack[len(self.stack)-len(fn_type.Results):]
+
+		case opCall:
+			args := self.args(instance.module.functionType(uint32(in.a)))
+			self.stack = append(self.stack, instance.call(uint32(in.a), args)...)
+
+		case opCallIndirect:
+			idx := self.popI32()
+			if uint64(idx) >= uint64(len(instance.table)) {
+				trap("undefined element")
+			}
+
+			target := instance.table[idx]
+			if target < 0 {
+				trap("uninitialized element")
+			}
+
+			expected := instance.module.types[in.a]
+			if !instance.module.functionType(uint32(target)).Equal(expected) {
+				trap("indirect call type mismatch")
+			}
+
+			args := self.args(expected)
+			self.stack = append(self.stack, instance.call(uint32(target), args)...)
+
+		case opDrop:
+			self.pop()
+
+		case opSelect:
+			cond := self.popI32()
+			b := self.pop()
+			a := self.pop()
+			if cond != 0 {
+				self.push(a)
+			} else {
+				self.push(b)
+			}
+
+		case opLocalGet:
+			self.push(self.locals[in.a])
+
+		case opLocalSet:
+			self.locals[in.a] = self.pop()
+
+		case opLocalTee:
+			self.locals[in.a] = self.stack[len(self.stack)-1]
+
+		case opGlobalGet:
+			self.push(instance.globals[in.a])
+
+		case opGlobalSet:
+			instance.globals[in.a] = self.pop()
+
+		case opMemorySize:
+			self.pushI32(uint32(len(instance.memory) / PageSize))
+
+		case opMemoryGrow:
+			delta := uint64(self.popI32())
+			pages := uint64(len(instance.memory) / PageSize)
+			if pages+delta > uint64(instance.maxPage) {
+				self.pushI32(0xffffffff)
+				break
+			}
+			instance.memory = append(instance.memory,
+				make([]byte, delta*PageSize)...)
+			self.pushI32(uint32(pages))
+
+		case opI32Const, opI64Const, opF32Const, opF64Const:
+			self.push(in.a)
+
+		case opMemoryCopy:
+			n := uint64(self.popI32())
+			src := uint64(self.popI32())
+			dst := uint64(self.popI32())
+			size := uint64(len(instance.memory))
+			if src+n > size || dst+n > size {
+				trap("out of bounds memory access")
+			}
+			copy(instance.memory[dst:dst+n], instance.memory[src:src+n])
+
+		case opMemoryFill:
+			n := uint64(self.popI32())
+			value := byte(self.popI32())
+			dst := uint64(self.popI32())
+			if dst+n > uint64(len(instance.memory)) {
+				trap("out of bounds memory access")
+			}
+			mem := instance.memory[dst : dst+n]
+			for i := range mem {
+				mem[i] = value
+			}
+
+		default:
+			switch {
+			case in.op >= 0x28 && in.op <= 0x3e:
+				self.memoryOp(in)
+			case in.op >= opPrefix<<8:
+				self.truncSat(in.op & 0xff)
+			default:
+				self.numeric(in.op)
+			}
+		}
+
+		pc++
+	}
+
+	return self.stack[len(self.stack)-len(fn_type.Results):]
+}
+
+func (self *frame) memoryOp(in *instr) {
+	mem := self.instance.memory
+
+	switch in.op {
+	// Loads
+	case 0x28: // i32.load
+		ea := self.address(in.a, 4)
+		self.pushI32(binary.LittleEndian.Uint32(mem[ea:]))
+	case 0x29: // i64.load
+		ea := self.address(in.a, 8)
+		self.push(binary.LittleEndian.Uint64(mem[ea:]))
+	case 0x2a: // f32.load
+		ea := self.address(in.a, 4)
+		self.pushI32(binary.LittleEndian.Uint32(mem[ea:]))
+	case 0x2b: // f64.load
+		ea := self.address(in.a, 8)
+		self.push(binary.LittleEndian.Uint64(mem[ea:]))
+	case 0x2c: // i32.load8_s
+		ea := self.address(in.a, 1)
+		self.pushI32(uint32(int32(int8(mem[ea]))))
+	case 0x2d: // i32.load8_u
+		ea := self.address(in.a, 1)
+		self.pushI32(uint32(mem[ea]))
+	case 0x2e: // i32.load16_s
+		ea := self.address(in.a, 2)
+		self.pushI32(uint32(int32(int16(binary.LittleEndian.Uint16(mem[ea:])))))
+	case 0x2f: // i32.load16_u
+		ea := self.address(in.a, 2)
+		self.pushI32(uint32(binary.LittleEndian.Uint16(mem[ea:])))
+	case 0x30: // i64.load8_s
+		ea := self.address(in.a, 1)
+		self.push(uint64(int64(int8(mem[ea]))))
+	case 0x31: // i64.load8_u
+		ea := self.address(in.a, 1)
+		self.push(uint64(mem[ea]))
+	case 0x32: // i64.load16_s
+		ea := self.address(in.a, 2)
+		self.push(uint64(int64(int16(binary.LittleEndian.Uint16(mem[ea:])))))
+	case 0x33: // i64.load16_u
+		ea := self.address(in.a, 2)
+		self.push(uint64(binary.LittleEndian.Uint16(mem[ea:])))
+	case 0x34: // i64.load32_s
+		ea := self.address(in.a, 4)
+		self.push(uint64(int64(int32(binary.LittleEndian.Uint32(mem[ea:])))))
+	case 0x35: // i64.load32_u
+		ea := self.address(in.a, 4)
+		self.push(uint64(binary.LittleEndian.Uint32(mem[ea:])))
+
+	// Stores
+	case 0x36, 0x38: // i32.store, f32.store
+		v := self.popI32()
+		ea := self.address(in.a, 4)
+		binary.LittleEndian.PutUint32(mem[ea:], v)
+	case 0x37, 0x39: // i64.store, f64.store
+		v := self.pop()
+		ea := self.address(in.a, 8)
+		binary.LittleEndian.PutUint64(mem[ea:], v)
+	case 0x3a, 0x3c: // i32.store8, i64.store8
+		v := self.pop()
+		ea := self.address(in.a, 1)
+		mem[ea] = byte(v)
+	case 0x3b, 0x3d: // i32.store16, i64.store16
+		v := self.pop()
+		ea := self.address(in.a, 2)
+		binary.LittleEndian.PutUint16(mem[ea:], uint16(v))
+	case 0x3e: // i64.store32
+		v := self.pop()
+		ea := self.address(in.a, 4)
+		binary.LittleEndian.PutUint32(mem[ea:], uint32(v))
+	}
+}
+
+func (self *frame) numeric(op uint16) {
+	switch op {
+	// i32 comparisons
+	case 0x45:
+		self.pushBool(self.popI32() == 0)
+	case 0x46, 0x47, 0x48, 0x49, 0x4a, 0x4b, 0x4c, 0x4d, 0x4e, 0x4f:
+		b := self.popI32()
+		a := self.popI32()
+		self.pushBool(compareI32(op, a, b))
+
+	// i64 comparisons
+	case 0x50:
+		self.pushBool(self.pop() == 0)
+	case 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5a:
+		b := self.pop()
+		a := self.pop()
+		self.pushBool(compareI64(op, a, b))
+
+	// f32 comparisons
+	case 0x5b, 0x5c, 0x5d, 0x5e, 0x5f, 0x60:
+		b := float64(self.popF32())
+		a := float64(self.popF32())
+		self.pushBool(compareFloat(op-0x5b, a, b))
+
+	// f64 comparisons
+	case 0x61, 0x62, 0x63, 0x64, 0x65, 0x66:
+		b := self.popF64()
+		a := self.popF64()
+		self.pushBool(compareFloat(op-0x61, a, b))
+
+	// i32 arithmetic
+	case 0x67:
+		self.pushI32(uint32(bits.LeadingZeros32(self.popI32())))
+	case 0x68:
+		self.pushI32(uint32(bits.TrailingZeros32(self.popI32())))
+	case 0x69:
+		self.pushI32(uint32(bits.OnesCount32(self.popI32())))
+	case 0x6a, 0x6b, 0x6c, 0x6d, 0x6e, 0x6f, 0x70, 0x71, 0x72, 0x73,
+		0x74, 0x75, 0x76, 0x77, 0x78:
+		b := self.popI32()
+		a := self.popI32()
+		self.pushI32(arithI32(op, a, b))
+
+	// i64 arithmetic
+	case 0x79:
+		self.push(uint64(bits.LeadingZeros64(self.pop())))
+	case 0x7a:
+		self.push(uint64(bits.TrailingZeros64(self.pop())))
+	case 0x7b:
+		self.push(uint64(bits.OnesCount64(self.pop())))
+	case 0x7c, 0x7d, 0x7e, 0x7f, 0x80, 0x81, 0x82, 0x83, 0x84, 0x85,
+		0x86, 0x87, 0x88, 0x89, 0x8a:
+		b := self.pop()
+		a := self.pop()
+		self.push(arithI64(op, a, b))
+
+	// f32 arithmetic
+	case 0x8b, 0x8c, 0x8d, 0x8e, 0x8f, 0x90, 0x91:
+		self.pushF32(float32(unaryFloat(op-0x8b, float64(self.popF32()))))
+	case 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98:
+		b := self.popF32()
+		a := self.popF32()
+		self.pushF32(binaryF32(op-0x92, a, b))
+
+	// f64 arithmetic
+	case 0x99, 0x9a, 0x9b, 0x9c, 0x9d, 0x9e, 0x9f:
+		self.pushF64(unaryFloat(op-0x99, self.popF64()))
+	case 0xa0, 0xa1, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6:
+		b := self.popF64()
+		a := self.popF64()
+		self.pushF64(binaryF64(op-0xa0, a, b))
+
+	// Conversions
+	case 0xa7: // i32.wrap_i64
+		self.pushI32(uint32(self.pop()))
+	case 0xa8: // i32.trunc_f32_s
+		self.pushI32(uint32(int32(truncSigned(float64(self.popF32()), 32))))
+	case 0xa9: // i32.trunc_f32_u
+		self.pushI32(uint32(truncUnsigned(float64(self.popF32()), 32)))
+	case 0xaa: // i32.trunc_f64_s
+		self.pushI32(uint32(int32(truncSigned(self.popF64(), 32))))
+	case 0xab: // i32.trunc_f64_u
+		self.pushI32(uint32(truncUnsigned(self.popF64(), 32)))
+	case 0xac: // i64.extend_i32_s
+		self.push(uint64(int64(int32(self.popI32()))))
+	case 0xad: // i64.extend_i32_u
+		self.push(uint64(self.popI32()))
+	case 0xae: // i64.trunc_f32_s
+		self.push(uint64(truncSigned(float64(self.popF32()), 64)))
+	case 0xaf: // i64.trunc_f32_u
+		self.push(truncUnsigned(float64(self.popF32()), 64))
+	case 0xb0: // i64.trunc_f64_s
+		self.push(uint64(truncSigned(self.popF64(), 64)))
+	case 0xb1: // i64.trunc_f64_u
+		self.push(truncUnsigned(self.popF64(), 64))
+	case 0xb2: // f32.convert_i32_s
+		self.pushF32(float32(int32(self.popI32())))
+	case 0xb3: // f32.convert_i32_u
+		self.pushF32(float32(self.popI32()))
+	case 0xb4: // f32.convert_i64_s
+		self.pushF32(float32(int64(self.pop())))
+	case 0xb5: // f32.convert_i64_u
+		self.pushF32(float32(self.pop()))
+	case 0xb6: // f32.demote_f64
+		self.pushF32(float32(self.popF64()))
+	case 0xb7: // f64.convert_i32_s
+		self.pushF64(float64(int32(self.popI32())))
+	case 0xb8: // f64.convert_i32_u
+		self.pushF64(float64(self.popI32()))
+	case 0xb9: // f64.convert_i64_s
+		self.pushF64(float64(int64(self.pop())))
+	case 0xba: // f64.convert_i64_u
+		self.pushF64(float64(self.pop()))
+	case 0xbb: // f64.promote_f32
+		self.pushF64(float64(self.popF32()))
+	case 0xbc, 0xbe: // i32.reinterpret_f32, f32.reinterpret_i32
+		self.pushI32(self.popI32())
+	case 0xbd, 0xbf: // i64.reinterpret_f64, f64.reinterpret_i64
+
+	// Sign extension
+	case 0xc0:
+		self.pushI32(uint32(int32(int8(self.popI32()))))
+	case 0xc1:
+		self.pushI32(uint32(int32(int16(self.popI32()))))
+	case 0xc2:
+		self.push(uint64(int64(int8(self.pop()))))
+	case 0xc3:
+		self.push(uint64(int64(int16(self.pop()))))
+	case 0xc4:
+		self.push(uint64(int64(int32(self.pop()))))
+
+	default:
+		trap("invalid instruction 0x%x", op)
+	}
+}
+
+func compareI32(op uint16, a, b uint32) bool {
+	switch op {
+	case 0x46:
+		return a == b
+	case 0x47:
+		return a != b
+	case 0x48:
+		return int32(a) < int32(b)
+	case 0x49:
+		return a < b
+	case 0x4a:
+		return int32(a) > int32(b)
+	case 0x4b:
+		return a > b
+	case 0x4c:
+		return int32(a) <= int32(b)
+	case 0x4d:
+		return a <= b
+	case 0x4e:
+		return int32(a) >= int32(b)
+	default:
+		return a >= b
+	}
+}
+
+func compareI64(op uint16, a, b uint64) bool {
+	switch op {
+	case 0x51:
+		return a == b
+	case 0x52:
+		return a != b
+	case 0x53:
+		return int64(a) < int64(b)
+	case 0x54:
+		return a < b
+	case 0x55:
+		return int64(a) > int64(b)
+	case 0x56:
+		return a > b
+	case 0x57:
+		return int64(a) <= int64(b)
+	case 0x58:
+		return a <= b
+	case 0x59:
+		return int64(a) >= int64(b)
+	default:
+		return a >= b
+	}
+}
+
+// Float comparisons in the order eq, ne, lt, gt, le, ge.
+func compareFloat(op uint16, a, b float64) bool {
+	switch op {
+	case 0:
+		return a == b
+	case 1:
+		return a != b
+	case 2:
+		return a < b
+	case 3:
+		return a > b
+	case 4:
+		return a <= b
+	default:
+		return a >= b
+	}
+}
+
+func arithI32(op uint16, a, b uint32) uint32 {
+	switch op {
+	case 0x6a:
+		return a + b
+	case 0x6b:
+		return a - b
+	case 0x6c:
+		return a * b
+	case 0x6d:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int32(a) == math.MinInt32 && int32(b) == -1 {
+			trap("integer overflow")
+		}
+		return uint32(int32(a) / int32(b))
+	case 0x6e:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a / b
+	case 0x6f:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int32(b) == -1 {
+			return 0
+		}
+		return uint32(int32(a) % int32(b))
+	case 0x70:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a % b
+	case 0x71:
+		return a & b
+	case 0x72:
+		return a | b
+	case 0x73:
+		return a ^ b
+	case 0x74:
+		return a << (b & 31)
+	case 0x75:
+		return uint32(int32(a) >> (b & 31))
+	case 0x76:
+		return a >> (b & 31)
+	case 0x77:
+		return bits.RotateLeft32(a, int(b&31))
+	default:
+		return bits.RotateLeft32(a, -int(b&31))
+	}
+}
+
+func arithI64(op uint16, a, b uint64) uint64 {
+	switch op {
+	case 0x7c:
+		return a + b
+	case 0x7d:
+		return a - b
+	case 0x7e:
+		return a * b
+	case 0x7f:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int64(a) == math.MinInt64 && int64(b) == -1 {
+			trap("integer overflow")
+		}
+		return uint64(int64(a) / int64(b))
+	case 0x80:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a / b
+	case 0x81:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int64(b) == -1 {
+			return 0
+		}
+		return uint64(int64(a) % int64(b))
+	case 0x82:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a % b
+	case 0x83:
+		return a & b
+	case 0x84:
+		return a | b
+	case 0x85:
+		return a ^ b
+	case 0x86:
+		return a << (b & 63)
+	case 0x87:
+		return uint64(int64(a) >> (b & 63))
+	case 0x88:
+		return a >> (b & 63)
+	case 0x89:
+		return bits.RotateLeft64(a, int(b&63))
+	default:
+		return bits.RotateLeft64(a, -int(b&63))
+	}
+}
+
+// Unary float operations in the order abs, neg, ceil, floor, trunc,
+// nearest, sqrt. These are exact for f32 values computed as f64.
+func unaryFloat(op uint16, a float64) float64 {
+	switch op {
+	case 0:
+		return math.Abs(a)
+	case 1:
+		return -a
+	case 2:
+		return math.Ceil(a)
+	case 3:
+		return math.Floor(a)
+	case 4:
+		return math.Trunc(a)
+	case 5:
+		return math.RoundToEven(a)
+	default:
+		return math.Sqrt(a)
+	}
+}
+
+// Binary float operations in the order add, sub, mul, div, min,
+// max, copysign.
+func binaryF32(op uint16, a, b float32) float32 {
+	switch op {
+	case 0:
+		return a + b
+	case 1:
+		return a - b
+	case 2:
+		return a * b
+	case 3:
+		return a / b
+	default:
+		return float32(binaryF64(op, float64(a), float64(b)))
+	}
+}
+
+func binaryF64(op uint16, a, b float64) float64 {
+	switch op {
+	case 0:
+		return a + b
+	case 1:
+		return a - b
+	case 2:
+		return a * b
+	case 3:
+		return a / b
+	case 4:
+		return math.Min(a, b)
+	case 5:
+		return math.Max(a, b)
+	default:
+		return math.Copysign(a, b)
+	}
+}
+
+func truncSigned(f float64, size int) int64 {
+	if math.IsNaN(f) {
+		trap("invalid conversion to integer")
+	}
+
+	t := math.Trunc(f)
+	if size == 32 {
+		if t < math.MinInt32 || t > math.MaxInt32 {
+			trap("integer overflow")
+		}
+	} else if t < math.MinInt64 || t >= 9223372036854775808.0 {
+		trap("integer overflow")
+	}
+	return int64(t)
+}
+
+func truncUnsigned(f float64, size int) uint64 {
+	if math.IsNaN(f) {
+		trap("invalid conversion to integer")
+	}
+
+	t := math.Trunc(f)
+	if t <= -1 ||
+		(size == 32 && t > math.MaxUint32) ||
+		(size == 64 && t >= 18446744073709551616.0) {
+		trap("integer overflow")
+	}
+	return uint64(t)
+}
+
+// The saturating truncations never trap.
+func (self *frame) truncSat(sub uint16) {
+	var f float64
+	if sub&2 == 0 {
+		f = float64(self.popF32())
+	} else {
+		f = self.popF64()
+	}
+
+	t := math.Trunc(f)
+	if math.IsNaN(f) {
+		t = 0
+	}
+
+	switch sub {
+	case 0, 2: // i32 signed
+		self.pushI32(uint32(int32(math.Max(math.MinInt32,
+			math.Min(math.MaxInt32, t)))))
+	case 1, 3: // i32 unsigned
+		self.pushI32(uint32(math.Max(0, math.Min(math.MaxUint32, t))))
+	case 4, 6: // i64 signed
+		switch {
+		case t < math.MinInt64:
+			self.push(uint64(1) << 63)
+		case t >= 9223372036854775808.0:
+			self.push(math.MaxInt64)
+		default:
+			self.push(uint64(int64(t)))
+		}
+	default: // i64 unsigned
+		switch {
+		case t <= 0:
+			self.push(0)
+		case t >= 18446744073709551616.0:
+			self.push(math.MaxUint64)
+		default:
+			self.push(uint64(t))
+		}
+	}
+}
@@ -0,0 +1,699 @@
+// Package wasm implements a small, self contained interpreter for
+// WebAssembly modules.
+//
+// The interpreter is used to run parsers shipped by the server
+// against collected data. It is deliberately limited: modules may
+// only import the host functions explicitly provided to them, they
+// can not access files, the network or the rest of the process, and
+// their memory, stack depth and number of executed instructions are
+// bounded. A misbehaving module results in an error (a trap), never
+// a crash of the client.
+//
+// The WebAssembly 1.0 instruction set is supported together with the
+// sign extension, saturating conversion and bulk memory copy/fill
+// extensions that compilers emit by default. Modules are not fully
+// validated before they run - instead every operation is checked at
+// run time so invalid code traps.
+package wasm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+type ValueType byte
+
+const (
+	I32 ValueType = 0x7f
+	I64 ValueType = 0x7e
+	F32 ValueType = 0x7d
+	F64 ValueType = 0x7c
+)
+
+const (
+	// The size of a memory page.
+	PageSize = 65536
+
+	// Bounds on the declarations in a module to stop a small module
+	// from making us allocate a lot of memory.
+	maxLocals    = 50000
+	maxTableSize = 1 << 20
+
+	externalFunction = 0x00
+	externalTable    = 0x01
+	externalMemory   = 0x02
+	externalGlobal   = 0x03
+)
+
+var (
+	wasmMagic   = []byte{0x00, 0x61, 0x73, 0x6d}
+	wasmVersion = []byte{0x01, 0x00, 0x00, 0x00}
+)
+
+type FuncType struct {
+	Params  []ValueType
+	Results []ValueType
+}
+
+func (self FuncType) Equal(other FuncType) bool {
+	return bytes.Equal(valueTypes(self.Params), valueTypes(other.Params)) &&
+		bytes.Equal(valueTypes(self.Results), valueTypes(other.Results))
+}
+
+func (self FuncType) String() string {
+	return fmt.Sprintf("%v -> %v", self.Params, self.Results)
+}
+
+func valueTypes(types []ValueType) []byte {
+	result := make([]byte, 0, len(types))
+	for _, t := range types {
+		result = append(result, byte(t))
+	}
+	return result
+}
+
+type limits struct {
+	min    uint32
+	max    uint32
+	hasMax bool
+}
+
+type importedFunction struct {
+	module  string
+	name    string
+	typeIdx uint32
+}
+
+type global struct {
+	valueType ValueType
+	mutable   bool
+	init      uint64
+}
+
+type export struct {
+	kind  byte
+	index uint32
+}
+
+type elementSegment struct {
+	offset uint32
+	funcs  []uint32
+}
+
+type dataSegment struct {
+	offset uint32
+	data   []byte
+}
+
+type function struct {
+	typeIdx uint32
+	locals  []ValueType
+	code    []instr
+}
+
+// A decoded module. A module may be instantiated many times, each
+// instance has its own memory.
+type Module struct {
+	types     []FuncType
+	imports   []importedFunction
+	functions []*function
+	table     *limits
+	memory    *limits
+	globals   []global
+	exports   map[string]export
+	start     int64
+	elements  []elementSegment
+	data      []dataSegment
+}
+
+// Decode a module from its binary encoding.
+func Decode(data []byte) (*Module, error) {
+	if len(data) < 8 || !bytes.Equal(data[:4], wasmMagic) {
+		return nil, errors.New("wasm: not a WebAssembly module")
+	}
+
+	if !bytes.Equal(data[4:8], wasmVersion) {
+		return nil, errors.New("wasm: unsupported version")
+	}
+
+	self := &Module{
+		exports: make(map[string]export),
+		start:   -1,
+	}
+
+	r := &reader{data: data, pos: 8}
+	for !r.eof() {
+		id, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := r.readU32()
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := r.readBytes(int(size))
+		if err != nil {
+			return nil, err
+		}
+
+		err = self.decodeSection(id, &reader{data: body})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(self.functions) > 0 && self.functions[0].code == nil {
+		return nil, errors.New("wasm: missing code section")
+	}
+
+	return self, nil
+}
+
+func (self *Module) decodeSection(id byte, r *reader) error {
+	switch id {
+	case 0: // Custom sections are ignored.
+		return nil
+	case 1:
+		return self.decodeTypes(r)
+	case 2:
+		return self.decodeImports(r)
+	case 3:
+		return self.decodeFunctions(r)
+	case 4:
+		return self.decodeTables(r)
+	case 5:
+		return self.decodeMemory(r)
+	case 6:
+		return self.decodeGlobals(r)
+	case 7:
+		return self.decodeExports(r)
+	case 8:
+		start, err := r.readU32()
+		if err != nil {
+			return err
+		}
+		if int(start) >= self.numFunctions() {
+			return errors.New("wasm: invalid start function")
+		}
+		self.start = int64(start)
+		return nil
+	case 9:
+		return self.decodeElements(r)
+	case 10:
+		return self.decodeCode(r)
+	case 11:
+		return self.decodeData(r)
+	case 12: // Data count is only needed for validation.
+		return nil
+	default:
+		return fmt.Errorf("wasm: unknown section %d", id)
+	}
+}
+
+func (self *Module) numFunctions() int {
+	return len(self.imports) + len(self.functions)
+}
+
+func (self *Module) functionType(idx uint32) FuncType {
+	if int(idx) < len(self.imports) {
+		return self.types[self.imports[idx].typeIdx]
+	}
+	return self.types[self.functions[int(idx)-len(self.imports)].typeIdx]
+}
+
+func readValueType(r *reader) (ValueType, error) {
+	b, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch t := ValueType(b); t {
+	case I32, I64, F32, F64:
+		return t, nil
+	default:
+		return 0, fmt.Errorf("wasm: unsupported value type 0x%x", b)
+	}
+}
+
+func readValueTypes(r *reader) ([]ValueType, error) {
+	n, err := r.readCount()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]ValueType, 0, n)
+	for i := 0; i < n; i++ {
+		t, err := readValueType(r)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+func readLimits(r *reader) (*limits, error) {
+	flags, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &limits{}
+	result.min, err = r.readU32()
+	if err != nil {
+		return nil, err
+	}
+
+	switch flags {
+	case 0:
+	case 1:
+		result.hasMax = true
+		result.max, err = r.readU32()
+		if err != nil {
+			return nil, err
+		}
+		if result.max < result.min {
+			return nil, errors.New("wasm: invalid limits")
+		}
+	default:
+		return nil, fmt.Errorf("wasm: unsupported limits 0x%x", flags)
+	}
+
+	return result, nil
+}
+
+func (self *Module) decodeTypes(r *reader) error {
+	n, err := r.readCount()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		form, err := r.readByte()
+		if err != nil {
+			return err
+		}
+		if form != 0x60 {
+			return fmt.Errorf("wasm: invalid function type 0x%x", form)
+		}
+
+		params, err := readValueTypes(r)
+		if err != nil {
+			return err
+		}
+
+		results, err := readValueTypes(r)
+		if err != nil {
+			return err
+		}
+
+		self.types = append(self.types, FuncType{
+			Params: params, Results: results})
+	}
+	return nil
+}
+
+func (self *Module) decodeImports(r *reader) error {
+	n, err := r.readCount()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		module, err := r.readName()
+		if err != nil {
+			return err
+		}
+
+		name, err := r.readName()
+		if err != nil {
+			return err
+		}
+
+		kind, err := r.readByte()
+		if err != nil {
+			return err
+		}
+
+		// The sandbox only provides functions to modules.
+		if kind != externalFunction {
+			return fmt.Errorf("wasm: unsupported import %v.%v", module, name)
+		}
+
+		type_idx, err := r.readU32()
+		if err != nil {
+			return err
+		}
+		if int(type_idx) >= len(self.types) {
+			return fmt.Errorf("wasm: invalid type for import %v.%v",
+				module, name)
+		}
+
+		self.imports = append(self.imports, importedFunction{
+			module: module, name: name, typeIdx: type_idx})
+	}
+	return nil
+}
+
+func (self *Module) decodeFunctions(r *reader) error {
+	n, err := r.readCount()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		type_idx, err := r.readU32()
+		if err != nil {
+			return err
+		}
+		if int(type_idx) >= len(self.types) {
+			return errors.New("wasm: invalid function type index")
+		}
+		self.functions = append(self.functions, &function{typeIdx: type_idx})
+	}
+	return nil
+}
+
+func (self *Module) decodeTables(r *reader) error {
+	n, err := r.readCount()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		ref_type, err := r.readByte()
+		if err != nil {
+			return err
+		}
+		if ref_type != 0x70 || self.table != nil {
+			return errors.New("wasm: only a single funcref table is supported")
+		}
+
+		self.table, err = readLimits(r)
+		if err != nil {
+			return err
+		}
+
+		if self.table.min > maxTableSize {
+			return errors.New("wasm: table too large")
+		}
+	}
+	return nil
+}
+
+func (self *Module) decodeMemory(r *reader) error {
+	n, err := r.readCount()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		if self.memory != nil {
+			return errors.New("wasm: only a single memory is supported")
+		}
+
+		self.memory, err = readLimits(r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluate a constant expression - only simple constants are
+// supported since modules can not import globals.
+func (self *Module) readConstExpr(r *reader) (uint64, error) {
+	op, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+
+	var value uint64
+	switch op {
+	case 0x41:
+		v, err := r.readS32()
+		if err != nil {
+			return 0, err
+		}
+		value = uint64(uint32(v))
+
+	case 0x42:
+		v, err := r.readS64(64)
+		if err != nil {
+			return 0, err
+		}
+		value = uint64(v)
+
+	case 0x43:
+		v, err := r.readU32Fixed()
+		if err != nil {
+			return 0, err
+		}
+		value = uint64(v)
+
+	case 0x44:
+		value, err = r.readU64Fixed()
+		if err != nil {
+			return 0, err
+		}
+
+	case 0x23:
+		idx, err := r.readU32()
+		if err != nil {
+			return 0, err
+		}
+		if int(idx) >= len(self.globals) {
+			return 0, errors.New("wasm: invalid global in constant expression")
+		}
+		value = self.globals[idx].init
+
+	default:
+		return 0, fmt.Errorf("wasm: unsupported constant expression 0x%x", op)
+	}
+
+	end, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	if end != 0x0b {
+		return 0, errors.New("wasm: invalid constant expression")
+	}
+
+	return value, nil
+}
+
+func (self *Module) decodeGlobals(r *reader) error {
+	n, err := r.readCount()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		value_type, err := readValueType(r)
+		if err != nil {
+			return err
+		}
+
+		mutable, err := r.readByte()
+		if err != nil {
+			return err
+		}
+
+		init, err := self.readConstExpr(r)
+		if err != nil {
+			return err
+		}
+
+		self.globals = append(self.globals, global{
+			valueType: value_type,
+			mutable:   mutable == 1,
+			init:      init,
+		})
+	}
+	return nil
+}
+
+func (self *Module) decodeExports(r *reader) error {
+	n, err := r.readCount()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		name, err := r.readName()
+		if err != nil {
+			return err
+		}
+
+		kind, err := r.readByte()
+		if err != nil {
+			return err
+		}
+
+		idx, err := r.readU32()
+		if err != nil {
+			return err
+		}
+
+		if kind == externalFunction && int(idx) >= self.numFunctions() {
+			return fmt.Errorf("wasm: invalid export %v", name)
+		}
+
+		self.exports[name] = export{kind: kind, index: idx}
+	}
+	return nil
+}
+
+func (self *Module) decodeElements(r *reader) error {
+	n, err := r.readCount()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		flags, err := r.readU32()
+		if err != nil {
+			return err
+		}
+
+		if flags != 0 {
+			return fmt.Errorf("wasm: unsupported element segment 0x%x", flags)
+		}
+
+		offset, err := self.readConstExpr(r)
+		if err != nil {
+			return err
+		}
+
+		count, err := r.readCount()
+		if err != nil {
+			return err
+		}
+
+		segment := elementSegment{offset: uint32(offset)}
+		for j := 0; j < count; j++ {
+			idx, err := r.readU32()
+			if err != nil {
+				return err
+			}
+			if int(idx) >= self.numFunctions() {
+				return errors.New("wasm: invalid function in element segment")
+			}
+			segment.funcs = append(segment.funcs, idx)
+		}
+
+		self.elements = append(self.elements, segment)
+	}
+	return nil
+}
+
+func (self *Module) decodeCode(r *reader) error {
+	n, err := r.readCount()
+	if err != nil {
+		return err
+	}
+
+	if n != len(self.functions) {
+		return errors.New("wasm: function and code sections do not match")
+	}
+
+	for i := 0; i < n; i++ {
+		size, err := r.readU32()
+		if err != nil {
+			return err
+		}
+
+		body, err := r.readBytes(int(size))
+		if err != nil {
+			return err
+		}
+
+		err = self.decodeFunctionBody(self.functions[i], &reader{data: body})
+		if err != nil {
+			return fmt.Errorf("function %d: %w", i+len(self.imports), err)
+		}
+	}
+	return nil
+}
+
+func (self *Module) decodeFunctionBody(fn *function, r *reader) error {
+	n, err := r.readCount()
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for i := 0; i < n; i++ {
+		count, err := r.readU32()
+		if err != nil {
+			return err
+		}
+
+		total += int(count)
+		if total > maxLocals {
+			return errors.New("wasm: too many locals")
+		}
+
+		value_type, err := readValueType(r)
+		if err != nil {
+			return err
+		}
+
+		for j := uint32(0); j < count; j++ {
+			fn.locals = append(fn.locals, value_type)
+		}
+	}
+
+	fn.code, err = self.compile(fn, r)
+	return err
+}
+
+func (self *Module) decodeData(r *reader) error {
+	n, err := r.readCount()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		flags, err := r.readU32()
+		if err != nil {
+			return err
+		}
+
+		switch flags {
+		case 0:
+		case 2:
+			mem_idx, err := r.readU32()
+			if err != nil {
+				return err
+			}
+			if mem_idx != 0 {
+				return errors.New("wasm: invalid memory index")
+			}
+		default:
+			return fmt.Errorf("wasm: unsupported data segment 0x%x", flags)
+		}
+
+		offset, err := self.readConstExpr(r)
+		if err != nil {
+			return err
+		}
+
+		size, err := r.readU32()
+		if err != nil {
+			return err
+		}
+
+		data, err := r.readBytes(int(size))
+		if err != nil {
+			return err
+		}
+
+		self.data = append(self.data, dataSegment{
+			offset: uint32(offset), data: data})
+	}
+	return nil
+}
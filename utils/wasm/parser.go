@@ -0,0 +1,116 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// The interface between parser modules and the host:
+//
+//   - The module exports "alloc(size i32) -> i32" which returns a
+//     buffer of the requested size in its memory.
+//   - The module exports "parse(ptr i32, len i32) -> i32" which
+//     parses the data in the buffer and returns 0 on success.
+//   - The module may import "env.emit(ptr i32, len i32)" to emit a
+//     row encoded as a JSON object.
+//   - The module may import "env.log(ptr i32, len i32)" to log a
+//     message.
+//
+// No other imports are provided so a parser can only transform the
+// data it is given.
+var (
+	allocType = FuncType{Params: []ValueType{I32}, Results: []ValueType{I32}}
+	parseType = FuncType{Params: []ValueType{I32, I32}, Results: []ValueType{I32}}
+	bufType   = FuncType{Params: []ValueType{I32, I32}}
+)
+
+type Parser struct {
+	module *Module
+	config Config
+}
+
+func NewParser(data []byte, config Config) (*Parser, error) {
+	module, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range []string{"alloc", "parse"} {
+		if _, pres := module.exports[name]; !pres {
+			return nil, fmt.Errorf("wasm: parser does not export %v", name)
+		}
+	}
+
+	return &Parser{module: module, config: config}, nil
+}
+
+// Run the parser over the data. Each call uses a fresh instance so
+// state can not leak between parsed files.
+func (self *Parser) Parse(ctx context.Context, data []byte,
+	emit func(row []byte) error, log func(message string)) error {
+
+	if uint64(len(data)) > 0xffffffff {
+		return errors.New("wasm: data too large")
+	}
+
+	config := self.config
+	config.Imports = map[string]*HostFunction{
+		"env.emit": {
+			Type: bufType,
+			Call: func(instance *Instance, args []uint64) ([]uint64, error) {
+				row, err := instance.Read(uint32(args[0]), uint32(args[1]))
+				if err != nil {
+					return nil, err
+				}
+				if len(row) == 0 {
+					return nil, nil
+				}
+				return nil, emit(row)
+			},
+		},
+		"env.log": {
+			Type: bufType,
+			Call: func(instance *Instance, args []uint64) ([]uint64, error) {
+				message, err := instance.Read(uint32(args[0]), uint32(args[1]))
+				if err != nil {
+					return nil, err
+				}
+				log(string(message))
+				return nil, nil
+			},
+		},
+	}
+
+	instance, err := Instantiate(ctx, self.module, config)
+	if err != nil {
+		return err
+	}
+
+	if !instance.HasFunction("alloc", allocType) ||
+		!instance.HasFunction("parse", parseType) {
+		return errors.New("wasm: parser exports have the wrong type")
+	}
+
+	result, err := instance.Call("alloc", uint64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	ptr := uint32(result[0])
+	err = instance.Write(ptr, data)
+	if err != nil {
+		return err
+	}
+
+	result, err = instance.Call("parse", uint64(ptr), uint64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	if status := int32(result[0]); status != 0 {
+		return fmt.Errorf("wasm: parser failed with status %d", status)
+	}
+
+	return nil
+}
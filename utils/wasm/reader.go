@@ -0,0 +1,137 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	errUnexpectedEOF = errors.New("wasm: unexpected end of module")
+	errOverflow      = errors.New("wasm: integer overflow in LEB128")
+)
+
+// A reader over the binary encoding of a module.
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func (self *reader) eof() bool {
+	return self.pos >= len(self.data)
+}
+
+func (self *reader) remaining() int {
+	return len(self.data) - self.pos
+}
+
+func (self *reader) readByte() (byte, error) {
+	if self.pos >= len(self.data) {
+		return 0, errUnexpectedEOF
+	}
+	b := self.data[self.pos]
+	self.pos++
+	return b, nil
+}
+
+func (self *reader) readBytes(n int) ([]byte, error) {
+	if n < 0 || n > self.remaining() {
+		return nil, errUnexpectedEOF
+	}
+	result := self.data[self.pos : self.pos+n]
+	self.pos += n
+	return result, nil
+}
+
+func (self *reader) readU32() (uint32, error) {
+	var result uint32
+	var shift uint
+	for i := 0; i < 5; i++ {
+		b, err := self.readByte()
+		if err != nil {
+			return 0, err
+		}
+		result |= uint32(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return result, nil
+		}
+		shift += 7
+	}
+	return 0, errOverflow
+}
+
+func (self *reader) readS64(size uint) (int64, error) {
+	var result int64
+	var shift uint
+	for {
+		b, err := self.readByte()
+		if err != nil {
+			return 0, err
+		}
+		result |= int64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			if shift < 64 && b&0x40 != 0 {
+				result |= -1 << shift
+			}
+			return result, nil
+		}
+		if shift >= size {
+			return 0, errOverflow
+		}
+	}
+}
+
+func (self *reader) readS32() (int32, error) {
+	v, err := self.readS64(32)
+	if err != nil {
+		return 0, err
+	}
+	if v < math.MinInt32 || v > math.MaxInt32 {
+		return 0, errOverflow
+	}
+	return int32(v), nil
+}
+
+func (self *reader) readU64Fixed() (uint64, error) {
+	b, err := self.readBytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+func (self *reader) readU32Fixed() (uint32, error) {
+	b, err := self.readBytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (self *reader) readName() (string, error) {
+	n, err := self.readU32()
+	if err != nil {
+		return "", err
+	}
+	b, err := self.readBytes(int(n))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Read the length of a vector. Every element takes at least one
+// byte, so a length larger than the remaining data is invalid. This
+// prevents a small module from making us allocate huge slices.
+func (self *reader) readCount() (int, error) {
+	n, err := self.readU32()
+	if err != nil {
+		return 0, err
+	}
+	if int(n) > self.remaining() {
+		return 0, fmt.Errorf("wasm: invalid vector length %d", n)
+	}
+	return int(n), nil
+}
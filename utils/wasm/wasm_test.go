@@ -0,0 +1,313 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Helpers to assemble modules in the binary format.
+func uleb(v uint64) []byte {
+	var result []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			result = append(result, b|0x80)
+			continue
+		}
+		return append(result, b)
+	}
+}
+
+func cat(parts ...[]byte) []byte {
+	var result []byte
+	for _, p := range parts {
+		result = append(result, p...)
+	}
+	return result
+}
+
+func vec(items ...[]byte) []byte {
+	return cat(uleb(uint64(len(items))), cat(items...))
+}
+
+func name(s string) []byte {
+	return cat(uleb(uint64(len(s))), []byte(s))
+}
+
+func section(id byte, content []byte) []byte {
+	return cat([]byte{id}, uleb(uint64(len(content))), content)
+}
+
+func funcType(params, results []byte) []byte {
+	return cat([]byte{0x60}, vec(bytesToItems(params)...),
+		vec(bytesToItems(results)...))
+}
+
+func bytesToItems(b []byte) [][]byte {
+	var result [][]byte
+	for _, x := range b {
+		result = append(result, []byte{x})
+	}
+	return result
+}
+
+// A function body with the given locals (count, type pairs).
+func body(locals [][]byte, code ...byte) []byte {
+	content := cat(vec(locals...), code, []byte{opEnd})
+	return cat(uleb(uint64(len(content))), content)
+}
+
+func module(sections ...[]byte) []byte {
+	return cat(wasmMagic, wasmVersion, cat(sections...))
+}
+
+var (
+	i32 = byte(I32)
+)
+
+// A parser which emits every line of its input as a row.
+func lineParser() []byte {
+	parse := []byte{
+		// start = ptr; end = ptr + len; i = ptr
+		opLocalGet, 0, opLocalSet, 3,
+		opLocalGet, 0, opLocalGet, 1, 0x6a, opLocalSet, 4,
+		opLocalGet, 0, opLocalSet, 2,
+
+		opBlock, 0x40,
+		opLoop, 0x40,
+		// if i >= end break
+		opLocalGet, 2, opLocalGet, 4, 0x4f, opBrIf, 1,
+
+		// if memory[i] == '\n'
+		opLocalGet, 2, 0x2d, 0, 0, opI32Const, 10, 0x46,
+		opIf, 0x40,
+		// emit(start, i - start); start = i + 1
+		opLocalGet, 3, opLocalGet, 2, opLocalGet, 3, 0x6b, opCall, 0,
+		opLocalGet, 2, opI32Const, 1, 0x6a, opLocalSet, 3,
+		opEnd,
+
+		// i++
+		opLocalGet, 2, opI32Const, 1, 0x6a, opLocalSet, 2,
+		opBr, 0,
+		opEnd,
+		opEnd,
+
+		// Emit the last line
+		opLocalGet, 4, opLocalGet, 3, 0x4b,
+		opIf, 0x40,
+		opLocalGet, 3, opLocalGet, 4, opLocalGet, 3, 0x6b, opCall, 0,
+		opEnd,
+
+		opI32Const, 0,
+	}
+
+	alloc := []byte{
+		// Bump allocator: return heap; heap += n
+		opGlobalGet, 0,
+		opGlobalGet, 0, opLocalGet, 0, 0x6a, opGlobalSet, 0,
+	}
+
+	return module(
+		section(1, vec(
+			funcType([]byte{i32, i32}, nil),           // 0: emit
+			funcType([]byte{i32}, []byte{i32}),        // 1: alloc
+			funcType([]byte{i32, i32}, []byte{i32}))), // 2: parse
+		section(2, vec(cat(name("env"), name("emit"), []byte{0x00}, uleb(0)))),
+		section(3, vec(uleb(1), uleb(2))),
+		section(5, vec([]byte{0x00, 0x01})),
+		section(6, vec([]byte{i32, 0x01, opI32Const, 0x80, 0x08, opEnd})),
+		section(7, vec(
+			cat(name("alloc"), []byte{0x00}, uleb(1)),
+			cat(name("parse"), []byte{0x00}, uleb(2)))),
+		section(10, vec(
+			body(nil, alloc...),
+			body([][]byte{{0x03, i32}}, parse...))),
+	)
+}
+
+func TestParser(t *testing.T) {
+	parser, err := NewParser(lineParser(), Config{})
+	assert.NoError(t, err)
+
+	var rows []string
+	err = parser.Parse(context.Background(),
+		[]byte("{\"A\":1}\n{\"A\":2}\n\n{\"A\":3}"),
+		func(row []byte) error {
+			rows = append(rows, string(row))
+			return nil
+		}, func(string) {})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{"A":1}`, `{"A":2}`, `{"A":3}`}, rows)
+
+	// Errors from the host abort the parser.
+	err = parser.Parse(context.Background(), []byte("a\nb"),
+		func(row []byte) error {
+			return errors.New("Stop")
+		}, func(string) {})
+	assert.Error(t, err)
+
+	// The instruction limit bounds the work done.
+	parser.config.Fuel = 100
+	err = parser.Parse(context.Background(),
+		[]byte(strings.Repeat("x", 1000)),
+		func(row []byte) error { return nil }, func(string) {})
+	assert.ErrorIs(t, err, ErrFuelExhausted)
+}
+
+func TestInstructions(t *testing.T) {
+	// fac(n) = n < 2 ? 1 : n * fac(n - 1) over i64
+	fac := []byte{
+		opLocalGet, 0, opI64Const, 2, 0x53,
+		opIf, byte(I64),
+		opI64Const, 1,
+		opElse,
+		opLocalGet, 0,
+		opLocalGet, 0, opI64Const, 1, 0x7d, opCall, 0,
+		0x7e,
+		opEnd,
+	}
+
+	// div(a, b) = a / b (signed i32)
+	div := []byte{opLocalGet, 0, opLocalGet, 1, 0x6d}
+
+	// load(addr) = i32.load(addr)
+	load := []byte{opLocalGet, 0, 0x28, 2, 0}
+
+	// spin() loops forever
+	spin := []byte{opLoop, 0x40, opBr, 0, opEnd}
+
+	// grow(n) = memory.grow(n)
+	grow := []byte{opLocalGet, 0, opMemoryGrow, 0}
+
+	// sel(n) picks a branch with br_table: 0 -> 10, 1 -> 20, else 30
+	sel := []byte{
+		opBlock, 0x40,
+		opBlock, 0x40,
+		opBlock, 0x40,
+		opLocalGet, 0, opBrTable, 2, 0, 1, 2,
+		opEnd,
+		opI32Const, 10, opReturn,
+		opEnd,
+		opI32Const, 20, opReturn,
+		opEnd,
+		opI32Const, 30,
+	}
+
+	data := module(
+		section(1, vec(
+			funcType([]byte{byte(I64)}, []byte{byte(I64)}), // 0
+			funcType([]byte{i32, i32}, []byte{i32}),        // 1
+			funcType([]byte{i32}, []byte{i32}),             // 2
+			funcType(nil, nil))),                           // 3
+		section(3, vec(uleb(0), uleb(1), uleb(2), uleb(3), uleb(2), uleb(2))),
+		section(5, vec([]byte{0x01, 0x01, 0x02})),
+		section(7, vec(
+			cat(name("fac"), []byte{0x00}, uleb(0)),
+			cat(name("div"), []byte{0x00}, uleb(1)),
+			cat(name("load"), []byte{0x00}, uleb(2)),
+			cat(name("spin"), []byte{0x00}, uleb(3)),
+			cat(name("grow"), []byte{0x00}, uleb(4)),
+			cat(name("sel"), []byte{0x00}, uleb(5)))),
+		section(10, vec(
+			body(nil, fac...),
+			body(nil, div...),
+			body(nil, load...),
+			body(nil, spin...),
+			body(nil, grow...),
+			body(nil, sel...))),
+		section(11, vec(cat([]byte{0x00, opI32Const, 8, opEnd},
+			vec([]byte{0x2a}, []byte{0x01})))),
+	)
+
+	module, err := Decode(data)
+	assert.NoError(t, err)
+
+	instance, err := Instantiate(context.Background(), module, Config{
+		Fuel: 100000,
+	})
+	assert.NoError(t, err)
+
+	result, err := instance.Call("fac", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{3628800}, result)
+
+	result, err = instance.Call("div", uint64(0xfffffff6), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{uint64(0xfffffffd)}, result)
+
+	_, err = instance.Call("div", 1, 0)
+	assert.ErrorContains(t, err, "integer divide by zero")
+
+	// The data segment was loaded at offset 8.
+	result, err = instance.Call("load", 8)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{0x12a}, result)
+
+	_, err = instance.Call("load", 65534)
+	assert.ErrorContains(t, err, "out of bounds")
+
+	// The module allows 2 pages of memory.
+	result, err = instance.Call("grow", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1}, result)
+
+	result, err = instance.Call("grow", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{0xffffffff}, result)
+
+	for arg, expected := range map[uint64]uint64{0: 10, 1: 20, 2: 30, 100: 30} {
+		result, err = instance.Call("sel", arg)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{expected}, result)
+	}
+
+	_, err = instance.Call("spin")
+	assert.ErrorIs(t, err, ErrFuelExhausted)
+
+	// Deep recursion is stopped.
+	instance.fuel = 100000
+	_, err = instance.Call("fac", 100000)
+	assert.ErrorContains(t, err, "call stack exhausted")
+
+	// Cancelling the context stops execution.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	instance, err = Instantiate(ctx, module, Config{})
+	assert.NoError(t, err)
+	_, err = instance.Call("spin")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSandbox(t *testing.T) {
+	// Modules may not import anything we do not provide.
+	data := module(
+		section(1, vec(funcType(nil, nil))),
+		section(2, vec(cat(name("env"), name("system"), []byte{0x00}, uleb(0)))),
+	)
+
+	module, err := Decode(data)
+	assert.NoError(t, err)
+
+	_, err = Instantiate(context.Background(), module, Config{})
+	assert.ErrorContains(t, err, "unknown import env.system")
+
+	// Modules may not require more memory than allowed.
+	data = cat(wasmMagic, wasmVersion, section(5, vec([]byte{0x00, 0x80, 0x08})))
+	module, err = Decode(data)
+	assert.NoError(t, err)
+
+	_, err = Instantiate(context.Background(), module, Config{})
+	assert.ErrorContains(t, err, "memory pages")
+
+	// Truncated modules are rejected without panicking.
+	valid := lineParser()
+	for i := 0; i < len(valid); i++ {
+		Decode(valid[:i])
+	}
+}
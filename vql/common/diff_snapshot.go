@@ -0,0 +1,280 @@
+/*
+Plugin diff_snapshot.
+
+Recurring collections (e.g. a daily listing of installed software)
+mostly return the same rows each time. Over slow links it is wasteful
+to upload the full result set every time.
+
+The diff_snapshot plugin runs the query once and compares the result
+with the snapshot stored on the endpoint from the previous run. Only
+added and removed rows are emitted, followed by a summary row carrying
+a digest of the full current result set. The server can reconstruct
+the full result set from the previous collections and check it
+against the digest.
+
+	SELECT * FROM diff_snapshot(
+	   name="InstalledSoftware",
+	   query={ SELECT Name, Version FROM Artifact.Windows.Sys.Programs() },
+	   key="Name")
+
+A modified row is reported as the old row removed and the new row
+added. The first run (or a run with reset=TRUE) emits every row as
+added.
+*/
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/artifacts"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/services/writeback"
+	"www.velocidex.com/golang/velociraptor/utils"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	vfilter "www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+// Rows are stored serialized, keyed by the key column.
+type diffSnapshot map[string][]string
+
+func snapshotPath(scope vfilter.Scope, name string) (string, error) {
+	client_config, ok := artifacts.GetConfig(scope)
+	if !ok {
+		return "", fmt.Errorf("diff_snapshot: Client config not available")
+	}
+
+	location, err := writeback.WritebackLocation(&config_proto.Config{
+		Client: client_config,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(name))
+	return filepath.Join(filepath.Dir(location), "snapshots",
+		hex.EncodeToString(hash[:16])+".json.z"), nil
+}
+
+func loadSnapshot(ctx context.Context, path string) (diffSnapshot, error) {
+	compressed, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := utils.Uncompress(ctx, compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(diffSnapshot)
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
+
+func storeSnapshot(path string, snapshot diffSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	compressed, err := utils.Compress(data)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	// Replace the old snapshot atomically so an interrupted write
+	// does not corrupt it.
+	tmp_path := path + ".tmp"
+	err = os.WriteFile(tmp_path, compressed, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp_path, path)
+}
+
+// The digest covers all current rows regardless of their order.
+func snapshotDigest(snapshot diffSnapshot) (string, int) {
+	var rows []string
+	for _, v := range snapshot {
+		rows = append(rows, v...)
+	}
+	sort.Strings(rows)
+
+	hash := sha256.New()
+	for _, row := range rows {
+		hash.Write([]byte(row))
+		hash.Write([]byte("\n"))
+	}
+	return hex.EncodeToString(hash.Sum(nil)), len(rows)
+}
+
+func parseRow(serialized string) *ordereddict.Dict {
+	row := ordereddict.NewDict()
+	_ = json.Unmarshal([]byte(serialized), row)
+	return row
+}
+
+type DiffSnapshotPluginArgs struct {
+	Query vfilter.StoredQuery `vfilter:"required,field=query,doc=The query to run."`
+	Key   string              `vfilter:"required,field=key,doc=The column to use as key."`
+	Name  string              `vfilter:"required,field=name,doc=A unique name for the stored snapshot."`
+	Reset bool                `vfilter:"optional,field=reset,doc=Ignore the previous snapshot and emit all rows."`
+}
+
+type DiffSnapshotPlugin struct{}
+
+func (self DiffSnapshotPlugin) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+		defer vql_subsystem.RegisterMonitor("diff_snapshot", args)()
+
+		err := vql_subsystem.CheckAccess(scope, acls.FILESYSTEM_WRITE)
+		if err != nil {
+			scope.Log("diff_snapshot: %v", err)
+			return
+		}
+
+		arg := &DiffSnapshotPluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("diff_snapshot: %v", err)
+			return
+		}
+
+		path, err := snapshotPath(scope, arg.Name)
+		if err != nil {
+			scope.Log("diff_snapshot: %v", err)
+			return
+		}
+
+		old_snapshot := make(diffSnapshot)
+		if !arg.Reset {
+			old_snapshot, err = loadSnapshot(ctx, path)
+			if err != nil {
+				scope.Log("diff_snapshot: No previous snapshot for %v, sending all rows",
+					arg.Name)
+				old_snapshot = make(diffSnapshot)
+			}
+		}
+
+		emit := func(row *ordereddict.Dict) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case output_chan <- row:
+				return true
+			}
+		}
+
+		opts := vql_subsystem.EncOptsFromScope(scope)
+		new_snapshot := make(diffSnapshot)
+		added := 0
+
+		subscope := scope.Copy()
+		defer subscope.Close()
+
+		for row := range arg.Query.Eval(ctx, subscope) {
+			key_any, pres := scope.Associative(row, arg.Key)
+			if !pres {
+				continue
+			}
+			key := fmt.Sprintf("%v", key_any)
+
+			dict_row := vfilter.RowToDict(ctx, subscope, row)
+			serialized, err := json.MarshalWithOptions(dict_row, opts)
+			if err != nil {
+				continue
+			}
+			new_snapshot[key] = append(new_snapshot[key], string(serialized))
+
+			// Remove unchanged rows from the old snapshot - what is
+			// left at the end was removed.
+			if removeRow(old_snapshot, key, string(serialized)) {
+				continue
+			}
+
+			added++
+			if !emit(dict_row.Set("Diff", "added")) {
+				return
+			}
+		}
+
+		// Do not replace the snapshot with a partial result set.
+		if ctx.Err() != nil {
+			return
+		}
+
+		removed := 0
+		for _, rows := range old_snapshot {
+			for _, serialized := range rows {
+				removed++
+				if !emit(parseRow(serialized).Set("Diff", "removed")) {
+					return
+				}
+			}
+		}
+
+		err = storeSnapshot(path, new_snapshot)
+		if err != nil {
+			scope.Log("diff_snapshot: Storing snapshot: %v", err)
+		}
+
+		digest, total := snapshotDigest(new_snapshot)
+		emit(ordereddict.NewDict().
+			Set("Diff", "summary").
+			Set("Digest", digest).
+			Set("TotalRows", total).
+			Set("Added", added).
+			Set("Removed", removed))
+	}()
+
+	return output_chan
+}
+
+func removeRow(snapshot diffSnapshot, key, serialized string) bool {
+	rows := snapshot[key]
+	for idx, row := range rows {
+		if row == serialized {
+			snapshot[key] = append(rows[:idx], rows[idx+1:]...)
+			if len(snapshot[key]) == 0 {
+				delete(snapshot, key)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (self DiffSnapshotPlugin) Info(
+	scope vfilter.Scope,
+	type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "diff_snapshot",
+		Doc:      "Run 'query' and emit only the differences from the snapshot stored by the last run.",
+		ArgType:  type_map.AddType(scope, &DiffSnapshotPluginArgs{}),
+		Metadata: vql_subsystem.VQLMetadata().Permissions(acls.FILESYSTEM_WRITE).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&DiffSnapshotPlugin{})
+}
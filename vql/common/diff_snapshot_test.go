@@ -0,0 +1,40 @@
+package common
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func TestDiffSnapshotStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshots", "test.json.z")
+
+	snapshot := diffSnapshot{
+		"a": {`{"Name":"a","Version":1}`},
+		"b": {`{"Name":"b","Version":1}`},
+	}
+	assert.NoError(t, storeSnapshot(path, snapshot))
+
+	loaded, err := loadSnapshot(context.Background(), path)
+	assert.NoError(t, err)
+	assert.Equal(t, snapshot, loaded)
+
+	// The digest does not depend on row order.
+	digest, total := snapshotDigest(snapshot)
+	assert.Equal(t, 2, total)
+
+	reordered_digest, _ := snapshotDigest(diffSnapshot{
+		"x": {`{"Name":"b","Version":1}`, `{"Name":"a","Version":1}`},
+	})
+	assert.Equal(t, digest, reordered_digest)
+
+	// Unchanged rows are removed from the old snapshot, leaving only
+	// the removed rows.
+	assert.True(t, removeRow(loaded, "a", `{"Name":"a","Version":1}`))
+	assert.True(t, !removeRow(loaded, "b", `{"Name":"b","Version":2}`))
+	assert.Equal(t, diffSnapshot{
+		"b": {`{"Name":"b","Version":1}`},
+	}, loaded)
+}
@@ -0,0 +1,61 @@
+package common
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/constants"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	vfilter "www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+// Implemented by the flow responder.
+type progressSetter interface {
+	SetProgress(total, done int64)
+}
+
+type ProgressFunctionArgs struct {
+	Total int64 `vfilter:"required,field=total,doc=The total number of items the query expects to process."`
+	Done  int64 `vfilter:"required,field=done,doc=The number of items processed so far."`
+}
+
+type ProgressFunction struct{}
+
+func (self *ProgressFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+	arg := &ProgressFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("progress: %s", err.Error())
+		return false
+	}
+
+	// Progress is only tracked when running inside a collection.
+	responder_any, pres := scope.GetContext(constants.SCOPE_RESPONDER_CONTEXT)
+	if !pres {
+		return false
+	}
+
+	responder, ok := responder_any.(progressSetter)
+	if !ok {
+		return false
+	}
+
+	responder.SetProgress(arg.Total, arg.Done)
+	return true
+}
+
+func (self *ProgressFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name: "progress",
+		Doc: "Report the query's progress so the server can estimate " +
+			"when the collection will complete.",
+		ArgType: type_map.AddType(scope, &ProgressFunctionArgs{}),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&ProgressFunction{})
+}
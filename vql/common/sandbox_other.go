@@ -0,0 +1,17 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package common
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func prepareSandbox(command *exec.Cmd) error {
+	return errors.New("Sandbox not supported on this platform")
+}
+
+func startSandbox(command *exec.Cmd) (func(), error) {
+	return nil, errors.New("Sandbox not supported on this platform")
+}
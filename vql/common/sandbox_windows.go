@@ -0,0 +1,74 @@
+//go:build windows
+// +build windows
+
+package common
+
+import (
+	"os/exec"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+func prepareSandbox(command *exec.Cmd) error {
+	return nil
+}
+
+// On Windows the command is placed in a job object which prevents
+// it from interacting with the desktop and kills it (and any
+// children) when the query is done.
+func startSandbox(command *exec.Cmd) (func(), error) {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{
+		BasicLimitInformation: windows.JOBOBJECT_BASIC_LIMIT_INFORMATION{
+			LimitFlags: windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE |
+				windows.JOB_OBJECT_LIMIT_DIE_ON_UNHANDLED_EXCEPTION,
+		},
+	}
+	_, err = windows.SetInformationJobObject(job,
+		windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&limits)), uint32(unsafe.Sizeof(limits)))
+	if err != nil {
+		windows.CloseHandle(job)
+		return nil, err
+	}
+
+	ui_limits := windows.JOBOBJECT_BASIC_UI_RESTRICTIONS{
+		UIRestrictionClass: windows.JOB_OBJECT_UILIMIT_DESKTOP |
+			windows.JOB_OBJECT_UILIMIT_DISPLAYSETTINGS |
+			windows.JOB_OBJECT_UILIMIT_EXITWINDOWS |
+			windows.JOB_OBJECT_UILIMIT_GLOBALATOMS |
+			windows.JOB_OBJECT_UILIMIT_HANDLES |
+			windows.JOB_OBJECT_UILIMIT_READCLIPBOARD |
+			windows.JOB_OBJECT_UILIMIT_SYSTEMPARAMETERS |
+			windows.JOB_OBJECT_UILIMIT_WRITECLIPBOARD,
+	}
+	_, err = windows.SetInformationJobObject(job,
+		windows.JobObjectBasicUIRestrictions,
+		uintptr(unsafe.Pointer(&ui_limits)), uint32(unsafe.Sizeof(ui_limits)))
+	if err != nil {
+		windows.CloseHandle(job)
+		return nil, err
+	}
+
+	process, err := windows.OpenProcess(
+		windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE,
+		false, uint32(command.Process.Pid))
+	if err != nil {
+		windows.CloseHandle(job)
+		return nil, err
+	}
+	defer windows.CloseHandle(process)
+
+	err = windows.AssignProcessToJobObject(job, process)
+	if err != nil {
+		windows.CloseHandle(job)
+		return nil, err
+	}
+
+	return func() { windows.CloseHandle(job) }, nil
+}
@@ -36,11 +36,12 @@ import (
 )
 
 type ShellPluginArgs struct {
-	Argv   []string         `vfilter:"required,field=argv,doc=Argv to run the command with."`
-	Sep    string           `vfilter:"optional,field=sep,doc=The separator that will be used to split the stdout into rows."`
-	Length int64            `vfilter:"optional,field=length,doc=Size of buffer to capture output per row."`
-	Env    vfilter.LazyExpr `vfilter:"optional,field=env,doc=Environment variables to launch with."`
-	Cwd    string           `vfilter:"optional,field=cwd,doc=If specified we change to this working directory first."`
+	Argv    []string         `vfilter:"required,field=argv,doc=Argv to run the command with."`
+	Sep     string           `vfilter:"optional,field=sep,doc=The separator that will be used to split the stdout into rows."`
+	Length  int64            `vfilter:"optional,field=length,doc=Size of buffer to capture output per row."`
+	Env     vfilter.LazyExpr `vfilter:"optional,field=env,doc=Environment variables to launch with."`
+	Cwd     string           `vfilter:"optional,field=cwd,doc=If specified we change to this working directory first."`
+	Sandbox bool             `vfilter:"optional,field=sandbox,doc=Run the command in a restricted sandbox (e.g. for third party tools)."`
 }
 
 type ShellResult struct {
@@ -124,6 +125,14 @@ func (self ShellPlugin) Call(
 		}
 		command.Dir = arg.Cwd
 
+		if arg.Sandbox {
+			err = prepareSandbox(command)
+			if err != nil {
+				scope.Log("execve: Preparing sandbox: %v", err)
+				return
+			}
+		}
+
 		stdout_pipe, err := command.StdoutPipe()
 		if err != nil {
 			scope.Log("execve: no command to run")
@@ -152,6 +161,19 @@ func (self ShellPlugin) Call(
 
 		}
 
+		if arg.Sandbox {
+			closer, err := startSandbox(command)
+			if err != nil {
+				// Do not let the command run outside the
+				// sandbox.
+				scope.Log("execve: Starting sandbox: %v", err)
+				_ = command.Process.Kill()
+				_ = command.Wait()
+				return
+			}
+			defer closer()
+		}
+
 		// We need to combine the status code with the stdout to
 		// minimize the total number of responses.  Send a copy of the
 		// response because we will continue modifying it.
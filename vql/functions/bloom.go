@@ -0,0 +1,157 @@
+package functions
+
+import (
+	"context"
+	"crypto/md5"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/utils"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Indicators are matched case insensitively.
+func normalizeIndicator(item string) string {
+	return strings.ToLower(strings.TrimSpace(item))
+}
+
+type BloomFilterFunctionArgs struct {
+	Items  types.LazyExpr `vfilter:"required,field=items,doc=A list of items or a query to add to the filter."`
+	Column string         `vfilter:"optional,field=column,doc=If items is a query, use this column from each row."`
+	FPRate float64        `vfilter:"optional,field=fp_rate,doc=The false positive rate of the filter (default 0.001)."`
+}
+
+type BloomFilterFunction struct{}
+
+func (self *BloomFilterFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+	defer vql_subsystem.RegisterMonitor("bloom_filter", args)()
+
+	arg := &BloomFilterFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("bloom_filter: %v", err)
+		return vfilter.Null{}
+	}
+
+	if arg.FPRate == 0 {
+		arg.FPRate = 0.001
+	}
+
+	// The filter is sized for the number of items so we need to
+	// collect them first.
+	var items []string
+
+	// Items in a list are iterated as rows with a _value column.
+	if arg.Column == "" {
+		arg.Column = "_value"
+	}
+
+	for row := range scope.Iterate(ctx, arg.Items.Reduce(ctx)) {
+		value, _ := scope.Associative(row, arg.Column)
+		item, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		item = normalizeIndicator(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	filter, err := utils.NewBloomFilter(uint64(len(items)), arg.FPRate)
+	if err != nil {
+		scope.Log("bloom_filter: %v", err)
+		return vfilter.Null{}
+	}
+
+	for _, item := range items {
+		filter.Add(item)
+	}
+
+	serialized, err := filter.Serialize()
+	if err != nil {
+		scope.Log("bloom_filter: %v", err)
+		return vfilter.Null{}
+	}
+
+	return serialized
+}
+
+func (self BloomFilterFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:    "bloom_filter",
+		Doc:     "Build a serialized bloom filter from a list of indicators.",
+		ArgType: type_map.AddType(scope, &BloomFilterFunctionArgs{}),
+	}
+}
+
+type BloomCheckFunctionArgs struct {
+	Filter string `vfilter:"required,field=filter,doc=A serialized bloom filter as produced by bloom_filter()."`
+	Item   string `vfilter:"required,field=item,doc=The item to check."`
+}
+
+type BloomCheckFunction struct{}
+
+func (self *BloomCheckFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+	defer vql_subsystem.RegisterMonitor("bloom_check", args)()
+
+	arg := &BloomCheckFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("bloom_check: %v", err)
+		return false
+	}
+
+	filter, err := getBloomFilter(scope, arg.Filter)
+	if err != nil {
+		scope.Log("bloom_check: %v", err)
+		return false
+	}
+
+	return filter.Test(normalizeIndicator(arg.Item))
+}
+
+// Filters may be large so we only parse them once per query.
+func getBloomFilter(scope vfilter.Scope, serialized string) (
+	*utils.BloomFilter, error) {
+	hash := md5.Sum([]byte(serialized))
+	key := "bloom_filter_" + string(hash[:])
+
+	switch t := vql_subsystem.CacheGet(scope, key).(type) {
+	case *utils.BloomFilter:
+		return t, nil
+	case error:
+		return nil, t
+	}
+
+	filter, err := utils.ParseBloomFilter(serialized)
+	if err != nil {
+		vql_subsystem.CacheSet(scope, key, err)
+		return nil, err
+	}
+
+	vql_subsystem.CacheSet(scope, key, filter)
+	return filter, nil
+}
+
+func (self BloomCheckFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name: "bloom_check",
+		Doc: "Check if an item may be in a bloom filter. Matches may be " +
+			"false positives and should be verified.",
+		ArgType: type_map.AddType(scope, &BloomCheckFunctionArgs{}),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&BloomFilterFunction{})
+	vql_subsystem.RegisterFunction(&BloomCheckFunction{})
+}
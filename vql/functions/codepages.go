@@ -0,0 +1,109 @@
+package functions
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+// Windows code page numbers which are not named windows-<number>.
+var windowsCodePages = map[int]encoding.Encoding{
+	437:   charmap.CodePage437,
+	850:   charmap.CodePage850,
+	866:   charmap.CodePage866,
+	932:   japanese.ShiftJIS,
+	936:   simplifiedchinese.GBK,
+	949:   korean.EUCKR,
+	950:   traditionalchinese.Big5,
+	20866: charmap.KOI8R,
+	21866: charmap.KOI8U,
+	28591: charmap.ISO8859_1,
+	54936: simplifiedchinese.GB18030,
+	65001: unicode.UTF8,
+}
+
+// Resolve an encoding from a name like "utf-16le", "windows-1251",
+// "cp1251" or a bare Windows code page number like "932".
+func getEncoding(name string) (encoding.Encoding, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "", "utf16", "utf-16", "utf16le", "utf-16le":
+		return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), nil
+
+	case "utf16be", "utf-16be":
+		return unicode.UTF16(unicode.BigEndian, unicode.UseBOM), nil
+	}
+
+	number, err := strconv.Atoi(strings.TrimPrefix(name, "cp"))
+	if err == nil {
+		enc, pres := windowsCodePages[number]
+		if pres {
+			return enc, nil
+		}
+		name = fmt.Sprintf("windows-%d", number)
+	}
+
+	return htmlindex.Get(name)
+}
+
+type DecodeTextArgs struct {
+	String   string `vfilter:"required,field=string,doc=The raw bytes to decode"`
+	Encoding string `vfilter:"optional,field=encoding,doc=The encoding or Windows code page (e.g. utf16be, windows-1251, cp932). Default utf16le."`
+}
+
+type DecodeTextFunction struct{}
+
+func (self DecodeTextFunction) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+	defer vql_subsystem.RegisterMonitor("decode_text", args)()
+
+	arg := &DecodeTextArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("decode_text: %s", err.Error())
+		return vfilter.Null{}
+	}
+
+	enc, err := getEncoding(arg.Encoding)
+	if err != nil {
+		scope.Log("decode_text: %v: %v", arg.Encoding, err)
+		return vfilter.Null{}
+	}
+
+	decoded, err := enc.NewDecoder().String(arg.String)
+	if err != nil {
+		scope.Log("decode_text: %v", err)
+		return vfilter.Null{}
+	}
+
+	// Windows strings are often NUL terminated.
+	return strings.TrimRight(decoded, "\x00")
+}
+
+func (self DecodeTextFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:    "decode_text",
+		Doc:     "Decode text from UTF-16 or a Windows code page into UTF-8.",
+		ArgType: type_map.AddType(scope, &DecodeTextArgs{}),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&DecodeTextFunction{})
+}
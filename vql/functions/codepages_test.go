@@ -0,0 +1,29 @@
+package functions
+
+import (
+	"testing"
+
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func TestDecodeText(t *testing.T) {
+	for _, tc := range []struct {
+		encoding, data, expected string
+	}{
+		{"", "h\x00i\x00", "hi"},
+		{"utf16be", "\x00h\x00i", "hi"},
+		{"cp1251", "\xcf\xf0\xe8\xe2\xe5\xf2", "Привет"},
+		{"windows-1251", "\xcf\xf0\xe8\xe2\xe5\xf2", "Привет"},
+		{"932", "\x93\xfa\x96\x7b", "日本"},
+	} {
+		enc, err := getEncoding(tc.encoding)
+		assert.NoError(t, err)
+
+		decoded, err := enc.NewDecoder().String(tc.data)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, decoded)
+	}
+
+	_, err := getEncoding("cp9999")
+	assert.Error(t, err)
+}
@@ -0,0 +1,50 @@
+package functions
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/utils"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type CompareVersionsArgs struct {
+	A    string `vfilter:"required,field=a,doc=The first version to compare"`
+	B    string `vfilter:"required,field=b,doc=The second version to compare"`
+	Tool string `vfilter:"optional,field=tool,doc=The tool the versions belong to (default velociraptor)"`
+}
+
+type CompareVersionsFunction struct{}
+
+func (self *CompareVersionsFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+	defer vql_subsystem.RegisterMonitor("compare_versions", args)()
+
+	arg := &CompareVersionsArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("compare_versions: %s", err.Error())
+		return vfilter.Null{}
+	}
+
+	if arg.Tool == "" {
+		arg.Tool = "velociraptor"
+	}
+
+	return utils.CompareVersions(arg.Tool, arg.A, arg.B)
+}
+
+func (self CompareVersionsFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:    "compare_versions",
+		Doc:     "Compare two versions. Returns -1 if a < b, 0 if they are equal and 1 if a > b.",
+		ArgType: type_map.AddType(scope, &CompareVersionsArgs{}),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&CompareVersionsFunction{})
+}
@@ -0,0 +1,283 @@
+package networking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	vfilter "www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+var (
+	// Can be overridden in tests.
+	awsMetadataURL   = "http://169.254.169.254"
+	azureMetadataURL = "http://169.254.169.254"
+	gcpMetadataURL   = "http://metadata.google.internal"
+
+	notFoundError = errors.New("Not found")
+)
+
+// The metadata services are link local and must never be reached
+// through a proxy. Use short timeouts since most machines are not
+// in the cloud and the request will simply time out.
+func newMetadataClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: nil,
+			DialContext: (&net.Dialer{
+				Timeout: timeout,
+			}).DialContext,
+		},
+	}
+}
+
+func metadataRequest(ctx context.Context, client *http.Client,
+	method, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %v", notFoundError, resp.Status)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+}
+
+func metadataJSON(ctx context.Context, client *http.Client,
+	url string, headers map[string]string) (*ordereddict.Dict, error) {
+	data, err := metadataRequest(ctx, client, "GET", url, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ordereddict.NewDict()
+	err = json.Unmarshal(data, result)
+	return result, err
+}
+
+// Lines returned by the AWS listing endpoints.
+func metadataList(ctx context.Context, client *http.Client,
+	url string, headers map[string]string) []string {
+	result := []string{}
+	data, err := metadataRequest(ctx, client, "GET", url, headers)
+	if err != nil {
+		return result
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// AWS IMDSv2 requires a session token obtained with a PUT request.
+func getAWSMetadata(ctx context.Context,
+	client *http.Client) (*ordereddict.Dict, error) {
+	token, err := metadataRequest(ctx, client, "PUT",
+		awsMetadataURL+"/latest/api/token", map[string]string{
+			"X-aws-ec2-metadata-token-ttl-seconds": "60",
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{
+		"X-aws-ec2-metadata-token": string(token),
+	}
+
+	identity, err := metadataJSON(ctx, client,
+		awsMetadataURL+"/latest/dynamic/instance-identity/document", headers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only report the role names - never the credentials.
+	roles := metadataList(ctx, client,
+		awsMetadataURL+"/latest/meta-data/iam/security-credentials/", headers)
+
+	// Tags are only available if enabled on the instance.
+	tags := ordereddict.NewDict()
+	for _, key := range metadataList(ctx, client,
+		awsMetadataURL+"/latest/meta-data/tags/instance", headers) {
+		value, err := metadataRequest(ctx, client, "GET",
+			awsMetadataURL+"/latest/meta-data/tags/instance/"+key, headers)
+		if err == nil {
+			tags.Set(key, string(value))
+		}
+	}
+
+	return ordereddict.NewDict().
+		Set("Provider", "AWS").
+		Set("InstanceId", getString(identity, "instanceId")).
+		Set("Region", getString(identity, "region")).
+		Set("Account", getString(identity, "accountId")).
+		Set("Roles", roles).
+		Set("Tags", tags).
+		Set("Identity", identity), nil
+}
+
+func getAzureMetadata(ctx context.Context,
+	client *http.Client) (*ordereddict.Dict, error) {
+	instance, err := metadataJSON(ctx, client,
+		azureMetadataURL+"/metadata/instance?api-version=2021-02-01",
+		map[string]string{"Metadata": "true"})
+	if err != nil {
+		return nil, err
+	}
+
+	compute := ordereddict.NewDict()
+	compute_any, pres := instance.Get("compute")
+	if pres {
+		compute_dict, ok := compute_any.(*ordereddict.Dict)
+		if ok {
+			compute = compute_dict
+		}
+	}
+
+	// Managed identities are not listed in the instance metadata.
+	return ordereddict.NewDict().
+		Set("Provider", "Azure").
+		Set("InstanceId", getString(compute, "vmId")).
+		Set("Region", getString(compute, "location")).
+		Set("Account", getString(compute, "subscriptionId")).
+		Set("Roles", []string{}).
+		Set("Tags", getAny(compute, "tagsList")).
+		Set("Identity", instance), nil
+}
+
+func getGCPMetadata(ctx context.Context,
+	client *http.Client) (*ordereddict.Dict, error) {
+	headers := map[string]string{"Metadata-Flavor": "Google"}
+	instance, err := metadataJSON(ctx, client,
+		gcpMetadataURL+"/computeMetadata/v1/instance/?recursive=true",
+		headers)
+	if err != nil {
+		return nil, err
+	}
+
+	project, _ := metadataRequest(ctx, client, "GET",
+		gcpMetadataURL+"/computeMetadata/v1/project/project-id", headers)
+
+	// The zone is given as projects/<number>/zones/<zone>
+	zone := getString(instance, "zone")
+	zone = zone[strings.LastIndex(zone, "/")+1:]
+
+	// Service accounts are keyed by their email. The recursive
+	// listing does not include tokens.
+	roles := []string{}
+	accounts_any, pres := instance.Get("serviceAccounts")
+	if pres {
+		accounts, ok := accounts_any.(*ordereddict.Dict)
+		if ok {
+			for _, k := range accounts.Keys() {
+				if k != "default" {
+					roles = append(roles, k)
+				}
+			}
+		}
+	}
+
+	return ordereddict.NewDict().
+		Set("Provider", "GCP").
+		Set("InstanceId", fmt.Sprintf("%v", getAny(instance, "id"))).
+		Set("Region", zone).
+		Set("Account", string(project)).
+		Set("Roles", roles).
+		Set("Tags", getAny(instance, "tags")).
+		Set("Identity", instance), nil
+}
+
+func getString(dict *ordereddict.Dict, key string) string {
+	value, _ := dict.GetString(key)
+	return value
+}
+
+func getAny(dict *ordereddict.Dict, key string) interface{} {
+	value, _ := dict.Get(key)
+	return value
+}
+
+type CloudMetadataFunctionArgs struct {
+	Timeout int64 `vfilter:"optional,field=timeout,doc=Timeout in seconds for each metadata service (default 2)."`
+}
+
+type CloudMetadataFunction struct{}
+
+func (self *CloudMetadataFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	defer vql_subsystem.RegisterMonitor("cloud_metadata", args)()
+
+	err := vql_subsystem.CheckAccess(scope, acls.MACHINE_STATE)
+	if err != nil {
+		scope.Log("cloud_metadata: %v", err)
+		return vfilter.Null{}
+	}
+
+	arg := &CloudMetadataFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("cloud_metadata: %v", err)
+		return vfilter.Null{}
+	}
+
+	if arg.Timeout == 0 {
+		arg.Timeout = 2
+	}
+
+	client := newMetadataClient(time.Duration(arg.Timeout) * time.Second)
+
+	// Try each provider in turn - only one will answer.
+	for _, getter := range []func(context.Context, *http.Client) (
+		*ordereddict.Dict, error){
+		getAWSMetadata, getAzureMetadata, getGCPMetadata} {
+		result, err := getter(ctx, client)
+		if err == nil {
+			return result
+		}
+	}
+
+	return vfilter.Null{}
+}
+
+func (self *CloudMetadataFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "cloud_metadata",
+		Doc:      "Query the cloud instance metadata service (AWS, Azure or GCP) if present.",
+		ArgType:  type_map.AddType(scope, &CloudMetadataFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.MACHINE_STATE).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&CloudMetadataFunction{})
+}
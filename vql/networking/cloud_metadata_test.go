@@ -0,0 +1,95 @@
+package networking
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func TestAWSMetadata(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			if r.Method != "PUT" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			fmt.Fprint(w, "token")
+			return
+		}
+
+		// IMDSv2 requires the session token.
+		if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/latest/dynamic/instance-identity/document":
+			fmt.Fprint(w, `{"instanceId": "i-1234", "region": "us-east-1", "accountId": "1111"}`)
+		case "/latest/meta-data/iam/security-credentials/":
+			fmt.Fprint(w, "MyRole\n")
+		case "/latest/meta-data/tags/instance":
+			fmt.Fprint(w, "Name\nOwner")
+		case "/latest/meta-data/tags/instance/Name":
+			fmt.Fprint(w, "web1")
+		case "/latest/meta-data/tags/instance/Owner":
+			fmt.Fprint(w, "ops")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	awsMetadataURL = ts.URL
+	result, err := getAWSMetadata(context.Background(),
+		newMetadataClient(time.Second))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "i-1234", getString(result, "InstanceId"))
+	assert.Equal(t, "us-east-1", getString(result, "Region"))
+	assert.Equal(t, []string{"MyRole"}, getAny(result, "Roles"))
+
+	tags, ok := getAny(result, "Tags").(*ordereddict.Dict)
+	assert.True(t, ok)
+	assert.Equal(t, "web1", getString(tags, "Name"))
+	assert.Equal(t, "ops", getString(tags, "Owner"))
+}
+
+func TestGCPMetadata(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/":
+			fmt.Fprint(w, `{"id": 5712345678901234567,
+  "zone": "projects/1234/zones/us-central1-a",
+  "serviceAccounts": {"default": {}, "sa@proj.iam.gserviceaccount.com": {}},
+  "tags": ["http-server"]}`)
+		case "/computeMetadata/v1/project/project-id":
+			fmt.Fprint(w, "proj")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	gcpMetadataURL = ts.URL
+	result, err := getGCPMetadata(context.Background(),
+		newMetadataClient(time.Second))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "5712345678901234567", getString(result, "InstanceId"))
+	assert.Equal(t, "us-central1-a", getString(result, "Region"))
+	assert.Equal(t, "proj", getString(result, "Account"))
+	assert.Equal(t, []string{"sa@proj.iam.gserviceaccount.com"},
+		getAny(result, "Roles"))
+}
@@ -0,0 +1,283 @@
+package networking
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/artifacts"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/constants"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	vfilter "www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type ConnectivityTestPluginArgs struct {
+	Urls         []string `vfilter:"optional,field=urls,doc=The server URLs to test (default the client's server_urls)."`
+	BandwidthUrl string   `vfilter:"optional,field=bandwidth_url,doc=Download this URL to estimate the bandwidth."`
+	Timeout      int64    `vfilter:"optional,field=timeout,doc=Timeout in seconds for each test (default 10)."`
+}
+
+// The outcome of a single connectivity test.
+type connectivityResult struct {
+	Address   string `json:"Address,omitempty"`
+	Connected bool   `json:"Connected"`
+	LatencyMs int64  `json:"LatencyMs"`
+	Error     string `json:"Error,omitempty"`
+}
+
+type ConnectivityTestPlugin struct{}
+
+func (self ConnectivityTestPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+		defer vql_subsystem.RegisterMonitor("connectivity_test", args)()
+
+		err := vql_subsystem.CheckAccess(scope, acls.MACHINE_STATE)
+		if err != nil {
+			scope.Log("connectivity_test: %v", err)
+			return
+		}
+
+		arg := &ConnectivityTestPluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("connectivity_test: %v", err)
+			return
+		}
+
+		if arg.Timeout == 0 {
+			arg.Timeout = 10
+		}
+
+		config_obj, _ := artifacts.GetConfig(scope)
+		if config_obj == nil {
+			config_obj = &config_proto.ClientConfig{}
+		}
+
+		urls := arg.Urls
+		if len(urls) == 0 {
+			urls = config_obj.ServerUrls
+		}
+
+		if len(urls) == 0 {
+			scope.Log("connectivity_test: No server URLs to test")
+			return
+		}
+
+		transport, err := GetHttpTransport(config_obj, "")
+		if err != nil {
+			scope.Log("connectivity_test: %v", err)
+			return
+		}
+
+		timeout := time.Duration(arg.Timeout) * time.Second
+		client := &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		}
+
+		for _, server_url := range urls {
+			row := testConnectivity(ctx, client, server_url,
+				arg.BandwidthUrl, timeout)
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+// Test the connectivity to a single server URL: resolve its name,
+// connect to it directly over IPv4 and IPv6 and then fetch the
+// server.pem through the proxy (if any) the same way the
+// communicator would.
+func testConnectivity(ctx context.Context, client *http.Client,
+	server_url, bandwidth_url string, timeout time.Duration) *ordereddict.Dict {
+
+	// Websocket urls are served over the same https port.
+	server_url = strings.Replace(server_url, "wss://", "https://", 1)
+	server_url = strings.Replace(server_url, "ws://", "http://", 1)
+
+	row := ordereddict.NewDict()
+
+	parsed, err := url.Parse(server_url)
+	if err != nil {
+		return row.Set("Url", server_url).Set("Error", err.Error())
+	}
+
+	// Server urls may contain credentials which must not be
+	// reported.
+	row.Set("Url", parsed.Redacted())
+
+	host := parsed.Hostname()
+	port := parsed.Port()
+	if port == "" {
+		port = "443"
+		if parsed.Scheme == "http" {
+			port = "80"
+		}
+	}
+	row.Set("Host", host).Set("Port", port)
+
+	// Report which proxy the request will go through.
+	proxy := ""
+	req, err := http.NewRequestWithContext(ctx, "GET",
+		strings.TrimSuffix(server_url, "/")+"/server.pem", nil)
+	transport, ok := client.Transport.(*http.Transport)
+	if err == nil && ok && transport.Proxy != nil {
+		proxy_url, err := transport.Proxy(req)
+		if err != nil {
+			proxy = "Error: " + err.Error()
+		} else if proxy_url != nil {
+			proxy = proxy_url.Redacted()
+		}
+	}
+	row.Set("Proxy", proxy)
+
+	// DNS resolution
+	sub_ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupIPAddr(sub_ctx, host)
+	dns := ordereddict.NewDict().
+		Set("LatencyMs", time.Since(start).Milliseconds())
+
+	ipv4 := []string{}
+	ipv6 := []string{}
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			ipv4 = append(ipv4, addr.IP.String())
+		} else {
+			ipv6 = append(ipv6, addr.IP.String())
+		}
+	}
+	dns.Set("IPv4", ipv4).Set("IPv6", ipv6)
+	if err != nil {
+		dns.Set("Error", err.Error())
+	}
+	row.Set("DNS", dns)
+
+	// Direct egress over each address family. This bypasses the
+	// proxy so it shows whether the network allows the connection
+	// at all.
+	row.Set("IPv4", dialOnce(ctx, "tcp4", ipv4, port, timeout))
+	row.Set("IPv6", dialOnce(ctx, "tcp6", ipv6, port, timeout))
+
+	// The actual request as the communicator would make it.
+	if req == nil {
+		return row
+	}
+	req.Header.Set("User-Agent", constants.USER_AGENT)
+	row.Set("Request", fetchOnce(client, req))
+
+	// Estimate the bandwidth by downloading a (preferably large)
+	// file.
+	if bandwidth_url != "" {
+		req, err := http.NewRequestWithContext(ctx, "GET", bandwidth_url, nil)
+		if err != nil {
+			row.Set("Bandwidth", ordereddict.NewDict().
+				Set("Error", err.Error()))
+			return row
+		}
+		req.Header.Set("User-Agent", constants.USER_AGENT)
+		row.Set("Bandwidth", fetchOnce(client, req))
+	}
+
+	return row
+}
+
+func dialOnce(ctx context.Context, network string,
+	addresses []string, port string, timeout time.Duration) *connectivityResult {
+	if len(addresses) == 0 {
+		return &connectivityResult{Error: "No address"}
+	}
+
+	result := &connectivityResult{
+		Address: net.JoinHostPort(addresses[0], port),
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, network, result.Address)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	conn.Close()
+	result.Connected = true
+
+	return result
+}
+
+func fetchOnce(client *http.Client, req *http.Request) *ordereddict.Dict {
+	result := ordereddict.NewDict()
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return result.
+			Set("LatencyMs", time.Since(start).Milliseconds()).
+			Set("Error", err.Error())
+	}
+	defer resp.Body.Close()
+
+	result.Set("LatencyMs", time.Since(start).Milliseconds()).
+		Set("Status", resp.StatusCode)
+
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		cert := resp.TLS.PeerCertificates[0]
+		result.Set("Certificate", ordereddict.NewDict().
+			Set("Subject", cert.Subject.String()).
+			Set("Issuer", cert.Issuer.String()).
+			Set("NotAfter", cert.NotAfter))
+	}
+
+	body_start := time.Now()
+	n, err := io.Copy(io.Discard, resp.Body)
+	elapsed := time.Since(body_start)
+	result.Set("Bytes", n)
+	if err != nil {
+		result.Set("Error", err.Error())
+	}
+
+	// Very small downloads are dominated by latency so this is
+	// only a rough estimate.
+	if elapsed > 0 {
+		result.Set("BytesPerSecond", int64(float64(n)/elapsed.Seconds()))
+	}
+
+	return result
+}
+
+func (self ConnectivityTestPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "connectivity_test",
+		Doc:      "Test the connectivity to the server URLs (DNS, proxy, IPv4/IPv6 egress and bandwidth).",
+		ArgType:  type_map.AddType(scope, &ConnectivityTestPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.MACHINE_STATE).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&ConnectivityTestPlugin{})
+}
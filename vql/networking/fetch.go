@@ -0,0 +1,364 @@
+package networking
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/artifacts"
+	"www.velocidex.com/golang/velociraptor/constants"
+	"www.velocidex.com/golang/velociraptor/uploads"
+	"www.velocidex.com/golang/velociraptor/utils"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+const (
+	// Partial downloads are kept next to the destination with this
+	// suffix so they can be resumed.
+	PARTIAL_SUFFIX = ".partial"
+
+	DEFAULT_FETCH_CHUNK_SIZE = 1024 * 1024
+	DEFAULT_FETCH_RETRIES    = 5
+)
+
+var (
+	fetchHashMismatchError = errors.New("Hash mismatch")
+)
+
+type FetchFileFunctionArgs struct {
+	Url        string `vfilter:"required,field=url,doc=The URL to fetch."`
+	Dest       string `vfilter:"required,field=dest,doc=The path to store the file in."`
+	Sha256     string `vfilter:"optional,field=sha256,doc=The expected hash of the file. The file is removed if it does not match."`
+	ChunkSize  int64  `vfilter:"optional,field=chunk_size,doc=Fetch the file in chunks of this size (default 1mb)."`
+	RateLimit  uint64 `vfilter:"optional,field=rate_limit,doc=Maximum download rate in bytes per second (default unlimited)."`
+	Retries    int64  `vfilter:"optional,field=retries,doc=Number of times to retry a failed chunk (default 5)."`
+	Executable bool   `vfilter:"optional,field=executable,doc=Make the file executable."`
+	RootCerts  string `vfilter:"optional,field=root_ca,doc=Additional root CA certificates to trust."`
+	SkipVerify bool   `vfilter:"optional,field=skip_verify,doc=Disable ssl certificate verifications."`
+}
+
+type FetchFileFunction struct{}
+
+func (self *FetchFileFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	defer vql_subsystem.RegisterMonitor("fetch_file", args)()
+
+	err := vql_subsystem.CheckAccess(scope, acls.FILESYSTEM_WRITE)
+	if err != nil {
+		scope.Log("fetch_file: %s", err)
+		return vfilter.Null{}
+	}
+
+	arg := &FetchFileFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("fetch_file: %s", err.Error())
+		return vfilter.Null{}
+	}
+
+	config_obj, _ := artifacts.GetConfig(scope)
+	client, err := GetHttpClient(ctx, config_obj, scope, &HttpPluginRequest{
+		Url:        arg.Url,
+		RootCerts:  arg.RootCerts,
+		SkipVerify: arg.SkipVerify,
+	})
+	if err != nil {
+		scope.Log("fetch_file: %v", err)
+		return vfilter.Null{}
+	}
+
+	fetcher := &fileFetcher{
+		client:     client,
+		url:        arg.Url,
+		dest:       arg.Dest,
+		sha256:     strings.ToLower(arg.Sha256),
+		chunk_size: arg.ChunkSize,
+		rate_limit: arg.RateLimit,
+		retries:    arg.Retries,
+		log:        scope.Log,
+	}
+
+	result, err := fetcher.Fetch(ctx)
+	if err != nil {
+		scope.Log("fetch_file: %v: %v", arg.Url, err)
+		return vfilter.Null{}
+	}
+
+	if arg.Executable && runtime.GOOS != "windows" {
+		err = os.Chmod(arg.Dest, 0700)
+		if err != nil {
+			scope.Log("fetch_file: %v", err)
+			return vfilter.Null{}
+		}
+	}
+
+	return result
+}
+
+func (self FetchFileFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name: "fetch_file",
+		Doc: "Download a large file in chunks, resuming interrupted downloads " +
+			"and verifying its hash.",
+		ArgType:  type_map.AddType(scope, &FetchFileFunctionArgs{}),
+		Metadata: vql_subsystem.VQLMetadata().Permissions(acls.FILESYSTEM_WRITE).Build(),
+	}
+}
+
+// Downloads a file into a partial file using range requests. If the
+// download is interrupted (e.g. the client restarts or loses its
+// connection) the next attempt continues from the end of the partial
+// file. Once complete the hash is verified and the partial file is
+// moved into place.
+type fileFetcher struct {
+	client     HTTPClient
+	url        string
+	dest       string
+	sha256     string
+	chunk_size int64
+	rate_limit uint64
+	retries    int64
+	log        func(format string, args ...interface{})
+}
+
+func (self *fileFetcher) Fetch(ctx context.Context) (*ordereddict.Dict, error) {
+	if self.chunk_size <= 0 {
+		self.chunk_size = DEFAULT_FETCH_CHUNK_SIZE
+	}
+
+	if self.retries <= 0 {
+		self.retries = DEFAULT_FETCH_RETRIES
+	}
+
+	// The file is already there - no need to fetch it again.
+	if self.sha256 != "" {
+		hash, size, err := hashFile(self.dest)
+		if err == nil && hash == self.sha256 {
+			return self.result(size, 0, "Cached"), nil
+		}
+	}
+
+	partial := self.dest + PARTIAL_SUFFIX
+	fd, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	offset, err := fd.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	resumed := offset
+	if resumed > 0 {
+		self.log("fetch_file: Resuming download of %v from offset %v",
+			self.url, resumed)
+	}
+
+	var failures int64
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		n, done, err := self.fetchChunk(ctx, fd, offset)
+		offset += n
+
+		if err != nil {
+			// Any progress resets the retry count.
+			if n > 0 {
+				failures = 0
+			}
+			failures++
+			if failures > self.retries {
+				return nil, err
+			}
+
+			delay := time.Duration(1<<uint(failures-1)) * time.Second
+			if delay > 30*time.Second {
+				delay = 30 * time.Second
+			}
+			self.log("fetch_file: %v, retrying in %v", err, delay)
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-utils.GetTime().After(delay):
+			}
+			continue
+		}
+
+		failures = 0
+		if done {
+			break
+		}
+	}
+
+	err = fd.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	hash, size, err := hashFile(partial)
+	if err != nil {
+		return nil, err
+	}
+
+	// A corrupted partial file can not be resumed so start again
+	// next time.
+	if self.sha256 != "" && hash != self.sha256 {
+		os.Remove(partial)
+		return nil, fmt.Errorf("%w: got %v, expected %v",
+			fetchHashMismatchError, hash, self.sha256)
+	}
+
+	// Windows can not rename over an existing file.
+	os.Remove(self.dest)
+	err = os.Rename(partial, self.dest)
+	if err != nil {
+		return nil, err
+	}
+
+	result := self.result(size, resumed, "Downloaded")
+	result.Set("Sha256", hash)
+	return result, nil
+}
+
+func (self *fileFetcher) result(
+	size, resumed int64, status string) *ordereddict.Dict {
+	return ordereddict.NewDict().
+		Set("OSPath", self.dest).
+		Set("Size", size).
+		Set("Sha256", self.sha256).
+		Set("Resumed", resumed).
+		Set("DownloadStatus", status)
+}
+
+// Fetch the next chunk at offset and append it to fd. Returns the
+// number of bytes written and if the download is complete.
+func (self *fileFetcher) fetchChunk(ctx context.Context,
+	fd *os.File, offset int64) (int64, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", self.url, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("User-Agent", constants.USER_AGENT)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d",
+		offset, offset+self.chunk_size-1))
+
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	reader := uploads.NewThrottledReader(ctx, resp.Body, self.rate_limit)
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, total, err := parseContentRange(
+			resp.Header.Get("Content-Range"))
+		if err != nil {
+			return 0, false, err
+		}
+
+		if start != offset {
+			return 0, false, fmt.Errorf(
+				"Server returned range at %v, expected %v", start, offset)
+		}
+
+		n, err := io.Copy(fd, reader)
+		if err != nil {
+			return n, false, err
+		}
+		return n, offset+n >= total, nil
+
+	// The server does not support ranges and sent the whole file.
+	case http.StatusOK:
+		err = truncate(fd)
+		if err != nil {
+			return 0, false, err
+		}
+
+		n, err := io.Copy(fd, reader)
+		if err != nil {
+			// Start again next time.
+			_ = truncate(fd)
+			return 0, false, err
+		}
+		return n - offset, true, nil
+
+	// The partial file is already complete (or larger than the
+	// file). The hash check will decide if it is usable.
+	case http.StatusRequestedRangeNotSatisfiable:
+		return 0, true, nil
+
+	default:
+		return 0, false, fmt.Errorf("Server returned %v", resp.Status)
+	}
+}
+
+func truncate(fd *os.File) error {
+	err := fd.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = fd.Seek(0, io.SeekStart)
+	return err
+}
+
+// Parse a Content-Range header like "bytes 0-1023/4096"
+func parseContentRange(header string) (start int64, total int64, err error) {
+	header = strings.TrimPrefix(header, "bytes ")
+	parts := strings.SplitN(header, "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("Invalid Content-Range %q", header)
+	}
+
+	range_parts := strings.SplitN(parts[0], "-", 2)
+	start, err = strconv.ParseInt(range_parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid Content-Range %q", header)
+	}
+
+	total, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid Content-Range %q", header)
+	}
+
+	return start, total, nil
+}
+
+func hashFile(path string) (string, int64, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer fd.Close()
+
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, fd)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), n, nil
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&FetchFileFunction{})
+}
@@ -0,0 +1,89 @@
+package networking
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func TestFetchFile(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	hash := sha256.Sum256(data)
+	expected_hash := hex.EncodeToString(hash[:])
+
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&requests, 1)
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "tool.exe")
+
+	// Simulate an interrupted download.
+	err := os.WriteFile(dest+PARTIAL_SUFFIX, data[:4000], 0600)
+	assert.NoError(t, err)
+
+	fetcher := &fileFetcher{
+		client:     server.Client(),
+		url:        server.URL + "/public/tool.exe",
+		dest:       dest,
+		sha256:     expected_hash,
+		chunk_size: 1024,
+		log:        t.Logf,
+	}
+
+	result, err := fetcher.Fetch(context.Background())
+	assert.NoError(t, err)
+
+	resumed, _ := result.Get("Resumed")
+	assert.Equal(t, int64(4000), resumed)
+
+	// The remaining 6000 bytes are fetched in 1kb chunks.
+	assert.Equal(t, int64(6), atomic.LoadInt64(&requests))
+
+	written, err := os.ReadFile(dest)
+	assert.NoError(t, err)
+	assert.Equal(t, data, written)
+
+	_, err = os.Stat(dest + PARTIAL_SUFFIX)
+	assert.True(t, os.IsNotExist(err))
+
+	// A second fetch uses the existing file.
+	result, err = fetcher.Fetch(context.Background())
+	assert.NoError(t, err)
+	status, _ := result.Get("DownloadStatus")
+	assert.Equal(t, "Cached", status)
+	assert.Equal(t, int64(6), atomic.LoadInt64(&requests))
+
+	// A file with the wrong hash is rejected and removed.
+	fetcher.dest = filepath.Join(dir, "bad.exe")
+	fetcher.sha256 = "0000"
+	_, err = fetcher.Fetch(context.Background())
+	assert.ErrorContains(t, err, "Hash mismatch")
+
+	_, err = os.Stat(fetcher.dest + PARTIAL_SUFFIX)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestParseContentRange(t *testing.T) {
+	start, total, err := parseContentRange("bytes 1024-2047/4096")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1024), start)
+	assert.Equal(t, int64(4096), total)
+
+	_, _, err = parseContentRange("bytes */4096")
+	assert.Error(t, err)
+}
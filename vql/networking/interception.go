@@ -0,0 +1,297 @@
+package networking
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"www.velocidex.com/golang/velociraptor/acls"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/crypto"
+	"www.velocidex.com/golang/velociraptor/utils"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	vfilter "www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+var (
+	errInterceptionRejected = errors.New(
+		"TLS connection intercepted by a CA not in Crypto.interception_ca_certificates")
+
+	metricTLSInterceptions = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "tls_interception_count",
+			Help: "Count of server connections intercepted by a TLS inspecting proxy",
+		})
+
+	interceptions = &interceptionTracker{}
+)
+
+// Only keep this many distinct interception chains.
+const maxInterceptionRecords = 20
+
+type InterceptedCertificate struct {
+	Subject   string    `json:"Subject"`
+	Issuer    string    `json:"Issuer"`
+	SHA256    string    `json:"SHA256"`
+	NotBefore time.Time `json:"NotBefore"`
+	NotAfter  time.Time `json:"NotAfter"`
+}
+
+// An observed interception of a connection to the server.
+type InterceptionRecord struct {
+	Seq        uint64                   `json:"-"`
+	FirstSeen  time.Time                `json:"FirstSeen"`
+	LastSeen   time.Time                `json:"LastSeen"`
+	ServerName string                   `json:"ServerName"`
+	Allowed    bool                     `json:"Allowed"`
+	Count      uint64                   `json:"Count"`
+	Chain      []InterceptedCertificate `json:"Chain"`
+}
+
+type interceptionTracker struct {
+	mu      sync.Mutex
+	seq     uint64
+	records []*InterceptionRecord
+}
+
+func (self *interceptionTracker) Record(
+	server_name string, chain []*x509.Certificate, allowed bool) {
+	if len(chain) == 0 {
+		return
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	now := utils.GetTime().Now()
+	leaf_hash := hashCertificate(chain[0])
+
+	for _, record := range self.records {
+		if record.ServerName == server_name &&
+			record.Chain[0].SHA256 == leaf_hash {
+			record.LastSeen = now
+			record.Count++
+			return
+		}
+	}
+
+	self.seq++
+	record := &InterceptionRecord{
+		Seq:        self.seq,
+		FirstSeen:  now,
+		LastSeen:   now,
+		ServerName: server_name,
+		Allowed:    allowed,
+		Count:      1,
+	}
+	for _, cert := range chain {
+		record.Chain = append(record.Chain, InterceptedCertificate{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			SHA256:    hashCertificate(cert),
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+		})
+	}
+
+	self.records = append(self.records, record)
+	if len(self.records) > maxInterceptionRecords {
+		self.records = self.records[1:]
+	}
+}
+
+// Get a copy of the records observed after seq.
+func (self *interceptionTracker) Since(seq uint64) []InterceptionRecord {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	result := []InterceptionRecord{}
+	for _, record := range self.records {
+		if record.Seq > seq {
+			result = append(result, *record)
+		}
+	}
+	return result
+}
+
+func verifiesWith(conn tls.ConnectionState, roots *x509.CertPool) bool {
+	if len(conn.PeerCertificates) == 0 {
+		return false
+	}
+
+	opts := x509.VerifyOptions{
+		CurrentTime:   time.Now(),
+		Intermediates: x509.NewCertPool(),
+		Roots:         roots,
+	}
+	for _, cert := range conn.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := conn.PeerCertificates[0].Verify(opts)
+	return err == nil
+}
+
+// Detect TLS inspecting middleboxes on the connection to the
+// server. The OS certificate store usually contains the inspection
+// proxy's CA, so the connection may verify successfully even though
+// the certificate was not issued by any CA we expect the server to
+// use (our own CA, Crypto.root_certs or the built in public roots).
+//
+// Such connections are recorded so they can be reported to the
+// server. If Crypto.interception_ca_certificates is set, only
+// interception by those CAs is allowed. Client messages are
+// encrypted end to end so inspection proxies can not read them
+// either way.
+func EnableInterceptionDetection(
+	tlsConfig *tls.Config, config_obj *config_proto.ClientConfig) error {
+	if tlsConfig == nil || config_obj == nil {
+		return nil
+	}
+
+	expected := x509.NewCertPool()
+	err := crypto.AddDefaultCerts(config_obj, expected)
+	if err != nil {
+		return err
+	}
+
+	if !config_obj.UseSelfSignedSsl {
+		crypto.AddPublicRoots(expected)
+	}
+
+	var allowed *x509.CertPool
+	allowed_pem := config_obj.GetCrypto().GetInterceptionCaCertificates()
+	if allowed_pem != "" {
+		allowed = x509.NewCertPool()
+		if !allowed.AppendCertsFromPEM([]byte(allowed_pem)) {
+			return errors.New(
+				"Unable to parse Crypto.interception_ca_certificates in the config file.")
+		}
+	}
+
+	isPinned := pinnedChecker(config_obj)
+	thumbprint_only := strings.ToUpper(
+		config_obj.GetCrypto().GetCertificateVerificationMode()) == "THUMBPRINT_ONLY"
+	verify := tlsConfig.VerifyConnection
+
+	tlsConfig.VerifyConnection = func(conn tls.ConnectionState) error {
+		if len(conn.PeerCertificates) == 0 ||
+			isPinned(conn.PeerCertificates[0]) ||
+			verifiesWith(conn, expected) {
+			return callVerify(verify, conn)
+		}
+
+		metricTLSInterceptions.Inc()
+
+		// Pinned certificates are never overridden.
+		is_allowed := !thumbprint_only && allowed != nil &&
+			verifiesWith(conn, allowed)
+		interceptions.Record(conn.ServerName, conn.PeerCertificates, is_allowed)
+
+		if is_allowed {
+			return nil
+		}
+
+		// An explicit allow list means no other interception is
+		// tolerated.
+		if allowed != nil {
+			return errInterceptionRejected
+		}
+
+		return callVerify(verify, conn)
+	}
+
+	return nil
+}
+
+func callVerify(
+	verify func(conn tls.ConnectionState) error,
+	conn tls.ConnectionState) error {
+	if verify == nil {
+		return nil
+	}
+	return verify(conn)
+}
+
+type TLSInterceptionsArgs struct {
+	Watch  bool  `vfilter:"optional,field=watch,doc=Keep running and emit new interceptions as they are observed."`
+	Period int64 `vfilter:"optional,field=period,doc=When watching, check for new interceptions every this many seconds (default 10)."`
+}
+
+type TLSInterceptionsPlugin struct{}
+
+func (self TLSInterceptionsPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+		defer vql_subsystem.RegisterMonitor("tls_interceptions", args)()
+
+		err := vql_subsystem.CheckAccess(scope, acls.MACHINE_STATE)
+		if err != nil {
+			scope.Log("tls_interceptions: %s", err)
+			return
+		}
+
+		arg := &TLSInterceptionsArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("tls_interceptions: %v", err)
+			return
+		}
+
+		if arg.Period == 0 {
+			arg.Period = 10
+		}
+
+		var last_seq uint64
+		for {
+			for _, record := range interceptions.Since(last_seq) {
+				last_seq = record.Seq
+				select {
+				case <-ctx.Done():
+					return
+				case output_chan <- record:
+				}
+			}
+
+			if !arg.Watch {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(arg.Period) * time.Second):
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self TLSInterceptionsPlugin) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name: "tls_interceptions",
+		Doc: "Report TLS inspecting proxies observed on the connection " +
+			"to the server.",
+		ArgType:  type_map.AddType(scope, &TLSInterceptionsArgs{}),
+		Metadata: vql_subsystem.VQLMetadata().Permissions(acls.MACHINE_STATE).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&TLSInterceptionsPlugin{})
+}
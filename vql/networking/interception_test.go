@@ -0,0 +1,92 @@
+package networking
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/crypto"
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func testInterceptedConnection(
+	config_obj *config_proto.ClientConfig, url string) error {
+	transport, err := GetHttpTransport(config_obj, "")
+	if err != nil {
+		return err
+	}
+
+	err = EnableInterceptionDetection(transport.TLSClientConfig, config_obj)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func TestTLSInterception(t *testing.T) {
+	// The test server's certificate is not signed by any CA we
+	// expect so it looks like an inspection proxy.
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+
+	proxy_ca := string(pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: ts.Certificate().Raw,
+	}))
+
+	// Without an allow list the connection is verified as before
+	// (and fails here) but the interception is recorded.
+	interceptions = &interceptionTracker{}
+	err := testInterceptedConnection(&config_proto.ClientConfig{}, ts.URL)
+	assert.Error(t, err)
+
+	records := interceptions.Since(0)
+	assert.Equal(t, 1, len(records))
+	assert.True(t, !records[0].Allowed)
+	assert.Equal(t, hashCertificate(ts.Certificate()), records[0].Chain[0].SHA256)
+
+	// Allow the proxy's CA.
+	interceptions = &interceptionTracker{}
+	config_obj := &config_proto.ClientConfig{
+		Crypto: &config_proto.CryptoConfig{
+			InterceptionCaCertificates: proxy_ca,
+		},
+	}
+	assert.NoError(t, testInterceptedConnection(config_obj, ts.URL))
+
+	records = interceptions.Since(0)
+	assert.Equal(t, 1, len(records))
+	assert.True(t, records[0].Allowed)
+
+	// Interception by other CAs is rejected when an allow list is
+	// set.
+	other_ca, err := crypto.GenerateCACert(2048)
+	assert.NoError(t, err)
+
+	config_obj.Crypto.InterceptionCaCertificates = other_ca.Cert
+	err = testInterceptedConnection(config_obj, ts.URL)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "intercepted")
+
+	// Pinned certificates are not considered intercepted.
+	interceptions = &interceptionTracker{}
+	config_obj = &config_proto.ClientConfig{
+		Crypto: &config_proto.CryptoConfig{
+			CertificateVerificationMode: "PKI_OR_THUMBPRINT",
+			PublicKeyPins:               []string{hashPublicKey(ts.Certificate())},
+		},
+	}
+	assert.NoError(t, testInterceptedConnection(config_obj, ts.URL))
+	assert.Equal(t, 0, len(interceptions.Since(0)))
+}
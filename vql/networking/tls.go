@@ -38,6 +38,14 @@ func hashCertificate(cert *x509.Certificate) string {
 	return hex.EncodeToString(h[:])
 }
 
+// hashPublicKey returns the hex encoded sha256 of the certificate's
+// SubjectPublicKeyInfo. This stays the same when a certificate is
+// reissued for the same key.
+func hashPublicKey(cert *x509.Certificate) string {
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(h[:])
+}
+
 func normalizeThumbPrints(thumbprints []string) []string {
 	thumbprintList := make([]string, 0, len(thumbprints))
 
@@ -49,6 +57,20 @@ func normalizeThumbPrints(thumbprints []string) []string {
 	return thumbprintList
 }
 
+// Returns a function which checks if a certificate matches any of
+// the pinned thumbprints or public keys.
+func pinnedChecker(
+	config_obj *config_proto.ClientConfig) func(cert *x509.Certificate) bool {
+	// this shouldn't be done for each connection attempt but currently
+	// there does not seem to be a way to store the modified hash list
+	thumbprintList := normalizeThumbPrints(config_obj.GetCrypto().GetCertificateThumbprints())
+	pinList := normalizeThumbPrints(config_obj.GetCrypto().GetPublicKeyPins())
+	return func(cert *x509.Certificate) bool {
+		return utils.InString(thumbprintList, hashCertificate(cert)) ||
+			utils.InString(pinList, hashPublicKey(cert))
+	}
+}
+
 // If we deployed Velociraptor using self signed certificates we want
 // to be able to trust our own server. Our own server is signed by our
 // own CA and also may have a different common name (not related to
@@ -80,9 +102,7 @@ func customVerifyConnection(
 		private_opts.Roots.AppendCertsFromPEM([]byte(config_obj.CaCertificate))
 	}
 
-	// this shouldn't be done for each connection attempt but currently
-	// there does not seem to be a way to store the modified hash list
-	thumbprintList := normalizeThumbPrints(config_obj.GetCrypto().GetCertificateThumbprints())
+	isPinned := pinnedChecker(config_obj)
 	verificationMode := strings.ToUpper(config_obj.GetCrypto().GetCertificateVerificationMode())
 
 	return func(conn tls.ConnectionState) error {
@@ -108,7 +128,7 @@ func customVerifyConnection(
 				// Strict enforcement - Only allow certificates
 				// with this thumbprint exactly.
 				case "THUMBPRINT_ONLY":
-					if utils.InString(thumbprintList, hashCertificate(cert)) {
+					if isPinned(cert) {
 						return nil
 					}
 					return errRejectedThumbprint
@@ -119,7 +139,7 @@ func customVerifyConnection(
 				case "PKI_OR_THUMBPRINT":
 					// Short circuit if the thumbprint matches
 					// immediately
-					if utils.InString(thumbprintList, hashCertificate(cert)) {
+					if isPinned(cert) {
 						return nil
 					}
 					// No thumbprint match here, verify as in PkiOnly
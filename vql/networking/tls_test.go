@@ -130,3 +130,30 @@ func TestTLSVerification(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Contains(t, string(data), "Hello, client")
 }
+
+func TestTLSPublicKeyPinning(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+
+	// Pin the server's key and a backup key which is not yet in use.
+	config_obj := &config_proto.ClientConfig{
+		Crypto: &config_proto.CryptoConfig{
+			CertificateVerificationMode: "THUMBPRINT_ONLY",
+			PublicKeyPins: []string{
+				"00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF:00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF",
+				strings.ToUpper(hashPublicKey(ts.Certificate())),
+			},
+		},
+	}
+	data, err := testHTTPConnection(config_obj, ts.URL)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "Hello, client")
+
+	// Only the backup key is pinned.
+	config_obj.Crypto.PublicKeyPins = config_obj.Crypto.PublicKeyPins[:1]
+	_, err = testHTTPConnection(config_obj, ts.URL)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Server certificate had no known thumbprint")
+}
@@ -36,13 +36,14 @@ import (
 // Example: select upload(file=FullPath) from glob(globs="/bin/*")
 
 type UploadFunctionArgs struct {
-	File     *accessors.OSPath `vfilter:"required,field=file,doc=The file to upload"`
-	Name     *accessors.OSPath `vfilter:"optional,field=name,doc=The name of the file that should be stored on the server"`
-	Accessor string            `vfilter:"optional,field=accessor,doc=The accessor to use"`
-	Mtime    vfilter.Any       `vfilter:"optional,field=mtime,doc=Modified time to record"`
-	Atime    vfilter.Any       `vfilter:"optional,field=atime,doc=Access time to record"`
-	Ctime    vfilter.Any       `vfilter:"optional,field=ctime,doc=Change time to record"`
-	Btime    vfilter.Any       `vfilter:"optional,field=btime,doc=Birth time to record"`
+	File      *accessors.OSPath `vfilter:"required,field=file,doc=The file to upload"`
+	Name      *accessors.OSPath `vfilter:"optional,field=name,doc=The name of the file that should be stored on the server"`
+	Accessor  string            `vfilter:"optional,field=accessor,doc=The accessor to use"`
+	Mtime     vfilter.Any       `vfilter:"optional,field=mtime,doc=Modified time to record"`
+	Atime     vfilter.Any       `vfilter:"optional,field=atime,doc=Access time to record"`
+	Ctime     vfilter.Any       `vfilter:"optional,field=ctime,doc=Change time to record"`
+	Btime     vfilter.Any       `vfilter:"optional,field=btime,doc=Birth time to record"`
+	RateLimit uint64            `vfilter:"optional,field=rate_limit,doc=Maximum upload rate in bytes per second (default unlimited)."`
 }
 
 type UploadFunction struct{}
@@ -116,7 +117,7 @@ func (self *UploadFunction) Call(ctx context.Context,
 		arg.Name,
 		stat.Size(), // Expected size.
 		mtime, atime, ctime, btime, stat.Mode(),
-		file)
+		uploads.NewThrottledReader(ctx, file, arg.RateLimit))
 	if err != nil {
 		return &uploads.UploadResponse{
 			Error: err.Error(),
@@ -0,0 +1,319 @@
+package parsers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/accessors"
+	"www.velocidex.com/golang/velociraptor/acls"
+	utils "www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	vfilter "www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+const (
+	// Messages larger than this are truncated. The headers are at
+	// the start of the message so they are still parsed.
+	MAX_EMAIL_SIZE = 50 * 1024 * 1024
+)
+
+var (
+	mimeDecoder = &mime.WordDecoder{}
+)
+
+// Decode RFC 2047 encoded words (e.g. =?UTF-8?B?...?=) in headers.
+func decodeHeader(value string) string {
+	decoded, err := mimeDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// Describe the attachments in a multipart message. We only report
+// their metadata - the message itself can be uploaded if the content
+// is needed.
+func getAttachments(msg *mail.Message) []*ordereddict.Dict {
+	result := []*ordereddict.Dict{}
+
+	media_type, params, err := mime.ParseMediaType(
+		msg.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(media_type, "multipart/") {
+		return result
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return result
+		}
+
+		filename := part.FileName()
+		if filename == "" {
+			continue
+		}
+
+		size, _ := io.Copy(ioutil.Discard, part)
+		result = append(result, ordereddict.NewDict().
+			Set("Name", decodeHeader(filename)).
+			Set("ContentType", part.Header.Get("Content-Type")).
+			Set("EncodedSize", size))
+	}
+}
+
+func parseEmailMessage(reader io.Reader) (*ordereddict.Dict, error) {
+	msg, err := mail.ReadMessage(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := ordereddict.NewDict()
+	for k, v := range msg.Header {
+		decoded := make([]string, 0, len(v))
+		for _, i := range v {
+			decoded = append(decoded, decodeHeader(i))
+		}
+		headers.Set(k, decoded)
+	}
+
+	result := ordereddict.NewDict().
+		Set("From", decodeHeader(msg.Header.Get("From"))).
+		Set("To", decodeHeader(msg.Header.Get("To"))).
+		Set("Cc", decodeHeader(msg.Header.Get("Cc"))).
+		Set("Subject", decodeHeader(msg.Header.Get("Subject"))).
+		Set("MessageId", msg.Header.Get("Message-Id")).
+		Set("ReturnPath", msg.Header.Get("Return-Path")).
+		Set("Received", msg.Header["Received"])
+
+	date, err := msg.Header.Date()
+	if err == nil {
+		result.Set("Date", date)
+	} else {
+		result.Set("Date", msg.Header.Get("Date"))
+	}
+
+	return result.Set("Attachments", getAttachments(msg)).
+		Set("Headers", headers), nil
+}
+
+type ParseEmailPluginArgs struct {
+	Filenames []*accessors.OSPath `vfilter:"required,field=filename,doc=Files to be parsed (e.g. Maildir messages or .eml files)."`
+	Accessor  string              `vfilter:"optional,field=accessor,doc=The accessor to use."`
+}
+
+type ParseEmailPlugin struct{}
+
+func (self ParseEmailPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "parse_email",
+		Doc:      "Parses the headers and attachment metadata of RFC 5322 email messages.",
+		ArgType:  type_map.AddType(scope, &ParseEmailPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.FILESYSTEM_READ).Build(),
+	}
+}
+
+func (self ParseEmailPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		arg := &ParseEmailPluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("parse_email: %s", err.Error())
+			return
+		}
+
+		err = vql_subsystem.CheckFilesystemAccess(scope, arg.Accessor)
+		if err != nil {
+			scope.Log("parse_email: %s", err)
+			return
+		}
+
+		accessor, err := accessors.GetAccessor(arg.Accessor, scope)
+		if err != nil {
+			scope.Log("parse_email: %v", err)
+			return
+		}
+
+		for _, filename := range arg.Filenames {
+			func() {
+				defer utils.RecoverVQL(scope)
+
+				fd, err := accessor.OpenWithOSPath(filename)
+				if err != nil {
+					scope.Log("parse_email: Unable to open file %s: %v",
+						filename, err)
+					return
+				}
+				defer fd.Close()
+
+				row, err := parseEmailMessage(
+					io.LimitReader(fd, MAX_EMAIL_SIZE))
+				if err != nil {
+					scope.Log("parse_email: Unable to parse file %s: %v",
+						filename, err)
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+
+				case output_chan <- row.Set("OSPath", filename):
+				}
+			}()
+		}
+	}()
+
+	return output_chan
+}
+
+type ParseMboxPluginArgs struct {
+	Filename *accessors.OSPath `vfilter:"required,field=filename,doc=The mbox file to parse."`
+	Accessor string            `vfilter:"optional,field=accessor,doc=The accessor to use."`
+}
+
+type ParseMboxPlugin struct{}
+
+func (self ParseMboxPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "parse_mbox",
+		Doc:      "Parses the headers and attachment metadata of all messages in an mbox file.",
+		ArgType:  type_map.AddType(scope, &ParseMboxPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.FILESYSTEM_READ).Build(),
+	}
+}
+
+func (self ParseMboxPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+		defer utils.RecoverVQL(scope)
+
+		arg := &ParseMboxPluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("parse_mbox: %s", err.Error())
+			return
+		}
+
+		err = vql_subsystem.CheckFilesystemAccess(scope, arg.Accessor)
+		if err != nil {
+			scope.Log("parse_mbox: %s", err)
+			return
+		}
+
+		accessor, err := accessors.GetAccessor(arg.Accessor, scope)
+		if err != nil {
+			scope.Log("parse_mbox: %v", err)
+			return
+		}
+
+		fd, err := accessor.OpenWithOSPath(arg.Filename)
+		if err != nil {
+			scope.Log("parse_mbox: Unable to open file %s: %v",
+				arg.Filename, err)
+			return
+		}
+		defer fd.Close()
+
+		err = splitMbox(fd, func(offset int64, message []byte) error {
+			row, err := parseEmailMessage(bytes.NewReader(message))
+			if err != nil {
+				scope.Log("parse_mbox: Unable to parse message at offset %v: %v",
+					offset, err)
+				return nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+
+			case output_chan <- row.Set("Offset", offset):
+			}
+			return nil
+		})
+		if err != nil && err != ctx.Err() {
+			scope.Log("parse_mbox: %v", err)
+		}
+	}()
+
+	return output_chan
+}
+
+// An mbox file is a concatenation of messages, each starting with a
+// "From " separator line. Calls cb with each message and the offset
+// of its separator line.
+func splitMbox(reader io.Reader,
+	cb func(offset int64, message []byte) error) error {
+	buffered := bufio.NewReader(reader)
+
+	var offset, message_offset int64
+	message := &bytes.Buffer{}
+	in_message := false
+
+	flush := func() error {
+		if !in_message {
+			return nil
+		}
+		err := cb(message_offset, message.Bytes())
+		message.Reset()
+		return err
+	}
+
+	for {
+		line, err := buffered.ReadBytes('\n')
+		if len(line) > 0 {
+			line_offset := offset
+			offset += int64(len(line))
+
+			if bytes.HasPrefix(line, []byte("From ")) {
+				err := flush()
+				if err != nil {
+					return err
+				}
+				in_message = true
+				message_offset = line_offset
+
+			} else if in_message && message.Len() < MAX_EMAIL_SIZE {
+				// Undo the mboxrd quoting of From lines in the body.
+				if bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From ")) {
+					line = line[1:]
+				}
+				message.Write(line)
+			}
+		}
+
+		if err == io.EOF {
+			return flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&ParseEmailPlugin{})
+	vql_subsystem.RegisterPlugin(&ParseMboxPlugin{})
+}
@@ -0,0 +1,71 @@
+package parsers_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/stretchr/testify/assert"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/velociraptor/vql/parsers"
+)
+
+var mboxTestCase = `From alice@example.com Mon Jan  1 00:00:00 2024
+From: Alice <alice@example.com>
+To: bob@example.com
+Subject: =?UTF-8?B?SGVsbG8gV29ybGQ=?=
+Date: Mon, 01 Jan 2024 10:00:00 +0000
+Content-Type: multipart/mixed; boundary="XX"
+
+--XX
+Content-Type: text/plain
+
+>From the start
+--XX
+Content-Type: application/pdf
+Content-Disposition: attachment; filename="invoice.pdf"
+
+JVBERi0=
+--XX--
+
+From bob@example.com Mon Jan  1 00:00:00 2024
+From: bob@example.com
+Subject: Second
+
+body
+`
+
+func (self *ParserTestSuite) TestMboxParser() {
+	ctx := context.Background()
+	scope := vql_subsystem.MakeScope()
+	defer scope.Close()
+
+	rows := []*ordereddict.Dict{}
+	for row := range (parsers.ParseMboxPlugin{}).Call(ctx, scope,
+		ordereddict.NewDict().
+			Set("filename", mboxTestCase).
+			Set("accessor", "data")) {
+		rows = append(rows, row.(*ordereddict.Dict))
+	}
+
+	assert.Equal(self.T(), 2, len(rows))
+
+	// Encoded words are decoded.
+	subject, _ := rows[0].Get("Subject")
+	assert.Equal(self.T(), "Hello World", subject)
+
+	date, _ := rows[0].Get("Date")
+	assert.Equal(self.T(), int64(1704103200), date.(time.Time).Unix())
+
+	attachments, _ := rows[0].Get("Attachments")
+	assert.Equal(self.T(), 1, len(attachments.([]*ordereddict.Dict)))
+
+	name, _ := attachments.([]*ordereddict.Dict)[0].Get("Name")
+	assert.Equal(self.T(), "invoice.pdf", name)
+
+	subject, _ = rows[1].Get("Subject")
+	assert.Equal(self.T(), "Second", subject)
+
+	offset, _ := rows[1].Get("Offset")
+	assert.Equal(self.T(), int64(378), offset)
+}
@@ -0,0 +1,700 @@
+package parsers
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/accessors"
+	"www.velocidex.com/golang/velociraptor/acls"
+	utils "www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	vfilter "www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+const (
+	// We only need the start of each flow to see the handshake.
+	MAX_TLS_FLOW_BUFFER = 128 * 1024
+
+	TLS_RECORD_HANDSHAKE = 0x16
+
+	TLS_CLIENT_HELLO      = 1
+	TLS_SERVER_HELLO      = 2
+	TLS_CERTIFICATE       = 11
+	TLS_SERVER_HELLO_DONE = 14
+
+	LINKTYPE_NULL      = 0
+	LINKTYPE_ETHERNET  = 1
+	LINKTYPE_RAW       = 101
+	LINKTYPE_LINUX_SLL = 113
+	LINKTYPE_IPV4      = 228
+	LINKTYPE_IPV6      = 229
+	LINKTYPE_SLL2      = 276
+)
+
+var (
+	tlsTruncatedError = errors.New("Truncated")
+	tlsNotTLSError    = errors.New("Not a TLS handshake")
+)
+
+// A simple cursor over a byte slice. Reads past the end return
+// zero values and set the error.
+type tlsReader struct {
+	data []byte
+	err  error
+}
+
+func (self *tlsReader) bytes(n int) []byte {
+	if self.err != nil || n > len(self.data) {
+		self.err = tlsTruncatedError
+		return nil
+	}
+	result := self.data[:n]
+	self.data = self.data[n:]
+	return result
+}
+
+func (self *tlsReader) uint8() int {
+	b := self.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return int(b[0])
+}
+
+func (self *tlsReader) uint16() int {
+	b := self.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b))
+}
+
+func (self *tlsReader) uint24() int {
+	b := self.bytes(3)
+	if b == nil {
+		return 0
+	}
+	return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+}
+
+// Read a length prefixed vector.
+func (self *tlsReader) vector(length_size int) *tlsReader {
+	var length int
+	switch length_size {
+	case 1:
+		length = self.uint8()
+	case 2:
+		length = self.uint16()
+	case 3:
+		length = self.uint24()
+	}
+	return &tlsReader{data: self.bytes(length), err: self.err}
+}
+
+// GREASE values (RFC 8701) are random and must be ignored for JA3.
+func isGrease(value int) bool {
+	return value&0x0f0f == 0x0a0a && value>>8 == value&0xff
+}
+
+func joinInts(values []int) string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		result = append(result, strconv.Itoa(v))
+	}
+	return strings.Join(result, "-")
+}
+
+type tlsExtension struct {
+	Type int
+	Data []byte
+}
+
+func parseTLSExtensions(reader *tlsReader) []tlsExtension {
+	result := []tlsExtension{}
+	if len(reader.data) == 0 {
+		return result
+	}
+
+	extensions := reader.vector(2)
+	for extensions.err == nil && len(extensions.data) > 0 {
+		ext_type := extensions.uint16()
+		data := extensions.vector(2)
+		if extensions.err != nil {
+			break
+		}
+		result = append(result, tlsExtension{Type: ext_type, Data: data.data})
+	}
+	return result
+}
+
+// Server Name Indication extension (RFC 6066)
+func getSNI(data []byte) string {
+	names := (&tlsReader{data: data}).vector(2)
+	for names.err == nil && len(names.data) > 0 {
+		name_type := names.uint8()
+		name := names.vector(2)
+		if name_type == 0 && name.err == nil {
+			return string(name.data)
+		}
+	}
+	return ""
+}
+
+// The negotiated version for TLS 1.3 is carried in the
+// supported_versions extension.
+func getSupportedVersion(data []byte) int {
+	return (&tlsReader{data: data}).uint16()
+}
+
+func tlsVersionName(version int) string {
+	switch version {
+	case 0x0300:
+		return "SSLv3"
+	case 0x0301:
+		return "TLS 1.0"
+	case 0x0302:
+		return "TLS 1.1"
+	case 0x0303:
+		return "TLS 1.2"
+	case 0x0304:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+func md5Hex(value string) string {
+	hash := md5.Sum([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
+
+// Calculate the JA3 fingerprint of a ClientHello message body.
+// https://github.com/salesforce/ja3
+func parseClientHello(body []byte) (*ordereddict.Dict, error) {
+	reader := &tlsReader{data: body}
+	version := reader.uint16()
+	reader.bytes(32) // Random
+	reader.vector(1) // Session ID
+
+	ciphers := []int{}
+	cipher_suites := reader.vector(2)
+	for cipher_suites.err == nil && len(cipher_suites.data) > 0 {
+		cipher := cipher_suites.uint16()
+		if !isGrease(cipher) {
+			ciphers = append(ciphers, cipher)
+		}
+	}
+
+	reader.vector(1) // Compression methods
+	if reader.err != nil {
+		return nil, reader.err
+	}
+
+	extensions := []int{}
+	curves := []int{}
+	point_formats := []int{}
+	sni := ""
+
+	for _, ext := range parseTLSExtensions(reader) {
+		if isGrease(ext.Type) {
+			continue
+		}
+		extensions = append(extensions, ext.Type)
+
+		switch ext.Type {
+		case 0:
+			sni = getSNI(ext.Data)
+
+		case 10: // supported_groups
+			groups := (&tlsReader{data: ext.Data}).vector(2)
+			for groups.err == nil && len(groups.data) > 0 {
+				group := groups.uint16()
+				if !isGrease(group) {
+					curves = append(curves, group)
+				}
+			}
+
+		case 11: // ec_point_formats
+			formats := (&tlsReader{data: ext.Data}).vector(1)
+			for formats.err == nil && len(formats.data) > 0 {
+				point_formats = append(point_formats, formats.uint8())
+			}
+		}
+	}
+
+	ja3 := fmt.Sprintf("%d,%s,%s,%s,%s", version, joinInts(ciphers),
+		joinInts(extensions), joinInts(curves), joinInts(point_formats))
+
+	return ordereddict.NewDict().
+		Set("Type", "ClientHello").
+		Set("ServerName", sni).
+		Set("Version", tlsVersionName(version)).
+		Set("Fingerprint", ja3).
+		Set("FingerprintHash", md5Hex(ja3)).
+		Set("Certificates", []*ordereddict.Dict{}), nil
+}
+
+// Calculate the JA3S fingerprint of a ServerHello message body.
+func parseServerHello(body []byte) (*ordereddict.Dict, error) {
+	reader := &tlsReader{data: body}
+	version := reader.uint16()
+	reader.bytes(32) // Random
+	reader.vector(1) // Session ID
+	cipher := reader.uint16()
+	reader.uint8() // Compression method
+	if reader.err != nil {
+		return nil, reader.err
+	}
+
+	negotiated := version
+	extensions := []int{}
+	for _, ext := range parseTLSExtensions(reader) {
+		extensions = append(extensions, ext.Type)
+		if ext.Type == 43 {
+			negotiated = getSupportedVersion(ext.Data)
+		}
+	}
+
+	ja3s := fmt.Sprintf("%d,%d,%s", version, cipher, joinInts(extensions))
+
+	return ordereddict.NewDict().
+		Set("Type", "ServerHello").
+		Set("ServerName", "").
+		Set("Version", tlsVersionName(negotiated)).
+		Set("Fingerprint", ja3s).
+		Set("FingerprintHash", md5Hex(ja3s)).
+		Set("Certificates", []*ordereddict.Dict{}), nil
+}
+
+// The certificate chain is only visible for TLS 1.2 and earlier -
+// TLS 1.3 encrypts it.
+func parseCertificates(body []byte) []*ordereddict.Dict {
+	result := []*ordereddict.Dict{}
+	certs := (&tlsReader{data: body}).vector(3)
+	for certs.err == nil && len(certs.data) > 0 {
+		der := certs.vector(3)
+		if der.err != nil {
+			break
+		}
+
+		hash := sha1.Sum(der.data)
+		row := ordereddict.NewDict().
+			Set("SHA1", hex.EncodeToString(hash[:]))
+
+		cert, err := x509.ParseCertificate(der.data)
+		if err != nil {
+			result = append(result, row.Set("Error", err.Error()))
+			continue
+		}
+
+		result = append(result, row.
+			Set("Subject", cert.Subject.String()).
+			Set("Issuer", cert.Issuer.String()).
+			Set("SerialNumber", cert.SerialNumber.String()).
+			Set("NotBefore", cert.NotBefore).
+			Set("NotAfter", cert.NotAfter).
+			Set("DNSNames", cert.DNSNames).
+			Set("SelfSigned", cert.Subject.String() == cert.Issuer.String()))
+	}
+	return result
+}
+
+// Tracks the data seen at the start of a single TCP flow.
+type tlsFlow struct {
+	buffer []byte
+	done   bool
+	result *ordereddict.Dict
+}
+
+// Parse as many complete handshake messages as are available in
+// the flow's buffer. Returns a row when the flow is complete.
+func (self *tlsFlow) parse() (*ordereddict.Dict, error) {
+	reader := &tlsReader{data: self.buffer}
+
+	// Handshake messages may be fragmented across records so
+	// reassemble the handshake stream first.
+	handshake := []byte{}
+	complete := false
+	for len(reader.data) >= 5 {
+		record_type := reader.uint8()
+		reader.uint16() // Version
+		record := reader.vector(2)
+		if reader.err != nil {
+			break
+		}
+
+		if record_type != TLS_RECORD_HANDSHAKE {
+			// Anything else (e.g. ChangeCipherSpec) ends the
+			// plain text handshake.
+			complete = true
+			break
+		}
+		handshake = append(handshake, record.data...)
+	}
+
+	if len(handshake) == 0 {
+		if complete || len(self.buffer) >= 5 && self.buffer[0] != TLS_RECORD_HANDSHAKE {
+			return nil, tlsNotTLSError
+		}
+		return nil, nil
+	}
+
+	messages := &tlsReader{data: handshake}
+	for len(messages.data) >= 4 {
+		msg_type := messages.uint8()
+		body := messages.vector(3)
+		if messages.err != nil {
+			break
+		}
+
+		var err error
+		switch msg_type {
+		case TLS_CLIENT_HELLO:
+			self.result, err = parseClientHello(body.data)
+			return self.result, err
+
+		case TLS_SERVER_HELLO:
+			self.result, err = parseServerHello(body.data)
+			if err != nil {
+				return nil, err
+			}
+
+		case TLS_CERTIFICATE:
+			if self.result != nil {
+				self.result.Set("Certificates", parseCertificates(body.data))
+			}
+			return self.result, nil
+
+		case TLS_SERVER_HELLO_DONE:
+			return self.result, nil
+
+		default:
+			if self.result == nil {
+				return nil, tlsNotTLSError
+			}
+		}
+	}
+
+	if complete {
+		return self.result, nil
+	}
+	return nil, nil
+}
+
+type tcpPacket struct {
+	Src, Dst         net.IP
+	SrcPort, DstPort uint16
+	Payload          []byte
+}
+
+func (self *tcpPacket) key() string {
+	return fmt.Sprintf("%v:%v-%v:%v", self.Src, self.SrcPort,
+		self.Dst, self.DstPort)
+}
+
+// Decode a TCP packet from a captured frame. Returns nil for
+// anything else.
+func decodeTCPPacket(link_type uint32, data []byte) *tcpPacket {
+	var ether_type uint16
+
+	switch link_type {
+	case LINKTYPE_ETHERNET:
+		if len(data) < 14 {
+			return nil
+		}
+		ether_type = binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+
+		// 802.1Q VLAN tag
+		if ether_type == 0x8100 && len(data) >= 4 {
+			ether_type = binary.BigEndian.Uint16(data[2:])
+			data = data[4:]
+		}
+
+	case LINKTYPE_LINUX_SLL:
+		if len(data) < 16 {
+			return nil
+		}
+		ether_type = binary.BigEndian.Uint16(data[14:])
+		data = data[16:]
+
+	case LINKTYPE_SLL2:
+		if len(data) < 20 {
+			return nil
+		}
+		ether_type = binary.BigEndian.Uint16(data)
+		data = data[20:]
+
+	case LINKTYPE_NULL:
+		if len(data) < 4 {
+			return nil
+		}
+		data = data[4:]
+		fallthrough
+
+	case LINKTYPE_RAW, LINKTYPE_IPV4, LINKTYPE_IPV6:
+		if len(data) == 0 {
+			return nil
+		}
+		switch data[0] >> 4 {
+		case 4:
+			ether_type = 0x0800
+		case 6:
+			ether_type = 0x86dd
+		}
+
+	default:
+		return nil
+	}
+
+	result := &tcpPacket{}
+	switch ether_type {
+	case 0x0800:
+		if len(data) < 20 || data[9] != 6 {
+			return nil
+		}
+		header_len := int(data[0]&0x0f) * 4
+		total_len := int(binary.BigEndian.Uint16(data[2:]))
+		if header_len < 20 || total_len < header_len || total_len > len(data) {
+			return nil
+		}
+		result.Src = net.IP(data[12:16])
+		result.Dst = net.IP(data[16:20])
+		data = data[header_len:total_len]
+
+	case 0x86dd:
+		// Extension headers are not supported.
+		if len(data) < 40 || data[6] != 6 {
+			return nil
+		}
+		payload_len := int(binary.BigEndian.Uint16(data[4:]))
+		if 40+payload_len > len(data) {
+			return nil
+		}
+		result.Src = net.IP(data[8:24])
+		result.Dst = net.IP(data[24:40])
+		data = data[40 : 40+payload_len]
+
+	default:
+		return nil
+	}
+
+	if len(data) < 20 {
+		return nil
+	}
+	offset := int(data[12]>>4) * 4
+	if offset < 20 || offset > len(data) {
+		return nil
+	}
+	result.SrcPort = binary.BigEndian.Uint16(data)
+	result.DstPort = binary.BigEndian.Uint16(data[2:])
+	result.Payload = data[offset:]
+
+	return result
+}
+
+// Read a classic libpcap file and call cb for each captured frame.
+func readPcap(reader io.Reader,
+	cb func(ts time.Time, link_type uint32, data []byte) error) error {
+	buffered := bufio.NewReader(reader)
+
+	header := make([]byte, 24)
+	_, err := io.ReadFull(buffered, header)
+	if err != nil {
+		return err
+	}
+
+	var order binary.ByteOrder
+	nano := false
+	switch binary.LittleEndian.Uint32(header) {
+	case 0xa1b2c3d4:
+		order = binary.LittleEndian
+	case 0xa1b23c4d:
+		order, nano = binary.LittleEndian, true
+	case 0xd4c3b2a1:
+		order = binary.BigEndian
+	case 0x4d3cb2a1:
+		order, nano = binary.BigEndian, true
+	default:
+		return errors.New("Not a pcap file (pcapng is not supported)")
+	}
+
+	link_type := order.Uint32(header[20:]) & 0x0fffffff
+	record := make([]byte, 16)
+	for {
+		_, err := io.ReadFull(buffered, record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		seconds := int64(order.Uint32(record))
+		fraction := int64(order.Uint32(record[4:]))
+		if !nano {
+			fraction *= 1000
+		}
+
+		length := order.Uint32(record[8:])
+		if length > 256*1024 {
+			return fmt.Errorf("Invalid record length %v", length)
+		}
+
+		data := make([]byte, length)
+		_, err = io.ReadFull(buffered, data)
+		if err != nil {
+			return err
+		}
+
+		err = cb(time.Unix(seconds, fraction).UTC(), link_type, data)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Extract the TLS handshakes from a pcap file. Segments are
+// appended in capture order without sequence number reassembly,
+// which is sufficient for the start of most flows.
+func parseTLSHandshakes(reader io.Reader,
+	cb func(row *ordereddict.Dict) error) error {
+	flows := make(map[string]*tlsFlow)
+
+	emit := func(packet *tcpPacket, ts time.Time, row *ordereddict.Dict) error {
+		result := ordereddict.NewDict().
+			Set("Time", ts).
+			Set("SrcIP", packet.Src.String()).
+			Set("SrcPort", packet.SrcPort).
+			Set("DstIP", packet.Dst.String()).
+			Set("DstPort", packet.DstPort)
+		result.MergeFrom(row)
+		return cb(result)
+	}
+
+	err := readPcap(reader, func(ts time.Time, link_type uint32, data []byte) error {
+		packet := decodeTCPPacket(link_type, data)
+		if packet == nil || len(packet.Payload) == 0 {
+			return nil
+		}
+
+		key := packet.key()
+		flow, pres := flows[key]
+		if !pres {
+			// Only track flows which start with a handshake record.
+			if packet.Payload[0] != TLS_RECORD_HANDSHAKE {
+				return nil
+			}
+			flow = &tlsFlow{}
+			flows[key] = flow
+		}
+
+		if flow.done {
+			return nil
+		}
+
+		flow.buffer = append(flow.buffer, packet.Payload...)
+		row, err := flow.parse()
+		if err != nil || len(flow.buffer) > MAX_TLS_FLOW_BUFFER {
+			flow.done = true
+			flow.buffer = nil
+			return nil
+		}
+
+		if row != nil {
+			flow.done = true
+			flow.buffer = nil
+			return emit(packet, ts, row)
+		}
+		return nil
+	})
+	return err
+}
+
+type ParseTLSHandshakesPluginArgs struct {
+	Filename *accessors.OSPath `vfilter:"required,field=filename,doc=The pcap file to parse."`
+	Accessor string            `vfilter:"optional,field=accessor,doc=The accessor to use."`
+}
+
+type ParseTLSHandshakesPlugin struct{}
+
+func (self ParseTLSHandshakesPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "parse_tls_handshakes",
+		Doc:      "Extract TLS handshakes with their JA3/JA3S fingerprints, SNI and certificates from a pcap file.",
+		ArgType:  type_map.AddType(scope, &ParseTLSHandshakesPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.FILESYSTEM_READ).Build(),
+	}
+}
+
+func (self ParseTLSHandshakesPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+		defer utils.RecoverVQL(scope)
+
+		arg := &ParseTLSHandshakesPluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("parse_tls_handshakes: %s", err.Error())
+			return
+		}
+
+		err = vql_subsystem.CheckFilesystemAccess(scope, arg.Accessor)
+		if err != nil {
+			scope.Log("parse_tls_handshakes: %s", err)
+			return
+		}
+
+		accessor, err := accessors.GetAccessor(arg.Accessor, scope)
+		if err != nil {
+			scope.Log("parse_tls_handshakes: %v", err)
+			return
+		}
+
+		fd, err := accessor.OpenWithOSPath(arg.Filename)
+		if err != nil {
+			scope.Log("parse_tls_handshakes: Unable to open file %s: %v",
+				arg.Filename, err)
+			return
+		}
+		defer fd.Close()
+
+		err = parseTLSHandshakes(fd, func(row *ordereddict.Dict) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+
+			case output_chan <- row:
+			}
+			return nil
+		})
+		if err != nil && err != ctx.Err() {
+			scope.Log("parse_tls_handshakes: %v", err)
+		}
+	}()
+
+	return output_chan
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&ParseTLSHandshakesPlugin{})
+}
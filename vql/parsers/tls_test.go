@@ -0,0 +1,171 @@
+package parsers_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/stretchr/testify/assert"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/velociraptor/vql/parsers"
+)
+
+// Record the TLS records written by each side of a connection so
+// they can be written to a pcap file.
+type capturedPacket struct {
+	src_port, dst_port uint16
+	data               []byte
+}
+
+type recordingConn struct {
+	net.Conn
+	mu                 *sync.Mutex
+	packets            *[]capturedPacket
+	src_port, dst_port uint16
+}
+
+func (self recordingConn) Write(b []byte) (int, error) {
+	self.mu.Lock()
+	*self.packets = append(*self.packets, capturedPacket{
+		src_port: self.src_port, dst_port: self.dst_port,
+		data: append([]byte{}, b...)})
+	self.mu.Unlock()
+	return self.Conn.Write(b)
+}
+
+// Wrap the records in Ethernet/IPv4/TCP frames.
+func makePcap(packets []capturedPacket) []byte {
+	out := &bytes.Buffer{}
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header, 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], 1)
+	out.Write(header)
+
+	for i, p := range packets {
+		frame := make([]byte, 14+20+20+len(p.data))
+		binary.BigEndian.PutUint16(frame[12:], 0x0800)
+		ip := frame[14:]
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(40+len(p.data)))
+		ip[9] = 6
+		client, server := []byte{10, 0, 0, 1}, []byte{10, 0, 0, 2}
+		if p.src_port == 443 {
+			client, server = server, client
+		}
+		copy(ip[12:], client)
+		copy(ip[16:], server)
+		tcp := ip[20:]
+		binary.BigEndian.PutUint16(tcp, p.src_port)
+		binary.BigEndian.PutUint16(tcp[2:], p.dst_port)
+		tcp[12] = 5 << 4
+		copy(tcp[20:], p.data)
+
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record, uint32(1700000000+i))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(frame)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(frame)))
+		out.Write(record)
+		out.Write(frame)
+	}
+	return out.Bytes()
+}
+
+// Perform a real TLS 1.2 handshake with a self signed certificate
+// and capture it.
+func makeTLSHandshakePcap(t *testing.T) []byte {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test.example.com"},
+		DNSNames:     []string{"test.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		&key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packets := []capturedPacket{}
+	mu := &sync.Mutex{}
+	client_end, server_end := net.Pipe()
+
+	server := tls.Server(recordingConn{server_end, mu, &packets, 443, 50000},
+		&tls.Config{
+			MaxVersion: tls.VersionTLS12,
+			Certificates: []tls.Certificate{{
+				Certificate: [][]byte{der}, PrivateKey: key}},
+		})
+	client := tls.Client(recordingConn{client_end, mu, &packets, 50000, 443},
+		&tls.Config{ServerName: "test.example.com", InsecureSkipVerify: true})
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		server.Handshake()
+	}()
+	if err := client.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	client_end.Close()
+	server_end.Close()
+
+	return makePcap(packets)
+}
+
+func (self *ParserTestSuite) TestTLSHandshakes() {
+	ctx := context.Background()
+	scope := vql_subsystem.MakeScope()
+	defer scope.Close()
+
+	rows := []*ordereddict.Dict{}
+	for row := range (parsers.ParseTLSHandshakesPlugin{}).Call(ctx, scope,
+		ordereddict.NewDict().
+			Set("filename", string(makeTLSHandshakePcap(self.T()))).
+			Set("accessor", "data")) {
+		rows = append(rows, row.(*ordereddict.Dict))
+	}
+
+	assert.Equal(self.T(), 2, len(rows))
+
+	client_hello := rows[0]
+	assert.Equal(self.T(), "ClientHello", getString(client_hello, "Type"))
+	assert.Equal(self.T(), "test.example.com",
+		getString(client_hello, "ServerName"))
+	assert.Equal(self.T(), "10.0.0.2", getString(client_hello, "DstIP"))
+	assert.Regexp(self.T(), "^771,[0-9-]+,[0-9-]+,[0-9-]*,[0-9-]*$",
+		getString(client_hello, "Fingerprint"))
+	assert.Equal(self.T(), 32, len(getString(client_hello, "FingerprintHash")))
+
+	server_hello := rows[1]
+	assert.Equal(self.T(), "ServerHello", getString(server_hello, "Type"))
+	assert.Equal(self.T(), "TLS 1.2", getString(server_hello, "Version"))
+
+	certificates, _ := server_hello.Get("Certificates")
+	assert.Equal(self.T(), 1, len(certificates.([]*ordereddict.Dict)))
+	cert := certificates.([]*ordereddict.Dict)[0]
+	assert.Equal(self.T(), "CN=test.example.com", getString(cert, "Subject"))
+}
+
+func getString(row *ordereddict.Dict, field string) string {
+	value, _ := row.GetString(field)
+	return value
+}
@@ -0,0 +1,203 @@
+package parsers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/accessors"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/artifacts"
+	crypto_utils "www.velocidex.com/golang/velociraptor/crypto/utils"
+	utils "www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/utils/wasm"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	vfilter "www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+const (
+	MAX_WASM_MODULE_SIZE = 10 * 1024 * 1024
+)
+
+type ParseWasmPluginArgs struct {
+	Module          *accessors.OSPath `vfilter:"required,field=module,doc=The WebAssembly parser module (usually a tool)."`
+	Signature       string            `vfilter:"required,field=signature,doc=The hex encoded signature of the module made with the CA key."`
+	Filename        *accessors.OSPath `vfilter:"required,field=filename,doc=The file to parse."`
+	Accessor        string            `vfilter:"optional,field=accessor,doc=The accessor to use to read the file."`
+	MaxMemory       uint64            `vfilter:"optional,field=max_memory,doc=The maximum memory available to the parser in bytes (default 32MB). The file may be at most half this size."`
+	MaxInstructions int64             `vfilter:"optional,field=max_instructions,doc=The maximum number of instructions the parser may run (default 1e9)."`
+}
+
+type ParseWasmPlugin struct{}
+
+func (self ParseWasmPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "parse_wasm",
+		Doc:      "Parse a file with a signed WebAssembly parser module running in a sandbox.",
+		ArgType:  type_map.AddType(scope, &ParseWasmPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.FILESYSTEM_READ).Build(),
+	}
+}
+
+func (self ParseWasmPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+		defer utils.RecoverVQL(scope)
+		defer vql_subsystem.RegisterMonitor("parse_wasm", args)()
+
+		arg := &ParseWasmPluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("parse_wasm: %v", err)
+			return
+		}
+
+		err = vql_subsystem.CheckFilesystemAccess(scope, arg.Accessor)
+		if err != nil {
+			scope.Log("parse_wasm: %v", err)
+			return
+		}
+
+		if arg.MaxMemory == 0 {
+			arg.MaxMemory = 32 * 1024 * 1024
+		}
+
+		parser, err := getWasmParser(scope, arg)
+		if err != nil {
+			scope.Log("parse_wasm: %v", err)
+			return
+		}
+
+		accessor, err := accessors.GetAccessor(arg.Accessor, scope)
+		if err != nil {
+			scope.Log("parse_wasm: %v", err)
+			return
+		}
+
+		fd, err := accessor.OpenWithOSPath(arg.Filename)
+		if err != nil {
+			scope.Log("parse_wasm: Unable to open file %s: %v",
+				arg.Filename, err)
+			return
+		}
+		defer fd.Close()
+
+		// The data is copied into the parser's memory and must leave
+		// room for the parser's own allocations.
+		max_size := int64(arg.MaxMemory / 2)
+		data, err := io.ReadAll(io.LimitReader(fd, max_size+1))
+		if err != nil {
+			scope.Log("parse_wasm: %v", err)
+			return
+		}
+
+		if int64(len(data)) > max_size {
+			scope.Log("parse_wasm: %v is too large - increase max_memory",
+				arg.Filename)
+			return
+		}
+
+		err = parser.Parse(ctx, data,
+			func(serialized []byte) error {
+				row, err := utils.ParseJsonToObject(serialized)
+				if err != nil {
+					return fmt.Errorf("Parser emitted invalid JSON: %w", err)
+				}
+
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case output_chan <- row:
+				}
+				return nil
+			},
+			func(message string) {
+				scope.Log("parse_wasm: %v", message)
+			})
+		if err != nil && err != ctx.Err() {
+			scope.Log("parse_wasm: %v: %v", arg.Filename, err)
+		}
+	}()
+
+	return output_chan
+}
+
+// Load and verify the parser module. Decoded modules are cached in
+// the scope so parsing many files only verifies the module once.
+func getWasmParser(
+	scope vfilter.Scope, arg *ParseWasmPluginArgs) (*wasm.Parser, error) {
+
+	accessor, err := accessors.GetAccessor("", scope)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := accessor.OpenWithOSPath(arg.Module)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	data, err := io.ReadAll(io.LimitReader(fd, MAX_WASM_MODULE_SIZE))
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(data)
+	key := fmt.Sprintf("parse_wasm %x %v %v", hash, arg.MaxMemory,
+		arg.MaxInstructions)
+
+	parser, ok := vql_subsystem.CacheGet(scope, key).(*wasm.Parser)
+	if ok {
+		return parser, nil
+	}
+
+	signature, err := hex.DecodeString(arg.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid signature: %w", err)
+	}
+
+	config_obj, ok := artifacts.GetConfig(scope)
+	if !ok || config_obj.CaCertificate == "" {
+		return nil, fmt.Errorf("No CA certificate available to verify %v",
+			arg.Module)
+	}
+
+	err = crypto_utils.VerifySHA256WithCertificate(
+		config_obj.CaCertificate, data, signature)
+	if err != nil {
+		return nil, fmt.Errorf("Module %v is not correctly signed: %w",
+			arg.Module, err)
+	}
+
+	// Memory is addressed with 32 bits.
+	pages := arg.MaxMemory / wasm.PageSize
+	if pages > 65536 {
+		pages = 65536
+	}
+
+	parser, err = wasm.NewParser(data, wasm.Config{
+		MaxMemoryPages: uint32(pages),
+		Fuel:           arg.MaxInstructions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	vql_subsystem.CacheSet(scope, key, parser)
+	return parser, nil
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&ParseWasmPlugin{})
+}
@@ -17,3 +17,8 @@ func InfoWithContext(ctx context.Context) (*InfoStat, error) {
 	}
 	return &InfoStat{InfoStat: *res}, err
 }
+
+// Seconds since epoch when the host booted.
+func BootTimeWithContext(ctx context.Context) (uint64, error) {
+	return host.BootTimeWithContext(ctx)
+}
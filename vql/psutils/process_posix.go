@@ -18,7 +18,16 @@ func GetProcess(ctx context.Context, pid int32) (*ordereddict.Dict, error) {
 		return nil, err
 	}
 
-	return getProcessData(process_obj), nil
+	result := getProcessData(process_obj)
+
+	// IO counters are only cheap enough to fetch for a single
+	// process.
+	io_counters, err := IOCountersWithContext(ctx, pid)
+	if err == nil {
+		result.Set("IoCounters", io_counters)
+	}
+
+	return result, nil
 }
 
 func ListProcesses(ctx context.Context) ([]*ordereddict.Dict, error) {
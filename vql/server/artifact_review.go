@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/services/launcher"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	vql_utils "www.velocidex.com/golang/velociraptor/vql/utils"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type ArtifactLintPluginArgs struct {
+	Names      []string `vfilter:"optional,field=names,doc=Artifacts to lint (default all custom artifacts)"`
+	Definition string   `vfilter:"optional,field=definition,doc=Lint this artifact definition in YAML instead"`
+}
+
+type ArtifactLintPlugin struct{}
+
+func (self ArtifactLintPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+	go func() {
+		defer close(output_chan)
+		defer vql_subsystem.RegisterMonitor("artifact_lint", args)()
+
+		err := vql_subsystem.CheckAccess(scope, acls.READ_RESULTS)
+		if err != nil {
+			scope.Log("artifact_lint: %v", err)
+			return
+		}
+
+		arg := &ArtifactLintPluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("artifact_lint: %v", err)
+			return
+		}
+
+		config_obj, ok := vql_subsystem.GetServerConfig(scope)
+		if !ok {
+			scope.Log("artifact_lint: Command can only run on the server")
+			return
+		}
+
+		repository, err := vql_utils.GetRepository(scope)
+		if err != nil {
+			scope.Log("artifact_lint: %v", err)
+			return
+		}
+
+		names := arg.Names
+
+		// Load the definition into a copy of the repository so it
+		// can refer to other artifacts.
+		if arg.Definition != "" {
+			repository = repository.Copy()
+			artifact, err := repository.LoadYaml(arg.Definition,
+				services.ArtifactOptions{
+					ValidateArtifact:  false,
+					ArtifactIsBuiltIn: false,
+				})
+			if err != nil {
+				scope.Log("artifact_lint: %v", err)
+				return
+			}
+			names = []string{artifact.Name}
+		}
+
+		if len(names) == 0 {
+			all, err := repository.List(ctx, config_obj)
+			if err != nil {
+				scope.Log("artifact_lint: %v", err)
+				return
+			}
+
+			for _, name := range all {
+				artifact, pres := repository.Get(ctx, config_obj, name)
+				if pres && !artifact.BuiltIn && !artifact.CompiledIn {
+					names = append(names, name)
+				}
+			}
+		}
+
+		options := launcher.LintOptions{
+			BannedPlugins: config_obj.Defaults.GetBannedArtifactPlugins(),
+		}
+
+		for _, name := range names {
+			artifact, pres := repository.Get(ctx, config_obj, name)
+			if !pres {
+				scope.Log("artifact_lint: artifact %v not known", name)
+				continue
+			}
+
+			for _, result := range launcher.LintArtifact(
+				ctx, config_obj, repository, artifact, options) {
+				select {
+				case <-ctx.Done():
+					return
+				case output_chan <- result:
+				}
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self ArtifactLintPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "artifact_lint",
+		Doc:      "Check artifact definitions for problems.",
+		ArgType:  type_map.AddType(scope, &ArtifactLintPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.READ_RESULTS).Build(),
+	}
+}
+
+type ArtifactReviewFunctionArgs struct {
+	Name    string `vfilter:"required,field=name,doc=The custom artifact to mark as reviewed"`
+	Comment string `vfilter:"optional,field=comment,doc=A comment to record with the review"`
+}
+
+type ArtifactReviewFunction struct{}
+
+func (self *ArtifactReviewFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.SERVER_ADMIN)
+	if err != nil {
+		scope.Log("artifact_review: %v", err)
+		return vfilter.Null{}
+	}
+
+	arg := &ArtifactReviewFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("artifact_review: %v", err)
+		return vfilter.Null{}
+	}
+
+	config_obj, ok := vql_subsystem.GetServerConfig(scope)
+	if !ok {
+		scope.Log("artifact_review: Command can only run on the server")
+		return vfilter.Null{}
+	}
+
+	repository, err := vql_utils.GetRepository(scope)
+	if err != nil {
+		scope.Log("artifact_review: %v", err)
+		return vfilter.Null{}
+	}
+
+	principal := vql_subsystem.GetPrincipal(scope)
+	review, err := launcher.ReviewArtifact(ctx, config_obj, repository,
+		principal, arg.Name, arg.Comment)
+	if err != nil {
+		scope.Log("artifact_review: %v", err)
+		return vfilter.Null{}
+	}
+
+	return ordereddict.NewDict().
+		Set("Artifact", review.Artifact).
+		Set("Hash", review.Hash).
+		Set("Reviewer", review.Reviewer).
+		Set("Reviewed", time.Unix(review.Reviewed, 0).UTC()).
+		Set("Comment", review.Comment)
+}
+
+func (self ArtifactReviewFunction) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "artifact_review",
+		Doc:      "Mark the current definition of a custom artifact as reviewed so it may be hunted.",
+		ArgType:  type_map.AddType(scope, &ArtifactReviewFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.SERVER_ADMIN).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&ArtifactLintPlugin{})
+	vql_subsystem.RegisterFunction(&ArtifactReviewFunction{})
+}
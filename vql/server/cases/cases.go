@@ -0,0 +1,220 @@
+package cases
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/datastore"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+const (
+	CASE_STATE_OPEN   = "open"
+	CASE_STATE_CLOSED = "closed"
+)
+
+type CaseFlow struct {
+	ClientId string `json:"ClientId"`
+	FlowId   string `json:"FlowId"`
+}
+
+// A case groups the clients, flows, hunts, notebooks and exports
+// related to an investigation under a single id.
+//
+// Only the case members (and server administrators) may see or
+// modify the case. When a case with a retention period is closed,
+// it expires that many days later and may be purged with the
+// Server.Utils.PurgeCases artifact.
+type Case struct {
+	Id          string `json:"Id"`
+	Name        string `json:"Name"`
+	Description string `json:"Description,omitempty"`
+	Creator     string `json:"Creator"`
+	State       string `json:"State"`
+
+	Created  int64 `json:"Created"`
+	Modified int64 `json:"Modified"`
+	Closed   int64 `json:"Closed,omitempty"`
+
+	// Number of days to keep the case after it is closed (0 means
+	// keep forever).
+	Retention int64 `json:"Retention,omitempty"`
+
+	Members   []string   `json:"Members"`
+	Clients   []string   `json:"Clients"`
+	Flows     []CaseFlow `json:"Flows"`
+	Hunts     []string   `json:"Hunts"`
+	Notebooks []string   `json:"Notebooks"`
+	Exports   []string   `json:"Exports"`
+}
+
+func (self *Case) IsMember(principal string) bool {
+	return utils.InString(self.Members, principal)
+}
+
+func (self *Case) Expired(now int64) bool {
+	return self.State == CASE_STATE_CLOSED && self.Retention > 0 &&
+		now > self.Closed+self.Retention*24*60*60
+}
+
+func (self *Case) SetState(state string, now int64) error {
+	switch state {
+	case CASE_STATE_OPEN:
+		self.Closed = 0
+
+	case CASE_STATE_CLOSED:
+		if self.State != CASE_STATE_CLOSED {
+			self.Closed = now
+		}
+
+	default:
+		return fmt.Errorf("Invalid case state %q", state)
+	}
+
+	self.State = state
+	return nil
+}
+
+func (self *Case) AddFlow(client_id, flow_id string) {
+	self.AddClient(client_id)
+	for _, f := range self.Flows {
+		if f.ClientId == client_id && f.FlowId == flow_id {
+			return
+		}
+	}
+	self.Flows = append(self.Flows, CaseFlow{
+		ClientId: client_id,
+		FlowId:   flow_id,
+	})
+}
+
+func (self *Case) AddClient(client_id string) {
+	self.Clients = appendUnique(self.Clients, client_id)
+}
+
+func (self *Case) AddHunt(hunt_id string) {
+	self.Hunts = appendUnique(self.Hunts, hunt_id)
+}
+
+func (self *Case) AddNotebook(notebook_id string) {
+	self.Notebooks = appendUnique(self.Notebooks, notebook_id)
+}
+
+func (self *Case) AddExport(vfs_path string) {
+	self.Exports = appendUnique(self.Exports, vfs_path)
+}
+
+func appendUnique(list []string, item string) []string {
+	if item == "" || utils.InString(list, item) {
+		return list
+	}
+	return append(list, item)
+}
+
+func NewCase(name, creator string) *Case {
+	now := utils.GetTime().Now().Unix()
+	return &Case{
+		Id:       "CASE." + utils.NextId(),
+		Name:     name,
+		Creator:  creator,
+		State:    CASE_STATE_OPEN,
+		Created:  now,
+		Modified: now,
+		Members:  []string{creator},
+	}
+}
+
+func GetCase(config_obj *config_proto.Config, case_id string) (*Case, error) {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	raw_db, ok := db.(datastore.RawDataStore)
+	if !ok {
+		return nil, errors.New("Datastore has no raw access.")
+	}
+
+	data, err := raw_db.GetBuffer(config_obj, paths.CasePath(case_id))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.NotFoundError, case_id)
+	}
+
+	record := &Case{}
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, err
+	}
+
+	if record.Id != case_id {
+		return nil, fmt.Errorf("%w: %v", utils.NotFoundError, case_id)
+	}
+
+	return record, nil
+}
+
+func SetCase(config_obj *config_proto.Config, record *Case) error {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return err
+	}
+
+	raw_db, ok := db.(datastore.RawDataStore)
+	if !ok {
+		return errors.New("Datastore has no raw access.")
+	}
+
+	record.Modified = utils.GetTime().Now().Unix()
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return raw_db.SetBuffer(config_obj, paths.CasePath(record.Id),
+		data, utils.SyncCompleter)
+}
+
+func DeleteCase(config_obj *config_proto.Config, case_id string) error {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return err
+	}
+
+	return db.DeleteSubject(config_obj, paths.CasePath(case_id))
+}
+
+// List all the cases in the org, oldest first.
+func ListCases(config_obj *config_proto.Config) ([]*Case, error) {
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	children, err := db.ListChildren(config_obj, paths.CASES_ROOT)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*Case{}
+	for _, child := range children {
+		if child.IsDir() {
+			continue
+		}
+
+		record, err := GetCase(config_obj, child.Base())
+		if err != nil {
+			continue
+		}
+		result = append(result, record)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created < result[j].Created
+	})
+
+	return result, nil
+}
@@ -0,0 +1,125 @@
+package cases
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/stretchr/testify/suite"
+	"www.velocidex.com/golang/velociraptor/file_store/test_utils"
+	"www.velocidex.com/golang/velociraptor/logging"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+	"www.velocidex.com/golang/vfilter"
+)
+
+type CasesTestSuite struct {
+	test_utils.TestSuite
+}
+
+func (self *CasesTestSuite) SetupTest() {
+	self.TestSuite.SetupTest()
+
+	err := services.GrantRoles(self.ConfigObj, "admin", []string{"administrator"})
+	assert.NoError(self.T(), err)
+
+	err = services.GrantRoles(self.ConfigObj, "mic", []string{"analyst"})
+	assert.NoError(self.T(), err)
+
+	err = services.GrantRoles(self.ConfigObj, "fred", []string{"analyst"})
+	assert.NoError(self.T(), err)
+}
+
+func (self *CasesTestSuite) scopeFor(principal string) vfilter.Scope {
+	builder := services.ScopeBuilder{
+		Config:     self.ConfigObj,
+		ACLManager: acl_managers.NewServerACLManager(self.ConfigObj, principal),
+		Logger: logging.NewPlainLogger(
+			self.ConfigObj, &logging.FrontendComponent),
+		Env: ordereddict.NewDict(),
+	}
+
+	manager, err := services.GetRepositoryManager(self.ConfigObj)
+	assert.NoError(self.T(), err)
+	return manager.BuildScope(builder)
+}
+
+func (self *CasesTestSuite) listCases(scope vfilter.Scope) []vfilter.Row {
+	var result []vfilter.Row
+	for row := range (CasesPlugin{}).Call(self.Ctx, scope, ordereddict.NewDict()) {
+		result = append(result, row)
+	}
+	return result
+}
+
+func (self *CasesTestSuite) TestCaseMembership() {
+	mic_scope := self.scopeFor("mic")
+	defer mic_scope.Close()
+
+	fred_scope := self.scopeFor("fred")
+	defer fred_scope.Close()
+
+	admin_scope := self.scopeFor("admin")
+	defer admin_scope.Close()
+
+	res := CaseCreateFunction{}.Call(self.Ctx, mic_scope,
+		ordereddict.NewDict().
+			Set("name", "Phishing incident").
+			Set("retention", 30))
+	case_id, _ := res.(*ordereddict.Dict).GetString("Id")
+
+	CaseUpdateFunction{}.Call(self.Ctx, mic_scope,
+		ordereddict.NewDict().
+			Set("case_id", case_id).
+			Set("client_id", "C.1234").
+			Set("flow_id", "F.1234"))
+
+	record, err := GetCase(self.ConfigObj, case_id)
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), []string{"mic"}, record.Members)
+	assert.Equal(self.T(), []string{"C.1234"}, record.Clients)
+	assert.Equal(self.T(), []CaseFlow{{ClientId: "C.1234", FlowId: "F.1234"}},
+		record.Flows)
+
+	// Fred is not a member so can not see or modify the case.
+	assert.Equal(self.T(), 0, len(self.listCases(fred_scope)))
+
+	res = CaseUpdateFunction{}.Call(self.Ctx, fred_scope,
+		ordereddict.NewDict().
+			Set("case_id", case_id).
+			Set("hunt_id", "H.1234"))
+	assert.Equal(self.T(), vfilter.Null{}, res)
+
+	// Administrators can see all cases.
+	assert.Equal(self.T(), 1, len(self.listCases(admin_scope)))
+
+	// Once added, Fred can see the case.
+	CaseUpdateFunction{}.Call(self.Ctx, mic_scope,
+		ordereddict.NewDict().
+			Set("case_id", case_id).
+			Set("members", []string{"mic", "fred"}))
+	assert.Equal(self.T(), 1, len(self.listCases(fred_scope)))
+}
+
+func (self *CasesTestSuite) TestCaseRetention() {
+	closed := time.Unix(1700000000, 0)
+
+	record := NewCase("Test", "mic")
+	record.Retention = 30
+
+	assert.NoError(self.T(), record.SetState(CASE_STATE_CLOSED, closed.Unix()))
+	assert.Error(self.T(), record.SetState("pending", closed.Unix()))
+
+	// Cases only expire once the retention period has passed.
+	assert.True(self.T(), !record.Expired(closed.Add(24*time.Hour).Unix()))
+	assert.True(self.T(), record.Expired(closed.Add(31*24*time.Hour).Unix()))
+
+	// Re-opened cases never expire.
+	assert.NoError(self.T(), record.SetState(CASE_STATE_OPEN, closed.Unix()))
+	assert.True(self.T(), !record.Expired(closed.Add(31*24*time.Hour).Unix()))
+}
+
+func TestCases(t *testing.T) {
+	suite.Run(t, &CasesTestSuite{})
+}
@@ -0,0 +1,397 @@
+package cases
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type CaseCreateFunctionArgs struct {
+	Name        string   `vfilter:"required,field=name,doc=A name for the case."`
+	Description string   `vfilter:"optional,field=description,doc=A description of the case."`
+	Members     []string `vfilter:"optional,field=members,doc=Users allowed to access the case (the creator is always a member)."`
+	Retention   int64    `vfilter:"optional,field=retention,doc=Number of days to keep the case after it is closed (default forever)."`
+}
+
+type CaseCreateFunction struct{}
+
+func (self CaseCreateFunction) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.READ_RESULTS)
+	if err != nil {
+		scope.Log("case_create: %v", err)
+		return vfilter.Null{}
+	}
+
+	arg := &CaseCreateFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("case_create: %v", err)
+		return vfilter.Null{}
+	}
+
+	config_obj, err := getConfig(scope)
+	if err != nil {
+		scope.Log("case_create: %v", err)
+		return vfilter.Null{}
+	}
+
+	principal := vql_subsystem.GetPrincipal(scope)
+	record := NewCase(arg.Name, principal)
+	record.Description = arg.Description
+	record.Retention = arg.Retention
+	for _, member := range arg.Members {
+		record.Members = appendUnique(record.Members, member)
+	}
+
+	err = SetCase(config_obj, record)
+	if err != nil {
+		scope.Log("case_create: %v", err)
+		return vfilter.Null{}
+	}
+
+	services.LogAudit(ctx,
+		config_obj, principal, "case_create",
+		ordereddict.NewDict().
+			Set("case_id", record.Id).
+			Set("name", record.Name).
+			Set("members", record.Members))
+
+	return caseToDict(record)
+}
+
+func (self CaseCreateFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "case_create",
+		Doc:      "Creates a case to group the evidence of an investigation.",
+		ArgType:  type_map.AddType(scope, &CaseCreateFunctionArgs{}),
+		Metadata: vql_subsystem.VQLMetadata().Permissions(acls.READ_RESULTS).Build(),
+	}
+}
+
+type CaseUpdateFunctionArgs struct {
+	CaseId      string   `vfilter:"required,field=case_id,doc=The case to update."`
+	Description string   `vfilter:"optional,field=description,doc=A new description for the case."`
+	State       string   `vfilter:"optional,field=state,doc=Set the case state (open or closed)."`
+	Members     []string `vfilter:"optional,field=members,doc=Replace the case members."`
+	Retention   int64    `vfilter:"optional,field=retention,doc=Number of days to keep the case after it is closed."`
+	ClientId    string   `vfilter:"optional,field=client_id,doc=Add this client to the case."`
+	FlowId      string   `vfilter:"optional,field=flow_id,doc=Add this flow to the case (requires client_id)."`
+	HuntId      string   `vfilter:"optional,field=hunt_id,doc=Add this hunt to the case."`
+	NotebookId  string   `vfilter:"optional,field=notebook_id,doc=Add this notebook to the case."`
+	Export      string   `vfilter:"optional,field=export,doc=Add this exported file (a file store path) to the case."`
+}
+
+type CaseUpdateFunction struct{}
+
+func (self CaseUpdateFunction) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.READ_RESULTS)
+	if err != nil {
+		scope.Log("case_update: %v", err)
+		return vfilter.Null{}
+	}
+
+	arg := &CaseUpdateFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("case_update: %v", err)
+		return vfilter.Null{}
+	}
+
+	if arg.FlowId != "" && arg.ClientId == "" {
+		scope.Log("case_update: flow_id requires a client_id")
+		return vfilter.Null{}
+	}
+
+	config_obj, err := getConfig(scope)
+	if err != nil {
+		scope.Log("case_update: %v", err)
+		return vfilter.Null{}
+	}
+
+	record, err := getCaseWithAccess(scope, config_obj, arg.CaseId)
+	if err != nil {
+		scope.Log("case_update: %v", err)
+		return vfilter.Null{}
+	}
+
+	if arg.Description != "" {
+		record.Description = arg.Description
+	}
+
+	if arg.State != "" {
+		err = record.SetState(arg.State, utils.GetTime().Now().Unix())
+		if err != nil {
+			scope.Log("case_update: %v", err)
+			return vfilter.Null{}
+		}
+	}
+
+	if len(arg.Members) > 0 {
+		record.Members = nil
+		for _, member := range arg.Members {
+			record.Members = appendUnique(record.Members, member)
+		}
+	}
+
+	_, pres := args.Get("retention")
+	if pres {
+		record.Retention = arg.Retention
+	}
+
+	if arg.FlowId != "" {
+		record.AddFlow(arg.ClientId, arg.FlowId)
+	} else {
+		record.AddClient(arg.ClientId)
+	}
+	record.AddHunt(arg.HuntId)
+	record.AddNotebook(arg.NotebookId)
+	record.AddExport(arg.Export)
+
+	err = SetCase(config_obj, record)
+	if err != nil {
+		scope.Log("case_update: %v", err)
+		return vfilter.Null{}
+	}
+
+	principal := vql_subsystem.GetPrincipal(scope)
+	services.LogAudit(ctx,
+		config_obj, principal, "case_update",
+		ordereddict.NewDict().
+			Set("case_id", record.Id).
+			Set("args", args))
+
+	return caseToDict(record)
+}
+
+func (self CaseUpdateFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "case_update",
+		Doc:      "Updates a case or adds evidence to it.",
+		ArgType:  type_map.AddType(scope, &CaseUpdateFunctionArgs{}),
+		Metadata: vql_subsystem.VQLMetadata().Permissions(acls.READ_RESULTS).Build(),
+	}
+}
+
+type CaseDeleteFunctionArgs struct {
+	CaseId string `vfilter:"required,field=case_id,doc=The case to delete."`
+}
+
+type CaseDeleteFunction struct{}
+
+// Deleting a case only removes the case record. The flows, hunts and
+// notebooks it refers to must be deleted separately (see
+// Server.Utils.PurgeCases).
+func (self CaseDeleteFunction) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.SERVER_ADMIN)
+	if err != nil {
+		scope.Log("case_delete: %v", err)
+		return vfilter.Null{}
+	}
+
+	arg := &CaseDeleteFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("case_delete: %v", err)
+		return vfilter.Null{}
+	}
+
+	config_obj, err := getConfig(scope)
+	if err != nil {
+		scope.Log("case_delete: %v", err)
+		return vfilter.Null{}
+	}
+
+	err = DeleteCase(config_obj, arg.CaseId)
+	if err != nil {
+		scope.Log("case_delete: %v", err)
+		return vfilter.Null{}
+	}
+
+	principal := vql_subsystem.GetPrincipal(scope)
+	services.LogAudit(ctx,
+		config_obj, principal, "case_delete",
+		ordereddict.NewDict().Set("case_id", arg.CaseId))
+
+	return arg.CaseId
+}
+
+func (self CaseDeleteFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "case_delete",
+		Doc:      "Deletes a case record.",
+		ArgType:  type_map.AddType(scope, &CaseDeleteFunctionArgs{}),
+		Metadata: vql_subsystem.VQLMetadata().Permissions(acls.SERVER_ADMIN).Build(),
+	}
+}
+
+type CasesPluginArgs struct {
+	CaseId string `vfilter:"optional,field=case_id,doc=Only show this case."`
+}
+
+type CasesPlugin struct{}
+
+func (self CasesPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		err := vql_subsystem.CheckAccess(scope, acls.READ_RESULTS)
+		if err != nil {
+			scope.Log("cases: %v", err)
+			return
+		}
+
+		arg := &CasesPluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("cases: %v", err)
+			return
+		}
+
+		config_obj, err := getConfig(scope)
+		if err != nil {
+			scope.Log("cases: %v", err)
+			return
+		}
+
+		var records []*Case
+		if arg.CaseId != "" {
+			record, err := getCaseWithAccess(scope, config_obj, arg.CaseId)
+			if err != nil {
+				scope.Log("cases: %v", err)
+				return
+			}
+			records = append(records, record)
+
+		} else {
+			records, err = ListCases(config_obj)
+			if err != nil {
+				scope.Log("cases: %v", err)
+				return
+			}
+		}
+
+		for _, record := range records {
+			// Cases the user is not a member of are not shown.
+			if !canAccess(scope, record) {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- caseToDict(record):
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self CasesPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "cases",
+		Doc:      "List the cases the user is a member of.",
+		ArgType:  type_map.AddType(scope, &CasesPluginArgs{}),
+		Metadata: vql_subsystem.VQLMetadata().Permissions(acls.READ_RESULTS).Build(),
+	}
+}
+
+func getConfig(scope vfilter.Scope) (*config_proto.Config, error) {
+	err := services.RequireFrontend()
+	if err != nil {
+		return nil, err
+	}
+
+	config_obj, ok := vql_subsystem.GetServerConfig(scope)
+	if !ok {
+		return nil, fmt.Errorf("Command can only run on the server")
+	}
+	return config_obj, nil
+}
+
+// Server administrators can access all cases.
+func canAccess(scope vfilter.Scope, record *Case) bool {
+	return record.IsMember(vql_subsystem.GetPrincipal(scope)) ||
+		vql_subsystem.CheckAccess(scope, acls.SERVER_ADMIN) == nil
+}
+
+func getCaseWithAccess(scope vfilter.Scope,
+	config_obj *config_proto.Config, case_id string) (*Case, error) {
+	record, err := GetCase(config_obj, case_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canAccess(scope, record) {
+		return nil, fmt.Errorf("%w: Not a member of case %v",
+			acls.PermissionDenied, case_id)
+	}
+
+	return record, nil
+}
+
+func caseToDict(record *Case) *ordereddict.Dict {
+	flows := []*ordereddict.Dict{}
+	for _, f := range record.Flows {
+		flows = append(flows, ordereddict.NewDict().
+			Set("ClientId", f.ClientId).
+			Set("FlowId", f.FlowId))
+	}
+
+	result := ordereddict.NewDict().
+		Set("Id", record.Id).
+		Set("Name", record.Name).
+		Set("Description", record.Description).
+		Set("Creator", record.Creator).
+		Set("State", record.State).
+		Set("Created", time.Unix(record.Created, 0).UTC()).
+		Set("Modified", time.Unix(record.Modified, 0).UTC()).
+		Set("Closed", vfilter.Null{}).
+		Set("Retention", record.Retention).
+		Set("Expired", record.Expired(utils.GetTime().Now().Unix())).
+		Set("Members", record.Members).
+		Set("Clients", record.Clients).
+		Set("Flows", flows).
+		Set("Hunts", record.Hunts).
+		Set("Notebooks", record.Notebooks).
+		Set("Exports", record.Exports)
+
+	if record.Closed > 0 {
+		result.Set("Closed", time.Unix(record.Closed, 0).UTC())
+	}
+
+	return result
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&CaseCreateFunction{})
+	vql_subsystem.RegisterFunction(&CaseUpdateFunction{})
+	vql_subsystem.RegisterFunction(&CaseDeleteFunction{})
+	vql_subsystem.RegisterPlugin(&CasesPlugin{})
+}
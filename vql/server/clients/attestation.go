@@ -0,0 +1,78 @@
+package clients
+
+import (
+	"context"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	crypto_server "www.velocidex.com/golang/velociraptor/crypto/server"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type ClientAttestationFunctionArgs struct {
+	ClientId string `vfilter:"required,field=client_id,doc=The client to get the attestation report for"`
+}
+
+type ClientAttestationFunction struct{}
+
+func (self ClientAttestationFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.READ_RESULTS)
+	if err != nil {
+		scope.Log("client_attestation: %s", err)
+		return vfilter.Null{}
+	}
+
+	arg := &ClientAttestationFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("client_attestation: %v", err)
+		return vfilter.Null{}
+	}
+
+	err = services.RequireFrontend()
+	if err != nil {
+		scope.Log("client_attestation: %v", err)
+		return vfilter.Null{}
+	}
+
+	config_obj, ok := vql_subsystem.GetServerConfig(scope)
+	if !ok {
+		scope.Log("client_attestation: Command can only run on the server")
+		return vfilter.Null{}
+	}
+
+	// Clients which never sent a report have none.
+	record, err := crypto_server.GetAttestation(config_obj, arg.ClientId)
+	if err != nil {
+		return vfilter.Null{}
+	}
+
+	return ordereddict.NewDict().
+		Set("ClientId", record.ClientId).
+		Set("Attestation", record.Attestation).
+		Set("Enrolled", time.Unix(record.Enrolled, 0).UTC()).
+		Set("Changes", record.Changes).
+		Set("Previous", record.Previous)
+}
+
+func (self ClientAttestationFunction) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "client_attestation",
+		Doc:      "Returns the machine attestation report a client enrolled with.",
+		ArgType:  type_map.AddType(scope, &ClientAttestationFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.READ_RESULTS).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&ClientAttestationFunction{})
+}
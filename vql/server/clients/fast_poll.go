@@ -0,0 +1,179 @@
+package clients
+
+import (
+	"context"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/constants"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+const (
+	DEFAULT_FAST_POLL_DURATION = 600
+	MAX_FAST_POLL_DURATION     = 3600
+)
+
+type FastPollClientsPluginArgs struct {
+	ClientId string `vfilter:"optional,field=client_id,doc=The client to fast poll."`
+	Label    string `vfilter:"optional,field=label,doc=Fast poll all clients with this label."`
+	Duration uint64 `vfilter:"optional,field=duration,doc=How long to fast poll for in seconds (default 600, at most 3600)."`
+	Stop     bool   `vfilter:"optional,field=stop,doc=End the fast poll window early."`
+}
+
+// Fast polling keeps clients polling every min_poll seconds even in
+// laptop mode, so an analyst gets quick turnaround during an
+// interactive investigation. The window is always time bounded and
+// clients automatically revert to their normal poll schedule when it
+// expires.
+type FastPollClientsPlugin struct{}
+
+func (self FastPollClientsPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		err := vql_subsystem.CheckAccess(scope, acls.COLLECT_CLIENT)
+		if err != nil {
+			scope.Log("fast_poll_clients: %v", err)
+			return
+		}
+
+		arg := &FastPollClientsPluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("fast_poll_clients: %v", err)
+			return
+		}
+
+		if arg.ClientId == "" && arg.Label == "" {
+			scope.Log("fast_poll_clients: One of client_id or label must be specified")
+			return
+		}
+
+		if arg.Duration == 0 {
+			arg.Duration = DEFAULT_FAST_POLL_DURATION
+		}
+
+		if arg.Duration > MAX_FAST_POLL_DURATION {
+			scope.Log("fast_poll_clients: duration limited to %v seconds",
+				MAX_FAST_POLL_DURATION)
+			arg.Duration = MAX_FAST_POLL_DURATION
+		}
+
+		if arg.Stop {
+			arg.Duration = 0
+		}
+
+		err = services.RequireFrontend()
+		if err != nil {
+			scope.Log("fast_poll_clients: %v", err)
+			return
+		}
+
+		config_obj, ok := vql_subsystem.GetServerConfig(scope)
+		if !ok {
+			scope.Log("fast_poll_clients: Command can only run on the server")
+			return
+		}
+
+		client_manager, err := services.GetClientInfoManager(config_obj)
+		if err != nil {
+			scope.Log("fast_poll_clients: %v", err)
+			return
+		}
+
+		principal := vql_subsystem.GetPrincipal(scope)
+		services.LogAudit(ctx,
+			config_obj, principal, "fast_poll_clients",
+			ordereddict.NewDict().
+				Set("client_id", arg.ClientId).
+				Set("label", arg.Label).
+				Set("duration", arg.Duration))
+
+		var client_ids []string
+		if arg.ClientId != "" {
+			client_ids = append(client_ids, arg.ClientId)
+		}
+
+		if arg.Label != "" {
+			indexer, err := services.GetIndexer(config_obj)
+			if err != nil {
+				scope.Log("fast_poll_clients: %v", err)
+				return
+			}
+
+			search_chan, err := indexer.SearchClientsChan(ctx, scope,
+				config_obj, "label:"+arg.Label, principal)
+			if err != nil {
+				scope.Log("fast_poll_clients: %v", err)
+				return
+			}
+
+			for api_client := range search_chan {
+				client_ids = append(client_ids, api_client.ClientId)
+			}
+		}
+
+		// Clients which only receive the directive after the window
+		// has passed (e.g. because they were offline) ignore it.
+		now := utils.GetTime().Now()
+		expires := now.Add(time.Duration(arg.Duration) * time.Second)
+
+		for _, client_id := range client_ids {
+			err := client_manager.QueueMessageForClient(ctx, client_id,
+				&crypto_proto.VeloMessage{
+					SessionId: constants.FAST_POLL_WELL_KNOWN_FLOW,
+					PollDirective: &crypto_proto.PollDirective{
+						Duration: arg.Duration,
+						Expires:  uint64(expires.Unix()),
+					},
+				},
+				services.NOTIFY_CLIENT, utils.BackgroundWriter)
+			if err != nil {
+				scope.Log("fast_poll_clients: %v: %v", client_id, err)
+				continue
+			}
+
+			var until vfilter.Any = vfilter.Null{}
+			if arg.Duration > 0 {
+				until = expires.UTC()
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- ordereddict.NewDict().
+				Set("ClientId", client_id).
+				Set("Until", until):
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self FastPollClientsPlugin) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "fast_poll_clients",
+		Doc:      "Make clients poll the server as fast as possible for a limited time.",
+		ArgType:  type_map.AddType(scope, &FastPollClientsPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.COLLECT_CLIENT).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&FastPollClientsPlugin{})
+}
@@ -0,0 +1,94 @@
+package clients
+
+import (
+	"context"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/services/hash_inventory"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type HashInventoryPluginArgs struct {
+	Hashes []string `vfilter:"required,field=hash,doc=One or more SHA256 hashes to look up"`
+}
+
+type HashInventoryPlugin struct{}
+
+func (self HashInventoryPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		err := vql_subsystem.CheckAccess(scope, acls.READ_RESULTS)
+		if err != nil {
+			scope.Log("hash_inventory: %s", err)
+			return
+		}
+
+		arg := &HashInventoryPluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("hash_inventory: %v", err)
+			return
+		}
+
+		err = services.RequireFrontend()
+		if err != nil {
+			scope.Log("hash_inventory: %v", err)
+			return
+		}
+
+		config_obj, ok := vql_subsystem.GetServerConfig(scope)
+		if !ok {
+			scope.Log("hash_inventory: Command can only run on the server")
+			return
+		}
+
+		for _, hash := range arg.Hashes {
+			records, err := hash_inventory.LookupHash(config_obj, hash)
+			if err != nil {
+				scope.Log("hash_inventory: %v: %v", hash, err)
+				continue
+			}
+
+			for _, record := range records {
+				select {
+				case <-ctx.Done():
+					return
+				case output_chan <- ordereddict.NewDict().
+					Set("SHA256", record.Hash).
+					Set("ClientId", record.ClientId).
+					Set("Paths", record.Paths).
+					Set("Size", record.Size).
+					Set("Updated", time.Unix(record.Updated, 0).UTC()):
+				}
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self HashInventoryPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name: "hash_inventory",
+		Doc: "Find the clients with an executable matching the SHA256 hash " +
+			"in their Generic.Client.HashInventory.",
+		ArgType:  type_map.AddType(scope, &HashInventoryPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.READ_RESULTS).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&HashInventoryPlugin{})
+}
@@ -0,0 +1,150 @@
+package clients
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/constants"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type PauseClientsPluginArgs struct {
+	ClientId string `vfilter:"optional,field=client_id,doc=The client to pause."`
+	Label    string `vfilter:"optional,field=label,doc=Pause all clients with this label."`
+	Resume   bool   `vfilter:"optional,field=resume,doc=Resume the clients instead of pausing them."`
+}
+
+// Pausing a client stops its monitoring queries and defers regular
+// collections until the client is resumed. This is useful during
+// incident containment or change freezes. Urgent collections still
+// run on paused clients.
+type PauseClientsPlugin struct{}
+
+func (self PauseClientsPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		err := vql_subsystem.CheckAccess(scope, acls.MACHINE_STATE)
+		if err != nil {
+			scope.Log("pause_clients: %v", err)
+			return
+		}
+
+		arg := &PauseClientsPluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("pause_clients: %v", err)
+			return
+		}
+
+		if arg.ClientId == "" && arg.Label == "" {
+			scope.Log("pause_clients: One of client_id or label must be specified")
+			return
+		}
+
+		err = services.RequireFrontend()
+		if err != nil {
+			scope.Log("pause_clients: %v", err)
+			return
+		}
+
+		config_obj, ok := vql_subsystem.GetServerConfig(scope)
+		if !ok {
+			scope.Log("pause_clients: Command can only run on the server")
+			return
+		}
+
+		client_manager, err := services.GetClientInfoManager(config_obj)
+		if err != nil {
+			scope.Log("pause_clients: %v", err)
+			return
+		}
+
+		session_id := constants.PAUSE_WELL_KNOWN_FLOW
+		action := "Paused"
+		if arg.Resume {
+			session_id = constants.RESUME_WELL_KNOWN_FLOW
+			action = "Resumed"
+		}
+
+		principal := vql_subsystem.GetPrincipal(scope)
+		services.LogAudit(ctx,
+			config_obj, principal, "pause_clients",
+			ordereddict.NewDict().
+				Set("client_id", arg.ClientId).
+				Set("label", arg.Label).
+				Set("resume", arg.Resume))
+
+		var client_ids []string
+		if arg.ClientId != "" {
+			client_ids = append(client_ids, arg.ClientId)
+		}
+
+		if arg.Label != "" {
+			indexer, err := services.GetIndexer(config_obj)
+			if err != nil {
+				scope.Log("pause_clients: %v", err)
+				return
+			}
+
+			search_chan, err := indexer.SearchClientsChan(ctx, scope,
+				config_obj, "label:"+arg.Label, principal)
+			if err != nil {
+				scope.Log("pause_clients: %v", err)
+				return
+			}
+
+			for api_client := range search_chan {
+				client_ids = append(client_ids, api_client.ClientId)
+			}
+		}
+
+		for _, client_id := range client_ids {
+			err := client_manager.QueueMessageForClient(ctx, client_id,
+				&crypto_proto.VeloMessage{
+					SessionId: session_id,
+				},
+				services.NOTIFY_CLIENT, utils.BackgroundWriter)
+			if err != nil {
+				scope.Log("pause_clients: %v: %v", client_id, err)
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- ordereddict.NewDict().
+				Set("ClientId", client_id).
+				Set("Action", action):
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self PauseClientsPlugin) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "pause_clients",
+		Doc:      "Pause or resume non-essential activity on clients.",
+		ArgType:  type_map.AddType(scope, &PauseClientsPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.MACHINE_STATE).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&PauseClientsPlugin{})
+}
@@ -0,0 +1,197 @@
+package clients
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/constants"
+	crypto_proto "www.velocidex.com/golang/velociraptor/crypto/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+// A short description of what the task will do on the client.
+func taskType(task *crypto_proto.VeloMessage) string {
+	switch {
+	case task.SessionId == constants.PAUSE_WELL_KNOWN_FLOW:
+		return "Pause"
+	case task.SessionId == constants.RESUME_WELL_KNOWN_FLOW:
+		return "Resume"
+	case task.SessionId == constants.FAST_POLL_WELL_KNOWN_FLOW:
+		return "FastPoll"
+	case task.FlowRequest != nil:
+		return "FlowRequest"
+	case task.Sealed != nil:
+		return "Sealed"
+	case task.Cancel != nil:
+		return "Cancel"
+	case task.KillKillKill != nil:
+		return "Kill"
+	case task.UpdateEventTable != nil:
+		return "UpdateEventTable"
+	case task.UpdateForeman != nil:
+		return "UpdateForeman"
+	case task.Ping != nil:
+		return "Ping"
+	default:
+		return "Unknown"
+	}
+}
+
+type ClientTasksPluginArgs struct {
+	ClientId string `vfilter:"required,field=client_id,doc=The client id to inspect."`
+}
+
+type ClientTasksPlugin struct{}
+
+func (self ClientTasksPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		err := vql_subsystem.CheckAccess(scope, acls.READ_RESULTS)
+		if err != nil {
+			scope.Log("client_tasks: %s", err)
+			return
+		}
+
+		arg := &ClientTasksPluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("client_tasks: %v", err)
+			return
+		}
+
+		err = services.RequireFrontend()
+		if err != nil {
+			scope.Log("client_tasks: %v", err)
+			return
+		}
+
+		config_obj, ok := vql_subsystem.GetServerConfig(scope)
+		if !ok {
+			scope.Log("client_tasks: Command can only run on the server")
+			return
+		}
+
+		client_info_manager, err := services.GetClientInfoManager(config_obj)
+		if err != nil {
+			scope.Log("client_tasks: %v", err)
+			return
+		}
+
+		// Only tasks which were not yet delivered to the client
+		// are still in the queue.
+		tasks, err := client_info_manager.PeekClientTasks(ctx, arg.ClientId)
+		if err != nil {
+			scope.Log("client_tasks: %v", err)
+			return
+		}
+
+		for _, task := range tasks {
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- ordereddict.NewDict().
+				Set("TaskId", task.TaskId).
+				Set("FlowId", task.SessionId).
+				Set("Type", taskType(task)).
+				Set("Urgent", task.Urgent).
+				Set("Task", task):
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self ClientTasksPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "client_tasks",
+		Doc:      "List the tasks queued for a client which were not yet delivered.",
+		ArgType:  type_map.AddType(scope, &ClientTasksPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.READ_RESULTS).Build(),
+	}
+}
+
+type ClientTaskRemoveFunctionArgs struct {
+	ClientId string `vfilter:"required,field=client_id,doc=The client id to modify."`
+	TaskId   uint64 `vfilter:"required,field=task_id,doc=The task to remove (see client_tasks())."`
+}
+
+type ClientTaskRemoveFunction struct{}
+
+func (self ClientTaskRemoveFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.COLLECT_CLIENT)
+	if err != nil {
+		scope.Log("client_task_remove: %s", err)
+		return vfilter.Null{}
+	}
+
+	arg := &ClientTaskRemoveFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("client_task_remove: %v", err)
+		return vfilter.Null{}
+	}
+
+	err = services.RequireFrontend()
+	if err != nil {
+		scope.Log("client_task_remove: %v", err)
+		return vfilter.Null{}
+	}
+
+	config_obj, ok := vql_subsystem.GetServerConfig(scope)
+	if !ok {
+		scope.Log("client_task_remove: Command can only run on the server")
+		return vfilter.Null{}
+	}
+
+	client_info_manager, err := services.GetClientInfoManager(config_obj)
+	if err != nil {
+		scope.Log("client_task_remove: %v", err)
+		return vfilter.Null{}
+	}
+
+	err = client_info_manager.UnQueueMessageForClient(ctx, arg.ClientId,
+		&crypto_proto.VeloMessage{TaskId: arg.TaskId})
+	if err != nil {
+		scope.Log("client_task_remove: %v", err)
+		return vfilter.Null{}
+	}
+
+	principal := vql_subsystem.GetPrincipal(scope)
+	services.LogAudit(ctx,
+		config_obj, principal, "RemoveClientTask",
+		ordereddict.NewDict().
+			Set("client_id", arg.ClientId).
+			Set("task_id", arg.TaskId))
+
+	return arg.TaskId
+}
+
+func (self ClientTaskRemoveFunction) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "client_task_remove",
+		Doc:      "Remove a task from the client's queue before it is delivered.",
+		ArgType:  type_map.AddType(scope, &ClientTaskRemoveFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.COLLECT_CLIENT).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&ClientTasksPlugin{})
+	vql_subsystem.RegisterFunction(&ClientTaskRemoveFunction{})
+}
@@ -28,6 +28,7 @@ import (
 	"www.velocidex.com/golang/velociraptor/services"
 	"www.velocidex.com/golang/velociraptor/uploads"
 	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/utils/redact"
 	"www.velocidex.com/golang/velociraptor/vql"
 	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
 	"www.velocidex.com/golang/vfilter"
@@ -48,6 +49,7 @@ type CreateFlowDownloadArgs struct {
 	Format       string `vfilter:"optional,field=format,doc=Format to export (csv,json,csv_only) defaults to both."`
 	ExpandSparse bool   `vfilter:"optional,field=expand_sparse,doc=If set we expand sparse files in the archive."`
 	Name         string `vfilter:"optional,field=name,doc=If specified we call the file this name otherwise we generate name based on flow id."`
+	Redact       bool   `vfilter:"optional,field=redact,doc=If set, apply the configured redaction rules to the results. Uploaded files and logs are not included."`
 }
 
 type CreateFlowDownload struct{}
@@ -87,18 +89,28 @@ func (self *CreateFlowDownload) Call(ctx context.Context,
 		return vfilter.Null{}
 	}
 
+	var redactor *redact.Redactor
+	if arg.Redact {
+		redactor, err = redact.FromConfig(config_obj)
+		if err != nil {
+			scope.Log("create_flow_download: %v", err)
+			return vfilter.Null{}
+		}
+	}
+
 	principal := vql_subsystem.GetPrincipal(scope)
 	services.LogAudit(ctx,
 		config_obj, principal, "create_flow_download",
 		ordereddict.NewDict().
 			Set("format", format).
 			Set("client_id", arg.ClientId).
-			Set("flow_id", arg.FlowId))
+			Set("flow_id", arg.FlowId).
+			Set("redact", arg.Redact))
 
 	result, err := createDownloadFile(
 		ctx, scope, config_obj, format,
 		arg.FlowId, arg.ClientId, arg.Password,
-		arg.ExpandSparse, arg.Name, arg.Wait)
+		arg.ExpandSparse, arg.Name, arg.Wait, redactor)
 	if err != nil {
 		scope.Log("create_flow_download: %s", err)
 		return vfilter.Null{}
@@ -124,6 +136,7 @@ type CreateHuntDownloadArgs struct {
 	Filename     string `vfilter:"optional,field=base,doc=Base filename to write to."`
 	Password     string `vfilter:"optional,field=password,doc=An optional password to encrypt the collection zip."`
 	ExpandSparse bool   `vfilter:"optional,field=expand_sparse,doc=If set we expand sparse files in the archive."`
+	Redact       bool   `vfilter:"optional,field=redact,doc=If set, apply the configured redaction rules to the results. Uploaded files and logs are not included."`
 }
 
 type CreateHuntDownload struct{}
@@ -163,10 +176,19 @@ func (self *CreateHuntDownload) Call(ctx context.Context,
 		return vfilter.Null{}
 	}
 
+	var redactor *redact.Redactor
+	if arg.Redact {
+		redactor, err = redact.FromConfig(config_obj)
+		if err != nil {
+			scope.Log("create_hunt_download: %v", err)
+			return vfilter.Null{}
+		}
+	}
+
 	result, err := createHuntDownloadFile(
 		ctx, config_obj, scope, arg.HuntId,
 		format, arg.ExpandSparse,
-		arg.Wait, arg.OnlyCombined, arg.Filename, arg.Password)
+		arg.Wait, arg.OnlyCombined, arg.Filename, arg.Password, redactor)
 	if err != nil {
 		scope.Log("create_hunt_download: %s", err)
 		return vfilter.Null{}
@@ -191,7 +213,8 @@ func createDownloadFile(
 	format reporting.ContainerFormat,
 	flow_id, client_id, password string,
 	expand_sparse bool,
-	name string, wait bool) (api.FSPathSpec, error) {
+	name string, wait bool,
+	redactor *redact.Redactor) (api.FSPathSpec, error) {
 	if client_id == "" || flow_id == "" {
 		return nil, errors.New("Client Id and Flow Id should be specified.")
 	}
@@ -266,7 +289,7 @@ func createDownloadFile(
 
 		err := downloadFlowToZip(ctx, scope, config_obj, format,
 			client_id, path_specs.NewUnsafeFilestorePath(),
-			flow_id, expand_sparse, zip_writer)
+			flow_id, expand_sparse, zip_writer, redactor)
 		if err != nil {
 			logger := logging.GetLogger(config_obj, &logging.GUIComponent)
 			logger.Error("downloadFlowToZip: %v", err)
@@ -290,7 +313,8 @@ func downloadFlowToZip(
 	prefix api.FSPathSpec,
 	flow_id string,
 	expand_sparse bool,
-	zip_writer *reporting.Container) error {
+	zip_writer *reporting.Container,
+	redactor *redact.Redactor) error {
 
 	// Write the client info so it can be imported again
 	client_info_manager, err := services.GetClientInfoManager(config_obj)
@@ -341,12 +365,23 @@ func downloadFlowToZip(
 		}
 	}
 
-	// Copy the collection logs
+	// Logs, annotations and uploads can not be redacted so they are
+	// not exported when redacting.
 	flow_path_manager := paths.NewFlowPathManager(client_id, flow_id)
-	err = copyResultSetIntoContainer(ctx, config_obj, zip_writer, format,
-		flow_path_manager.Log(), prefix.AddChild("log"))
-	if err != nil {
-		return err
+	if redactor == nil {
+		// Copy the collection logs
+		err = copyResultSetIntoContainer(ctx, config_obj, zip_writer, format,
+			flow_path_manager.Log(), prefix.AddChild("log"), nil)
+		if err != nil {
+			return err
+		}
+
+		// Copy any analyst annotations
+		err = copyResultSetIntoContainer(ctx, config_obj, zip_writer, format,
+			flow_path_manager.Annotations(), prefix.AddChild("annotations"), nil)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Copy artifact results
@@ -359,13 +394,18 @@ func downloadFlowToZip(
 			}
 
 			err = copyResultSetIntoContainer(ctx, config_obj, zip_writer, format,
-				artifact_path_manager.Path(), prefix.AddChild("results", name))
+				artifact_path_manager.Path(), prefix.AddChild("results", name),
+				redactor.ForArtifact(name))
 			if err != nil {
 				return err
 			}
 		}
 	}
 
+	if redactor != nil {
+		return nil
+	}
+
 	// Copy uploads
 	err = copyUploadFiles(ctx, scope, config_obj, zip_writer,
 		prefix, format, flow_path_manager, expand_sparse)
@@ -647,7 +687,8 @@ func copyResultSetIntoContainer(
 	container *reporting.Container,
 	format reporting.ContainerFormat,
 	src api.FSPathSpec,
-	dest api.FSPathSpec) (err error) {
+	dest api.FSPathSpec,
+	redactor *redact.Redactor) (err error) {
 
 	file_store_factory := file_store.GetFileStore(config_obj)
 	reader, err := result_sets.NewResultSetReader(file_store_factory, src)
@@ -666,7 +707,8 @@ func copyResultSetIntoContainer(
 		return
 	}
 
-	json.ConvertJSONL(buf_chan, json_writer, csv_writer, nil)
+	json.ConvertJSONL(redactor.RedactJSONL(ctx, buf_chan),
+		json_writer, csv_writer, nil)
 
 	return nil
 }
@@ -707,7 +749,8 @@ func createHuntDownloadFile(
 	format reporting.ContainerFormat,
 	expand_sparse bool,
 	wait, only_combined bool,
-	base_filename, password string) (api.FSPathSpec, error) {
+	base_filename, password string,
+	redactor *redact.Redactor) (api.FSPathSpec, error) {
 	if hunt_id == "" {
 		return nil, errors.New("Hunt Id should be specified.")
 	}
@@ -801,7 +844,7 @@ func createHuntDownloadFile(
 
 		err = generateCombinedResults(
 			sub_ctx, config_obj, scope,
-			hunt_details, format, zip_writer)
+			hunt_details, format, zip_writer, redactor)
 		if err != nil {
 			logger.Error("createHuntDownloadFile: %v", err)
 			return
@@ -837,7 +880,7 @@ func createHuntDownloadFile(
 			err := downloadFlowToZip(
 				sub_ctx, scope, config_obj, format, client_id,
 				path_specs.NewUnsafeFilestorePath(hostname),
-				flow_id, expand_sparse, zip_writer)
+				flow_id, expand_sparse, zip_writer, redactor)
 			if err != nil {
 				logging.GetLogger(config_obj, &logging.FrontendComponent).
 					WithFields(logrus.Fields{
@@ -863,7 +906,8 @@ func generateCombinedResults(
 	scope vfilter.Scope,
 	hunt_details *api_proto.Hunt,
 	format reporting.ContainerFormat,
-	zip_writer *reporting.Container) error {
+	zip_writer *reporting.Container,
+	redactor *redact.Redactor) error {
 
 	file_store_factory := file_store.GetFileStore(config_obj)
 	hunt_dispatcher, err := services.GetHuntDispatcher(config_obj)
@@ -886,6 +930,9 @@ func generateCombinedResults(
 		defer maybeClose(json_writer)
 		defer maybeClose(csv_writer)
 
+		artifact_name, _ := paths.SplitFullSourceName(artifact_source)
+		artifact_redactor := redactor.ForArtifact(artifact_name)
+
 		options := services.FlowSearchOptions{BasicInformation: true}
 		flow_chan, _, err := hunt_dispatcher.GetFlows(ctx,
 			config_obj, options, scope, hunt_details.HuntId, 0)
@@ -925,7 +972,9 @@ func generateCombinedResults(
 				fqdn = api_client.OsInfo.Fqdn
 			}
 
-			json.ConvertJSONL(buf_chan, json_writer, csv_writer,
+			json.ConvertJSONL(
+				artifact_redactor.RedactJSONL(ctx, buf_chan),
+				json_writer, csv_writer,
 				ordereddict.NewDict().
 					Set("FlowId", flow_id).
 					Set("ClientId", client_id).
@@ -57,6 +57,7 @@ import (
 	"www.velocidex.com/golang/velociraptor/json"
 	"www.velocidex.com/golang/velociraptor/services"
 	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/utils/ecs"
 	"www.velocidex.com/golang/velociraptor/vql"
 	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
 	"www.velocidex.com/golang/velociraptor/vql/networking"
@@ -83,6 +84,10 @@ type _ElasticPluginArgs struct {
 	MaxMemoryBuffer    uint64              `vfilter:"optional,field=max_memory_buffer,doc=How large we allow the memory buffer to grow to while we are trying to contact the Elastic server (default 100mb)."`
 	Action             string              `vfilter:"optional,field=action,doc=Either index or create. For data streams this must be create."`
 	Secret             string              `vfilter:"optional,field=secret,doc=Alternatively use a secret from the secrets service. Secret must be of type 'AWS S3 Creds'"`
+	Schema             string              `vfilter:"optional,field=schema,doc=Normalize rows before uploading: raw (default), ecs (Elastic Common Schema) or text (flatten rows into the message field for full text search)."`
+	SchemaMapping      *ordereddict.Dict   `vfilter:"optional,field=schema_mapping,doc=Additional mappings of column names to ECS fields (e.g. dict(EventID='event.code'))."`
+	Redact             bool                `vfilter:"optional,field=redact,doc=If set, apply the configured redaction rules to rows before uploading."`
+	Artifact           string              `vfilter:"optional,field=artifact,doc=The artifact the rows come from, used to select the redaction rules."`
 }
 
 type _ElasticPlugin struct{}
@@ -124,6 +129,12 @@ func (self _ElasticPlugin) Call(ctx context.Context,
 			return
 		}
 
+		mapper, err := ecs.GetMapper(arg.Schema, arg.SchemaMapping)
+		if err != nil {
+			scope.Log("elastic: %v", err)
+			return
+		}
+
 		config_obj, _ := artifacts.GetConfig(scope)
 
 		if arg.Threads == 0 {
@@ -140,6 +151,15 @@ func (self _ElasticPlugin) Call(ctx context.Context,
 
 		wg := sync.WaitGroup{}
 		row_chan := arg.Query.Eval(ctx, scope)
+		if arg.Redact {
+			row_chan, err = redactRows(ctx, scope, "elastic",
+				arg.Artifact, row_chan)
+			if err != nil {
+				scope.Log("elastic: %v", err)
+				return
+			}
+		}
+
 		for i := 0; i < int(arg.Threads); i++ {
 			wg.Add(1)
 
@@ -148,7 +168,7 @@ func (self _ElasticPlugin) Call(ctx context.Context,
 
 			// Start an uploader on a thread.
 			go upload_rows(ctx, config_obj, scope, output_chan,
-				row_chan, id, arg.Action, &wg, arg)
+				row_chan, id, arg.Action, &wg, arg, mapper)
 		}
 
 		wg.Wait()
@@ -164,7 +184,8 @@ func upload_rows(
 	row_chan <-chan vfilter.Row,
 	id int64, action string,
 	wg *sync.WaitGroup,
-	arg *_ElasticPluginArgs) {
+	arg *_ElasticPluginArgs,
+	mapper *ecs.Mapper) {
 	defer wg.Done()
 
 	var buf bytes.Buffer
@@ -234,7 +255,8 @@ func upload_rows(
 			}
 
 			id = int64(utils.GetId())
-			err := append_row_to_buffer(ctx, scope, action, row, id, &buf, arg, opts)
+			err := append_row_to_buffer(ctx, scope, action, row, id, &buf,
+				arg, mapper, opts)
 			if err != nil {
 				scope.Log("elastic: %v", err)
 				continue
@@ -262,7 +284,7 @@ func append_row_to_buffer(
 	scope vfilter.Scope,
 	action string,
 	row vfilter.Row, id int64, buf *bytes.Buffer,
-	arg *_ElasticPluginArgs, opts *json.EncOpts) error {
+	arg *_ElasticPluginArgs, mapper *ecs.Mapper, opts *json.EncOpts) error {
 
 	row_dict := vfilter.RowToDict(ctx, scope, row)
 	index := arg.Index
@@ -273,6 +295,10 @@ func append_row_to_buffer(
 		row_dict.Delete("_index")
 	}
 
+	if mapper != nil {
+		row_dict = mapper.Map(row_dict)
+	}
+
 	var meta []byte
 	pipeline := arg.PipeLine
 	if pipeline != "" {
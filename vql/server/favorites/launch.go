@@ -0,0 +1,143 @@
+package favorites
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	api_proto "www.velocidex.com/golang/velociraptor/api/proto"
+	"www.velocidex.com/golang/velociraptor/datastore"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/velociraptor/vql/server/flows"
+	"www.velocidex.com/golang/velociraptor/vql/server/hunts"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type LaunchFavoriteArgs struct {
+	Name        string           `vfilter:"required,field=name,doc=The name of the favorite to launch."`
+	Type        string           `vfilter:"optional,field=type,doc=The type of favorite (default CLIENT)."`
+	ClientId    string           `vfilter:"optional,field=client_id,doc=Collect the favorite from this client."`
+	Label       string           `vfilter:"optional,field=label,doc=Start a hunt collecting the favorite from all clients with this label."`
+	Description string           `vfilter:"optional,field=description,doc=A description for the hunt."`
+	Expires     vfilter.LazyExpr `vfilter:"optional,field=expires,doc=A time for the hunt to expire (e.g. now() + 1800)"`
+}
+
+type LaunchFavorite struct{}
+
+func (self *LaunchFavorite) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	arg := &LaunchFavoriteArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("favorites_launch: %v", err)
+		return vfilter.Null{}
+	}
+
+	if (arg.ClientId == "") == (arg.Label == "") {
+		scope.Log("favorites_launch: Exactly one of client_id or label must be specified")
+		return vfilter.Null{}
+	}
+
+	if arg.Type == "" {
+		arg.Type = "CLIENT"
+	}
+
+	err = services.RequireFrontend()
+	if err != nil {
+		scope.Log("favorites_launch: %v", err)
+		return vfilter.Null{}
+	}
+
+	config_obj, ok := vql_subsystem.GetServerConfig(scope)
+	if !ok {
+		scope.Log("favorites_launch: Command can only run on the server")
+		return vfilter.Null{}
+	}
+
+	db, err := datastore.GetDB(config_obj)
+	if err != nil {
+		scope.Log("favorites_launch: %v", err)
+		return vfilter.Null{}
+	}
+
+	principal := vql_subsystem.GetPrincipal(scope)
+	if principal == "" {
+		scope.Log("favorites_launch: Username not specified")
+		return vfilter.Null{}
+	}
+
+	// Favorites belong to the calling user.
+	path_manager := paths.NewUserPathManager(principal)
+	fav := &api_proto.Favorite{}
+	err = db.GetSubject(config_obj,
+		path_manager.Favorites(arg.Name, arg.Type), fav)
+	if err != nil || len(fav.Spec) == 0 {
+		scope.Log("favorites_launch: Favorite %v not found", arg.Name)
+		return vfilter.Null{}
+	}
+
+	// Convert the stored specs to the spec format used by the
+	// collection functions.
+	artifacts := []string{}
+	spec := ordereddict.NewDict()
+	for _, item := range fav.Spec {
+		artifacts = append(artifacts, item.Artifact)
+		params := ordereddict.NewDict()
+		if item.Parameters != nil {
+			for _, env := range item.Parameters.Env {
+				params.Set(env.Key, env.Value)
+			}
+		}
+		spec.Set(item.Artifact, params)
+	}
+
+	// Delegate to the regular collection functions so the usual
+	// permission checks apply.
+	if arg.ClientId != "" {
+		return (&flows.ScheduleCollectionFunction{}).Call(ctx, scope,
+			ordereddict.NewDict().
+				Set("client_id", arg.ClientId).
+				Set("artifacts", artifacts).
+				Set("spec", spec))
+	}
+
+	description := arg.Description
+	if description == "" {
+		description = fav.Description
+	}
+	if description == "" {
+		description = fav.Name
+	}
+
+	hunt_args := ordereddict.NewDict().
+		Set("description", description).
+		Set("artifacts", artifacts).
+		Set("spec", spec).
+		Set("include_labels", []string{arg.Label})
+	if !utils.IsNil(arg.Expires) {
+		hunt_args.Set("expires", arg.Expires.Reduce(ctx))
+	}
+
+	return (&hunts.ScheduleHuntFunction{}).Call(ctx, scope, hunt_args)
+}
+
+func (self LaunchFavorite) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:    "favorites_launch",
+		Doc:     "Launch a saved favorite against a client or a label.",
+		ArgType: type_map.AddType(scope, &LaunchFavoriteArgs{}),
+		Metadata: vql_subsystem.VQLMetadata().Permissions(
+			acls.COLLECT_CLIENT, acls.START_HUNT).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&LaunchFavorite{})
+}
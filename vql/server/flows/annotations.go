@@ -0,0 +1,187 @@
+package flows
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/file_store"
+	"www.velocidex.com/golang/velociraptor/file_store/api"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/result_sets"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+// Annotations are stored in a result set next to the flow (or the
+// client when no flow is given) so they are exported and deleted
+// together with it.
+func annotationsPath(client_id, flow_id string) api.FSPathSpec {
+	if flow_id == "" {
+		return paths.NewClientPathManager(client_id).Annotations()
+	}
+	return paths.NewFlowPathManager(client_id, flow_id).Annotations()
+}
+
+type AnnotateFunctionArgs struct {
+	ClientId string      `vfilter:"required,field=client_id,doc=The client id to annotate."`
+	FlowId   string      `vfilter:"optional,field=flow_id,doc=If specified, annotate this flow instead of the client."`
+	Tag      string      `vfilter:"optional,field=tag,doc=A tag to apply (e.g. malicious, benign)."`
+	Note     string      `vfilter:"optional,field=note,doc=A free form note."`
+	Artifact string      `vfilter:"optional,field=artifact,doc=The artifact whose results are annotated."`
+	Row      vfilter.Any `vfilter:"optional,field=row,doc=The result row (or file) the annotation refers to."`
+}
+
+type AnnotateFunction struct{}
+
+func (self AnnotateFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.LABEL_CLIENT)
+	if err != nil {
+		scope.Log("annotate: %s", err)
+		return vfilter.Null{}
+	}
+
+	arg := &AnnotateFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("annotate: %v", err)
+		return vfilter.Null{}
+	}
+
+	if arg.Tag == "" && arg.Note == "" {
+		scope.Log("annotate: One of tag or note must be specified")
+		return vfilter.Null{}
+	}
+
+	err = services.RequireFrontend()
+	if err != nil {
+		scope.Log("annotate: %v", err)
+		return vfilter.Null{}
+	}
+
+	config_obj, ok := vql_subsystem.GetServerConfig(scope)
+	if !ok {
+		scope.Log("annotate: Command can only run on the server")
+		return vfilter.Null{}
+	}
+
+	journal, err := services.GetJournal(config_obj)
+	if err != nil {
+		scope.Log("annotate: %v", err)
+		return vfilter.Null{}
+	}
+
+	annotation := ordereddict.NewDict().
+		Set("Timestamp", utils.GetTime().Now().UTC()).
+		Set("Principal", vql_subsystem.GetPrincipal(scope)).
+		Set("ClientId", arg.ClientId).
+		Set("FlowId", arg.FlowId).
+		Set("Tag", arg.Tag).
+		Set("Note", arg.Note).
+		Set("Artifact", arg.Artifact).
+		Set("Row", arg.Row)
+
+	// The journal serializes concurrent writers so multiple analysts
+	// may annotate the same collection at once.
+	err = journal.AppendToResultSet(config_obj,
+		annotationsPath(arg.ClientId, arg.FlowId),
+		[]*ordereddict.Dict{annotation}, services.JournalOptions{})
+	if err != nil {
+		scope.Log("annotate: %v", err)
+		return vfilter.Null{}
+	}
+
+	return annotation
+}
+
+func (self AnnotateFunction) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "annotate",
+		Doc:      "Tag or leave a note on a client, a flow or a row in its results.",
+		ArgType:  type_map.AddType(scope, &AnnotateFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.LABEL_CLIENT).Build(),
+	}
+}
+
+type AnnotationsPluginArgs struct {
+	ClientId string `vfilter:"required,field=client_id,doc=The client id to read."`
+	FlowId   string `vfilter:"optional,field=flow_id,doc=If specified, read the flow's annotations instead of the client's."`
+}
+
+type AnnotationsPlugin struct{}
+
+func (self AnnotationsPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+	go func() {
+		defer close(output_chan)
+
+		err := vql_subsystem.CheckAccess(scope, acls.READ_RESULTS)
+		if err != nil {
+			scope.Log("annotations: %s", err)
+			return
+		}
+
+		arg := &AnnotationsPluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("annotations: %v", err)
+			return
+		}
+
+		err = services.RequireFrontend()
+		if err != nil {
+			scope.Log("annotations: %v", err)
+			return
+		}
+
+		config_obj, ok := vql_subsystem.GetServerConfig(scope)
+		if !ok {
+			scope.Log("annotations: Command can only run on the server")
+			return
+		}
+
+		file_store_factory := file_store.GetFileStore(config_obj)
+		rs_reader, err := result_sets.NewResultSetReader(
+			file_store_factory, annotationsPath(arg.ClientId, arg.FlowId))
+		if err != nil {
+			scope.Log("annotations: %v", err)
+			return
+		}
+		defer rs_reader.Close()
+
+		for row := range rs_reader.Rows(ctx) {
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self AnnotationsPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "annotations",
+		Doc:      "Retrieve the annotations made on a client or flow.",
+		ArgType:  type_map.AddType(scope, &AnnotationsPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.READ_RESULTS).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&AnnotateFunction{})
+	vql_subsystem.RegisterPlugin(&AnnotationsPlugin{})
+}
@@ -0,0 +1,265 @@
+package flows
+
+import (
+	"context"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/services/launcher"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/velociraptor/vql/functions"
+	vql_utils "www.velocidex.com/golang/velociraptor/vql/utils"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type ApprovalRequestFunctionArgs struct {
+	ClientId string           `vfilter:"required,field=client_id,doc=The client to collect the artifact from"`
+	Artifact string           `vfilter:"required,field=artifact,doc=The artifact requiring dual authorization"`
+	Reason   string           `vfilter:"required,field=reason,doc=Why the collection is needed"`
+	Expires  vfilter.LazyExpr `vfilter:"optional,field=expires,doc=A time for expiry (e.g. now() + 3600, default 24 hours)."`
+}
+
+type ApprovalRequestFunction struct{}
+
+func (self ApprovalRequestFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.COLLECT_CLIENT)
+	if err != nil {
+		scope.Log("approval_request: %s", err)
+		return vfilter.Null{}
+	}
+
+	arg := &ApprovalRequestFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("approval_request: %v", err)
+		return vfilter.Null{}
+	}
+
+	err = services.RequireFrontend()
+	if err != nil {
+		scope.Log("approval_request: %v", err)
+		return vfilter.Null{}
+	}
+
+	config_obj, ok := vql_subsystem.GetServerConfig(scope)
+	if !ok {
+		scope.Log("approval_request: Command can only run on the server")
+		return vfilter.Null{}
+	}
+
+	repository, err := vql_utils.GetRepository(scope)
+	if err != nil {
+		scope.Log("approval_request: %v", err)
+		return vfilter.Null{}
+	}
+
+	artifact, pres := repository.Get(ctx, config_obj, arg.Artifact)
+	if !pres {
+		scope.Log("approval_request: Unknown artifact %v", arg.Artifact)
+		return vfilter.Null{}
+	}
+
+	if !launcher.RequiresDualAuthorization(artifact) {
+		scope.Log("approval_request: Artifact %v does not require dual authorization",
+			arg.Artifact)
+		return vfilter.Null{}
+	}
+
+	expires := utils.GetTime().Now().Add(24 * time.Hour)
+	if !utils.IsNil(arg.Expires) {
+		expires, err = functions.TimeFromAny(ctx, scope, arg.Expires.Reduce(ctx))
+		if err != nil {
+			scope.Log("approval_request: expiry time invalid: %v", err)
+			return vfilter.Null{}
+		}
+	}
+
+	principal := vql_subsystem.GetPrincipal(scope)
+	approval, err := launcher.RequestApproval(ctx, config_obj,
+		&launcher.Approval{
+			ClientId:  arg.ClientId,
+			Artifact:  artifact.Name,
+			Reason:    arg.Reason,
+			Requester: principal,
+			Expires:   expires.Unix(),
+		})
+	if err != nil {
+		scope.Log("approval_request: %v", err)
+		return vfilter.Null{}
+	}
+
+	services.LogAudit(ctx,
+		config_obj, principal, "RequestApproval",
+		ordereddict.NewDict().
+			Set("id", approval.Id).
+			Set("client_id", approval.ClientId).
+			Set("artifact", approval.Artifact).
+			Set("reason", approval.Reason))
+
+	return approvalRow(approval)
+}
+
+func (self ApprovalRequestFunction) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "approval_request",
+		Doc:      "Request approval to collect an artifact requiring dual authorization from a client.",
+		ArgType:  type_map.AddType(scope, &ApprovalRequestFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.COLLECT_CLIENT).Build(),
+	}
+}
+
+type ApprovalGrantFunctionArgs struct {
+	Id string `vfilter:"required,field=id,doc=The approval to grant (see approvals())."`
+}
+
+type ApprovalGrantFunction struct{}
+
+func (self ApprovalGrantFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.COLLECT_CLIENT)
+	if err != nil {
+		scope.Log("approval_grant: %s", err)
+		return vfilter.Null{}
+	}
+
+	arg := &ApprovalGrantFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("approval_grant: %v", err)
+		return vfilter.Null{}
+	}
+
+	err = services.RequireFrontend()
+	if err != nil {
+		scope.Log("approval_grant: %v", err)
+		return vfilter.Null{}
+	}
+
+	config_obj, ok := vql_subsystem.GetServerConfig(scope)
+	if !ok {
+		scope.Log("approval_grant: Command can only run on the server")
+		return vfilter.Null{}
+	}
+
+	principal := vql_subsystem.GetPrincipal(scope)
+	approval, err := launcher.GrantApproval(ctx, config_obj, principal, arg.Id)
+	if err != nil {
+		scope.Log("approval_grant: %v", err)
+		return vfilter.Null{}
+	}
+
+	services.LogAudit(ctx,
+		config_obj, principal, "GrantApproval",
+		ordereddict.NewDict().
+			Set("id", approval.Id).
+			Set("client_id", approval.ClientId).
+			Set("artifact", approval.Artifact).
+			Set("requester", approval.Requester))
+
+	return approvalRow(approval)
+}
+
+func (self ApprovalGrantFunction) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "approval_grant",
+		Doc:      "Grant an approval requested by another user.",
+		ArgType:  type_map.AddType(scope, &ApprovalGrantFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.COLLECT_CLIENT).Build(),
+	}
+}
+
+type ApprovalsPlugin struct{}
+
+func (self ApprovalsPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		err := vql_subsystem.CheckAccess(scope, acls.READ_RESULTS)
+		if err != nil {
+			scope.Log("approvals: %s", err)
+			return
+		}
+
+		err = services.RequireFrontend()
+		if err != nil {
+			scope.Log("approvals: %v", err)
+			return
+		}
+
+		config_obj, ok := vql_subsystem.GetServerConfig(scope)
+		if !ok {
+			scope.Log("approvals: Command can only run on the server")
+			return
+		}
+
+		approvals, err := launcher.ListApprovals(ctx, config_obj)
+		if err != nil {
+			scope.Log("approvals: %v", err)
+			return
+		}
+
+		for _, approval := range approvals {
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- approvalRow(approval):
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self ApprovalsPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "approvals",
+		Doc:      "List the approvals for collecting artifacts requiring dual authorization.",
+		Metadata: vql.VQLMetadata().Permissions(acls.READ_RESULTS).Build(),
+	}
+}
+
+func approvalRow(approval *launcher.Approval) *ordereddict.Dict {
+	optionalTime := func(t int64) vfilter.Any {
+		if t == 0 {
+			return vfilter.Null{}
+		}
+		return time.Unix(t, 0).UTC()
+	}
+
+	return ordereddict.NewDict().
+		Set("Id", approval.Id).
+		Set("ClientId", approval.ClientId).
+		Set("Artifact", approval.Artifact).
+		Set("Reason", approval.Reason).
+		Set("Requester", approval.Requester).
+		Set("Created", time.Unix(approval.Created, 0).UTC()).
+		Set("Expires", time.Unix(approval.Expires, 0).UTC()).
+		Set("Approver", approval.Approver).
+		Set("Approved", optionalTime(approval.Approved)).
+		Set("UsedBy", approval.UsedBy).
+		Set("Used", optionalTime(approval.Used)).
+		Set("FlowId", approval.FlowId)
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&ApprovalRequestFunction{})
+	vql_subsystem.RegisterFunction(&ApprovalGrantFunction{})
+	vql_subsystem.RegisterPlugin(&ApprovalsPlugin{})
+}
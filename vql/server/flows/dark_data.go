@@ -0,0 +1,248 @@
+package flows
+
+import (
+	"context"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/artifacts"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/services/launcher"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
+	"www.velocidex.com/golang/velociraptor/vql/tools/collector"
+	vql_utils "www.velocidex.com/golang/velociraptor/vql/utils"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type DarkDataPluginArgs struct {
+	ClientId string `vfilter:"optional,field=client_id,doc=Only show dark data from this client"`
+	All      bool   `vfilter:"optional,field=all,doc=Also show uploads which were already reprocessed"`
+}
+
+type DarkDataPlugin struct{}
+
+func (self DarkDataPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		err := vql_subsystem.CheckAccess(scope, acls.READ_RESULTS)
+		if err != nil {
+			scope.Log("dark_data: %s", err)
+			return
+		}
+
+		arg := &DarkDataPluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("dark_data: %v", err)
+			return
+		}
+
+		err = services.RequireFrontend()
+		if err != nil {
+			scope.Log("dark_data: %v", err)
+			return
+		}
+
+		config_obj, ok := vql_subsystem.GetServerConfig(scope)
+		if !ok {
+			scope.Log("dark_data: Command can only run on the server")
+			return
+		}
+
+		records, err := launcher.ListDarkData(ctx, config_obj, arg.ClientId)
+		if err != nil {
+			scope.Log("dark_data: %v", err)
+			return
+		}
+
+		for _, record := range records {
+			if record.Reprocessed > 0 && !arg.All {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- darkDataRow(record):
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self DarkDataPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "dark_data",
+		Doc:      "List uploaded files which were not parsed into any results.",
+		ArgType:  type_map.AddType(scope, &DarkDataPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.READ_RESULTS).Build(),
+	}
+}
+
+type ReprocessUploadsFunctionArgs struct {
+	ClientId string            `vfilter:"required,field=client_id,doc=The client the files were uploaded from"`
+	FlowId   string            `vfilter:"required,field=flow_id,doc=The flow which uploaded the files"`
+	Artifact string            `vfilter:"required,field=artifact,doc=The server artifact to process the uploads with. It receives the ClientId and FlowId parameters."`
+	Env      *ordereddict.Dict `vfilter:"optional,field=env,doc=Additional parameters for the artifact"`
+}
+
+type ReprocessUploadsFunction struct{}
+
+func (self ReprocessUploadsFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.COLLECT_SERVER)
+	if err != nil {
+		scope.Log("reprocess_uploads: %s", err)
+		return vfilter.Null{}
+	}
+
+	arg := &ReprocessUploadsFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("reprocess_uploads: %v", err)
+		return vfilter.Null{}
+	}
+
+	err = services.RequireFrontend()
+	if err != nil {
+		scope.Log("reprocess_uploads: %v", err)
+		return vfilter.Null{}
+	}
+
+	config_obj, ok := vql_subsystem.GetServerConfig(scope)
+	if !ok {
+		scope.Log("reprocess_uploads: Command can only run on the server")
+		return vfilter.Null{}
+	}
+
+	record, err := launcher.GetDarkData(config_obj, arg.ClientId, arg.FlowId)
+	if err != nil {
+		scope.Log("reprocess_uploads: %v", err)
+		return vfilter.Null{}
+	}
+
+	repository, err := vql_utils.GetRepository(scope)
+	if err != nil {
+		scope.Log("reprocess_uploads: %v", err)
+		return vfilter.Null{}
+	}
+
+	// The artifact finds the uploads with the uploads() plugin.
+	env := ordereddict.NewDict()
+	if arg.Env != nil {
+		env.MergeFrom(arg.Env)
+	}
+	env.Set("ClientId", arg.ClientId).
+		Set("FlowId", arg.FlowId)
+
+	principal := vql_subsystem.GetPrincipal(scope)
+	request := &flows_proto.ArtifactCollectorArgs{
+		ClientId:  "server",
+		Artifacts: []string{arg.Artifact},
+		Creator:   principal,
+	}
+
+	err = collector.AddSpecProtobuf(ctx, config_obj, repository, scope,
+		ordereddict.NewDict().Set(arg.Artifact, env), request)
+	if err != nil {
+		scope.Log("reprocess_uploads: %v", err)
+		return vfilter.Null{}
+	}
+
+	acl_manager, ok := artifacts.GetACLManager(scope)
+	if !ok {
+		acl_manager = acl_managers.NullACLManager{}
+	}
+
+	launcher_service, err := services.GetLauncher(config_obj)
+	if err != nil {
+		scope.Log("reprocess_uploads: %v", err)
+		return vfilter.Null{}
+	}
+
+	flow_id, err := launcher_service.ScheduleArtifactCollection(
+		ctx, config_obj, acl_manager, repository, request, nil)
+	if err != nil {
+		scope.Log("reprocess_uploads: %v", err)
+		return vfilter.Null{}
+	}
+
+	record.ReprocessedBy = principal
+	record.Reprocessed = utils.GetTime().Now().Unix()
+	record.ReprocessFlowId = flow_id
+
+	err = launcher.SetDarkData(config_obj, record)
+	if err != nil {
+		scope.Log("reprocess_uploads: %v", err)
+		return vfilter.Null{}
+	}
+
+	services.LogAudit(ctx,
+		config_obj, principal, "ReprocessUploads",
+		ordereddict.NewDict().
+			Set("client_id", arg.ClientId).
+			Set("flow_id", arg.FlowId).
+			Set("artifact", arg.Artifact).
+			Set("reprocess_flow_id", flow_id))
+
+	return darkDataRow(record)
+}
+
+func (self ReprocessUploadsFunction) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "reprocess_uploads",
+		Doc:      "Process the unparsed uploads of a flow with a server artifact.",
+		ArgType:  type_map.AddType(scope, &ReprocessUploadsFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.COLLECT_SERVER).Build(),
+	}
+}
+
+func darkDataRow(record *launcher.DarkData) *ordereddict.Dict {
+	var reprocessed vfilter.Any = vfilter.Null{}
+	if record.Reprocessed > 0 {
+		reprocessed = time.Unix(record.Reprocessed, 0).UTC()
+	}
+
+	var total_size int64
+	uploads := make([]*ordereddict.Dict, 0, len(record.Uploads))
+	for _, upload := range record.Uploads {
+		total_size += upload.Size
+		uploads = append(uploads, ordereddict.NewDict().
+			Set("VFSPath", upload.VFSPath).
+			Set("Size", upload.Size))
+	}
+
+	return ordereddict.NewDict().
+		Set("ClientId", record.ClientId).
+		Set("FlowId", record.FlowId).
+		Set("Artifacts", record.Artifacts).
+		Set("Reason", record.Reason).
+		Set("Created", time.Unix(record.Created, 0).UTC()).
+		Set("TotalUploads", len(uploads)).
+		Set("TotalSize", total_size).
+		Set("Uploads", uploads).
+		Set("ReprocessedBy", record.ReprocessedBy).
+		Set("Reprocessed", reprocessed).
+		Set("ReprocessFlowId", record.ReprocessFlowId)
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&DarkDataPlugin{})
+	vql_subsystem.RegisterFunction(&ReprocessUploadsFunction{})
+}
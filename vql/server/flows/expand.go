@@ -0,0 +1,339 @@
+package flows
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/file_store"
+	"www.velocidex.com/golang/velociraptor/file_store/api"
+	"www.velocidex.com/golang/velociraptor/file_store/path_specs"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/paths"
+	"www.velocidex.com/golang/velociraptor/result_sets"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+var (
+	errExpansionLimit = errors.New("Archive expansion limit reached")
+)
+
+type ExpandArchivePluginArgs struct {
+	ClientId string `vfilter:"required,field=client_id,doc=The client id of the flow."`
+	FlowId   string `vfilter:"required,field=flow_id,doc=The flow which uploaded the archive."`
+	VFSPath  string `vfilter:"required,field=vfs_path,doc=The file store path of the uploaded archive (as in System.Upload.Completion)."`
+	Type     string `vfilter:"optional,field=type,doc=The archive type (zip or gzip). Detected from the file name by default."`
+	MaxFiles int64  `vfilter:"optional,field=max_files,doc=Maximum number of members to expand (default 1000)."`
+	MaxSize  int64  `vfilter:"optional,field=max_size,doc=Maximum total expanded size in bytes (default 100mb)."`
+}
+
+type ExpandArchivePlugin struct{}
+
+func (self ExpandArchivePlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+		defer vql_subsystem.RegisterMonitor("expand_archive", args)()
+
+		err := vql_subsystem.CheckAccess(scope,
+			acls.READ_RESULTS, acls.PREPARE_RESULTS)
+		if err != nil {
+			scope.Log("expand_archive: %s", err)
+			return
+		}
+
+		err = services.RequireFrontend()
+		if err != nil {
+			scope.Log("expand_archive: %v", err)
+			return
+		}
+
+		arg := &ExpandArchivePluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("expand_archive: %v", err)
+			return
+		}
+
+		config_obj, ok := vql_subsystem.GetServerConfig(scope)
+		if !ok {
+			scope.Log("expand_archive: Command can only run on the server")
+			return
+		}
+
+		if arg.MaxFiles == 0 {
+			arg.MaxFiles = 1000
+		}
+
+		if arg.MaxSize == 0 {
+			arg.MaxSize = 100 * 1024 * 1024
+		}
+
+		if arg.Type == "" {
+			arg.Type = archiveTypeFromName(arg.VFSPath)
+		}
+
+		expander, err := newArchiveExpander(config_obj, arg)
+		if err != nil {
+			scope.Log("expand_archive: %v", err)
+			return
+		}
+		defer expander.Close()
+
+		err = expander.Expand(ctx, func(row *ordereddict.Dict) {
+			select {
+			case <-ctx.Done():
+			case output_chan <- row:
+			}
+		})
+		if err != nil {
+			scope.Log("expand_archive: %v: %v", arg.VFSPath, err)
+		}
+	}()
+
+	return output_chan
+}
+
+func (self ExpandArchivePlugin) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name: "expand_archive",
+		Doc: "Expand an uploaded zip or gzip archive into the flow's " +
+			"uploads, returning the hashes of each member.",
+		ArgType: type_map.AddType(scope, &ExpandArchivePluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(
+			acls.READ_RESULTS, acls.PREPARE_RESULTS).Build(),
+	}
+}
+
+func archiveTypeFromName(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	case strings.HasSuffix(name, ".gz"), strings.HasSuffix(name, ".gzip"):
+		return "gzip"
+	}
+	return ""
+}
+
+// Expands archive members into the flow's uploads next to the
+// archive. A member "dir/file.txt" of the upload ".../foo.zip" is
+// stored as ".../foo.zip.expanded/dir/file.txt" so the original paths
+// within the archive are preserved.
+type archiveExpander struct {
+	config_obj *config_proto.Config
+	arg        *ExpandArchivePluginArgs
+
+	archive_path api.FSPathSpec
+	output_path  api.FSPathSpec
+
+	rs_writer result_sets.ResultSetWriter
+
+	count int64
+	size  int64
+}
+
+func newArchiveExpander(
+	config_obj *config_proto.Config,
+	arg *ExpandArchivePluginArgs) (*archiveExpander, error) {
+	flow_path_manager := paths.NewFlowPathManager(arg.ClientId, arg.FlowId)
+
+	archive_path := path_specs.NewUnsafeFilestorePath(
+		paths.ExtractClientPathComponents(arg.VFSPath)...).
+		SetType(api.PATH_TYPE_FILESTORE_ANY)
+
+	// Only allow expanding the flow's own uploads.
+	if !path_specs.IsSubPath(flow_path_manager.UploadContainer(), archive_path) {
+		return nil, fmt.Errorf("%v is not an upload of flow %v",
+			arg.VFSPath, arg.FlowId)
+	}
+
+	rs_writer, err := result_sets.NewResultSetWriter(
+		file_store.GetFileStore(config_obj), flow_path_manager.UploadMetadata(),
+		json.DefaultEncOpts(), utils.SyncCompleter, result_sets.AppendMode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &archiveExpander{
+		config_obj:   config_obj,
+		arg:          arg,
+		archive_path: archive_path,
+		output_path: archive_path.Dir().AddUnsafeChild(
+			archive_path.Base() + ".expanded"),
+		rs_writer: rs_writer,
+	}, nil
+}
+
+func (self *archiveExpander) Close() {
+	self.rs_writer.Close()
+}
+
+func (self *archiveExpander) Expand(
+	ctx context.Context, emit func(row *ordereddict.Dict)) error {
+	file_store_factory := file_store.GetFileStore(self.config_obj)
+	fd, err := file_store_factory.ReadFile(self.archive_path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	switch self.arg.Type {
+	case "zip":
+		stat, err := fd.Stat()
+		if err != nil {
+			return err
+		}
+
+		zip_reader, err := zip.NewReader(
+			utils.MakeReaderAtter(fd), stat.Size())
+		if err != nil {
+			return err
+		}
+
+		for _, member := range zip_reader.File {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			if member.FileInfo().IsDir() {
+				continue
+			}
+
+			reader, err := member.Open()
+			if err != nil {
+				continue
+			}
+
+			row, err := self.writeMember(member.Name, reader)
+			reader.Close()
+			if err != nil {
+				return err
+			}
+			emit(row)
+		}
+		return nil
+
+	case "gzip":
+		reader, err := gzip.NewReader(fd)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		// Gzip only contains a single member.
+		name := reader.Name
+		if name == "" {
+			name = strings.TrimSuffix(strings.TrimSuffix(
+				self.archive_path.Base(), ".gz"), ".gzip")
+		}
+
+		row, err := self.writeMember(name, reader)
+		if err != nil {
+			return err
+		}
+		emit(row)
+		return nil
+
+	default:
+		return fmt.Errorf("Unsupported archive type %q", self.arg.Type)
+	}
+}
+
+func (self *archiveExpander) writeMember(
+	name string, reader io.Reader) (*ordereddict.Dict, error) {
+	if self.count >= self.arg.MaxFiles {
+		return nil, errExpansionLimit
+	}
+	self.count++
+
+	// Members may not escape the expansion directory.
+	var components []string
+	for _, c := range strings.Split(strings.ReplaceAll(name, "\\", "/"), "/") {
+		if c != "" && c != "." && c != ".." {
+			components = append(components, c)
+		}
+	}
+	if len(components) == 0 {
+		components = []string{fmt.Sprintf("member_%d", self.count)}
+	}
+
+	member_path := self.output_path.AddUnsafeChild(components...)
+
+	file_store_factory := file_store.GetFileStore(self.config_obj)
+	out_fd, err := file_store_factory.WriteFile(member_path)
+	if err != nil {
+		return nil, err
+	}
+	defer out_fd.Close()
+
+	err = out_fd.Truncate()
+	if err != nil {
+		return nil, err
+	}
+
+	md5_sum := md5.New()
+	sha1_sum := sha1.New()
+	sha256_sum := sha256.New()
+
+	// Read one more byte than allowed to detect when the limit is
+	// exceeded.
+	remaining := self.arg.MaxSize - self.size
+	n, err := io.Copy(io.MultiWriter(out_fd, md5_sum, sha1_sum, sha256_sum),
+		io.LimitReader(reader, remaining+1))
+	if err != nil {
+		return nil, err
+	}
+	self.size += n
+
+	if n > remaining {
+		return nil, errExpansionLimit
+	}
+
+	vfs_path := member_path.AsClientPath()
+	now := utils.GetTime().Now().UTC()
+	self.rs_writer.Write(ordereddict.NewDict().
+		Set("Timestamp", now.Unix()).
+		Set("started", now.String()).
+		Set("vfs_path", vfs_path).
+		Set("Type", "expanded").
+		Set("_Components", member_path.Components()).
+		Set("file_size", n).
+		Set("uploaded_size", n))
+
+	return ordereddict.NewDict().
+		Set("ClientId", self.arg.ClientId).
+		Set("FlowId", self.arg.FlowId).
+		Set("Archive", self.arg.VFSPath).
+		Set("Member", name).
+		Set("VFSPath", vfs_path).
+		Set("Size", n).
+		Set("MD5", hex.EncodeToString(md5_sum.Sum(nil))).
+		Set("SHA1", hex.EncodeToString(sha1_sum.Sum(nil))).
+		Set("SHA256", hex.EncodeToString(sha256_sum.Sum(nil))), nil
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&ExpandArchivePlugin{})
+}
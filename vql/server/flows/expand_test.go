@@ -0,0 +1,111 @@
+package flows
+
+import (
+	"archive/zip"
+	"bytes"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/alecthomas/assert"
+	"www.velocidex.com/golang/velociraptor/file_store"
+	"www.velocidex.com/golang/velociraptor/file_store/test_utils"
+	"www.velocidex.com/golang/velociraptor/paths"
+)
+
+func (self *TestSuite) writeTestZip(members map[string]string) string {
+	buf := &bytes.Buffer{}
+	zip_writer := zip.NewWriter(buf)
+	for name, data := range members {
+		fd, err := zip_writer.Create(name)
+		assert.NoError(self.T(), err)
+		_, err = fd.Write([]byte(data))
+		assert.NoError(self.T(), err)
+	}
+	assert.NoError(self.T(), zip_writer.Close())
+
+	flow_path_manager := paths.NewFlowPathManager(self.client_id, self.flow_id)
+	upload_path := flow_path_manager.GetUploadsFile(
+		"auto", "C:/evidence.zip", []string{"C:", "evidence.zip"}).Path()
+
+	fd, err := file_store.GetFileStore(self.ConfigObj).WriteFile(upload_path)
+	assert.NoError(self.T(), err)
+	_, err = fd.Write(buf.Bytes())
+	assert.NoError(self.T(), err)
+	fd.Close()
+
+	return upload_path.AsClientPath()
+}
+
+func (self *TestSuite) TestExpandArchive() {
+	vfs_path := self.writeTestZip(map[string]string{
+		"dir/hello.txt":   "hello",
+		"../../evil.txt":  "evil",
+		"dir/sub/bye.txt": "bye",
+	})
+
+	expander, err := newArchiveExpander(self.ConfigObj, &ExpandArchivePluginArgs{
+		ClientId: self.client_id,
+		FlowId:   self.flow_id,
+		VFSPath:  vfs_path,
+		Type:     archiveTypeFromName(vfs_path),
+		MaxFiles: 10,
+		MaxSize:  1024,
+	})
+	assert.NoError(self.T(), err)
+
+	rows := make(map[string]*ordereddict.Dict)
+	err = expander.Expand(self.Ctx, func(row *ordereddict.Dict) {
+		member, _ := row.GetString("Member")
+		rows[member] = row
+	})
+	assert.NoError(self.T(), err)
+	expander.Close()
+
+	assert.Equal(self.T(), 3, len(rows))
+
+	sha256, _ := rows["dir/hello.txt"].GetString("SHA256")
+	assert.Equal(self.T(),
+		"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", sha256)
+
+	// Members are stored next to the archive with their paths
+	// preserved and can not escape it.
+	member_path, _ := rows["dir/hello.txt"].GetString("VFSPath")
+	assert.Equal(self.T(), vfs_path+".expanded/dir/hello.txt", member_path)
+
+	evil_path, _ := rows["../../evil.txt"].GetString("VFSPath")
+	assert.Equal(self.T(), vfs_path+".expanded/evil.txt", evil_path)
+
+	// The expanded members are added to the flow's uploads.
+	flow_path_manager := paths.NewFlowPathManager(self.client_id, self.flow_id)
+	upload_rows := test_utils.FileReadRows(self.T(), self.ConfigObj,
+		flow_path_manager.UploadMetadata())
+	assert.Equal(self.T(), 3, len(upload_rows))
+}
+
+func (self *TestSuite) TestExpandArchiveLimits() {
+	vfs_path := self.writeTestZip(map[string]string{
+		"big.txt": "0123456789",
+	})
+
+	expander, err := newArchiveExpander(self.ConfigObj, &ExpandArchivePluginArgs{
+		ClientId: self.client_id,
+		FlowId:   self.flow_id,
+		VFSPath:  vfs_path,
+		Type:     "zip",
+		MaxFiles: 10,
+		MaxSize:  5,
+	})
+	assert.NoError(self.T(), err)
+	defer expander.Close()
+
+	err = expander.Expand(self.Ctx, func(row *ordereddict.Dict) {})
+	assert.Equal(self.T(), errExpansionLimit, err)
+
+	// Archives outside the flow's uploads are rejected.
+	_, err = newArchiveExpander(self.ConfigObj, &ExpandArchivePluginArgs{
+		ClientId: self.client_id,
+		FlowId:   "F.OTHER",
+		VFSPath:  vfs_path,
+		Type:     "zip",
+	})
+	assert.Error(self.T(), err)
+}
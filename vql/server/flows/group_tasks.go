@@ -0,0 +1,338 @@
+package flows
+
+import (
+	"context"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/artifacts"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/services/launcher"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
+	"www.velocidex.com/golang/velociraptor/vql/functions"
+	"www.velocidex.com/golang/velociraptor/vql/tools/collector"
+	vql_utils "www.velocidex.com/golang/velociraptor/vql/utils"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type CollectGroupFunctionArgs struct {
+	Label     string            `vfilter:"required,field=label,doc=Schedule the collection on all clients with this label"`
+	Artifacts []string          `vfilter:"optional,field=artifacts,doc=A list of artifacts to collect"`
+	Env       *ordereddict.Dict `vfilter:"optional,field=env,doc=Parameters to apply to the artifact (an alternative to a full spec)"`
+	Spec      *ordereddict.Dict `vfilter:"optional,field=spec,doc=Parameters to apply to the artifacts"`
+	Timeout   uint64            `vfilter:"optional,field=timeout,doc=Set query timeout (default 10 min)"`
+	MaxRows   uint64            `vfilter:"optional,field=max_rows,doc=Max number of rows to fetch"`
+	MaxBytes  uint64            `vfilter:"optional,field=max_bytes,doc=Max number of bytes to upload"`
+	Urgent    bool              `vfilter:"optional,field=urgent,doc=Set the collection as urgent - skips other queues collections on the client."`
+	Expires   vfilter.LazyExpr  `vfilter:"optional,field=expires,doc=A time for expiry (e.g. now() + 1800, default 7 days). Clients checking in later will not run the collection."`
+}
+
+type CollectGroupFunction struct{}
+
+func (self CollectGroupFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.COLLECT_CLIENT)
+	if err != nil {
+		scope.Log("collect_group: %s", err)
+		return vfilter.Null{}
+	}
+
+	arg := &CollectGroupFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("collect_group: %v", err)
+		return vfilter.Null{}
+	}
+
+	// If a full spec is provided we dont need to provide the
+	// artifacts again.
+	if arg.Spec != nil && len(arg.Artifacts) == 0 {
+		arg.Artifacts = arg.Spec.Keys()
+	}
+
+	if len(arg.Artifacts) == 0 {
+		scope.Log("collect_group: no artifacts to collect!")
+		return vfilter.Null{}
+	}
+
+	err = services.RequireFrontend()
+	if err != nil {
+		scope.Log("collect_group: %v", err)
+		return vfilter.Null{}
+	}
+
+	config_obj, ok := vql_subsystem.GetServerConfig(scope)
+	if !ok {
+		scope.Log("collect_group: Command can only run on the server")
+		return vfilter.Null{}
+	}
+
+	expires := utils.GetTime().Now().Add(7 * 24 * time.Hour)
+	if !utils.IsNil(arg.Expires) {
+		expires, err = functions.TimeFromAny(ctx, scope, arg.Expires.Reduce(ctx))
+		if err != nil {
+			scope.Log("collect_group: expiry time invalid: %v", err)
+			return vfilter.Null{}
+		}
+	}
+
+	request := &flows_proto.ArtifactCollectorArgs{
+		Artifacts:      arg.Artifacts,
+		Creator:        vql_subsystem.GetPrincipal(scope),
+		Timeout:        arg.Timeout,
+		MaxRows:        arg.MaxRows,
+		MaxUploadBytes: arg.MaxBytes,
+		Urgent:         arg.Urgent,
+	}
+
+	// Compile the request once for all the clients.
+	err = compileDeferredCollection(ctx, scope, config_obj,
+		request, arg.Spec, arg.Env)
+	if err != nil {
+		scope.Log("collect_group: %v", err)
+		return vfilter.Null{}
+	}
+
+	client_info_manager, err := services.GetClientInfoManager(config_obj)
+	if err != nil {
+		scope.Log("collect_group: %v", err)
+		return vfilter.Null{}
+	}
+
+	task, err := client_info_manager.QueueGroupTask(ctx, &services.GroupTask{
+		Label:   arg.Label,
+		Creator: request.Creator,
+		Expires: expires.Unix(),
+		Request: request,
+	})
+	if err != nil {
+		scope.Log("collect_group: %v", err)
+		return vfilter.Null{}
+	}
+
+	services.LogAudit(ctx,
+		config_obj, request.Creator, "CollectGroup",
+		ordereddict.NewDict().
+			Set("id", task.Id).
+			Set("label", task.Label).
+			Set("artifacts", request.Artifacts))
+
+	return groupTaskRow(task)
+}
+
+func (self CollectGroupFunction) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "collect_group",
+		Doc:      "Launch an artifact collection on all clients with a label as they check in.",
+		ArgType:  type_map.AddType(scope, &CollectGroupFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.COLLECT_CLIENT).Build(),
+	}
+}
+
+type GroupTasksPlugin struct{}
+
+func (self GroupTasksPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		err := vql_subsystem.CheckAccess(scope, acls.READ_RESULTS)
+		if err != nil {
+			scope.Log("group_tasks: %s", err)
+			return
+		}
+
+		err = services.RequireFrontend()
+		if err != nil {
+			scope.Log("group_tasks: %v", err)
+			return
+		}
+
+		config_obj, ok := vql_subsystem.GetServerConfig(scope)
+		if !ok {
+			scope.Log("group_tasks: Command can only run on the server")
+			return
+		}
+
+		client_info_manager, err := services.GetClientInfoManager(config_obj)
+		if err != nil {
+			scope.Log("group_tasks: %v", err)
+			return
+		}
+
+		tasks, err := client_info_manager.ListGroupTasks(ctx)
+		if err != nil {
+			scope.Log("group_tasks: %v", err)
+			return
+		}
+
+		for _, task := range tasks {
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- groupTaskRow(task):
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self GroupTasksPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "group_tasks",
+		Doc:      "List the group collections which have not expired yet.",
+		Metadata: vql.VQLMetadata().Permissions(acls.READ_RESULTS).Build(),
+	}
+}
+
+type GroupTaskRemoveFunctionArgs struct {
+	Id string `vfilter:"required,field=id,doc=The group task to remove (see group_tasks())."`
+}
+
+type GroupTaskRemoveFunction struct{}
+
+func (self GroupTaskRemoveFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.COLLECT_CLIENT)
+	if err != nil {
+		scope.Log("group_task_remove: %s", err)
+		return vfilter.Null{}
+	}
+
+	arg := &GroupTaskRemoveFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("group_task_remove: %v", err)
+		return vfilter.Null{}
+	}
+
+	err = services.RequireFrontend()
+	if err != nil {
+		scope.Log("group_task_remove: %v", err)
+		return vfilter.Null{}
+	}
+
+	config_obj, ok := vql_subsystem.GetServerConfig(scope)
+	if !ok {
+		scope.Log("group_task_remove: Command can only run on the server")
+		return vfilter.Null{}
+	}
+
+	client_info_manager, err := services.GetClientInfoManager(config_obj)
+	if err != nil {
+		scope.Log("group_task_remove: %v", err)
+		return vfilter.Null{}
+	}
+
+	err = client_info_manager.DeleteGroupTask(ctx, arg.Id)
+	if err != nil {
+		scope.Log("group_task_remove: %v", err)
+		return vfilter.Null{}
+	}
+
+	principal := vql_subsystem.GetPrincipal(scope)
+	services.LogAudit(ctx,
+		config_obj, principal, "RemoveGroupTask",
+		ordereddict.NewDict().Set("id", arg.Id))
+
+	return arg.Id
+}
+
+func (self GroupTaskRemoveFunction) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "group_task_remove",
+		Doc:      "Stop scheduling a group collection on clients that check in.",
+		ArgType:  type_map.AddType(scope, &GroupTaskRemoveFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.COLLECT_CLIENT).Build(),
+	}
+}
+
+// Compile a collection request which will be scheduled on clients
+// later as they check in.
+func compileDeferredCollection(
+	ctx context.Context, scope vfilter.Scope,
+	config_obj *config_proto.Config,
+	request *flows_proto.ArtifactCollectorArgs,
+	spec, env *ordereddict.Dict) error {
+
+	repository, err := vql_utils.GetRepository(scope)
+	if err != nil {
+		return err
+	}
+
+	if spec == nil {
+		spec = ordereddict.NewDict()
+		if env != nil {
+			for _, name := range request.Artifacts {
+				spec.Set(name, env)
+			}
+		}
+	}
+
+	err = collector.AddSpecProtobuf(ctx, config_obj, repository, scope,
+		spec, request)
+	if err != nil {
+		return err
+	}
+
+	err = launcher.RejectDualAuthorization(ctx, config_obj, repository, request)
+	if err != nil {
+		return err
+	}
+
+	err = launcher.RejectUnreviewedArtifacts(ctx, config_obj, repository, request)
+	if err != nil {
+		return err
+	}
+
+	acl_manager, ok := artifacts.GetACLManager(scope)
+	if !ok {
+		acl_manager = acl_managers.NullACLManager{}
+	}
+
+	launcher, err := services.GetLauncher(config_obj)
+	if err != nil {
+		return err
+	}
+
+	request.CompiledCollectorArgs, err = launcher.CompileCollectorArgs(
+		ctx, config_obj, acl_manager, repository,
+		services.CompilerOptions{
+			ObfuscateNames: true,
+		}, request)
+	return err
+}
+
+func groupTaskRow(task *services.GroupTask) *ordereddict.Dict {
+	return ordereddict.NewDict().
+		Set("Id", task.Id).
+		Set("Label", task.Label).
+		Set("Artifacts", task.Request.Artifacts).
+		Set("Creator", task.Creator).
+		Set("Created", time.Unix(task.Created, 0).UTC()).
+		Set("Expires", time.Unix(task.Expires, 0).UTC())
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&CollectGroupFunction{})
+	vql_subsystem.RegisterPlugin(&GroupTasksPlugin{})
+	vql_subsystem.RegisterFunction(&GroupTaskRemoveFunction{})
+}
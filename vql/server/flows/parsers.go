@@ -0,0 +1,450 @@
+package flows
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/accessors"
+	"www.velocidex.com/golang/velociraptor/acls"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/file_store"
+	"www.velocidex.com/golang/velociraptor/file_store/api"
+	"www.velocidex.com/golang/velociraptor/file_store/path_specs"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/paths"
+	artifact_paths "www.velocidex.com/golang/velociraptor/paths/artifacts"
+	"www.velocidex.com/golang/velociraptor/result_sets"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+const (
+	// Parsed rows are stored in the flow as sources of this
+	// artifact so they show up with the flow's other results.
+	PARSED_UPLOADS_ARTIFACT = "Generic.Uploads.Parsed"
+)
+
+// The parsers known to the server. Parsers in the config with the
+// same name replace these.
+var builtinUploadParsers = []*config_proto.UploadParser{
+	{
+		Name:      "evtx",
+		Magic:     hex.EncodeToString([]byte("ElfFile\x00")),
+		Extension: `(?i)\.evtx$`,
+		Query:     "SELECT * FROM parse_evtx(filename=FileName, accessor=Accessor)",
+	},
+	{
+		// Windows 10 prefetch files are compressed. Older files are
+		// found by their extension.
+		Name:      "prefetch",
+		Magic:     hex.EncodeToString([]byte("MAM\x04")),
+		Extension: `(?i)\.pf$`,
+		Query:     "SELECT * FROM prefetch(filename=FileName, accessor=Accessor)",
+	},
+	{
+		Name:      "sqlite",
+		Magic:     hex.EncodeToString([]byte("SQLite format 3\x00")),
+		Extension: `(?i)\.(sqlite|db)$`,
+		Query: `SELECT * FROM sqlite(file=FileName, accessor=Accessor,
+    query="SELECT type, name, tbl_name, sql FROM sqlite_master")`,
+	},
+	{
+		Name:  "registry",
+		Magic: hex.EncodeToString([]byte("regf")),
+		Query: `SELECT OSPath.Path AS Key, Name, Mtime, Data
+FROM glob(globs="**", accessor="raw_reg",
+     root=pathspec(DelegateAccessor=Accessor, DelegatePath=FileName, Path="/"))`,
+	},
+}
+
+type uploadParser struct {
+	name      string
+	magic     []byte
+	offset    int64
+	extension *regexp.Regexp
+	query     string
+}
+
+type parserRegistry struct {
+	parsers []*uploadParser
+}
+
+func newParserRegistry(config_obj *config_proto.Config) (*parserRegistry, error) {
+	self := &parserRegistry{}
+
+	var definitions []*config_proto.UploadParser
+	definitions = append(definitions, config_obj.Defaults.GetUploadParsers()...)
+	definitions = append(definitions, builtinUploadParsers...)
+
+	for _, definition := range definitions {
+		if definition.Name == "" || definition.Query == "" {
+			return nil, fmt.Errorf(
+				"Upload parser %q: a name and query are required", definition.Name)
+		}
+
+		// Configured parsers replace the built in ones.
+		if self.Get(definition.Name) != nil {
+			continue
+		}
+
+		parser := &uploadParser{
+			name:   definition.Name,
+			offset: definition.Offset,
+			query:  definition.Query,
+		}
+
+		var err error
+		parser.magic, err = hex.DecodeString(definition.Magic)
+		if err != nil {
+			return nil, fmt.Errorf("Upload parser %v: magic: %w",
+				definition.Name, err)
+		}
+
+		if definition.Extension != "" {
+			parser.extension, err = regexp.Compile(definition.Extension)
+			if err != nil {
+				return nil, fmt.Errorf("Upload parser %v: extension: %w",
+					definition.Name, err)
+			}
+		}
+
+		self.parsers = append(self.parsers, parser)
+	}
+
+	return self, nil
+}
+
+func (self *parserRegistry) Get(name string) *uploadParser {
+	for _, parser := range self.parsers {
+		if parser.name == name {
+			return parser
+		}
+	}
+	return nil
+}
+
+// How much of the file we need to read to detect all formats.
+func (self *parserRegistry) headerSize() int64 {
+	var result int64
+	for _, parser := range self.parsers {
+		size := parser.offset + int64(len(parser.magic))
+		if size > result {
+			result = size
+		}
+	}
+	return result
+}
+
+// Find the parser for the file. The magic bytes are more reliable so
+// we only fall back to the file name if no magic matched.
+func (self *parserRegistry) Detect(header []byte, name string) *uploadParser {
+	for _, parser := range self.parsers {
+		if len(parser.magic) == 0 {
+			continue
+		}
+
+		end := parser.offset + int64(len(parser.magic))
+		if end <= int64(len(header)) &&
+			bytes.Equal(header[parser.offset:end], parser.magic) {
+			return parser
+		}
+	}
+
+	for _, parser := range self.parsers {
+		if parser.extension != nil && parser.extension.MatchString(name) {
+			return parser
+		}
+	}
+
+	return nil
+}
+
+type ParseUploadPluginArgs struct {
+	ClientId string `vfilter:"required,field=client_id,doc=The client id of the flow."`
+	FlowId   string `vfilter:"required,field=flow_id,doc=The flow which uploaded the file."`
+	VFSPath  string `vfilter:"required,field=vfs_path,doc=The file store path of the upload (as in System.Upload.Completion)."`
+	Parser   string `vfilter:"optional,field=parser,doc=The parser to use. Detected from the file by default."`
+	MaxRows  int64  `vfilter:"optional,field=max_rows,doc=Maximum number of rows to store for the file (default 100000)."`
+}
+
+type ParseUploadPlugin struct{}
+
+func (self ParseUploadPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+		defer vql_subsystem.RegisterMonitor("parse_upload", args)()
+
+		err := vql_subsystem.CheckAccess(scope,
+			acls.READ_RESULTS, acls.PREPARE_RESULTS)
+		if err != nil {
+			scope.Log("parse_upload: %s", err)
+			return
+		}
+
+		err = services.RequireFrontend()
+		if err != nil {
+			scope.Log("parse_upload: %v", err)
+			return
+		}
+
+		arg := &ParseUploadPluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("parse_upload: %v", err)
+			return
+		}
+
+		config_obj, ok := vql_subsystem.GetServerConfig(scope)
+		if !ok {
+			scope.Log("parse_upload: Command can only run on the server")
+			return
+		}
+
+		if arg.MaxRows == 0 {
+			arg.MaxRows = 100000
+		}
+
+		result, err := parseUpload(ctx, config_obj, scope, arg)
+		if err != nil {
+			scope.Log("parse_upload: %v: %v", arg.VFSPath, err)
+			return
+		}
+
+		if result != nil {
+			select {
+			case <-ctx.Done():
+			case output_chan <- result:
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self ParseUploadPlugin) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name: "parse_upload",
+		Doc: "Parse an uploaded file with the matching upload parser and " +
+			"store the rows in the flow next to the file.",
+		ArgType: type_map.AddType(scope, &ParseUploadPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(
+			acls.READ_RESULTS, acls.PREPARE_RESULTS).Build(),
+	}
+}
+
+// Returns a summary row or nil if no parser handles the file.
+func parseUpload(
+	ctx context.Context,
+	config_obj *config_proto.Config,
+	scope vfilter.Scope,
+	arg *ParseUploadPluginArgs) (*ordereddict.Dict, error) {
+
+	flow_path_manager := paths.NewFlowPathManager(arg.ClientId, arg.FlowId)
+	upload_path := path_specs.NewUnsafeFilestorePath(
+		paths.ExtractClientPathComponents(arg.VFSPath)...).
+		SetType(api.PATH_TYPE_FILESTORE_ANY)
+
+	// Only allow parsing the flow's own uploads.
+	if !path_specs.IsSubPath(flow_path_manager.UploadContainer(), upload_path) {
+		return nil, fmt.Errorf("%v is not an upload of flow %v",
+			arg.VFSPath, arg.FlowId)
+	}
+
+	registry, err := newParserRegistry(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var parser *uploadParser
+	if arg.Parser != "" {
+		parser = registry.Get(arg.Parser)
+		if parser == nil {
+			return nil, fmt.Errorf("Unknown parser %v", arg.Parser)
+		}
+
+	} else {
+		header, err := readUploadHeader(config_obj, upload_path,
+			registry.headerSize())
+		if err != nil {
+			return nil, err
+		}
+
+		parser = registry.Detect(header, upload_path.Base())
+		if parser == nil {
+			return nil, nil
+		}
+	}
+
+	statements, err := vfilter.MultiParse(parser.query)
+	if err != nil {
+		return nil, fmt.Errorf("Parser %v: %w", parser.name, err)
+	}
+
+	path_manager := artifact_paths.NewArtifactPathManagerWithMode(
+		config_obj, arg.ClientId, arg.FlowId,
+		PARSED_UPLOADS_ARTIFACT+"/"+parser.name, paths.MODE_CLIENT)
+
+	rs_writer, err := result_sets.NewResultSetWriter(
+		file_store.GetFileStore(config_obj), path_manager.Path(),
+		json.DefaultEncOpts(), utils.SyncCompleter, result_sets.AppendMode)
+	if err != nil {
+		return nil, err
+	}
+	defer rs_writer.Close()
+
+	subscope := scope.Copy().AppendVars(ordereddict.NewDict().
+		Set("FileName", accessors.MustNewFileStorePath("fs:").
+			Append(upload_path.Components()...)).
+		Set("Accessor", "fs"))
+	defer subscope.Close()
+
+	sub_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var count int64
+	for _, statement := range statements {
+		for row := range statement.Eval(sub_ctx, subscope) {
+			if count >= arg.MaxRows {
+				cancel()
+				break
+			}
+			count++
+
+			// Keep track of which file each row came from.
+			rs_writer.Write(vfilter.RowToDict(sub_ctx, subscope, row).
+				Set("_Upload", arg.VFSPath))
+		}
+	}
+
+	if count > 0 {
+		err = addArtifactWithResults(ctx, config_obj,
+			arg.ClientId, arg.FlowId, path_manager.FullArtifactName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ordereddict.NewDict().
+		Set("ClientId", arg.ClientId).
+		Set("FlowId", arg.FlowId).
+		Set("VFSPath", arg.VFSPath).
+		Set("Parser", parser.name).
+		Set("Artifact", path_manager.FullArtifactName).
+		Set("Rows", count), nil
+}
+
+func readUploadHeader(config_obj *config_proto.Config,
+	upload_path api.FSPathSpec, size int64) ([]byte, error) {
+	fd, err := file_store.GetFileStore(config_obj).ReadFile(upload_path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	header := make([]byte, size)
+	n, err := io.ReadFull(fd, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return header[:n], nil
+}
+
+// Make the parsed table visible with the flow's results.
+func addArtifactWithResults(
+	ctx context.Context, config_obj *config_proto.Config,
+	client_id, flow_id, name string) error {
+	launcher, err := services.GetLauncher(config_obj)
+	if err != nil {
+		return err
+	}
+
+	collection_context, err := launcher.Storage().LoadCollectionContext(
+		ctx, config_obj, client_id, flow_id)
+	if err != nil {
+		return err
+	}
+
+	if utils.InString(collection_context.ArtifactsWithResults, name) {
+		return nil
+	}
+
+	collection_context.ArtifactsWithResults = append(
+		collection_context.ArtifactsWithResults, name)
+
+	return launcher.Storage().WriteFlow(
+		ctx, config_obj, collection_context, utils.BackgroundWriter)
+}
+
+type UploadParsersPlugin struct{}
+
+func (self UploadParsersPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		config_obj, ok := vql_subsystem.GetServerConfig(scope)
+		if !ok {
+			scope.Log("upload_parsers: Command can only run on the server")
+			return
+		}
+
+		registry, err := newParserRegistry(config_obj)
+		if err != nil {
+			scope.Log("upload_parsers: %v", err)
+			return
+		}
+
+		for _, parser := range registry.parsers {
+			extension := ""
+			if parser.extension != nil {
+				extension = parser.extension.String()
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- ordereddict.NewDict().
+				Set("Name", parser.name).
+				Set("Magic", fmt.Sprintf("%q", parser.magic)).
+				Set("Offset", parser.offset).
+				Set("Extension", extension).
+				Set("Query", parser.query):
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self UploadParsersPlugin) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "upload_parsers",
+		Doc:      "List the parsers the server runs over uploaded files.",
+		Metadata: vql.VQLMetadata().Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&ParseUploadPlugin{})
+	vql_subsystem.RegisterPlugin(&UploadParsersPlugin{})
+}
@@ -0,0 +1,81 @@
+package flows
+
+import (
+	"github.com/alecthomas/assert"
+	"google.golang.org/protobuf/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/file_store"
+	"www.velocidex.com/golang/velociraptor/file_store/path_specs"
+	"www.velocidex.com/golang/velociraptor/paths"
+)
+
+func (self *TestSuite) TestUploadParserDetection() {
+	registry, err := newParserRegistry(self.ConfigObj)
+	assert.NoError(self.T(), err)
+
+	flow_path_manager := paths.NewFlowPathManager(self.client_id, self.flow_id)
+	upload_path := flow_path_manager.GetUploadsFile(
+		"auto", "C:/Users/test/History", []string{"C:", "Users", "test", "History"}).Path()
+
+	fd, err := file_store.GetFileStore(self.ConfigObj).WriteFile(upload_path)
+	assert.NoError(self.T(), err)
+	_, err = fd.Write([]byte("SQLite format 3\x00 rest of the file"))
+	assert.NoError(self.T(), err)
+	fd.Close()
+
+	// Detected by magic even without an extension.
+	header, err := readUploadHeader(self.ConfigObj, upload_path,
+		registry.headerSize())
+	assert.NoError(self.T(), err)
+	assert.Equal(self.T(), "sqlite", registry.Detect(header, upload_path.Base()).name)
+
+	// Magic takes precedence over the file name.
+	assert.Equal(self.T(), "evtx",
+		registry.Detect([]byte("ElfFile\x00"), "Security.db").name)
+
+	// Compressed prefetch files are matched by name.
+	assert.Equal(self.T(), "prefetch",
+		registry.Detect([]byte("SCCA"), "CMD.EXE-1234.pf").name)
+
+	assert.Nil(self.T(), registry.Detect([]byte("hello"), "hello.txt"))
+
+	// The upload must belong to the flow.
+	other_path := path_specs.NewUnsafeFilestorePath(
+		"clients", self.client_id, "collections", "F.Other", "uploads", "x")
+	_, err = parseUpload(self.Ctx, self.ConfigObj, nil, &ParseUploadPluginArgs{
+		ClientId: self.client_id,
+		FlowId:   self.flow_id,
+		VFSPath:  other_path.AsClientPath(),
+	})
+	assert.Error(self.T(), err)
+}
+
+func (self *TestSuite) TestUploadParserConfig() {
+	config_obj := proto.Clone(self.ConfigObj).(*config_proto.Config)
+	config_obj.Defaults.UploadParsers = []*config_proto.UploadParser{{
+		Name:      "evtx",
+		Extension: `\.evt$`,
+		Query:     "SELECT * FROM info()",
+	}, {
+		Name:   "lnk",
+		Magic:  "4c000000",
+		Query:  "SELECT * FROM parse_lnk(filename=FileName, accessor=Accessor)",
+		Offset: 2,
+	}}
+
+	registry, err := newParserRegistry(config_obj)
+	assert.NoError(self.T(), err)
+
+	// The configured parser replaces the built in one.
+	assert.Equal(self.T(), "SELECT * FROM info()", registry.Get("evtx").query)
+	assert.Nil(self.T(), registry.Detect([]byte("ElfFile\x00"), "foo"))
+	assert.Equal(self.T(), "evtx", registry.Detect(nil, "old.evt").name)
+
+	assert.Equal(self.T(), "lnk",
+		registry.Detect([]byte("xxL\x00\x00\x00"), "foo").name)
+
+	// Bad definitions are rejected.
+	config_obj.Defaults.UploadParsers[0].Magic = "not hex"
+	_, err = newParserRegistry(config_obj)
+	assert.Error(self.T(), err)
+}
@@ -0,0 +1,267 @@
+package flows
+
+import (
+	"context"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type ClientWatchFunctionArgs struct {
+	ClientId  string            `vfilter:"required,field=client_id,doc=The client to watch"`
+	Comment   string            `vfilter:"optional,field=comment,doc=A comment to include in the alert"`
+	Artifacts []string          `vfilter:"optional,field=artifacts,doc=A list of artifacts to collect when the client checks in"`
+	Env       *ordereddict.Dict `vfilter:"optional,field=env,doc=Parameters to apply to the artifact (an alternative to a full spec)"`
+	Spec      *ordereddict.Dict `vfilter:"optional,field=spec,doc=Parameters to apply to the artifacts"`
+	Timeout   uint64            `vfilter:"optional,field=timeout,doc=Set query timeout (default 10 min)"`
+	MaxRows   uint64            `vfilter:"optional,field=max_rows,doc=Max number of rows to fetch"`
+	MaxBytes  uint64            `vfilter:"optional,field=max_bytes,doc=Max number of bytes to upload"`
+	Urgent    bool              `vfilter:"optional,field=urgent,doc=Set the collection as urgent - skips other queues collections on the client."`
+}
+
+type ClientWatchFunction struct{}
+
+func (self ClientWatchFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.COLLECT_CLIENT)
+	if err != nil {
+		scope.Log("client_watch: %s", err)
+		return vfilter.Null{}
+	}
+
+	arg := &ClientWatchFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("client_watch: %v", err)
+		return vfilter.Null{}
+	}
+
+	// If a full spec is provided we dont need to provide the
+	// artifacts again.
+	if arg.Spec != nil && len(arg.Artifacts) == 0 {
+		arg.Artifacts = arg.Spec.Keys()
+	}
+
+	err = services.RequireFrontend()
+	if err != nil {
+		scope.Log("client_watch: %v", err)
+		return vfilter.Null{}
+	}
+
+	config_obj, ok := vql_subsystem.GetServerConfig(scope)
+	if !ok {
+		scope.Log("client_watch: Command can only run on the server")
+		return vfilter.Null{}
+	}
+
+	watch := &services.WatchedClient{
+		ClientId: arg.ClientId,
+		Comment:  arg.Comment,
+		Creator:  vql_subsystem.GetPrincipal(scope),
+	}
+
+	// The collection is optional.
+	if len(arg.Artifacts) > 0 {
+		watch.Request = &flows_proto.ArtifactCollectorArgs{
+			Artifacts:      arg.Artifacts,
+			Creator:        watch.Creator,
+			Timeout:        arg.Timeout,
+			MaxRows:        arg.MaxRows,
+			MaxUploadBytes: arg.MaxBytes,
+			Urgent:         arg.Urgent,
+		}
+
+		err = compileDeferredCollection(ctx, scope, config_obj,
+			watch.Request, arg.Spec, arg.Env)
+		if err != nil {
+			scope.Log("client_watch: %v", err)
+			return vfilter.Null{}
+		}
+	}
+
+	client_info_manager, err := services.GetClientInfoManager(config_obj)
+	if err != nil {
+		scope.Log("client_watch: %v", err)
+		return vfilter.Null{}
+	}
+
+	watch, err = client_info_manager.WatchClient(ctx, watch)
+	if err != nil {
+		scope.Log("client_watch: %v", err)
+		return vfilter.Null{}
+	}
+
+	services.LogAudit(ctx,
+		config_obj, watch.Creator, "WatchClient",
+		ordereddict.NewDict().
+			Set("client_id", watch.ClientId).
+			Set("comment", watch.Comment).
+			Set("artifacts", arg.Artifacts))
+
+	return watchedClientRow(watch)
+}
+
+func (self ClientWatchFunction) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "client_watch",
+		Doc:      "Raise an alert and optionally launch a collection when a client next checks in.",
+		ArgType:  type_map.AddType(scope, &ClientWatchFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.COLLECT_CLIENT).Build(),
+	}
+}
+
+type ClientWatchListPlugin struct{}
+
+func (self ClientWatchListPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		err := vql_subsystem.CheckAccess(scope, acls.READ_RESULTS)
+		if err != nil {
+			scope.Log("client_watch_list: %s", err)
+			return
+		}
+
+		err = services.RequireFrontend()
+		if err != nil {
+			scope.Log("client_watch_list: %v", err)
+			return
+		}
+
+		config_obj, ok := vql_subsystem.GetServerConfig(scope)
+		if !ok {
+			scope.Log("client_watch_list: Command can only run on the server")
+			return
+		}
+
+		client_info_manager, err := services.GetClientInfoManager(config_obj)
+		if err != nil {
+			scope.Log("client_watch_list: %v", err)
+			return
+		}
+
+		watched, err := client_info_manager.ListWatchedClients(ctx)
+		if err != nil {
+			scope.Log("client_watch_list: %v", err)
+			return
+		}
+
+		for _, watch := range watched {
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- watchedClientRow(watch):
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self ClientWatchListPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "client_watch_list",
+		Doc:      "List the watched clients which did not check in yet.",
+		Metadata: vql.VQLMetadata().Permissions(acls.READ_RESULTS).Build(),
+	}
+}
+
+type ClientWatchRemoveFunctionArgs struct {
+	ClientId string `vfilter:"required,field=client_id,doc=The client to stop watching."`
+}
+
+type ClientWatchRemoveFunction struct{}
+
+func (self ClientWatchRemoveFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.COLLECT_CLIENT)
+	if err != nil {
+		scope.Log("client_watch_remove: %s", err)
+		return vfilter.Null{}
+	}
+
+	arg := &ClientWatchRemoveFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("client_watch_remove: %v", err)
+		return vfilter.Null{}
+	}
+
+	err = services.RequireFrontend()
+	if err != nil {
+		scope.Log("client_watch_remove: %v", err)
+		return vfilter.Null{}
+	}
+
+	config_obj, ok := vql_subsystem.GetServerConfig(scope)
+	if !ok {
+		scope.Log("client_watch_remove: Command can only run on the server")
+		return vfilter.Null{}
+	}
+
+	client_info_manager, err := services.GetClientInfoManager(config_obj)
+	if err != nil {
+		scope.Log("client_watch_remove: %v", err)
+		return vfilter.Null{}
+	}
+
+	err = client_info_manager.UnwatchClient(ctx, arg.ClientId)
+	if err != nil {
+		scope.Log("client_watch_remove: %v", err)
+		return vfilter.Null{}
+	}
+
+	principal := vql_subsystem.GetPrincipal(scope)
+	services.LogAudit(ctx,
+		config_obj, principal, "UnwatchClient",
+		ordereddict.NewDict().Set("client_id", arg.ClientId))
+
+	return arg.ClientId
+}
+
+func (self ClientWatchRemoveFunction) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "client_watch_remove",
+		Doc:      "Stop watching a client.",
+		ArgType:  type_map.AddType(scope, &ClientWatchRemoveFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.COLLECT_CLIENT).Build(),
+	}
+}
+
+func watchedClientRow(watch *services.WatchedClient) *ordereddict.Dict {
+	var artifacts []string
+	if watch.Request != nil {
+		artifacts = watch.Request.Artifacts
+	}
+
+	return ordereddict.NewDict().
+		Set("ClientId", watch.ClientId).
+		Set("Comment", watch.Comment).
+		Set("Artifacts", artifacts).
+		Set("Creator", watch.Creator).
+		Set("Created", time.Unix(watch.Created, 0).UTC())
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&ClientWatchFunction{})
+	vql_subsystem.RegisterPlugin(&ClientWatchListPlugin{})
+	vql_subsystem.RegisterFunction(&ClientWatchRemoveFunction{})
+}
@@ -56,6 +56,14 @@ type ScheduleHuntFunctionArg struct {
 	ExcludeLabels []string         `vfilter:"optional,field=exclude_labels,doc=If specified exclude these labels"`
 	OS            string           `vfilter:"optional,field=os,doc=If specified target this OS"`
 	OrgIds        []string         `vfilter:"optional,field=org_id,doc=If set the collection will be started in the specified orgs."`
+
+	MaxTotalBytes   uint64  `vfilter:"optional,field=max_total_bytes,doc=Pause the hunt when all clients uploaded this many bytes"`
+	MaxTotalSeconds float64 `vfilter:"optional,field=max_total_seconds,doc=Pause the hunt when collections ran for this many seconds in total"`
+	MaxErrorRate    float64 `vfilter:"optional,field=max_error_rate,doc=Pause the hunt when this fraction (0-1) of collections fail"`
+
+	CanaryClients      uint64  `vfilter:"optional,field=canary_clients,doc=First schedule the hunt on this many clients only"`
+	CanaryLabel        string  `vfilter:"optional,field=canary_label,doc=If set, only clients with this label are canary clients"`
+	CanaryMaxErrorRate float64 `vfilter:"optional,field=canary_max_error_rate,doc=Expand the hunt if fewer than this fraction (0-1) of canary collections failed, otherwise pause it"`
 }
 
 type ScheduleHuntFunction struct{}
@@ -155,6 +163,14 @@ func (self *ScheduleHuntFunction) Call(ctx context.Context,
 		StartRequest:    request,
 		Expires:         expires,
 		State:           state,
+
+		MaxTotalUploadBytes:      arg.MaxTotalBytes,
+		MaxTotalExecutionSeconds: arg.MaxTotalSeconds,
+		MaxErrorRate:             arg.MaxErrorRate,
+
+		CanaryClients:      arg.CanaryClients,
+		CanaryLabel:        arg.CanaryLabel,
+		CanaryMaxErrorRate: arg.CanaryMaxErrorRate,
 	}
 
 	if len(arg.IncludeLabels) > 0 {
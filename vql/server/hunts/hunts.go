@@ -138,6 +138,7 @@ type HuntResultsPluginArgs struct {
 	HuntId   string   `vfilter:"required,field=hunt_id,doc=The hunt id to read."`
 	Brief    bool     `vfilter:"optional,field=brief,doc=If set we return less columns (deprecated)."`
 	Orgs     []string `vfilter:"optional,field=orgs,doc=If set we combine results from all orgs."`
+	Sample   int64    `vfilter:"optional,field=sample,doc=If set only return up to this many rows from each client (useful to preview a running hunt)."`
 }
 
 type HuntResultsPlugin struct{}
@@ -305,17 +306,14 @@ func (self HuntResultsPlugin) Call(
 				// Read each result set and emit it
 				// with some extra columns for
 				// context.
-				for row := range reader.Rows(ctx) {
-					row.Set("FlowId", flow_details.Context.SessionId).
-						Set("ClientId", flow_details.Context.ClientId).
-						Set("_OrgId", org_id).
-						Set("Fqdn", fqdn)
-
-					select {
-					case <-ctx.Done():
-						return
-					case output_chan <- row:
-					}
+				if !emitFlowRows(ctx, reader, arg.Sample, output_chan,
+					func(row *ordereddict.Dict) {
+						row.Set("FlowId", flow_details.Context.SessionId).
+							Set("ClientId", flow_details.Context.ClientId).
+							Set("_OrgId", org_id).
+							Set("Fqdn", fqdn)
+					}) {
+					return
 				}
 			}
 		}
@@ -324,6 +322,37 @@ func (self HuntResultsPlugin) Call(
 	return output_chan
 }
 
+// Emit the rows of a single flow's result set, stopping after sample
+// rows if it is set. Flows of a running hunt may still be adding
+// rows, so sampling reads only the start of each result set. Returns
+// false if the query is cancelled.
+func emitFlowRows(
+	ctx context.Context, reader result_sets.ResultSetReader, sample int64,
+	output_chan chan vfilter.Row, decorate func(row *ordereddict.Dict)) bool {
+	defer reader.Close()
+
+	sub_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var count int64
+	for row := range reader.Rows(sub_ctx) {
+		if sample > 0 && count >= sample {
+			break
+		}
+		count++
+
+		decorate(row)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case output_chan <- row:
+		}
+	}
+
+	return true
+}
+
 func (self HuntResultsPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
 	return &vfilter.PluginInfo{
 		Name:     "hunt_results",
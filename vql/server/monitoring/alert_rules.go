@@ -0,0 +1,194 @@
+package monitoring
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/paths"
+	artifact_paths "www.velocidex.com/golang/velociraptor/paths/artifacts"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type AlertRulesPluginArgs struct {
+	Rules      vfilter.StoredQuery `vfilter:"required,field=rules,doc=A query returning rules with columns Name, Artifact, Condition and optionally Severity, Threshold and Window."`
+	Indicators []string            `vfilter:"optional,field=indicators,doc=A list of indicators made available to conditions as the Indicators variable."`
+}
+
+type AlertRulesPlugin struct{}
+
+func (self AlertRulesPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+		defer vql_subsystem.RegisterMonitor("alert_rules", args)()
+
+		err := vql_subsystem.CheckAccess(scope, acls.SERVER_ADMIN)
+		if err != nil {
+			scope.Log("alert_rules: %s", err)
+			return
+		}
+
+		err = services.RequireFrontend()
+		if err != nil {
+			scope.Log("alert_rules: %v", err)
+			return
+		}
+
+		config_obj, ok := vql_subsystem.GetServerConfig(scope)
+		if !ok {
+			scope.Log("alert_rules: Command can only run on the server")
+			return
+		}
+
+		journal, err := services.GetJournal(config_obj)
+		if err != nil {
+			scope.Log("alert_rules: %v", err)
+			return
+		}
+
+		arg := &AlertRulesPluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("alert_rules: %v", err)
+			return
+		}
+
+		// Group the rules by the event queue they watch.
+		rules := make(map[string][]*alertRule)
+		for row := range arg.Rules.Eval(ctx, scope) {
+			rule, err := newAlertRule(vfilter.RowToDict(ctx, scope, row))
+			if err != nil {
+				scope.Log("alert_rules: %v", err)
+				continue
+			}
+			rules[rule.Artifact] = append(rules[rule.Artifact], rule)
+		}
+
+		// Conditions may refer to the indicator list.
+		subscope := scope.Copy().AppendVars(ordereddict.NewDict().
+			Set("Indicators", arg.Indicators))
+		defer subscope.Close()
+
+		wg := &sync.WaitGroup{}
+		defer wg.Wait()
+
+		for artifact, artifact_rules := range rules {
+			mode, err := artifact_paths.GetArtifactMode(ctx, config_obj, artifact)
+			if err != nil {
+				scope.Log("alert_rules: Artifact %s not known", artifact)
+				continue
+			}
+
+			artifact_type := "SERVER_EVENT"
+			switch mode {
+			case paths.MODE_CLIENT_EVENT:
+				artifact_type = "CLIENT_EVENT"
+			case paths.MODE_SERVER_EVENT, paths.INTERNAL:
+			default:
+				scope.Log("alert_rules: %v is not an event artifact", artifact)
+				continue
+			}
+
+			qm_chan, cancel := journal.Watch(ctx, artifact, "alert_rules plugin")
+			scope.AddDestructor(cancel)
+
+			wg.Add(1)
+			go func(artifact_type string, artifact_rules []*alertRule) {
+				defer wg.Done()
+
+				for row := range qm_chan {
+					for _, rule := range artifact_rules {
+						count := rule.Match(ctx, subscope, row, utils.GetTime().Now())
+						if count == 0 {
+							continue
+						}
+
+						alert := newAlertMessage(rule, row, count, artifact_type)
+						err := pushAlert(ctx, journal, config_obj, alert)
+						if err != nil {
+							scope.Log("alert_rules: %v", err)
+						}
+
+						select {
+						case <-ctx.Done():
+							return
+						case output_chan <- ordereddict.NewDict().
+							Set("Timestamp", alert.Timestamp).
+							Set("Name", alert.AlertName).
+							Set("Severity", rule.Severity).
+							Set("ClientId", alert.ClientId).
+							Set("Artifact", alert.Artifact).
+							Set("Count", count).
+							Set("Event", row):
+						}
+					}
+				}
+			}(artifact_type, artifact_rules)
+		}
+	}()
+
+	return output_chan
+}
+
+func newAlertMessage(rule *alertRule, row *ordereddict.Dict,
+	count int64, artifact_type string) *services.AlertMessage {
+	client_id, _ := row.GetString("ClientId")
+	flow_id, _ := row.GetString("FlowId")
+	if client_id == "" {
+		client_id = "server"
+	}
+
+	return &services.AlertMessage{
+		ClientId:  client_id,
+		AlertName: rule.Name,
+		Timestamp: utils.GetTime().Now(),
+		EventData: ordereddict.NewDict().
+			Set("Severity", rule.Severity).
+			Set("Condition", rule.Condition).
+			Set("Count", count).
+			Set("Event", row),
+		Artifact:     rule.Artifact,
+		ArtifactType: artifact_type,
+		FlowId:       flow_id,
+	}
+}
+
+func pushAlert(ctx context.Context, journal services.JournalService,
+	config_obj *config_proto.Config, alert *services.AlertMessage) error {
+	serialized, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	serialized = append(serialized, '\n')
+
+	return journal.PushJsonlToArtifact(ctx, config_obj,
+		serialized, 1, "Server.Internal.Alerts", "server", "")
+}
+
+func (self AlertRulesPlugin) Info(scope vfilter.Scope,
+	type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name: "alert_rules",
+		Doc: "Evaluate alerting rules over server event queues and " +
+			"raise alerts when they match.",
+		ArgType:  type_map.AddType(scope, &AlertRulesPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.SERVER_ADMIN).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&AlertRulesPlugin{})
+}
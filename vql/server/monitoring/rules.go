@@ -0,0 +1,132 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/vfilter"
+)
+
+// An alert rule evaluates a VQL condition over each event arriving
+// on an event queue. A rule fires when the condition matched
+// Threshold times for the same client within Window.
+type alertRule struct {
+	Name      string
+	Artifact  string
+	Condition string
+	Severity  string
+	Threshold int64
+	Window    time.Duration
+
+	lambda *vfilter.Lambda
+
+	mu sync.Mutex
+
+	// Times of recent matches by client id. Only used when the
+	// threshold is larger than 1.
+	hits map[string][]time.Time
+}
+
+func newAlertRule(rule *ordereddict.Dict) (*alertRule, error) {
+	result := &alertRule{
+		Severity:  "MEDIUM",
+		Threshold: 1,
+		hits:      make(map[string][]time.Time),
+	}
+
+	result.Name, _ = rule.GetString("Name")
+	if result.Name == "" {
+		return nil, errors.New("Rule must have a Name")
+	}
+
+	result.Artifact, _ = rule.GetString("Artifact")
+	if result.Artifact == "" {
+		return nil, fmt.Errorf("Rule %v: Artifact must be specified",
+			result.Name)
+	}
+
+	result.Condition, _ = rule.GetString("Condition")
+	if result.Condition == "" {
+		result.Condition = "TRUE"
+	}
+
+	// The row is available both as the Row parameter and as
+	// individual columns in the scope.
+	lambda, err := vfilter.ParseLambda("Row=>" + result.Condition)
+	if err != nil {
+		return nil, fmt.Errorf("Rule %v: Invalid condition %v: %w",
+			result.Name, result.Condition, err)
+	}
+	result.lambda = lambda
+
+	severity, _ := rule.GetString("Severity")
+	if severity != "" {
+		result.Severity = severity
+	}
+
+	// CSV parameters are passed as strings.
+	threshold_any, _ := rule.Get("Threshold")
+	threshold, pres := utils.ToInt64(threshold_any)
+	if pres && threshold > 1 {
+		result.Threshold = threshold
+	}
+
+	window_any, _ := rule.Get("Window")
+	window, pres := utils.ToInt64(window_any)
+	if pres && window > 0 {
+		result.Window = time.Duration(window) * time.Second
+	}
+
+	if result.Threshold > 1 && result.Window == 0 {
+		return nil, fmt.Errorf(
+			"Rule %v: A Window is required when Threshold is set",
+			result.Name)
+	}
+
+	return result, nil
+}
+
+// Evaluate the rule against the event. Returns the number of
+// matches in the window when the rule fires, or 0.
+func (self *alertRule) Match(ctx context.Context, scope vfilter.Scope,
+	row *ordereddict.Dict, now time.Time) int64 {
+	subscope := scope.Copy().AppendVars(row)
+	defer subscope.Close()
+
+	if !scope.Bool(self.lambda.Reduce(ctx, subscope, []vfilter.Any{row})) {
+		return 0
+	}
+
+	if self.Threshold <= 1 {
+		return 1
+	}
+
+	client_id, _ := row.GetString("ClientId")
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	// Expire matches which fell out of the window.
+	cutoff := now.Add(-self.Window)
+	hits := self.hits[client_id]
+	for len(hits) > 0 && !hits[0].After(cutoff) {
+		hits = hits[1:]
+	}
+	hits = append(hits, now)
+
+	count := int64(len(hits))
+	if count < self.Threshold {
+		self.hits[client_id] = hits
+		return 0
+	}
+
+	// Start counting again so we do not fire on every subsequent
+	// event.
+	delete(self.hits, client_id)
+	return count
+}
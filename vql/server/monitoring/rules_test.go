@@ -0,0 +1,78 @@
+package monitoring
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/alecthomas/assert"
+	"www.velocidex.com/golang/vfilter"
+)
+
+func TestAlertRuleCondition(t *testing.T) {
+	ctx := context.Background()
+	scope := vfilter.NewScope().AppendVars(ordereddict.NewDict().
+		Set("Indicators", []string{"bad.exe"}))
+	now := time.Unix(1000, 0)
+
+	rule, err := newAlertRule(ordereddict.NewDict().
+		Set("Name", "Bad Process").
+		Set("Artifact", "Windows.Events.ProcessCreation").
+		Set("Condition", `Name IN Indicators`))
+	assert.NoError(t, err)
+	assert.Equal(t, "MEDIUM", rule.Severity)
+
+	assert.Equal(t, int64(1), rule.Match(ctx, scope,
+		ordereddict.NewDict().Set("Name", "bad.exe"), now))
+	assert.Equal(t, int64(0), rule.Match(ctx, scope,
+		ordereddict.NewDict().Set("Name", "good.exe"), now))
+
+	// The row is also available as a parameter.
+	rule, err = newAlertRule(ordereddict.NewDict().
+		Set("Name", "Regex").
+		Set("Artifact", "Windows.Events.ProcessCreation").
+		Set("Condition", `Row.CommandLine =~ "-enc"`))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rule.Match(ctx, scope,
+		ordereddict.NewDict().Set("CommandLine", "powershell -enc AAA"), now))
+
+	// Invalid rules are rejected.
+	_, err = newAlertRule(ordereddict.NewDict().Set("Name", "No Artifact"))
+	assert.Error(t, err)
+
+	_, err = newAlertRule(ordereddict.NewDict().
+		Set("Name", "No Window").
+		Set("Artifact", "Windows.Events.ProcessCreation").
+		Set("Threshold", "5"))
+	assert.Error(t, err)
+}
+
+func TestAlertRuleThreshold(t *testing.T) {
+	ctx := context.Background()
+	scope := vfilter.NewScope()
+	now := time.Unix(1000, 0)
+
+	// CSV parameters are strings.
+	rule, err := newAlertRule(ordereddict.NewDict().
+		Set("Name", "Failed Logons").
+		Set("Artifact", "Windows.Events.FailedLogBeforeSuccess").
+		Set("Threshold", "3").
+		Set("Window", "60"))
+	assert.NoError(t, err)
+
+	row := ordereddict.NewDict().Set("ClientId", "C.1")
+	other := ordereddict.NewDict().Set("ClientId", "C.2")
+
+	assert.Equal(t, int64(0), rule.Match(ctx, scope, row, now))
+	assert.Equal(t, int64(0), rule.Match(ctx, scope, other, now))
+
+	// The first match falls out of the window.
+	now = now.Add(61 * time.Second)
+	assert.Equal(t, int64(0), rule.Match(ctx, scope, row, now))
+	assert.Equal(t, int64(0), rule.Match(ctx, scope, row, now))
+	assert.Equal(t, int64(3), rule.Match(ctx, scope, row, now))
+
+	// Counting starts again after the rule fires.
+	assert.Equal(t, int64(0), rule.Match(ctx, scope, row, now))
+}
@@ -0,0 +1,107 @@
+package monitoring
+
+import (
+	"regexp"
+	"sync"
+	"time"
+
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils"
+)
+
+const (
+	TRIAGE_SUPPRESS = "suppress"
+	TRIAGE_ASSIGN   = "assign"
+)
+
+// A triage rule matches new alerts by client id and alert name. It
+// either suppresses matching alerts or assigns them to a user. If a
+// Start or End time is given the rule only applies to alerts raised
+// within that time range.
+type triageRule struct {
+	ClientId *regexp.Regexp
+	Name     *regexp.Regexp
+	Action   string
+	User     string
+	Start    time.Time
+	End      time.Time
+}
+
+func (self *triageRule) Matches(alert *services.AlertMessage) bool {
+	if self.ClientId != nil && !self.ClientId.MatchString(alert.ClientId) {
+		return false
+	}
+
+	if self.Name != nil && !self.Name.MatchString(alert.AlertName) {
+		return false
+	}
+
+	if !self.Start.IsZero() && alert.Timestamp.Before(self.Start) {
+		return false
+	}
+
+	if !self.End.IsZero() && alert.Timestamp.After(self.End) {
+		return false
+	}
+
+	return true
+}
+
+// The alert triager brings new alerts into the triage workflow. Each
+// alert is given an id and the new state, and rules are applied in
+// order. Repeated alerts with the same name from the same client
+// within the dedup window are dropped.
+type alertTriager struct {
+	rules []*triageRule
+	dedup time.Duration
+
+	mu sync.Mutex
+
+	// The last time an alert was accepted by client id and name.
+	last map[string]time.Time
+}
+
+func newAlertTriager(rules []*triageRule, dedup time.Duration) *alertTriager {
+	return &alertTriager{
+		rules: rules,
+		dedup: dedup,
+		last:  make(map[string]time.Time),
+	}
+}
+
+// Triage the alert. Returns a description of why the alert was
+// dropped, or "" if the alert should be kept.
+func (self *alertTriager) Triage(alert *services.AlertMessage) string {
+	for _, rule := range self.rules {
+		if !rule.Matches(alert) {
+			continue
+		}
+
+		if rule.Action == TRIAGE_SUPPRESS {
+			return "Suppressed by rule"
+		}
+
+		// The first assignment rule wins.
+		if rule.Action == TRIAGE_ASSIGN && alert.AssignedToUser == "" {
+			alert.AssignedToUser = rule.User
+		}
+	}
+
+	if self.dedup > 0 {
+		key := alert.ClientId + "/" + alert.AlertName
+
+		self.mu.Lock()
+		last, pres := self.last[key]
+		if pres && alert.Timestamp.Sub(last) < self.dedup {
+			self.mu.Unlock()
+			return "Duplicate"
+		}
+		self.last[key] = alert.Timestamp
+		self.mu.Unlock()
+	}
+
+	alert.AlertId = "A." + utils.NextId()
+	alert.State = services.ALERT_STATE_NEW
+
+	return ""
+}
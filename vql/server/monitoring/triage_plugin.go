@@ -0,0 +1,187 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/velociraptor/vql/functions"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type TriageAlertsPluginArgs struct {
+	Rules vfilter.StoredQuery `vfilter:"optional,field=rules,doc=A query returning triage rules with columns ClientIdRegex, NameRegex, Action (suppress or assign), User, Start and End."`
+	Dedup int64               `vfilter:"optional,field=dedup,doc=Drop alerts with the same name from the same client within this many seconds."`
+}
+
+func newTriageRule(ctx context.Context, scope vfilter.Scope,
+	row *ordereddict.Dict) (*triageRule, error) {
+	result := &triageRule{}
+
+	for _, field := range []struct {
+		name   string
+		target **regexp.Regexp
+	}{{"ClientIdRegex", &result.ClientId}, {"NameRegex", &result.Name}} {
+		expr, _ := row.GetString(field.name)
+		if expr == "" {
+			continue
+		}
+
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", field.name, err)
+		}
+		*field.target = re
+	}
+
+	action, _ := row.GetString("Action")
+	result.Action = strings.ToLower(action)
+	result.User, _ = row.GetString("User")
+
+	switch result.Action {
+	case TRIAGE_SUPPRESS:
+	case TRIAGE_ASSIGN:
+		if result.User == "" {
+			return nil, fmt.Errorf("Assign rule requires a User")
+		}
+	default:
+		return nil, fmt.Errorf("Unknown triage action %v", action)
+	}
+
+	for _, field := range []struct {
+		name   string
+		target *time.Time
+	}{{"Start", &result.Start}, {"End", &result.End}} {
+		value, pres := row.Get(field.name)
+		if !pres {
+			continue
+		}
+
+		ts, err := functions.TimeFromAny(ctx, scope, value)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", field.name, err)
+		}
+		*field.target = ts
+	}
+
+	return result, nil
+}
+
+type TriageAlertsPlugin struct{}
+
+func (self TriageAlertsPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+		defer vql_subsystem.RegisterMonitor("triage_alerts", args)()
+
+		err := vql_subsystem.CheckAccess(scope, acls.READ_RESULTS)
+		if err != nil {
+			scope.Log("triage_alerts: %s", err)
+			return
+		}
+
+		err = services.RequireFrontend()
+		if err != nil {
+			scope.Log("triage_alerts: %v", err)
+			return
+		}
+
+		config_obj, ok := vql_subsystem.GetServerConfig(scope)
+		if !ok {
+			scope.Log("triage_alerts: Command can only run on the server")
+			return
+		}
+
+		journal, err := services.GetJournal(config_obj)
+		if err != nil {
+			scope.Log("triage_alerts: %v", err)
+			return
+		}
+
+		arg := &TriageAlertsPluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("triage_alerts: %v", err)
+			return
+		}
+
+		var rules []*triageRule
+		if arg.Rules != nil {
+			for row := range arg.Rules.Eval(ctx, scope) {
+				rule, err := newTriageRule(ctx, scope,
+					vfilter.RowToDict(ctx, scope, row))
+				if err != nil {
+					scope.Log("triage_alerts: %v", err)
+					return
+				}
+				rules = append(rules, rule)
+			}
+		}
+
+		triager := newAlertTriager(rules,
+			time.Duration(arg.Dedup)*time.Second)
+
+		qm_chan, cancel := journal.Watch(
+			ctx, "Server.Internal.Alerts", "triage_alerts plugin")
+		defer cancel()
+
+		for row := range qm_chan {
+			alert := &services.AlertMessage{}
+			err := json.Unmarshal([]byte(json.MustMarshalString(row)), alert)
+			if err != nil {
+				continue
+			}
+
+			if triager.Triage(alert) != "" {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- ordereddict.NewDict().
+				Set("AlertId", alert.AlertId).
+				Set("State", alert.State).
+				Set("Timestamp", alert.Timestamp).
+				Set("Name", alert.AlertName).
+				Set("ClientId", alert.ClientId).
+				Set("AssignedUser", alert.AssignedToUser).
+				Set("Artifact", alert.Artifact).
+				Set("ArtifactType", alert.ArtifactType).
+				Set("FlowId", alert.FlowId).
+				Set("EventData", alert.EventData):
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self TriageAlertsPlugin) Info(scope vfilter.Scope,
+	type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name: "triage_alerts",
+		Doc: "Watch for new alerts, applying deduplication, suppression " +
+			"and assignment rules.",
+		ArgType:  type_map.AddType(scope, &TriageAlertsPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.READ_RESULTS).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&TriageAlertsPlugin{})
+}
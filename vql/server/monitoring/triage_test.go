@@ -0,0 +1,66 @@
+package monitoring
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"www.velocidex.com/golang/velociraptor/services"
+)
+
+func TestAlertTriage(t *testing.T) {
+	now := time.Unix(1000, 0)
+	new_alert := func(client_id, name string, ts time.Time) *services.AlertMessage {
+		return &services.AlertMessage{
+			ClientId:  client_id,
+			AlertName: name,
+			Timestamp: ts,
+		}
+	}
+
+	triager := newAlertTriager([]*triageRule{{
+		// Suppress noisy alerts from a test machine during a
+		// maintenance window.
+		ClientId: regexp.MustCompile("C.test"),
+		Action:   TRIAGE_SUPPRESS,
+		Start:    now,
+		End:      now.Add(time.Hour),
+	}, {
+		Name:   regexp.MustCompile("(?i)mimikatz"),
+		Action: TRIAGE_ASSIGN,
+		User:   "alice",
+	}, {
+		Action: TRIAGE_ASSIGN,
+		User:   "bob",
+	}}, 10*time.Minute)
+
+	alert := new_alert("C.1", "Mimikatz Detected", now)
+	assert.Equal(t, "", triager.Triage(alert))
+	assert.Equal(t, services.ALERT_STATE_NEW, alert.State)
+	assert.Equal(t, "alice", alert.AssignedToUser)
+	assert.Regexp(t, "^A[.]", alert.AlertId)
+
+	// Other alerts fall through to the catch all assignment.
+	alert = new_alert("C.1", "Suspicious Service", now)
+	assert.Equal(t, "", triager.Triage(alert))
+	assert.Equal(t, "bob", alert.AssignedToUser)
+
+	// The same alert from the same client is a duplicate within
+	// the dedup window.
+	alert = new_alert("C.1", "Mimikatz Detected", now.Add(time.Minute))
+	assert.Equal(t, "Duplicate", triager.Triage(alert))
+
+	alert = new_alert("C.2", "Mimikatz Detected", now.Add(time.Minute))
+	assert.Equal(t, "", triager.Triage(alert))
+
+	alert = new_alert("C.1", "Mimikatz Detected", now.Add(11*time.Minute))
+	assert.Equal(t, "", triager.Triage(alert))
+
+	// Suppression only applies within the time range.
+	alert = new_alert("C.test", "Mimikatz Detected", now.Add(time.Minute))
+	assert.Equal(t, "Suppressed by rule", triager.Triage(alert))
+
+	alert = new_alert("C.test", "Mimikatz Detected", now.Add(2*time.Hour))
+	assert.Equal(t, "", triager.Triage(alert))
+}
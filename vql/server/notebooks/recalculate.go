@@ -0,0 +1,135 @@
+package notebooks
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	api_proto "www.velocidex.com/golang/velociraptor/api/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type RecalculateNotebookFunctionArgs struct {
+	NotebookId string `vfilter:"required,field=notebook_id,doc=The id of the notebook to recalculate"`
+}
+
+type RecalculateNotebookFunction struct{}
+
+// Re-run all the cells of a saved notebook against the current
+// data. This allows a notebook to be used as a saved search which is
+// refreshed as new results arrive.
+func (self RecalculateNotebookFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.COLLECT_SERVER)
+	if err != nil {
+		scope.Log("notebook_recalculate: %v", err)
+		return vfilter.Null{}
+	}
+
+	arg := &RecalculateNotebookFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("notebook_recalculate: %v", err)
+		return vfilter.Null{}
+	}
+
+	err = services.RequireFrontend()
+	if err != nil {
+		scope.Log("notebook_recalculate: %v", err)
+		return vfilter.Null{}
+	}
+
+	config_obj, pres := vql_subsystem.GetServerConfig(scope)
+	if !pres {
+		scope.Log("notebook_recalculate: must be running on the server")
+		return vfilter.Null{}
+	}
+
+	notebook_manager, err := services.GetNotebookManager(config_obj)
+	if err != nil {
+		scope.Log("notebook_recalculate: %v", err)
+		return vfilter.Null{}
+	}
+
+	notebook, err := notebook_manager.GetNotebook(
+		ctx, arg.NotebookId, services.DO_NOT_INCLUDE_UPLOADS)
+	if err != nil {
+		scope.Log("notebook_recalculate: %v", err)
+		return vfilter.Null{}
+	}
+
+	principal := vql_subsystem.GetPrincipal(scope)
+	if !notebook_manager.CheckNotebookAccess(notebook, principal) {
+		scope.Log("notebook_recalculate: Notebook is not shared with user.")
+		return vfilter.Null{}
+	}
+
+	// Fetch the cell content before we start updating them.
+	err = fillNotebookCells(ctx, config_obj, notebook)
+	if err != nil {
+		scope.Log("notebook_recalculate: %v", err)
+		return vfilter.Null{}
+	}
+
+	// Cells are calculated in order and synchronously because later
+	// cells may depend on the output of earlier ones.
+	for _, cell := range notebook.CellMetadata {
+		if cell.CellId == "" {
+			continue
+		}
+
+		_, err = notebook_manager.UpdateNotebookCell(
+			ctx, notebook, principal, &api_proto.NotebookCellRequest{
+				NotebookId: arg.NotebookId,
+				CellId:     cell.CellId,
+				Input:      cell.Input,
+				Type:       cell.Type,
+				Env:        cell.Env,
+				Sync:       true,
+			})
+		if err != nil {
+			scope.Log("notebook_recalculate: %v: %v", cell.CellId, err)
+		}
+	}
+
+	// Get the updated notebook
+	notebook, err = notebook_manager.GetNotebook(
+		ctx, arg.NotebookId, services.DO_NOT_INCLUDE_UPLOADS)
+	if err != nil {
+		scope.Log("notebook_recalculate: %v", err)
+		return vfilter.Null{}
+	}
+
+	err = fillNotebookCells(ctx, config_obj, notebook)
+	if err != nil {
+		scope.Log("notebook_recalculate: %v", err)
+		return vfilter.Null{}
+	}
+
+	services.LogAudit(ctx,
+		config_obj, principal, "RecalculateNotebook",
+		ordereddict.NewDict().
+			Set("notebook_id", notebook.NotebookId))
+
+	return notebook
+}
+
+func (self RecalculateNotebookFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:    "notebook_recalculate",
+		Doc:     "Re-run all the cells in a notebook.",
+		ArgType: type_map.AddType(scope, &RecalculateNotebookFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(
+			acls.COLLECT_SERVER).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&RecalculateNotebookFunction{})
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/utils/redact"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+// Build a redactor from the server config for the artifact.
+func getRedactor(scope vfilter.Scope, artifact string) (*redact.Redactor, error) {
+	config_obj, ok := vql_subsystem.GetServerConfig(scope)
+	if !ok {
+		return nil, errors.New("Redaction can only run on the server")
+	}
+
+	redactor, err := redact.FromConfig(config_obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return redactor.ForArtifact(artifact), nil
+}
+
+// Row values may be arbitrary Go objects so we serialize them first
+// to redact the same data that is forwarded.
+func redactRow(ctx context.Context, scope vfilter.Scope,
+	redactor *redact.Redactor, row vfilter.Row) (*ordereddict.Dict, error) {
+	dict := vfilter.RowToDict(ctx, scope, row)
+	if redactor == nil {
+		return dict, nil
+	}
+
+	serialized, err := json.MarshalWithOptions(
+		dict, vql_subsystem.EncOptsFromScope(scope))
+	if err != nil {
+		return nil, err
+	}
+
+	redacted, err := redactor.RedactJSON(serialized)
+	if err != nil {
+		return nil, err
+	}
+
+	return utils.ParseJsonToObject(redacted)
+}
+
+// Apply the configured redaction rules to all rows before they are
+// forwarded.
+func redactRows(ctx context.Context, scope vfilter.Scope,
+	name, artifact string,
+	row_chan <-chan vfilter.Row) (<-chan vfilter.Row, error) {
+	redactor, err := getRedactor(scope, artifact)
+	if err != nil {
+		return nil, err
+	}
+
+	if redactor == nil {
+		return row_chan, nil
+	}
+
+	output_chan := make(chan vfilter.Row)
+	go func() {
+		defer close(output_chan)
+
+		for row := range row_chan {
+			redacted, err := redactRow(ctx, scope, redactor, row)
+			if err != nil {
+				scope.Log("%v: Dropping row which can not be redacted: %v",
+					name, err)
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- redacted:
+			}
+		}
+	}()
+
+	return output_chan, nil
+}
+
+type RedactFunctionArgs struct {
+	Row      vfilter.Any `vfilter:"required,field=row,doc=The row to redact"`
+	Artifact string      `vfilter:"optional,field=artifact,doc=Only apply the rules for this artifact (default rules that apply to all artifacts)"`
+}
+
+type RedactFunction struct{}
+
+func (self *RedactFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	arg := &RedactFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("redact: %v", err)
+		return vfilter.Null{}
+	}
+
+	redactor, err := getRedactor(scope, arg.Artifact)
+	if err != nil {
+		scope.Log("redact: %v", err)
+		return vfilter.Null{}
+	}
+
+	result, err := redactRow(ctx, scope, redactor, arg.Row)
+	if err != nil {
+		scope.Log("redact: %v", err)
+		return vfilter.Null{}
+	}
+
+	return result
+}
+
+func (self RedactFunction) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "redact",
+		Doc:      "Apply the configured redaction rules to a row.",
+		ArgType:  type_map.AddType(scope, &RedactFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&RedactFunction{})
+}
@@ -35,6 +35,7 @@ import (
 	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
 	"www.velocidex.com/golang/velociraptor/constants"
 	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/utils/ecs"
 	"www.velocidex.com/golang/velociraptor/vql"
 	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
 	"www.velocidex.com/golang/velociraptor/vql/functions"
@@ -59,6 +60,10 @@ type _SplunkPluginArgs struct {
 	TimestampField string              `vfilter:"optional,field=timestamp_field,doc=Field to use as event timestamp."`
 	HostnameField  string              `vfilter:"optional,field=hostname_field,doc=Field to use as event hostname. Overrides hostname parameter."`
 	Secret         string              `vfilter:"optional,field=secret,doc=Alternatively use a secret from the secrets service. Secret must be of type 'AWS S3 Creds'"`
+	Schema         string              `vfilter:"optional,field=schema,doc=Normalize rows before uploading: raw (default), ecs (Elastic Common Schema) or text (flatten rows into the message field for full text search)."`
+	SchemaMapping  *ordereddict.Dict   `vfilter:"optional,field=schema_mapping,doc=Additional mappings of column names to ECS fields (e.g. dict(EventID='event.code'))."`
+	Redact         bool                `vfilter:"optional,field=redact,doc=If set, apply the configured redaction rules to rows before uploading."`
+	Artifact       string              `vfilter:"optional,field=artifact,doc=The artifact the rows come from, used to select the redaction rules."`
 }
 
 type _SplunkPlugin struct{}
@@ -110,16 +115,31 @@ func (self _SplunkPlugin) Call(ctx context.Context,
 			arg.Source = "velociraptor"
 		}
 
+		mapper, err := ecs.GetMapper(arg.Schema, arg.SchemaMapping)
+		if err != nil {
+			scope.Log("splunk_upload: %v", err)
+			return
+		}
+
 		config_obj, _ := artifacts.GetConfig(scope)
 
 		wg := sync.WaitGroup{}
 		row_chan := arg.Query.Eval(ctx, scope)
+		if arg.Redact {
+			row_chan, err = redactRows(ctx, scope, "splunk_upload",
+				arg.Artifact, row_chan)
+			if err != nil {
+				scope.Log("splunk_upload: %v", err)
+				return
+			}
+		}
+
 		for i := 0; i < int(arg.Threads); i++ {
 			wg.Add(1)
 
 			// Start an uploader on a thread.
 			go _upload_rows(ctx, scope, config_obj, output_chan,
-				row_chan, &wg, arg)
+				row_chan, &wg, arg, mapper)
 		}
 
 		wg.Wait()
@@ -135,7 +155,8 @@ func _upload_rows(
 	output_chan chan vfilter.Row,
 	row_chan <-chan vfilter.Row,
 	wg *sync.WaitGroup,
-	arg *_SplunkPluginArgs) {
+	arg *_SplunkPluginArgs,
+	mapper *ecs.Mapper) {
 	defer wg.Done()
 
 	// var buf []*ordereddict.Dict
@@ -180,19 +201,19 @@ func _upload_rows(
 		case row, ok := <-row_chan:
 			if !ok {
 				// Flush any remaining rows
-				send_to_splunk(ctx, scope, output_chan, client, buf, arg)
+				send_to_splunk(ctx, scope, output_chan, client, buf, arg, mapper)
 				return
 			}
 			buf = append(buf, row)
 
 			// Do not allow the buffer to get too large.
 			if int64(len(buf)) > arg.ChunkSize {
-				send_to_splunk(ctx, scope, output_chan, client, buf, arg)
+				send_to_splunk(ctx, scope, output_chan, client, buf, arg, mapper)
 				buf = buf[:0]
 			}
 
 		case <-next_send_time:
-			send_to_splunk(ctx, scope, output_chan, client, buf, arg)
+			send_to_splunk(ctx, scope, output_chan, client, buf, arg, mapper)
 			buf = buf[:0]
 			next_send_time = time.After(wait_time)
 		}
@@ -203,7 +224,8 @@ func send_to_splunk(
 	ctx context.Context,
 	scope vfilter.Scope,
 	output_chan chan vfilter.Row,
-	client *splunk.Client, buf []vfilter.Row, arg *_SplunkPluginArgs) {
+	client *splunk.Client, buf []vfilter.Row, arg *_SplunkPluginArgs,
+	mapper *ecs.Mapper) {
 
 	if len(buf) == 0 {
 		return
@@ -224,6 +246,13 @@ func send_to_splunk(
 			}
 		}
 
+		// The hostname and timestamp fields refer to the original
+		// columns.
+		data := dict
+		if mapper != nil {
+			data = mapper.Map(dict)
+		}
+
 		// Extract timestamp_field if exists
 		if arg.TimestampField != "" {
 			ts, ok := dict.Get(arg.TimestampField)
@@ -237,7 +266,7 @@ func send_to_splunk(
 					events,
 					client.NewEventWithTime(
 						timestamp,
-						dict,
+						data,
 						arg.Source,
 						arg.Sourcetype,
 						arg.Index,
@@ -251,7 +280,7 @@ func send_to_splunk(
 			events = append(
 				events,
 				client.NewEvent(
-					dict,
+					data,
 					arg.Source,
 					arg.Sourcetype,
 					arg.Index,
@@ -2,6 +2,7 @@ package timelines
 
 import (
 	"context"
+	"time"
 
 	"github.com/Velocidex/ordereddict"
 	"www.velocidex.com/golang/velociraptor/acls"
@@ -20,6 +21,7 @@ type TimelinePluginArgs struct {
 	Timeline       string      `vfilter:"required,field=timeline,doc=Name of the timeline to read"`
 	SkipComponents []string    `vfilter:"optional,field=skip,doc=List of child components to skip"`
 	StartTime      vfilter.Any `vfilter:"optional,field=start,doc=First timestamp to fetch"`
+	EndTime        vfilter.Any `vfilter:"optional,field=end,doc=Stop reading after this timestamp"`
 	NotebookId     string      `vfilter:"optional,field=notebook_id,doc=The notebook ID the timeline is stored in."`
 }
 
@@ -90,7 +92,22 @@ func (self TimelinePlugin) Call(
 			reader.SeekToTime(start)
 		}
 
+		var end time.Time
+		if !utils.IsNil(arg.EndTime) {
+			end, err = functions.TimeFromAny(ctx, scope, arg.EndTime)
+			if err != nil {
+				scope.Log("timeline: %v", err)
+				return
+			}
+		}
+
 		for item := range reader.Read(ctx) {
+			// The timeline is sorted so there is nothing more to
+			// read.
+			if !end.IsZero() && item.Time.After(end) {
+				return
+			}
+
 			select {
 			case <-ctx.Done():
 				return
@@ -0,0 +1,251 @@
+package users
+
+import (
+	"context"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/services/users"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type ApiKeyCreateFunctionArgs struct {
+	Username    string   `vfilter:"required,field=user,doc=The user the key will authenticate as."`
+	Description string   `vfilter:"optional,field=description,doc=A description of what the key is used for."`
+	OrgIds      []string `vfilter:"optional,field=orgs,doc=If set, the key may only access these orgs."`
+	RateLimit   float64  `vfilter:"optional,field=rate_limit,doc=Maximum number of requests per second (default unlimited)."`
+	ExpiresIn   int64    `vfilter:"optional,field=expires_in,doc=Number of seconds until the key expires (default never)."`
+}
+
+type ApiKeyCreateFunction struct{}
+
+func (self ApiKeyCreateFunction) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.SERVER_ADMIN)
+	if err != nil {
+		scope.Log("api_key_create: %v", err)
+		return vfilter.Null{}
+	}
+
+	arg := &ApiKeyCreateFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("api_key_create: %v", err)
+		return vfilter.Null{}
+	}
+
+	root_config_obj, err := getRootConfig(scope)
+	if err != nil {
+		scope.Log("api_key_create: %v", err)
+		return vfilter.Null{}
+	}
+
+	// Make sure the user actually exists.
+	principal := vql_subsystem.GetPrincipal(scope)
+	users_manager := services.GetUserManager()
+	_, err = users_manager.GetUser(ctx, principal, arg.Username)
+	if err != nil {
+		scope.Log("api_key_create: %v", err)
+		return vfilter.Null{}
+	}
+
+	var expires time.Time
+	if arg.ExpiresIn > 0 {
+		expires = time.Now().Add(time.Duration(arg.ExpiresIn) * time.Second)
+	}
+
+	key, record, err := users.CreateApiKey(ctx, root_config_obj,
+		arg.Username, arg.Description, arg.OrgIds, arg.RateLimit, expires)
+	if err != nil {
+		scope.Log("api_key_create: %v", err)
+		return vfilter.Null{}
+	}
+
+	services.LogAudit(ctx,
+		root_config_obj, principal, "api_key_create",
+		ordereddict.NewDict().
+			Set("api_key", record.Id).
+			Set("username", record.Username).
+			Set("orgs", record.Orgs).
+			Set("rate_limit", record.RateLimit).
+			Set("expires", record.Expires))
+
+	// The key is only available here - it can not be retrieved later.
+	return apiKeyToDict(record).Set("Key", key)
+}
+
+func (self ApiKeyCreateFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "api_key_create",
+		Doc:      "Creates an API key to authenticate automation as a user.",
+		ArgType:  type_map.AddType(scope, &ApiKeyCreateFunctionArgs{}),
+		Metadata: vql_subsystem.VQLMetadata().Permissions(acls.SERVER_ADMIN).Build(),
+	}
+}
+
+type ApiKeyRevokeFunctionArgs struct {
+	Id string `vfilter:"required,field=id,doc=The id of the key to revoke."`
+}
+
+type ApiKeyRevokeFunction struct{}
+
+func (self ApiKeyRevokeFunction) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	err := vql_subsystem.CheckAccess(scope, acls.SERVER_ADMIN)
+	if err != nil {
+		scope.Log("api_key_revoke: %v", err)
+		return vfilter.Null{}
+	}
+
+	arg := &ApiKeyRevokeFunctionArgs{}
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("api_key_revoke: %v", err)
+		return vfilter.Null{}
+	}
+
+	root_config_obj, err := getRootConfig(scope)
+	if err != nil {
+		scope.Log("api_key_revoke: %v", err)
+		return vfilter.Null{}
+	}
+
+	record, err := users.RevokeApiKey(ctx, root_config_obj, arg.Id)
+	if err != nil {
+		scope.Log("api_key_revoke: %v", err)
+		return vfilter.Null{}
+	}
+
+	principal := vql_subsystem.GetPrincipal(scope)
+	services.LogAudit(ctx,
+		root_config_obj, principal, "api_key_revoke",
+		ordereddict.NewDict().
+			Set("api_key", record.Id).
+			Set("username", record.Username))
+
+	return apiKeyToDict(record)
+}
+
+func (self ApiKeyRevokeFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "api_key_revoke",
+		Doc:      "Revokes an API key.",
+		ArgType:  type_map.AddType(scope, &ApiKeyRevokeFunctionArgs{}),
+		Metadata: vql_subsystem.VQLMetadata().Permissions(acls.SERVER_ADMIN).Build(),
+	}
+}
+
+type ApiKeysPluginArgs struct {
+	Username string `vfilter:"optional,field=user,doc=Only list keys for this user."`
+}
+
+type ApiKeysPlugin struct{}
+
+func (self ApiKeysPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		err := vql_subsystem.CheckAccess(scope, acls.SERVER_ADMIN)
+		if err != nil {
+			scope.Log("api_keys: %v", err)
+			return
+		}
+
+		arg := &ApiKeysPluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("api_keys: %v", err)
+			return
+		}
+
+		root_config_obj, err := getRootConfig(scope)
+		if err != nil {
+			scope.Log("api_keys: %v", err)
+			return
+		}
+
+		records, err := users.ListApiKeys(ctx, root_config_obj, arg.Username)
+		if err != nil {
+			scope.Log("api_keys: %v", err)
+			return
+		}
+
+		for _, record := range records {
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- apiKeyToDict(record):
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self ApiKeysPlugin) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name:     "api_keys",
+		Doc:      "List the API keys on the server.",
+		ArgType:  type_map.AddType(scope, &ApiKeysPluginArgs{}),
+		Metadata: vql_subsystem.VQLMetadata().Permissions(acls.SERVER_ADMIN).Build(),
+	}
+}
+
+// API keys are global to the server so are stored in the root org.
+func getRootConfig(scope vfilter.Scope) (*config_proto.Config, error) {
+	err := services.RequireFrontend()
+	if err != nil {
+		return nil, err
+	}
+
+	org_manager, err := services.GetOrgManager()
+	if err != nil {
+		return nil, err
+	}
+
+	return org_manager.GetOrgConfig(services.ROOT_ORG_ID)
+}
+
+func apiKeyToDict(record *users.ApiKey) *ordereddict.Dict {
+	result := ordereddict.NewDict().
+		Set("Id", record.Id).
+		Set("Username", record.Username).
+		Set("Description", record.Description).
+		Set("Orgs", record.Orgs).
+		Set("RateLimit", record.RateLimit).
+		Set("Created", time.Unix(record.Created, 0).UTC()).
+		Set("Expires", vfilter.Null{}).
+		Set("Revoked", vfilter.Null{})
+
+	if record.Expires > 0 {
+		result.Set("Expires", time.Unix(record.Expires, 0).UTC())
+	}
+
+	if record.Revoked > 0 {
+		result.Set("Revoked", time.Unix(record.Revoked, 0).UTC())
+	}
+
+	return result
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&ApiKeyCreateFunction{})
+	vql_subsystem.RegisterFunction(&ApiKeyRevokeFunction{})
+	vql_subsystem.RegisterPlugin(&ApiKeysPlugin{})
+}
@@ -0,0 +1,34 @@
+package tools
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/http_comms"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+)
+
+type CheckinFunction struct{}
+
+func (self *CheckinFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	defer vql_subsystem.RegisterMonitor("checkin", args)()
+
+	return http_comms.TriggerCheckin()
+}
+
+func (self CheckinFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name: "checkin",
+		Doc: "Contact the server immediately instead of waiting for the next " +
+			"poll. Event queries can call this when a significant local event " +
+			"occurs. Returns false if the request was rate limited.",
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&CheckinFunction{})
+}
@@ -23,6 +23,7 @@ import (
 	"www.velocidex.com/golang/velociraptor/json"
 	"www.velocidex.com/golang/velociraptor/services"
 	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/utils/ecs"
 	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
 	"www.velocidex.com/golang/velociraptor/vql/functions"
 	"www.velocidex.com/golang/velociraptor/vql/networking"
@@ -94,6 +95,7 @@ type LogScaleQueue struct {
 	authToken                 string
 	nWorkers                  int
 	tagMap                    map[string]string
+	mapper                    *ecs.Mapper
 	batchingTimeoutDuration   time.Duration
 	httpClientTimeoutDuration time.Duration
 	eventBatchSize            int
@@ -284,6 +286,20 @@ func (self *LogScaleQueue) SetTaggedFields(tags []string) error {
 	return nil
 }
 
+// Normalize event attributes with this mapper (nil to send rows
+// unchanged).
+func (self *LogScaleQueue) SetSchemaMapper(mapper *ecs.Mapper) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.opened {
+		return errQueueOpened
+	}
+
+	self.mapper = mapper
+	return nil
+}
+
 func (self *LogScaleQueue) SetHttpTransport(transport *http.Transport) error {
 	self.lock.Lock()
 	defer self.lock.Unlock()
@@ -462,6 +478,11 @@ func (self *LogScaleQueue) rowToPayload(ctx context.Context, scope vfilter.Scope
 	self.addMappedTags(row, payload)
 	self.addTimestamp(ctx, scope, row, payload)
 
+	// Tags and timestamps refer to the original columns.
+	if self.mapper != nil {
+		payload.Events[0].Attributes = self.mapper.Map(row)
+	}
+
 	return payload
 }
 
@@ -9,6 +9,7 @@ import (
 
 	"github.com/Velocidex/ordereddict"
 	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/utils/ecs"
 	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
 	"www.velocidex.com/golang/velociraptor/vql/networking"
 	vfilter "www.velocidex.com/golang/vfilter"
@@ -29,6 +30,8 @@ type logscalePluginArgs struct {
 	TagFields         []string            `vfilter:"optional,field=tag_fields,doc=Name of fields to be used as tags. Fields can be renamed using =<newname>"`
 	StatsInterval     int                 `vfilter:"optional,field=stats_interval,doc=Interval, in seconds, to post statistics to the log (default: 600, 0 to disable)"`
 	Debug             bool                `vfilter:"optional,field=debug,doc=Enable verbose logging."`
+	Schema            string              `vfilter:"optional,field=schema,doc=Normalize rows before uploading: raw (default), ecs (Elastic Common Schema) or text (flatten rows into the message field for full text search)."`
+	SchemaMapping     *ordereddict.Dict   `vfilter:"optional,field=schema_mapping,doc=Additional mappings of column names to ECS fields (e.g. dict(EventID='event.code'))."`
 }
 
 func (args *logscalePluginArgs) validate() error {
@@ -141,6 +144,16 @@ func applyArgs(args *logscalePluginArgs, queue *LogScaleQueue) error {
 		return fmt.Errorf("`tag_fields': %w", err)
 	}
 
+	mapper, err := ecs.GetMapper(args.Schema, args.SchemaMapping)
+	if err != nil {
+		return fmt.Errorf("`schema': %w", err)
+	}
+
+	err = queue.SetSchemaMapper(mapper)
+	if err != nil {
+		return fmt.Errorf("`schema': %w", err)
+	}
+
 	if args.Debug {
 		queue.EnableDebugging(true)
 	}
@@ -0,0 +1,295 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/uploads"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/utils/parquet"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+// GCS support is only available in extras builds.
+var parquetGCSUploader func(ctx context.Context, scope vfilter.Scope,
+	reader io.Reader, project, bucket, name, credentials string) (
+	*uploads.UploadResponse, error)
+
+type ExportParquetArgs struct {
+	Query       vfilter.StoredQuery `vfilter:"required,field=query,doc=The query producing the rows to export"`
+	Service     string              `vfilter:"optional,field=service,doc=Where to export to: s3 (default) or gcs"`
+	Bucket      string              `vfilter:"required,field=bucket,doc=The bucket to upload to"`
+	Prefix      string              `vfilter:"optional,field=prefix,doc=Prefix for the objects (e.g. hunt_id=H.123/artifact=Generic.Client.Info/)"`
+	RowsPerPart uint64              `vfilter:"optional,field=rows_per_part,doc=Start a new object after this many rows (default 1000000)"`
+
+	// S3 settings
+	Region               string `vfilter:"optional,field=region,doc=The region the bucket is in"`
+	CredentialsKey       string `vfilter:"optional,field=credentials_key,doc=The AWS key credentials to use"`
+	CredentialsSecret    string `vfilter:"optional,field=credentials_secret,doc=The AWS secret credentials to use"`
+	CredentialsToken     string `vfilter:"optional,field=credentials_token,doc=The AWS session token to use (only needed for temporary credentials)"`
+	Endpoint             string `vfilter:"optional,field=endpoint,doc=The Endpoint to use"`
+	ServerSideEncryption string `vfilter:"optional,field=serverside_encryption,doc=The server side encryption method to use"`
+	KmsEncryptionKey     string `vfilter:"optional,field=kms_encryption_key,doc=The server side KMS key to use"`
+	SkipVerify           bool   `vfilter:"optional,field=skip_verify,doc=Skip TLS Verification"`
+	Secret               string `vfilter:"optional,field=secret,doc=Alternatively use a secret from the secrets service. Secret must be of type 'AWS S3 Creds'"`
+
+	// GCS settings
+	Project     string `vfilter:"optional,field=project,doc=The GCS project to upload to"`
+	Credentials string `vfilter:"optional,field=credentials,doc=The GCS credentials to use"`
+}
+
+// An object being streamed to the bucket.
+type parquetPart struct {
+	name   string
+	pipe   *io.PipeWriter
+	writer *parquet.Writer
+
+	wg       sync.WaitGroup
+	response *uploads.UploadResponse
+	err      error
+}
+
+// Close the part and wait for the upload to complete.
+func (self *parquetPart) Close() (*uploads.UploadResponse, error) {
+	err := self.writer.Close()
+	if err != nil {
+		self.pipe.CloseWithError(err)
+	} else {
+		self.pipe.Close()
+	}
+	self.wg.Wait()
+
+	if self.err == nil {
+		self.err = err
+	}
+	if self.response != nil {
+		self.response.Size = uint64(self.writer.Size())
+	}
+	return self.response, self.err
+}
+
+type ExportParquetPlugin struct{}
+
+func (self ExportParquetPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+		defer vql_subsystem.RegisterMonitor("export_parquet", args)()
+
+		mergeScope(ctx, scope, args)
+
+		arg := &ExportParquetArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("export_parquet: %v", err)
+			return
+		}
+
+		if arg.Secret != "" {
+			s3_args := &S3UploadArgs{Secret: arg.Secret}
+			err := mergeSecret(ctx, scope, s3_args)
+			if err != nil {
+				scope.Log("export_parquet: %v", err)
+				return
+			}
+			arg.Region = s3_args.Region
+			arg.CredentialsKey = s3_args.CredentialsKey
+			arg.CredentialsSecret = s3_args.CredentialsSecret
+			arg.CredentialsToken = s3_args.CredentialsToken
+			arg.Endpoint = s3_args.Endpoint
+			arg.ServerSideEncryption = s3_args.ServerSideEncryption
+			arg.KmsEncryptionKey = s3_args.KmsEncryptionKey
+		}
+
+		if arg.RowsPerPart == 0 {
+			arg.RowsPerPart = 1000000
+		}
+
+		upload, err := getParquetUploader(scope, arg)
+		if err != nil {
+			scope.Log("export_parquet: %v", err)
+			return
+		}
+
+		sub_ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var part *parquetPart
+		part_number := 0
+
+		close_part := func() bool {
+			if part == nil {
+				return true
+			}
+
+			rows := part.writer.Rows()
+			response, err := part.Close()
+			part = nil
+
+			result := ordereddict.NewDict().
+				Set("Part", part_number-1).
+				Set("Rows", rows).
+				Set("Upload", response)
+			if err != nil {
+				scope.Log("export_parquet: %v", err)
+				result.Set("Error", err.Error())
+			}
+
+			select {
+			case <-ctx.Done():
+				return false
+			case output_chan <- result:
+			}
+			return err == nil
+		}
+		defer close_part()
+
+		opts := vql_subsystem.EncOptsFromScope(scope)
+
+		subscope := scope.Copy()
+		defer subscope.Close()
+
+		for row := range arg.Query.Eval(sub_ctx, subscope) {
+			dict := vfilter.RowToDict(sub_ctx, subscope, row)
+
+			// The schema of each part is taken from its first row.
+			if part == nil {
+				name := fmt.Sprintf("%spart-%05d.parquet", arg.Prefix, part_number)
+				part, err = startParquetPart(sub_ctx, upload, name, dict.Keys())
+				if err != nil {
+					scope.Log("export_parquet: %v", err)
+					return
+				}
+				part_number++
+			}
+
+			values := make([]*string, 0, len(part.writer.Columns()))
+			for _, column := range part.writer.Columns() {
+				value, pres := dict.Get(column)
+				values = append(values, parquetValue(value, pres, opts))
+			}
+
+			err = part.writer.Write(values)
+			if err != nil {
+				scope.Log("export_parquet: %v", err)
+				return
+			}
+
+			if uint64(part.writer.Rows()) >= arg.RowsPerPart && !close_part() {
+				return
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+type parquetUploader func(ctx context.Context, reader io.Reader, name string) (
+	*uploads.UploadResponse, error)
+
+func getParquetUploader(
+	scope vfilter.Scope, arg *ExportParquetArgs) (parquetUploader, error) {
+	switch arg.Service {
+	case "", "s3":
+		return func(ctx context.Context, reader io.Reader, name string) (
+			*uploads.UploadResponse, error) {
+			return upload_S3(ctx, scope, reader, arg.Bucket, name,
+				arg.CredentialsKey, arg.CredentialsSecret, arg.CredentialsToken,
+				arg.Region, arg.Endpoint, arg.ServerSideEncryption,
+				arg.KmsEncryptionKey, "", arg.SkipVerify, 0)
+		}, nil
+
+	case "gcs":
+		if parquetGCSUploader == nil {
+			return nil, errors.New("GCS support is not available in this build")
+		}
+		return func(ctx context.Context, reader io.Reader, name string) (
+			*uploads.UploadResponse, error) {
+			return parquetGCSUploader(ctx, scope, reader,
+				arg.Project, arg.Bucket, name, arg.Credentials)
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("Unsupported service %v", arg.Service)
+	}
+}
+
+// Start streaming a new part to the bucket. Nothing is written to
+// local disk - only the current row group is held in memory.
+func startParquetPart(ctx context.Context, upload parquetUploader,
+	name string, columns []string) (*parquetPart, error) {
+	reader, writer := io.Pipe()
+
+	part := &parquetPart{
+		name: name,
+		pipe: writer,
+	}
+
+	part.wg.Add(1)
+	go func() {
+		defer part.wg.Done()
+
+		part.response, part.err = upload(ctx, reader, name)
+
+		// Unblock the writer if the upload failed early.
+		reader.CloseWithError(part.err)
+	}()
+
+	var err error
+	part.writer, err = parquet.NewWriter(writer, columns)
+	if err != nil {
+		writer.CloseWithError(err)
+		part.wg.Wait()
+		return nil, err
+	}
+
+	return part, nil
+}
+
+// Strings are stored as is, other values are serialized to JSON.
+func parquetValue(value interface{}, pres bool, opts *json.EncOpts) *string {
+	if !pres || utils.IsNil(value) {
+		return nil
+	}
+
+	switch t := value.(type) {
+	case vfilter.Null, *vfilter.Null:
+		return nil
+
+	case string:
+		return &t
+
+	default:
+		serialized, err := json.MarshalWithOptions(value, opts)
+		if err != nil {
+			return nil
+		}
+		result := string(serialized)
+		return &result
+	}
+}
+
+func (self ExportParquetPlugin) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name: "export_parquet",
+		Doc: "Stream query results as partitioned Parquet files directly " +
+			"to an S3 or GCS bucket.",
+		ArgType: type_map.AddType(scope, &ExportParquetArgs{}),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&ExportParquetPlugin{})
+}
@@ -0,0 +1,8 @@
+//go:build extras
+// +build extras
+
+package tools
+
+func init() {
+	parquetGCSUploader = upload_gcs
+}
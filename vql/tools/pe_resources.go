@@ -0,0 +1,534 @@
+/*
+  Edit the version information and icon resources of a Windows
+  binary during repacking.
+
+  The resource directory is left in place. New resource data is
+  appended to the end of the .rsrc section (which must be the last
+  section in the file) and the existing resource data entries are
+  pointed at it.
+*/
+
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	RT_ICON       = 3
+	RT_GROUP_ICON = 14
+	RT_VERSION    = 16
+
+	IMAGE_DIRECTORY_ENTRY_RESOURCE = 2
+	IMAGE_DIRECTORY_ENTRY_SECURITY = 4
+)
+
+// A resource data entry (IMAGE_RESOURCE_DATA_ENTRY) in the file.
+type resourceDataEntry struct {
+	// File offset of the entry itself.
+	offset int
+	id     uint32
+	rva    uint32
+	size   uint32
+}
+
+type peResourceEditor struct {
+	data []byte
+
+	// File offsets of important headers.
+	optional_header int
+	data_directory  int
+	rsrc_header     int
+
+	section_alignment uint32
+	file_alignment    uint32
+
+	rsrc_va  uint32
+	rsrc_raw uint32
+
+	// Data entries for each resource type.
+	entries map[uint32][]*resourceDataEntry
+}
+
+func newPEResourceEditor(data []byte) (*peResourceEditor, error) {
+	self := &peResourceEditor{
+		data:    data,
+		entries: make(map[uint32][]*resourceDataEntry),
+	}
+
+	if len(data) < 0x40 || string(data[:2]) != "MZ" {
+		return nil, errors.New("Not a PE file")
+	}
+
+	pe_header := int(binary.LittleEndian.Uint32(data[0x3c:]))
+	if pe_header+24 > len(data) ||
+		string(data[pe_header:pe_header+4]) != "PE\x00\x00" {
+		return nil, errors.New("Not a PE file")
+	}
+
+	number_of_sections := int(binary.LittleEndian.Uint16(data[pe_header+6:]))
+	size_of_optional_header := int(binary.LittleEndian.Uint16(data[pe_header+20:]))
+	self.optional_header = pe_header + 24
+
+	switch binary.LittleEndian.Uint16(data[self.optional_header:]) {
+	case 0x10b: // PE32
+		self.data_directory = self.optional_header + 96
+	case 0x20b: // PE32+
+		self.data_directory = self.optional_header + 112
+	default:
+		return nil, errors.New("Unknown optional header")
+	}
+
+	self.section_alignment = binary.LittleEndian.Uint32(
+		data[self.optional_header+32:])
+	self.file_alignment = binary.LittleEndian.Uint32(
+		data[self.optional_header+36:])
+
+	// Find the .rsrc section - it must be the last one so we can
+	// grow it.
+	section_table := self.optional_header + size_of_optional_header
+	last_raw := uint32(0)
+	for i := 0; i < number_of_sections; i++ {
+		header := section_table + i*40
+		if header+40 > len(data) {
+			return nil, errors.New("Section table truncated")
+		}
+
+		raw := binary.LittleEndian.Uint32(data[header+20:])
+		if raw > last_raw {
+			last_raw = raw
+		}
+
+		if string(bytes.TrimRight(data[header:header+8], "\x00")) == ".rsrc" {
+			self.rsrc_header = header
+			self.rsrc_va = binary.LittleEndian.Uint32(data[header+12:])
+			self.rsrc_raw = raw
+		}
+	}
+
+	if self.rsrc_header == 0 {
+		return nil, errors.New("Binary has no resources")
+	}
+
+	if self.rsrc_raw != last_raw {
+		return nil, errors.New("The .rsrc section is not the last section")
+	}
+
+	err := self.walkDirectory(0, 0, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return self, nil
+}
+
+func (self *peResourceEditor) rsrcOffset(offset uint32) (int, error) {
+	result := int(self.rsrc_raw + offset)
+	if result+16 > len(self.data) {
+		return 0, errors.New("Resource directory truncated")
+	}
+	return result, nil
+}
+
+// Walk the resource tree (type -> id -> language) recording the data
+// entries.
+func (self *peResourceEditor) walkDirectory(
+	offset uint32, depth int, res_type, id uint32) error {
+	if depth > 2 {
+		return errors.New("Resource directory too deep")
+	}
+
+	dir, err := self.rsrcOffset(offset)
+	if err != nil {
+		return err
+	}
+
+	count := int(binary.LittleEndian.Uint16(self.data[dir+12:])) +
+		int(binary.LittleEndian.Uint16(self.data[dir+14:]))
+
+	for i := 0; i < count; i++ {
+		entry := dir + 16 + i*8
+		if entry+8 > len(self.data) {
+			return errors.New("Resource directory truncated")
+		}
+
+		name := binary.LittleEndian.Uint32(self.data[entry:])
+		child := binary.LittleEndian.Uint32(self.data[entry+4:])
+
+		switch depth {
+		case 0:
+			res_type = name
+		case 1:
+			id = name
+		}
+
+		// A subdirectory
+		if child&0x80000000 != 0 {
+			err = self.walkDirectory(child&0x7fffffff, depth+1, res_type, id)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		data_entry, err := self.rsrcOffset(child)
+		if err != nil {
+			return err
+		}
+
+		self.entries[res_type] = append(self.entries[res_type],
+			&resourceDataEntry{
+				offset: data_entry,
+				id:     id,
+				rva:    binary.LittleEndian.Uint32(self.data[data_entry:]),
+				size:   binary.LittleEndian.Uint32(self.data[data_entry+4:]),
+			})
+	}
+
+	return nil
+}
+
+func (self *peResourceEditor) readEntry(entry *resourceDataEntry) ([]byte, error) {
+	start := int(entry.rva-self.rsrc_va) + int(self.rsrc_raw)
+	end := start + int(entry.size)
+	if start < 0 || end > len(self.data) {
+		return nil, errors.New("Resource data out of range")
+	}
+	return self.data[start:end], nil
+}
+
+// Append the data to the end of the file and point the entry at it.
+func (self *peResourceEditor) replaceEntry(
+	entry *resourceDataEntry, data []byte) {
+	for len(self.data)%8 != 0 {
+		self.data = append(self.data, 0)
+	}
+
+	entry.rva = self.rsrc_va + uint32(len(self.data)) - self.rsrc_raw
+	entry.size = uint32(len(data))
+	binary.LittleEndian.PutUint32(self.data[entry.offset:], entry.rva)
+	binary.LittleEndian.PutUint32(self.data[entry.offset+4:], entry.size)
+
+	self.data = append(self.data, data...)
+}
+
+func alignUp(value, alignment uint32) uint32 {
+	if alignment == 0 {
+		return value
+	}
+	return (value + alignment - 1) / alignment * alignment
+}
+
+// Remove any Authenticode signature - it is invalidated by the
+// edit. The certificate table is always at the end of the file.
+func (self *peResourceEditor) stripSignature() {
+	security := self.data_directory + IMAGE_DIRECTORY_ENTRY_SECURITY*8
+	offset := binary.LittleEndian.Uint32(self.data[security:])
+	size := binary.LittleEndian.Uint32(self.data[security+4:])
+	if offset == 0 || size == 0 {
+		return
+	}
+
+	if int(offset) <= len(self.data) {
+		self.data = self.data[:offset]
+	}
+	binary.LittleEndian.PutUint32(self.data[security:], 0)
+	binary.LittleEndian.PutUint32(self.data[security+4:], 0)
+}
+
+// Grow the .rsrc section to cover the appended data and fix up the
+// headers.
+func (self *peResourceEditor) Bytes() []byte {
+	size := alignUp(uint32(len(self.data))-self.rsrc_raw, self.file_alignment)
+	for uint32(len(self.data)) < self.rsrc_raw+size {
+		self.data = append(self.data, 0)
+	}
+
+	// VirtualSize and SizeOfRawData
+	binary.LittleEndian.PutUint32(self.data[self.rsrc_header+8:], size)
+	binary.LittleEndian.PutUint32(self.data[self.rsrc_header+16:], size)
+
+	// The resource data directory
+	resource_dir := self.data_directory + IMAGE_DIRECTORY_ENTRY_RESOURCE*8
+	binary.LittleEndian.PutUint32(self.data[resource_dir+4:], size)
+
+	// SizeOfImage
+	binary.LittleEndian.PutUint32(self.data[self.optional_header+56:],
+		alignUp(self.rsrc_va+size, self.section_alignment))
+
+	// The checksum is not verified for regular executables.
+	binary.LittleEndian.PutUint32(self.data[self.optional_header+64:], 0)
+
+	return self.data
+}
+
+// A node in the VS_VERSIONINFO tree.
+type versionNode struct {
+	key      string
+	typ      uint16
+	value    []byte
+	children []*versionNode
+}
+
+func align4(offset int) int {
+	return (offset + 3) &^ 3
+}
+
+func parseVersionNode(data []byte) (*versionNode, int, error) {
+	if len(data) < 6 {
+		return nil, 0, errors.New("Version info truncated")
+	}
+
+	length := int(binary.LittleEndian.Uint16(data))
+	value_length := int(binary.LittleEndian.Uint16(data[2:]))
+	result := &versionNode{typ: binary.LittleEndian.Uint16(data[4:])}
+	if length > len(data) || length < 6 {
+		return nil, 0, errors.New("Version info truncated")
+	}
+
+	// The key is a null terminated UTF16 string.
+	offset := 6
+	key := []uint16{}
+	for offset+2 <= length {
+		c := binary.LittleEndian.Uint16(data[offset:])
+		offset += 2
+		if c == 0 {
+			break
+		}
+		key = append(key, c)
+	}
+	result.key = string(utf16.Decode(key))
+	offset = align4(offset)
+
+	// Text values are measured in words.
+	if result.typ == 1 {
+		value_length *= 2
+	}
+	if offset+value_length > length {
+		value_length = length - offset
+	}
+	if value_length > 0 {
+		result.value = data[offset : offset+value_length]
+		offset = align4(offset + value_length)
+	}
+
+	for offset < length {
+		child, child_length, err := parseVersionNode(data[offset:length])
+		if err != nil {
+			return nil, 0, err
+		}
+		result.children = append(result.children, child)
+		offset = align4(offset + child_length)
+	}
+
+	return result, length, nil
+}
+
+func (self *versionNode) serialize() []byte {
+	buf := make([]byte, 6)
+	for _, c := range utf16.Encode([]rune(self.key)) {
+		buf = binary.LittleEndian.AppendUint16(buf, c)
+	}
+	buf = append(buf, 0, 0)
+	for len(buf)%4 != 0 {
+		buf = append(buf, 0)
+	}
+
+	value_length := len(self.value)
+	if self.typ == 1 {
+		value_length /= 2
+	}
+	buf = append(buf, self.value...)
+
+	for _, child := range self.children {
+		for len(buf)%4 != 0 {
+			buf = append(buf, 0)
+		}
+		buf = append(buf, child.serialize()...)
+	}
+
+	binary.LittleEndian.PutUint16(buf, uint16(len(buf)))
+	binary.LittleEndian.PutUint16(buf[2:], uint16(value_length))
+	binary.LittleEndian.PutUint16(buf[4:], self.typ)
+
+	return buf
+}
+
+func utf16Value(value string) []byte {
+	result := []byte{}
+	for _, c := range utf16.Encode([]rune(value)) {
+		result = binary.LittleEndian.AppendUint16(result, c)
+	}
+	return append(result, 0, 0)
+}
+
+// Parse a version like 0.72.0.1 into the two DWORDs used by
+// VS_FIXEDFILEINFO.
+func parseFixedVersion(version string) (uint32, uint32, bool) {
+	parts := strings.Split(version, ".")
+	numbers := make([]uint32, 4)
+	for i := 0; i < len(parts) && i < 4; i++ {
+		n, err := strconv.ParseUint(parts[i], 10, 16)
+		if err != nil {
+			return 0, 0, false
+		}
+		numbers[i] = uint32(n)
+	}
+	return numbers[0]<<16 | numbers[1], numbers[2]<<16 | numbers[3], true
+}
+
+// Set the strings in the binary's version information. Keys are the
+// standard names (e.g. CompanyName, ProductName, FileVersion).
+func (self *peResourceEditor) SetVersionInfo(values map[string]string) error {
+	entries := self.entries[RT_VERSION]
+	if len(entries) == 0 {
+		return errors.New("Binary has no version information")
+	}
+
+	data, err := self.readEntry(entries[0])
+	if err != nil {
+		return err
+	}
+
+	root, _, err := parseVersionNode(data)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, child := range root.children {
+		if child.key != "StringFileInfo" {
+			continue
+		}
+
+		for _, table := range child.children {
+			for _, key := range keys {
+				value := values[key]
+				found := false
+				for _, str := range table.children {
+					if str.key == key {
+						str.value = utf16Value(value)
+						found = true
+					}
+				}
+				if !found {
+					table.children = append(table.children, &versionNode{
+						key: key, typ: 1, value: utf16Value(value),
+					})
+				}
+			}
+		}
+	}
+
+	// Keep the numeric versions in sync with the strings.
+	if len(root.value) >= 52 {
+		fixed := append([]byte{}, root.value...)
+		ms, ls, ok := parseFixedVersion(values["FileVersion"])
+		if ok {
+			binary.LittleEndian.PutUint32(fixed[8:], ms)
+			binary.LittleEndian.PutUint32(fixed[12:], ls)
+		}
+		ms, ls, ok = parseFixedVersion(values["ProductVersion"])
+		if ok {
+			binary.LittleEndian.PutUint32(fixed[16:], ms)
+			binary.LittleEndian.PutUint32(fixed[20:], ls)
+		}
+		root.value = fixed
+	}
+
+	self.replaceEntry(entries[0], root.serialize())
+	return nil
+}
+
+// Replace the application icon with the images in the .ico file. The
+// ico may not contain more images than the original icon.
+func (self *peResourceEditor) SetIcon(ico []byte) error {
+	if len(ico) < 6 || binary.LittleEndian.Uint16(ico[2:]) != 1 {
+		return errors.New("Not an ico file")
+	}
+	count := int(binary.LittleEndian.Uint16(ico[4:]))
+
+	groups := self.entries[RT_GROUP_ICON]
+	icons := self.entries[RT_ICON]
+	if len(groups) == 0 || len(icons) == 0 {
+		return errors.New("Binary has no icon")
+	}
+
+	if count > len(icons) {
+		return fmt.Errorf(
+			"Icon has too many images (%v), the binary has space for %v",
+			count, len(icons))
+	}
+
+	group := make([]byte, 6, 6+count*14)
+	copy(group, ico[:6])
+
+	for i := 0; i < count; i++ {
+		entry := 6 + i*16
+		if entry+16 > len(ico) {
+			return errors.New("Icon directory truncated")
+		}
+
+		size := binary.LittleEndian.Uint32(ico[entry+8:])
+		offset := binary.LittleEndian.Uint32(ico[entry+12:])
+		if int(offset)+int(size) > len(ico) {
+			return errors.New("Icon image truncated")
+		}
+
+		self.replaceEntry(icons[i], ico[offset:offset+size])
+
+		// A GRPICONDIRENTRY is the ICONDIRENTRY with the image
+		// offset replaced by the resource id.
+		group = append(group, ico[entry:entry+12]...)
+		group = binary.LittleEndian.AppendUint16(group, uint16(icons[i].id))
+	}
+
+	self.replaceEntry(groups[0], group)
+	return nil
+}
+
+// Stamp version information and an icon into a PE binary.
+func StampPEResources(exe_bytes []byte,
+	version_info map[string]string, ico []byte) ([]byte, error) {
+	editor, err := newPEResourceEditor(exe_bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	editor.stripSignature()
+
+	// Anything after the section is an overlay we can not keep.
+	section_end := editor.rsrc_raw + binary.LittleEndian.Uint32(
+		editor.data[editor.rsrc_header+16:])
+	if int(section_end) < len(editor.data) {
+		return nil, errors.New("Binary has appended data - stamp resources before appending binaries")
+	}
+
+	if len(version_info) > 0 {
+		err = editor.SetVersionInfo(version_info)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ico) > 0 {
+		err = editor.SetIcon(ico)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return editor.Bytes(), nil
+}
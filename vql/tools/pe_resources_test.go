@@ -0,0 +1,44 @@
+package tools
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+)
+
+func TestVersionInfoRoundTrip(t *testing.T) {
+	// The version info resource compiled into the binary.
+	data, err := os.ReadFile("../../bin/rsrc_windows_amd64.syso")
+	assert.NoError(t, err)
+
+	idx := bytes.Index(data, utf16Value("VS_VERSION_INFO"))
+	assert.True(t, idx > 6)
+	data = data[idx-6:]
+
+	root, length, err := parseVersionNode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "VS_VERSION_INFO", root.key)
+
+	// Serializing the parsed tree gives back the original.
+	assert.Equal(t, data[:length], root.serialize())
+
+	// Update a string and read it back.
+	table := root.children[0].children[0]
+	for _, str := range table.children {
+		if str.key == "CompanyName" {
+			str.value = utf16Value("A much longer company name")
+		}
+	}
+
+	root, _, err = parseVersionNode(root.serialize())
+	assert.NoError(t, err)
+
+	table = root.children[0].children[0]
+	for _, str := range table.children {
+		if str.key == "CompanyName" {
+			assert.Equal(t, utf16Value("A much longer company name"), str.value)
+		}
+	}
+}
@@ -51,13 +51,15 @@ const (
 )
 
 type RepackFunctionArgs struct {
-	Target     string            `vfilter:"optional,field=target,doc=The name of the target OS to repack (VelociraptorWindows, VelociraptorLinux, VelociraptorDarwin)"`
-	Version    string            `vfilter:"optional,field=version,doc=Velociraptor Version to repack"`
-	Exe        *accessors.OSPath `vfilter:"optional,field=exe,doc=Alternative a path to the executable to repack"`
-	Accessor   string            `vfilter:"optional,field=accessor,doc=The accessor to use to read the file."`
-	Binaries   []string          `vfilter:"optional,field=binaries,doc=List of tool names that will be repacked into the target"`
-	Config     string            `vfilter:"required,field=config,doc=The config to be repacked in the form of a json or yaml string"`
-	UploadName string            `vfilter:"required,field=upload_name,doc=The name of the upload to create"`
+	Target      string            `vfilter:"optional,field=target,doc=The name of the target OS to repack (VelociraptorWindows, VelociraptorLinux, VelociraptorDarwin)"`
+	Version     string            `vfilter:"optional,field=version,doc=Velociraptor Version to repack"`
+	Exe         *accessors.OSPath `vfilter:"optional,field=exe,doc=Alternative a path to the executable to repack"`
+	Accessor    string            `vfilter:"optional,field=accessor,doc=The accessor to use to read the file."`
+	Binaries    []string          `vfilter:"optional,field=binaries,doc=List of tool names that will be repacked into the target"`
+	Config      string            `vfilter:"required,field=config,doc=The config to be repacked in the form of a json or yaml string"`
+	UploadName  string            `vfilter:"required,field=upload_name,doc=The name of the upload to create"`
+	VersionInfo *ordereddict.Dict `vfilter:"optional,field=version_info,doc=Windows version information to set in the binary (e.g. dict(CompanyName=..., ProductName=..., FileVersion=...))"`
+	Icon        string            `vfilter:"optional,field=icon,doc=The content of an .ico file to use as the Windows binary's icon"`
 }
 
 type RepackFunction struct{}
@@ -115,6 +117,25 @@ func (self RepackFunction) Call(ctx context.Context,
 			exe_bytes, []byte(arg.Config))
 	}
 
+	// Stamp the resources before anything is appended to the
+	// binary.
+	version_info := make(map[string]string)
+	if arg.VersionInfo != nil {
+		for _, k := range arg.VersionInfo.Keys() {
+			v, _ := arg.VersionInfo.Get(k)
+			version_info[k] = utils.ToString(v)
+		}
+	}
+
+	if len(version_info) > 0 || arg.Icon != "" {
+		exe_bytes, err = StampPEResources(
+			exe_bytes, version_info, []byte(arg.Icon))
+		if err != nil {
+			scope.Log("ERROR:client_repack: Stamping resources: %v", err)
+			return vfilter.Null{}
+		}
+	}
+
 	scope.Log("client_repack: Will Repack the Velociraptor binary with %v bytes of config",
 		len(arg.Config))
 
@@ -0,0 +1,167 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/artifacts"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/services/writeback"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/velociraptor/vql/psutils"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+const (
+	RESTART_AGENT = "agent"
+	RESTART_HOST  = "host"
+
+	DEFAULT_RESTART_MESSAGE = "This computer will restart for maintenance."
+)
+
+type RestartFunctionArgs struct {
+	Action  string `vfilter:"optional,field=action,doc=What to restart: 'agent' (default) or 'host'."`
+	Delay   int64  `vfilter:"optional,field=delay,doc=Wait this long (in seconds) before restarting."`
+	Message string `vfilter:"optional,field=message,doc=The message shown to logged in users before a host restart."`
+	Notify  bool   `vfilter:"optional,field=notify,doc=If set, notify logged in users before a host restart."`
+}
+
+type RestartFunction struct{}
+
+func (self *RestartFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	defer vql_subsystem.RegisterMonitor("restart", args)()
+
+	arg := &RestartFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("restart: %v", err)
+		return vfilter.Null{}
+	}
+
+	// This is a privileged operation
+	err = vql_subsystem.CheckAccess(scope, acls.EXECVE)
+	if err != nil {
+		scope.Log("restart: %v", err)
+		return vfilter.Null{}
+	}
+
+	client_config_obj, ok := artifacts.GetConfig(scope)
+	if !ok || client_config_obj == nil {
+		scope.Log("restart: Must be running on a client to restart")
+		return vfilter.Null{}
+	}
+
+	switch arg.Action {
+	case "":
+		arg.Action = RESTART_AGENT
+	case RESTART_AGENT, RESTART_HOST:
+	default:
+		scope.Log("restart: Unknown action %v: should be 'agent' or 'host'",
+			arg.Action)
+		return vfilter.Null{}
+	}
+
+	if arg.Delay < 0 {
+		arg.Delay = 0
+	}
+
+	if arg.Message == "" {
+		arg.Message = DEFAULT_RESTART_MESSAGE
+	}
+
+	// A host reboot is confirmed by a change in the boot time.
+	boot_time, err := psutils.BootTimeWithContext(ctx)
+	if err != nil {
+		scope.Log("restart: %v", err)
+	}
+
+	flow_id, _ := scope.Resolve("_SessionId")
+	pending := &config_proto.PendingRestart{
+		FlowId:        utils.ToString(flow_id),
+		Action:        arg.Action,
+		RequestedTime: uint64(utils.GetTime().Now().Unix()),
+		Delay:         uint64(arg.Delay),
+		BootTime:      boot_time,
+	}
+
+	// Record the restart so the client can confirm it when it
+	// comes back up.
+	config_obj := &config_proto.Config{Client: client_config_obj}
+	err = writeback.GetWritebackService().MutateWriteback(config_obj,
+		func(wb *config_proto.Writeback) error {
+			wb.PendingRestart = pending
+			return writeback.WritebackUpdateLevel2
+		})
+	if err != nil {
+		scope.Log("restart: %v", err)
+		return vfilter.Null{}
+	}
+
+	result := ordereddict.NewDict().
+		Set("Action", arg.Action).
+		Set("Delay", arg.Delay).
+		Set("Scheduled", utils.GetTime().Now().Add(
+			time.Duration(arg.Delay)*time.Second))
+
+	switch arg.Action {
+	case RESTART_HOST:
+		// The OS handles the delay and notifies the users.
+		err = rebootHost(ctx, arg.Delay, arg.Message, arg.Notify)
+		if err != nil {
+			scope.Log("restart: %v", err)
+
+			// The restart will not happen so there is nothing to
+			// confirm.
+			_ = writeback.GetWritebackService().MutateWriteback(config_obj,
+				func(wb *config_proto.Writeback) error {
+					wb.PendingRestart = nil
+					return writeback.WritebackUpdateLevel2
+				})
+			return vfilter.Null{}
+		}
+
+	case RESTART_AGENT:
+		// Restart the main client loop, but wait a bit to allow the
+		// flow to complete.
+		go func() {
+			time.Sleep(time.Duration(arg.Delay) * time.Second)
+
+			select {
+			case ClientRestart <- pending.FlowId:
+			default:
+			}
+		}()
+	}
+
+	return result
+}
+
+func (self RestartFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "restart",
+		Doc:      "Schedule a restart of the client or the host. The client confirms the restart to the server when it starts up again.",
+		ArgType:  type_map.AddType(scope, &RestartFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.EXECVE).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&RestartFunction{})
+}
+
+// Unix shutdown only schedules in whole minutes so round up.
+func shutdownTime(delay int64) string {
+	if delay <= 0 {
+		return "now"
+	}
+	return fmt.Sprintf("+%d", (delay+59)/60)
+}
@@ -0,0 +1,43 @@
+//go:build darwin
+// +build darwin
+
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Show a notification in the console user's session. We run as
+// root so we need to switch to the user's launchd context.
+func notifyConsoleUser(ctx context.Context, message string) error {
+	uid, err := exec.CommandContext(ctx, "stat", "-f", "%u", "/dev/console").
+		Output()
+	if err != nil {
+		return err
+	}
+
+	script := fmt.Sprintf("display notification %q with title %q",
+		message, "Restart scheduled")
+	return exec.CommandContext(ctx, "launchctl", "asuser",
+		strings.TrimSpace(string(uid)),
+		"osascript", "-e", script).Run()
+}
+
+func rebootHost(ctx context.Context,
+	delay int64, message string, notify bool) error {
+	if notify {
+		// Not fatal - there may be no one logged in.
+		_ = notifyConsoleUser(ctx, message)
+	}
+
+	output, err := exec.CommandContext(ctx, "shutdown", "-r",
+		shutdownTime(delay)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("shutdown: %w: %v", err,
+			strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// shutdown broadcasts the message to logged in users.
+func rebootHost(ctx context.Context,
+	delay int64, message string, notify bool) error {
+	argv := []string{"-r", shutdownTime(delay)}
+	if notify {
+		argv = append(argv, message)
+	}
+
+	output, err := exec.CommandContext(ctx, "shutdown", argv...).
+		CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("shutdown: %w: %v", err,
+			strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build windows
+// +build windows
+
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// shutdown.exe shows a countdown to logged in users when the delay
+// is not 0 and the optional comment explains why.
+func rebootHost(ctx context.Context,
+	delay int64, message string, notify bool) error {
+	argv := []string{"/r", "/t", fmt.Sprintf("%d", delay),
+		// Planned: Application: Maintenance
+		"/d", "p:4:1"}
+	if notify {
+		argv = append(argv, "/c", message)
+	}
+
+	output, err := exec.CommandContext(ctx, "shutdown.exe", argv...).
+		CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("shutdown.exe: %w: %v", err,
+			strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package tools
 import (
 	"crypto/tls"
 	"errors"
+	"io"
 	"net/http"
 
 	"github.com/Velocidex/ordereddict"
@@ -127,7 +128,7 @@ func (self S3UploadFunction) Call(ctx context.Context,
 }
 
 func upload_S3(ctx context.Context, scope vfilter.Scope,
-	reader accessors.ReadSeekCloser,
+	reader io.Reader,
 	bucket, name string,
 	credentialsKey string,
 	credentialsSecret string,
@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/artifacts"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	"www.velocidex.com/golang/velociraptor/http_comms"
+	"www.velocidex.com/golang/velociraptor/services/writeback"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+type UpdateServerUrlsFunctionArgs struct {
+	Urls  []string `vfilter:"optional,field=urls,doc=The new list of server URLs (these may include credentials)."`
+	Reset bool     `vfilter:"optional,field=reset,doc=If set, forget any pushed URLs and use the config file URLs after the next restart."`
+}
+
+type UpdateServerUrlsFunction struct{}
+
+func (self *UpdateServerUrlsFunction) Call(ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) vfilter.Any {
+
+	defer vql_subsystem.RegisterMonitor("update_server_urls", args)()
+
+	arg := &UpdateServerUrlsFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("update_server_urls: %v", err)
+		return vfilter.Null{}
+	}
+
+	// This is a privileged operation - it redirects the client to
+	// another server.
+	err = vql_subsystem.CheckAccess(scope, acls.EXECVE)
+	if err != nil {
+		scope.Log("update_server_urls: %v", err)
+		return vfilter.Null{}
+	}
+
+	client_config_obj, ok := artifacts.GetConfig(scope)
+	if !ok || client_config_obj == nil {
+		scope.Log("update_server_urls: Must be running on a client")
+		return vfilter.Null{}
+	}
+
+	if !arg.Reset {
+		err = http_comms.ValidateServerUrls(arg.Urls)
+		if err != nil {
+			scope.Log("update_server_urls: %v", err)
+			return vfilter.Null{}
+		}
+	}
+
+	// Persist the new URLs so they survive a restart.
+	config_obj := &config_proto.Config{Client: client_config_obj}
+	err = writeback.GetWritebackService().MutateWriteback(config_obj,
+		func(wb *config_proto.Writeback) error {
+			if arg.Reset {
+				wb.ServerUrls = nil
+			} else {
+				wb.ServerUrls = arg.Urls
+			}
+			return writeback.WritebackUpdateLevel1
+		})
+	if err != nil {
+		scope.Log("update_server_urls: %v", err)
+		return vfilter.Null{}
+	}
+
+	if arg.Reset {
+		return client_config_obj.ServerUrls
+	}
+
+	// Switch the running communicator over to the new URLs.
+	err = http_comms.UpdateServerUrls(arg.Urls)
+	if err != nil {
+		scope.Log("update_server_urls: %v", err)
+		return vfilter.Null{}
+	}
+
+	return arg.Urls
+}
+
+func (self UpdateServerUrlsFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
+	return &vfilter.FunctionInfo{
+		Name:     "update_server_urls",
+		Doc:      "Switch the client to a new set of server URLs without restarting. The new URLs are stored in the writeback.",
+		ArgType:  type_map.AddType(scope, &UpdateServerUrlsFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.EXECVE).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterFunction(&UpdateServerUrlsFunction{})
+}
@@ -28,10 +28,14 @@ package vql
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
+	"github.com/Velocidex/ordereddict"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"www.velocidex.com/golang/velociraptor/acls"
 	"www.velocidex.com/golang/velociraptor/constants"
 	"www.velocidex.com/golang/vfilter"
 )
@@ -140,6 +144,56 @@ func EnforceVQLAllowList(
 	return nil
 }
 
+// Remove all plugins and functions which declare any of the
+// permissions in their metadata. Unlike an ACL check this removes
+// them from every scope so they can not be called at all. Returns
+// the names of the removed plugins and functions.
+func EnforceVQLDenyList(permissions ...acls.ACL_PERMISSION) []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	removed := []string{}
+	for name, plugin := range exportedPlugins {
+		info := plugin.Info(nil, nil)
+		if info != nil && declaresPermission(info.Metadata, permissions) {
+			delete(exportedPlugins, name)
+			removed = append(removed, name)
+		}
+	}
+
+	for name, function := range exportedFunctions {
+		info := function.Info(nil, nil)
+		if info != nil && declaresPermission(info.Metadata, permissions) {
+			delete(exportedFunctions, name)
+			removed = append(removed, name)
+		}
+	}
+
+	// Reset the global scope so we will be forced to recreate it.
+	globalScope = nil
+
+	sort.Strings(removed)
+	return removed
+}
+
+func declaresPermission(
+	metadata *ordereddict.Dict, permissions []acls.ACL_PERMISSION) bool {
+	if metadata == nil {
+		return false
+	}
+
+	declared, _ := metadata.GetString("permissions")
+	for _, name := range strings.Split(declared, ",") {
+		perm := acls.GetPermission(strings.TrimSpace(name))
+		for _, p := range permissions {
+			if perm == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 var (
 	mu sync.Mutex
 
@@ -53,6 +53,8 @@ type Win32_Process struct {
 	CommandLine     string
 	Exe             string
 	TokenIsElevated bool
+	IntegrityLevel  string
+	SessionId       uint32
 	CreateTime      time.Time
 	User            float64 `json:"user"`
 	System          float64 `json:"system"`
@@ -181,6 +183,44 @@ func (self *Win32_Process) getUsername(handle syscall.Handle) {
 	if err == nil {
 		self.TokenIsElevated = elevation.TokenIsElevated > 0
 	}
+
+	self.IntegrityLevel = getIntegrityLevel(windows.Token(token))
+}
+
+// The integrity level is the last sub authority of the token's
+// mandatory label SID.
+func getIntegrityLevel(token windows.Token) string {
+	buffer := make([]byte, 256)
+	length := uint32(0)
+	err := windows.GetTokenInformation(token, windows.TokenIntegrityLevel,
+		&buffer[0], uint32(len(buffer)), &length)
+	if err != nil {
+		return ""
+	}
+
+	label := (*windows.Tokenmandatorylabel)(unsafe.Pointer(&buffer[0]))
+	count := label.Label.Sid.SubAuthorityCount()
+	if count == 0 {
+		return ""
+	}
+
+	rid := label.Label.Sid.SubAuthority(uint32(count) - 1)
+	switch {
+	case rid < 0x1000:
+		return "Untrusted"
+	case rid < 0x2000:
+		return "Low"
+	case rid < 0x2100:
+		return "Medium"
+	case rid < 0x3000:
+		return "MediumPlus"
+	case rid < 0x4000:
+		return "High"
+	case rid < 0x5000:
+		return "System"
+	default:
+		return "Protected"
+	}
 }
 
 type PslistPlugin struct{}
@@ -242,6 +282,10 @@ func (self PslistPlugin) Call(
 					Threads: entry.Threads,
 				}
 
+				// This works even when we can not open the process.
+				_ = windows.ProcessIdToSessionId(
+					entry.ProcessID, &info.SessionId)
+
 				proc_handle, err := info.getHandle()
 				if err == nil {
 					info.getCmdLine(proc_handle)
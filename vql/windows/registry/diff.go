@@ -0,0 +1,68 @@
+package registry
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+)
+
+// A snapshot of the values under a key. Keys are the value names
+// relative to the watched key (e.g. Subkey\Name). The default value
+// is named @.
+type valueSnapshot map[string]interface{}
+
+// Compare two snapshots of the watched key and produce an event for
+// each value which was added, modified or deleted.
+func diffValues(key_path string, now time.Time,
+	before, after valueSnapshot) []*ordereddict.Dict {
+	var result []*ordereddict.Dict
+
+	names := make([]string, 0, len(before)+len(after))
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		_, pres := before[name]
+		if !pres {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		old_value, old_pres := before[name]
+		new_value, new_pres := after[name]
+
+		action := ""
+		switch {
+		case !old_pres:
+			action = "Added"
+		case !new_pres:
+			action = "Deleted"
+		case !reflect.DeepEqual(old_value, new_value):
+			action = "Modified"
+		default:
+			continue
+		}
+
+		key, value_name := key_path, name
+		idx := strings.LastIndex(name, "\\")
+		if idx >= 0 {
+			key = key_path + "\\" + name[:idx]
+			value_name = name[idx+1:]
+		}
+
+		result = append(result, ordereddict.NewDict().
+			Set("Time", now).
+			Set("Action", action).
+			Set("Key", key).
+			Set("ValueName", value_name).
+			Set("Before", old_value).
+			Set("After", new_value))
+	}
+
+	return result
+}
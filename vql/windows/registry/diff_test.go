@@ -0,0 +1,43 @@
+package registry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/velociraptor/json"
+)
+
+func TestDiffValues(t *testing.T) {
+	key := `HKEY_LOCAL_MACHINE\Software\Microsoft\Windows\CurrentVersion\Run`
+	before := valueSnapshot{
+		"OneDrive": `C:\OneDrive.exe`,
+		"Updater":  `C:\Updater.exe`,
+		"@":        "",
+	}
+	after := valueSnapshot{
+		"OneDrive":     `C:\OneDrive.exe`,
+		"Updater":      `C:\Users\Public\evil.exe`,
+		"@":            "",
+		`Sub\Backdoor`: []byte{1, 2},
+	}
+
+	events := diffValues(key, time.Unix(10, 0).UTC(), before, after)
+	serialized := json.MustMarshalString(events)
+	assert.Equal(t, `[{"Time":"1970-01-01T00:00:10Z","Action":"Added",`+
+		`"Key":"HKEY_LOCAL_MACHINE\\Software\\Microsoft\\Windows\\CurrentVersion\\Run\\Sub",`+
+		`"ValueName":"Backdoor","Before":null,"After":"AQI="},`+
+		`{"Time":"1970-01-01T00:00:10Z","Action":"Modified",`+
+		`"Key":"HKEY_LOCAL_MACHINE\\Software\\Microsoft\\Windows\\CurrentVersion\\Run",`+
+		`"ValueName":"Updater","Before":"C:\\Updater.exe","After":"C:\\Users\\Public\\evil.exe"}]`,
+		serialized)
+
+	// Deleting the value.
+	events = diffValues(key, time.Unix(10, 0).UTC(), after, before)
+	assert.Equal(t, 2, len(events))
+	action, _ := events[0].Get("Action")
+	assert.Equal(t, "Deleted", action)
+
+	// No changes
+	assert.Equal(t, 0, len(diffValues(key, time.Now(), before, before)))
+}
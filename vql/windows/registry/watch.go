@@ -0,0 +1,256 @@
+//go:build windows
+// +build windows
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+	registry_accessor "www.velocidex.com/golang/velociraptor/accessors/registry"
+	"www.velocidex.com/golang/velociraptor/acls"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql"
+	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
+	vfilter "www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+)
+
+const (
+	// WaitForMultipleObjects can only wait on this many handles.
+	MAXIMUM_WAIT_OBJECTS = 64
+
+	// How deep to snapshot subkeys of recursive watches.
+	MAX_SUBKEY_DEPTH = 5
+
+	// How often to check if the query is cancelled.
+	WAIT_MSEC = 1000
+)
+
+type WatchRegistryPluginArgs struct {
+	Keys      []string `vfilter:"required,field=keys,doc=Registry keys to watch (e.g. HKEY_LOCAL_MACHINE\\Software\\Microsoft\\Windows\\CurrentVersion\\Run)."`
+	Recursive bool     `vfilter:"optional,field=recursive,doc=Also watch values in subkeys."`
+}
+
+type keyWatcher struct {
+	path      string
+	key       registry.Key
+	event     windows.Handle
+	recursive bool
+	values    valueSnapshot
+}
+
+func (self *keyWatcher) Close() {
+	self.key.Close()
+	windows.CloseHandle(self.event)
+}
+
+// Request a notification on the event the next time the key
+// changes. Notifications are one shot so this must be called after
+// each change.
+func (self *keyWatcher) arm() error {
+	return windows.RegNotifyChangeKeyValue(windows.Handle(self.key),
+		self.recursive,
+		windows.REG_NOTIFY_CHANGE_NAME|windows.REG_NOTIFY_CHANGE_LAST_SET,
+		self.event, true)
+}
+
+func (self *keyWatcher) snapshot() valueSnapshot {
+	result := make(valueSnapshot)
+	snapshotKey(self.key, "", self.recursive, 0, result)
+	return result
+}
+
+func snapshotKey(key registry.Key, prefix string,
+	recursive bool, depth int, result valueSnapshot) {
+	names, _ := registry_accessor.ReadValueNames(key)
+	for _, name := range names {
+		value, err := registry_accessor.GetValue(key, name)
+		if err != nil {
+			continue
+		}
+		if name == "" {
+			name = "@"
+		}
+		result[prefix+name] = value
+	}
+
+	if !recursive || depth >= MAX_SUBKEY_DEPTH {
+		return
+	}
+
+	subkeys, _ := key.ReadSubKeyNames(-1)
+	for _, subkey_name := range subkeys {
+		subkey, err := registry.OpenKey(key, subkey_name,
+			registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			continue
+		}
+		snapshotKey(subkey, prefix+subkey_name+"\\", recursive, depth+1, result)
+		subkey.Close()
+	}
+}
+
+func openKeyWatcher(path string, recursive bool) (*keyWatcher, error) {
+	components := utils.SplitComponents(path)
+	if len(components) == 0 {
+		return nil, fmt.Errorf("Invalid key %v", path)
+	}
+
+	hive, ok := registry_accessor.GetHiveFromName(components[0])
+	if !ok {
+		return nil, fmt.Errorf("Unknown root hive name %s", components[0])
+	}
+
+	key, err := registry.OpenKey(hive, strings.Join(components[1:], "\\"),
+		registry.NOTIFY|registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS|
+			registry.WOW64_64KEY)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+
+	// Auto reset event.
+	event, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		key.Close()
+		return nil, err
+	}
+
+	result := &keyWatcher{
+		path:      strings.Join(components, "\\"),
+		key:       key,
+		event:     event,
+		recursive: recursive,
+	}
+	result.values = result.snapshot()
+
+	err = result.arm()
+	if err != nil {
+		result.Close()
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+
+	return result, nil
+}
+
+type WatchRegistryPlugin struct{}
+
+func (self WatchRegistryPlugin) Call(
+	ctx context.Context,
+	scope vfilter.Scope,
+	args *ordereddict.Dict) <-chan vfilter.Row {
+	output_chan := make(chan vfilter.Row)
+
+	go func() {
+		defer close(output_chan)
+		defer vql_subsystem.RegisterMonitor("watch_registry", args)()
+
+		// Notifications are tied to the thread which requested
+		// them so all registry calls must happen on this thread.
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		err := vql_subsystem.CheckAccess(scope, acls.MACHINE_STATE)
+		if err != nil {
+			scope.Log("watch_registry: %s", err)
+			return
+		}
+
+		arg := &WatchRegistryPluginArgs{}
+		err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("watch_registry: %s", err.Error())
+			return
+		}
+
+		if len(arg.Keys) > MAXIMUM_WAIT_OBJECTS {
+			scope.Log("watch_registry: Can only watch up to %v keys",
+				MAXIMUM_WAIT_OBJECTS)
+			return
+		}
+
+		var watchers []*keyWatcher
+		var events []windows.Handle
+		for _, key := range arg.Keys {
+			watcher, err := openKeyWatcher(key, arg.Recursive)
+			if err != nil {
+				scope.Log("watch_registry: %v", err)
+				continue
+			}
+			defer watcher.Close()
+
+			watchers = append(watchers, watcher)
+			events = append(events, watcher.event)
+		}
+
+		if len(watchers) == 0 {
+			return
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			idx, err := windows.WaitForMultipleObjects(events, false, WAIT_MSEC)
+			if err != nil {
+				scope.Log("watch_registry: %v", err)
+				return
+			}
+
+			if idx == uint32(windows.WAIT_TIMEOUT) {
+				continue
+			}
+
+			idx -= windows.WAIT_OBJECT_0
+			if int(idx) >= len(watchers) {
+				continue
+			}
+
+			watcher := watchers[idx]
+
+			// Re-arm before taking the snapshot so changes made
+			// while we compare are not missed.
+			err = watcher.arm()
+			if err != nil {
+				scope.Log("watch_registry: %v: %v", watcher.path, err)
+				return
+			}
+
+			values := watcher.snapshot()
+			for _, row := range diffValues(watcher.path,
+				utils.GetTime().Now(), watcher.values, values) {
+				select {
+				case <-ctx.Done():
+					return
+				case output_chan <- row:
+				}
+			}
+			watcher.values = values
+		}
+	}()
+
+	return output_chan
+}
+
+func (self WatchRegistryPlugin) Info(
+	scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.PluginInfo {
+	return &vfilter.PluginInfo{
+		Name: "watch_registry",
+		Doc: "Watch registry keys for changes and emit the values " +
+			"before and after the change.",
+		ArgType:  type_map.AddType(scope, &WatchRegistryPluginArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.MACHINE_STATE).Build(),
+	}
+}
+
+func init() {
+	vql_subsystem.RegisterPlugin(&WatchRegistryPlugin{})
+}
@@ -10,7 +10,9 @@ import (
 	"github.com/Velocidex/ordereddict"
 	"golang.org/x/sys/windows/registry"
 	registry_accessor "www.velocidex.com/golang/velociraptor/accessors/registry"
+	"www.velocidex.com/golang/velociraptor/acls"
 	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql"
 	vql_subsystem "www.velocidex.com/golang/velociraptor/vql"
 	vfilter "www.velocidex.com/golang/vfilter"
 	"www.velocidex.com/golang/vfilter/arg_parser"
@@ -32,8 +34,16 @@ func (self *RegSetValueFunction) Call(ctx context.Context,
 
 	defer vql_subsystem.RegisterMonitor("reg_set_value", args)()
 
+	// Changing the registry is the same as writing to the
+	// filesystem.
+	err := vql_subsystem.CheckAccess(scope, acls.FILESYSTEM_WRITE)
+	if err != nil {
+		scope.Log("reg_set_value: %v", err)
+		return vfilter.Null{}
+	}
+
 	arg := &RegSetValueFunctionArgs{}
-	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
 	if err != nil {
 		scope.Log("reg_set_value: %s", err.Error())
 		return vfilter.Null{}
@@ -118,9 +128,10 @@ func (self *RegSetValueFunction) Call(ctx context.Context,
 
 func (self RegSetValueFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
 	return &vfilter.FunctionInfo{
-		Name:    "reg_set_value",
-		Doc:     "Set a value in the registry.",
-		ArgType: type_map.AddType(scope, &RegSetValueFunctionArgs{}),
+		Name:     "reg_set_value",
+		Doc:      "Set a value in the registry.",
+		ArgType:  type_map.AddType(scope, &RegSetValueFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.FILESYSTEM_WRITE).Build(),
 	}
 }
 
@@ -136,8 +147,16 @@ func (self *RegDeleteValueFunction) Call(ctx context.Context,
 
 	defer vql_subsystem.RegisterMonitor("reg_rm_value", args)()
 
+	// Changing the registry is the same as writing to the
+	// filesystem.
+	err := vql_subsystem.CheckAccess(scope, acls.FILESYSTEM_WRITE)
+	if err != nil {
+		scope.Log("reg_rm_value: %v", err)
+		return vfilter.Null{}
+	}
+
 	arg := &RegDeleteValueFunctionArgs{}
-	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
 	if err != nil {
 		scope.Log("reg_rm_value: %s", err.Error())
 		return vfilter.Null{}
@@ -181,9 +200,10 @@ func (self *RegDeleteValueFunction) Call(ctx context.Context,
 
 func (self RegDeleteValueFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
 	return &vfilter.FunctionInfo{
-		Name:    "reg_rm_value",
-		Doc:     "Removes a value in the registry.",
-		ArgType: type_map.AddType(scope, &RegDeleteValueFunctionArgs{}),
+		Name:     "reg_rm_value",
+		Doc:      "Removes a value in the registry.",
+		ArgType:  type_map.AddType(scope, &RegDeleteValueFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.FILESYSTEM_WRITE).Build(),
 	}
 }
 
@@ -199,8 +219,16 @@ func (self *RegDeleteKeyFunction) Call(ctx context.Context,
 
 	defer vql_subsystem.RegisterMonitor("reg_rm_key", args)()
 
+	// Changing the registry is the same as writing to the
+	// filesystem.
+	err := vql_subsystem.CheckAccess(scope, acls.FILESYSTEM_WRITE)
+	if err != nil {
+		scope.Log("reg_rm_key: %v", err)
+		return vfilter.Null{}
+	}
+
 	arg := &RegDeleteKeyFunctionArgs{}
-	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	err = arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
 	if err != nil {
 		scope.Log("reg_rm_key: %s", err.Error())
 		return vfilter.Null{}
@@ -242,9 +270,10 @@ func (self *RegDeleteKeyFunction) Call(ctx context.Context,
 
 func (self RegDeleteKeyFunction) Info(scope vfilter.Scope, type_map *vfilter.TypeMap) *vfilter.FunctionInfo {
 	return &vfilter.FunctionInfo{
-		Name:    "reg_rm_key",
-		Doc:     "Removes a key and all its values from the registry.",
-		ArgType: type_map.AddType(scope, &RegDeleteKeyFunctionArgs{}),
+		Name:     "reg_rm_key",
+		Doc:      "Removes a key and all its values from the registry.",
+		ArgType:  type_map.AddType(scope, &RegDeleteKeyFunctionArgs{}),
+		Metadata: vql.VQLMetadata().Permissions(acls.FILESYSTEM_WRITE).Build(),
 	}
 }
 
@@ -26,6 +26,7 @@ package plugins
 
 import (
 	_ "www.velocidex.com/golang/velociraptor/vql/server"
+	_ "www.velocidex.com/golang/velociraptor/vql/server/cases"
 	_ "www.velocidex.com/golang/velociraptor/vql/server/clients"
 	_ "www.velocidex.com/golang/velociraptor/vql/server/crypto"
 	_ "www.velocidex.com/golang/velociraptor/vql/server/downloads"
@@ -0,0 +1,56 @@
+package integration_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/vtesting/assert"
+	"www.velocidex.com/golang/velociraptor/vtesting/integration"
+
+	_ "www.velocidex.com/golang/velociraptor/result_sets/timed"
+	_ "www.velocidex.com/golang/velociraptor/vql/common"
+)
+
+type IntegrationTestSuite struct {
+	integration.TestSuite
+}
+
+func (self *IntegrationTestSuite) SetupTest() {
+	self.ConfigObj = self.LoadConfig()
+	self.LoadArtifactsIntoConfig([]string{`
+name: TestArtifact
+sources:
+- query: SELECT log(message="Hello") AS Hello FROM scope()
+`})
+
+	self.TestSuite.SetupTest()
+	self.StartFrontend()
+}
+
+func (self *IntegrationTestSuite) TestCollection() {
+	clients := []*integration.Client{self.StartClient(), self.StartClient()}
+
+	for _, client := range clients {
+		self.WaitForEnrolment(client)
+
+		flow := self.CollectArtifact(client.ClientId, "TestArtifact")
+		assert.Equal(self.T(), flows_proto.ArtifactCollectorContext_FINISHED,
+			flow.Context.State)
+		assert.Equal(self.T(), uint64(1), flow.Context.TotalCollectedRows)
+	}
+}
+
+func (self *IntegrationTestSuite) TestHunt() {
+	for i := 0; i < 2; i++ {
+		self.WaitForEnrolment(self.StartClient())
+	}
+
+	hunt_obj := self.RunHunt(2, "TestArtifact")
+	assert.Equal(self.T(), uint64(2), hunt_obj.Stats.TotalClientsWithResults)
+	assert.Equal(self.T(), uint64(0), hunt_obj.Stats.TotalClientsWithErrors)
+}
+
+func TestIntegration(t *testing.T) {
+	suite.Run(t, &IntegrationTestSuite{})
+}
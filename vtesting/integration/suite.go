@@ -0,0 +1,299 @@
+/*
+  An in-process integration test harness.
+
+  The harness runs a real frontend (over plain HTTP on a free port)
+  with the usual server services and any number of real clients,
+  each with its own private key and writeback. Clients enrol with the
+  server through the normal crypto stack so tests can exercise
+  enrolment, collections and hunts end to end.
+
+  Users may embed the TestSuite in their own testify suites to
+  validate custom artifacts:
+
+  type MyTestSuite struct {
+      integration.TestSuite
+  }
+
+  func (self *MyTestSuite) TestMyArtifact() {
+      self.LoadArtifactsIntoConfig([]string{my_artifact})
+      self.StartFrontend()
+      client := self.StartClient()
+      flow := self.CollectArtifact(client.ClientId, "MyArtifact")
+      ...
+  }
+*/
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"www.velocidex.com/golang/velociraptor/api"
+	api_proto "www.velocidex.com/golang/velociraptor/api/proto"
+	config_proto "www.velocidex.com/golang/velociraptor/config/proto"
+	crypto_utils "www.velocidex.com/golang/velociraptor/crypto/utils"
+	"www.velocidex.com/golang/velociraptor/executor"
+	"www.velocidex.com/golang/velociraptor/file_store/test_utils"
+	flows_proto "www.velocidex.com/golang/velociraptor/flows/proto"
+	"www.velocidex.com/golang/velociraptor/http_comms"
+	"www.velocidex.com/golang/velociraptor/json"
+	"www.velocidex.com/golang/velociraptor/server"
+	"www.velocidex.com/golang/velociraptor/services"
+	"www.velocidex.com/golang/velociraptor/services/writeback"
+	"www.velocidex.com/golang/velociraptor/utils"
+	"www.velocidex.com/golang/velociraptor/vql/acl_managers"
+	"www.velocidex.com/golang/velociraptor/vtesting"
+)
+
+var (
+	// How long to wait for the system to settle.
+	Timeout = 20 * time.Second
+)
+
+type Client struct {
+	ClientId  string
+	ConfigObj *config_proto.Config
+	Comms     *http_comms.HTTPCommunicator
+}
+
+type TestSuite struct {
+	test_utils.TestSuite
+
+	Port    int
+	Clients []*Client
+
+	// If set, clients use this clock for poll and backoff timing.
+	Clock utils.Clock
+
+	server_url    string
+	writeback_dir string
+
+	server_cancel func()
+	server_wg     *sync.WaitGroup
+
+	client_ctx    context.Context
+	client_cancel func()
+	client_wg     *sync.WaitGroup
+}
+
+func (self *TestSuite) SetupTest() {
+	if self.ConfigObj == nil {
+		self.ConfigObj = self.LoadConfig()
+	}
+	self.ConfigObj.Services.Interrogation = true
+	self.ConfigObj.Services.Launcher = true
+	self.ConfigObj.Services.UserManager = true
+	self.ConfigObj.Services.ClientMonitoring = true
+	self.ConfigObj.Services.HuntDispatcher = true
+	self.ConfigObj.Services.HuntManager = true
+
+	var err error
+	self.Port, err = vtesting.GetFreePort()
+	require.NoError(self.T(), err)
+
+	self.server_url = fmt.Sprintf("http://localhost:%d/", self.Port)
+	self.ConfigObj.Frontend.BindPort = uint32(self.Port)
+	self.ConfigObj.Client.ServerUrls = []string{self.server_url}
+
+	// Poll quickly so tests do not wait.
+	self.ConfigObj.Client.MaxPoll = 1
+	self.ConfigObj.Client.MaxPollStd = 1
+
+	self.writeback_dir, err = os.MkdirTemp("", "integration")
+	require.NoError(self.T(), err)
+
+	self.TestSuite.SetupTest()
+}
+
+func (self *TestSuite) TearDownTest() {
+	if self.client_cancel != nil {
+		self.client_cancel()
+		self.client_wg.Wait()
+	}
+
+	if self.server_cancel != nil {
+		self.server_cancel()
+		self.server_wg.Wait()
+	}
+
+	self.Clients = nil
+	self.client_cancel = nil
+	self.server_cancel = nil
+
+	os.RemoveAll(self.writeback_dir)
+
+	self.TestSuite.TearDownTest()
+}
+
+// Start the frontend and wait for it to accept connections.
+func (self *TestSuite) StartFrontend() {
+	ctx, cancel := context.WithCancel(self.Ctx)
+	self.server_cancel = cancel
+	self.server_wg = &sync.WaitGroup{}
+
+	server_obj, err := server.NewServer(ctx, self.ConfigObj, self.server_wg)
+	require.NoError(self.T(), err)
+
+	mux := http.NewServeMux()
+	server.PrepareFrontendMux(self.ConfigObj, server_obj, mux)
+
+	err = api.StartFrontendPlainHttp(
+		ctx, self.server_wg, self.ConfigObj, server_obj, mux)
+	require.NoError(self.T(), err)
+
+	vtesting.WaitUntil(Timeout, self.T(), func() bool {
+		req, err := http.Get(self.server_url + "server.pem")
+		if err != nil {
+			return false
+		}
+		defer req.Body.Close()
+
+		return req.StatusCode == http.StatusOK
+	})
+}
+
+// Start a new client with a fresh key. The client enrols with the
+// frontend in the background - use WaitForEnrolment() to wait for
+// it.
+func (self *TestSuite) StartClient() *Client {
+	if self.client_cancel == nil {
+		self.client_ctx, self.client_cancel = context.WithCancel(self.Ctx)
+		self.client_wg = &sync.WaitGroup{}
+	}
+
+	// Each client gets its own copy of the config with its own
+	// writeback file.
+	client_config := &config_proto.Config{}
+	serialized, err := json.Marshal(self.ConfigObj)
+	require.NoError(self.T(), err)
+	err = json.Unmarshal(serialized, client_config)
+	require.NoError(self.T(), err)
+
+	filename := filepath.Join(self.writeback_dir,
+		fmt.Sprintf("client.%d.yaml", len(self.Clients)))
+	client_config.Client.WritebackLinux = filename
+	client_config.Client.WritebackWindows = filename
+	client_config.Client.WritebackDarwin = filename
+
+	writeback_service := writeback.GetWritebackService()
+	err = writeback_service.LoadWriteback(client_config)
+	require.NoError(self.T(), err)
+
+	// Generate a new private key for this client.
+	err = crypto_utils.VerifyConfig(client_config)
+	require.NoError(self.T(), err)
+
+	wb, err := writeback_service.GetWriteback(client_config)
+	require.NoError(self.T(), err)
+
+	clock := self.Clock
+	if clock == nil {
+		clock = utils.RealClock{}
+	}
+
+	exe, err := executor.NewClientExecutorWithClock(
+		self.client_ctx, wb.ClientId, client_config, clock)
+	require.NoError(self.T(), err)
+
+	comm, err := http_comms.StartHttpCommunicatorServiceWithClock(
+		self.client_ctx, self.client_wg, client_config, exe,
+		func(ctx context.Context, config_obj *config_proto.Config) {},
+		clock)
+	require.NoError(self.T(), err)
+
+	client := &Client{
+		ClientId:  wb.ClientId,
+		ConfigObj: client_config,
+		Comms:     comm,
+	}
+	self.Clients = append(self.Clients, client)
+
+	return client
+}
+
+// Wait until the server knows about the client.
+func (self *TestSuite) WaitForEnrolment(client *Client) {
+	client_info_manager, err := services.GetClientInfoManager(self.ConfigObj)
+	require.NoError(self.T(), err)
+
+	vtesting.WaitUntil(Timeout, self.T(), func() bool {
+		_, err := client_info_manager.Get(self.Ctx, client.ClientId)
+		return err == nil
+	})
+}
+
+// Collect the artifacts from the client and wait for the collection
+// to complete.
+func (self *TestSuite) CollectArtifact(
+	client_id string, artifacts ...string) *api_proto.FlowDetails {
+	manager, err := services.GetRepositoryManager(self.ConfigObj)
+	require.NoError(self.T(), err)
+
+	repository, err := manager.GetGlobalRepository(self.ConfigObj)
+	require.NoError(self.T(), err)
+
+	launcher, err := services.GetLauncher(self.ConfigObj)
+	require.NoError(self.T(), err)
+
+	request := &flows_proto.ArtifactCollectorArgs{
+		ClientId:  client_id,
+		Artifacts: artifacts,
+		Creator:   utils.GetSuperuserName(self.ConfigObj),
+	}
+
+	flow_id, err := launcher.ScheduleArtifactCollection(self.Ctx,
+		self.ConfigObj, acl_managers.NullACLManager{}, repository,
+		request, func() {
+			notifier, err := services.GetNotifier(self.ConfigObj)
+			if err == nil {
+				notifier.NotifyListener(self.Ctx, self.ConfigObj,
+					client_id, "integration")
+			}
+		})
+	require.NoError(self.T(), err)
+
+	var flow *api_proto.FlowDetails
+	vtesting.WaitUntil(Timeout, self.T(), func() bool {
+		flow, err = launcher.GetFlowDetails(self.Ctx, self.ConfigObj,
+			client_id, flow_id)
+		return err == nil && flow.Context != nil &&
+			flow.Context.State != flows_proto.ArtifactCollectorContext_RUNNING
+	})
+
+	return flow
+}
+
+// Start a hunt for the artifacts on all clients and wait until the
+// number of clients have completed it.
+func (self *TestSuite) RunHunt(
+	clients uint64, artifacts ...string) *api_proto.Hunt {
+	dispatcher, err := services.GetHuntDispatcher(self.ConfigObj)
+	require.NoError(self.T(), err)
+
+	hunt_obj, err := dispatcher.CreateHunt(self.Ctx, self.ConfigObj,
+		acl_managers.NullACLManager{}, &api_proto.Hunt{
+			Creator: utils.GetSuperuserName(self.ConfigObj),
+			State:   api_proto.Hunt_RUNNING,
+			StartRequest: &flows_proto.ArtifactCollectorArgs{
+				Artifacts: artifacts,
+			},
+			Expires: uint64(utils.GetTime().Now().Add(
+				time.Hour).UnixNano() / 1000),
+		})
+	require.NoError(self.T(), err)
+
+	vtesting.WaitUntil(Timeout, self.T(), func() bool {
+		hunt_obj, _ = dispatcher.GetHunt(self.Ctx, hunt_obj.HuntId)
+		return hunt_obj.Stats != nil &&
+			hunt_obj.Stats.TotalClientsWithResults >= clients
+	})
+
+	return hunt_obj
+}